@@ -117,10 +117,11 @@ func collectTaskActivitySignals(taskDir, latestRunID, status string, latestRunSt
 
 func readTaskBusSignals(taskDir string) (*activityBusMessage, *time.Time, error) {
 	busPath := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
-	bus, err := messagebus.NewMessageBus(busPath)
+	bus, err := messagebus.Open(busPath, "")
 	if err != nil {
 		return nil, nil, err
 	}
+	defer bus.Close()
 
 	msgs, err := bus.ReadMessages("")
 	if err != nil {
@@ -11,6 +11,7 @@ import (
 
 	"github.com/jonnyzzz/conductor-loop/internal/config"
 	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
 	"github.com/jonnyzzz/conductor-loop/internal/storage"
 	"github.com/spf13/cobra"
 )
@@ -22,7 +23,17 @@ func newBusCmd() *cobra.Command {
 	}
 	cmd.AddCommand(newBusPostCmd())
 	cmd.AddCommand(newBusReadCmd())
+	cmd.AddCommand(newBusAckCmd())
+	cmd.AddCommand(newBusSendCmd())
+	cmd.AddCommand(newBusInboxCmd())
+	cmd.AddCommand(newBusAskCmd())
+	cmd.AddCommand(newBusAnswerCmd())
 	cmd.AddCommand(newBusDiscoverCmd())
+	cmd.AddCommand(newBusSearchCmd())
+	cmd.AddCommand(newBusReindexCmd())
+	cmd.AddCommand(newBusMigrateCmd())
+	cmd.AddCommand(newBusExportCmd())
+	cmd.AddCommand(newBusLintCmd())
 	return cmd
 }
 
@@ -306,12 +317,14 @@ func resolveBusPostMessageContext(projectID, taskID, runID, busPath string) (res
 
 func newBusPostCmd() *cobra.Command {
 	var (
-		root      string
-		msgType   string
-		projectID string
-		taskID    string
-		runID     string
-		body      string
+		root       string
+		msgType    string
+		projectID  string
+		taskID     string
+		runID      string
+		body       string
+		meta       map[string]string
+		configPath string
 	)
 
 	cmd := &cobra.Command{
@@ -359,17 +372,25 @@ Use "run-agent bus discover" to preview auto-discovery from your current directo
 					body = string(data)
 				}
 			}
-			bus, err := messagebus.NewMessageBus(busPath)
+			syncBusSchemaPolicy(configPath, busPath)
+			bus, err := messagebus.Open(busPath, "")
 			if err != nil {
 				return err
 			}
+			defer bus.Close()
 			msg := &messagebus.Message{
 				Type:      msgType,
 				ProjectID: projectID,
 				TaskID:    taskID,
 				RunID:     runID,
+				Meta:      meta,
 				Body:      body,
 			}
+			// Strict validation fails the append below; warn mode only
+			// logs on the bus side, so tell the poster here.
+			if mode, verr := messagebus.CheckMessage(busPath, msg); verr != nil && mode == messagebus.ValidationWarn {
+				fmt.Fprintf(os.Stderr, "warning: %v\n", verr)
+			}
 			msgID, err := bus.AppendMessage(msg)
 			if err != nil {
 				return err
@@ -385,10 +406,33 @@ Use "run-agent bus discover" to preview auto-discovery from your current directo
 	cmd.Flags().StringVar(&taskID, "task", "", "task ID (optional; inferred from context if omitted)")
 	cmd.Flags().StringVar(&runID, "run", "", "run ID (optional; inferred from context if omitted)")
 	cmd.Flags().StringVar(&body, "body", "", "message body (reads from stdin if not provided and stdin is a pipe)")
+	cmd.Flags().StringToStringVar(&meta, "meta", nil, "message metadata key=value (repeatable), e.g. verdict=fail")
+	cmd.Flags().StringVar(&configPath, "config", "", "config file with the message_bus validation settings (default: auto-discovered)")
 
 	return cmd
 }
 
+// syncBusSchemaPolicy applies the message_bus validation of the config in
+// configPath, or of the auto-discovered config, to busPath before a command
+// appends to it, as runJob and the API server do. Without a config the policy
+// stored next to the bus stays; a config that fails to load is reported on
+// stderr.
+func syncBusSchemaPolicy(configPath, busPath string) {
+	if configPath == "" {
+		found, err := config.FindDefaultConfig()
+		if err != nil || found == "" {
+			return
+		}
+		configPath = found
+	}
+	cfg, err := config.LoadConfigForServer(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: message_bus settings skipped: %v\n", err)
+		return
+	}
+	runner.SyncBusSchemaPolicy(cfg.MessageBus, busPath)
+}
+
 func newBusReadCmd() *cobra.Command {
 	var (
 		root      string
@@ -396,6 +440,9 @@ func newBusReadCmd() *cobra.Command {
 		taskID    string
 		tail      int
 		follow    bool
+		where     string
+		consumer  string
+		ack       bool
 	)
 
 	cmd := &cobra.Command{
@@ -415,57 +462,42 @@ When --project is specified, the path is auto-resolved:
   - With --task:    <root>/<project>/<task>/TASK-MESSAGE-BUS.md
   - Without --task: <root>/<project>/PROJECT-MESSAGE-BUS.md
 
+--where filters messages with an expression over type, msg_id, project,
+task, run, issue, parent, body, ts and meta.<key>, for example:
+  --where 'type in (FACT,DECISION) and meta.kind = "task_completion_propagation" and ts > -2h'
+  --where 'type = ERROR or body ~ panic'
+--tail then counts matching messages.
+
+--consumer <name> reads only the messages after the named consumer's cursor,
+oldest first, at most --tail of them. With --ack the cursor then moves past
+the messages read, so the next call (for example by the next run of the same
+task) continues where this one stopped:
+  run-agent bus read --consumer "$JRUN_TASK_ID" --ack
+Without --ack the cursor is left alone; acknowledge after processing with
+"run-agent bus ack" for at-least-once handling.
+
 Use "run-agent bus discover" to preview auto-discovery from your current directory.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Resolve bus path: --project/--task > JRUN_MESSAGE_BUS env > CWD run-info > CWD project > auto-discover
-			var busPath string
-			if projectID != "" {
-				resolved, resolveErr := resolveBusFilePath(root, projectID, taskID)
-				if resolveErr != nil {
-					return resolveErr
-				}
-				busPath = resolved
-			}
-			if busPath == "" {
-				busPath = os.Getenv("JRUN_MESSAGE_BUS")
-			}
-			if busPath == "" {
-				// CWD run-info.yaml inference: running inside an agent run directory.
-				if cwdProject, cwdTask, _, cwdRoot := inferScopeFromCWDRunInfo(); cwdProject != "" {
-					useRoot := root
-					if useRoot == "" {
-						useRoot = cwdRoot
-					}
-					if resolved, err := resolveBusFilePath(useRoot, cwdProject, cwdTask); err == nil {
-						busPath = resolved
-					}
-				}
+			filter, err := messagebus.ParseFilter(where)
+			if err != nil {
+				return err
 			}
-			if busPath == "" {
-				// CWD project home inference: directory contains task-ID-formatted subdirs.
-				if cwdProject := inferProjectFromCWD(); cwdProject != "" {
-					if resolved, err := resolveBusFilePath(root, cwdProject, ""); err == nil {
-						busPath = resolved
-					}
-				}
+			if ack && consumer == "" {
+				return errors.New("--ack requires --consumer")
 			}
-			if busPath == "" {
-				discovered, err := discoverBusFilePath("")
-				if err != nil {
-					return fmt.Errorf("cannot find message bus: run from inside a task or project directory: %w", err)
-				}
-				busPath = discovered
+			busPath, err := resolveBusReadPath(root, projectID, taskID)
+			if err != nil {
+				return err
 			}
-			bus, err := messagebus.NewMessageBus(busPath, messagebus.WithPollInterval(500*time.Millisecond))
+			bus, err := messagebus.Open(busPath, "", messagebus.WithPollInterval(500*time.Millisecond))
 			if err != nil {
 				return err
 			}
-			var messages []*messagebus.Message
-			if tail > 0 {
-				messages, err = bus.ReadLastN(tail)
-			} else {
-				messages, err = bus.ReadMessages("")
+			defer bus.Close()
+			if consumer != "" {
+				return readConsumerMessages(bus, consumer, filter, tail, ack, follow)
 			}
+			messages, err := bus.ReadMessagesWhere(filter, tail)
 			if err != nil {
 				return err
 			}
@@ -490,7 +522,9 @@ Use "run-agent bus discover" to preview auto-discovery from your current directo
 					return err
 				}
 				for _, msg := range newMsgs {
-					printBusMessage(msg)
+					if filter.Match(msg) {
+						printBusMessage(msg)
+					}
 					lastID = msg.MsgID
 				}
 			}
@@ -502,10 +536,57 @@ Use "run-agent bus discover" to preview auto-discovery from your current directo
 	cmd.Flags().StringVar(&taskID, "task", "", "task ID (requires --project; resolves task-level bus)")
 	cmd.Flags().IntVar(&tail, "tail", 20, "print last N messages")
 	cmd.Flags().BoolVar(&follow, "follow", false, "watch for new messages (Ctrl-C to exit)")
+	cmd.Flags().StringVar(&where, "where", "", "filter expression, e.g. 'type = FACT and ts > -2h'")
+	cmd.Flags().StringVar(&consumer, "consumer", "", "read only messages not yet acknowledged by this named consumer")
+	cmd.Flags().BoolVar(&ack, "ack", false, "acknowledge the messages read (requires --consumer)")
 
 	return cmd
 }
 
+// resolveBusReadPath resolves the bus to read from:
+// --project/--task > JRUN_MESSAGE_BUS env > CWD run-info > CWD project > auto-discover.
+func resolveBusReadPath(root, projectID, taskID string) (string, error) {
+	var busPath string
+	if projectID != "" {
+		resolved, resolveErr := resolveBusFilePath(root, projectID, taskID)
+		if resolveErr != nil {
+			return "", resolveErr
+		}
+		busPath = resolved
+	}
+	if busPath == "" {
+		busPath = os.Getenv("JRUN_MESSAGE_BUS")
+	}
+	if busPath == "" {
+		// CWD run-info.yaml inference: running inside an agent run directory.
+		if cwdProject, cwdTask, _, cwdRoot := inferScopeFromCWDRunInfo(); cwdProject != "" {
+			useRoot := root
+			if useRoot == "" {
+				useRoot = cwdRoot
+			}
+			if resolved, err := resolveBusFilePath(useRoot, cwdProject, cwdTask); err == nil {
+				busPath = resolved
+			}
+		}
+	}
+	if busPath == "" {
+		// CWD project home inference: directory contains task-ID-formatted subdirs.
+		if cwdProject := inferProjectFromCWD(); cwdProject != "" {
+			if resolved, err := resolveBusFilePath(root, cwdProject, ""); err == nil {
+				busPath = resolved
+			}
+		}
+	}
+	if busPath == "" {
+		discovered, err := discoverBusFilePath("")
+		if err != nil {
+			return "", fmt.Errorf("cannot find message bus: run from inside a task or project directory: %w", err)
+		}
+		busPath = discovered
+	}
+	return busPath, nil
+}
+
 func newBusDiscoverCmd() *cobra.Command {
 	var fromDir string
 
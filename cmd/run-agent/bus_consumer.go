@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/spf13/cobra"
+)
+
+func newBusAckCmd() *cobra.Command {
+	var (
+		root      string
+		projectID string
+		taskID    string
+		consumer  string
+		reset     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "ack [msg-id]",
+		Short: "Acknowledge messages for a named consumer",
+		Long: `Move the cursor of a named consumer to msg-id, or to the newest message
+on the bus when msg-id is omitted. Later "run-agent bus read --consumer"
+calls only return messages after the cursor. Cursors never move backwards;
+acknowledging an older message is a no-op.
+
+The bus is resolved like "run-agent bus read". Cursors are stored next to
+the bus in <bus>.cursors.json.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if consumer == "" {
+				return errors.New("--consumer is required")
+			}
+			if reset && len(args) > 0 {
+				return errors.New("--reset does not take a msg-id")
+			}
+			busPath, err := resolveBusReadPath(root, projectID, taskID)
+			if err != nil {
+				return err
+			}
+			bus, err := messagebus.Open(busPath, "")
+			if err != nil {
+				return err
+			}
+			defer bus.Close()
+			if reset {
+				existed, err := bus.ResetCursor(consumer)
+				if err != nil {
+					return err
+				}
+				if !existed {
+					fmt.Printf("consumer %s has no cursor\n", consumer)
+					return nil
+				}
+				fmt.Printf("reset cursor of consumer %s\n", consumer)
+				return nil
+			}
+			var msgID string
+			if len(args) > 0 {
+				msgID = args[0]
+			} else {
+				last, err := bus.ReadLastN(1)
+				if err != nil {
+					return err
+				}
+				if len(last) == 0 {
+					return errors.New("message bus is empty")
+				}
+				msgID = last[0].MsgID
+			}
+			cursor, err := bus.Ack(consumer, msgID)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("consumer %s: %s\n", consumer, cursor.MsgID)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory for project/task bus resolution (default: ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (without --task uses the project-level bus)")
+	cmd.Flags().StringVar(&taskID, "task", "", "task ID (requires --project; uses the task-level bus)")
+	cmd.Flags().StringVar(&consumer, "consumer", "", "consumer name (required)")
+	cmd.Flags().BoolVar(&reset, "reset", false, "delete the consumer cursor so it reads the bus from the start")
+
+	return cmd
+}
+
+// readConsumerMessages prints the messages after the cursor of consumer, at
+// most tail of them per batch (all when tail <= 0). Messages rejected by
+// filter still count as read. With ack the cursor follows the messages read.
+func readConsumerMessages(bus messagebus.Bus, consumer string, filter *messagebus.Filter, tail int, ack, follow bool) error {
+	// since tracks our own position once a batch was read, so follow mode
+	// without --ack does not print the same messages again.
+	var since string
+	for {
+		var (
+			messages []*messagebus.Message
+			err      error
+		)
+		if since == "" {
+			messages, err = bus.ReadUnacked(consumer, 0)
+		} else {
+			messages, err = bus.ReadMessages(since)
+			if errors.Is(err, messagebus.ErrSinceIDNotFound) {
+				since = ""
+				continue
+			}
+		}
+		if err != nil {
+			return err
+		}
+		printed := 0
+		var last string
+		for _, msg := range messages {
+			if tail > 0 && printed >= tail {
+				break
+			}
+			if filter.Match(msg) {
+				printBusMessage(msg)
+				printed++
+			}
+			last = msg.MsgID
+		}
+		if last != "" {
+			since = last
+			if ack {
+				if _, err := bus.Ack(consumer, last); err != nil {
+					return err
+				}
+			}
+		}
+		if !follow {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/busexport"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/spf13/cobra"
+)
+
+func newBusExportCmd() *cobra.Command {
+	var (
+		root          string
+		projectID     string
+		taskID        string
+		format        string
+		output        string
+		title         string
+		since         string
+		until         string
+		types         []string
+		where         string
+		keepRunEvents bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a message bus as a readable task log",
+		Long: `Export a message bus as a task log to attach to tickets and reviews.
+
+The bus is resolved like "run-agent bus read". Messages are grouped by run,
+replies are nested under the messages they reference in parents (answers
+under questions, for example), and RUN_START/RUN_STOP events are collapsed
+into the run headers (use --keep-run-events to list them). RUN_CRASH
+messages stay visible.
+
+Formats: markdown (default), html (a standalone page), json (the threaded
+document) and csv (one row per message with its thread depth).
+
+--since and --until accept RFC3339 timestamps, dates (2006-01-02) or offsets
+from now such as -2h or -7d; --type keeps only the given message types and
+--where applies a filter expression as in "run-agent bus read":
+  run-agent bus export --project my-project --task task-20260101-120000-fix --format html -o log.html
+  run-agent bus export --since -1d --type FACT,DECISION,QUESTION,ANSWER`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := busexport.NormalizeFormat(format)
+			if err != nil {
+				return err
+			}
+			opts := busexport.Options{Title: title, Types: types, KeepRunEvents: keepRunEvents}
+			now := time.Now()
+			if since != "" {
+				if opts.Since, err = messagebus.ParseTime(since, now); err != nil {
+					return fmt.Errorf("--since: %w", err)
+				}
+			}
+			if until != "" {
+				if opts.Until, err = messagebus.ParseTime(until, now); err != nil {
+					return fmt.Errorf("--until: %w", err)
+				}
+			}
+			if opts.Filter, err = messagebus.ParseFilter(where); err != nil {
+				return err
+			}
+			busPath, err := resolveBusReadPath(root, projectID, taskID)
+			if err != nil {
+				return err
+			}
+			if opts.Title == "" {
+				opts.Title = busExportTitle(busPath)
+			}
+			bus, err := messagebus.Open(busPath, "")
+			if err != nil {
+				return err
+			}
+			defer bus.Close()
+			messages, err := bus.ReadMessages("")
+			if err != nil {
+				return err
+			}
+
+			if output == "" || output == "-" {
+				return busexport.Export(os.Stdout, messages, format, opts)
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("create output: %w", err)
+			}
+			if err := busexport.Export(f, messages, format, opts); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("write output: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "exported %s to %s\n", busPath, output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory for project/task bus resolution (default: ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (optional; inferred from context if omitted)")
+	cmd.Flags().StringVar(&taskID, "task", "", "task ID (requires --project; inferred from context if omitted)")
+	cmd.Flags().StringVar(&format, "format", busexport.FormatMarkdown, "output format: "+strings.Join(busexport.Formats, ", "))
+	cmd.Flags().StringVarP(&output, "output", "o", "", "write to this file instead of stdout")
+	cmd.Flags().StringVar(&title, "title", "", "document title (default: the project/task of the bus)")
+	cmd.Flags().StringVar(&since, "since", "", "only messages at or after this time (RFC3339, date or offset like -2h)")
+	cmd.Flags().StringVar(&until, "until", "", "only messages at or before this time (RFC3339, date or offset like -2h)")
+	cmd.Flags().StringSliceVar(&types, "type", nil, "only these message types (repeatable or comma-separated)")
+	cmd.Flags().StringVar(&where, "where", "", "filter expression, e.g. 'type = FACT and ts > -2h'")
+	cmd.Flags().BoolVar(&keepRunEvents, "keep-run-events", false, "list RUN_START/RUN_STOP messages instead of collapsing them into run headers")
+
+	return cmd
+}
+
+// busExportTitle names an export after the project and task of its bus.
+func busExportTitle(busPath string) string {
+	projectID, taskID := inferMessageScopeFromBusPath(busPath)
+	switch {
+	case projectID == "":
+		return "Message bus export"
+	case taskID == "":
+		return "Project " + projectID
+	}
+	return "Task " + projectID + "/" + taskID
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/spf13/cobra"
+)
+
+func newBusSendCmd() *cobra.Command {
+	var (
+		root       string
+		projectID  string
+		toTask     string
+		toRun      string
+		msgType    string
+		body       string
+		configPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "send",
+		Short: "Send a directed message to another task of the project",
+		Long: `Send a message to the inbox of another task of the same project.
+
+The message is appended to <root>/<project>/<task>/TASK-MESSAGE-BUS.md with
+to_task (and, with --to-run, to_run) set. Runs of the recipient task see it
+with "run-agent bus inbox", and the next run of the task gets every inbox
+message not seen yet in its prompt. Use --to-run to address one specific
+running child; other runs of the task ignore it.
+
+The sending project, task and run are inferred like "run-agent bus post".
+Without --root, the recipient is looked up next to the sender's own bus.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			toTask = strings.TrimSpace(toTask)
+			if toTask == "" {
+				return errors.New("--to is required")
+			}
+			if toTask == "." || toTask == ".." || filepath.Base(toTask) != toTask || strings.ContainsAny(toTask, `/\`) {
+				return fmt.Errorf("invalid --to task %q", toTask)
+			}
+			senderBus, _ := resolveBusPostPath(root, projectID, "")
+			var fromTask, fromRun string
+			projectID, fromTask, fromRun = resolveBusPostMessageContext(projectID, "", "", senderBus)
+			if projectID == "" {
+				return fmt.Errorf("cannot infer project: pass --project or run from inside a task or project directory")
+			}
+			busPath, err := resolveTaskInboxPath(root, projectID, toTask, senderBus)
+			if err != nil {
+				return err
+			}
+			if body == "" {
+				info, err := os.Stdin.Stat()
+				if err == nil && (info.Mode()&os.ModeCharDevice) == 0 {
+					data, err := io.ReadAll(os.Stdin)
+					if err != nil {
+						return fmt.Errorf("read stdin: %w", err)
+					}
+					body = string(data)
+				}
+			}
+			if strings.TrimSpace(body) == "" {
+				return errors.New("message body is empty (use --body or stdin)")
+			}
+			syncBusSchemaPolicy(configPath, busPath)
+			bus, err := messagebus.Open(busPath, "")
+			if err != nil {
+				return err
+			}
+			defer bus.Close()
+			msgID, err := bus.AppendMessage(&messagebus.Message{
+				Type:      msgType,
+				ProjectID: projectID,
+				TaskID:    fromTask,
+				RunID:     fromRun,
+				ToTask:    toTask,
+				ToRun:     strings.TrimSpace(toRun),
+				Body:      body,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("msg_id: %s\n", msgID)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory (default: next to the sender's bus, then ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (optional; inferred from context if omitted)")
+	cmd.Flags().StringVar(&toTask, "to", "", "recipient task ID (required)")
+	cmd.Flags().StringVar(&toRun, "to-run", "", "recipient run ID (optional; only this run of the task sees the message)")
+	cmd.Flags().StringVar(&msgType, "type", "INFO", "message type")
+	cmd.Flags().StringVar(&body, "body", "", "message body (reads from stdin if not provided and stdin is a pipe)")
+	cmd.Flags().StringVar(&configPath, "config", "", "config file with the message_bus validation settings (default: auto-discovered)")
+
+	return cmd
+}
+
+// resolveTaskInboxPath returns the bus of task toTask in projectID. Agents
+// usually run without --root, so the sender's own bus locates the project
+// directory when it belongs to the same project.
+func resolveTaskInboxPath(root, projectID, toTask, senderBus string) (string, error) {
+	var taskDir string
+	if root == "" && senderBus != "" {
+		busProject, busTask := inferMessageScopeFromBusPath(senderBus)
+		if busProject == projectID {
+			projectDir := filepath.Dir(senderBus)
+			if busTask != "" {
+				projectDir = filepath.Dir(projectDir)
+			}
+			taskDir = filepath.Join(projectDir, toTask)
+		}
+	}
+	if taskDir == "" {
+		busPath, err := resolveBusFilePath(root, projectID, toTask)
+		if err != nil {
+			return "", err
+		}
+		taskDir = filepath.Dir(busPath)
+	}
+	if info, err := os.Stat(taskDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("task %s not found in project %s (%s)", toTask, projectID, taskDir)
+	}
+	return filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"), nil
+}
+
+func newBusInboxCmd() *cobra.Command {
+	var (
+		root      string
+		projectID string
+		taskID    string
+		runID     string
+		all       bool
+		ack       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "inbox",
+		Short: "Show the directed messages sent to a task",
+		Long: `Show the messages sent to a task with "run-agent bus send".
+
+By default only messages that no run of the task has seen yet are shown;
+--ack marks them as seen. Messages addressed to a specific run (to_run) are
+only shown to that run. Inside an agent run the task and run are taken from
+JRUN_MESSAGE_BUS and JRUN_ID:
+  run-agent bus inbox --ack`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			busPath, err := resolveBusReadPath(root, projectID, taskID)
+			if err != nil {
+				return err
+			}
+			_, busTask := inferMessageScopeFromBusPath(busPath)
+			inboxTask := firstNonEmpty(taskID, busTask, os.Getenv("JRUN_TASK_ID"))
+			if inboxTask == "" {
+				return errors.New("cannot infer task: pass --project and --task")
+			}
+			if runID == "" {
+				runID = os.Getenv("JRUN_ID")
+			}
+			bus, err := messagebus.Open(busPath, "")
+			if err != nil {
+				return err
+			}
+			defer bus.Close()
+			inbox, err := bus.ReadInbox(inboxTask, runID, !all)
+			if err != nil {
+				return err
+			}
+			if len(inbox) == 0 {
+				fmt.Println("No new messages")
+				return nil
+			}
+			for _, msg := range inbox {
+				printInboxMessage(msg)
+			}
+			if ack {
+				if _, err := bus.Ack(messagebus.InboxConsumer, inbox[len(inbox)-1].MsgID); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory for project/task bus resolution (default: ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (optional; inferred from context if omitted)")
+	cmd.Flags().StringVar(&taskID, "task", "", "task ID (requires --project; inferred from context if omitted)")
+	cmd.Flags().StringVar(&runID, "run", "", "run ID whose run-specific messages to include (default: JRUN_ID)")
+	cmd.Flags().BoolVar(&all, "all", false, "show messages already seen too")
+	cmd.Flags().BoolVar(&ack, "ack", false, "mark the shown messages as seen")
+
+	return cmd
+}
+
+func printInboxMessage(msg *messagebus.Message) {
+	ts := msg.Timestamp.Format("2006-01-02 15:04:05")
+	sender := firstNonEmpty(msg.TaskID, msg.ProjectID)
+	if msg.RunID != "" {
+		sender += "/" + msg.RunID
+	}
+	fmt.Printf("[%s] (%s) from %s: %s\n", ts, msg.Type, sender, msg.Body)
+}
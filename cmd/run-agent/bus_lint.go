@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/spf13/cobra"
+)
+
+func newBusLintCmd() *cobra.Command {
+	var (
+		root       string
+		projectID  string
+		taskID     string
+		configPath string
+		all        bool
+		listTypes  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check bus messages against the message type schemas",
+		Long: `Check the messages of a bus against the registry of message types: the
+type must be known and the message must have the fields, body structure and
+meta values its schema requires. The bus is resolved like "run-agent bus read";
+--all checks every project and task bus under the runs root.
+
+Schemas come from --config (message_bus.types), otherwise from the schema
+policy the runner stored next to the bus (<bus>.schema.json), otherwise the
+built-in types are used. The command fails when any message is invalid.
+--list-types prints the registry instead.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			var (
+				cfgTypes []messagebus.TypeSchema
+				fromCfg  bool
+			)
+			if configPath != "" {
+				cfg, err := config.LoadConfigForServer(configPath)
+				if err != nil {
+					return err
+				}
+				cfgTypes, fromCfg = cfg.MessageBus.Types, true
+			}
+			if listTypes {
+				reg, err := messagebus.NewRegistry(cfgTypes...)
+				if err != nil {
+					return err
+				}
+				printMessageTypes(out, reg)
+				return nil
+			}
+
+			var busPaths []string
+			if all {
+				if projectID != "" || taskID != "" {
+					return fmt.Errorf("--all cannot be combined with --project or --task")
+				}
+				resolved, err := config.ResolveRunsDir(root)
+				if err != nil {
+					return fmt.Errorf("resolve runs dir: %w", err)
+				}
+				if busPaths, err = listBusFiles(resolved); err != nil {
+					return err
+				}
+			} else {
+				busPath, err := resolveBusReadPath(root, projectID, taskID)
+				if err != nil {
+					return err
+				}
+				busPaths = []string{busPath}
+			}
+
+			checked, invalid := 0, 0
+			for _, busPath := range busPaths {
+				types := cfgTypes
+				if !fromCfg {
+					policy, _, err := messagebus.ReadSchemaPolicy(busPath)
+					if err != nil {
+						return fmt.Errorf("%s: %w", busPath, err)
+					}
+					types = policy.Types
+				}
+				reg, err := messagebus.NewRegistry(types...)
+				if err != nil {
+					return fmt.Errorf("%s: %w", busPath, err)
+				}
+				bus, err := messagebus.Open(busPath, "")
+				if err != nil {
+					return err
+				}
+				messages, err := bus.ReadMessages("")
+				bus.Close()
+				if err != nil {
+					return fmt.Errorf("%s: %w", busPath, err)
+				}
+				for _, msg := range messages {
+					checked++
+					if err := reg.Validate(msg); err != nil {
+						invalid++
+						fmt.Fprintf(out, "%s: %v\n", busPath, err)
+					}
+				}
+			}
+			fmt.Fprintf(out, "%d messages checked in %d buses, %d invalid\n", checked, len(busPaths), invalid)
+			if invalid > 0 {
+				return fmt.Errorf("%d invalid messages", invalid)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory (default: ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (optional; inferred from context if omitted)")
+	cmd.Flags().StringVar(&taskID, "task", "", "task ID (requires --project; inferred from context if omitted)")
+	cmd.Flags().StringVar(&configPath, "config", "", "config file with message_bus.types (default: the bus schema policy)")
+	cmd.Flags().BoolVar(&all, "all", false, "check every project and task bus under the root")
+	cmd.Flags().BoolVar(&listTypes, "list-types", false, "print the known message types and their rules")
+
+	return cmd
+}
+
+func printMessageTypes(out io.Writer, reg *messagebus.Registry) {
+	for _, schema := range reg.Types() {
+		fmt.Fprintf(out, "%-16s %s\n", schema.Type, schema.Description)
+		var rules []string
+		if len(schema.Required) > 0 {
+			rules = append(rules, "required: "+strings.Join(schema.Required, ", "))
+		}
+		if schema.BodyPattern != "" {
+			rules = append(rules, "body matches: "+schema.BodyPattern)
+		}
+		if schema.Where != "" {
+			rules = append(rules, "where: "+schema.Where)
+		}
+		for _, rule := range rules {
+			fmt.Fprintf(out, "%-16s   %s\n", "", rule)
+		}
+	}
+}
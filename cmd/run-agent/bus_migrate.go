@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/spf13/cobra"
+)
+
+func newBusMigrateCmd() *cobra.Command {
+	var (
+		root      string
+		projectID string
+		taskID    string
+		all       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Import message bus files into the SQLite backend",
+		Long: `Import the messages and consumer cursors of a markdown message bus
+into <bus>.db, the SQLite backend database. The bus is resolved like
+"run-agent bus read"; --all migrates every project and task bus under the
+runs root.
+
+Once a bus has a database every writer goes through it, whatever
+storage.bus_backend says, and the markdown file is kept up to date as an
+export for agents. Migrating a bus that already has a database imports
+nothing. Archived segments are not imported; compaction archives stay
+readable through their manifest.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var busPaths []string
+			if all {
+				if projectID != "" || taskID != "" {
+					return fmt.Errorf("--all cannot be combined with --project or --task")
+				}
+				resolved, err := config.ResolveRunsDir(root)
+				if err != nil {
+					return fmt.Errorf("resolve runs dir: %w", err)
+				}
+				busPaths, err = listBusFiles(resolved)
+				if err != nil {
+					return err
+				}
+			} else {
+				busPath, err := resolveBusReadPath(root, projectID, taskID)
+				if err != nil {
+					return err
+				}
+				busPaths = []string{busPath}
+			}
+			for _, busPath := range busPaths {
+				n, err := messagebus.MigrateToSQLite(busPath)
+				if err != nil {
+					return fmt.Errorf("migrate %s: %w", busPath, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %d messages imported\n", busPath, n)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory (default: ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (optional; inferred from context if omitted)")
+	cmd.Flags().StringVar(&taskID, "task", "", "task ID (requires --project; inferred from context if omitted)")
+	cmd.Flags().BoolVar(&all, "all", false, "migrate every project and task bus under the root")
+
+	return cmd
+}
+
+// listBusFiles returns the project and task bus files under root, sorted.
+func listBusFiles(root string) ([]string, error) {
+	var paths []string
+	for _, pattern := range []string{
+		filepath.Join(root, "*", "PROJECT-MESSAGE-BUS.md"),
+		filepath.Join(root, "*", "*", "TASK-MESSAGE-BUS.md"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("list message buses: %w", err)
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
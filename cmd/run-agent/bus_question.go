@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/webhook"
+	"github.com/spf13/cobra"
+)
+
+func newBusAskCmd() *cobra.Command {
+	var (
+		root       string
+		projectID  string
+		taskID     string
+		runID      string
+		body       string
+		configPath string
+		wait       bool
+		timeout    time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "ask",
+		Short: "Post a QUESTION for a human and optionally wait for the answer",
+		Long: `Post a QUESTION message to the message bus and notify the configured
+webhook (event "question"). The bus and the message project/task/run are
+resolved like "run-agent bus post".
+
+With --wait the command blocks until an ANSWER threaded to the question
+appears on the same bus and prints the answer body to stdout. Humans answer
+from the web UI, the API or "run-agent bus answer". With --timeout the
+command fails when no answer arrives in time:
+  run-agent bus ask --wait --timeout 30m --body "Deploy to production?"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			busPath, err := resolveBusPostPath(root, projectID, taskID)
+			if err != nil {
+				return err
+			}
+			projectID, taskID, runID = resolveBusPostMessageContext(projectID, taskID, runID, busPath)
+			if projectID == "" {
+				return fmt.Errorf("cannot infer project: run from inside a task or project directory")
+			}
+			body, err := readBusMessageBody(body)
+			if err != nil {
+				return err
+			}
+			syncBusSchemaPolicy(configPath, busPath)
+			bus, err := messagebus.Open(busPath, "")
+			if err != nil {
+				return err
+			}
+			defer bus.Close()
+			question := &messagebus.Message{
+				Type:      messagebus.TypeQuestion,
+				ProjectID: projectID,
+				TaskID:    taskID,
+				RunID:     runID,
+				Body:      body,
+			}
+			msgID, err := bus.AppendMessage(question)
+			if err != nil {
+				return err
+			}
+			notifyQuestion(configPath, question)
+			if !wait {
+				fmt.Printf("msg_id: %s\n", msgID)
+				return nil
+			}
+
+			fmt.Fprintf(os.Stderr, "msg_id: %s\nwaiting for an answer...\n", msgID)
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			answer, err := bus.WaitForAnswer(ctx, msgID)
+			if errors.Is(err, context.DeadlineExceeded) {
+				return fmt.Errorf("no answer to %s within %s", msgID, timeout)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println(strings.TrimSpace(answer.Body))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory for project/task bus resolution (default: ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (optional; inferred from context if omitted)")
+	cmd.Flags().StringVar(&taskID, "task", "", "task ID (optional; inferred from context if omitted)")
+	cmd.Flags().StringVar(&runID, "run", "", "run ID (optional; inferred from context if omitted)")
+	cmd.Flags().StringVar(&body, "body", "", "question text (reads from stdin if not provided and stdin is a pipe)")
+	cmd.Flags().StringVar(&configPath, "config", "", "config file with the webhook and message_bus settings (default: auto-discovered)")
+	cmd.Flags().BoolVar(&wait, "wait", false, "block until the question is answered and print the answer")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "with --wait, fail when no answer arrives within this duration (0 = wait forever)")
+
+	return cmd
+}
+
+func newBusAnswerCmd() *cobra.Command {
+	var (
+		root       string
+		projectID  string
+		taskID     string
+		body       string
+		configPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "answer <question-msg-id>",
+		Short: "Answer a QUESTION posted with \"run-agent bus ask\"",
+		Long: `Post an ANSWER threaded to a QUESTION message. The answer is appended to
+the bus holding the question, which is resolved like "run-agent bus read",
+and is also delivered to the inbox of the asking task and run.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			busPath, err := resolveBusReadPath(root, projectID, taskID)
+			if err != nil {
+				return err
+			}
+			body, err := readBusMessageBody(body)
+			if err != nil {
+				return err
+			}
+			syncBusSchemaPolicy(configPath, busPath)
+			bus, err := messagebus.Open(busPath, "")
+			if err != nil {
+				return err
+			}
+			defer bus.Close()
+			messages, err := bus.ReadMessages("")
+			if err != nil {
+				return err
+			}
+			questionID := strings.TrimSpace(args[0])
+			var question *messagebus.Message
+			for _, msg := range messages {
+				if msg.MsgID == questionID {
+					question = msg
+					break
+				}
+			}
+			if question == nil || !strings.EqualFold(question.Type, messagebus.TypeQuestion) {
+				return fmt.Errorf("question %s not found in %s", questionID, busPath)
+			}
+			if answer := messagebus.FindAnswer(messages, questionID); answer != nil {
+				return fmt.Errorf("question %s is already answered by %s", questionID, answer.MsgID)
+			}
+			msgID, err := bus.AppendMessage(messagebus.NewAnswer(question, body))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("msg_id: %s\n", msgID)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory for project/task bus resolution (default: ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (optional; inferred from context if omitted)")
+	cmd.Flags().StringVar(&taskID, "task", "", "task ID (requires --project; inferred from context if omitted)")
+	cmd.Flags().StringVar(&body, "body", "", "answer text (reads from stdin if not provided and stdin is a pipe)")
+	cmd.Flags().StringVar(&configPath, "config", "", "config file with the message_bus validation settings (default: auto-discovered)")
+
+	return cmd
+}
+
+// readBusMessageBody returns body, or stdin when body is empty and stdin is
+// a pipe. An empty result is an error.
+func readBusMessageBody(body string) (string, error) {
+	if body == "" {
+		info, err := os.Stdin.Stat()
+		if err == nil && (info.Mode()&os.ModeCharDevice) == 0 {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return "", fmt.Errorf("read stdin: %w", err)
+			}
+			body = string(data)
+		}
+	}
+	if strings.TrimSpace(body) == "" {
+		return "", errors.New("message body is empty (use --body or stdin)")
+	}
+	return body, nil
+}
+
+// notifyQuestion sends the question webhook configured in configPath (or the
+// default config). Delivery problems are reported on stderr only: the
+// question is already on the bus.
+func notifyQuestion(configPath string, question *messagebus.Message) {
+	if configPath == "" {
+		found, err := config.FindDefaultConfig()
+		if err != nil || found == "" {
+			return
+		}
+		configPath = found
+	}
+	cfg, err := config.LoadConfigForServer(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: question webhook skipped: %v\n", err)
+		return
+	}
+	err = webhook.NewNotifier(cfg.Webhook).SendQuestion(webhook.QuestionPayload{
+		ProjectID: question.ProjectID,
+		TaskID:    question.TaskID,
+		RunID:     question.RunID,
+		MsgID:     question.MsgID,
+		Body:      question.Body,
+		AskedAt:   question.Timestamp,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: question webhook: %v\n", err)
+	}
+}
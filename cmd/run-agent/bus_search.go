@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/bussearch"
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/spf13/cobra"
+)
+
+func newBusSearchCmd() *cobra.Command {
+	var (
+		root      string
+		projectID string
+		where     string
+		limit     int
+		jsonOut   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search messages across all project and task buses",
+		Long: `Search messages across every project and task message bus under the runs root.
+
+All words must match (case-insensitive). A trailing * matches a prefix and
+"quoted phrases" must appear verbatim in the body:
+  run-agent bus search 'deploy fail*'
+  run-agent bus search '"connection refused"' --project my-project --where 'type = ERROR'
+
+The search index lives in <root>/.search and is brought up to date with the
+newly appended messages before every search. Use "run-agent bus reindex"
+to rebuild it from scratch.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := messagebus.ParseFilter(where)
+			if err != nil {
+				return err
+			}
+			root, err = config.ResolveRunsDir(root)
+			if err != nil {
+				return fmt.Errorf("resolve runs dir: %w", err)
+			}
+			hits, err := bussearch.Search(root, args[0], bussearch.Options{
+				Project: projectID,
+				Filter:  filter,
+				Limit:   limit,
+			})
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return encodeJSON(cmd.OutOrStdout(), map[string]interface{}{"query": args[0], "hits": hits})
+			}
+			printSearchHits(cmd.OutOrStdout(), hits)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory (default: ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "only search this project")
+	cmd.Flags().StringVar(&where, "where", "", "filter expression, e.g. 'type = FACT and ts > -2h'")
+	cmd.Flags().IntVar(&limit, "limit", bussearch.DefaultLimit, "maximum number of hits")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "output hits as JSON")
+
+	return cmd
+}
+
+func newBusReindexCmd() *cobra.Command {
+	var root string
+
+	cmd := &cobra.Command{
+		Use:   "reindex",
+		Short: "Rebuild the message bus search index",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var err error
+			root, err = config.ResolveRunsDir(root)
+			if err != nil {
+				return fmt.Errorf("resolve runs dir: %w", err)
+			}
+			stats, err := bussearch.Rebuild(root)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Indexed %d messages from %d buses\n", stats.Messages, stats.Buses)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "root directory (default: ~/.run-agent/runs)")
+	return cmd
+}
+
+func printSearchHits(out io.Writer, hits []bussearch.Hit) {
+	if len(hits) == 0 {
+		fmt.Fprintln(out, "No matching messages")
+		return
+	}
+	for _, hit := range hits {
+		scope := hit.ProjectID
+		if hit.TaskID != "" {
+			scope += "/" + hit.TaskID
+		}
+		if hit.RunID != "" {
+			scope += " " + hit.RunID
+		}
+		ts := hit.Timestamp.Format("2006-01-02 15:04:05")
+		fmt.Fprintf(out, "[%s] %s (%s) %s\n", ts, scope, hit.Type, hit.MsgID)
+		fmt.Fprintf(out, "    %s\n", strings.TrimSpace(hit.Snippet))
+	}
+}
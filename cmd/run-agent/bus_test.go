@@ -1,11 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/jonnyzzz/conductor-loop/internal/bussearch"
 	"github.com/jonnyzzz/conductor-loop/internal/config"
 	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 	"github.com/jonnyzzz/conductor-loop/internal/storage"
@@ -928,3 +934,533 @@ func TestBusPostInfersFromProjectHomeCWD(t *testing.T) {
 		t.Errorf("project_id=%q, want %q", messages[0].ProjectID, "home-project")
 	}
 }
+
+func TestBusReadWhere(t *testing.T) {
+	root := t.TempDir()
+	projDir := filepath.Join(root, "proj")
+	if err := os.MkdirAll(projDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	bus, err := messagebus.NewMessageBus(filepath.Join(projDir, "PROJECT-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("create project bus: %v", err)
+	}
+	for _, msg := range []*messagebus.Message{
+		{Type: "FACT", ProjectID: "proj", Body: "fact-one", Meta: map[string]string{"kind": "decision"}},
+		{Type: "ERROR", ProjectID: "proj", Body: "error-one"},
+		{Type: "FACT", ProjectID: "proj", Body: "fact-two"},
+	} {
+		if _, err := bus.AppendMessage(msg); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	cmd := newRootCmd()
+	cmd.SetArgs([]string{"bus", "read", "--root", root, "--project", "proj", "--where", `type = FACT and meta.kind = "decision" or type = error`})
+	var runErr error
+	out := captureStdout(t, func() { runErr = cmd.Execute() })
+	if runErr != nil {
+		t.Fatalf("bus read --where failed: %v", runErr)
+	}
+	if !strings.Contains(out, "fact-one") || !strings.Contains(out, "error-one") || strings.Contains(out, "fact-two") {
+		t.Fatalf("unexpected filtered output: %q", out)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetArgs([]string{"bus", "read", "--root", root, "--project", "proj", "--where", "type =="})
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "where:") {
+		t.Fatalf("expected where parse error, got %v", err)
+	}
+}
+
+func TestBusSearchAndReindex(t *testing.T) {
+	root := t.TempDir()
+	for _, project := range []string{"alpha", "beta"} {
+		if err := os.MkdirAll(filepath.Join(root, project), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		bus, err := messagebus.NewMessageBus(filepath.Join(root, project, "PROJECT-MESSAGE-BUS.md"))
+		if err != nil {
+			t.Fatalf("create project bus: %v", err)
+		}
+		if _, err := bus.AppendMessage(&messagebus.Message{Type: "FACT", ProjectID: project, Body: "release checklist for " + project}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"bus", "search", "checklist", "--root", root, "--where", "project = beta"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("bus search failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "beta (FACT)") || !strings.Contains(out.String(), "release checklist for beta") || strings.Contains(out.String(), "alpha") {
+		t.Fatalf("unexpected search output: %q", out.String())
+	}
+
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"bus", "reindex", "--root", root})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("bus reindex failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Indexed 2 messages from 2 buses") {
+		t.Fatalf("unexpected reindex output: %q", out.String())
+	}
+
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"bus", "search", "release", "--root", root, "--json", "--limit", "1"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("bus search --json failed: %v", err)
+	}
+	var resp struct {
+		Query string          `json:"query"`
+		Hits  []bussearch.Hit `json:"hits"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v: %s", err, out.String())
+	}
+	if resp.Query != "release" || len(resp.Hits) != 1 || resp.Hits[0].ProjectID != "beta" {
+		t.Fatalf("unexpected json hits: %+v", resp)
+	}
+
+	// The index directory is not a project.
+	out.Reset()
+	if err := listProjects(&out, root, false); err != nil {
+		t.Fatalf("listProjects: %v", err)
+	}
+	if strings.Contains(out.String(), bussearch.DirName) {
+		t.Fatalf("index dir listed as project: %q", out.String())
+	}
+}
+
+func TestBusReadConsumerAck(t *testing.T) {
+	root := t.TempDir()
+	taskDir := filepath.Join(root, "proj", "task-20260101-000000-cursor")
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	bus, err := messagebus.NewMessageBus(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("create task bus: %v", err)
+	}
+	var ids []string
+	for _, body := range []string{"first", "second", "third"} {
+		id, err := bus.AppendMessage(&messagebus.Message{Type: "USER_REQUEST", ProjectID: "proj", Body: body})
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	read := func(args ...string) string {
+		t.Helper()
+		cmd := newRootCmd()
+		cmd.SetArgs(append([]string{"bus", "read", "--root", root, "--project", "proj", "--task", "task-20260101-000000-cursor"}, args...))
+		var runErr error
+		out := captureStdout(t, func() { runErr = cmd.Execute() })
+		if runErr != nil {
+			t.Fatalf("bus read %v failed: %v", args, runErr)
+		}
+		return out
+	}
+
+	if out := read("--consumer", "ralph", "--ack", "--tail", "2"); !strings.Contains(out, "first") || !strings.Contains(out, "second") || strings.Contains(out, "third") {
+		t.Fatalf("first page: %q", out)
+	}
+	if out := read("--consumer", "ralph"); strings.Contains(out, "second") || !strings.Contains(out, "third") {
+		t.Fatalf("second page: %q", out)
+	}
+	// Without --ack the cursor did not move.
+	if out := read("--consumer", "ralph", "--ack"); !strings.Contains(out, "third") {
+		t.Fatalf("third page: %q", out)
+	}
+	if out := read("--consumer", "ralph"); strings.TrimSpace(out) != "" {
+		t.Fatalf("expected no unacked messages, got %q", out)
+	}
+
+	cmd := newRootCmd()
+	cmd.SetArgs([]string{"bus", "ack", "--root", root, "--project", "proj", "--task", "task-20260101-000000-cursor", "--consumer", "reviewer", ids[0]})
+	var runErr error
+	out := captureStdout(t, func() { runErr = cmd.Execute() })
+	if runErr != nil || !strings.Contains(out, ids[0]) {
+		t.Fatalf("bus ack: %q, %v", out, runErr)
+	}
+	if out := read("--consumer", "reviewer"); strings.Contains(out, "first") || !strings.Contains(out, "second") {
+		t.Fatalf("reviewer read: %q", out)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetArgs([]string{"bus", "read", "--root", root, "--project", "proj", "--ack"})
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--consumer") {
+		t.Fatalf("expected --ack without --consumer to fail, got %v", err)
+	}
+}
+
+func TestBusSendAndInbox(t *testing.T) {
+	root := t.TempDir()
+	parentDir := filepath.Join(root, "proj", "task-20260101-000000-parent")
+	childDir := filepath.Join(root, "proj", "task-20260101-000000-child")
+	for _, dir := range []string{parentDir, childDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Send from inside the parent run: the sender and the project directory
+	// come from the parent's environment.
+	t.Setenv("JRUN_MESSAGE_BUS", filepath.Join(parentDir, "TASK-MESSAGE-BUS.md"))
+	t.Setenv("JRUN_ID", "run-parent")
+	t.Setenv("JRUN_TASK_ID", "")
+	t.Setenv("JRUN_PROJECT_ID", "")
+	t.Setenv("JRUN_RUN_FOLDER", "")
+	t.Setenv("JRUN_TASK_FOLDER", "")
+
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		var runErr error
+		out := captureStdout(t, func() { runErr = cmd.Execute() })
+		return out, runErr
+	}
+	if _, err := run("bus", "send", "--to", "task-20260101-000000-child", "--body", "switch to plan B"); err != nil {
+		t.Fatalf("bus send: %v", err)
+	}
+	if _, err := run("bus", "send", "--to", "task-20260101-000000-child", "--to-run", "run-2", "--body", "only run 2"); err != nil {
+		t.Fatalf("bus send --to-run: %v", err)
+	}
+	if _, err := run("bus", "send", "--to", "task-20260101-000000-missing", "--body", "x"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing task error, got %v", err)
+	}
+
+	child, err := messagebus.NewMessageBus(filepath.Join(childDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	msgs, _ := child.ReadMessages("")
+	if len(msgs) != 2 || msgs[0].ToTask != "task-20260101-000000-child" || msgs[0].TaskID != "task-20260101-000000-parent" ||
+		msgs[0].RunID != "run-parent" || msgs[0].ProjectID != "proj" || msgs[1].ToRun != "run-2" {
+		t.Fatalf("unexpected child bus messages: %+v", msgs)
+	}
+
+	t.Setenv("JRUN_MESSAGE_BUS", "")
+	t.Setenv("JRUN_ID", "")
+	inbox := func(args ...string) string {
+		t.Helper()
+		out, err := run(append([]string{"bus", "inbox", "--root", root, "--project", "proj", "--task", "task-20260101-000000-child"}, args...)...)
+		if err != nil {
+			t.Fatalf("bus inbox %v: %v", args, err)
+		}
+		return out
+	}
+	if out := inbox("--run", "run-1", "--ack"); !strings.Contains(out, "from task-20260101-000000-parent/run-parent: switch to plan B") || strings.Contains(out, "only run 2") {
+		t.Fatalf("run-1 inbox: %q", out)
+	}
+	if out := inbox("--run", "run-1"); !strings.Contains(out, "No new messages") {
+		t.Fatalf("inbox after ack: %q", out)
+	}
+	if out := inbox("--run", "run-2"); !strings.Contains(out, "only run 2") || strings.Contains(out, "plan B") {
+		t.Fatalf("run-2 inbox: %q", out)
+	}
+	if out := inbox("--all"); !strings.Contains(out, "plan B") || !strings.Contains(out, "only run 2") {
+		t.Fatalf("full inbox: %q", out)
+	}
+}
+
+func TestBusAskAndAnswer(t *testing.T) {
+	root := t.TempDir()
+	taskDir := filepath.Join(root, "proj", "task-20260101-000000-ask")
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	busPath := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
+	t.Setenv("JRUN_MESSAGE_BUS", busPath)
+	t.Setenv("JRUN_ID", "run-1")
+	t.Setenv("JRUN_TASK_ID", "")
+	t.Setenv("JRUN_PROJECT_ID", "")
+	t.Setenv("JRUN_RUN_FOLDER", "")
+	t.Setenv("JRUN_TASK_FOLDER", "")
+
+	hooks := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p struct {
+			Event string `json:"event"`
+			MsgID string `json:"msg_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		hooks <- p.Event + " " + p.MsgID
+	}))
+	defer srv.Close()
+	cfgPath := filepath.Join(root, "config.yaml")
+	if err := os.WriteFile(cfgPath, []byte("webhook:\n  url: "+srv.URL+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		var runErr error
+		out := captureStdout(t, func() { runErr = cmd.Execute() })
+		return out, runErr
+	}
+
+	// Without an answer, --wait gives up at the timeout.
+	if _, err := run("bus", "ask", "--config", cfgPath, "--body", "first?", "--wait", "--timeout", "50ms"); err == nil || !strings.Contains(err.Error(), "no answer") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	bus, err := messagebus.NewMessageBus(busPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := bus.ReadMessages("")
+	if len(msgs) != 1 || msgs[0].Type != "QUESTION" || msgs[0].RunID != "run-1" {
+		t.Fatalf("unexpected bus messages: %+v", msgs)
+	}
+	if got := <-hooks; got != "question "+msgs[0].MsgID {
+		t.Fatalf("webhook = %q", got)
+	}
+
+	// Answer the first question from outside the run.
+	t.Setenv("JRUN_MESSAGE_BUS", "")
+	out, err := run("bus", "answer", msgs[0].MsgID, "--root", root, "--project", "proj", "--task", "task-20260101-000000-ask", "--body", "go ahead")
+	if err != nil || !strings.Contains(out, "msg_id:") {
+		t.Fatalf("bus answer: %q, %v", out, err)
+	}
+	if _, err := run("bus", "answer", msgs[0].MsgID, "--root", root, "--project", "proj", "--task", "task-20260101-000000-ask", "--body", "again"); err == nil || !strings.Contains(err.Error(), "already answered") {
+		t.Fatalf("expected already answered error, got %v", err)
+	}
+	if inbox, _ := bus.ReadInbox("task-20260101-000000-ask", "run-1", false); len(inbox) != 1 || inbox[0].Type != "ANSWER" {
+		t.Fatalf("answer not in the asker's inbox: %+v", inbox)
+	}
+
+	// A waiting ask returns the answer body once it is posted.
+	t.Setenv("JRUN_MESSAGE_BUS", busPath)
+	go func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			all, _ := bus.ReadMessages("")
+			if open := messagebus.OpenQuestions(all); len(open) == 1 {
+				_, _ = bus.AppendMessage(messagebus.NewAnswer(open[0], "use the staging DB"))
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	out, err = run("bus", "ask", "--config", cfgPath, "--body", "which DB?", "--wait", "--timeout", "10s")
+	if err != nil || strings.TrimSpace(out) != "use the staging DB" {
+		t.Fatalf("bus ask --wait: %q, %v", out, err)
+	}
+}
+
+func TestBusMigrate(t *testing.T) {
+	root := t.TempDir()
+	taskDir := filepath.Join(root, "proj", "task-20260101-000000-mig")
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	busPath := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
+	file, err := messagebus.NewMessageBus(busPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"one", "two"} {
+		if _, err := file.AppendMessage(&messagebus.Message{Type: "FACT", ProjectID: "proj", Body: body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("JRUN_MESSAGE_BUS", "")
+
+	cmd := newRootCmd()
+	cmd.SetArgs([]string{"bus", "migrate", "--root", root, "--all"})
+	var runErr error
+	out := captureStdout(t, func() { runErr = cmd.Execute() })
+	if runErr != nil || !strings.Contains(out, busPath+": 2 messages imported") {
+		t.Fatalf("bus migrate: %q, %v", out, runErr)
+	}
+	if _, err := os.Stat(messagebus.SQLitePath(busPath)); err != nil {
+		t.Fatalf("database not created: %v", err)
+	}
+	bus, err := messagebus.Open(busPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	if msgs, _ := bus.ReadMessages(""); len(msgs) != 2 || msgs[1].Body != "two" {
+		t.Fatalf("migrated messages = %+v", msgs)
+	}
+}
+
+func TestBusExport(t *testing.T) {
+	root := t.TempDir()
+	taskDir := filepath.Join(root, "proj", "task-20260101-000000-exp")
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	bus, err := messagebus.NewMessageBus(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	question := &messagebus.Message{Type: messagebus.TypeQuestion, ProjectID: "proj", RunID: "run-1", Body: "which DB?"}
+	if _, err := bus.AppendMessage(question); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bus.AppendMessage(messagebus.NewAnswer(question, "staging")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("JRUN_MESSAGE_BUS", "")
+
+	outPath := filepath.Join(root, "log.md")
+	cmd := newRootCmd()
+	cmd.SetArgs([]string{"bus", "export", "--root", root, "--project", "proj", "--task", "task-20260101-000000-exp", "-o", outPath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("bus export: %v", err)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); !strings.Contains(got, "# Task proj/task-20260101-000000-exp") || !strings.Contains(got, "  - **ANSWER**") {
+		t.Fatalf("unexpected export:\n%s", got)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetArgs([]string{"bus", "export", "--root", root, "--project", "proj", "--task", "task-20260101-000000-exp", "--format", "csv", "--type", "answer"})
+	var runErr error
+	out := captureStdout(t, func() { runErr = cmd.Execute() })
+	if runErr != nil || strings.Count(out, "\n") != 2 || !strings.Contains(out, ",ANSWER,") {
+		t.Fatalf("csv export: %q, %v", out, runErr)
+	}
+}
+
+func TestBusLint(t *testing.T) {
+	root := t.TempDir()
+	projectDir := filepath.Join(root, "proj")
+	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	bus, err := messagebus.NewMessageBus(filepath.Join(projectDir, "PROJECT-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []*messagebus.Message{
+		{Type: "FACT", ProjectID: "proj", Body: "tests pass"},
+		{Type: "DECISIONS", ProjectID: "proj", Body: "typo in the type"},
+	} {
+		if _, err := bus.AppendMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("JRUN_MESSAGE_BUS", "")
+
+	cmd := newRootCmd()
+	cmd.SetArgs([]string{"bus", "lint", "--root", root, "--project", "proj"})
+	var runErr error
+	out := captureStdout(t, func() { runErr = cmd.Execute() })
+	if runErr == nil || !strings.Contains(runErr.Error(), "1 invalid messages") {
+		t.Fatalf("expected lint failure, got %v", runErr)
+	}
+	if !strings.Contains(out, "DECISIONS") || !strings.Contains(out, "2 messages checked in 1 buses, 1 invalid") {
+		t.Fatalf("unexpected lint output:\n%s", out)
+	}
+
+	cmd = newRootCmd()
+	cmd.SetArgs([]string{"bus", "lint", "--list-types"})
+	out = captureStdout(t, func() { runErr = cmd.Execute() })
+	if runErr != nil || !strings.Contains(out, "QUESTION") || !strings.Contains(out, "required: ") {
+		t.Fatalf("list-types: %v\n%s", runErr, out)
+	}
+}
+
+func TestBusPostWithMeta(t *testing.T) {
+	t.Setenv("JRUN_MESSAGE_BUS", "")
+	root := t.TempDir()
+	taskDir := filepath.Join(root, "my-project", "task-20260302-100000-meta")
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := newRootCmd()
+	cmd.SetArgs([]string{
+		"bus", "post",
+		"--root", root,
+		"--project", "my-project",
+		"--task", "task-20260302-100000-meta",
+		"--type", "REVIEW",
+		"--meta", "verdict=fail",
+		"--body", "missing tests",
+	})
+	var runErr error
+	captureStdout(t, func() {
+		runErr = cmd.Execute()
+	})
+	if runErr != nil {
+		t.Fatalf("bus post failed: %v", runErr)
+	}
+
+	bus, err := messagebus.NewMessageBus(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("open bus: %v", err)
+	}
+	messages, err := bus.ReadMessages("")
+	if err != nil {
+		t.Fatalf("read messages: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Meta["verdict"] != "fail" {
+		t.Fatalf("messages = %+v", messages)
+	}
+}
+
+func TestBusPostAppliesConfigValidation(t *testing.T) {
+	t.Setenv("JRUN_MESSAGE_BUS", "")
+	root := t.TempDir()
+	taskDir := filepath.Join(root, "my-project", "task-20260302-100000-schema")
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig := func(validation string) string {
+		path := filepath.Join(root, validation+".yaml")
+		if err := os.WriteFile(path, []byte("message_bus:\n  validation: "+validation+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	post := func(configPath string) error {
+		cmd := newRootCmd()
+		cmd.SetArgs([]string{
+			"bus", "post",
+			"--root", root,
+			"--project", "my-project",
+			"--task", "task-20260302-100000-schema",
+			"--type", "DECISIONS",
+			"--body", "made up type",
+			"--config", configPath,
+		})
+		var runErr error
+		captureStdout(t, func() {
+			runErr = cmd.Execute()
+		})
+		return runErr
+	}
+
+	// No run of the task stored the policy yet; the config applies anyway.
+	if err := post(writeConfig("strict")); err == nil || !strings.Contains(err.Error(), "unknown message type") {
+		t.Fatalf("expected strict validation error, got %v", err)
+	}
+	// Turning validation off applies without a run too.
+	if err := post(writeConfig("off")); err != nil {
+		t.Fatalf("bus post with validation off: %v", err)
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"time"
 
 	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/jonnyzzz/conductor-loop/internal/worktree"
 	"github.com/spf13/cobra"
 )
 
@@ -21,8 +23,13 @@ func newGCCmd() *cobra.Command {
 		project         string
 		keepFailed      bool
 		rotateBus       bool
+		compactBus      bool
+		compactAge      time.Duration
+		compactKeep     int
+		compactRollup   bool
 		busMaxSize      string
 		deleteDoneTasks bool
+		worktrees       bool
 	)
 
 	cmd := &cobra.Command{
@@ -38,7 +45,17 @@ func newGCCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("invalid --bus-max-size %q: %w", busMaxSize, err)
 			}
-			return runGC(root, project, olderThan, dryRun, keepFailed, rotateBus, maxBytes, deleteDoneTasks)
+			if rotateBus && compactBus {
+				return fmt.Errorf("--rotate-bus and --compact-bus are mutually exclusive")
+			}
+			return runGCWithOptions(root, project, olderThan, dryRun, keepFailed, deleteDoneTasks, worktrees, gcBusOptions{
+				Rotate:           rotateBus,
+				Compact:          compactBus,
+				MaxBytes:         maxBytes,
+				CompactOlderThan: compactAge,
+				KeepLast:         compactKeep,
+				Rollup:           compactRollup,
+			})
 		},
 	}
 
@@ -48,15 +65,38 @@ func newGCCmd() *cobra.Command {
 	cmd.Flags().StringVar(&project, "project", "", "limit gc to a specific project (optional)")
 	cmd.Flags().BoolVar(&keepFailed, "keep-failed", false, "keep runs with non-zero exit codes")
 	cmd.Flags().BoolVar(&rotateBus, "rotate-bus", false, "rotate message bus files that exceed --bus-max-size")
-	cmd.Flags().StringVar(&busMaxSize, "bus-max-size", "10MB", "size threshold for bus file rotation (e.g. 10MB, 5MB, 100KB)")
+	cmd.Flags().BoolVar(&compactBus, "compact-bus", false,
+		"archive the oldest messages of bus files that exceed --bus-max-size into dated segments, keeping message IDs readable")
+	cmd.Flags().DurationVar(&compactAge, "compact-older-than", 0, "with --compact-bus, also archive messages older than this duration")
+	cmd.Flags().IntVar(&compactKeep, "compact-keep-last", 100, "with --compact-bus, always keep this many newest messages in the bus")
+	cmd.Flags().BoolVar(&compactRollup, "compact-rollup", false, "with --compact-bus, summarize archived RUN_START/RUN_STOP events into RUN_ROLLUP messages")
+	cmd.Flags().StringVar(&busMaxSize, "bus-max-size", "10MB", "size threshold for bus file rotation or compaction (e.g. 10MB, 5MB, 100KB)")
 	cmd.Flags().BoolVar(&deleteDoneTasks, "delete-done-tasks", false,
 		"delete task directories that have DONE file, empty runs/, and are older than --older-than")
+	cmd.Flags().BoolVar(&worktrees, "worktrees", false,
+		"remove git worktrees of DONE tasks older than --older-than (task branches are kept)")
 
 	return cmd
 }
 
-func runGC(root, project string, olderThan time.Duration, dryRun, keepFailed bool, rotateBus bool, busMaxBytes int64, deleteDoneTasks bool) error {
+// gcBusOptions configures message bus maintenance during gc.
+type gcBusOptions struct {
+	Rotate           bool
+	Compact          bool
+	MaxBytes         int64
+	CompactOlderThan time.Duration
+	KeepLast         int
+	Rollup           bool
+}
+
+func runGC(root, project string, olderThan time.Duration, dryRun, keepFailed bool, rotateBus bool, busMaxBytes int64, deleteDoneTasks, worktrees bool) error {
+	return runGCWithOptions(root, project, olderThan, dryRun, keepFailed, deleteDoneTasks, worktrees, gcBusOptions{Rotate: rotateBus, MaxBytes: busMaxBytes})
+}
+
+func runGCWithOptions(root, project string, olderThan time.Duration, dryRun, keepFailed, deleteDoneTasks, worktrees bool, busOpts gcBusOptions) error {
 	cutoff := time.Now().Add(-olderThan)
+	rotateBus := busOpts.Rotate
+	busMaxBytes := busOpts.MaxBytes
 
 	projects, err := listProjectDirs(root, project)
 	if err != nil {
@@ -67,7 +107,9 @@ func runGC(root, project string, olderThan time.Duration, dryRun, keepFailed boo
 		deletedCount     int
 		freedBytes       int64
 		rotatedCount     int
+		compactedCount   int
 		deletedTaskCount int
+		worktreeCount    int
 	)
 
 	for _, proj := range projects {
@@ -87,6 +129,12 @@ func runGC(root, project string, olderThan time.Duration, dryRun, keepFailed boo
 				rotatedCount++
 			}
 		}
+		if busOpts.Compact {
+			projBus := filepath.Join(projDir, "PROJECT-MESSAGE-BUS.md")
+			if compactBusFile(projBus, busOpts, dryRun) {
+				compactedCount++
+			}
+		}
 
 		for _, taskEntry := range taskEntries {
 			if !taskEntry.IsDir() {
@@ -104,6 +152,21 @@ func runGC(root, project string, olderThan time.Duration, dryRun, keepFailed boo
 					rotatedCount++
 				}
 			}
+			if busOpts.Compact {
+				taskBus := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
+				if compactBusFile(taskBus, busOpts, dryRun) {
+					compactedCount++
+				}
+			}
+
+			if worktrees {
+				removed, err := gcTaskWorktree(taskDir, cutoff, dryRun)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+				} else if removed {
+					worktreeCount++
+				}
+			}
 
 			runsDir := filepath.Join(taskDir, "runs")
 			runEntries, err := os.ReadDir(runsDir)
@@ -159,6 +222,14 @@ func runGC(root, project string, olderThan time.Duration, dryRun, keepFailed boo
 		fmt.Printf("%s %d task directories (DONE + empty runs)\n", action, deletedTaskCount)
 	}
 
+	if worktrees && worktreeCount > 0 {
+		removeAction := "Removed"
+		if dryRun {
+			removeAction = "Would remove"
+		}
+		fmt.Printf("%s %d task worktree(s)\n", removeAction, worktreeCount)
+	}
+
 	if rotateBus && rotatedCount > 0 {
 		rotateAction := "Rotated"
 		if dryRun {
@@ -166,6 +237,13 @@ func runGC(root, project string, olderThan time.Duration, dryRun, keepFailed boo
 		}
 		fmt.Printf("%s %d message bus file(s)\n", rotateAction, rotatedCount)
 	}
+	if busOpts.Compact && compactedCount > 0 {
+		compactAction := "Compacted"
+		if dryRun {
+			compactAction = "Would compact"
+		}
+		fmt.Printf("%s %d message bus file(s)\n", compactAction, compactedCount)
+	}
 
 	return nil
 }
@@ -211,12 +289,54 @@ func gcTaskDir(taskDir string, cutoff time.Time, dryRun bool) (bool, error) {
 	}
 
 	fmt.Printf("deleting task dir %s (DONE + empty)\n", taskName)
+	// Unregister a task worktree from its repository before the checkout
+	// disappears with the task directory.
+	if wt, err := worktree.Read(taskDir); err == nil && wt != nil {
+		_ = worktree.Remove(wt, false)
+	}
 	if err := os.RemoveAll(taskDir); err != nil {
 		return false, fmt.Errorf("delete task dir %s: %w", taskDir, err)
 	}
 	return true, nil
 }
 
+// gcTaskWorktree removes the git worktree of a DONE task whose DONE marker is
+// older than cutoff. The task branch is kept so unmerged work stays reachable.
+// Returns true if the worktree was removed (or would be in dry-run mode).
+func gcTaskWorktree(taskDir string, cutoff time.Time, dryRun bool) (bool, error) {
+	wt, err := worktree.Read(taskDir)
+	if err != nil {
+		return false, fmt.Errorf("read worktree of %s: %w", taskDir, err)
+	}
+	if wt == nil || wt.Removed {
+		return false, nil
+	}
+	done, err := os.Stat(filepath.Join(taskDir, "DONE"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("stat DONE file in %s: %w", taskDir, err)
+	}
+	if !done.ModTime().Before(cutoff) {
+		return false, nil
+	}
+
+	taskName := filepath.Base(taskDir)
+	if dryRun {
+		fmt.Printf("[dry-run] would remove worktree of task %s (branch %s kept)\n", taskName, wt.Branch)
+		return true, nil
+	}
+	fmt.Printf("removing worktree of task %s (branch %s kept)\n", taskName, wt.Branch)
+	if err := worktree.Remove(wt, false); err != nil {
+		return false, fmt.Errorf("remove worktree of %s: %w", taskDir, err)
+	}
+	if err := worktree.Write(taskDir, wt); err != nil {
+		return false, fmt.Errorf("record worktree removal in %s: %w", taskDir, err)
+	}
+	return true, nil
+}
+
 // rotateBusFile renames busPath to busPath.<YYYYMMDD-HHMMSS>.archived if it exceeds maxBytes.
 // Returns true if the file was rotated (or would be in dry-run mode).
 func rotateBusFile(busPath string, maxBytes int64, dryRun bool) (bool, error) {
@@ -245,10 +365,57 @@ func rotateBusFile(busPath string, maxBytes int64, dryRun bool) (bool, error) {
 	if err := os.Rename(busPath, archivedPath); err != nil {
 		return false, fmt.Errorf("rename %s: %w", busPath, err)
 	}
+	// The sidecar index described the archived file; drop it.
+	_ = os.Remove(messagebus.IndexPath(busPath))
 	fmt.Printf("Rotated %s (%.1f MB → archived)\n", baseName, sizeMB)
 	return true, nil
 }
 
+// compactBusFile archives the oldest messages of busPath once it exceeds
+// opts.MaxBytes, shrinking it to at most half that size (and archiving
+// anything older than opts.CompactOlderThan). Returns true if messages were
+// archived (or would be in dry-run mode); failures are reported as warnings.
+func compactBusFile(busPath string, opts gcBusOptions, dryRun bool) bool {
+	info, err := os.Stat(busPath)
+	if err != nil || info.Size() <= opts.MaxBytes {
+		return false
+	}
+	bus, err := messagebus.Open(busPath, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: compact %s: %v\n", busPath, err)
+		return false
+	}
+	defer bus.Close()
+	compactOpts := messagebus.CompactOptions{
+		TargetBytes: opts.MaxBytes / 2,
+		KeepLast:    opts.KeepLast,
+		Rollup:      opts.Rollup,
+		DryRun:      dryRun,
+	}
+	if opts.CompactOlderThan > 0 {
+		compactOpts.Before = time.Now().Add(-opts.CompactOlderThan)
+	}
+	result, err := bus.Compact(compactOpts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: compact %s: %v\n", busPath, err)
+		return false
+	}
+	if result.Moved == 0 {
+		return false
+	}
+	baseName := filepath.Base(busPath)
+	beforeMB := float64(result.BytesBefore) / (1024 * 1024)
+	afterMB := float64(result.BytesAfter) / (1024 * 1024)
+	if dryRun {
+		fmt.Printf("[dry-run] would compact %s (%.1f MB → %.1f MB, %d messages archived, %d summarized)\n",
+			baseName, beforeMB, afterMB, result.Moved, result.Summarized)
+		return true
+	}
+	fmt.Printf("Compacted %s (%.1f MB → %.1f MB, %d messages archived, %d summarized)\n",
+		baseName, beforeMB, afterMB, result.Moved, result.Summarized)
+	return true
+}
+
 // parseSizeBytes parses a human-readable size string like "10MB", "5MB", "100KB", "1GB" into bytes.
 func parseSizeBytes(s string) (int64, error) {
 	s = strings.TrimSpace(s)
@@ -299,7 +466,7 @@ func listProjectDirs(root, project string) ([]string, error) {
 	}
 	var projects []string
 	for _, e := range entries {
-		if e.IsDir() {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
 			projects = append(projects, e.Name())
 		}
 	}
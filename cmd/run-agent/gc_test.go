@@ -3,12 +3,15 @@ package main
 import (
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/jonnyzzz/conductor-loop/internal/worktree"
 )
 
 // makeRun creates a fake run directory with a run-info.yaml for testing.
@@ -113,7 +116,7 @@ func TestGCTableDriven(t *testing.T) {
 			root := t.TempDir()
 			runDir := makeRun(t, root, "proj", "task1", "run-test", tc.status, tc.startTime, tc.exitCode)
 
-			if err := runGC(root, "", tc.olderThan, false, tc.keepFailed, false, 0, false); err != nil {
+			if err := runGC(root, "", tc.olderThan, false, tc.keepFailed, false, 0, false, false); err != nil {
 				t.Fatalf("runGC: %v", err)
 			}
 
@@ -134,7 +137,7 @@ func TestGCDryRunDoesNotDelete(t *testing.T) {
 	runDir := makeRun(t, root, "proj", "task1", "run-old", storage.StatusCompleted, old, 0)
 
 	output := captureStdout(t, func() {
-		if err := runGC(root, "", 24*time.Hour, true, false, false, 0, false); err != nil {
+		if err := runGC(root, "", 24*time.Hour, true, false, false, 0, false, false); err != nil {
 			t.Errorf("runGC dry-run: %v", err)
 		}
 	})
@@ -157,7 +160,7 @@ func TestGCProjectFilter(t *testing.T) {
 	proj1Dir := makeRun(t, root, "proj1", "task1", "run-old", storage.StatusCompleted, old, 0)
 	proj2Dir := makeRun(t, root, "proj2", "task1", "run-old", storage.StatusCompleted, old, 0)
 
-	if err := runGC(root, "proj1", 24*time.Hour, false, false, false, 0, false); err != nil {
+	if err := runGC(root, "proj1", 24*time.Hour, false, false, false, 0, false, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -177,7 +180,7 @@ func TestGCSkipsMissingRunInfo(t *testing.T) {
 		t.Fatalf("mkdir: %v", err)
 	}
 
-	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false); err != nil {
+	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -203,7 +206,7 @@ func TestGCOrphanedRunDirWarning(t *testing.T) {
 	oldStderr := os.Stderr
 	os.Stderr = w
 
-	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false); err != nil {
+	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false, false); err != nil {
 		w.Close()
 		os.Stderr = oldStderr
 		t.Fatalf("runGC: %v", err)
@@ -236,7 +239,7 @@ func TestGCSummaryOutput(t *testing.T) {
 	makeRun(t, root, "proj", "task1", "run-old2", storage.StatusCompleted, old, 0)
 
 	output := captureStdout(t, func() {
-		if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false); err != nil {
+		if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false, false); err != nil {
 			t.Errorf("runGC: %v", err)
 		}
 	})
@@ -253,7 +256,7 @@ func TestGCMultipleTasks(t *testing.T) {
 	dir1 := makeRun(t, root, "proj", "task1", "run-old", storage.StatusCompleted, old, 0)
 	dir2 := makeRun(t, root, "proj", "task2", "run-old", storage.StatusCompleted, old, 0)
 
-	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false); err != nil {
+	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -301,7 +304,7 @@ func TestGCRotateBus_LargeFileGetsRotated(t *testing.T) {
 	makeBusFile(t, taskBus, 2*1024*1024)
 
 	output := captureStdout(t, func() {
-		if err := runGC(root, "", 168*time.Hour, false, false, true, 1*1024*1024, false); err != nil {
+		if err := runGC(root, "", 168*time.Hour, false, false, true, 1*1024*1024, false, false); err != nil {
 			t.Fatalf("runGC: %v", err)
 		}
 	})
@@ -338,7 +341,7 @@ func TestGCRotateBus_SmallFileNotRotated(t *testing.T) {
 	// 512KB file, threshold 1MB — should NOT be rotated
 	makeBusFile(t, taskBus, 512*1024)
 
-	if err := runGC(root, "", 168*time.Hour, false, false, true, 1*1024*1024, false); err != nil {
+	if err := runGC(root, "", 168*time.Hour, false, false, true, 1*1024*1024, false, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -355,7 +358,7 @@ func TestGCRotateBus_DryRunDoesNotRotate(t *testing.T) {
 	makeBusFile(t, taskBus, 2*1024*1024)
 
 	output := captureStdout(t, func() {
-		if err := runGC(root, "", 168*time.Hour, true, false, true, 1*1024*1024, false); err != nil {
+		if err := runGC(root, "", 168*time.Hour, true, false, true, 1*1024*1024, false, false); err != nil {
 			t.Fatalf("runGC: %v", err)
 		}
 	})
@@ -385,7 +388,7 @@ func TestGCRotateBus_ThresholdRespected(t *testing.T) {
 	bus2 := filepath.Join(root, "proj", "task2", "TASK-MESSAGE-BUS.md")
 	makeBusFile(t, bus2, 1*1024*1024)
 
-	if err := runGC(root, "", 168*time.Hour, false, false, true, 2*1024*1024, false); err != nil {
+	if err := runGC(root, "", 168*time.Hour, false, false, true, 2*1024*1024, false, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -406,7 +409,7 @@ func TestGCRotateBus_ProjectBusFileRotated(t *testing.T) {
 	// 2MB project bus file, threshold 1MB
 	makeBusFile(t, projBus, 2*1024*1024)
 
-	if err := runGC(root, "", 168*time.Hour, false, false, true, 1*1024*1024, false); err != nil {
+	if err := runGC(root, "", 168*time.Hour, false, false, true, 1*1024*1024, false, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -438,7 +441,7 @@ func TestGCRotateBus_NotRotatedWhenFlagAbsent(t *testing.T) {
 	// Large file but --rotate-bus not set
 	makeBusFile(t, taskBus, 20*1024*1024)
 
-	if err := runGC(root, "", 168*time.Hour, false, false, false, 10*1024*1024, false); err != nil {
+	if err := runGC(root, "", 168*time.Hour, false, false, false, 10*1024*1024, false, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -483,7 +486,7 @@ func TestGCDeleteDoneTasksNoFlag(t *testing.T) {
 		t.Fatalf("chtimes: %v", err)
 	}
 
-	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false); err != nil {
+	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -503,7 +506,7 @@ func TestGCDeleteDoneTasksWithDONE(t *testing.T) {
 	}
 
 	output := captureStdout(t, func() {
-		if err := runGC(root, "", 24*time.Hour, false, false, false, 0, true); err != nil {
+		if err := runGC(root, "", 24*time.Hour, false, false, false, 0, true, false); err != nil {
 			t.Fatalf("runGC: %v", err)
 		}
 	})
@@ -526,7 +529,7 @@ func TestGCDeleteDoneTasksNoDONE(t *testing.T) {
 		t.Fatalf("chtimes: %v", err)
 	}
 
-	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, true); err != nil {
+	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, true, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -545,7 +548,7 @@ func TestGCDeleteDoneTasksDryRun(t *testing.T) {
 	}
 
 	output := captureStdout(t, func() {
-		if err := runGC(root, "", 24*time.Hour, true, false, false, 0, true); err != nil {
+		if err := runGC(root, "", 24*time.Hour, true, false, false, 0, true, false); err != nil {
 			t.Fatalf("runGC dry-run: %v", err)
 		}
 	})
@@ -571,7 +574,7 @@ func TestGCDeleteDoneTasksActiveRuns(t *testing.T) {
 		t.Fatalf("chtimes: %v", err)
 	}
 
-	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, true); err != nil {
+	if err := runGC(root, "", 24*time.Hour, false, false, false, 0, true, false); err != nil {
 		t.Fatalf("runGC: %v", err)
 	}
 
@@ -616,3 +619,104 @@ func TestParseSizeBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestGCWorktreesRemovesDoneTaskWorktree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	root := t.TempDir()
+	taskDir := makeTaskDir(t, root, "proj", "task-wt", true, false)
+	wt, err := worktree.Ensure(taskDir, "task-wt", repo, "")
+	if err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(filepath.Join(taskDir, "DONE"), old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	output := captureStdout(t, func() {
+		if err := runGC(root, "", 24*time.Hour, false, false, false, 0, false, true); err != nil {
+			t.Fatalf("runGC: %v", err)
+		}
+	})
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Errorf("expected worktree to be removed, stat err: %v", err)
+	}
+	if !strings.Contains(output, "Removed 1 task worktree(s)") {
+		t.Errorf("expected removal summary in output, got: %q", output)
+	}
+	out, err := exec.Command("git", "-C", repo, "branch", "--list", wt.Branch).CombinedOutput()
+	if err != nil || strings.TrimSpace(string(out)) == "" {
+		t.Errorf("expected task branch to be kept, got %q (%v)", out, err)
+	}
+	if stored, err := worktree.Read(taskDir); err != nil || stored == nil || !stored.Removed {
+		t.Errorf("expected worktree metadata marked removed, got %+v (%v)", stored, err)
+	}
+}
+
+func TestGCCompactBus_ArchivesOldestMessages(t *testing.T) {
+	root := t.TempDir()
+	busPath := filepath.Join(root, "proj", "task1", "TASK-MESSAGE-BUS.md")
+	if err := os.MkdirAll(filepath.Dir(busPath), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	bus, err := messagebus.NewMessageBus(busPath)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	var ids []string
+	for i := 0; i < 40; i++ {
+		id, err := bus.AppendMessage(&messagebus.Message{Type: "PROGRESS", ProjectID: "proj", TaskID: "task1", Body: strings.Repeat("x", 200)})
+		if err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	info, err := os.Stat(busPath)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	maxBytes := info.Size() / 2
+	opts := gcBusOptions{Compact: true, MaxBytes: maxBytes, KeepLast: 5}
+
+	output := captureStdout(t, func() {
+		if err := runGCWithOptions(root, "", 168*time.Hour, true, false, false, false, opts); err != nil {
+			t.Fatalf("runGCWithOptions: %v", err)
+		}
+	})
+	if !strings.Contains(output, "would compact TASK-MESSAGE-BUS.md") {
+		t.Errorf("expected dry-run compaction, got: %q", output)
+	}
+	if after, _ := os.Stat(busPath); after.Size() != info.Size() {
+		t.Fatalf("dry run changed the bus")
+	}
+
+	output = captureStdout(t, func() {
+		if err := runGCWithOptions(root, "", 168*time.Hour, false, false, false, false, opts); err != nil {
+			t.Fatalf("runGCWithOptions: %v", err)
+		}
+	})
+	if !strings.Contains(output, "Compacted 1 message bus file(s)") {
+		t.Errorf("expected compaction summary, got: %q", output)
+	}
+	after, err := os.Stat(busPath)
+	if err != nil || after.Size() > maxBytes/2 {
+		t.Fatalf("bus not compacted below target: %v, %v", after, err)
+	}
+	// Cursors on archived messages keep working.
+	got, err := bus.ReadMessages(ids[0])
+	if err != nil || len(got) != len(ids)-1 {
+		t.Fatalf("ReadMessages(archived cursor) = %d messages, %v", len(got), err)
+	}
+}
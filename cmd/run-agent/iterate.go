@@ -38,8 +38,9 @@ func newIterateCmd() *cobra.Command {
 		Long: `Iterate runs a cycle of implementation runs followed by review runs.
 Each iteration executes an implementation step, then a review step.
 If the review output contains pass tokens (APPROVED, PASS) the loop exits with
-code 0. If fail tokens appear (REJECTED, FAIL, CHANGES_REQUESTED) the next
-iteration begins (up to --max-iterations). Exit code 1 means iterations exhausted.`,
+code 0, even when fail tokens appear too. Otherwise, with fail tokens (REJECTED,
+FAIL, CHANGES_REQUESTED) or none, the next iteration begins (up to
+--max-iterations). Exit code 1 means iterations exhausted.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			rootDir = strings.TrimSpace(rootDir)
 			projectID = strings.TrimSpace(projectID)
@@ -23,6 +23,13 @@ func TestDetectIterateVerdict_Fail(t *testing.T) {
 	}
 }
 
+func TestDetectIterateVerdict_PassWinsOverFail(t *testing.T) {
+	v := detectIterateVerdict("All 42 tests PASSED, 0 FAILED. APPROVED")
+	if v != "pass" {
+		t.Errorf("detectIterateVerdict(pass and fail words) = %q, want pass", v)
+	}
+}
+
 func TestDetectIterateVerdict_Unknown(t *testing.T) {
 	v := detectIterateVerdict("Looks good to me, but no verdict token.")
 	if v != "unknown" {
@@ -96,7 +96,7 @@ func listProjects(out io.Writer, root string, jsonOut bool) error {
 
 	var projects []string
 	for _, e := range entries {
-		if e.IsDir() {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
 			projects = append(projects, e.Name())
 		}
 	}
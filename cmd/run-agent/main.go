@@ -33,6 +33,7 @@ func newRootCmd() *cobra.Command {
 	cmd.AddCommand(newTaskCmd())
 	cmd.AddCommand(newGoalCmd())
 	cmd.AddCommand(newWorkflowCmd())
+	cmd.AddCommand(newPipelineCmd())
 	cmd.AddCommand(newJobCmd())
 	cmd.AddCommand(newWrapCmd())
 	cmd.AddCommand(newShellSetupCmd())
@@ -118,6 +119,8 @@ func newTaskCmd() *cobra.Command {
 	cmd.Flags().DurationVar(&opts.PollInterval, "child-poll-interval", 0, "child poll interval")
 	cmd.Flags().DurationVar(&opts.RestartDelay, "restart-delay", time.Second, "restart delay")
 	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 0, "idle output timeout per job (e.g. 30m, 2h); 0 means no limit")
+	addBudgetFlags(cmd, &opts.Budget, "config default/unlimited")
+	addIsolationFlags(cmd, &opts.Isolation, &opts.OnDone)
 
 	cmd.AddCommand(newTaskResumeCmd())
 	cmd.AddCommand(newTaskDeleteCmd())
@@ -200,10 +203,27 @@ func newTaskResumeCmd() *cobra.Command {
 	cmd.Flags().DurationVar(&opts.WaitTimeout, "child-wait-timeout", 0, "child wait timeout")
 	cmd.Flags().DurationVar(&opts.PollInterval, "child-poll-interval", 0, "child poll interval")
 	cmd.Flags().DurationVar(&opts.RestartDelay, "restart-delay", time.Second, "restart delay")
+	addBudgetFlags(cmd, &opts.Budget, "config default/unlimited")
 
 	return cmd
 }
 
+// addBudgetFlags registers the task subtree budget flags. unset describes
+// what 0 means: task loops fall back to defaults.budget from the config
+// file, jobs run unlimited.
+func addBudgetFlags(cmd *cobra.Command, budget *runner.Budget, unset string) {
+	cmd.Flags().Int64Var(&budget.MaxTokens, "max-tokens", 0, "stop the task tree after this many input+output tokens (0 = "+unset+")")
+	cmd.Flags().Float64Var(&budget.MaxCostUSD, "max-cost-usd", 0, "stop the task tree after this spend in USD (0 = "+unset+")")
+	cmd.Flags().DurationVar(&budget.MaxWallClock, "max-wall-clock", 0, "stop the task tree after this elapsed time, e.g. 2h (0 = "+unset+")")
+	cmd.Flags().IntVar(&budget.MaxRestarts, "max-tree-restarts", 0, "stop the task tree after this many restarts across all tasks (0 = "+unset+")")
+}
+
+// addIsolationFlags registers the per-task git worktree isolation flags.
+func addIsolationFlags(cmd *cobra.Command, isolation, onDone *string) {
+	cmd.Flags().StringVar(isolation, "isolation", "", "task working copy: none or worktree (dedicated git worktree and branch under the task directory)")
+	cmd.Flags().StringVar(onDone, "on-done", "", "worktree policy when the task is DONE: branch (default, leave for review), merge or rebase")
+}
+
 func newJobCmd() *cobra.Command {
 	var (
 		opts   runner.JobOptions
@@ -294,6 +314,8 @@ func newJobCmd() *cobra.Command {
 	cmd.Flags().StringVar(&opts.PreviousRunID, "previous-run-id", "", "previous run id")
 	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 0, "idle output timeout (e.g. 30m, 2h); 0 means no limit")
 	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "stream output in real-time while job runs")
+	addBudgetFlags(cmd, &opts.Budget, "unlimited")
+	addIsolationFlags(cmd, &opts.Isolation, &opts.OnDone)
 
 	cmd.AddCommand(newJobBatchCmd())
 
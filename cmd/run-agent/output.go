@@ -34,6 +34,7 @@ func newOutputCmd() *cobra.Command {
 		runDir    string
 		tail      int
 		file      string
+		format    string
 		follow    bool
 	)
 
@@ -41,6 +42,12 @@ func newOutputCmd() *cobra.Command {
 		Use:   "output",
 		Short: "Print output from a completed run",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if isTranscriptFile(file) {
+				return runTranscriptOutput(runDir, root, projectID, taskID, runID, format, tail, follow)
+			}
+			if cmd.Flags().Changed("format") {
+				return fmt.Errorf("--format is only supported with --file transcript")
+			}
 			if follow {
 				return runFollowOutput(runDir, root, projectID, taskID, runID, file)
 			}
@@ -54,7 +61,8 @@ func newOutputCmd() *cobra.Command {
 	cmd.Flags().StringVar(&taskID, "task", "", "task id")
 	cmd.Flags().StringVar(&runID, "run", "", "run id (uses most recent if omitted)")
 	cmd.Flags().IntVar(&tail, "tail", 0, "print last N lines only (0 = all)")
-	cmd.Flags().StringVar(&file, "file", "output", "file to print: output (default), stdout, stderr, prompt")
+	cmd.Flags().StringVar(&file, "file", "output", "file to print: output (default), stdout, stderr, prompt, transcript")
+	cmd.Flags().StringVar(&format, "format", transcriptFormatPretty, "transcript format: pretty or json (with --file transcript)")
 	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "follow output as it is written (for running jobs)")
 
 	cmd.AddCommand(newOutputSynthesizeCmd())
@@ -172,7 +180,7 @@ func resolveOutputFile(runDir, file string) (string, error) {
 		}
 		return p, nil
 	default:
-		return "", fmt.Errorf("unknown --file value %q: must be output, stdout, stderr, or prompt", file)
+		return "", fmt.Errorf("unknown --file value %q: must be output, stdout, stderr, prompt, or transcript", file)
 	}
 }
 
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
 	"github.com/spf13/cobra"
 )
 
@@ -65,35 +66,11 @@ When --root/--project/--task are given, run IDs are resolved relative to that ta
 }
 
 func runOutputSynthesize(out io.Writer, root, projectID, taskID string, runSelectors []string, strict bool) error {
-	if len(runSelectors) == 0 {
-		return fmt.Errorf("no run selectors provided")
-	}
-
-	var missingCount int
+	runs := make([]runner.SynthesisRun, 0, len(runSelectors))
 	for _, sel := range runSelectors {
-		runDir := resolveRunDirForSynthesize(root, projectID, taskID, sel)
-
-		content, sourcePath, err := readRunOutputForSynthesize(runDir)
-		if err != nil {
-			if strict {
-				return fmt.Errorf("run %s: %w", sel, err)
-			}
-			fmt.Fprintf(out, "## run: %s\n\n", sel)
-			fmt.Fprintf(out, "> WARNING: no output found for this run (path: %s)\n\n", runDir)
-			missingCount++
-			continue
-		}
-
-		fmt.Fprintf(out, "## run: %s\n\n", sel)
-		fmt.Fprintf(out, "source: %s\n\n", sourcePath)
-		fmt.Fprintf(out, "%s\n\n", strings.TrimSpace(content))
-		fmt.Fprintf(out, "---\n\n")
-	}
-
-	if missingCount > 0 && !strict {
-		fmt.Fprintf(out, "> %d run(s) had no output artifact\n", missingCount)
+		runs = append(runs, runner.SynthesisRun{Label: sel, RunDir: resolveRunDirForSynthesize(root, projectID, taskID, sel)})
 	}
-	return nil
+	return runner.SynthesizeRunOutputs(out, runs, strict)
 }
 
 // resolveRunDirForSynthesize resolves a run selector to an absolute run directory path.
@@ -109,22 +86,6 @@ func resolveRunDirForSynthesize(root, projectID, taskID, sel string) string {
 	return sel
 }
 
-// readRunOutputForSynthesize reads the best available output for a run directory.
-// Prefers output.md; falls back to agent-stdout.txt.
-func readRunOutputForSynthesize(runDir string) (content, sourcePath string, err error) {
-	outputPath := filepath.Join(runDir, "output.md")
-	if data, e := os.ReadFile(outputPath); e == nil {
-		return string(data), outputPath, nil
-	}
-
-	stdoutPath := filepath.Join(runDir, "agent-stdout.txt")
-	if data, e := os.ReadFile(stdoutPath); e == nil {
-		return string(data), stdoutPath, nil
-	}
-
-	return "", runDir, fmt.Errorf("no output.md or agent-stdout.txt found in %s", runDir)
-}
-
 func splitAndTrim(s, sep string) []string {
 	parts := strings.Split(s, sep)
 	result := make([]string, 0, len(parts))
@@ -259,3 +259,71 @@ func TestOutputCmd_Integration(t *testing.T) {
 		t.Errorf("expected 'integration test output', got: %q", out)
 	}
 }
+
+func TestRunTranscriptOutput_Formats(t *testing.T) {
+	root := t.TempDir()
+	runDir := makeRun(t, root, "proj", "task1", "run-001", storage.StatusCompleted, time.Now().Add(-time.Hour), 0)
+	writeFile(t, filepath.Join(runDir, "transcript.jsonl"),
+		`{"seq":1,"ts":"2026-01-01T00:00:00Z","type":"assistant_text","text":"hello"}`+"\n"+
+			`{"seq":2,"ts":"2026-01-01T00:00:01Z","type":"tool_call","tool":"Bash","input":{"command":"ls"}}`+"\n")
+
+	var runErr error
+	out := captureStdout(t, func() {
+		runErr = runTranscriptOutput("", root, "proj", "task1", "", "pretty", 1, false)
+	})
+	if runErr != nil {
+		t.Fatalf("unexpected error: %v", runErr)
+	}
+	if out != "[tool_call] Bash {\"command\":\"ls\"}\n" {
+		t.Errorf("unexpected pretty output: %q", out)
+	}
+
+	out = captureStdout(t, func() {
+		runErr = runTranscriptOutput("", root, "proj", "task1", "", "json", 0, false)
+	})
+	if runErr != nil {
+		t.Fatalf("unexpected error: %v", runErr)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"type":"assistant_text"`) {
+		t.Errorf("expected two JSON lines, got: %q", out)
+	}
+
+	if err := runTranscriptOutput("", root, "proj", "task1", "", "xml", 0, false); err == nil {
+		t.Fatal("expected error for unknown --format")
+	}
+}
+
+func TestRunTranscriptOutput_DerivedFromStdout(t *testing.T) {
+	root := t.TempDir()
+	runDir := makeRun(t, root, "proj", "task1", "run-001", storage.StatusCompleted, time.Now().Add(-time.Hour), 0)
+	writeFile(t, filepath.Join(runDir, "agent-stdout.txt"),
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"from claude"}]}}`+"\n")
+
+	cmd := newRootCmd()
+	cmd.SetArgs([]string{"output", "--run-dir", runDir, "--file", "transcript"})
+	var runErr error
+	out := captureStdout(t, func() {
+		runErr = cmd.Execute()
+	})
+	if runErr != nil {
+		t.Fatalf("output command failed: %v", runErr)
+	}
+	if !strings.Contains(out, "[assistant] from claude") {
+		t.Errorf("expected derived claude transcript, got: %q", out)
+	}
+}
+
+func TestOutputCmd_FormatRequiresTranscript(t *testing.T) {
+	root := t.TempDir()
+	runDir := makeRun(t, root, "proj", "task1", "run-001", storage.StatusCompleted, time.Now().Add(-time.Hour), 0)
+	writeFile(t, filepath.Join(runDir, "output.md"), "text\n")
+
+	cmd := newRootCmd()
+	cmd.SetArgs([]string{"output", "--run-dir", runDir, "--format", "json"})
+	cmd.SetOut(&strings.Builder{})
+	cmd.SetErr(&strings.Builder{})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--file transcript") {
+		t.Fatalf("expected --format error, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+const (
+	transcriptFormatPretty = "pretty"
+	transcriptFormatJSON   = "json"
+)
+
+func isTranscriptFile(file string) bool {
+	return strings.EqualFold(strings.TrimSpace(file), "transcript")
+}
+
+// runTranscriptOutput prints the normalized transcript of a run.
+// --tail limits the output to the last N events.
+func runTranscriptOutput(runDir, root, projectID, taskID, runID, format string, tail int, follow bool) error {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != transcriptFormatPretty && format != transcriptFormatJSON {
+		return fmt.Errorf("unknown --format value %q: must be pretty or json", format)
+	}
+	resolved, err := resolveOutputRunDir(runDir, root, projectID, taskID, runID)
+	if err != nil {
+		return err
+	}
+	info, _ := storage.ReadRunInfo(filepath.Join(resolved, "run-info.yaml"))
+	if follow && info != nil && info.Status == storage.StatusRunning {
+		return followTranscript(os.Stdout, resolved, format)
+	}
+	events, err := runner.ReadTranscript(resolved, info)
+	if err != nil {
+		return fmt.Errorf("read transcript: %w", err)
+	}
+	if tail > 0 && len(events) > tail {
+		events = events[len(events)-tail:]
+	}
+	return writeTranscriptEvents(os.Stdout, events, format)
+}
+
+func writeTranscriptEvents(w io.Writer, events []transcript.Event, format string) error {
+	if format == transcriptFormatPretty {
+		return transcript.WritePretty(w, events)
+	}
+	enc := json.NewEncoder(w)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// followTranscript prints transcript events as the running job appends
+// them and returns once the run finishes.
+func followTranscript(w io.Writer, runDir, format string) error {
+	path := filepath.Join(runDir, transcript.FileName)
+	runInfoPath := filepath.Join(runDir, "run-info.yaml")
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	var (
+		offset  int64
+		partial []byte
+	)
+	drain := func() (int, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, nil
+		}
+		defer f.Close()
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return 0, nil
+		}
+		data, err := io.ReadAll(f)
+		if err != nil || len(data) == 0 {
+			return 0, nil
+		}
+		offset += int64(len(data))
+		data = append(partial, data...)
+		last := bytes.LastIndexByte(data, '\n')
+		if last < 0 {
+			partial = data
+			return 0, nil
+		}
+		partial = append([]byte(nil), data[last+1:]...)
+		var events []transcript.Event
+		for _, line := range bytes.Split(data[:last], []byte("\n")) {
+			if event, ok := transcript.DecodeLine(line); ok {
+				events = append(events, event)
+			}
+		}
+		return len(events), writeTranscriptEvents(w, events, format)
+	}
+
+	lastData := time.Now()
+	for {
+		select {
+		case <-sigCh:
+			return nil
+		default:
+		}
+		n, err := drain()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			lastData = time.Now()
+		}
+		if info, err := storage.ReadRunInfo(runInfoPath); err == nil && info.Status != storage.StatusRunning {
+			_, err := drain()
+			return err
+		}
+		if time.Since(lastData) > followNoDataTimeout {
+			return nil
+		}
+		time.Sleep(followPollInterval)
+	}
+}
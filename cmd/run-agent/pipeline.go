@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/goaldecompose"
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
+	"github.com/spf13/cobra"
+)
+
+func newPipelineCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pipeline",
+		Short: "Run workflow specs as task pipelines",
+	}
+	cmd.AddCommand(newPipelineRunCmd())
+	cmd.AddCommand(newPipelineStatusCmd())
+	return cmd
+}
+
+func newPipelineRunCmd() *cobra.Command {
+	var (
+		projectID string
+		opts      runner.PipelineOptions
+		jsonOut   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run <spec.yaml>",
+		Short: "Materialize the tasks of a workflow spec and run them as a DAG",
+		Long: `Run a workflow spec (as written by "run-agent goal decompose --out") as a
+pipeline of tasks: every task gets its TASK.md (the spec prompt_file, relative
+to the spec, or a prompt built from the spec) and depends_on, and is started
+once the tasks it depends on have completed, at most max_parallel at a time.
+
+Pipeline state is kept in <root>/<project>/pipelines/<workflow_id>/
+pipeline-state.yaml; a DONE marker is written there when every task completed.
+A failed task skips its dependents. --resume keeps completed tasks and runs
+the rest again:
+  run-agent goal decompose --goal-file GOAL.md --out spec.yaml
+  run-agent pipeline run spec.yaml`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			spec, err := goaldecompose.LoadSpec(args[0])
+			if err != nil {
+				return err
+			}
+			if projectID = strings.TrimSpace(projectID); projectID != "" {
+				spec.ProjectID = projectID
+			}
+			if strings.TrimSpace(opts.RootDir) == "" {
+				opts.RootDir = spec.RootDir
+			}
+			if opts.RootDir, err = config.ResolveRunsDir(opts.RootDir); err != nil {
+				return fmt.Errorf("resolve runs dir: %w", err)
+			}
+			opts.SpecPath = args[0]
+
+			if !opts.DryRun && strings.TrimSpace(opts.ConfigPath) == "" && strings.TrimSpace(opts.Agent) == "" {
+				found, err := config.FindDefaultConfig()
+				if err != nil {
+					return err
+				}
+				opts.ConfigPath = found
+			}
+
+			result, err := runner.RunPipeline(spec, opts)
+			if result != nil {
+				if jsonOut {
+					data, jsonErr := runner.PipelineResultJSON(result)
+					if jsonErr != nil {
+						return jsonErr
+					}
+					if _, writeErr := cmd.OutOrStdout().Write(data); writeErr != nil {
+						return writeErr
+					}
+				} else {
+					fmt.Fprintf(cmd.OutOrStdout(), "pipeline state: %s\n", result.StatePath)
+					printPipelineState(cmd.OutOrStdout(), &result.State)
+				}
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (default: project_id of the spec)")
+	cmd.Flags().StringVar(&opts.RootDir, "root", "", "run-agent root directory (default: root_dir of the spec, then storage.runs_dir or ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&opts.ConfigPath, "config", "", "config file path")
+	cmd.Flags().StringVar(&opts.Agent, "agent", "", "agent type for every task (default: the agent of each task)")
+	cmd.Flags().StringVar(&opts.WorkingDir, "cwd", "", "working directory")
+	cmd.Flags().IntVar(&opts.MaxParallel, "max-parallel", 0, "maximum tasks running at once (default: max_parallel of the spec)")
+	cmd.Flags().BoolVar(&opts.Resume, "resume", false, "keep completed tasks of the previous run and run the rest")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "write tasks and pipeline state without starting tasks")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 0, "idle output timeout per job (e.g. 30m, 2h); 0 means no limit")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "output pipeline result as JSON")
+
+	return cmd
+}
+
+func newPipelineStatusCmd() *cobra.Command {
+	var (
+		root      string
+		projectID string
+		jsonOut   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "status <workflow-id|spec.yaml>",
+		Short: "Show the state of a pipeline",
+		Long: `Show the state of a pipeline started with "run-agent pipeline run". The
+argument is a workflow ID (with --project) or the spec file. Exits non-zero
+when the pipeline failed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflowID := strings.TrimSpace(args[0])
+			if info, err := os.Stat(workflowID); err == nil && !info.IsDir() {
+				spec, err := goaldecompose.LoadSpec(workflowID)
+				if err != nil {
+					return err
+				}
+				workflowID = spec.WorkflowID
+				if projectID == "" {
+					projectID = spec.ProjectID
+				}
+				if root == "" {
+					root = spec.RootDir
+				}
+			}
+			if projectID == "" {
+				return fmt.Errorf("--project is required")
+			}
+			rootDir, err := config.ResolveRunsDir(root)
+			if err != nil {
+				return fmt.Errorf("resolve runs dir: %w", err)
+			}
+			state, err := runner.LoadPipelineState(rootDir, projectID, workflowID)
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(state); err != nil {
+					return err
+				}
+			} else {
+				printPipelineState(cmd.OutOrStdout(), state)
+			}
+			if state.Status == runner.PipelineStatusFailed {
+				return fmt.Errorf("pipeline %s failed", workflowID)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "run-agent root directory (default: ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (default: project_id of the spec)")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "output pipeline state as JSON")
+
+	return cmd
+}
+
+func printPipelineState(out io.Writer, state *runner.PipelineState) {
+	counts := state.Counts()
+	fmt.Fprintf(out, "pipeline %s (project %s): %s, %d/%d tasks completed\n",
+		state.WorkflowID, state.ProjectID, state.Status, counts[runner.PipelineStatusCompleted], len(state.Tasks))
+	for _, task := range state.Tasks {
+		line := fmt.Sprintf("  %-10s %s", task.Status, task.TaskID)
+		if task.Agent != "" {
+			line += " [" + task.Agent + "]"
+		}
+		if task.Error != "" {
+			line += ": " + task.Error
+		}
+		fmt.Fprintln(out, line)
+	}
+	if !state.CompletedAt.IsZero() {
+		fmt.Fprintf(out, "finished at: %s\n", state.CompletedAt.UTC().Format(time.RFC3339))
+	}
+}
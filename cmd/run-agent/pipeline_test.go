@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/taskdeps"
+)
+
+func TestPipelineRunDryRunFromGoalDecompose(t *testing.T) {
+	t.Setenv("JRUN_PROJECT_ID", "my-project")
+	root := t.TempDir()
+	specPath := filepath.Join(t.TempDir(), "spec.yaml")
+
+	cmd := newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"goal", "decompose", "--goal", "Ship pipelines", "--out", specPath})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("goal decompose: %v", err)
+	}
+
+	var out bytes.Buffer
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"pipeline", "run", specPath, "--root", root, "--dry-run"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("pipeline run: %v", err)
+	}
+	if !strings.Contains(out.String(), ": pending, 0/8 tasks completed") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+
+	taskDirs, err := filepath.Glob(filepath.Join(root, "my-project", "task-*"))
+	if err != nil || len(taskDirs) != 8 {
+		t.Fatalf("materialized tasks = %v, %v", taskDirs, err)
+	}
+	last := taskDirs[len(taskDirs)-1]
+	if _, err := os.Stat(filepath.Join(last, "TASK.md")); err != nil {
+		t.Fatalf("TASK.md missing: %v", err)
+	}
+	if deps, err := taskdeps.ReadDependsOn(last); err != nil || len(deps) != 1 {
+		t.Fatalf("depends_on of %s = %v, %v", last, deps, err)
+	}
+
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"pipeline", "status", specPath, "--root", root})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("pipeline status: %v", err)
+	}
+	if strings.Count(out.String(), "  pending ") != 8 {
+		t.Fatalf("unexpected status:\n%s", out.String())
+	}
+}
@@ -90,10 +90,11 @@ type quorumResult struct {
 
 func runReviewQuorum(out io.Writer, root, projectID, taskID string, runIDs []string, required int) error {
 	busPath := quorumBusPath(root, projectID, taskID)
-	mb, err := messagebus.NewMessageBus(busPath)
+	mb, err := messagebus.Open(busPath, "")
 	if err != nil {
 		return fmt.Errorf("open message bus: %w", err)
 	}
+	defer mb.Close()
 
 	msgs, err := mb.ReadMessages("")
 	if err != nil {
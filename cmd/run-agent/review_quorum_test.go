@@ -51,6 +51,26 @@ func TestRunReviewQuorum_QuorumMet(t *testing.T) {
 	}
 }
 
+func TestRunReviewQuorum_ApprovalWinsOverFailWords(t *testing.T) {
+	root := t.TempDir()
+	projectID := "test-project"
+	taskID := "test-task"
+	busPath := filepath.Join(root, projectID, taskID, "TASK-MESSAGE-BUS.md")
+	bus := mkBus(t, busPath)
+
+	appendMsg(t, bus, &messagebus.Message{Type: "REVIEW", ProjectID: projectID, TaskID: taskID, RunID: "run-1", Body: "LGTM, the flaky test that FAILED yesterday is fixed"})
+	appendMsg(t, bus, &messagebus.Message{Type: "REVIEW", ProjectID: projectID, TaskID: taskID, RunID: "run-2", Body: "APPROVED — the CHANGES_REQUESTED last round are in"})
+
+	var out bytes.Buffer
+	err := runReviewQuorum(&out, root, projectID, taskID, []string{"run-1", "run-2"}, 2)
+	if err != nil {
+		t.Fatalf("expected quorum met, got error: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "QUORUM MET") {
+		t.Errorf("expected 'QUORUM MET' in output, got:\n%s", out.String())
+	}
+}
+
 func TestRunReviewQuorum_InsufficientApprovals(t *testing.T) {
 	root := t.TempDir()
 	projectID := "test-project"
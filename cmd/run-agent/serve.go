@@ -152,9 +152,13 @@ func runServe(configPath, rootDir string, disableTaskStart bool, cliHost string,
 		apiCfg.AuthEnabled = false
 	}
 
-	var extraRoots []string
+	var (
+		extraRoots []string
+		busCfg     *config.MessageBusConfig
+	)
 	if cfg != nil {
 		extraRoots = cfg.Storage.ExtraRoots
+		busCfg = &cfg.MessageBus
 	}
 
 	var agentNames []string
@@ -170,6 +174,7 @@ func runServe(configPath, rootDir string, disableTaskStart bool, cliHost string,
 		ExtraRoots:       extraRoots,
 		ConfigPath:       configPath,
 		APIConfig:        apiCfg,
+		MessageBus:       busCfg,
 		RootTaskLimit:    rootTaskLimit(cfg),
 		Version:          version,
 		AgentNames:       agentNames,
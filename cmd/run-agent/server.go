@@ -18,6 +18,7 @@ import (
 	"io"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"text/tabwriter"
@@ -49,6 +50,7 @@ directly on the local filesystem and do NOT require the server to be running.`,
 	cmd.AddCommand(newServerProjectCmd())
 	cmd.AddCommand(newServerWatchCmd())
 	cmd.AddCommand(newServerBusCmd())
+	cmd.AddCommand(newServerScheduleCmd())
 	cmd.AddCommand(newServerUpdateCmd())
 
 	return cmd
@@ -1359,6 +1361,22 @@ type serverProjectStatsResponse struct {
 	CrashedRuns          int    `json:"crashed_runs"`
 	MessageBusFiles      int    `json:"message_bus_files"`
 	MessageBusTotalBytes int64  `json:"message_bus_total_bytes"`
+
+	Usage     serverUsageTotals `json:"usage"`
+	TaskUsage []struct {
+		TaskID string            `json:"task_id"`
+		Usage  serverUsageTotals `json:"usage"`
+	} `json:"task_usage,omitempty"`
+}
+
+type serverUsageTotals struct {
+	Runs              int     `json:"runs"`
+	RunsWithUsage     int     `json:"runs_with_usage"`
+	InputTokens       int64   `json:"input_tokens"`
+	OutputTokens      int64   `json:"output_tokens"`
+	CachedInputTokens int64   `json:"cached_input_tokens"`
+	TotalTokens       int64   `json:"total_tokens"`
+	CostUSD           float64 `json:"cost_usd"`
 }
 
 type serverProjectGCResponse struct {
@@ -1488,6 +1506,14 @@ func newServerProjectStatsCmd() *cobra.Command {
 			fmt.Fprintf(w, "  Crashed:\t%d\n", result.CrashedRuns)
 			fmt.Fprintf(w, "Message bus files:\t%d\n", result.MessageBusFiles)
 			fmt.Fprintf(w, "Message bus size:\t%s\n", serverFormatBytes(result.MessageBusTotalBytes))
+			if result.Usage.RunsWithUsage > 0 {
+				fmt.Fprintf(w, "Tokens (in/out):\t%d / %d\n", result.Usage.InputTokens, result.Usage.OutputTokens)
+				fmt.Fprintf(w, "  Cached input:\t%d\n", result.Usage.CachedInputTokens)
+				fmt.Fprintf(w, "Cost (USD):\t%s\n", formatUSD(result.Usage.CostUSD))
+				for _, task := range result.TaskUsage {
+					fmt.Fprintf(w, "  %s:\t%d tokens, %s\n", task.TaskID, task.Usage.TotalTokens, formatUSD(task.Usage.CostUSD))
+				}
+			}
 			return w.Flush()
 		},
 	}
@@ -1902,13 +1928,14 @@ func newServerBusReadCmd() *cobra.Command {
 		tail       int
 		follow     bool
 		jsonOutput bool
+		where      string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "read",
 		Short: "Read messages from the project or task message bus",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return serverBusRead(cmd.OutOrStdout(), serverURL, project, taskID, tail, follow, jsonOutput)
+			return serverBusRead(cmd.OutOrStdout(), serverURL, project, taskID, tail, follow, jsonOutput, where)
 		},
 	}
 
@@ -1918,20 +1945,25 @@ func newServerBusReadCmd() *cobra.Command {
 	cmd.Flags().IntVar(&tail, "tail", 0, "show last N messages (0 = all)")
 	cmd.Flags().BoolVar(&follow, "follow", false, "stream new messages via SSE")
 	cmd.Flags().BoolVar(&jsonOutput, "json", false, "output as raw JSON array")
+	cmd.Flags().StringVar(&where, "where", "", "filter expression evaluated by the server, e.g. 'type = FACT and ts > -2h'")
 	cobra.MarkFlagRequired(cmd.Flags(), "project") //nolint:errcheck
 
 	return cmd
 }
 
-func serverBusRead(out io.Writer, serverURL, project, taskID string, tail int, follow bool, jsonOutput bool) error {
+func serverBusRead(out io.Writer, serverURL, project, taskID string, tail int, follow bool, jsonOutput bool, where string) error {
 	var baseURL string
 	if taskID != "" {
 		baseURL = serverURL + "/api/projects/" + project + "/tasks/" + taskID + "/messages"
 	} else {
 		baseURL = serverURL + "/api/projects/" + project + "/messages"
 	}
+	var query string
+	if strings.TrimSpace(where) != "" {
+		query = "?where=" + url.QueryEscape(where)
+	}
 
-	msgs, err := serverFetchBusMessages(baseURL)
+	msgs, err := serverFetchBusMessages(baseURL + query)
 	if err != nil {
 		return err
 	}
@@ -1948,7 +1980,7 @@ func serverBusRead(out io.Writer, serverURL, project, taskID string, tail int, f
 		return nil
 	}
 
-	streamURL := baseURL + "/stream"
+	streamURL := baseURL + "/stream" + query
 	retryWait := 2 * time.Second
 	const maxRetryWait = 30 * time.Second
 
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// serverSchedule mirrors the schedule JSON of /api/projects/{p}/schedules.
+type serverSchedule struct {
+	ID         string     `json:"id"`
+	Cron       string     `json:"cron"`
+	Timezone   string     `json:"timezone,omitempty"`
+	AgentType  string     `json:"agent_type"`
+	Overlap    string     `json:"overlap"`
+	CatchUp    string     `json:"catch_up"`
+	Paused     bool       `json:"paused"`
+	Pending    bool       `json:"pending,omitempty"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	LastTaskID string     `json:"last_task_id,omitempty"`
+	LastResult string     `json:"last_result,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+}
+
+type serverScheduleCreateRequest struct {
+	ID          string `json:"id"`
+	Cron        string `json:"cron"`
+	Timezone    string `json:"timezone,omitempty"`
+	AgentType   string `json:"agent_type"`
+	Prompt      string `json:"prompt"`
+	ProjectRoot string `json:"project_root,omitempty"`
+	Overlap     string `json:"overlap,omitempty"`
+	CatchUp     string `json:"catch_up,omitempty"`
+	Paused      bool   `json:"paused,omitempty"`
+}
+
+func newServerScheduleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schedule",
+		Short: "Manage scheduled (cron) tasks via the server API",
+		Long: `Schedules run a task prompt on a cron expression. Every activation creates
+a new task, task-<YYYYMMDD>-<HHMMSS>-<schedule-id>, which is queued like any
+other root task when the server's root task limit is reached. Schedules are
+stored per project in <root>/<project>/schedules.yaml.
+
+Overlap policies decide what an activation does while the previous task of
+the schedule is still queued or running:
+  skip     do not start a task (default)
+  queue    start one task once the previous one finishes
+  replace  stop the previous task and start a new one
+
+Activations missed while the server was down run once on restart
+(--catch-up once, default) or are dropped (--catch-up none).`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		},
+	}
+	cmd.AddCommand(newServerScheduleAddCmd())
+	cmd.AddCommand(newServerScheduleListCmd())
+	cmd.AddCommand(newServerScheduleRemoveCmd())
+	cmd.AddCommand(newServerSchedulePauseCmd(true))
+	cmd.AddCommand(newServerSchedulePauseCmd(false))
+	return cmd
+}
+
+func serverSchedulesURL(serverURL, project, id string) string {
+	u := serverURL + "/api/projects/" + url.PathEscape(project) + "/schedules"
+	if id != "" {
+		u += "/" + url.PathEscape(id)
+	}
+	return u
+}
+
+// serverScheduleDo sends a request to the schedules API and returns the
+// response body, failing unless the server answers with want.
+func serverScheduleDo(method, u string, body interface{}, want int) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u, reader) //nolint:noctx
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("schedules request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != want {
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+func formatScheduleTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func newServerScheduleAddCmd() *cobra.Command {
+	var (
+		serverURL  string
+		project    string
+		promptText string
+		promptFile string
+		jsonOutput bool
+		req        serverScheduleCreateRequest
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add a schedule",
+		Example: `  run-agent server schedule add --project my-project --id nightly-deps \
+    --cron "0 3 * * *" --agent claude --prompt-file prompts/deps.md
+  run-agent server schedule add --project my-project --id flaky-triage \
+    --cron "0 */6 * * mon-fri" --timezone Europe/Berlin --agent codex \
+    --prompt "Triage the flaky tests of the last CI runs" --overlap queue`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prompt, err := serverLoadPrompt(promptText, promptFile)
+			if err != nil {
+				return err
+			}
+			req.Prompt = prompt
+			data, err := serverScheduleDo(http.MethodPost, serverSchedulesURL(serverURL, project, ""), req, http.StatusCreated)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\n", strings.TrimSpace(string(data)))
+				return nil
+			}
+			var sc serverSchedule
+			if err := json.Unmarshal(data, &sc); err != nil {
+				return fmt.Errorf("decode response: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Schedule %s added (cron %q, overlap %s, next run: %s)\n",
+				sc.ID, sc.Cron, sc.Overlap, formatScheduleTime(sc.NextRunAt))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&serverURL, "server", defaultServerURL, "run-agent server URL")
+	cmd.Flags().StringVar(&project, "project", "", "project ID (required)")
+	cmd.Flags().StringVar(&req.ID, "id", "", "schedule ID, 3-40 lowercase letters, digits and hyphens (required)")
+	cmd.Flags().StringVar(&req.Cron, "cron", "", `cron expression, e.g. "0 3 * * *" or @daily (required)`)
+	cmd.Flags().StringVar(&req.Timezone, "timezone", "", "IANA time zone of the cron expression (default: server local time)")
+	cmd.Flags().StringVar(&req.AgentType, "agent", "", "agent type, e.g. claude (required)")
+	cmd.Flags().StringVar(&promptText, "prompt", "", "task prompt (mutually exclusive with --prompt-file)")
+	cmd.Flags().StringVar(&promptFile, "prompt-file", "", "path to file containing task prompt")
+	cmd.Flags().StringVar(&req.ProjectRoot, "project-root", "", "working directory for the tasks")
+	cmd.Flags().StringVar(&req.Overlap, "overlap", "skip", "overlap policy: skip, queue or replace")
+	cmd.Flags().StringVar(&req.CatchUp, "catch-up", "once", "missed activations after a restart: once or none")
+	cmd.Flags().BoolVar(&req.Paused, "paused", false, "add the schedule paused")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "output response as JSON")
+	_ = cmd.MarkFlagRequired("project")
+	_ = cmd.MarkFlagRequired("id")
+	_ = cmd.MarkFlagRequired("cron")
+	_ = cmd.MarkFlagRequired("agent")
+
+	return cmd
+}
+
+func newServerScheduleListCmd() *cobra.Command {
+	var (
+		serverURL  string
+		project    string
+		jsonOutput bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the schedules of a project",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := serverScheduleDo(http.MethodGet, serverSchedulesURL(serverURL, project, ""), nil, http.StatusOK)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\n", strings.TrimSpace(string(data)))
+				return nil
+			}
+			var result struct {
+				Schedules []serverSchedule `json:"schedules"`
+			}
+			if err := json.Unmarshal(data, &result); err != nil {
+				return fmt.Errorf("decode response: %w", err)
+			}
+			if len(result.Schedules) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "No schedules in project %s\n", project)
+				return nil
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tCRON\tAGENT\tOVERLAP\tSTATE\tNEXT RUN\tLAST RUN\tLAST RESULT\tLAST TASK")
+			for _, sc := range result.Schedules {
+				state := "active"
+				switch {
+				case sc.Paused:
+					state = "paused"
+				case sc.Pending:
+					state = "pending"
+				}
+				cronExpr := sc.Cron
+				if sc.Timezone != "" {
+					cronExpr += " (" + sc.Timezone + ")"
+				}
+				lastResult := sc.LastResult
+				if lastResult == "" {
+					lastResult = "-"
+				}
+				lastTask := sc.LastTaskID
+				if lastTask == "" {
+					lastTask = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					sc.ID, cronExpr, sc.AgentType, sc.Overlap, state,
+					formatScheduleTime(sc.NextRunAt), formatScheduleTime(sc.LastRunAt), lastResult, lastTask)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&serverURL, "server", defaultServerURL, "run-agent server URL")
+	cmd.Flags().StringVar(&project, "project", "", "project ID (required)")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "output response as JSON")
+	_ = cmd.MarkFlagRequired("project")
+
+	return cmd
+}
+
+func newServerScheduleRemoveCmd() *cobra.Command {
+	var (
+		serverURL string
+		project   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "remove <schedule-id>",
+		Short: "Remove a schedule (tasks it created are kept)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := serverScheduleDo(http.MethodDelete, serverSchedulesURL(serverURL, project, args[0]), nil, http.StatusOK); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Schedule %s removed\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&serverURL, "server", defaultServerURL, "run-agent server URL")
+	cmd.Flags().StringVar(&project, "project", "", "project ID (required)")
+	_ = cmd.MarkFlagRequired("project")
+
+	return cmd
+}
+
+// newServerSchedulePauseCmd returns "schedule pause", or "schedule resume"
+// when pause is false.
+func newServerSchedulePauseCmd(pause bool) *cobra.Command {
+	var (
+		serverURL string
+		project   string
+	)
+
+	use, short, done := "resume", "Resume a paused schedule from now on (missed activations are not run)", "resumed"
+	if pause {
+		use, short, done = "pause", "Pause a schedule", "paused"
+	}
+	cmd := &cobra.Command{
+		Use:   use + " <schedule-id>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body := map[string]bool{"paused": pause}
+			data, err := serverScheduleDo(http.MethodPatch, serverSchedulesURL(serverURL, project, args[0]), body, http.StatusOK)
+			if err != nil {
+				return err
+			}
+			var sc serverSchedule
+			if err := json.Unmarshal(data, &sc); err != nil {
+				return fmt.Errorf("decode response: %w", err)
+			}
+			if pause {
+				fmt.Fprintf(cmd.OutOrStdout(), "Schedule %s %s\n", sc.ID, done)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "Schedule %s %s (next run: %s)\n", sc.ID, done, formatScheduleTime(sc.NextRunAt))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&serverURL, "server", defaultServerURL, "run-agent server URL")
+	cmd.Flags().StringVar(&project, "project", "", "project ID (required)")
+	_ = cmd.MarkFlagRequired("project")
+
+	return cmd
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/api"
+)
+
+func runServerScheduleCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := newServerScheduleCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestServerScheduleCommands(t *testing.T) {
+	root := t.TempDir()
+	server, err := api.NewServer(api.Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	out, err := runServerScheduleCmd(t, "add", "--server", ts.URL, "--project", "my-project",
+		"--id", "nightly-deps", "--cron", "0 3 * * *", "--timezone", "UTC",
+		"--agent", "claude", "--prompt", "update dependencies", "--overlap", "queue")
+	if err != nil {
+		t.Fatalf("add: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Schedule nightly-deps added") || !strings.Contains(out, "overlap queue") {
+		t.Fatalf("add output: %q", out)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "my-project", "schedules.yaml"))
+	if err != nil || !strings.Contains(string(data), "cron: 0 3 * * *") {
+		t.Fatalf("schedules.yaml = %q, %v", data, err)
+	}
+
+	if _, err := runServerScheduleCmd(t, "add", "--server", ts.URL, "--project", "my-project",
+		"--id", "broken", "--cron", "every night", "--agent", "claude", "--prompt", "x"); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("expected invalid cron to be rejected, got %v", err)
+	}
+
+	out, err = runServerScheduleCmd(t, "pause", "nightly-deps", "--server", ts.URL, "--project", "my-project")
+	if err != nil || !strings.Contains(out, "Schedule nightly-deps paused") {
+		t.Fatalf("pause: %v %q", err, out)
+	}
+	out, err = runServerScheduleCmd(t, "list", "--server", ts.URL, "--project", "my-project")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !strings.Contains(out, "nightly-deps") || !strings.Contains(out, "0 3 * * * (UTC)") || !strings.Contains(out, "paused") {
+		t.Fatalf("list output: %q", out)
+	}
+	out, err = runServerScheduleCmd(t, "resume", "nightly-deps", "--server", ts.URL, "--project", "my-project")
+	if err != nil || !strings.Contains(out, "Schedule nightly-deps resumed (next run: ") {
+		t.Fatalf("resume: %v %q", err, out)
+	}
+
+	out, err = runServerScheduleCmd(t, "remove", "nightly-deps", "--server", ts.URL, "--project", "my-project")
+	if err != nil || !strings.Contains(out, "Schedule nightly-deps removed") {
+		t.Fatalf("remove: %v %q", err, out)
+	}
+	out, err = runServerScheduleCmd(t, "list", "--server", ts.URL, "--project", "my-project")
+	if err != nil || !strings.Contains(out, "No schedules in project my-project") {
+		t.Fatalf("list after remove: %v %q", err, out)
+	}
+}
@@ -28,6 +28,7 @@ func newStatusCmd() *cobra.Command {
 		jsonOut      bool
 		conciseOut   bool
 		activityOut  bool
+		usageOut     bool
 		driftAfter   time.Duration
 	)
 
@@ -40,7 +41,7 @@ func newStatusCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("resolve runs dir: %w", err)
 			}
-			return runStatusWithOptions(
+			return runStatusReport(
 				cmd.OutOrStdout(),
 				root,
 				projectID,
@@ -52,6 +53,7 @@ func newStatusCmd() *cobra.Command {
 					Enabled:    activityOut,
 					DriftAfter: driftAfter,
 				},
+				usageOut,
 			)
 		},
 	}
@@ -63,6 +65,7 @@ func newStatusCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&jsonOut, "json", false, "output as JSON")
 	cmd.Flags().BoolVar(&conciseOut, "concise", false, "output concise tab-separated rows: task_id status exit_code latest_run done pid_alive")
 	cmd.Flags().BoolVar(&activityOut, "activity", false, "include recent activity signals (latest bus message, output activity, meaningful-signal age, analysis drift risk)")
+	cmd.Flags().BoolVar(&usageOut, "usage", false, "include token and cost usage summed over all runs of each task, plus a project total")
 	cmd.Flags().DurationVar(&driftAfter, "drift-after", defaultAnalysisDriftAfter, "mark analysis-drift risk when a running task has no meaningful bus signal for this duration (used with --activity)")
 	_ = cmd.MarkFlagRequired("project")
 
@@ -79,6 +82,7 @@ type statusRow struct {
 	DependsOn []string             `json:"depends_on,omitempty"`
 	BlockedBy []string             `json:"blocked_by,omitempty"`
 	Activity  *taskActivitySignals `json:"activity,omitempty"`
+	Usage     *storage.UsageTotals `json:"usage,omitempty"`
 
 	latestRunStart time.Time `json:"-"`
 	latestOutput   string    `json:"-"`
@@ -91,6 +95,10 @@ func runStatus(out io.Writer, root, projectID, taskID, statusFilter string, json
 }
 
 func runStatusWithOptions(out io.Writer, root, projectID, taskID, statusFilter string, jsonOut, conciseOut bool, opts activityOptions) error {
+	return runStatusReport(out, root, projectID, taskID, statusFilter, jsonOut, conciseOut, opts, false)
+}
+
+func runStatusReport(out io.Writer, root, projectID, taskID, statusFilter string, jsonOut, conciseOut bool, opts activityOptions, usageOut bool) error {
 	projectID = strings.TrimSpace(projectID)
 	taskID = strings.TrimSpace(taskID)
 	if projectID == "" {
@@ -99,6 +107,9 @@ func runStatusWithOptions(out io.Writer, root, projectID, taskID, statusFilter s
 	if jsonOut && conciseOut {
 		return fmt.Errorf("--concise cannot be used with --json")
 	}
+	if usageOut && opts.Enabled && !jsonOut {
+		return fmt.Errorf("--usage cannot be combined with --activity unless --json is set")
+	}
 
 	projectDir := filepath.Join(root, projectID)
 	entries, err := os.ReadDir(projectDir)
@@ -138,12 +149,28 @@ func runStatusWithOptions(out io.Writer, root, projectID, taskID, statusFilter s
 		if err != nil {
 			return err
 		}
+		if usageOut {
+			totals := collectTaskUsage(filepath.Join(root, projectID, id))
+			row.Usage = &totals
+		}
 		rows = append(rows, row)
 	}
 
 	rows = filterStatusRows(rows, statusFilter)
 
+	var projectUsage storage.UsageTotals
+	if usageOut {
+		for _, row := range rows {
+			if row.Usage != nil {
+				projectUsage.Merge(*row.Usage)
+			}
+		}
+	}
+
 	if jsonOut {
+		if usageOut {
+			return encodeJSON(out, map[string]interface{}{"tasks": rows, "usage": projectUsage})
+		}
 		return encodeJSON(out, map[string]interface{}{"tasks": rows})
 	}
 
@@ -172,6 +199,21 @@ func runStatusWithOptions(out io.Writer, root, projectID, taskID, statusFilter s
 				)
 				continue
 			}
+			if usageOut {
+				fmt.Fprintf(
+					out,
+					"%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\n",
+					row.TaskID,
+					row.Status,
+					statusExitCode(row.ExitCode),
+					statusLatestRun(row.LatestRun),
+					row.Done,
+					statusPIDAlive(row.PIDAlive),
+					statusUsageTokens(row.Usage),
+					statusUsageCost(row.Usage),
+				)
+				continue
+			}
 			fmt.Fprintf(
 				out,
 				"%s\t%s\t%s\t%s\t%t\t%s\n",
@@ -187,9 +229,12 @@ func runStatusWithOptions(out io.Writer, root, projectID, taskID, statusFilter s
 	}
 
 	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
-	if opts.Enabled {
+	switch {
+	case opts.Enabled:
 		fmt.Fprintln(w, "TASK_ID\tSTATUS\tEXIT_CODE\tLATEST_RUN\tDONE\tPID_ALIVE\tBLOCKED_BY\tLAST_BUS\tLAST_OUTPUT\tMEANINGFUL_AGE\tDRIFT_RISK\tDRIFT_REASON")
-	} else {
+	case usageOut:
+		fmt.Fprintln(w, "TASK_ID\tSTATUS\tEXIT_CODE\tLATEST_RUN\tDONE\tPID_ALIVE\tBLOCKED_BY\tTOKENS\tCOST_USD")
+	default:
 		fmt.Fprintln(w, "TASK_ID\tSTATUS\tEXIT_CODE\tLATEST_RUN\tDONE\tPID_ALIVE\tBLOCKED_BY")
 	}
 	for _, row := range rows {
@@ -216,6 +261,22 @@ func runStatusWithOptions(out io.Writer, root, projectID, taskID, statusFilter s
 			)
 			continue
 		}
+		if usageOut {
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\t%s\n",
+				row.TaskID,
+				row.Status,
+				statusExitCode(row.ExitCode),
+				statusLatestRun(row.LatestRun),
+				row.Done,
+				statusPIDAlive(row.PIDAlive),
+				blockedBy,
+				statusUsageTokens(row.Usage),
+				statusUsageCost(row.Usage),
+			)
+			continue
+		}
 		fmt.Fprintf(
 			w,
 			"%s\t%s\t%s\t%s\t%t\t%s\t%s\n",
@@ -231,6 +292,15 @@ func runStatusWithOptions(out io.Writer, root, projectID, taskID, statusFilter s
 	if err := w.Flush(); err != nil {
 		return err
 	}
+	if usageOut && projectUsage.RunsWithUsage > 0 {
+		fmt.Fprintf(out, "Total usage: %d input / %d output tokens (%d cached), %s across %d runs\n",
+			projectUsage.InputTokens,
+			projectUsage.OutputTokens,
+			projectUsage.CachedInputTokens,
+			formatUSD(projectUsage.CostUSD),
+			projectUsage.RunsWithUsage,
+		)
+	}
 	if len(rows) == 0 && strings.TrimSpace(statusFilter) != "" {
 		_, err := fmt.Fprintln(out, statusEmptyMessage(projectID, taskID, statusFilter))
 		return err
@@ -483,6 +553,47 @@ func statusActivityReason(signals *taskActivitySignals) string {
 	return safeField(signals.DriftReason)
 }
 
+// collectTaskUsage sums the usage recorded in run-info.yaml across every run
+// of the task. Unreadable run directories are skipped.
+func collectTaskUsage(taskDir string) storage.UsageTotals {
+	var totals storage.UsageTotals
+	runsDir := filepath.Join(taskDir, "runs")
+	entries, err := os.ReadDir(runsDir)
+	if err != nil {
+		return totals
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := runstate.ReadRunInfo(filepath.Join(runsDir, entry.Name(), "run-info.yaml"))
+		if err != nil {
+			continue
+		}
+		totals.AddRun(info)
+	}
+	return totals
+}
+
+func statusUsageTokens(usage *storage.UsageTotals) string {
+	if usage == nil || usage.RunsWithUsage == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", usage.TotalTokens)
+}
+
+func statusUsageCost(usage *storage.UsageTotals) string {
+	if usage == nil || usage.RunsWithUsage == 0 || usage.CostUSD == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.4f", usage.CostUSD)
+}
+
+// formatUSD renders a dollar amount with enough precision for small runs.
+func formatUSD(amount float64) string {
+	return fmt.Sprintf("$%.4f", amount)
+}
+
 func intPointer(value int) *int {
 	v := value
 	return &v
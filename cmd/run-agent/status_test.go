@@ -495,3 +495,71 @@ func TestRunStatusText_ActivityColumns(t *testing.T) {
 		}
 	}
 }
+
+func setRunUsage(t *testing.T, runDir string, usage storage.Usage) {
+	t.Helper()
+	path := filepath.Join(runDir, "run-info.yaml")
+	if err := storage.UpdateRunInfo(path, func(info *storage.RunInfo) error {
+		info.Usage = &usage
+		return nil
+	}); err != nil {
+		t.Fatalf("update run-info: %v", err)
+	}
+}
+
+func TestRunStatusUsage_SumsAllRunsPerTask(t *testing.T) {
+	root := t.TempDir()
+	project := "proj"
+	now := time.Now().UTC()
+	task := "task-20260101-000001-aa"
+	other := "task-20260101-000002-bb"
+
+	setRunUsage(t, makeRun(t, root, project, task, "run-001", storage.StatusFailed, now.Add(-2*time.Minute), 1),
+		storage.Usage{InputTokens: 1000, OutputTokens: 100, CostUSD: 0.02})
+	setRunUsage(t, makeRun(t, root, project, task, "run-002", storage.StatusCompleted, now.Add(-time.Minute), 0),
+		storage.Usage{InputTokens: 500, OutputTokens: 50, CachedInputTokens: 400, CostUSD: 0.01})
+	makeRun(t, root, project, other, "run-003", storage.StatusCompleted, now, 0)
+
+	var buf bytes.Buffer
+	if err := runStatusReport(&buf, root, project, "", "", true, false, activityOptions{}, true); err != nil {
+		t.Fatalf("runStatusReport: %v", err)
+	}
+	var payload struct {
+		Tasks []statusRow         `json:"tasks"`
+		Usage storage.UsageTotals `json:"usage"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+		t.Fatalf("invalid JSON: %v\noutput: %s", err, buf.String())
+	}
+	row := findStatusRow(t, payload.Tasks, task)
+	if row.Usage == nil {
+		t.Fatalf("expected usage for %s", task)
+	}
+	if row.Usage.Runs != 2 || row.Usage.TotalTokens != 1650 || row.Usage.CachedInputTokens != 400 {
+		t.Fatalf("unexpected task usage: %+v", *row.Usage)
+	}
+	if payload.Usage.Runs != 3 || payload.Usage.RunsWithUsage != 2 {
+		t.Fatalf("unexpected project usage: %+v", payload.Usage)
+	}
+
+	buf.Reset()
+	if err := runStatusReport(&buf, root, project, "", "", false, false, activityOptions{}, true); err != nil {
+		t.Fatalf("runStatusReport: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"TOKENS", "COST_USD", "1650", "0.0300", "Total usage: 1500 input / 150 output tokens"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestRunStatusUsage_RejectsActivityTable(t *testing.T) {
+	root := t.TempDir()
+	makeRun(t, root, "proj", "task-20260101-000001-aa", "run-001", storage.StatusCompleted, time.Now(), 0)
+	var buf bytes.Buffer
+	err := runStatusReport(&buf, root, "proj", "", "", false, false, activityOptions{Enabled: true}, true)
+	if err == nil {
+		t.Fatal("expected error combining --usage with --activity")
+	}
+}
@@ -168,7 +168,7 @@ func runValidate(configPath, rootDir, agentFilter string, checkNetwork, checkTok
 // checkToken performs a deep accessibility check on the token for the given agent.
 // It returns a human-readable description and whether the token is accessible.
 func checkToken(agentName string, agentCfg config.AgentConfig) (string, bool) {
-	agType := strings.ToLower(agentCfg.Type)
+	desc, _ := runner.AgentDescriptor(agentCfg)
 
 	// Token set directly in config (also catches CONDUCTOR_AGENT_<NAME>_TOKEN overrides).
 	if agentCfg.Token != "" {
@@ -191,14 +191,22 @@ func checkToken(agentName string, agentCfg config.AgentConfig) (string, bool) {
 	}
 
 	// No explicit token — check the well-known env var for this agent type.
-	envVar := validateTokenEnvVar(agType)
+	envVar := desc.TokenEnvVar
 	if envVar != "" {
 		if os.Getenv(envVar) != "" {
 			return fmt.Sprintf("env %s [OK]", envVar), true
 		}
+		if desc.TokenOptional {
+			return fmt.Sprintf("env %s [NOT SET - optional]", envVar), true
+		}
 		return fmt.Sprintf("env %s [NOT SET]", envVar), false
 	}
 
+	// Self-hosted openai-compatible servers often run without authentication.
+	if desc.TokenOptional {
+		return "token [NOT SET - optional]", true
+	}
+
 	return "token [NOT SET]", false
 }
 
@@ -209,13 +217,14 @@ func validateSingleAgent(ctx context.Context, name string, agentCfg config.Agent
 	}
 
 	agType := strings.ToLower(agentCfg.Type)
+	desc, descErr := runner.AgentDescriptor(agentCfg)
 
 	// Check CLI availability (REST agents have no local CLI).
-	if isValidateRestAgent(agType) {
+	if descErr == nil && desc.REST {
 		result.cliStatus = "REST agent"
 	} else {
-		cliName := validateCLIName(agType)
-		if cliName == "" {
+		cliName := desc.Binary
+		if descErr != nil || cliName == "" {
 			result.cliStatus = fmt.Sprintf("unknown type %q", agType)
 			result.ok = false
 		} else {
@@ -225,9 +234,11 @@ func validateSingleAgent(ctx context.Context, name string, agentCfg config.Agent
 				result.ok = false
 			} else {
 				result.cliStatus = "CLI found"
-				ver, verErr := agent.DetectCLIVersion(ctx, path)
-				if verErr == nil {
-					result.version = extractValidateVersion(ver)
+				if desc.ProbeVersion {
+					ver, verErr := agent.DetectCLIVersion(ctx, path)
+					if verErr == nil {
+						result.version = extractValidateVersion(ver)
+					}
 				}
 			}
 		}
@@ -240,7 +251,7 @@ func validateSingleAgent(ctx context.Context, name string, agentCfg config.Agent
 		if tokenErr != nil {
 			result.ok = false
 		}
-		result.tokenStatus = computeTokenStatus(agType, agentCfg.Token, tokenErr == nil)
+		result.tokenStatus = computeTokenStatus(desc, agentCfg.Token, tokenErr == nil)
 	}
 
 	return result
@@ -268,14 +279,14 @@ func printAgentResult(r agentCheckResult) {
 
 // computeTokenStatus returns a short human-readable description of the token
 // availability for display in the validate output.
-func computeTokenStatus(agType, configToken string, ok bool) string {
-	if isValidateRestAgent(agType) {
+func computeTokenStatus(desc agent.Descriptor, configToken string, ok bool) string {
+	if desc.REST {
 		if ok {
 			return "token set"
 		}
 		return "not set"
 	}
-	envVar := validateTokenEnvVar(agType)
+	envVar := desc.TokenEnvVar
 	if ok {
 		if envVar != "" && os.Getenv(envVar) != "" {
 			return envVar + " set"
@@ -332,42 +343,3 @@ func extractValidateVersion(raw string) string {
 	}
 	return m[1]
 }
-
-func isValidateRestAgent(agType string) bool {
-	switch agType {
-	case "perplexity", "xai":
-		return true
-	default:
-		return false
-	}
-}
-
-func validateCLIName(agType string) string {
-	switch agType {
-	case "claude":
-		return "claude"
-	case "codex":
-		return "codex"
-	case "gemini":
-		return "gemini"
-	default:
-		return ""
-	}
-}
-
-func validateTokenEnvVar(agType string) string {
-	switch agType {
-	case "claude":
-		return "ANTHROPIC_API_KEY"
-	case "codex":
-		return "OPENAI_API_KEY"
-	case "gemini":
-		return "GEMINI_API_KEY"
-	case "perplexity":
-		return "PERPLEXITY_API_KEY"
-	case "xai":
-		return "XAI_API_KEY"
-	default:
-		return ""
-	}
-}
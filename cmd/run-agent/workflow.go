@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -19,6 +20,7 @@ func newWorkflowCmd() *cobra.Command {
 		Short: "Workflow orchestration utilities",
 	}
 	cmd.AddCommand(newWorkflowRunCmd())
+	cmd.AddCommand(newWorkflowTemplatesCmd())
 	return cmd
 }
 
@@ -33,6 +35,14 @@ func newWorkflowRunCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "run",
 		Short: "Run staged workflow execution with persisted stage state",
+		Long: `Run the stages of a workflow template for a task, persisting stage state
+so that --resume skips completed stages.
+
+--template is a built-in template (THE_PROMPT_v5), a template file, or the
+name of <name>.yaml found in <root>/<project>/workflows/, a --template-dir,
+or workflows.dirs of the config. Templates define stages with prompt
+templates, per-stage agent, timeout, retries and output gates; see
+"run-agent workflow templates".`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			projectID = strings.TrimSpace(projectID)
 			taskID = strings.TrimSpace(taskID)
@@ -90,9 +100,11 @@ func newWorkflowRunCmd() *cobra.Command {
 	cmd.Flags().StringVar(&opts.ConfigPath, "config", "", "config file path")
 	cmd.Flags().StringVar(&opts.Agent, "agent", "", "agent type")
 	cmd.Flags().StringVar(&opts.WorkingDir, "cwd", "", "working directory")
-	cmd.Flags().StringVar(&opts.Template, "template", runner.WorkflowTemplatePromptV5, "workflow template")
+	cmd.Flags().StringVar(&opts.Template, "template", runner.WorkflowTemplatePromptV5, "workflow template name or file")
+	cmd.Flags().StringArrayVar(&opts.TemplateDirs, "template-dir", nil, "additional directory to search for workflow templates (repeatable)")
+	cmd.Flags().StringToStringVar(&opts.Vars, "var", nil, "template variable name=value (repeatable)")
 	cmd.Flags().IntVar(&opts.FromStage, "from-stage", 0, "first stage to execute")
-	cmd.Flags().IntVar(&opts.ToStage, "to-stage", 12, "last stage to execute")
+	cmd.Flags().IntVar(&opts.ToStage, "to-stage", -1, "last stage to execute (default: the last stage of the template)")
 	cmd.Flags().BoolVar(&opts.Resume, "resume", false, "resume from persisted stage state (skip completed stages)")
 	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "plan stages and persist state without executing jobs")
 	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 0, "idle output timeout per stage (e.g. 30m, 2h); 0 means no limit")
@@ -103,6 +115,81 @@ func newWorkflowRunCmd() *cobra.Command {
 	return cmd
 }
 
+func newWorkflowTemplatesCmd() *cobra.Command {
+	var (
+		root         string
+		projectID    string
+		configPath   string
+		templateDirs []string
+		jsonOut      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "templates",
+		Short: "List the available workflow templates",
+		Long: `List the built-in workflow templates and those found in
+<root>/<project>/workflows/, --template-dir and workflows.dirs of the config.
+
+A template is a YAML file:
+  name: ship
+  agent: claude            # default agent of all stages
+  timeout: 30m             # default idle timeout of all stages
+  retries: 1               # default extra attempts after a failed stage
+  vars: {branch: main}
+  stages:
+    - name: Plan
+      prompt: "Plan {{.Vars.branch}} work for {{.TaskDir}}"
+    - name: Review
+      agent: codex
+      prompt_file: review.md
+      retries: 2
+      retry_delay: 1m
+      gate: {output_contains: APPROVED}`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rootDir, err := config.ResolveRunsDir(root)
+			if err != nil {
+				return fmt.Errorf("resolve runs dir: %w", err)
+			}
+			if strings.TrimSpace(projectID) == "" {
+				projectID = firstNonEmpty(strings.TrimSpace(os.Getenv("JRUN_PROJECT_ID")), inferProjectFromCWD())
+			}
+			dirs, err := runner.WorkflowTemplateDirs(rootDir, strings.TrimSpace(projectID), configPath, templateDirs)
+			if err != nil {
+				return err
+			}
+			templates, loadErrs := runner.ListWorkflowTemplates(dirs)
+			for _, loadErr := range loadErrs {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: %v\n", loadErr)
+			}
+			if jsonOut {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(map[string]interface{}{"templates": templates})
+			}
+			for _, tmpl := range templates {
+				source := tmpl.Source
+				if source == "" {
+					source = "built-in"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s (%d stages) %s\n", tmpl.Name, len(tmpl.Stages), source)
+				if tmpl.Description != "" {
+					fmt.Fprintf(cmd.OutOrStdout(), "  %s\n", tmpl.Description)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", "", "run-agent root directory (default: storage.runs_dir or ~/.run-agent/runs)")
+	cmd.Flags().StringVar(&projectID, "project", "", "project whose workflows directory is searched")
+	cmd.Flags().StringVar(&configPath, "config", "", "config file path (for workflows.dirs)")
+	cmd.Flags().StringArrayVar(&templateDirs, "template-dir", nil, "additional directory to search for workflow templates (repeatable)")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "output templates as JSON")
+
+	return cmd
+}
+
 func printWorkflowRunSummary(out io.Writer, result *runner.WorkflowResult) error {
 	if result == nil {
 		return nil
@@ -113,6 +200,13 @@ func printWorkflowRunSummary(out io.Writer, result *runner.WorkflowResult) error
 	if _, err := fmt.Fprintf(out, "template: %s stages: %d..%d\n", result.Template, result.FromStage, result.ToStage); err != nil {
 		return err
 	}
+	for _, step := range result.PlannedSteps {
+		if len(step) > 1 {
+			if _, err := fmt.Fprintf(out, "parallel stages: %v\n", step); err != nil {
+				return err
+			}
+		}
+	}
 	if result.DryRun {
 		_, err := fmt.Fprintf(out, "dry-run planned stages: %v\n", result.PlannedStages)
 		return err
@@ -125,6 +219,11 @@ func printWorkflowRunSummary(out io.Writer, result *runner.WorkflowResult) error
 			return err
 		}
 	}
+	for _, jump := range result.State.Jumps {
+		if _, err := fmt.Fprintf(out, "routed: stage %d -> %d\n", jump.From, jump.To); err != nil {
+			return err
+		}
+	}
 	if !result.State.CompletedAt.IsZero() {
 		if _, err := fmt.Fprintf(out, "completed at: %s\n", result.State.CompletedAt.UTC().Format(time.RFC3339)); err != nil {
 			return err
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -103,3 +105,47 @@ func TestWorkflowRunDryRunJSON(t *testing.T) {
 		t.Fatalf("template = %q, want %q", result.Template, runner.WorkflowTemplatePromptV5)
 	}
 }
+
+func TestWorkflowRunDryRunCustomTemplate(t *testing.T) {
+	t.Setenv("JRUN_PROJECT_ID", "my-project")
+	root := t.TempDir()
+	templatesDir := filepath.Join(root, "my-project", "workflows")
+	if err := os.MkdirAll(templatesDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	template := "name: ship\nstages:\n  - {name: Plan, prompt: plan}\n  - {name: Implement, prompt: build}\n  - {name: Ship, prompt: ship}\n"
+	if err := os.WriteFile(filepath.Join(templatesDir, "ship.yaml"), []byte(template), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	cmd := newRootCmd()
+	cmd.SetOut(&stdout)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{
+		"workflow", "run",
+		"--task", "task-20260301-140000-ship",
+		"--root", root,
+		"--template", "ship",
+		"--dry-run",
+	})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if out := stdout.String(); !strings.Contains(out, "template: ship stages: 0..2") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+
+	stdout.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&stdout)
+	cmd.SetErr(io.Discard)
+	cmd.SetArgs([]string{"workflow", "templates", "--root", root, "--project", "my-project"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("execute templates: %v", err)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "THE_PROMPT_v5 (13 stages) built-in") || !strings.Contains(out, "ship (3 stages) "+filepath.Join(templatesDir, "ship.yaml")) {
+		t.Fatalf("unexpected templates output: %q", out)
+	}
+}
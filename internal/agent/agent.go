@@ -1,7 +1,11 @@
 // Package agent defines shared interfaces and run context for agent backends.
 package agent
 
-import "context"
+import (
+	"context"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
 
 // Agent defines the common behavior implemented by all agent backends.
 type Agent interface {
@@ -23,3 +27,10 @@ type RunContext struct {
 	StderrPath  string
 	Environment map[string]string
 }
+
+// UsageReporter is implemented by backends that collect token usage while
+// executing (e.g. REST agents reading the usage block of the API response).
+// Usage returns the usage of the most recent Execute call.
+type UsageReporter interface {
+	Usage() (storage.Usage, bool)
+}
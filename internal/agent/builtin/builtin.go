@@ -0,0 +1,12 @@
+// Package builtin registers the agent backends shipped with conductor-loop.
+// Import it for its side effects wherever agent.Lookup must see them.
+package builtin
+
+import (
+	_ "github.com/jonnyzzz/conductor-loop/internal/agent/claude"
+	_ "github.com/jonnyzzz/conductor-loop/internal/agent/codex"
+	_ "github.com/jonnyzzz/conductor-loop/internal/agent/gemini"
+	_ "github.com/jonnyzzz/conductor-loop/internal/agent/openaicompat"
+	_ "github.com/jonnyzzz/conductor-loop/internal/agent/perplexity"
+	_ "github.com/jonnyzzz/conductor-loop/internal/agent/xai"
+)
@@ -0,0 +1,48 @@
+package claude
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+)
+
+const outputPlaceholder = "# Agent Output\n\n*The agent did not write output.md. Raw output is available in the stdout tab.*\n"
+
+func init() {
+	agent.Register(agent.Descriptor{
+		Type:         "claude",
+		TokenEnvVar:  "ANTHROPIC_API_KEY",
+		Binary:       claudeCommand,
+		ProbeVersion: true,
+		MinVersion:   "1.0.0",
+		ConfigPaths:  []string{".claude", ".claude.json"},
+		Command: func(agent.Invocation) (agent.Command, error) {
+			return agent.Command{
+				Path: claudeCommand,
+				Args: []string{
+					"-p",
+					"--input-format", "text",
+					"--output-format", "stream-json",
+					"--verbose",
+					"--tools", "default",
+					"--permission-mode", "bypassPermissions",
+				},
+				PromptOnStdin: true,
+			}, nil
+		},
+		WriteOutput:         writeOutput,
+		ParseUsage:          ParseUsage,
+		NewTranscriptParser: NewTranscriptParser,
+	})
+}
+
+// writeOutput extracts output.md from the stream and leaves a placeholder
+// pointing at the raw stdout when the stream cannot be parsed.
+func writeOutput(runDir, stdoutPath string) error {
+	if err := WriteOutputMDFromStream(runDir, stdoutPath); err != nil {
+		_ = os.WriteFile(filepath.Join(runDir, "output.md"), []byte(outputPlaceholder), 0o644)
+		return err
+	}
+	return nil
+}
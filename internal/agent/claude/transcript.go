@@ -0,0 +1,131 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+)
+
+// transcriptBlock is a content block of an assistant or user message.
+type transcriptBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Thinking  string          `json:"thinking,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// transcriptParser converts Claude stream-json lines into transcript events.
+type transcriptParser struct {
+	// toolNames maps tool_use ids to tool names for the matching results.
+	toolNames map[string]string
+}
+
+// NewTranscriptParser returns a transcript parser for stream-json stdout.
+func NewTranscriptParser() transcript.Parser {
+	return &transcriptParser{toolNames: make(map[string]string)}
+}
+
+// ParseLine implements transcript.Parser.
+func (p *transcriptParser) ParseLine(line []byte) []transcript.Event {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	var event streamEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		return nil
+	}
+	switch event.Type {
+	case "assistant", "user":
+		return p.messageEvents(event.Message)
+	case "result":
+		if event.IsError {
+			text := strings.TrimSpace(event.Result)
+			if text == "" {
+				text = "claude reported an error result"
+				if event.Subtype != "" {
+					text += " (" + event.Subtype + ")"
+				}
+			}
+			return []transcript.Event{{Type: transcript.TypeError, Text: text}}
+		}
+	}
+	return nil
+}
+
+// Flush implements transcript.Parser.
+func (p *transcriptParser) Flush() []transcript.Event {
+	return nil
+}
+
+func (p *transcriptParser) messageEvents(raw json.RawMessage) []transcript.Event {
+	if len(raw) == 0 {
+		return nil
+	}
+	var msg struct {
+		Content []transcriptBlock `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil
+	}
+	var events []transcript.Event
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			if block.Text != "" {
+				events = append(events, transcript.Event{Type: transcript.TypeAssistantText, Text: block.Text})
+			}
+		case "thinking":
+			if block.Thinking != "" {
+				events = append(events, transcript.Event{Type: transcript.TypeThinking, Text: block.Thinking})
+			}
+		case "tool_use":
+			p.toolNames[block.ID] = block.Name
+			events = append(events, transcript.Event{
+				Type:   transcript.TypeToolCall,
+				Tool:   block.Name,
+				CallID: block.ID,
+				Input:  block.Input,
+			})
+		case "tool_result":
+			events = append(events, transcript.Event{
+				Type:    transcript.TypeToolResult,
+				Tool:    p.toolNames[block.ToolUseID],
+				CallID:  block.ToolUseID,
+				Text:    toolResultText(block.Content),
+				IsError: block.IsError,
+			})
+		}
+	}
+	return events
+}
+
+// toolResultText flattens a tool_result content field, which is either a
+// string or a list of text blocks.
+func toolResultText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var blocks []messageContent
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return ""
+	}
+	parts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Type == "text" && block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,52 @@
+package claude
+
+import (
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+)
+
+func TestTranscriptParser(t *testing.T) {
+	input := `{"type":"system","subtype":"init","session_id":"xxx","model":"claude-sonnet"}
+{"type":"assistant","message":{"content":[{"type":"thinking","thinking":"Need to list files."}]}}
+{"type":"assistant","message":{"content":[{"type":"text","text":"Listing files."},{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"ls"}}]}}
+{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"a.go"}],"is_error":false}]}}
+{"type":"assistant","message":{"content":[{"type":"text","text":"Done."}]}}
+{"type":"result","subtype":"success","is_error":false,"result":"Done."}`
+
+	events := transcript.Parse([]byte(input), NewTranscriptParser())
+	wantTypes := []string{
+		transcript.TypeThinking,
+		transcript.TypeAssistantText,
+		transcript.TypeToolCall,
+		transcript.TypeToolResult,
+		transcript.TypeAssistantText,
+	}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("expected %d events, got %+v", len(wantTypes), events)
+	}
+	for i, want := range wantTypes {
+		if events[i].Type != want {
+			t.Fatalf("event %d type = %q, want %q", i, events[i].Type, want)
+		}
+	}
+	call := events[2]
+	if call.Tool != "Bash" || call.CallID != "toolu_1" || string(call.Input) != `{"command":"ls"}` {
+		t.Fatalf("unexpected tool call: %+v", call)
+	}
+	result := events[3]
+	if result.Tool != "Bash" || result.CallID != "toolu_1" || result.Text != "a.go" || result.IsError {
+		t.Fatalf("unexpected tool result: %+v", result)
+	}
+}
+
+func TestTranscriptParserErrorResult(t *testing.T) {
+	input := `{"type":"result","subtype":"error_max_turns","is_error":true}`
+	events := transcript.Parse([]byte(input), NewTranscriptParser())
+	if len(events) != 1 || events[0].Type != transcript.TypeError {
+		t.Fatalf("expected one error event, got %+v", events)
+	}
+	if events[0].Text != "claude reported an error result (error_max_turns)" {
+		t.Fatalf("unexpected error text: %q", events[0].Text)
+	}
+}
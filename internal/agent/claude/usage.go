@@ -0,0 +1,119 @@
+package claude
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// usageBlock mirrors the Anthropic Messages API usage object.
+type usageBlock struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+func (u usageBlock) toUsage() storage.Usage {
+	return storage.Usage{
+		InputTokens:       u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		OutputTokens:      u.OutputTokens,
+		CachedInputTokens: u.CacheReadInputTokens,
+	}
+}
+
+// usageEvent holds the stream-json fields relevant to usage accounting.
+type usageEvent struct {
+	Type         string      `json:"type"`
+	Model        string      `json:"model,omitempty"`
+	Usage        *usageBlock `json:"usage,omitempty"`
+	TotalCostUSD *float64    `json:"total_cost_usd,omitempty"`
+	Message      *struct {
+		ID    string      `json:"id"`
+		Model string      `json:"model"`
+		Usage *usageBlock `json:"usage"`
+	} `json:"message,omitempty"`
+}
+
+// ParseUsage extracts token usage from Claude's stream-json output.
+// The cumulative "result" event is authoritative; when it is missing the
+// per-message usage blocks of assistant events are summed (deduplicated by
+// message id, since Claude repeats a message once per content block).
+// Returns (Usage{}, false) if no usage information is found.
+func ParseUsage(data []byte) (storage.Usage, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	var (
+		model       string
+		result      *storage.Usage
+		perMessage  = make(map[string]usageBlock)
+		messageKeys []string
+	)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var event usageEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		switch event.Type {
+		case "system":
+			if m := strings.TrimSpace(event.Model); m != "" {
+				model = m
+			}
+		case "assistant":
+			if event.Message == nil {
+				continue
+			}
+			if m := strings.TrimSpace(event.Message.Model); m != "" {
+				model = m
+			}
+			if event.Message.Usage == nil {
+				continue
+			}
+			key := event.Message.ID
+			if key == "" {
+				key = "#" + strconv.Itoa(len(messageKeys))
+			}
+			if _, seen := perMessage[key]; !seen {
+				messageKeys = append(messageKeys, key)
+			}
+			perMessage[key] = *event.Message.Usage
+		case "result":
+			if event.Usage == nil && event.TotalCostUSD == nil {
+				continue
+			}
+			usage := storage.Usage{}
+			if event.Usage != nil {
+				usage = event.Usage.toUsage()
+			}
+			if event.TotalCostUSD != nil && *event.TotalCostUSD > 0 {
+				usage.CostUSD = *event.TotalCostUSD
+				usage.CostSource = storage.CostSourceAgent
+			}
+			result = &usage
+		}
+	}
+
+	if result != nil {
+		result.Model = model
+		return *result, true
+	}
+	if len(messageKeys) == 0 {
+		return storage.Usage{}, false
+	}
+	var total storage.Usage
+	for _, key := range messageKeys {
+		total.Add(perMessage[key].toUsage())
+	}
+	total.Model = model
+	return total, true
+}
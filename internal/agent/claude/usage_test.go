@@ -0,0 +1,54 @@
+package claude
+
+import "testing"
+
+func TestParseUsageResultEvent(t *testing.T) {
+	input := `{"type":"system","subtype":"init","session_id":"xxx","model":"claude-sonnet-4-5"}
+{"type":"assistant","message":{"id":"msg_1","model":"claude-sonnet-4-5","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":3,"output_tokens":5}}}
+{"type":"result","subtype":"success","is_error":false,"result":"done","total_cost_usd":0.0421,"usage":{"input_tokens":10,"cache_creation_input_tokens":200,"cache_read_input_tokens":1000,"output_tokens":50}}`
+
+	usage, ok := ParseUsage([]byte(input))
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if usage.InputTokens != 1210 {
+		t.Fatalf("expected 1210 input tokens, got %d", usage.InputTokens)
+	}
+	if usage.CachedInputTokens != 1000 {
+		t.Fatalf("expected 1000 cached tokens, got %d", usage.CachedInputTokens)
+	}
+	if usage.OutputTokens != 50 {
+		t.Fatalf("expected 50 output tokens, got %d", usage.OutputTokens)
+	}
+	if usage.CostUSD != 0.0421 || usage.CostSource != "agent" {
+		t.Fatalf("unexpected cost: %v (%s)", usage.CostUSD, usage.CostSource)
+	}
+	if usage.Model != "claude-sonnet-4-5" {
+		t.Fatalf("unexpected model: %q", usage.Model)
+	}
+}
+
+func TestParseUsageFallbackToAssistantMessages(t *testing.T) {
+	input := `{"type":"assistant","message":{"id":"msg_1","content":[{"type":"text","text":"a"}],"usage":{"input_tokens":10,"output_tokens":2}}}
+{"type":"assistant","message":{"id":"msg_1","content":[{"type":"tool_use","name":"Read"}],"usage":{"input_tokens":10,"output_tokens":4}}}
+{"type":"assistant","message":{"id":"msg_2","content":[{"type":"text","text":"b"}],"usage":{"input_tokens":20,"output_tokens":6}}}`
+
+	usage, ok := ParseUsage([]byte(input))
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if usage.InputTokens != 30 || usage.OutputTokens != 10 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if usage.CostUSD != 0 {
+		t.Fatalf("expected no cost, got %v", usage.CostUSD)
+	}
+}
+
+func TestParseUsageNoUsage(t *testing.T) {
+	input := `{"type":"assistant","message":{"content":[{"type":"text","text":"a"}]}}
+not json`
+	if _, ok := ParseUsage([]byte(input)); ok {
+		t.Fatal("expected ok=false")
+	}
+}
@@ -0,0 +1,27 @@
+package codex
+
+import (
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+)
+
+func init() {
+	agent.Register(agent.Descriptor{
+		Type:         "codex",
+		TokenEnvVar:  tokenEnvVar,
+		ExtraEnvVars: []string{"OPENAI_ORG_ID"},
+		Binary:       codexCommand,
+		ProbeVersion: true,
+		MinVersion:   "0.1.0",
+		ConfigPaths:  []string{".codex"},
+		Command: func(agent.Invocation) (agent.Command, error) {
+			return agent.Command{
+				Path:          codexCommand,
+				Args:          []string{"exec", "--dangerously-bypass-approvals-and-sandbox", "--json", "-"},
+				PromptOnStdin: true,
+			}, nil
+		},
+		WriteOutput:         WriteOutputMDFromStream,
+		ParseUsage:          ParseUsage,
+		NewTranscriptParser: NewTranscriptParser,
+	})
+}
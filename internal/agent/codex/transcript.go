@@ -0,0 +1,175 @@
+package codex
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+)
+
+// transcriptItem is the item payload of Codex item.* events.
+type transcriptItem struct {
+	ID               string          `json:"id"`
+	Type             string          `json:"type"`
+	Text             string          `json:"text"`
+	Command          string          `json:"command"`
+	AggregatedOutput string          `json:"aggregated_output"`
+	ExitCode         *int            `json:"exit_code"`
+	Status           string          `json:"status"`
+	Changes          json.RawMessage `json:"changes"`
+	Server           string          `json:"server"`
+	Tool             string          `json:"tool"`
+	Arguments        json.RawMessage `json:"arguments"`
+	Result           json.RawMessage `json:"result"`
+	Error            json.RawMessage `json:"error"`
+	Query            string          `json:"query"`
+	Message          string          `json:"message"`
+}
+
+// transcriptParser converts Codex --json NDJSON lines into transcript events.
+type transcriptParser struct {
+	// started records item ids whose tool_call was already emitted.
+	started map[string]bool
+	// emitted is the assistant text seen so far in legacy message events,
+	// used to drop cumulative duplicates.
+	emitted string
+}
+
+// NewTranscriptParser returns a transcript parser for Codex NDJSON stdout.
+func NewTranscriptParser() transcript.Parser {
+	return &transcriptParser{started: make(map[string]bool)}
+}
+
+// ParseLine implements transcript.Parser.
+func (p *transcriptParser) ParseLine(line []byte) []transcript.Event {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(line, &event); err != nil {
+		return nil
+	}
+	eventType := textField(event["type"])
+	switch eventType {
+	case "item.started", "item.updated", "item.completed":
+		var item transcriptItem
+		if err := json.Unmarshal(event["item"], &item); err != nil {
+			return nil
+		}
+		return p.itemEvents(item, eventType == "item.completed")
+	case "error":
+		if text := textField(event["message"]); text != "" {
+			return []transcript.Event{{Type: transcript.TypeError, Text: text}}
+		}
+	case "turn.failed":
+		if text := textField(event["error"]); text != "" {
+			return []transcript.Event{{Type: transcript.TypeError, Text: text}}
+		}
+	}
+	if text := parseCodexTopLevelText(eventType, event); text != "" {
+		var builder strings.Builder
+		before := p.emitted
+		appendNormalized(&builder, &p.emitted, text)
+		if p.emitted != before && builder.Len() > 0 {
+			return []transcript.Event{{Type: transcript.TypeAssistantText, Text: strings.TrimSpace(builder.String())}}
+		}
+	}
+	return nil
+}
+
+// Flush implements transcript.Parser.
+func (p *transcriptParser) Flush() []transcript.Event {
+	return nil
+}
+
+func (p *transcriptParser) itemEvents(item transcriptItem, completed bool) []transcript.Event {
+	switch item.Type {
+	case "agent_message", "message":
+		if completed && strings.TrimSpace(item.Text) != "" {
+			return []transcript.Event{{Type: transcript.TypeAssistantText, Text: strings.TrimSpace(item.Text)}}
+		}
+		return nil
+	case "reasoning":
+		if completed && strings.TrimSpace(item.Text) != "" {
+			return []transcript.Event{{Type: transcript.TypeThinking, Text: strings.TrimSpace(item.Text)}}
+		}
+		return nil
+	case "error":
+		if completed && item.Message != "" {
+			return []transcript.Event{{Type: transcript.TypeError, Text: item.Message}}
+		}
+		return nil
+	}
+
+	tool, input := itemToolCall(item)
+	if tool == "" {
+		return nil
+	}
+	var events []transcript.Event
+	if !p.started[item.ID] {
+		p.started[item.ID] = true
+		events = append(events, transcript.Event{
+			Type:   transcript.TypeToolCall,
+			Tool:   tool,
+			CallID: item.ID,
+			Input:  input,
+		})
+	}
+	if completed {
+		delete(p.started, item.ID)
+		events = append(events, itemToolResult(item, tool))
+	}
+	return events
+}
+
+// itemToolCall maps a Codex tool-like item onto a tool name and arguments.
+func itemToolCall(item transcriptItem) (string, json.RawMessage) {
+	switch item.Type {
+	case "command_execution":
+		return "command_execution", marshalInput(map[string]string{"command": item.Command})
+	case "file_change":
+		return "file_change", marshalInput(map[string]json.RawMessage{"changes": item.Changes})
+	case "mcp_tool_call":
+		name := item.Tool
+		if item.Server != "" {
+			name = item.Server + "." + item.Tool
+		}
+		return name, item.Arguments
+	case "web_search":
+		return "web_search", marshalInput(map[string]string{"query": item.Query})
+	}
+	return "", nil
+}
+
+func itemToolResult(item transcriptItem, tool string) transcript.Event {
+	result := transcript.Event{
+		Type:   transcript.TypeToolResult,
+		Tool:   tool,
+		CallID: item.ID,
+		Text:   item.AggregatedOutput,
+	}
+	if result.Text == "" {
+		result.Text = textField(item.Result)
+	}
+	if errText := textField(item.Error); errText != "" {
+		result.Text = errText
+		result.IsError = true
+	}
+	if item.ExitCode != nil && *item.ExitCode != 0 {
+		result.IsError = true
+	}
+	if item.Status == "failed" {
+		result.IsError = true
+	}
+	return result
+}
+
+func marshalInput(value interface{}) json.RawMessage {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -0,0 +1,63 @@
+package codex
+
+import (
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+)
+
+func TestTranscriptParser(t *testing.T) {
+	input := `{"type":"thread.started","thread_id":"t1"}
+{"type":"item.completed","item":{"id":"item_0","type":"reasoning","text":"Check the tree."}}
+{"type":"item.started","item":{"id":"item_1","type":"command_execution","command":"bash -lc ls","aggregated_output":"","exit_code":null,"status":"in_progress"}}
+{"type":"item.completed","item":{"id":"item_1","type":"command_execution","command":"bash -lc ls","aggregated_output":"main.go\n","exit_code":0,"status":"completed"}}
+{"type":"item.completed","item":{"id":"item_2","type":"command_execution","command":"false","aggregated_output":"","exit_code":1,"status":"failed"}}
+{"type":"item.completed","item":{"id":"item_3","type":"agent_message","text":"All done."}}
+{"type":"turn.completed","usage":{"input_tokens":10,"cached_input_tokens":0,"output_tokens":5}}
+{"type":"error","message":"stream disconnected"}`
+
+	events := transcript.Parse([]byte(input), NewTranscriptParser())
+	wantTypes := []string{
+		transcript.TypeThinking,
+		transcript.TypeToolCall,
+		transcript.TypeToolResult,
+		transcript.TypeToolCall,
+		transcript.TypeToolResult,
+		transcript.TypeAssistantText,
+		transcript.TypeError,
+	}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("expected %d events, got %+v", len(wantTypes), events)
+	}
+	for i, want := range wantTypes {
+		if events[i].Type != want {
+			t.Fatalf("event %d type = %q, want %q", i, events[i].Type, want)
+		}
+	}
+	if string(events[1].Input) != `{"command":"bash -lc ls"}` || events[1].CallID != "item_1" {
+		t.Fatalf("unexpected tool call: %+v", events[1])
+	}
+	if events[2].Text != "main.go\n" || events[2].IsError {
+		t.Fatalf("unexpected tool result: %+v", events[2])
+	}
+	if !events[4].IsError {
+		t.Fatalf("expected failed command result, got %+v", events[4])
+	}
+	if events[5].Text != "All done." || events[6].Text != "stream disconnected" {
+		t.Fatalf("unexpected text events: %+v %+v", events[5], events[6])
+	}
+}
+
+func TestTranscriptParserLegacyMessages(t *testing.T) {
+	input := `{"type":"message","content":"Hello"}
+{"type":"message","content":"Hello world"}
+{"type":"result","result":"Hello world"}`
+
+	events := transcript.Parse([]byte(input), NewTranscriptParser())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if events[0].Text != "Hello" || events[1].Text != "world" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
@@ -0,0 +1,60 @@
+package codex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// codexUsage mirrors the usage object attached to Codex turn.completed events.
+type codexUsage struct {
+	InputTokens       int64 `json:"input_tokens"`
+	CachedInputTokens int64 `json:"cached_input_tokens"`
+	OutputTokens      int64 `json:"output_tokens"`
+}
+
+// ParseUsage extracts token usage from Codex --json NDJSON output by summing
+// the usage blocks of every turn.completed event.
+// Returns (Usage{}, false) if no usage information is found.
+func ParseUsage(data []byte) (storage.Usage, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	var (
+		total storage.Usage
+		found bool
+		model string
+	)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var event struct {
+			Type  string      `json:"type"`
+			Model string      `json:"model"`
+			Usage *codexUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		if m := strings.TrimSpace(event.Model); m != "" {
+			model = m
+		}
+		if event.Type != "turn.completed" || event.Usage == nil {
+			continue
+		}
+		found = true
+		total.InputTokens += event.Usage.InputTokens
+		total.CachedInputTokens += event.Usage.CachedInputTokens
+		total.OutputTokens += event.Usage.OutputTokens
+	}
+	if !found {
+		return storage.Usage{}, false
+	}
+	total.Model = model
+	return total, true
+}
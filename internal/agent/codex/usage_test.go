@@ -0,0 +1,26 @@
+package codex
+
+import "testing"
+
+func TestParseUsageSumsTurns(t *testing.T) {
+	input := `{"type":"thread.started","thread_id":"t1"}
+{"type":"item.completed","item":{"id":"item_0","type":"agent_message","text":"hi"}}
+{"type":"turn.completed","usage":{"input_tokens":1000,"cached_input_tokens":800,"output_tokens":40}}
+noise line
+{"type":"turn.completed","usage":{"input_tokens":500,"cached_input_tokens":100,"output_tokens":10}}`
+
+	usage, ok := ParseUsage([]byte(input))
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if usage.InputTokens != 1500 || usage.CachedInputTokens != 900 || usage.OutputTokens != 50 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestParseUsageNoTurns(t *testing.T) {
+	input := `{"type":"item.completed","item":{"type":"agent_message","text":"hi"}}`
+	if _, ok := ParseUsage([]byte(input)); ok {
+		t.Fatal("expected ok=false")
+	}
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CustomType is the config-declared agent type that runs an arbitrary
+// command template instead of a registered backend.
+const CustomType = "custom"
+
+// Prompt delivery modes of custom agents.
+const (
+	PromptModeStdin = "stdin"
+	PromptModeFile  = "file"
+)
+
+// CustomSpec describes a custom agent declared in the config file.
+type CustomSpec struct {
+	// Command is the argv template. {prompt_file}, {run_dir} and {cwd} are
+	// replaced with the run's prompt path, run directory and working dir.
+	Command []string
+	// PromptMode is PromptModeStdin (default) or PromptModeFile. In file
+	// mode the prompt path is appended when the template has no
+	// {prompt_file} placeholder.
+	PromptMode string
+	// TokenEnv names the variable the configured token is exported as.
+	TokenEnv string
+}
+
+// NewCustomDescriptor builds a CLI descriptor for a custom agent.
+func NewCustomDescriptor(spec CustomSpec) (Descriptor, error) {
+	if len(spec.Command) == 0 || strings.TrimSpace(spec.Command[0]) == "" {
+		return Descriptor{}, errors.New("custom agent command is empty")
+	}
+	mode := strings.ToLower(strings.TrimSpace(spec.PromptMode))
+	if mode == "" {
+		mode = PromptModeStdin
+	}
+	if mode != PromptModeStdin && mode != PromptModeFile {
+		return Descriptor{}, errors.Errorf("custom agent prompt_mode %q is invalid; valid values: stdin, file", spec.PromptMode)
+	}
+	template := append([]string(nil), spec.Command...)
+	return Descriptor{
+		Type:          CustomType,
+		TokenEnvVar:   strings.TrimSpace(spec.TokenEnv),
+		TokenOptional: true,
+		Binary:        strings.TrimSpace(template[0]),
+		Command: func(inv Invocation) (Command, error) {
+			return expandCustomCommand(template, mode, inv), nil
+		},
+	}, nil
+}
+
+func expandCustomCommand(template []string, mode string, inv Invocation) Command {
+	replacer := strings.NewReplacer(
+		"{prompt_file}", inv.PromptPath,
+		"{run_dir}", inv.RunDir,
+		"{cwd}", inv.WorkingDir,
+	)
+	usesPromptFile := false
+	args := make([]string, 0, len(template))
+	for _, arg := range template[1:] {
+		if strings.Contains(arg, "{prompt_file}") {
+			usesPromptFile = true
+		}
+		args = append(args, replacer.Replace(arg))
+	}
+	if mode == PromptModeFile && !usesPromptFile {
+		args = append(args, inv.PromptPath)
+	}
+	return Command{
+		Path:          replacer.Replace(strings.TrimSpace(template[0])),
+		Args:          args,
+		PromptOnStdin: mode == PromptModeStdin,
+	}
+}
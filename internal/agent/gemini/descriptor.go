@@ -0,0 +1,101 @@
+package gemini
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+)
+
+const geminiCommand = "gemini"
+
+var (
+	streamJSONMu      sync.Mutex
+	streamJSONChecked = make(map[string]error)
+)
+
+func init() {
+	agent.Register(agent.Descriptor{
+		Type:         "gemini",
+		TokenEnvVar:  tokenEnvVar,
+		Binary:       geminiCommand,
+		ProbeVersion: true,
+		MinVersion:   "0.1.0",
+		ConfigPaths:  []string{".gemini"},
+		Command: func(agent.Invocation) (agent.Command, error) {
+			if err := CheckStreamJSONSupport(); err != nil {
+				return agent.Command{}, err
+			}
+			return agent.Command{
+				Path:          geminiCommand,
+				Args:          []string{"--screen-reader", "true", "--approval-mode", "yolo", "--output-format", "stream-json"},
+				PromptOnStdin: true,
+			}, nil
+		},
+		WriteOutput:         WriteOutputMDFromStream,
+		OutputFailure:       outputFailure,
+		ParseUsage:          ParseUsage,
+		NewTranscriptParser: NewTranscriptParser,
+	})
+}
+
+// CheckStreamJSONSupport verifies the Gemini CLI binary supports
+// --output-format stream-json. Returns a descriptive error if not supported.
+// The result is cached per resolved binary path.
+func CheckStreamJSONSupport() error {
+	path, err := exec.LookPath(geminiCommand)
+	if err != nil {
+		return fmt.Errorf("gemini CLI not found or failed to run (install from https://github.com/google-gemini/gemini-cli): %w", err)
+	}
+	streamJSONMu.Lock()
+	defer streamJSONMu.Unlock()
+	if checkErr, ok := streamJSONChecked[path]; ok {
+		return checkErr
+	}
+	checkErr := probeStreamJSONSupport(path)
+	streamJSONChecked[path] = checkErr
+	return checkErr
+}
+
+func probeStreamJSONSupport(path string) error {
+	helpOut, err := exec.Command(path, "--help").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("gemini CLI not found or failed to run (install from https://github.com/google-gemini/gemini-cli): %w", err)
+	}
+	if !strings.Contains(strings.ToLower(string(helpOut)), "output-format") {
+		return fmt.Errorf("installed Gemini CLI does not support --output-format stream-json; please update to the latest version (npm install -g @google/gemini-cli or brew upgrade gemini-cli)")
+	}
+	return nil
+}
+
+// IsStreamJSONFlagError checks whether a Gemini stderr file contains a
+// flag-rejection message indicating the CLI version does not support
+// --output-format stream-json.
+func IsStreamJSONFlagError(stderrPath string) bool {
+	if stderrPath == "" {
+		return false
+	}
+	data, err := os.ReadFile(stderrPath)
+	if err != nil {
+		return false
+	}
+	lower := strings.ToLower(string(data))
+	for _, keyword := range []string{"unknown flag", "unrecognized option", "output-format", "stream-json", "invalid flag"} {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// outputFailure fails runs whose CLI rejected stream-json even though the
+// --help probe advertised it.
+func outputFailure(stderrPath string) string {
+	if IsStreamJSONFlagError(stderrPath) {
+		return "gemini CLI rejected --output-format stream-json"
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package gemini
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCheckStreamJSONSupport_NotInstalled(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	err := CheckStreamJSONSupport()
+	if err == nil {
+		t.Fatalf("expected error when gemini is not installed")
+	}
+	if !strings.Contains(strings.ToLower(err.Error()), "not found") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestCheckStreamJSONSupport_OldVersion(t *testing.T) {
+	binDir := t.TempDir()
+	createFakeGeminiCLIForHelp(t, binDir, false)
+	t.Setenv("PATH", binDir)
+
+	err := CheckStreamJSONSupport()
+	if err == nil {
+		t.Fatalf("expected old-version error")
+	}
+	if !strings.Contains(err.Error(), "does not support --output-format stream-json") {
+		t.Fatalf("expected actionable stream-json error, got %v", err)
+	}
+}
+
+func TestCheckStreamJSONSupport_Supported(t *testing.T) {
+	binDir := t.TempDir()
+	createFakeGeminiCLIForHelp(t, binDir, true)
+	t.Setenv("PATH", binDir)
+
+	if err := CheckStreamJSONSupport(); err != nil {
+		t.Fatalf("expected stream-json support, got %v", err)
+	}
+}
+
+func TestOutputFailure(t *testing.T) {
+	stderrPath := filepath.Join(t.TempDir(), "agent-stderr.txt")
+	if got := outputFailure(stderrPath); got != "" {
+		t.Fatalf("expected no failure for missing stderr, got %q", got)
+	}
+	if err := os.WriteFile(stderrPath, []byte("error: unknown flag --output-format\n"), 0o644); err != nil {
+		t.Fatalf("write stderr: %v", err)
+	}
+	if got := outputFailure(stderrPath); !strings.Contains(got, "stream-json") {
+		t.Fatalf("expected stream-json failure, got %q", got)
+	}
+}
+
+func createFakeGeminiCLIForHelp(t *testing.T, dir string, supportsOutputFormat bool) {
+	t.Helper()
+
+	helpLine := "Usage: gemini [options]"
+	if supportsOutputFormat {
+		helpLine = "Usage: gemini [options] --output-format stream-json"
+	}
+
+	if runtime.GOOS == "windows" {
+		path := filepath.Join(dir, "gemini.bat")
+		content := "@echo off\r\nif \"%1\"==\"--help\" (\r\n  echo " + helpLine + "\r\n  exit /b 0\r\n)\r\n"
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write bat: %v", err)
+		}
+		return
+	}
+
+	path := filepath.Join(dir, "gemini")
+	content := "#!/bin/sh\nif [ \"$1\" = \"--help\" ]; then\n  echo '" + helpLine + "'\n  exit 0\nfi\n"
+	if err := os.WriteFile(path, []byte(content), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+)
+
+// transcriptParser converts Gemini stream-json lines into transcript events.
+// Assistant message chunks are coalesced into one assistant_text event per
+// uninterrupted reply.
+type transcriptParser struct {
+	text      strings.Builder
+	emitted   string
+	toolNames map[string]string
+}
+
+// NewTranscriptParser returns a transcript parser for stream-json stdout.
+func NewTranscriptParser() transcript.Parser {
+	return &transcriptParser{toolNames: make(map[string]string)}
+}
+
+// ParseLine implements transcript.Parser.
+func (p *transcriptParser) ParseLine(line []byte) []transcript.Event {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(line, &event); err != nil {
+		return nil
+	}
+	eventType := geminiTextField(event["type"])
+	switch eventType {
+	case "message", "assistant":
+		text := parseGeminiMessageText(eventType, event)
+		if text == "" {
+			return nil
+		}
+		// Keep the whitespace between streamed chunks.
+		var raw string
+		if err := json.Unmarshal(event["content"], &raw); err == nil && strings.TrimSpace(raw) == text {
+			text = raw
+		}
+		var delta bool
+		_ = json.Unmarshal(event["delta"], &delta)
+		if delta {
+			p.text.WriteString(text)
+		} else {
+			p.text.WriteString(diffText(p.emitted, text))
+		}
+		p.emitted = p.text.String()
+		return nil
+	case "tool_use":
+		id := geminiTextField(event["tool_id"])
+		name := geminiTextField(event["tool_name"])
+		p.toolNames[id] = name
+		return append(p.Flush(), transcript.Event{
+			Type:   transcript.TypeToolCall,
+			Tool:   name,
+			CallID: id,
+			Input:  event["parameters"],
+		})
+	case "tool_result":
+		id := geminiTextField(event["tool_id"])
+		result := transcript.Event{
+			Type:    transcript.TypeToolResult,
+			Tool:    p.toolNames[id],
+			CallID:  id,
+			Text:    geminiTextField(event["output"]),
+			IsError: geminiTextField(event["status"]) == "error",
+		}
+		if errText := geminiTextField(event["error"]); errText != "" {
+			result.Text = errText
+			result.IsError = true
+		}
+		return append(p.Flush(), result)
+	case "error":
+		text := geminiTextField(event["message"])
+		if text == "" {
+			return nil
+		}
+		return append(p.Flush(), transcript.Event{Type: transcript.TypeError, Text: text})
+	case "result":
+		events := p.Flush()
+		if geminiTextField(event["status"]) == "error" {
+			text := geminiTextField(event["error"])
+			if text == "" {
+				text = "gemini reported an error result"
+			}
+			events = append(events, transcript.Event{Type: transcript.TypeError, Text: text})
+		}
+		return events
+	}
+	return nil
+}
+
+// Flush implements transcript.Parser.
+func (p *transcriptParser) Flush() []transcript.Event {
+	text := strings.TrimSpace(p.text.String())
+	p.text.Reset()
+	p.emitted = ""
+	if text == "" {
+		return nil
+	}
+	return []transcript.Event{{Type: transcript.TypeAssistantText, Text: text}}
+}
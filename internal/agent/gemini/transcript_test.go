@@ -0,0 +1,53 @@
+package gemini
+
+import (
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+)
+
+func TestTranscriptParser(t *testing.T) {
+	input := `{"type":"init","session_id":"s1","model":"gemini-2.5-pro"}
+{"type":"message","role":"user","content":"list files"}
+{"type":"message","role":"assistant","content":"Let me ","delta":true}
+{"type":"message","role":"assistant","content":"look.","delta":true}
+{"type":"tool_use","tool_name":"list_directory","tool_id":"t1","parameters":{"path":"."}}
+{"type":"tool_result","tool_id":"t1","status":"success","output":"main.go"}
+{"type":"tool_use","tool_name":"read_file","tool_id":"t2","parameters":{"path":"x"}}
+{"type":"tool_result","tool_id":"t2","status":"error","error":{"type":"not_found","message":"no such file"}}
+{"type":"message","role":"assistant","content":"Found main.go."}
+{"type":"result","status":"success","stats":{"input_tokens":5,"output_tokens":3}}`
+
+	events := transcript.Parse([]byte(input), NewTranscriptParser())
+	wantTypes := []string{
+		transcript.TypeAssistantText,
+		transcript.TypeToolCall,
+		transcript.TypeToolResult,
+		transcript.TypeToolCall,
+		transcript.TypeToolResult,
+		transcript.TypeAssistantText,
+	}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("expected %d events, got %+v", len(wantTypes), events)
+	}
+	for i, want := range wantTypes {
+		if events[i].Type != want {
+			t.Fatalf("event %d type = %q, want %q", i, events[i].Type, want)
+		}
+	}
+	if events[0].Text != "Let me look." {
+		t.Fatalf("unexpected coalesced text: %q", events[0].Text)
+	}
+	if events[1].Tool != "list_directory" || string(events[1].Input) != `{"path":"."}` {
+		t.Fatalf("unexpected tool call: %+v", events[1])
+	}
+	if events[2].Tool != "list_directory" || events[2].Text != "main.go" || events[2].IsError {
+		t.Fatalf("unexpected tool result: %+v", events[2])
+	}
+	if !events[4].IsError || events[4].Text != "no such file" {
+		t.Fatalf("unexpected failed tool result: %+v", events[4])
+	}
+	if events[5].Text != "Found main.go." {
+		t.Fatalf("unexpected final text: %q", events[5].Text)
+	}
+}
@@ -0,0 +1,68 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// geminiStats mirrors the stats object attached to the stream-json result event.
+type geminiStats struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	Cached       int64 `json:"cached"`
+	TotalTokens  int64 `json:"total_tokens"`
+}
+
+// ParseUsage extracts token usage from the Gemini stream-json result event.
+// The model is taken from the init event when present.
+// Returns (Usage{}, false) if no usage information is found.
+func ParseUsage(data []byte) (storage.Usage, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	var (
+		usage storage.Usage
+		found bool
+		model string
+	)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var event struct {
+			Type  string       `json:"type"`
+			Model string       `json:"model"`
+			Stats *geminiStats `json:"stats"`
+		}
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		if m := strings.TrimSpace(event.Model); m != "" {
+			model = m
+		}
+		if event.Type != "result" || event.Stats == nil {
+			continue
+		}
+		stats := event.Stats
+		output := stats.OutputTokens
+		if output == 0 && stats.TotalTokens > stats.InputTokens {
+			output = stats.TotalTokens - stats.InputTokens
+		}
+		usage = storage.Usage{
+			InputTokens:       stats.InputTokens,
+			OutputTokens:      output,
+			CachedInputTokens: stats.Cached,
+		}
+		found = true
+	}
+	if !found {
+		return storage.Usage{}, false
+	}
+	usage.Model = model
+	return usage, true
+}
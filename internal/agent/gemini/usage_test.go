@@ -0,0 +1,37 @@
+package gemini
+
+import "testing"
+
+func TestParseUsageResultStats(t *testing.T) {
+	input := `{"type":"init","session_id":"s1","model":"gemini-2.5-pro"}
+{"type":"message","role":"assistant","content":"hello","delta":true}
+{"type":"result","status":"success","stats":{"total_tokens":130,"input_tokens":100,"output_tokens":30,"cached":20,"duration_ms":900,"tool_calls":0}}`
+
+	usage, ok := ParseUsage([]byte(input))
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if usage.InputTokens != 100 || usage.OutputTokens != 30 || usage.CachedInputTokens != 20 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if usage.Model != "gemini-2.5-pro" {
+		t.Fatalf("unexpected model: %q", usage.Model)
+	}
+}
+
+func TestParseUsageDerivesOutputFromTotal(t *testing.T) {
+	input := `{"type":"result","stats":{"total_tokens":130,"input_tokens":100}}`
+	usage, ok := ParseUsage([]byte(input))
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if usage.OutputTokens != 30 {
+		t.Fatalf("expected 30 output tokens, got %d", usage.OutputTokens)
+	}
+}
+
+func TestParseUsageMissingResult(t *testing.T) {
+	if _, ok := ParseUsage([]byte(`{"type":"message","role":"assistant","content":"x"}`)); ok {
+		t.Fatal("expected ok=false")
+	}
+}
@@ -0,0 +1,120 @@
+package openaicompat
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/agent/tools"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// TypeName identifies the generic OpenAI-compatible agent type.
+const TypeName = "openai-compatible"
+
+// Config configures the openai-compatible agent backend.
+type Config struct {
+	APIKey     string
+	BaseURL    string
+	Model      string
+	Headers    map[string]string
+	HTTPClient *http.Client
+	// Tools enables the function-calling tool loop when non-nil.
+	Tools *tools.Options
+}
+
+// Agent runs prompts against a configurable chat-completions endpoint.
+type Agent struct {
+	client *Client
+	tools  *tools.Options
+
+	usage    storage.Usage
+	hasUsage bool
+}
+
+// NewAgent builds an openai-compatible agent. BaseURL is required; the API
+// key is optional because many self-hosted servers do not check it.
+func NewAgent(cfg Config) (*Agent, error) {
+	if strings.TrimSpace(cfg.BaseURL) == "" {
+		return nil, errors.New("openai-compatible agent requires base_url")
+	}
+	endpoint, err := ResolveEndpoint(cfg.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewClient(ClientConfig{
+		Name:        TypeName,
+		APIKey:      cfg.APIKey,
+		Endpoint:    endpoint,
+		Model:       cfg.Model,
+		Headers:     cfg.Headers,
+		HTTPClient:  cfg.HTTPClient,
+		MaxAttempts: DefaultMaxAttempts,
+		IdleTimeout: DefaultIdleTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Agent{client: client, tools: cfg.Tools}, nil
+}
+
+// Type returns the agent type identifier.
+func (a *Agent) Type() string {
+	return TypeName
+}
+
+// Execute sends the prompt and streams the reply into the run's stdout file.
+func (a *Agent) Execute(ctx context.Context, runCtx *agent.RunContext) (err error) {
+	if runCtx == nil {
+		return errors.New("run context is nil")
+	}
+	if strings.TrimSpace(runCtx.Prompt) == "" {
+		return errors.New("prompt is empty")
+	}
+
+	capture, err := agent.CaptureOutput(nil, nil, agent.OutputFiles{
+		StdoutPath: runCtx.StdoutPath,
+		StderrPath: runCtx.StderrPath,
+	})
+	if err != nil {
+		return errors.Wrap(err, "capture output")
+	}
+	defer func() {
+		if cerr := capture.Close(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "close output capture")
+		}
+	}()
+
+	a.usage, a.hasUsage = storage.Usage{}, false
+	usage, err := Run(ctx, a.client, runCtx, a.tools, capture.Stdout, capture.Stderr, nil)
+	if usage != nil {
+		if usage.Model == "" {
+			usage.Model = a.client.Model()
+		}
+		a.usage, a.hasUsage = *usage, true
+	}
+	return err
+}
+
+// Usage returns the token usage reported by the most recent Execute call.
+func (a *Agent) Usage() (storage.Usage, bool) {
+	return a.usage, a.hasUsage
+}
+
+// Run sends the run's prompt through client, using the tool loop when
+// toolOpts is set. Provider packages share it so every REST agent enables
+// tools the same way.
+func Run(ctx context.Context, client *Client, runCtx *agent.RunContext, toolOpts *tools.Options, stdout, stderr io.Writer, observer Observer) (*storage.Usage, error) {
+	if toolOpts == nil {
+		return client.Complete(ctx, runCtx.Prompt, stdout, stderr, observer)
+	}
+	set, err := tools.NewSet(runCtx, *toolOpts)
+	if err != nil {
+		return nil, errors.Wrap(err, "build tool set")
+	}
+	return client.CompleteWithTools(ctx, runCtx.Prompt, set, DefaultMaxToolTurns, stdout, stderr, observer)
+}
@@ -0,0 +1,113 @@
+package openaicompat
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	agentpkg "github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/agent/tools"
+)
+
+func TestNewAgentRequiresBaseURL(t *testing.T) {
+	if _, err := NewAgent(Config{Model: "llama3"}); err == nil {
+		t.Fatalf("expected error for missing base url")
+	}
+}
+
+func TestAgentExecute(t *testing.T) {
+	var gotPath string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		gotPath = r.URL.Path
+		return sseResponse("data: {\"choices\":[{\"delta\":{\"content\":\"local \"}}]}\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\"model\"}}]}\n" +
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2}}\n" +
+			"data: [DONE]\n"), nil
+	})}
+	agent, err := NewAgent(Config{BaseURL: "http://localhost:11434/v1", Model: "qwen2.5-coder", HTTPClient: client})
+	if err != nil {
+		t.Fatalf("NewAgent: %v", err)
+	}
+	if agent.Type() != TypeName {
+		t.Fatalf("unexpected type: %q", agent.Type())
+	}
+	dir := t.TempDir()
+	runCtx := &agentpkg.RunContext{
+		Prompt:     "prompt",
+		StdoutPath: filepath.Join(dir, "stdout.txt"),
+		StderrPath: filepath.Join(dir, "stderr.txt"),
+	}
+	if err := agent.Execute(context.Background(), runCtx); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if gotPath != "/v1/chat/completions" {
+		t.Fatalf("unexpected request path: %q", gotPath)
+	}
+	data, err := os.ReadFile(runCtx.StdoutPath)
+	if err != nil {
+		t.Fatalf("read stdout: %v", err)
+	}
+	if string(data) != "local model" {
+		t.Fatalf("unexpected stdout: %q", string(data))
+	}
+	usage, ok := agent.Usage()
+	if !ok || usage.InputTokens != 5 || usage.OutputTokens != 2 || usage.Model != "qwen2.5-coder" {
+		t.Fatalf("unexpected usage: %+v ok=%v", usage, ok)
+	}
+}
+
+func TestAgentExecuteValidation(t *testing.T) {
+	agent, err := NewAgent(Config{BaseURL: "http://localhost:8000", HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(strings.NewReader("")), Header: http.Header{}}, nil
+	})}})
+	if err != nil {
+		t.Fatalf("NewAgent: %v", err)
+	}
+	if err := agent.Execute(context.Background(), nil); err == nil {
+		t.Fatalf("expected error for nil run context")
+	}
+	if err := agent.Execute(context.Background(), &agentpkg.RunContext{Prompt: "  "}); err == nil {
+		t.Fatalf("expected error for empty prompt")
+	}
+}
+
+func TestAgentExecuteWithTools(t *testing.T) {
+	calls := 0
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			return sseResponse("data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"write_file\",\"arguments\":\"{\\\"path\\\":\\\"notes.txt\\\",\\\"content\\\":\\\"done\\\"}\"}}]}}]}\ndata: [DONE]\n"), nil
+		}
+		return sseResponse("data: {\"choices\":[{\"delta\":{\"content\":\"wrote notes\"}}]}\ndata: [DONE]\n"), nil
+	})}
+	agent, err := NewAgent(Config{BaseURL: "http://localhost:8000", HTTPClient: client, Tools: &tools.Options{}})
+	if err != nil {
+		t.Fatalf("NewAgent: %v", err)
+	}
+	dir := t.TempDir()
+	workDir := t.TempDir()
+	runCtx := &agentpkg.RunContext{
+		Prompt:     "write notes",
+		WorkingDir: workDir,
+		StdoutPath: filepath.Join(dir, "stdout.txt"),
+		StderrPath: filepath.Join(dir, "stderr.txt"),
+	}
+	if err := agent.Execute(context.Background(), runCtx); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	notes, err := os.ReadFile(filepath.Join(workDir, "notes.txt"))
+	if err != nil || string(notes) != "done" {
+		t.Fatalf("expected notes.txt to be written, got %q (%v)", notes, err)
+	}
+	stdout, err := os.ReadFile(runCtx.StdoutPath)
+	if err != nil {
+		t.Fatalf("read stdout: %v", err)
+	}
+	if !strings.Contains(string(stdout), `[tool] {"id":"call_1","tool":"write_file"`) || !strings.HasSuffix(string(stdout), "wrote notes") {
+		t.Fatalf("unexpected stdout: %q", stdout)
+	}
+}
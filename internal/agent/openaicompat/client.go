@@ -0,0 +1,380 @@
+// Package openaicompat implements a REST backend for any OpenAI-compatible
+// chat-completions endpoint (vLLM, llama.cpp server, Ollama, LiteLLM, Azure
+// OpenAI, xAI, Perplexity). Provider packages wrap Client with their own
+// defaults; the openai-compatible agent type uses it directly.
+package openaicompat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+const (
+	// DefaultMaxAttempts is the attempt count used by the openai-compatible
+	// agent type for retryable failures (network errors, 429 and 5xx).
+	DefaultMaxAttempts = 5
+	// DefaultIdleTimeout aborts a stream that stops sending data.
+	DefaultIdleTimeout = 60 * time.Second
+
+	defaultDialTimeout    = 10 * time.Second
+	defaultHeaderTimeout  = 60 * time.Second
+	defaultConnIdle       = 90 * time.Second
+	defaultMaxIdleConns   = 100
+	defaultMaxLineSize    = 1024 * 1024
+	defaultUserAgent      = "conductor-loop/openai-compatible"
+	streamContentTypeHint = "text/event-stream"
+	maxRetryBackoff       = 32 * time.Second
+)
+
+// ClientConfig configures a chat-completions client.
+type ClientConfig struct {
+	// Name labels errors and retry logs, e.g. "xai". Defaults to TypeName.
+	Name string
+	// APIKey is sent as a Bearer token unless Headers sets Authorization.
+	// Local model servers typically need none.
+	APIKey string
+	// Endpoint is the full chat-completions URL and is used verbatim.
+	Endpoint string
+	// Model is sent as the request model.
+	Model string
+	// Headers are added to every request (e.g. Azure "api-key").
+	Headers map[string]string
+	// HTTPClient overrides the default transport.
+	HTTPClient *http.Client
+	// UserAgent overrides the User-Agent header.
+	UserAgent string
+	// MaxAttempts bounds retries for retryable failures; <= 1 means one attempt.
+	MaxAttempts int
+	// IdleTimeout aborts a stream with no data for this long; 0 disables it.
+	IdleTimeout time.Duration
+	// OmitStreamOptions drops stream_options for servers that reject it.
+	OmitStreamOptions bool
+	// CumulativeContent strips already-written text from deltas for
+	// providers that resend the full message in every chunk.
+	CumulativeContent bool
+}
+
+// Observer lets a provider inspect each decoded stream chunk and append
+// trailing output once the stream completes (e.g. citations).
+type Observer interface {
+	ObserveChunk(raw []byte) error
+	Finish(stdout io.Writer) error
+}
+
+// Client sends prompts to a chat-completions endpoint.
+type Client struct {
+	cfg ClientConfig
+}
+
+// NewClient validates cfg and builds a Client.
+func NewClient(cfg ClientConfig) (*Client, error) {
+	cfg.Name = strings.TrimSpace(cfg.Name)
+	if cfg.Name == "" {
+		cfg.Name = TypeName
+	}
+	cfg.Endpoint = strings.TrimSpace(cfg.Endpoint)
+	if cfg.Endpoint == "" {
+		return nil, errors.Errorf("%s api endpoint is empty", cfg.Name)
+	}
+	cfg.APIKey = strings.TrimSpace(cfg.APIKey)
+	cfg.Model = strings.TrimSpace(cfg.Model)
+	if cfg.UserAgent = strings.TrimSpace(cfg.UserAgent); cfg.UserAgent == "" {
+		cfg.UserAgent = defaultUserAgent
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = DefaultHTTPClient()
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &Client{cfg: cfg}, nil
+}
+
+// Endpoint returns the chat-completions URL the client posts to.
+func (c *Client) Endpoint() string {
+	return c.cfg.Endpoint
+}
+
+// Model returns the configured request model.
+func (c *Client) Model() string {
+	return c.cfg.Model
+}
+
+// Complete sends prompt as a single user message and streams the reply to
+// stdout. Retry notices go to stderr. The returned usage is the last usage
+// block reported by the server, or nil when it reported none.
+func (c *Client) Complete(ctx context.Context, prompt string, stdout, stderr io.Writer, observer Observer) (*storage.Usage, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	out, err := c.send(ctx, []chatMessage{{Role: "user", Content: prompt}}, nil, stdout, stderr, observer)
+	var usage *storage.Usage
+	if out != nil {
+		usage = out.usage
+	}
+	if err != nil {
+		return usage, err
+	}
+	if observer != nil {
+		return usage, observer.Finish(stdout)
+	}
+	return usage, nil
+}
+
+// send posts one chat-completions request and decodes the assistant turn.
+func (c *Client) send(ctx context.Context, messages []chatMessage, tools []toolSpec, stdout, stderr io.Writer, observer Observer) (*reply, error) {
+	req := chatCompletionRequest{
+		Model:    c.cfg.Model,
+		Messages: messages,
+		Stream:   true,
+		Tools:    tools,
+	}
+	if !c.cfg.OmitStreamOptions {
+		req.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode request")
+	}
+	return c.executeWithRetry(ctx, payload, stdout, stderr, observer)
+}
+
+func (c *Client) executeWithRetry(ctx context.Context, payload []byte, stdout, stderr io.Writer, observer Observer) (*reply, error) {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	attempts := c.cfg.MaxAttempts
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		reqCtx, cancel := context.WithCancel(ctx)
+		req, err := c.newRequest(reqCtx, payload)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		resp, err := c.cfg.HTTPClient.Do(req)
+		if err != nil {
+			cancel()
+			if ctx.Err() != nil {
+				return nil, errors.Wrap(ctx.Err(), "request canceled")
+			}
+			if attempt < attempts-1 {
+				delay := retryDelay(nil, attempt, rng)
+				c.logRetry(stderr, delay, 0, err)
+				if err := sleepWithContext(ctx, delay); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, errors.Wrap(err, "send request")
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			out, err := c.readResponse(reqCtx, cancel, resp, stdout, observer)
+			cancel()
+			return out, err
+		}
+
+		status := resp.StatusCode
+		bodyText := readErrorBody(resp.Body)
+		cancel()
+
+		retryable := status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+		if retryable && attempt < attempts-1 {
+			delay := retryDelay(resp, attempt, rng)
+			c.logRetry(stderr, delay, status, nil)
+			if err := sleepWithContext(ctx, delay); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if bodyText != "" {
+			return nil, errors.Errorf("%s api error: status %d: %s", c.cfg.Name, status, bodyText)
+		}
+		return nil, errors.Errorf("%s api error: status %d", c.cfg.Name, status)
+	}
+	return nil, errors.Errorf("%s request failed after retries", c.cfg.Name)
+}
+
+func (c *Client) newRequest(ctx context.Context, payload []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "build request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", streamContentTypeHint)
+	req.Header.Set("User-Agent", c.cfg.UserAgent)
+	if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+	for key, value := range c.cfg.Headers {
+		if strings.TrimSpace(key) == "" {
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
+// readResponse decodes a streamed (SSE) reply, or a single JSON body when
+// the server ignored stream=true.
+func (c *Client) readResponse(ctx context.Context, cancel context.CancelFunc, resp *http.Response, stdout io.Writer, observer Observer) (*reply, error) {
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	if strings.Contains(contentType, "json") && !strings.Contains(contentType, streamContentTypeHint) {
+		defer resp.Body.Close()
+		return decodeSingleResponse(resp.Body, stdout, c.cfg.Name, observer)
+	}
+	state := &streamState{
+		name:       c.cfg.Name,
+		cumulative: c.cfg.CumulativeContent,
+		observer:   observer,
+	}
+	err := consumeStream(ctx, cancel, resp.Body, stdout, c.cfg.IdleTimeout, state)
+	return state.reply(), err
+}
+
+func (c *Client) logRetry(stderr io.Writer, delay time.Duration, status int, err error) {
+	logRetry(stderr, c.cfg.Name, delay, status, err)
+}
+
+// DefaultHTTPClient returns a client with connect and header timeouts but no
+// overall deadline, since generations can legitimately stream for minutes.
+func DefaultHTTPClient() *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   defaultDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          defaultMaxIdleConns,
+		IdleConnTimeout:       defaultConnIdle,
+		TLSHandshakeTimeout:   defaultDialTimeout,
+		ResponseHeaderTimeout: defaultHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// ResolveEndpoint turns a base URL into a chat-completions URL. URLs that
+// already end in /chat/completions are kept (including any query such as an
+// Azure api-version); "/v1" bases get "/chat/completions" appended and bare
+// hosts get "/v1/chat/completions".
+func ResolveEndpoint(baseURL string) (string, error) {
+	trimmed := strings.TrimSpace(baseURL)
+	if trimmed == "" {
+		return "", errors.New("base url is empty")
+	}
+	u, err := url.Parse(trimmed)
+	if err != nil {
+		return "", errors.Wrap(err, "parse base url")
+	}
+
+	path := strings.TrimRight(u.Path, "/")
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		return u.String(), nil
+	case strings.HasSuffix(path, "/v1"):
+		u.Path = path + "/chat/completions"
+	default:
+		u.Path = path + "/v1/chat/completions"
+	}
+	return u.String(), nil
+}
+
+func retryDelay(resp *http.Response, attempt int, rng *rand.Rand) time.Duration {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return delay
+		}
+	}
+	backoff := time.Second << attempt
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	if rng == nil {
+		return backoff
+	}
+	jitterMax := backoff / 2
+	if jitterMax <= 0 {
+		return backoff
+	}
+	return backoff + time.Duration(rng.Int63n(int64(jitterMax)))
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(trimmed); err == nil {
+		if seconds <= 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if parsed, err := http.ParseTime(trimmed); err == nil {
+		delta := time.Until(parsed)
+		if delta > 0 {
+			return delta, true
+		}
+	}
+	return 0, false
+}
+
+func sleepWithContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "request canceled")
+	case <-timer.C:
+		return nil
+	}
+}
+
+func logRetry(stderr io.Writer, name string, delay time.Duration, status int, err error) {
+	if stderr == nil {
+		return
+	}
+	if status > 0 {
+		_, _ = fmt.Fprintf(stderr, "%s retry in %s after status %d\n", name, delay, status)
+		return
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s retry in %s after error: %v\n", name, delay, err)
+		return
+	}
+	_, _ = fmt.Fprintf(stderr, "%s retry in %s\n", name, delay)
+}
+
+func readErrorBody(body io.ReadCloser) string {
+	if body == nil {
+		return ""
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, 16*1024))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
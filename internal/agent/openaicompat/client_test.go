@@ -0,0 +1,369 @@
+package openaicompat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func sseResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+	}
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"http://localhost:8000":                      "http://localhost:8000/v1/chat/completions",
+		"http://localhost:11434/v1":                  "http://localhost:11434/v1/chat/completions",
+		"http://localhost:11434/v1/":                 "http://localhost:11434/v1/chat/completions",
+		"https://api.perplexity.ai/chat/completions": "https://api.perplexity.ai/chat/completions",
+		"https://example.openai.azure.com/openai/deployments/gpt/chat/completions?api-version=2024-10-21": "https://example.openai.azure.com/openai/deployments/gpt/chat/completions?api-version=2024-10-21",
+		"http://litellm:4000/proxy": "http://litellm:4000/proxy/v1/chat/completions",
+	}
+	for base, want := range cases {
+		got, err := ResolveEndpoint(base)
+		if err != nil {
+			t.Fatalf("ResolveEndpoint(%q): %v", base, err)
+		}
+		if got != want {
+			t.Fatalf("ResolveEndpoint(%q)=%q, want %q", base, got, want)
+		}
+	}
+	if _, err := ResolveEndpoint("://bad"); err == nil {
+		t.Fatalf("expected error for invalid url")
+	}
+	if _, err := ResolveEndpoint(" "); err == nil {
+		t.Fatalf("expected error for empty url")
+	}
+}
+
+func TestNewClientRequiresEndpoint(t *testing.T) {
+	if _, err := NewClient(ClientConfig{}); err == nil {
+		t.Fatalf("expected error for empty endpoint")
+	}
+}
+
+func TestCompleteSendsHeadersAndBody(t *testing.T) {
+	var gotReq *http.Request
+	var gotBody chatCompletionRequest
+	client, err := NewClient(ClientConfig{
+		APIKey:   "secret",
+		Endpoint: "http://example/v1/chat/completions",
+		Model:    "llama3",
+		Headers:  map[string]string{"X-Team": "infra"},
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			gotReq = r
+			data, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(data, &gotBody)
+			return sseResponse("data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n\n"), nil
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	var stdout bytes.Buffer
+	if _, err := client.Complete(context.Background(), "prompt", &stdout, io.Discard, nil); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if stdout.String() != "ok" {
+		t.Fatalf("unexpected stdout: %q", stdout.String())
+	}
+	if got := gotReq.Header.Get("Authorization"); got != "Bearer secret" {
+		t.Fatalf("unexpected authorization: %q", got)
+	}
+	if got := gotReq.Header.Get("X-Team"); got != "infra" {
+		t.Fatalf("unexpected custom header: %q", got)
+	}
+	if gotBody.Model != "llama3" || !gotBody.Stream || gotBody.StreamOptions == nil || !gotBody.StreamOptions.IncludeUsage {
+		t.Fatalf("unexpected request body: %+v", gotBody)
+	}
+	if len(gotBody.Messages) != 1 || gotBody.Messages[0].Content != "prompt" {
+		t.Fatalf("unexpected messages: %+v", gotBody.Messages)
+	}
+}
+
+func TestCompleteWithoutAPIKeyOrStreamOptions(t *testing.T) {
+	var gotReq *http.Request
+	var raw map[string]json.RawMessage
+	client, err := NewClient(ClientConfig{
+		Endpoint:          "http://example/v1/chat/completions",
+		Headers:           map[string]string{"api-key": "azure-key"},
+		OmitStreamOptions: true,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			gotReq = r
+			data, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(data, &raw)
+			return sseResponse("data: [DONE]\n"), nil
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := client.Complete(context.Background(), "prompt", io.Discard, io.Discard, nil); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if got := gotReq.Header.Get("Authorization"); got != "" {
+		t.Fatalf("expected no authorization header, got %q", got)
+	}
+	if got := gotReq.Header.Get("api-key"); got != "azure-key" {
+		t.Fatalf("unexpected api-key header: %q", got)
+	}
+	if _, ok := raw["stream_options"]; ok {
+		t.Fatalf("expected stream_options to be omitted")
+	}
+}
+
+func TestCompleteNonStreamResponse(t *testing.T) {
+	client, err := NewClient(ClientConfig{
+		Endpoint: "http://example",
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(`{"choices":[{"message":{"content":"hello"}}]}`)),
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+			}, nil
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	var stdout bytes.Buffer
+	if _, err := client.Complete(context.Background(), "prompt", &stdout, io.Discard, nil); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if stdout.String() != "hello" {
+		t.Fatalf("unexpected stdout: %q", stdout.String())
+	}
+}
+
+type recordingObserver struct {
+	chunks   int
+	finished bool
+}
+
+func (o *recordingObserver) ObserveChunk(raw []byte) error {
+	o.chunks++
+	return nil
+}
+
+func (o *recordingObserver) Finish(stdout io.Writer) error {
+	o.finished = true
+	_, err := io.WriteString(stdout, "\n--end")
+	return err
+}
+
+func TestCompleteObserver(t *testing.T) {
+	client, err := NewClient(ClientConfig{
+		Endpoint: "http://example",
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return sseResponse("data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\ndata: {\"choices\":[{\"delta\":{\"content\":\"b\"}}]}\ndata: [DONE]\n"), nil
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	observer := &recordingObserver{}
+	var stdout bytes.Buffer
+	if _, err := client.Complete(context.Background(), "prompt", &stdout, io.Discard, observer); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if observer.chunks != 2 || !observer.finished {
+		t.Fatalf("unexpected observer state: %+v", observer)
+	}
+	if stdout.String() != "ab\n--end" {
+		t.Fatalf("unexpected stdout: %q", stdout.String())
+	}
+}
+
+func TestCompleteStatusError(t *testing.T) {
+	client, err := NewClient(ClientConfig{
+		Name:     "local",
+		Endpoint: "http://example",
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusBadRequest,
+				Body:       io.NopCloser(strings.NewReader("bad request")),
+				Header:     http.Header{},
+			}, nil
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	_, err = client.Complete(context.Background(), "prompt", io.Discard, io.Discard, nil)
+	if err == nil || !strings.Contains(err.Error(), "local api error: status 400: bad request") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCompleteRetriesRetryableStatus(t *testing.T) {
+	calls := 0
+	var stderr bytes.Buffer
+	client, err := NewClient(ClientConfig{
+		Endpoint:    "http://example",
+		MaxAttempts: 3,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			calls++
+			if calls == 1 {
+				return &http.Response{
+					StatusCode: http.StatusTooManyRequests,
+					Body:       io.NopCloser(strings.NewReader("slow down")),
+					Header:     http.Header{"Retry-After": []string{"0"}},
+				}, nil
+			}
+			return sseResponse("data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\ndata: [DONE]\n"), nil
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	// Retry-After: 0 is ignored, so the first backoff is ~1s.
+	start := time.Now()
+	var stdout bytes.Buffer
+	if _, err := client.Complete(context.Background(), "prompt", &stdout, &stderr, nil); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if calls != 2 || stdout.String() != "ok" {
+		t.Fatalf("calls=%d stdout=%q", calls, stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "retry in") {
+		t.Fatalf("expected retry log, got %q", stderr.String())
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("retry took too long")
+	}
+}
+
+func TestCompleteRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client, err := NewClient(ClientConfig{
+		Endpoint:    "http://example",
+		MaxAttempts: DefaultMaxAttempts,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Body:       io.NopCloser(strings.NewReader("retry")),
+				Header:     http.Header{"Retry-After": []string{"1"}},
+			}, nil
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := client.Complete(ctx, "prompt", io.Discard, io.Discard, nil); err == nil {
+		t.Fatalf("expected error for canceled retry")
+	}
+}
+
+func TestCompleteRequestError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client, err := NewClient(ClientConfig{
+		Endpoint:    "http://example",
+		MaxAttempts: DefaultMaxAttempts,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return nil, errors.New("network down")
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := client.Complete(ctx, "prompt", io.Discard, io.Discard, nil); err == nil {
+		t.Fatalf("expected request canceled error")
+	}
+	single, err := NewClient(ClientConfig{
+		Endpoint: "http://example",
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return nil, errors.New("network down")
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := single.Complete(context.Background(), "prompt", io.Discard, io.Discard, nil); err == nil {
+		t.Fatalf("expected request error")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("2"); !ok || d != 2*time.Second {
+		t.Fatalf("unexpected retry-after: %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("invalid"); ok {
+		t.Fatalf("expected invalid retry-after")
+	}
+	future := time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(future); !ok || d <= 0 {
+		t.Fatalf("expected http-date retry-after, got %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("-1"); ok {
+		t.Fatalf("expected negative retry-after to be ignored")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"1"}}}
+	if delay := retryDelay(resp, 0, nil); delay != time.Second {
+		t.Fatalf("expected 1s delay, got %v", delay)
+	}
+	rng := rand.New(rand.NewSource(1))
+	if delay := retryDelay(nil, 1, rng); delay <= time.Second {
+		t.Fatalf("expected jittered delay, got %v", delay)
+	}
+	if delay := retryDelay(nil, 10, nil); delay != maxRetryBackoff {
+		t.Fatalf("expected capped delay, got %v", delay)
+	}
+}
+
+func TestSleepWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sleepWithContext(ctx, time.Second); err == nil {
+		t.Fatalf("expected canceled error")
+	}
+	if err := sleepWithContext(context.Background(), 0); err != nil {
+		t.Fatalf("unexpected error for zero delay: %v", err)
+	}
+}
+
+func TestLogRetry(t *testing.T) {
+	var stderr bytes.Buffer
+	logRetry(&stderr, "test", time.Second, http.StatusTooManyRequests, nil)
+	if !strings.Contains(stderr.String(), "test retry in 1s after status 429") {
+		t.Fatalf("expected status log, got %q", stderr.String())
+	}
+	stderr.Reset()
+	logRetry(&stderr, "test", time.Second, 0, errors.New("boom"))
+	if !strings.Contains(stderr.String(), "error: boom") {
+		t.Fatalf("expected error log, got %q", stderr.String())
+	}
+	stderr.Reset()
+	logRetry(&stderr, "test", time.Second, 0, nil)
+	if !strings.Contains(stderr.String(), "retry") {
+		t.Fatalf("expected retry log, got %q", stderr.String())
+	}
+}
+
+func TestReadErrorBody(t *testing.T) {
+	if text := readErrorBody(io.NopCloser(strings.NewReader(" oops "))); text != "oops" {
+		t.Fatalf("unexpected body: %q", text)
+	}
+	if text := readErrorBody(nil); text != "" {
+		t.Fatalf("expected empty text")
+	}
+}
@@ -0,0 +1,28 @@
+package openaicompat
+
+import (
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/agent/tools"
+)
+
+func init() {
+	// Self-hosted servers often run without authentication, so the token is
+	// optional and there is no well-known environment variable.
+	agent.Register(agent.Descriptor{
+		Type:                TypeName,
+		REST:                true,
+		TokenOptional:       true,
+		SupportsTools:       true,
+		RequiresBaseURL:     true,
+		NewTranscriptParser: tools.NewTranscriptParser,
+		NewAgent: func(settings agent.Settings) (agent.Agent, error) {
+			return NewAgent(Config{
+				APIKey:  settings.Token,
+				BaseURL: settings.BaseURL,
+				Model:   settings.Model,
+				Headers: settings.Headers,
+				Tools:   tools.OptionsFrom(settings),
+			})
+		},
+	})
+}
@@ -0,0 +1,367 @@
+package openaicompat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+type chatCompletionRequest struct {
+	Model         string         `json:"model"`
+	Messages      []chatMessage  `json:"messages"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+	Tools         []toolSpec     `json:"tools,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type toolSpec struct {
+	Type     string       `json:"type"`
+	Function functionSpec `json:"function"`
+}
+
+type functionSpec struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// toolCall is a function call requested by the model. Streamed deltas carry
+// fragments keyed by Index that are concatenated into a full call.
+type toolCall struct {
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function functionCall `json:"function"`
+}
+
+type functionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// chatUsage mirrors the OpenAI-compatible usage block.
+type chatUsage struct {
+	PromptTokens        int64 `json:"prompt_tokens"`
+	CompletionTokens    int64 `json:"completion_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"prompt_tokens_details,omitempty"`
+}
+
+func (u *chatUsage) toUsage(model string) *storage.Usage {
+	if u == nil {
+		return nil
+	}
+	usage := &storage.Usage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+		Model:        strings.TrimSpace(model),
+	}
+	if u.PromptTokensDetails != nil {
+		usage.CachedInputTokens = u.PromptTokensDetails.CachedTokens
+	}
+	return usage
+}
+
+// chatCompletionChunk is both a streamed chunk and a non-streamed response;
+// the two share a shape and differ only in delta vs message.
+type chatCompletionChunk struct {
+	Model   string       `json:"model,omitempty"`
+	Choices []chatChoice `json:"choices"`
+	Usage   *chatUsage   `json:"usage,omitempty"`
+	Error   *apiError    `json:"error,omitempty"`
+}
+
+// Content returns the text carried by the first choice.
+func (c chatCompletionChunk) Content() string {
+	if len(c.Choices) == 0 {
+		return ""
+	}
+	choice := c.Choices[0]
+	if choice.Delta.Content != "" {
+		return choice.Delta.Content
+	}
+	if choice.Message.Content != "" {
+		return choice.Message.Content
+	}
+	return choice.Text
+}
+
+type chatChoice struct {
+	Delta        chatDelta   `json:"delta,omitempty"`
+	Message      chatMessage `json:"message,omitempty"`
+	Text         string      `json:"text,omitempty"`
+	FinishReason string      `json:"finish_reason,omitempty"`
+}
+
+type chatDelta struct {
+	Content   string     `json:"content,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	ToolCalls []toolCall `json:"tool_calls,omitempty"`
+}
+
+// reply is one decoded assistant turn.
+type reply struct {
+	content   string
+	toolCalls []toolCall
+	usage     *storage.Usage
+}
+
+type apiError struct {
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+}
+
+type streamState struct {
+	name        string
+	cumulative  bool
+	observer    Observer
+	lastContent string
+	toolCalls   []toolCall
+	usage       *storage.Usage
+}
+
+func (s *streamState) reply() *reply {
+	return &reply{content: s.lastContent, toolCalls: s.toolCalls, usage: s.usage}
+}
+
+// mergeToolCalls folds streamed tool-call fragments into complete calls.
+func (s *streamState) mergeToolCalls(deltas []toolCall) {
+	for _, delta := range deltas {
+		pos := -1
+		if delta.Index != nil {
+			for i := range s.toolCalls {
+				if s.toolCalls[i].Index != nil && *s.toolCalls[i].Index == *delta.Index {
+					pos = i
+					break
+				}
+			}
+		} else if delta.ID == "" && len(s.toolCalls) > 0 {
+			pos = len(s.toolCalls) - 1
+		}
+		if pos < 0 {
+			s.toolCalls = append(s.toolCalls, delta)
+			continue
+		}
+		call := &s.toolCalls[pos]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+}
+
+func consumeStream(ctx context.Context, cancel context.CancelFunc, body io.ReadCloser, stdout io.Writer, idleTimeout time.Duration, state *streamState) error {
+	if body == nil {
+		return errors.New("response body is nil")
+	}
+	defer body.Close()
+
+	activity, idleTriggered := startIdleMonitor(ctx, cancel, idleTimeout)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), defaultMaxLineSize)
+
+	// Chat-completions servers send one JSON document per data line, so each
+	// data line is dispatched on its own; blank separators are optional.
+	for scanner.Scan() {
+		signalActivity(activity)
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		done, err := handleEvent(strings.TrimSpace(line[len("data:"):]), stdout, state)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return streamContextError(ctx, state.name, idleTriggered)
+		}
+		return errors.Wrap(err, "read stream")
+	}
+	if ctx.Err() != nil {
+		return streamContextError(ctx, state.name, idleTriggered)
+	}
+	return nil
+}
+
+func handleEvent(payload string, stdout io.Writer, state *streamState) (bool, error) {
+	if payload == "" {
+		return false, nil
+	}
+	if payload == "[DONE]" {
+		return true, nil
+	}
+
+	var chunk chatCompletionChunk
+	if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+		return false, errors.Wrap(err, "decode stream chunk")
+	}
+	if chunk.Error != nil {
+		message := strings.TrimSpace(chunk.Error.Message)
+		if message == "" {
+			message = state.name + " stream error"
+		}
+		return false, errors.New(message)
+	}
+	if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason == "error" {
+		return false, errors.Errorf("%s stream finished with error", state.name)
+	}
+
+	if err := state.write(stdout, chunk.Content()); err != nil {
+		return false, err
+	}
+	if len(chunk.Choices) > 0 {
+		state.mergeToolCalls(chunk.Choices[0].Delta.ToolCalls)
+		state.mergeToolCalls(chunk.Choices[0].Message.ToolCalls)
+	}
+	// Some servers repeat cumulative usage on every chunk; keep the latest.
+	if usage := chunk.Usage.toUsage(chunk.Model); usage != nil {
+		state.usage = usage
+	}
+	if state.observer != nil {
+		if err := state.observer.ObserveChunk([]byte(payload)); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func (s *streamState) write(stdout io.Writer, content string) error {
+	if stdout == nil {
+		return errors.New("stdout writer is nil")
+	}
+	if content == "" {
+		return nil
+	}
+	if s.cumulative && s.lastContent != "" && strings.HasPrefix(content, s.lastContent) {
+		content = strings.TrimPrefix(content, s.lastContent)
+		if content == "" {
+			return nil
+		}
+	}
+	if _, err := io.WriteString(stdout, content); err != nil {
+		return errors.Wrap(err, "write stream content")
+	}
+	s.lastContent += content
+	return nil
+}
+
+func decodeSingleResponse(reader io.Reader, stdout io.Writer, name string, observer Observer) (*reply, error) {
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "read response")
+	}
+	var resp chatCompletionChunk
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, errors.Wrap(err, "decode response")
+	}
+	if resp.Error != nil {
+		return nil, errors.New(strings.TrimSpace(resp.Error.Message))
+	}
+	out := &reply{usage: resp.Usage.toUsage(resp.Model), content: resp.Content()}
+	if len(resp.Choices) > 0 {
+		out.toolCalls = resp.Choices[0].Message.ToolCalls
+	}
+	if strings.TrimSpace(out.content) == "" {
+		if len(out.toolCalls) > 0 {
+			return out, nil
+		}
+		return out, errors.Errorf("%s response missing content", name)
+	}
+	if _, err := io.WriteString(stdout, out.content); err != nil {
+		return out, errors.Wrap(err, "write response content")
+	}
+	if observer != nil {
+		if err := observer.ObserveChunk(body); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func startIdleMonitor(ctx context.Context, cancel context.CancelFunc, timeout time.Duration) (chan<- struct{}, <-chan struct{}) {
+	if timeout <= 0 {
+		return nil, nil
+	}
+	activity := make(chan struct{}, 1)
+	triggered := make(chan struct{}, 1)
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				select {
+				case triggered <- struct{}{}:
+				default:
+				}
+				cancel()
+				return
+			case <-activity:
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(timeout)
+			}
+		}
+	}()
+	return activity, triggered
+}
+
+func signalActivity(activity chan<- struct{}) {
+	if activity == nil {
+		return
+	}
+	select {
+	case activity <- struct{}{}:
+	default:
+	}
+}
+
+func streamContextError(ctx context.Context, name string, idleTriggered <-chan struct{}) error {
+	if idleTriggered != nil {
+		select {
+		case <-idleTriggered:
+			return errors.Errorf("%s stream idle timeout", name)
+		default:
+		}
+	}
+	if ctx.Err() != nil {
+		return errors.Wrap(ctx.Err(), "stream context canceled")
+	}
+	return errors.New("stream context canceled")
+}
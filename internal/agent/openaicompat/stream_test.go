@@ -0,0 +1,243 @@
+package openaicompat
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleEvent(t *testing.T) {
+	var stdout bytes.Buffer
+	state := &streamState{name: "test"}
+	done, err := handleEvent(`{"choices":[{"delta":{"content":"hi"}}]}`, &stdout, state)
+	if err != nil {
+		t.Fatalf("handleEvent: %v", err)
+	}
+	if done {
+		t.Fatalf("did not expect done")
+	}
+	if stdout.String() != "hi" {
+		t.Fatalf("unexpected stdout: %q", stdout.String())
+	}
+	if done, err := handleEvent("[DONE]", &stdout, state); err != nil || !done {
+		t.Fatalf("expected done marker, got done=%v err=%v", done, err)
+	}
+}
+
+func TestHandleEventUsage(t *testing.T) {
+	state := &streamState{name: "test"}
+	payloads := []string{
+		`{"model":"sonar-pro","choices":[{"delta":{"content":"a"}}],"usage":{"prompt_tokens":10,"completion_tokens":1}}`,
+		`{"model":"sonar-pro","choices":[{"delta":{"content":"b"}}],"usage":{"prompt_tokens":10,"completion_tokens":2}}`,
+		`{"model":"sonar-pro","choices":[{"delta":{"content":"c"}}]}`,
+	}
+	for _, payload := range payloads {
+		if _, err := handleEvent(payload, io.Discard, state); err != nil {
+			t.Fatalf("handleEvent: %v", err)
+		}
+	}
+	if state.usage == nil {
+		t.Fatalf("expected usage")
+	}
+	if state.usage.InputTokens != 10 || state.usage.OutputTokens != 2 || state.usage.Model != "sonar-pro" {
+		t.Fatalf("unexpected usage: %+v", *state.usage)
+	}
+}
+
+func TestHandleEventErrors(t *testing.T) {
+	var stdout bytes.Buffer
+	if _, err := handleEvent("{bad", &stdout, &streamState{}); err == nil {
+		t.Fatalf("expected parse error")
+	}
+	if _, err := handleEvent(`{"error":{"message":""}}`, &stdout, &streamState{}); err == nil {
+		t.Fatalf("expected stream error")
+	}
+	if _, err := handleEvent(`{"error":{"message":"boom"}}`, &stdout, &streamState{}); err == nil || err.Error() != "boom" {
+		t.Fatalf("expected boom error, got %v", err)
+	}
+	if _, err := handleEvent(`{"choices":[{"finish_reason":"error"}]}`, &stdout, &streamState{}); err == nil {
+		t.Fatalf("expected finish_reason error")
+	}
+}
+
+func TestStreamStateCumulativeContent(t *testing.T) {
+	if err := (&streamState{}).write(nil, "hi"); err == nil {
+		t.Fatalf("expected error for nil stdout")
+	}
+	var stdout bytes.Buffer
+	state := &streamState{cumulative: true, lastContent: "hello"}
+	if err := state.write(&stdout, "hello world"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if stdout.String() != " world" {
+		t.Fatalf("unexpected content: %q", stdout.String())
+	}
+
+	// Without cumulative mode, repeated deltas are real output.
+	stdout.Reset()
+	state = &streamState{}
+	for _, delta := range []string{"a", "a"} {
+		if err := state.write(&stdout, delta); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if stdout.String() != "aa" {
+		t.Fatalf("unexpected delta content: %q", stdout.String())
+	}
+}
+
+func TestConsumeStream(t *testing.T) {
+	data := "data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\n" +
+		": keep-alive\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n" +
+		"data: [DONE]\n\n"
+	var stdout bytes.Buffer
+	err := consumeStream(context.Background(), func() {}, io.NopCloser(strings.NewReader(data)), &stdout, 0, &streamState{})
+	if err != nil {
+		t.Fatalf("consumeStream: %v", err)
+	}
+	if stdout.String() != "hello world" {
+		t.Fatalf("unexpected stdout: %q", stdout.String())
+	}
+}
+
+func TestConsumeStreamUsage(t *testing.T) {
+	data := "data: {\"model\":\"grok-4\",\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n" +
+		"data: {\"model\":\"grok-4\",\"choices\":[],\"usage\":{\"prompt_tokens\":120,\"completion_tokens\":30,\"prompt_tokens_details\":{\"cached_tokens\":100}}}\n" +
+		"data: [DONE]\n"
+	state := &streamState{}
+	if err := consumeStream(context.Background(), func() {}, io.NopCloser(strings.NewReader(data)), io.Discard, 0, state); err != nil {
+		t.Fatalf("consumeStream: %v", err)
+	}
+	usage := state.usage
+	if usage == nil {
+		t.Fatalf("expected usage")
+	}
+	if usage.InputTokens != 120 || usage.OutputTokens != 30 || usage.CachedInputTokens != 100 || usage.Model != "grok-4" {
+		t.Fatalf("unexpected usage: %+v", *usage)
+	}
+}
+
+func TestConsumeStreamNilBody(t *testing.T) {
+	if err := consumeStream(context.Background(), func() {}, nil, io.Discard, 0, &streamState{}); err == nil {
+		t.Fatalf("expected error for nil body")
+	}
+}
+
+func TestConsumeStreamScannerError(t *testing.T) {
+	longLine := "data: " + strings.Repeat("a", defaultMaxLineSize+10) + "\n\n"
+	err := consumeStream(context.Background(), func() {}, io.NopCloser(strings.NewReader(longLine)), io.Discard, 0, &streamState{})
+	if err == nil {
+		t.Fatalf("expected scanner error")
+	}
+}
+
+func TestDecodeSingleResponse(t *testing.T) {
+	var stdout bytes.Buffer
+	payload := `{"model":"m","choices":[{"message":{"content":"hello"}}],"usage":{"prompt_tokens":3,"completion_tokens":4}}`
+	out, err := decodeSingleResponse(strings.NewReader(payload), &stdout, "test", nil)
+	if err != nil {
+		t.Fatalf("decodeSingleResponse: %v", err)
+	}
+	if stdout.String() != "hello" || out.content != "hello" {
+		t.Fatalf("unexpected stdout: %q", stdout.String())
+	}
+	usage := out.usage
+	if usage == nil || usage.InputTokens != 3 || usage.OutputTokens != 4 || usage.Model != "m" {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	if _, err := decodeSingleResponse(strings.NewReader(`{"choices":[]}`), &stdout, "test", nil); err == nil {
+		t.Fatalf("expected error for missing content")
+	}
+	if _, err := decodeSingleResponse(strings.NewReader(`{"error":{"message":"boom"}}`), &stdout, "test", nil); err == nil {
+		t.Fatalf("expected error for api error")
+	}
+	if _, err := decodeSingleResponse(strings.NewReader("{bad"), &stdout, "test", nil); err == nil {
+		t.Fatalf("expected decode error")
+	}
+}
+
+func TestDecodeSingleResponseToolCalls(t *testing.T) {
+	payload := `{"choices":[{"message":{"content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"list_dir","arguments":"{}"}}]}}]}`
+	out, err := decodeSingleResponse(strings.NewReader(payload), io.Discard, "test", nil)
+	if err != nil {
+		t.Fatalf("decodeSingleResponse: %v", err)
+	}
+	if len(out.toolCalls) != 1 || out.toolCalls[0].Function.Name != "list_dir" {
+		t.Fatalf("unexpected tool calls: %+v", out.toolCalls)
+	}
+}
+
+func TestHandleEventMergesToolCallFragments(t *testing.T) {
+	state := &streamState{name: "test"}
+	payloads := []string{
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"read_file","arguments":""}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"path\":"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_b","function":{"name":"list_dir","arguments":"{}"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"a.txt\"}"}}]}}]}`,
+	}
+	for _, payload := range payloads {
+		if _, err := handleEvent(payload, io.Discard, state); err != nil {
+			t.Fatalf("handleEvent: %v", err)
+		}
+	}
+	calls := state.reply().toolCalls
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %+v", calls)
+	}
+	if calls[0].ID != "call_a" || calls[0].Function.Name != "read_file" || calls[0].Function.Arguments != `{"path":"a.txt"}` {
+		t.Fatalf("unexpected first call: %+v", calls[0])
+	}
+	if calls[1].ID != "call_b" || calls[1].Function.Name != "list_dir" {
+		t.Fatalf("unexpected second call: %+v", calls[1])
+	}
+}
+
+func TestChunkContent(t *testing.T) {
+	chunk := chatCompletionChunk{Choices: []chatChoice{{Delta: chatDelta{Content: "delta"}}}}
+	if chunk.Content() != "delta" {
+		t.Fatalf("unexpected chunk content")
+	}
+	chunk = chatCompletionChunk{Choices: []chatChoice{{Message: chatMessage{Content: "msg"}}}}
+	if chunk.Content() != "msg" {
+		t.Fatalf("unexpected message content")
+	}
+	chunk = chatCompletionChunk{Choices: []chatChoice{{Text: "text"}}}
+	if chunk.Content() != "text" {
+		t.Fatalf("unexpected text content")
+	}
+	if (chatCompletionChunk{}).Content() != "" {
+		t.Fatalf("expected empty content without choices")
+	}
+}
+
+func TestStartIdleMonitor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	activity, triggered := startIdleMonitor(ctx, cancel, 20*time.Millisecond)
+	if activity == nil || triggered == nil {
+		t.Fatalf("expected channels")
+	}
+	select {
+	case <-triggered:
+	case <-time.After(200 * time.Millisecond):
+		t.Fatalf("expected idle trigger")
+	}
+}
+
+func TestStreamContextError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := streamContextError(ctx, "test", nil); err == nil {
+		t.Fatalf("expected context error")
+	}
+	triggered := make(chan struct{}, 1)
+	triggered <- struct{}{}
+	err := streamContextError(context.Background(), "test", triggered)
+	if err == nil || !strings.Contains(err.Error(), "idle timeout") {
+		t.Fatalf("expected idle timeout error, got %v", err)
+	}
+}
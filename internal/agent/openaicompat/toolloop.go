@@ -0,0 +1,138 @@
+package openaicompat
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/tools"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// DefaultMaxToolTurns bounds how many model turns a tool loop may take
+// before it is aborted.
+const DefaultMaxToolTurns = 50
+
+// Toolbox executes the tools offered to the model. *tools.Set implements it.
+type Toolbox interface {
+	Definitions() []tools.Definition
+	Call(ctx context.Context, name, arguments string) (string, error)
+}
+
+// CompleteWithTools runs a function-calling loop: the model's tool calls are
+// executed through toolbox and their results sent back until the model
+// answers without calling a tool. Every call is logged to stdout as a
+// tools.Record line. The returned usage sums all turns.
+func (c *Client) CompleteWithTools(ctx context.Context, prompt string, toolbox Toolbox, maxTurns int, stdout, stderr io.Writer, observer Observer) (*storage.Usage, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if toolbox == nil {
+		return c.Complete(ctx, prompt, stdout, stderr, observer)
+	}
+	if maxTurns <= 0 {
+		maxTurns = DefaultMaxToolTurns
+	}
+	specs := toolSpecs(toolbox.Definitions())
+	messages := []chatMessage{{Role: "user", Content: prompt}}
+
+	var total *storage.Usage
+	for turn := 0; turn < maxTurns; turn++ {
+		out, err := c.send(ctx, messages, specs, stdout, stderr, observer)
+		if out != nil {
+			total = addUsage(total, out.usage)
+		}
+		if err != nil {
+			return total, err
+		}
+		if len(out.toolCalls) == 0 {
+			if observer != nil {
+				return total, observer.Finish(stdout)
+			}
+			return total, nil
+		}
+
+		calls := normalizeToolCalls(out.toolCalls, turn)
+		messages = append(messages, chatMessage{Role: "assistant", Content: out.content, ToolCalls: calls})
+		for _, call := range calls {
+			result := c.runTool(ctx, toolbox, call, stdout)
+			messages = append(messages, chatMessage{Role: "tool", ToolCallID: call.ID, Content: result})
+		}
+		if ctx.Err() != nil {
+			return total, errors.Wrap(ctx.Err(), "tool loop canceled")
+		}
+	}
+	return total, errors.Errorf("%s tool loop exceeded %d turns", c.cfg.Name, maxTurns)
+}
+
+// runTool executes one call and returns the text sent back to the model.
+// Tool failures are reported to the model rather than aborting the run.
+func (c *Client) runTool(ctx context.Context, toolbox Toolbox, call toolCall, stdout io.Writer) string {
+	start := time.Now()
+	output, err := toolbox.Call(ctx, call.Function.Name, call.Function.Arguments)
+	rec := tools.Record{
+		ID:          call.ID,
+		Tool:        call.Function.Name,
+		Arguments:   json.RawMessage(call.Function.Arguments),
+		Status:      "ok",
+		OutputBytes: len(output),
+		DurationMS:  time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		rec.Status = "error"
+		rec.Error = err.Error()
+		output = "error: " + err.Error()
+	}
+	_ = tools.WriteRecord(stdout, rec)
+	return output
+}
+
+func toolSpecs(defs []tools.Definition) []toolSpec {
+	specs := make([]toolSpec, 0, len(defs))
+	for _, def := range defs {
+		specs = append(specs, toolSpec{
+			Type: "function",
+			Function: functionSpec{
+				Name:        def.Name,
+				Description: def.Description,
+				Parameters:  def.Parameters,
+			},
+		})
+	}
+	return specs
+}
+
+// normalizeToolCalls strips stream indexes and fills the fields some servers
+// omit, since the assistant message is replayed on the next request.
+func normalizeToolCalls(calls []toolCall, turn int) []toolCall {
+	out := make([]toolCall, 0, len(calls))
+	for i, call := range calls {
+		call.Index = nil
+		if call.ID == "" {
+			call.ID = "call_" + strconv.Itoa(turn) + "_" + strconv.Itoa(i)
+		}
+		if call.Type == "" {
+			call.Type = "function"
+		}
+		if call.Function.Arguments == "" {
+			call.Function.Arguments = "{}"
+		}
+		out = append(out, call)
+	}
+	return out
+}
+
+func addUsage(total, turn *storage.Usage) *storage.Usage {
+	if turn == nil {
+		return total
+	}
+	if total == nil {
+		total = &storage.Usage{}
+	}
+	total.Add(*turn)
+	return total
+}
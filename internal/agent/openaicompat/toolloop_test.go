@@ -0,0 +1,131 @@
+package openaicompat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/tools"
+)
+
+type fakeToolbox struct {
+	calls []string
+}
+
+func (f *fakeToolbox) Definitions() []tools.Definition {
+	return []tools.Definition{{Name: "list_dir", Description: "list", Parameters: json.RawMessage(`{"type":"object"}`)}}
+}
+
+func (f *fakeToolbox) Call(ctx context.Context, name, arguments string) (string, error) {
+	f.calls = append(f.calls, name+" "+arguments)
+	if name != "list_dir" {
+		return "", errors.New("unknown tool")
+	}
+	return "a.txt\t3\n", nil
+}
+
+func TestCompleteWithTools(t *testing.T) {
+	var requests []chatCompletionRequest
+	client, err := NewClient(ClientConfig{
+		Endpoint: "http://example",
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			var req chatCompletionRequest
+			data, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(data, &req); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+			requests = append(requests, req)
+			if len(requests) == 1 {
+				return sseResponse("data: {\"choices\":[{\"delta\":{\"content\":\"Looking.\",\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":\"list_dir\",\"arguments\":\"{}\"}}]}}]}\n" +
+					"data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":1,\"id\":\"call_2\",\"function\":{\"name\":\"rm_rf\",\"arguments\":\"{}\"}}]}}]}\n" +
+					"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":5}}\n" +
+					"data: [DONE]\n"), nil
+			}
+			return sseResponse("data: {\"choices\":[{\"delta\":{\"content\":\"Found a.txt\"}}]}\n" +
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":30,\"completion_tokens\":3}}\n" +
+				"data: [DONE]\n"), nil
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	toolbox := &fakeToolbox{}
+	var stdout bytes.Buffer
+	usage, err := client.CompleteWithTools(context.Background(), "what files?", toolbox, 0, &stdout, io.Discard, nil)
+	if err != nil {
+		t.Fatalf("CompleteWithTools: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	if len(requests[0].Tools) != 1 || requests[0].Tools[0].Function.Name != "list_dir" || requests[0].Tools[0].Type != "function" {
+		t.Fatalf("unexpected tools: %+v", requests[0].Tools)
+	}
+	second := requests[1].Messages
+	if len(second) != 4 {
+		t.Fatalf("expected user, assistant and two tool messages, got %+v", second)
+	}
+	if second[1].Role != "assistant" || len(second[1].ToolCalls) != 2 || second[1].ToolCalls[0].Index != nil {
+		t.Fatalf("unexpected assistant message: %+v", second[1])
+	}
+	if second[2].Role != "tool" || second[2].ToolCallID != "call_1" || second[2].Content != "a.txt\t3\n" {
+		t.Fatalf("unexpected tool result: %+v", second[2])
+	}
+	if second[3].ToolCallID != "call_2" || !strings.HasPrefix(second[3].Content, "error: unknown tool") {
+		t.Fatalf("unexpected tool error result: %+v", second[3])
+	}
+	if len(toolbox.calls) != 2 || toolbox.calls[0] != "list_dir {}" {
+		t.Fatalf("unexpected tool calls: %v", toolbox.calls)
+	}
+
+	out := stdout.String()
+	if !strings.HasPrefix(out, "Looking.") || !strings.HasSuffix(out, "Found a.txt") {
+		t.Fatalf("unexpected stdout: %q", out)
+	}
+	var records []tools.Record
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "[tool] ") {
+			continue
+		}
+		var rec tools.Record
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "[tool] ")), &rec); err != nil {
+			t.Fatalf("decode record %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 2 || records[0].Tool != "list_dir" || records[0].Status != "ok" || records[1].Status != "error" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if usage == nil || usage.InputTokens != 40 || usage.OutputTokens != 8 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestCompleteWithToolsTurnLimit(t *testing.T) {
+	client, err := NewClient(ClientConfig{
+		Endpoint: "http://example",
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return sseResponse("data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"name\":\"list_dir\"}}]}}]}\ndata: [DONE]\n"), nil
+		})},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	_, err = client.CompleteWithTools(context.Background(), "loop", &fakeToolbox{}, 2, io.Discard, io.Discard, nil)
+	if err == nil || !strings.Contains(err.Error(), "exceeded 2 turns") {
+		t.Fatalf("expected turn limit error, got %v", err)
+	}
+}
+
+func TestNormalizeToolCalls(t *testing.T) {
+	index := 3
+	calls := normalizeToolCalls([]toolCall{{Index: &index, Function: functionCall{Name: "list_dir"}}}, 2)
+	if calls[0].Index != nil || calls[0].ID != "call_2_0" || calls[0].Type != "function" || calls[0].Function.Arguments != "{}" {
+		t.Fatalf("unexpected normalized call: %+v", calls[0])
+	}
+}
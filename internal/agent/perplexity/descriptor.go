@@ -0,0 +1,20 @@
+package perplexity
+
+import (
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+)
+
+func init() {
+	agent.Register(agent.Descriptor{
+		Type:        "perplexity",
+		REST:        true,
+		TokenEnvVar: perplexityTokenEnv,
+		NewAgent: func(settings agent.Settings) (agent.Agent, error) {
+			return NewPerplexityAgent(Options{
+				Token:       settings.Token,
+				Model:       settings.Model,
+				APIEndpoint: settings.BaseURL,
+			}), nil
+		},
+	})
+}
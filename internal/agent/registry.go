@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// Invocation carries the per-run values a CLI command builder may use.
+type Invocation struct {
+	PromptPath string
+	RunDir     string
+	WorkingDir string
+}
+
+// Command is a resolved CLI command line.
+type Command struct {
+	Path string
+	Args []string
+	// PromptOnStdin pipes the prompt file to the process's stdin.
+	PromptOnStdin bool
+}
+
+// Settings is the per-agent configuration handed to REST backend factories.
+type Settings struct {
+	Token   string
+	BaseURL string
+	Model   string
+	Headers map[string]string
+
+	// Tools enables the function-calling tool loop. ConfigPath and
+	// RunAgentPath are passed on to child tasks spawned by the tools.
+	Tools        bool
+	ConfigPath   string
+	RunAgentPath string
+}
+
+// Descriptor tells the runner how to drive one agent type.
+type Descriptor struct {
+	// Type is the agent type name used in config files, e.g. "claude".
+	Type string
+	// REST agents run in-process through NewAgent; all others are CLIs.
+	REST bool
+
+	// TokenEnvVar is the environment variable the agent reads its API key
+	// from. Keys of other agents are stripped from its environment.
+	TokenEnvVar string
+	// ExtraEnvVars are further credentials passed through only to this agent.
+	ExtraEnvVars []string
+	// TokenOptional marks agents that may run without any token.
+	TokenOptional bool
+
+	// SupportsTools marks REST agents that implement the tool loop.
+	SupportsTools bool
+	// RequiresBaseURL marks agents that have no default endpoint.
+	RequiresBaseURL bool
+
+	// Binary is the CLI executable looked up in PATH by validation.
+	Binary string
+	// ProbeVersion runs "<Binary> --version" to record the agent version.
+	ProbeVersion bool
+	// MinVersion is the minimum supported CLI version, e.g. "1.0.0".
+	MinVersion string
+	// ConfigPaths are the CLI's login and settings files and directories,
+	// relative to HOME. Sandboxes that hide HOME bind them read-only.
+	ConfigPaths []string
+
+	// Command builds the CLI command line for a run.
+	Command func(inv Invocation) (Command, error)
+	// WriteOutput extracts output.md from the captured stdout. A returned
+	// error is logged and the generic stdout copy is used instead.
+	WriteOutput func(runDir, stdoutPath string) error
+	// OutputFailure inspects stderr after WriteOutput failed and returns a
+	// non-empty error summary when the run must be marked failed.
+	OutputFailure func(stderrPath string) string
+	// ParseUsage extracts token usage from the captured stdout.
+	ParseUsage func(data []byte) (storage.Usage, bool)
+	// NewTranscriptParser builds the parser that turns stdout into
+	// transcript.jsonl events; nil means transcript.NewTextParser.
+	NewTranscriptParser func() transcript.Parser
+
+	// NewAgent builds the in-process backend of a REST agent.
+	NewAgent func(settings Settings) (Agent, error)
+}
+
+// TokenEnvVars returns the credential variables owned by this agent.
+func (d Descriptor) TokenEnvVars() []string {
+	var vars []string
+	if d.TokenEnvVar != "" {
+		vars = append(vars, d.TokenEnvVar)
+	}
+	return append(vars, d.ExtraEnvVars...)
+}
+
+// Registry maps agent type names to their descriptors.
+type Registry struct {
+	mu          sync.RWMutex
+	descriptors map[string]Descriptor
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{descriptors: make(map[string]Descriptor)}
+}
+
+// Register adds a descriptor. Type names are case-insensitive and must be
+// unique.
+func (r *Registry) Register(d Descriptor) error {
+	name := strings.ToLower(strings.TrimSpace(d.Type))
+	if name == "" {
+		return errors.New("agent type is empty")
+	}
+	if d.REST && d.NewAgent == nil {
+		return errors.Errorf("rest agent %q has no factory", name)
+	}
+	if !d.REST && d.Command == nil {
+		return errors.Errorf("cli agent %q has no command builder", name)
+	}
+	d.Type = name
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.descriptors[name]; exists {
+		return errors.Errorf("agent type %q is already registered", name)
+	}
+	r.descriptors[name] = d
+	return nil
+}
+
+// Lookup returns the descriptor registered for agentType.
+func (r *Registry) Lookup(agentType string) (Descriptor, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	d, ok := r.descriptors[strings.ToLower(strings.TrimSpace(agentType))]
+	return d, ok
+}
+
+// Types returns the registered type names in sorted order.
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.descriptors))
+	for name := range r.descriptors {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// TokenEnvVars returns the credential variables of all registered agents.
+func (r *Registry) TokenEnvVars() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[string]struct{})
+	var vars []string
+	for _, d := range r.descriptors {
+		for _, name := range d.TokenEnvVars() {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			vars = append(vars, name)
+		}
+	}
+	sort.Strings(vars)
+	return vars
+}
+
+var defaultRegistry = NewRegistry()
+
+// Register adds a descriptor to the default registry. Backends call it from
+// init and it panics on invalid or duplicate descriptors.
+func Register(d Descriptor) {
+	if err := defaultRegistry.Register(d); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the descriptor registered for agentType in the default
+// registry.
+func Lookup(agentType string) (Descriptor, bool) {
+	return defaultRegistry.Lookup(agentType)
+}
+
+// Types returns the type names in the default registry.
+func Types() []string {
+	return defaultRegistry.Types()
+}
+
+// TokenEnvVars returns the credential variables of all agents in the
+// default registry.
+func TokenEnvVars() []string {
+	return defaultRegistry.TokenEnvVars()
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func cliDescriptor(agentType, tokenVar string) Descriptor {
+	return Descriptor{
+		Type:        agentType,
+		TokenEnvVar: tokenVar,
+		Binary:      agentType,
+		Command: func(Invocation) (Command, error) {
+			return Command{Path: agentType, PromptOnStdin: true}, nil
+		},
+	}
+}
+
+func TestRegistryRegisterAndLookup(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(cliDescriptor("Alpha", "ALPHA_KEY")); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	beta := cliDescriptor("beta", "BETA_KEY")
+	beta.ExtraEnvVars = []string{"BETA_ORG"}
+	if err := r.Register(beta); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	desc, ok := r.Lookup(" ALPHA ")
+	if !ok || desc.Type != "alpha" {
+		t.Fatalf("expected case-insensitive lookup, got %+v ok=%v", desc, ok)
+	}
+	if _, ok := r.Lookup("gamma"); ok {
+		t.Fatal("expected unknown type to be missing")
+	}
+	if got := strings.Join(r.Types(), ","); got != "alpha,beta" {
+		t.Fatalf("Types() = %q", got)
+	}
+	if got := strings.Join(r.TokenEnvVars(), ","); got != "ALPHA_KEY,BETA_KEY,BETA_ORG" {
+		t.Fatalf("TokenEnvVars() = %q", got)
+	}
+}
+
+func TestRegistryRejectsInvalidDescriptors(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(cliDescriptor("alpha", "")); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	cases := map[string]Descriptor{
+		"empty type": cliDescriptor(" ", ""),
+		"duplicate":  cliDescriptor("ALPHA", ""),
+		"no command": {Type: "cli"},
+		"no factory": {Type: "rest", REST: true},
+	}
+	for name, desc := range cases {
+		if err := r.Register(desc); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestCustomDescriptorStdin(t *testing.T) {
+	desc, err := NewCustomDescriptor(CustomSpec{Command: []string{"opencode", "run", "--cwd", "{cwd}"}})
+	if err != nil {
+		t.Fatalf("NewCustomDescriptor: %v", err)
+	}
+	if desc.Type != CustomType || desc.REST || desc.Binary != "opencode" {
+		t.Fatalf("unexpected descriptor: %+v", desc)
+	}
+	cmd, err := desc.Command(Invocation{PromptPath: "/run/prompt.md", WorkingDir: "/repo"})
+	if err != nil {
+		t.Fatalf("Command: %v", err)
+	}
+	if !cmd.PromptOnStdin || cmd.Path != "opencode" || strings.Join(cmd.Args, " ") != "run --cwd /repo" {
+		t.Fatalf("unexpected command: %+v", cmd)
+	}
+}
+
+func TestCustomDescriptorFileModeAppendsPrompt(t *testing.T) {
+	desc, err := NewCustomDescriptor(CustomSpec{Command: []string{"./review.sh", "--out={run_dir}/review.md"}, PromptMode: "FILE"})
+	if err != nil {
+		t.Fatalf("NewCustomDescriptor: %v", err)
+	}
+	cmd, err := desc.Command(Invocation{PromptPath: "/run/prompt.md", RunDir: "/run"})
+	if err != nil {
+		t.Fatalf("Command: %v", err)
+	}
+	if cmd.PromptOnStdin || strings.Join(cmd.Args, " ") != "--out=/run/review.md /run/prompt.md" {
+		t.Fatalf("unexpected command: %+v", cmd)
+	}
+}
+
+func TestCustomDescriptorValidation(t *testing.T) {
+	if _, err := NewCustomDescriptor(CustomSpec{}); err == nil {
+		t.Fatal("expected error for empty command")
+	}
+	if _, err := NewCustomDescriptor(CustomSpec{Command: []string{"x"}, PromptMode: "pipe"}); err == nil {
+		t.Fatal("expected error for invalid prompt_mode")
+	}
+}
@@ -0,0 +1,259 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+type runCommandArgs struct {
+	Command        string `json:"command"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+func (s *Set) runCommand(ctx context.Context, raw json.RawMessage) (string, error) {
+	var args runCommandArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Command) == "" {
+		return "", errors.New("command is empty")
+	}
+	timeout := s.cmdTimeout
+	if args.TimeoutSeconds > 0 {
+		if requested := time.Duration(args.TimeoutSeconds) * time.Second; requested < timeout {
+			timeout = requested
+		}
+	}
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := shellCommand(cmdCtx, args.Command)
+	cmd.Dir = s.root
+	cmd.Env = envList(s.env)
+	applyProcessGroup(cmd)
+	cmd.WaitDelay = time.Second
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if cmdCtx.Err() == context.DeadlineExceeded {
+		return fmt.Sprintf("command timed out after %s\n%s", timeout, truncate(output.String(), maxOutputBytes)), nil
+	}
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", errors.Wrap(err, "run command")
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	return fmt.Sprintf("exit code %d\n%s", exitCode, truncate(output.String(), maxOutputBytes)), nil
+}
+
+type busPostArgs struct {
+	Type string `json:"type"`
+	Body string `json:"body"`
+}
+
+func (s *Set) busPost(_ context.Context, raw json.RawMessage) (string, error) {
+	var args busPostArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	msgType := strings.ToUpper(strings.TrimSpace(args.Type))
+	if msgType == "" {
+		msgType = "PROGRESS"
+	}
+	if strings.TrimSpace(args.Body) == "" {
+		return "", errors.New("body is empty")
+	}
+	bus, err := messagebus.Open(s.busPath, "")
+	if err != nil {
+		return "", errors.Wrap(err, "open message bus")
+	}
+	defer bus.Close()
+	msgID, err := bus.AppendMessage(&messagebus.Message{
+		Type:      msgType,
+		ProjectID: s.projectID,
+		TaskID:    s.taskID,
+		RunID:     s.runID,
+		Body:      args.Body,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "post message")
+	}
+	return "posted " + msgID, nil
+}
+
+type spawnChildTaskArgs struct {
+	Prompt string `json:"prompt"`
+	Agent  string `json:"agent"`
+	TaskID string `json:"task_id"`
+	Wait   *bool  `json:"wait"`
+}
+
+// spawnChildTask starts "run-agent job" for a new task whose parent is the
+// current run, the same way CLI agents are told to decompose work.
+func (s *Set) spawnChildTask(ctx context.Context, raw json.RawMessage) (string, error) {
+	var args spawnChildTaskArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Prompt) == "" {
+		return "", errors.New("prompt is empty")
+	}
+	if s.projectID == "" || s.runID == "" {
+		return "", errors.New("spawning child tasks requires a project and run id")
+	}
+	taskID := strings.TrimSpace(args.TaskID)
+	if taskID == "" {
+		taskID = storage.GenerateTaskID("")
+	}
+	if err := storage.ValidateTaskID(taskID); err != nil {
+		return "", err
+	}
+	binary, err := s.runAgentBinary()
+	if err != nil {
+		return "", err
+	}
+
+	// The job command infers its scope from JRUN_* variables; point them at
+	// the child task and drop the folders that would pin it to ours.
+	env := make(map[string]string, len(s.env))
+	for key, value := range s.env {
+		env[key] = value
+	}
+	rootDir := ""
+	if taskFolder := strings.TrimSpace(env["JRUN_TASK_FOLDER"]); taskFolder != "" {
+		rootDir = filepath.Dir(filepath.Dir(taskFolder))
+	}
+	delete(env, "JRUN_TASK_FOLDER")
+	delete(env, "JRUN_RUN_FOLDER")
+	env["JRUN_PROJECT_ID"] = s.projectID
+	env["JRUN_TASK_ID"] = taskID
+
+	cmdArgs := []string{"job", "--parent-run-id", s.runID, "--cwd", s.root, "--prompt", args.Prompt}
+	if agentName := strings.TrimSpace(args.Agent); agentName != "" {
+		cmdArgs = append(cmdArgs, "--agent", agentName)
+	}
+	if s.configPath != "" {
+		cmdArgs = append(cmdArgs, "--config", s.configPath)
+	}
+	if rootDir != "" {
+		cmdArgs = append(cmdArgs, "--root", rootDir)
+	}
+	cmd := exec.CommandContext(ctx, binary, cmdArgs...)
+	cmd.Dir = s.root
+	cmd.Env = envList(env)
+
+	if args.Wait != nil && !*args.Wait {
+		if err := cmd.Start(); err != nil {
+			return "", errors.Wrap(err, "start child task")
+		}
+		go func() { _ = cmd.Wait() }()
+		return fmt.Sprintf("started child task %s", taskID), nil
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	runErr := cmd.Run()
+	exitCode := 0
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) {
+			return "", errors.Wrap(runErr, "run child task")
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	result := fmt.Sprintf("child task %s finished with exit code %d\n", taskID, exitCode)
+	if childOutput := latestChildOutput(rootDir, s.projectID, taskID); childOutput != "" {
+		return result + truncate(childOutput, maxOutputBytes), nil
+	}
+	return result + truncate(output.String(), maxOutputBytes), nil
+}
+
+func (s *Set) runAgentBinary() (string, error) {
+	if s.runAgent != "" {
+		return s.runAgent, nil
+	}
+	name := "run-agent"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	for _, dir := range filepath.SplitList(s.env["PATH"]) {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", errors.Wrap(err, "find run-agent binary")
+	}
+	return path, nil
+}
+
+// latestChildOutput returns output.md of the child task's newest run.
+func latestChildOutput(rootDir, projectID, taskID string) string {
+	if rootDir == "" {
+		return ""
+	}
+	runsDir := filepath.Join(rootDir, projectID, taskID, "runs")
+	entries, err := os.ReadDir(runsDir)
+	if err != nil {
+		return ""
+	}
+	var runs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			runs = append(runs, entry.Name())
+		}
+	}
+	if len(runs) == 0 {
+		return ""
+	}
+	sort.Strings(runs)
+	data, err := os.ReadFile(filepath.Join(runsDir, runs[len(runs)-1], "output.md"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+func envList(env map[string]string) []string {
+	if len(env) == 0 {
+		return os.Environ()
+	}
+	list := make([]string, 0, len(env))
+	for key, value := range env {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+)
+
+func TestRunCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	set := newTestSet(t, map[string]string{"PATH": os.Getenv("PATH"), "GREETING": "hi"})
+	got, err := set.Call(context.Background(), RunCommand, `{"command":"echo $GREETING; pwd; exit 3"}`)
+	if err != nil {
+		t.Fatalf("run_command: %v", err)
+	}
+	if !strings.HasPrefix(got, "exit code 3\nhi\n") || !strings.Contains(got, set.Root()) {
+		t.Fatalf("unexpected output: %q", got)
+	}
+	if _, err := set.Call(context.Background(), RunCommand, `{"command":"  "}`); err == nil {
+		t.Fatalf("expected error for empty command")
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	set := newTestSet(t, map[string]string{"PATH": os.Getenv("PATH")})
+	set.cmdTimeout = 100 * time.Millisecond
+	start := time.Now()
+	got, err := set.Call(context.Background(), RunCommand, `{"command":"sleep 5","timeout_seconds":60}`)
+	if err != nil {
+		t.Fatalf("run_command: %v", err)
+	}
+	if !strings.HasPrefix(got, "command timed out after 100ms") {
+		t.Fatalf("unexpected output: %q", got)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatalf("timeout not enforced")
+	}
+}
+
+func TestBusPost(t *testing.T) {
+	busPath := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	set := newTestSet(t, map[string]string{"JRUN_MESSAGE_BUS": busPath})
+	got, err := set.Call(context.Background(), BusPost, `{"type":"fact","body":"tests pass"}`)
+	if err != nil {
+		t.Fatalf("bus_post: %v", err)
+	}
+	if !strings.HasPrefix(got, "posted ") {
+		t.Fatalf("unexpected result: %q", got)
+	}
+	bus, err := messagebus.NewMessageBus(busPath)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	msgs, err := bus.ReadMessages("")
+	if err != nil {
+		t.Fatalf("ReadMessages: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Type != "FACT" || msgs[0].RunID != "run-1" || msgs[0].ProjectID != "proj" || strings.TrimSpace(msgs[0].Body) != "tests pass" {
+		t.Fatalf("unexpected messages: %+v", msgs)
+	}
+	if _, err := set.Call(context.Background(), BusPost, `{"type":"FACT","body":" "}`); err == nil {
+		t.Fatalf("expected error for empty body")
+	}
+}
+
+func TestSpawnChildTask(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	root := t.TempDir()
+	workDir := t.TempDir()
+	binDir := t.TempDir()
+	// The fake run-agent records its arguments and scope, then writes the
+	// child's output.md where the real job command would.
+	script := `#!/bin/sh
+echo "$@" > "` + filepath.Join(binDir, "args") + `"
+echo "$JRUN_TASK_ID $JRUN_TASK_FOLDER" > "` + filepath.Join(binDir, "scope") + `"
+mkdir -p "` + root + `/proj/$JRUN_TASK_ID/runs/run-child"
+echo "child done" > "` + root + `/proj/$JRUN_TASK_ID/runs/run-child/output.md"
+`
+	if err := os.WriteFile(filepath.Join(binDir, "run-agent"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	set, err := NewSet(&agent.RunContext{
+		ProjectID:  "proj",
+		TaskID:     "task-20260101-120000-parent",
+		RunID:      "run-1",
+		WorkingDir: workDir,
+		Environment: map[string]string{
+			"PATH":             binDir + string(os.PathListSeparator) + os.Getenv("PATH"),
+			"JRUN_TASK_FOLDER": filepath.Join(root, "proj", "task-20260101-120000-parent"),
+			"JRUN_RUN_FOLDER":  filepath.Join(root, "proj", "task-20260101-120000-parent", "runs", "run-1"),
+		},
+	}, Options{ConfigPath: "/etc/conductor.yaml"})
+	if err != nil {
+		t.Fatalf("NewSet: %v", err)
+	}
+
+	got, err := set.Call(context.Background(), SpawnChildTask, `{"prompt":"do it","agent":"codex","task_id":"task-20260101-120001-child"}`)
+	if err != nil {
+		t.Fatalf("spawn_child_task: %v", err)
+	}
+	if !strings.Contains(got, "child task task-20260101-120001-child finished with exit code 0") || !strings.Contains(got, "child done") {
+		t.Fatalf("unexpected result: %q", got)
+	}
+	args, _ := os.ReadFile(filepath.Join(binDir, "args"))
+	for _, want := range []string{"job", "--parent-run-id run-1", "--prompt do it", "--agent codex", "--config /etc/conductor.yaml", "--root " + root} {
+		if !strings.Contains(string(args), want) {
+			t.Fatalf("args %q missing %q", args, want)
+		}
+	}
+	scope, _ := os.ReadFile(filepath.Join(binDir, "scope"))
+	if strings.TrimSpace(string(scope)) != "task-20260101-120001-child" {
+		t.Fatalf("unexpected child scope: %q", scope)
+	}
+
+	if _, err := set.Call(context.Background(), SpawnChildTask, `{"prompt":"x","task_id":"../bad"}`); err == nil {
+		t.Fatalf("expected invalid task id error")
+	}
+	if _, err := set.Call(context.Background(), SpawnChildTask, `{"prompt":" "}`); err == nil {
+		t.Fatalf("expected empty prompt error")
+	}
+}
@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type readFileArgs struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+func (s *Set) readFile(_ context.Context, raw json.RawMessage) (string, error) {
+	var args readFileArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	path, err := s.resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "open file")
+	}
+	defer file.Close()
+	if args.Offset > 0 {
+		if _, err := file.Seek(args.Offset, io.SeekStart); err != nil {
+			return "", errors.Wrap(err, "seek file")
+		}
+	}
+	limit := args.Limit
+	if limit <= 0 || limit > maxReadBytes {
+		limit = maxReadBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(file, int64(limit)+1))
+	if err != nil {
+		return "", errors.Wrap(err, "read file")
+	}
+	if len(data) > limit {
+		return fmt.Sprintf("%s\n... [truncated at %d bytes; use offset to read more]", data[:limit], limit), nil
+	}
+	return string(data), nil
+}
+
+type writeFileArgs struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Append  bool   `json:"append"`
+}
+
+func (s *Set) writeFile(_ context.Context, raw json.RawMessage) (string, error) {
+	var args writeFileArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Path) == "" {
+		return "", errors.New("path is empty")
+	}
+	path, err := s.resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	if path == s.root {
+		return "", errors.New("path is the working directory")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", errors.Wrap(err, "create parent directories")
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if args.Append {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return "", errors.Wrap(err, "open file")
+	}
+	if _, err := io.WriteString(file, args.Content); err != nil {
+		file.Close()
+		return "", errors.Wrap(err, "write file")
+	}
+	if err := file.Close(); err != nil {
+		return "", errors.Wrap(err, "close file")
+	}
+	return fmt.Sprintf("wrote %d bytes to %s", len(args.Content), s.relative(path)), nil
+}
+
+type listDirArgs struct {
+	Path string `json:"path"`
+}
+
+func (s *Set) listDir(_ context.Context, raw json.RawMessage) (string, error) {
+	var args listDirArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	path, err := s.resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", errors.Wrap(err, "read directory")
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	var b strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() {
+			fmt.Fprintf(&b, "%s/\n", entry.Name())
+			continue
+		}
+		size := int64(-1)
+		if info, err := entry.Info(); err == nil {
+			size = info.Size()
+		}
+		fmt.Fprintf(&b, "%s\t%d\n", entry.Name(), size)
+	}
+	if b.Len() == 0 {
+		return "(empty directory)", nil
+	}
+	return truncate(b.String(), maxOutputBytes), nil
+}
+
+// resolve maps a model-supplied path onto the working directory and rejects
+// anything that escapes it, including through symlinks.
+func (s *Set) resolve(path string) (string, error) {
+	trimmed := strings.TrimSpace(path)
+	if trimmed == "" {
+		trimmed = "."
+	}
+	target := trimmed
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(s.root, target)
+	}
+	target = filepath.Clean(target)
+	if !within(s.root, target) {
+		return "", errors.Errorf("path %q is outside the working directory", path)
+	}
+	resolved, err := resolveExisting(target)
+	if err != nil {
+		return "", err
+	}
+	if !within(s.root, resolved) {
+		return "", errors.Errorf("path %q is outside the working directory", path)
+	}
+	return target, nil
+}
+
+// resolveExisting evaluates symlinks on the longest existing prefix of path,
+// so paths of files that are about to be created can be checked too.
+func resolveExisting(path string) (string, error) {
+	var rest []string
+	current := path
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			for i := len(rest) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, rest[i])
+			}
+			return resolved, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", errors.Wrap(err, "resolve path")
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return path, nil
+		}
+		rest = append(rest, filepath.Base(current))
+		current = parent
+	}
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+func (s *Set) relative(path string) string {
+	if rel, err := filepath.Rel(s.root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteAndReadFile(t *testing.T) {
+	set := newTestSet(t, nil)
+	ctx := context.Background()
+	if _, err := set.Call(ctx, WriteFile, `{"path":"sub/dir/a.txt","content":"hello"}`); err != nil {
+		t.Fatalf("write_file: %v", err)
+	}
+	if _, err := set.Call(ctx, WriteFile, `{"path":"sub/dir/a.txt","content":" world","append":true}`); err != nil {
+		t.Fatalf("write_file append: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(set.Root(), "sub", "dir", "a.txt"))
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("unexpected file content %q (%v)", data, err)
+	}
+	got, err := set.Call(ctx, ReadFile, `{"path":"sub/dir/a.txt","offset":6,"limit":3}`)
+	if err != nil {
+		t.Fatalf("read_file: %v", err)
+	}
+	if !strings.HasPrefix(got, "wor") || !strings.Contains(got, "truncated") {
+		t.Fatalf("unexpected read: %q", got)
+	}
+	if _, err := set.Call(ctx, ReadFile, `{"path":"missing.txt"}`); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
+
+func TestListDir(t *testing.T) {
+	set := newTestSet(t, nil)
+	ctx := context.Background()
+	if got, err := set.Call(ctx, ListDir, `{}`); err != nil || got != "(empty directory)" {
+		t.Fatalf("unexpected empty listing %q (%v)", got, err)
+	}
+	if err := os.Mkdir(filepath.Join(set.Root(), "pkg"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(set.Root(), "go.mod"), []byte("module x\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err := set.Call(ctx, ListDir, `{"path":"."}`)
+	if err != nil {
+		t.Fatalf("list_dir: %v", err)
+	}
+	if got != "go.mod\t9\npkg/\n" {
+		t.Fatalf("unexpected listing: %q", got)
+	}
+}
+
+func TestPathsConfinedToWorkingDir(t *testing.T) {
+	set := newTestSet(t, nil)
+	ctx := context.Background()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cases := []struct {
+		tool string
+		args string
+	}{
+		{ReadFile, `{"path":"../secret.txt"}`},
+		{ReadFile, `{"path":"` + filepath.ToSlash(filepath.Join(outside, "secret.txt")) + `"}`},
+		{WriteFile, `{"path":"../../escape.txt","content":"x"}`},
+		{ListDir, `{"path":".."}`},
+		{WriteFile, `{"path":".","content":"x"}`},
+	}
+	for _, tc := range cases {
+		if _, err := set.Call(ctx, tc.tool, tc.args); err == nil {
+			t.Fatalf("%s %s: expected confinement error", tc.tool, tc.args)
+		}
+	}
+
+	if err := os.Symlink(outside, filepath.Join(set.Root(), "link")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	if _, err := set.Call(ctx, ReadFile, `{"path":"link/secret.txt"}`); err == nil {
+		t.Fatalf("expected error reading through a symlink that escapes")
+	}
+	if _, err := set.Call(ctx, WriteFile, `{"path":"link/new/file.txt","content":"x"}`); err == nil {
+		t.Fatalf("expected error writing through a symlink that escapes")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be created outside the working directory")
+	}
+}
+
+func TestWithin(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "work")
+	cases := map[string]bool{
+		root:                               true,
+		filepath.Join(root, "a", "b"):      true,
+		filepath.Join(root, "..a"):         true,
+		filepath.Join(root, "..", "other"): false,
+		filepath.Join(string(filepath.Separator), "workspace"): false,
+	}
+	for path, want := range cases {
+		if got := within(root, path); got != want {
+			t.Fatalf("within(%q, %q)=%v, want %v", root, path, got, want)
+		}
+	}
+}
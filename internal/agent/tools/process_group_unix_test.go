@@ -0,0 +1,54 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunCommandTimeoutKillsChildren(t *testing.T) {
+	set := newTestSet(t, map[string]string{"PATH": os.Getenv("PATH")})
+	set.cmdTimeout = 200 * time.Millisecond
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	command := fmt.Sprintf(`{"command":"sleep 30 & echo $! > %s; wait"}`, pidFile)
+	if _, err := set.Call(context.Background(), RunCommand, command); err != nil {
+		t.Fatalf("run_command: %v", err)
+	}
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("read child pid: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("parse child pid: %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("child %d of the timed-out command is still running", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// processAlive reports whether pid runs; a zombie left for init to reap
+// counts as stopped.
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package tools
+
+import "os/exec"
+
+// applyProcessGroup keeps the default cancellation on Windows, which kills
+// only the shell.
+func applyProcessGroup(cmd *exec.Cmd) {}
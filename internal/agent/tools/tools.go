@@ -0,0 +1,271 @@
+// Package tools implements the sandboxed tool set that REST agents call via
+// function calling: file access and shell commands confined to the run's
+// working directory, message bus posts, and child task spawning.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+)
+
+const (
+	// DefaultCommandTimeout bounds a single run_command call.
+	DefaultCommandTimeout = 2 * time.Minute
+
+	maxReadBytes   = 256 * 1024
+	maxOutputBytes = 64 * 1024
+	recordPrefix   = "[tool] "
+)
+
+// Tool names offered to the model.
+const (
+	ReadFile       = "read_file"
+	WriteFile      = "write_file"
+	ListDir        = "list_dir"
+	RunCommand     = "run_command"
+	BusPost        = "bus_post"
+	SpawnChildTask = "spawn_child_task"
+)
+
+// Definition describes a tool in the function-calling schema.
+type Definition struct {
+	Name        string
+	Description string
+	// Parameters is the JSON Schema of the tool arguments.
+	Parameters json.RawMessage
+}
+
+// Options tunes a tool set.
+type Options struct {
+	// ConfigPath is passed to child jobs started by spawn_child_task.
+	ConfigPath string
+	// CommandTimeout bounds run_command; 0 means DefaultCommandTimeout.
+	CommandTimeout time.Duration
+	// RunAgentPath is the run-agent binary used by spawn_child_task; empty
+	// means "run-agent" looked up on the run's PATH.
+	RunAgentPath string
+}
+
+// OptionsFrom returns the tool options requested by REST agent settings, or
+// nil when tools are disabled.
+func OptionsFrom(settings agent.Settings) *Options {
+	if !settings.Tools {
+		return nil
+	}
+	return &Options{ConfigPath: settings.ConfigPath, RunAgentPath: settings.RunAgentPath}
+}
+
+// Set executes tool calls on behalf of a single run.
+type Set struct {
+	root       string
+	env        map[string]string
+	projectID  string
+	taskID     string
+	runID      string
+	busPath    string
+	configPath string
+	runAgent   string
+	cmdTimeout time.Duration
+}
+
+type handler func(s *Set, ctx context.Context, arguments json.RawMessage) (string, error)
+
+var handlers = map[string]handler{
+	ReadFile:       (*Set).readFile,
+	WriteFile:      (*Set).writeFile,
+	ListDir:        (*Set).listDir,
+	RunCommand:     (*Set).runCommand,
+	BusPost:        (*Set).busPost,
+	SpawnChildTask: (*Set).spawnChildTask,
+}
+
+// NewSet builds a tool set confined to runCtx.WorkingDir.
+func NewSet(runCtx *agent.RunContext, opts Options) (*Set, error) {
+	if runCtx == nil {
+		return nil, errors.New("run context is nil")
+	}
+	workingDir := strings.TrimSpace(runCtx.WorkingDir)
+	if workingDir == "" {
+		return nil, errors.New("tools require a working directory")
+	}
+	abs, err := filepath.Abs(workingDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve working directory")
+	}
+	root, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve working directory")
+	}
+	timeout := opts.CommandTimeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	env := runCtx.Environment
+	return &Set{
+		root:       root,
+		env:        env,
+		projectID:  firstNonEmpty(runCtx.ProjectID, env["JRUN_PROJECT_ID"]),
+		taskID:     firstNonEmpty(runCtx.TaskID, env["JRUN_TASK_ID"]),
+		runID:      firstNonEmpty(runCtx.RunID, env["JRUN_ID"]),
+		busPath:    strings.TrimSpace(env["JRUN_MESSAGE_BUS"]),
+		configPath: strings.TrimSpace(opts.ConfigPath),
+		runAgent:   strings.TrimSpace(opts.RunAgentPath),
+		cmdTimeout: timeout,
+	}, nil
+}
+
+// Root returns the directory all file and command tools are confined to.
+func (s *Set) Root() string {
+	return s.root
+}
+
+// Definitions lists the tools in a stable order.
+func (s *Set) Definitions() []Definition {
+	defs := make([]Definition, 0, len(definitions))
+	for _, def := range definitions {
+		if def.Name == BusPost && s.busPath == "" {
+			continue
+		}
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// Call runs the named tool with JSON-encoded arguments and returns the text
+// handed back to the model.
+func (s *Set) Call(ctx context.Context, name, arguments string) (string, error) {
+	h, ok := handlers[name]
+	if !ok {
+		return "", errors.Errorf("unknown tool %q", name)
+	}
+	if name == BusPost && s.busPath == "" {
+		return "", errors.New("message bus is not configured for this run")
+	}
+	raw := json.RawMessage(strings.TrimSpace(arguments))
+	if len(raw) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	if !json.Valid(raw) {
+		return "", errors.New("arguments are not valid JSON")
+	}
+	return h(s, ctx, raw)
+}
+
+// Record is the structured log line written to agent-stdout.txt for every
+// tool call, so transcripts show what the model did between replies.
+type Record struct {
+	ID          string          `json:"id,omitempty"`
+	Tool        string          `json:"tool"`
+	Arguments   json.RawMessage `json:"arguments,omitempty"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	OutputBytes int             `json:"output_bytes"`
+	DurationMS  int64           `json:"duration_ms"`
+}
+
+// WriteRecord writes rec as a single "[tool] {...}" line.
+func WriteRecord(w io.Writer, rec Record) error {
+	if w == nil {
+		return nil
+	}
+	if len(rec.Arguments) > 0 && !json.Valid(rec.Arguments) {
+		quoted, _ := json.Marshal(string(rec.Arguments))
+		rec.Arguments = quoted
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "encode tool record")
+	}
+	if _, err := fmt.Fprintf(w, "\n%s%s\n", recordPrefix, data); err != nil {
+		return errors.Wrap(err, "write tool record")
+	}
+	return nil
+}
+
+func decodeArgs(raw json.RawMessage, dst interface{}) error {
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return errors.Wrap(err, "decode arguments")
+	}
+	return nil
+}
+
+// truncate caps text handed back to the model and notes what was dropped.
+func truncate(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	return fmt.Sprintf("%s\n... [truncated %d bytes]", text[:limit], len(text)-limit)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if trimmed := strings.TrimSpace(value); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
+}
+
+var definitions = []Definition{
+	{
+		Name:        ReadFile,
+		Description: "Read a text file relative to the working directory.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{` +
+			`"path":{"type":"string","description":"File path relative to the working directory."},` +
+			`"offset":{"type":"integer","description":"Byte offset to start reading from."},` +
+			`"limit":{"type":"integer","description":"Maximum number of bytes to read."}},` +
+			`"required":["path"]}`),
+	},
+	{
+		Name:        WriteFile,
+		Description: "Create or overwrite a file relative to the working directory. Parent directories are created.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{` +
+			`"path":{"type":"string","description":"File path relative to the working directory."},` +
+			`"content":{"type":"string","description":"Full file content."},` +
+			`"append":{"type":"boolean","description":"Append instead of overwriting."}},` +
+			`"required":["path","content"]}`),
+	},
+	{
+		Name:        ListDir,
+		Description: "List the entries of a directory relative to the working directory.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{` +
+			`"path":{"type":"string","description":"Directory path relative to the working directory; defaults to the working directory."}}}`),
+	},
+	{
+		Name:        RunCommand,
+		Description: "Run a shell command in the working directory and return its exit code and combined output.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{` +
+			`"command":{"type":"string","description":"Shell command line."},` +
+			`"timeout_seconds":{"type":"integer","description":"Kill the command after this many seconds."}},` +
+			`"required":["command"]}`),
+	},
+	{
+		Name:        BusPost,
+		Description: "Post a message to the task message bus (progress, facts, decisions, errors, questions).",
+		Parameters: json.RawMessage(`{"type":"object","properties":{` +
+			`"type":{"type":"string","enum":["FACT","PROGRESS","DECISION","ERROR","QUESTION","INFO"]},` +
+			`"body":{"type":"string","description":"Message text."}},` +
+			`"required":["type","body"]}`),
+	},
+	{
+		Name:        SpawnChildTask,
+		Description: "Start a child task with its own agent run and return its result.",
+		Parameters: json.RawMessage(`{"type":"object","properties":{` +
+			`"prompt":{"type":"string","description":"Task description for the child agent."},` +
+			`"agent":{"type":"string","description":"Configured agent name; defaults to the config default."},` +
+			`"task_id":{"type":"string","description":"Child task id; generated when empty."},` +
+			`"wait":{"type":"boolean","description":"Wait for the child to finish (default true)."}},` +
+			`"required":["prompt"]}`),
+	},
+}
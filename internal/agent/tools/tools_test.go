@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+)
+
+func newTestSet(t *testing.T, env map[string]string) *Set {
+	t.Helper()
+	set, err := NewSet(&agent.RunContext{
+		ProjectID:   "proj",
+		TaskID:      "task-20260101-120000-parent",
+		RunID:       "run-1",
+		WorkingDir:  t.TempDir(),
+		Environment: env,
+	}, Options{})
+	if err != nil {
+		t.Fatalf("NewSet: %v", err)
+	}
+	return set
+}
+
+func TestNewSetRequiresWorkingDir(t *testing.T) {
+	if _, err := NewSet(nil, Options{}); err == nil {
+		t.Fatalf("expected error for nil run context")
+	}
+	if _, err := NewSet(&agent.RunContext{}, Options{}); err == nil {
+		t.Fatalf("expected error for empty working dir")
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	set := newTestSet(t, map[string]string{"JRUN_MESSAGE_BUS": "/tmp/bus.md"})
+	var names []string
+	for _, def := range set.Definitions() {
+		if !json.Valid(def.Parameters) {
+			t.Fatalf("tool %s has invalid schema", def.Name)
+		}
+		names = append(names, def.Name)
+	}
+	want := "bus_post,list_dir,read_file,run_command,spawn_child_task,write_file"
+	if got := strings.Join(names, ","); got != want {
+		t.Fatalf("definitions=%s, want %s", got, want)
+	}
+
+	// Without a message bus the bus_post tool is not offered.
+	for _, def := range newTestSet(t, nil).Definitions() {
+		if def.Name == BusPost {
+			t.Fatalf("did not expect bus_post without a message bus")
+		}
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	set := newTestSet(t, nil)
+	if _, err := set.Call(context.Background(), "rm_rf", "{}"); err == nil {
+		t.Fatalf("expected unknown tool error")
+	}
+	if _, err := set.Call(context.Background(), ReadFile, "{bad"); err == nil {
+		t.Fatalf("expected invalid JSON error")
+	}
+	if _, err := set.Call(context.Background(), BusPost, `{"type":"FACT","body":"x"}`); err == nil {
+		t.Fatalf("expected bus_post error without a message bus")
+	}
+}
+
+func TestWriteRecord(t *testing.T) {
+	var out bytes.Buffer
+	err := WriteRecord(&out, Record{ID: "call_1", Tool: ReadFile, Arguments: json.RawMessage(`{"path":"a"}`), Status: "ok", OutputBytes: 3})
+	if err != nil {
+		t.Fatalf("WriteRecord: %v", err)
+	}
+	line := strings.TrimSpace(out.String())
+	if !strings.HasPrefix(line, "[tool] ") {
+		t.Fatalf("unexpected record line: %q", line)
+	}
+	var rec Record
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "[tool] ")), &rec); err != nil {
+		t.Fatalf("decode record: %v", err)
+	}
+	if rec.Tool != ReadFile || string(rec.Arguments) != `{"path":"a"}` || rec.OutputBytes != 3 {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+
+	// Malformed model arguments are kept as a JSON string.
+	out.Reset()
+	if err := WriteRecord(&out, Record{Tool: ReadFile, Arguments: json.RawMessage(`{bad`), Status: "error"}); err != nil {
+		t.Fatalf("WriteRecord: %v", err)
+	}
+	if !strings.Contains(out.String(), `"arguments":"{bad"`) {
+		t.Fatalf("expected quoted arguments, got %q", out.String())
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("abc", 5); got != "abc" {
+		t.Fatalf("unexpected text: %q", got)
+	}
+	if got := truncate("abcdef", 3); !strings.HasPrefix(got, "abc\n") || !strings.Contains(got, "truncated 3 bytes") {
+		t.Fatalf("unexpected truncated text: %q", got)
+	}
+}
@@ -0,0 +1,52 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+)
+
+// transcriptParser turns the stdout of tool-calling REST agents into
+// transcript events: "[tool] {...}" records become tool_call/tool_result
+// pairs and everything else is plain assistant text.
+type transcriptParser struct {
+	text transcript.Parser
+}
+
+// NewTranscriptParser returns a parser for REST agent stdout containing
+// tool records written by WriteRecord.
+func NewTranscriptParser() transcript.Parser {
+	return &transcriptParser{text: transcript.NewTextParser()}
+}
+
+// ParseLine implements transcript.Parser.
+func (p *transcriptParser) ParseLine(line []byte) []transcript.Event {
+	if !bytes.HasPrefix(line, []byte(recordPrefix)) {
+		return p.text.ParseLine(line)
+	}
+	var rec Record
+	if err := json.Unmarshal(line[len(recordPrefix):], &rec); err != nil || rec.Tool == "" {
+		return p.text.ParseLine(line)
+	}
+	result := transcript.Event{
+		Type:   transcript.TypeToolResult,
+		Tool:   rec.Tool,
+		CallID: rec.ID,
+		Text:   fmt.Sprintf("%s (%d bytes, %dms)", rec.Status, rec.OutputBytes, rec.DurationMS),
+	}
+	if rec.Status != "ok" {
+		result.IsError = true
+		result.Text = rec.Error
+	}
+	return append(p.text.Flush(),
+		transcript.Event{Type: transcript.TypeToolCall, Tool: rec.Tool, CallID: rec.ID, Input: rec.Arguments},
+		result,
+	)
+}
+
+// Flush implements transcript.Parser.
+func (p *transcriptParser) Flush() []transcript.Event {
+	return p.text.Flush()
+}
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+)
+
+func TestTranscriptParser(t *testing.T) {
+	var stdout bytes.Buffer
+	stdout.WriteString("Reading the file.\n")
+	if err := WriteRecord(&stdout, Record{ID: "call_1", Tool: ReadFile, Arguments: json.RawMessage(`{"path":"a.txt"}`), Status: "ok", OutputBytes: 5, DurationMS: 2}); err != nil {
+		t.Fatalf("WriteRecord: %v", err)
+	}
+	if err := WriteRecord(&stdout, Record{ID: "call_2", Tool: RunCommand, Arguments: json.RawMessage(`{"command":"x"}`), Status: "error", Error: "exit status 1"}); err != nil {
+		t.Fatalf("WriteRecord: %v", err)
+	}
+	stdout.WriteString("Done.\n")
+
+	events := transcript.Parse(stdout.Bytes(), NewTranscriptParser())
+	wantTypes := []string{
+		transcript.TypeAssistantText,
+		transcript.TypeToolCall,
+		transcript.TypeToolResult,
+		transcript.TypeToolCall,
+		transcript.TypeToolResult,
+		transcript.TypeAssistantText,
+	}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("expected %d events, got %+v", len(wantTypes), events)
+	}
+	for i, want := range wantTypes {
+		if events[i].Type != want {
+			t.Fatalf("event %d type = %q, want %q", i, events[i].Type, want)
+		}
+	}
+	if events[1].Tool != ReadFile || events[1].CallID != "call_1" || string(events[1].Input) != `{"path":"a.txt"}` {
+		t.Fatalf("unexpected tool call: %+v", events[1])
+	}
+	if events[2].IsError || events[2].Text != "ok (5 bytes, 2ms)" {
+		t.Fatalf("unexpected tool result: %+v", events[2])
+	}
+	if !events[4].IsError || events[4].Text != "exit status 1" {
+		t.Fatalf("unexpected failed tool result: %+v", events[4])
+	}
+	if events[5].Text != "Done." {
+		t.Fatalf("unexpected final text: %q", events[5].Text)
+	}
+}
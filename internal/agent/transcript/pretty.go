@@ -0,0 +1,76 @@
+package transcript
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxPrettyInputBytes caps tool arguments shown by WritePretty.
+const maxPrettyInputBytes = 400
+
+// WritePretty renders events as human-readable text, one block per event.
+func WritePretty(w io.Writer, events []Event) error {
+	for _, event := range events {
+		if _, err := io.WriteString(w, FormatPretty(event)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatPretty renders a single event without a trailing newline.
+func FormatPretty(event Event) string {
+	switch event.Type {
+	case TypeAssistantText:
+		return "[assistant] " + event.Text
+	case TypeThinking:
+		return "[thinking] " + event.Text
+	case TypeToolCall:
+		line := "[tool_call] " + event.Tool
+		if input := strings.TrimSpace(string(event.Input)); input != "" {
+			if len(input) > maxPrettyInputBytes {
+				input = input[:maxPrettyInputBytes] + "..."
+			}
+			line += " " + input
+		}
+		return line
+	case TypeToolResult:
+		label := "[tool_result]"
+		if event.IsError {
+			label = "[tool_result error]"
+		}
+		line := strings.TrimSpace(label + " " + event.Tool)
+		if text := strings.TrimSpace(event.Text); text != "" {
+			line += "\n" + indent(text)
+		}
+		return line
+	case TypeUsage:
+		if event.Usage == nil {
+			return "[usage]"
+		}
+		line := fmt.Sprintf("[usage] input=%d output=%d", event.Usage.InputTokens, event.Usage.OutputTokens)
+		if event.Usage.CachedInputTokens > 0 {
+			line += fmt.Sprintf(" cached=%d", event.Usage.CachedInputTokens)
+		}
+		if event.Usage.CostUSD > 0 {
+			line += fmt.Sprintf(" cost=$%.4f", event.Usage.CostUSD)
+		}
+		if event.Usage.Model != "" {
+			line += " model=" + event.Usage.Model
+		}
+		return line
+	case TypeError:
+		return "[error] " + event.Text
+	default:
+		return "[" + event.Type + "] " + event.Text
+	}
+}
+
+func indent(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = "    " + line
+	}
+	return strings.Join(lines, "\n")
+}
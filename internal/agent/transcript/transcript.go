@@ -0,0 +1,199 @@
+// Package transcript defines the normalized per-run transcript: a JSON Lines
+// file of events that every agent backend produces from its own stdout
+// format, so consumers no longer need per-agent parsing.
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// FileName is the transcript file written into every run directory.
+const FileName = "transcript.jsonl"
+
+// Event types.
+const (
+	TypeAssistantText = "assistant_text"
+	TypeThinking      = "thinking"
+	TypeToolCall      = "tool_call"
+	TypeToolResult    = "tool_result"
+	TypeUsage         = "usage"
+	TypeError         = "error"
+)
+
+// maxLineBytes bounds a single stdout line handed to a parser and a single
+// transcript line read back.
+const maxLineBytes = 4 * 1024 * 1024
+
+// Event is one transcript entry.
+type Event struct {
+	// Seq numbers events from 1 in file order.
+	Seq  int64     `json:"seq"`
+	Time time.Time `json:"ts"`
+	Type string    `json:"type"`
+	// Text carries assistant text, thinking, tool output and error messages.
+	Text string `json:"text,omitempty"`
+	// Tool and CallID identify a tool_call and link its tool_result.
+	Tool   string `json:"tool,omitempty"`
+	CallID string `json:"call_id,omitempty"`
+	// Input is the JSON-encoded tool arguments of a tool_call.
+	Input   json.RawMessage `json:"input,omitempty"`
+	IsError bool            `json:"is_error,omitempty"`
+	Usage   *storage.Usage  `json:"usage,omitempty"`
+}
+
+// Parser converts agent stdout into events one line at a time, so the
+// transcript can be built while the agent is still running.
+type Parser interface {
+	// ParseLine handles one stdout line without its trailing newline.
+	ParseLine(line []byte) []Event
+	// Flush returns events still buffered at the end of the output.
+	Flush() []Event
+}
+
+// Parse runs p over complete stdout data.
+func Parse(data []byte, p Parser) []Event {
+	var events []Event
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		events = append(events, p.ParseLine(scanner.Bytes())...)
+	}
+	return append(events, p.Flush()...)
+}
+
+// TextParser turns plain text output into assistant_text events, one per
+// blank-line separated paragraph. It is the default for agents without
+// structured output.
+type TextParser struct {
+	lines []string
+}
+
+// NewTextParser returns a parser for plain text stdout.
+func NewTextParser() Parser {
+	return &TextParser{}
+}
+
+// ParseLine implements Parser.
+func (p *TextParser) ParseLine(line []byte) []Event {
+	text := strings.TrimRight(string(line), "\r")
+	if strings.TrimSpace(text) == "" {
+		return p.Flush()
+	}
+	p.lines = append(p.lines, text)
+	return nil
+}
+
+// Flush implements Parser.
+func (p *TextParser) Flush() []Event {
+	if len(p.lines) == 0 {
+		return nil
+	}
+	text := strings.Join(p.lines, "\n")
+	p.lines = nil
+	return []Event{{Type: TypeAssistantText, Text: text}}
+}
+
+// Writer appends events to a transcript file, assigning sequence numbers
+// and timestamps.
+type Writer struct {
+	mu   sync.Mutex
+	file *os.File
+	seq  int64
+}
+
+// Create truncates or creates the transcript at path.
+func Create(path string) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, errors.Wrap(err, "create transcript")
+	}
+	return &Writer{file: file}, nil
+}
+
+// Write appends events in order.
+func (w *Writer) Write(events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var buf bytes.Buffer
+	now := time.Now().UTC()
+	for _, event := range events {
+		w.seq++
+		event.Seq = w.seq
+		if event.Time.IsZero() {
+			event.Time = now
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return errors.Wrap(err, "encode transcript event")
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return errors.Wrap(err, "write transcript")
+	}
+	return nil
+}
+
+// Close closes the underlying file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.file.Close(); err != nil {
+		return errors.Wrap(err, "close transcript")
+	}
+	return nil
+}
+
+// Decode reads events from r, skipping lines that are not valid events.
+func Decode(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		if event, ok := DecodeLine(scanner.Bytes()); ok {
+			events = append(events, event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return events, errors.Wrap(err, "read transcript")
+	}
+	return events, nil
+}
+
+// DecodeLine parses a single transcript line.
+func DecodeLine(line []byte) (Event, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return Event{}, false
+	}
+	var event Event
+	if err := json.Unmarshal(line, &event); err != nil || event.Type == "" {
+		return Event{}, false
+	}
+	return event, true
+}
+
+// Read loads the transcript at path.
+func Read(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open transcript")
+	}
+	defer file.Close()
+	return Decode(file)
+}
@@ -0,0 +1,97 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+func TestTextParserSplitsParagraphs(t *testing.T) {
+	events := Parse([]byte("first line\nsecond line\n\nthird\r\n"), NewTextParser())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if events[0].Type != TypeAssistantText || events[0].Text != "first line\nsecond line" {
+		t.Fatalf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Text != "third" {
+		t.Fatalf("unexpected second event: %+v", events[1])
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	w, err := Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := w.Write(
+		Event{Type: TypeToolCall, Tool: "read_file", CallID: "c1", Input: json.RawMessage(`{"path":"a.go"}`)},
+		Event{Type: TypeToolResult, Tool: "read_file", CallID: "c1", Text: "package a"},
+	); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Write(Event{Type: TypeUsage, Usage: &storage.Usage{InputTokens: 10, OutputTokens: 2}}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	events, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.Seq != int64(i+1) {
+			t.Fatalf("event %d seq = %d", i, event.Seq)
+		}
+		if event.Time.IsZero() {
+			t.Fatalf("event %d has no timestamp", i)
+		}
+	}
+	if string(events[0].Input) != `{"path":"a.go"}` {
+		t.Fatalf("input = %s", events[0].Input)
+	}
+	if events[2].Usage == nil || events[2].Usage.InputTokens != 10 {
+		t.Fatalf("usage = %+v", events[2].Usage)
+	}
+}
+
+func TestDecodeSkipsInvalidLines(t *testing.T) {
+	input := "not json\n{\"seq\":1,\"type\":\"error\",\"text\":\"boom\"}\n{\"seq\":2}\n"
+	events, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(events) != 1 || events[0].Text != "boom" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestWritePretty(t *testing.T) {
+	var buf bytes.Buffer
+	err := WritePretty(&buf, []Event{
+		{Type: TypeAssistantText, Text: "hello"},
+		{Type: TypeToolCall, Tool: "run_command", Input: json.RawMessage(`{"command":"ls"}`)},
+		{Type: TypeToolResult, Tool: "run_command", Text: "a\nb", IsError: true},
+		{Type: TypeUsage, Usage: &storage.Usage{InputTokens: 3, OutputTokens: 4, CostUSD: 0.5}},
+	})
+	if err != nil {
+		t.Fatalf("WritePretty: %v", err)
+	}
+	want := "[assistant] hello\n" +
+		"[tool_call] run_command {\"command\":\"ls\"}\n" +
+		"[tool_result error] run_command\n    a\n    b\n" +
+		"[usage] input=3 output=4 cost=$0.5000\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,24 @@
+package xai
+
+import (
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/agent/tools"
+)
+
+func init() {
+	agent.Register(agent.Descriptor{
+		Type:                TypeName,
+		REST:                true,
+		TokenEnvVar:         envAPIKey,
+		SupportsTools:       true,
+		NewTranscriptParser: tools.NewTranscriptParser,
+		NewAgent: func(settings agent.Settings) (agent.Agent, error) {
+			return NewAgent(Config{
+				APIKey:  settings.Token,
+				BaseURL: settings.BaseURL,
+				Model:   settings.Model,
+				Tools:   tools.OptionsFrom(settings),
+			})
+		},
+	})
+}
@@ -1,22 +1,20 @@
-// Package xai implements the xAI REST backend adapter.
+// Package xai implements the xAI REST backend adapter on top of the shared
+// OpenAI-compatible client.
 package xai
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"io"
-	"net"
 	"net/http"
-	"net/url"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/agent/openaicompat"
+	"github.com/jonnyzzz/conductor-loop/internal/agent/tools"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
 )
 
 const (
@@ -36,15 +34,7 @@ const (
 	envModel       = "XAI_MODEL"
 )
 
-const (
-	defaultDialTimeout    = 10 * time.Second
-	defaultHeaderTimeout  = 60 * time.Second
-	defaultIdleTimeout    = 90 * time.Second
-	defaultMaxIdleConns   = 100
-	defaultMaxLineSize    = 1024 * 1024
-	defaultUserAgent      = "conductor-loop/xai"
-	streamContentTypeHint = "text/event-stream"
-)
+const defaultUserAgent = "conductor-loop/xai"
 
 // Config configures the xAI agent backend.
 type Config struct {
@@ -53,6 +43,8 @@ type Config struct {
 	Model      string
 	HTTPClient *http.Client
 	UserAgent  string
+	// Tools enables the function-calling tool loop when non-nil.
+	Tools *tools.Options
 }
 
 // Agent implements the xAI REST backend.
@@ -62,6 +54,10 @@ type Agent struct {
 	model      string
 	userAgent  string
 	httpClient *http.Client
+	tools      *tools.Options
+
+	usage    storage.Usage
+	hasUsage bool
 }
 
 // NewAgent builds an xAI agent backend from explicit configuration.
@@ -83,7 +79,7 @@ func NewAgent(cfg Config) (*Agent, error) {
 
 	client := cfg.HTTPClient
 	if client == nil {
-		client = defaultHTTPClient()
+		client = openaicompat.DefaultHTTPClient()
 	}
 
 	return &Agent{
@@ -92,6 +88,7 @@ func NewAgent(cfg Config) (*Agent, error) {
 		model:      model,
 		userAgent:  userAgent,
 		httpClient: client,
+		tools:      cfg.Tools,
 	}, nil
 }
 
@@ -135,11 +132,20 @@ func (a *Agent) Execute(ctx context.Context, runCtx *agent.RunContext) error {
 		return err
 	}
 
-	if err := resolved.streamCompletion(ctx, prompt, capture.Stdout); err != nil {
-		return err
+	a.usage, a.hasUsage = storage.Usage{}, false
+	usage, err := resolved.streamCompletion(ctx, runCtx, a.tools, capture.Stdout)
+	if usage != nil {
+		if usage.Model == "" {
+			usage.Model = resolved.model
+		}
+		a.usage, a.hasUsage = *usage, true
 	}
+	return err
+}
 
-	return nil
+// Usage returns the token usage reported by the most recent Execute call.
+func (a *Agent) Usage() (storage.Usage, bool) {
+	return a.usage, a.hasUsage
 }
 
 type resolvedConfig struct {
@@ -178,7 +184,7 @@ func (a *Agent) resolveConfig(env map[string]string) (*resolvedConfig, error) {
 
 	client := a.httpClient
 	if client == nil {
-		client = defaultHTTPClient()
+		client = openaicompat.DefaultHTTPClient()
 	}
 
 	userAgent := a.userAgent
@@ -195,96 +201,26 @@ func (a *Agent) resolveConfig(env map[string]string) (*resolvedConfig, error) {
 	}, nil
 }
 
-func (c *resolvedConfig) streamCompletion(ctx context.Context, prompt string, stdout io.Writer) error {
-	reqBody := chatCompletionRequest{
-		Model: c.model,
-		Messages: []chatMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
-		Stream: true,
-	}
-
-	payload, err := json.Marshal(reqBody)
-	if err != nil {
-		return errors.Wrap(err, "encode request")
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(payload))
-	if err != nil {
-		return errors.Wrap(err, "build request")
-	}
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", streamContentTypeHint)
-	req.Header.Set("User-Agent", c.userAgent)
-
-	resp, err := c.httpClient.Do(req)
+func (c *resolvedConfig) streamCompletion(ctx context.Context, runCtx *agent.RunContext, toolOpts *tools.Options, stdout io.Writer) (*storage.Usage, error) {
+	client, err := openaicompat.NewClient(openaicompat.ClientConfig{
+		Name:       TypeName,
+		APIKey:     c.apiKey,
+		Endpoint:   c.endpoint,
+		Model:      c.model,
+		HTTPClient: c.httpClient,
+		UserAgent:  c.userAgent,
+	})
 	if err != nil {
-		return errors.Wrap(err, "send request")
-	}
-	defer func() {
-		_ = resp.Body.Close()
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 16*1024))
-		return errors.Errorf("xai request failed: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
-	}
-
-	if strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), streamContentTypeHint) {
-		return streamResponse(resp.Body, stdout)
-	}
-
-	return decodeSingleResponse(resp.Body, stdout)
-}
-
-func defaultHTTPClient() *http.Client {
-	transport := &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   defaultDialTimeout,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
-		ForceAttemptHTTP2:     true,
-		MaxIdleConns:          defaultMaxIdleConns,
-		IdleConnTimeout:       defaultIdleTimeout,
-		TLSHandshakeTimeout:   defaultDialTimeout,
-		ResponseHeaderTimeout: defaultHeaderTimeout,
-		ExpectContinueTimeout: 1 * time.Second,
-	}
-
-	return &http.Client{
-		Transport: transport,
+		return nil, err
 	}
+	return openaicompat.Run(ctx, client, runCtx, toolOpts, stdout, nil, nil)
 }
 
 func resolveEndpoint(baseURL string) (string, error) {
-	trimmed := strings.TrimSpace(baseURL)
-	if trimmed == "" {
-		trimmed = DefaultBaseURL
-	}
-	u, err := url.Parse(trimmed)
-	if err != nil {
-		return "", errors.Wrap(err, "parse base url")
-	}
-
-	path := strings.TrimRight(u.Path, "/")
-	switch {
-	case strings.HasSuffix(path, "/v1/chat/completions"):
-		return u.String(), nil
-	case strings.HasSuffix(path, "/v1"):
-		u.Path = path + "/chat/completions"
-	default:
-		if path == "" {
-			u.Path = "/v1/chat/completions"
-		} else {
-			u.Path = path + "/v1/chat/completions"
-		}
+	if strings.TrimSpace(baseURL) == "" {
+		baseURL = DefaultBaseURL
 	}
-	return u.String(), nil
+	return openaicompat.ResolveEndpoint(baseURL)
 }
 
 func lookupEnv(env map[string]string, keys ...string) string {
@@ -304,145 +240,3 @@ func lookupEnv(env map[string]string, keys ...string) string {
 	}
 	return ""
 }
-
-func streamResponse(reader io.Reader, stdout io.Writer) error {
-	scanner := bufio.NewScanner(reader)
-	scanner.Buffer(make([]byte, 0, 64*1024), defaultMaxLineSize)
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-		if strings.HasPrefix(line, ":") {
-			continue
-		}
-		if !strings.HasPrefix(line, "data:") {
-			continue
-		}
-		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
-		if payload == "" {
-			continue
-		}
-		if payload == "[DONE]" {
-			return nil
-		}
-		if err := writeChunk(payload, stdout); err != nil {
-			return err
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return errors.Wrap(err, "read stream")
-	}
-	return nil
-}
-
-func writeChunk(payload string, stdout io.Writer) error {
-	var chunk chatCompletionChunk
-	if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
-		return errors.Wrap(err, "decode stream chunk")
-	}
-	if chunk.Error != nil {
-		return errors.New(strings.TrimSpace(chunk.Error.Message))
-	}
-	content := chunk.Content()
-	if content == "" {
-		return nil
-	}
-	if _, err := io.WriteString(stdout, content); err != nil {
-		return errors.Wrap(err, "write stream content")
-	}
-	return nil
-}
-
-func decodeSingleResponse(reader io.Reader, stdout io.Writer) error {
-	body, err := io.ReadAll(reader)
-	if err != nil {
-		return errors.Wrap(err, "read response")
-	}
-	var resp chatCompletionResponse
-	if err := json.Unmarshal(body, &resp); err != nil {
-		return errors.Wrap(err, "decode response")
-	}
-	if resp.Error != nil {
-		return errors.New(strings.TrimSpace(resp.Error.Message))
-	}
-	content := resp.Content()
-	if strings.TrimSpace(content) == "" {
-		return errors.New("xai response missing content")
-	}
-	if _, err := io.WriteString(stdout, content); err != nil {
-		return errors.Wrap(err, "write response content")
-	}
-	return nil
-}
-
-type chatCompletionRequest struct {
-	Model    string        `json:"model"`
-	Messages []chatMessage `json:"messages"`
-	Stream   bool          `json:"stream,omitempty"`
-}
-
-type chatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type chatCompletionChunk struct {
-	Choices []chatChoice `json:"choices"`
-	Error   *apiError    `json:"error,omitempty"`
-}
-
-func (c chatCompletionChunk) Content() string {
-	if len(c.Choices) == 0 {
-		return ""
-	}
-	choice := c.Choices[0]
-	if choice.Delta.Content != "" {
-		return choice.Delta.Content
-	}
-	if choice.Message.Content != "" {
-		return choice.Message.Content
-	}
-	if choice.Text != "" {
-		return choice.Text
-	}
-	return ""
-}
-
-type chatCompletionResponse struct {
-	Choices []chatChoice `json:"choices"`
-	Error   *apiError    `json:"error,omitempty"`
-}
-
-func (c chatCompletionResponse) Content() string {
-	if len(c.Choices) == 0 {
-		return ""
-	}
-	choice := c.Choices[0]
-	if choice.Message.Content != "" {
-		return choice.Message.Content
-	}
-	if choice.Text != "" {
-		return choice.Text
-	}
-	if choice.Delta.Content != "" {
-		return choice.Delta.Content
-	}
-	return ""
-}
-
-type chatChoice struct {
-	Delta   chatDelta   `json:"delta,omitempty"`
-	Message chatMessage `json:"message,omitempty"`
-	Text    string      `json:"text,omitempty"`
-}
-
-type chatDelta struct {
-	Content string `json:"content,omitempty"`
-	Role    string `json:"role,omitempty"`
-}
-
-type apiError struct {
-	Message string `json:"message"`
-}
@@ -51,62 +51,6 @@ func TestLookupEnv(t *testing.T) {
 	}
 }
 
-func TestWriteChunk(t *testing.T) {
-	var stdout bytes.Buffer
-	payload := `{"choices":[{"delta":{"content":"hi"}}]}`
-	if err := writeChunk(payload, &stdout); err != nil {
-		t.Fatalf("writeChunk: %v", err)
-	}
-	if stdout.String() != "hi" {
-		t.Fatalf("unexpected stdout: %q", stdout.String())
-	}
-	if err := writeChunk(`{"error":{"message":"boom"}}`, &stdout); err == nil {
-		t.Fatalf("expected error")
-	}
-	if err := writeChunk("{bad", &stdout); err == nil {
-		t.Fatalf("expected decode error")
-	}
-}
-
-func TestDecodeSingleResponse(t *testing.T) {
-	var stdout bytes.Buffer
-	payload := `{"choices":[{"message":{"content":"hello"}}]}`
-	if err := decodeSingleResponse(strings.NewReader(payload), &stdout); err != nil {
-		t.Fatalf("decodeSingleResponse: %v", err)
-	}
-	if stdout.String() != "hello" {
-		t.Fatalf("unexpected stdout: %q", stdout.String())
-	}
-	if err := decodeSingleResponse(strings.NewReader(`{"choices":[]}`), &stdout); err == nil {
-		t.Fatalf("expected error for missing content")
-	}
-	if err := decodeSingleResponse(strings.NewReader(`{"error":{"message":"boom"}}`), &stdout); err == nil {
-		t.Fatalf("expected error for api error")
-	}
-	if err := decodeSingleResponse(strings.NewReader("{bad"), &stdout); err == nil {
-		t.Fatalf("expected decode error")
-	}
-}
-
-func TestStreamResponse(t *testing.T) {
-	data := "data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n" +
-		"data: [DONE]\n"
-	var stdout bytes.Buffer
-	if err := streamResponse(strings.NewReader(data), &stdout); err != nil {
-		t.Fatalf("streamResponse: %v", err)
-	}
-	if stdout.String() != "ok" {
-		t.Fatalf("unexpected stdout: %q", stdout.String())
-	}
-}
-
-func TestStreamResponseError(t *testing.T) {
-	data := "data: {bad}\n"
-	if err := streamResponse(strings.NewReader(data), io.Discard); err == nil {
-		t.Fatalf("expected stream error")
-	}
-}
-
 func TestResolvedConfig(t *testing.T) {
 	agent, err := NewAgent(Config{APIKey: "token", BaseURL: "https://api.x.ai", Model: "model", HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
 		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("data: [DONE]\n")), Header: http.Header{"Content-Type": []string{"text/event-stream"}}}, nil
@@ -121,7 +65,7 @@ func TestResolvedConfig(t *testing.T) {
 	if resolved.apiKey != "token" {
 		t.Fatalf("expected api key")
 	}
-	if err := resolved.streamCompletion(context.Background(), "prompt", io.Discard); err != nil {
+	if _, err := resolved.streamCompletion(context.Background(), &agentpkg.RunContext{Prompt: "prompt"}, nil, io.Discard); err != nil {
 		t.Fatalf("streamCompletion: %v", err)
 	}
 }
@@ -154,7 +98,7 @@ func TestStreamCompletionNonStream(t *testing.T) {
 		t.Fatalf("resolveConfig: %v", err)
 	}
 	var stdout bytes.Buffer
-	if err := resolved.streamCompletion(context.Background(), "prompt", &stdout); err != nil {
+	if _, err := resolved.streamCompletion(context.Background(), &agentpkg.RunContext{Prompt: "prompt"}, nil, &stdout); err != nil {
 		t.Fatalf("streamCompletion: %v", err)
 	}
 	if stdout.String() != "hello" {
@@ -178,7 +122,7 @@ func TestStreamCompletionStatusError(t *testing.T) {
 	if err != nil {
 		t.Fatalf("resolveConfig: %v", err)
 	}
-	if err := resolved.streamCompletion(context.Background(), "prompt", io.Discard); err == nil {
+	if _, err := resolved.streamCompletion(context.Background(), &agentpkg.RunContext{Prompt: "prompt"}, nil, io.Discard); err == nil {
 		t.Fatalf("expected status error")
 	}
 }
@@ -233,21 +177,6 @@ func TestExecuteValidation(t *testing.T) {
 	}
 }
 
-func TestChunkContentHelpers(t *testing.T) {
-	chunk := chatCompletionChunk{Choices: []chatChoice{{Delta: chatDelta{Content: "delta"}}}}
-	if chunk.Content() != "delta" {
-		t.Fatalf("unexpected chunk content")
-	}
-	chunk = chatCompletionChunk{Choices: []chatChoice{{Message: chatMessage{Content: "msg"}}}}
-	if chunk.Content() != "msg" {
-		t.Fatalf("unexpected message content")
-	}
-	resp := chatCompletionResponse{Choices: []chatChoice{{Text: "text"}}}
-	if resp.Content() != "text" {
-		t.Fatalf("unexpected response content")
-	}
-}
-
 func TestExecuteSuccess(t *testing.T) {
 	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
 		body := "{\"choices\":[{\"message\":{\"content\":\"hello\"}}]}"
@@ -311,7 +240,7 @@ func TestRoundTripErrorPropagates(t *testing.T) {
 	if err != nil {
 		t.Fatalf("resolveConfig: %v", err)
 	}
-	if err := cfg.streamCompletion(context.Background(), "prompt", io.Discard); err == nil {
+	if _, err := cfg.streamCompletion(context.Background(), &agentpkg.RunContext{Prompt: "prompt"}, nil, io.Discard); err == nil {
 		t.Fatalf("expected request error")
 	}
 }
@@ -19,6 +19,7 @@ import (
 	"github.com/jonnyzzz/conductor-loop/internal/runstate"
 	"github.com/jonnyzzz/conductor-loop/internal/storage"
 	"github.com/jonnyzzz/conductor-loop/internal/taskdeps"
+	"github.com/jonnyzzz/conductor-loop/internal/worktree"
 	"github.com/pkg/errors"
 )
 
@@ -39,6 +40,38 @@ type TaskCreateRequest struct {
 	// ThreadMessageType is validated only when ThreadParent is set.
 	// For threaded task creation, only USER_REQUEST is accepted.
 	ThreadMessageType string `json:"thread_message_type,omitempty"`
+	// Isolation is "none" (default) or "worktree": run the task in a
+	// dedicated git worktree and branch under the task directory.
+	Isolation string `json:"isolation,omitempty"`
+	// OnDone is the worktree policy applied when the task is DONE:
+	// "branch" (default), "merge" or "rebase".
+	OnDone string `json:"on_done,omitempty"`
+	// Budget caps for the task subtree; unset fields fall back to
+	// defaults.budget. MaxWallClock is a Go duration such as "2h".
+	MaxTokens       int64   `json:"max_tokens,omitempty"`
+	MaxCostUSD      float64 `json:"max_cost_usd,omitempty"`
+	MaxWallClock    string  `json:"max_wall_clock,omitempty"`
+	MaxTreeRestarts int     `json:"max_tree_restarts,omitempty"`
+}
+
+// budget returns the task subtree budget requested by req.
+func (req TaskCreateRequest) budget() (runner.Budget, error) {
+	budget := runner.Budget{
+		MaxTokens:   req.MaxTokens,
+		MaxCostUSD:  req.MaxCostUSD,
+		MaxRestarts: req.MaxTreeRestarts,
+	}
+	if budget.MaxTokens < 0 || budget.MaxCostUSD < 0 || budget.MaxRestarts < 0 {
+		return budget, errors.New("budget caps must not be negative")
+	}
+	if wallClock := strings.TrimSpace(req.MaxWallClock); wallClock != "" {
+		d, err := time.ParseDuration(wallClock)
+		if err != nil || d < 0 {
+			return budget, errors.Errorf("invalid max_wall_clock %q", req.MaxWallClock)
+		}
+		budget.MaxWallClock = d
+	}
+	return budget, nil
 }
 
 // ProcessImportRequest configures adoption of an already-running process into a new run.
@@ -96,6 +129,8 @@ type MessageResponse struct {
 	TaskID    string              `json:"task_id,omitempty"`
 	RunID     string              `json:"run_id,omitempty"`
 	IssueID   string              `json:"issue_id,omitempty"`
+	ToTask    string              `json:"to_task,omitempty"`
+	ToRun     string              `json:"to_run,omitempty"`
 	Parents   []messagebus.Parent `json:"parents,omitempty"`
 	Links     []messagebus.Link   `json:"links,omitempty"`
 	Meta      map[string]string   `json:"meta,omitempty"`
@@ -331,6 +366,10 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) *apiErro
 			return err
 		}
 	}
+	filter, apiErr := parseMessageFilter(r)
+	if apiErr != nil {
+		return apiErr
+	}
 
 	var busPath string
 	if taskID != "" {
@@ -363,10 +402,11 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) *apiErro
 	if err := requirePathWithinRoot(s.rootDir, busPath, "message bus path"); err != nil {
 		return err
 	}
-	bus, err := messagebus.NewMessageBus(busPath)
+	bus, err := messagebus.Open(busPath, "")
 	if err != nil {
 		return apiErrorInternal("open message bus", err)
 	}
+	defer bus.Close()
 	messages, err := bus.ReadMessages(after)
 	if err != nil {
 		if stderrors.Is(err, messagebus.ErrSinceIDNotFound) {
@@ -376,7 +416,7 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) *apiErro
 	}
 	resp := make([]MessageResponse, 0, len(messages))
 	for _, msg := range messages {
-		if msg == nil {
+		if msg == nil || !filter.Match(msg) {
 			continue
 		}
 		resp = append(resp, MessageResponse{
@@ -387,6 +427,8 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) *apiErro
 			TaskID:    msg.TaskID,
 			RunID:     msg.RunID,
 			IssueID:   msg.IssueID,
+			ToTask:    msg.ToTask,
+			ToRun:     msg.ToRun,
 			Parents:   msg.Parents,
 			Links:     msg.Links,
 			Meta:      msg.Meta,
@@ -464,10 +506,11 @@ func (s *Server) handlePostMessage(w http.ResponseWriter, r *http.Request) *apiE
 		return apiErrorInternal("create message bus directory", err)
 	}
 
-	bus, err := messagebus.NewMessageBus(busPath)
+	bus, err := s.openWriteBus(busPath)
 	if err != nil {
 		return apiErrorInternal("open message bus", err)
 	}
+	defer bus.Close()
 
 	msgType := strings.TrimSpace(req.Type)
 	if msgType == "" {
@@ -483,7 +526,7 @@ func (s *Server) handlePostMessage(w http.ResponseWriter, r *http.Request) *apiE
 	}
 	msgID, err := bus.AppendMessage(msg)
 	if err != nil {
-		return apiErrorInternal("append message", err)
+		return appendMessageError(err)
 	}
 	req.TaskID = taskID
 	s.writeFormSubmissionAudit(r, formSubmissionAuditArgs{
@@ -556,6 +599,20 @@ func (s *Server) handleTaskCreate(w http.ResponseWriter, r *http.Request) *apiEr
 	}
 	req.ProjectRoot = projectRoot
 
+	isolation, err := worktree.NormalizeMode(req.Isolation)
+	if err != nil {
+		return apiErrorBadRequest(err.Error())
+	}
+	if _, err := worktree.NormalizePolicy(req.OnDone); err != nil {
+		return apiErrorBadRequest(err.Error())
+	}
+	if isolation == worktree.ModeWorktree && req.ProcessImport != nil {
+		return apiErrorBadRequest("isolation worktree cannot be combined with process_import")
+	}
+	if _, err := req.budget(); err != nil {
+		return apiErrorBadRequest(err.Error())
+	}
+
 	var (
 		dependsOn      []string
 		dependsUpdated bool
@@ -672,32 +729,9 @@ func (s *Server) handleTaskCreate(w http.ResponseWriter, r *http.Request) *apiEr
 		Payload:   req,
 	})
 
-	responseStatus := "started"
-	queuePosition := 0
-	if s.startTasks {
-		s.rootRunGateMu.Lock()
-		if blockedErr := s.taskCreateBlockedBySelfUpdateLocked(); blockedErr != nil {
-			s.rootRunGateMu.Unlock()
-			return blockedErr
-		}
-		if s.rootTaskPlanner != nil {
-			planResult, planErr := s.rootTaskPlanner.Submit(req, runDir, runPrompt)
-			if planErr != nil {
-				s.rootRunGateMu.Unlock()
-				return apiErrorInternal("plan root task start", planErr)
-			}
-			responseStatus = planResult.Status
-			queuePosition = planResult.QueuePosition
-			s.launchPlannedTasksLocked(planResult.Launches)
-		} else {
-			s.launchPlannedTasksLocked([]rootTaskLaunch{{
-				Request:   req,
-				RunID:     runID,
-				RunDir:    runDir,
-				RunPrompt: runPrompt,
-			}})
-		}
-		s.rootRunGateMu.Unlock()
+	responseStatus, queuePosition, admitErr := s.admitTaskRun(req, runID, runDir, runPrompt)
+	if admitErr != nil {
+		return admitErr
 	}
 	obslog.Log(s.logger, "INFO", "api", "task_create_accepted",
 		obslog.F("request_id", requestIDFromRequest(r)),
@@ -723,6 +757,35 @@ func (s *Server) handleTaskCreate(w http.ResponseWriter, r *http.Request) *apiEr
 	return writeJSON(w, http.StatusCreated, resp)
 }
 
+// admitTaskRun starts the pre-allocated first run of a task, or queues it
+// in the root-task planner when the root task limit is reached. It returns
+// the planner status ("started" or "queued") and the queue position.
+func (s *Server) admitTaskRun(req TaskCreateRequest, runID, runDir, runPrompt string) (string, int, *apiError) {
+	if !s.startTasks {
+		return "started", 0, nil
+	}
+	s.rootRunGateMu.Lock()
+	defer s.rootRunGateMu.Unlock()
+	if blockedErr := s.taskCreateBlockedBySelfUpdateLocked(); blockedErr != nil {
+		return "", 0, blockedErr
+	}
+	if s.rootTaskPlanner == nil {
+		s.launchPlannedTasksLocked([]rootTaskLaunch{{
+			Request:   req,
+			RunID:     runID,
+			RunDir:    runDir,
+			RunPrompt: runPrompt,
+		}})
+		return "started", 0, nil
+	}
+	planResult, planErr := s.rootTaskPlanner.Submit(req, runDir, runPrompt)
+	if planErr != nil {
+		return "", 0, apiErrorInternal("plan root task start", planErr)
+	}
+	s.launchPlannedTasksLocked(planResult.Launches)
+	return planResult.Status, planResult.QueuePosition, nil
+}
+
 // taskCreateBlockedBySelfUpdateLocked checks whether root-run admission is blocked.
 // Caller must hold s.rootRunGateMu.
 func (s *Server) taskCreateBlockedBySelfUpdateLocked() *apiError {
@@ -945,7 +1008,7 @@ func (s *Server) conductorURL() string {
 	return httpBaseURL(host, port)
 }
 
-func (s *Server) startTask(req TaskCreateRequest, firstRunDir, prompt string) {
+func (s *Server) startTask(req TaskCreateRequest, firstRunDir, prompt string) error {
 	runID := strings.TrimSpace(filepath.Base(firstRunDir))
 	parentRunID := ""
 	if req.ThreadParent != nil {
@@ -975,7 +1038,8 @@ func (s *Server) startTask(req TaskCreateRequest, firstRunDir, prompt string) {
 			obslog.F("import_pid", req.ProcessImport.PID),
 		)
 		s.metrics.IncActiveRuns()
-		if err := runner.RunImportedProcess(req.ProjectID, req.TaskID, opts); err != nil {
+		err := runner.RunImportedProcess(req.ProjectID, req.TaskID, opts)
+		if err != nil {
 			obslog.Log(s.logger, "ERROR", "api", "task_import_failed",
 				obslog.F("project_id", req.ProjectID),
 				obslog.F("task_id", req.TaskID),
@@ -995,9 +1059,13 @@ func (s *Server) startTask(req TaskCreateRequest, firstRunDir, prompt string) {
 			s.metrics.DecActiveRuns()
 			s.metrics.IncCompletedRuns()
 		}
-		return
+		return err
 	}
 
+	budget, err := req.budget()
+	if err != nil {
+		return err
+	}
 	opts := runner.TaskOptions{
 		RootDir:      s.rootDir,
 		ConfigPath:   s.configPath,
@@ -1009,6 +1077,9 @@ func (s *Server) startTask(req TaskCreateRequest, firstRunDir, prompt string) {
 		ConductorURL: s.conductorURL(),
 		ParentRunID:  parentRunID,
 		DependsOn:    req.DependsOn,
+		Isolation:    req.Isolation,
+		OnDone:       req.OnDone,
+		Budget:       budget,
 	}
 	obslog.Log(s.logger, "INFO", "api", "task_run_started",
 		obslog.F("project_id", req.ProjectID),
@@ -1017,7 +1088,8 @@ func (s *Server) startTask(req TaskCreateRequest, firstRunDir, prompt string) {
 		obslog.F("agent_type", req.AgentType),
 	)
 	s.metrics.IncActiveRuns()
-	if err := runner.RunTask(req.ProjectID, req.TaskID, opts); err != nil {
+	err = runner.RunTask(req.ProjectID, req.TaskID, opts)
+	if err != nil {
 		obslog.Log(s.logger, "ERROR", "api", "task_run_failed",
 			obslog.F("project_id", req.ProjectID),
 			obslog.F("task_id", req.TaskID),
@@ -1037,6 +1109,7 @@ func (s *Server) startTask(req TaskCreateRequest, firstRunDir, prompt string) {
 		s.metrics.DecActiveRuns()
 		s.metrics.IncCompletedRuns()
 	}
+	return err
 }
 
 func (s *Server) launchPlannedTasks(launches []rootTaskLaunch) {
@@ -1077,12 +1150,16 @@ func (s *Server) launchPlannedTasksLocked(launches []rootTaskLaunch) {
 		if strings.TrimSpace(launch.RunDir) == "" {
 			continue
 		}
+		key := taskQueueKey{ProjectID: launch.Request.ProjectID, TaskID: launch.Request.TaskID}
 		s.activeRootRuns.Add(1)
+		s.trackTaskRun(key, 1)
 		s.taskWg.Add(1)
 		go func() {
 			defer s.taskWg.Done()
 			defer s.activeRootRuns.Add(-1)
-			s.startTask(launch.Request, launch.RunDir, launch.RunPrompt)
+			defer s.trackTaskRun(key, -1)
+			err := s.startTask(launch.Request, launch.RunDir, launch.RunPrompt)
+			s.finishPipelineTaskRun(launch.RunID, err)
 			if s.rootTaskPlanner == nil {
 				return
 			}
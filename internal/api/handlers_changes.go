@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jonnyzzz/conductor-loop/internal/changes"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/pkg/errors"
+)
+
+// changesResponse is the JSON body of the run changes endpoint.
+type changesResponse struct {
+	ProjectID string       `json:"project_id"`
+	TaskID    string       `json:"task_id"`
+	RunID     string       `json:"run_id"`
+	Status    string       `json:"status"`
+	Changes   *changes.Set `json:"changes"`
+	Patch     *string      `json:"patch,omitempty"`
+}
+
+// serveRunChanges returns the files a run changed (changes.json) and, with
+// ?patch=true, the unified diff from changes.patch.
+// GET /api/projects/{p}/tasks/{t}/runs/{r}/changes[?patch=true]
+func (s *Server) serveRunChanges(w http.ResponseWriter, r *http.Request, run *storage.RunInfo) *apiError {
+	runDir, apiErr := s.runArtifactDir(run)
+	if apiErr != nil {
+		return apiErr
+	}
+	withPatch := false
+	if raw := r.URL.Query().Get("patch"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return apiErrorBadRequest("invalid patch")
+		}
+		withPatch = parsed
+	}
+	set, err := changes.Read(runDir)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return apiErrorNotFound("changes not recorded for run")
+		}
+		return apiErrorInternal("read changes", err)
+	}
+	resp := changesResponse{
+		ProjectID: run.ProjectID,
+		TaskID:    run.TaskID,
+		RunID:     run.RunID,
+		Status:    run.Status,
+		Changes:   set,
+	}
+	if withPatch {
+		data, err := os.ReadFile(filepath.Join(runDir, changes.PatchFileName))
+		if err != nil && !os.IsNotExist(err) {
+			return apiErrorInternal("read changes patch", err)
+		}
+		patch := string(data)
+		resp.Patch = &patch
+	}
+	return writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/changes"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+func TestRunChanges(t *testing.T) {
+	root := t.TempDir()
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	makeProjectRun(t, root, "project", "task", "run-1", storage.StatusCompleted, "raw\n")
+	makeProjectRun(t, root, "project", "task", "run-2", storage.StatusCompleted, "raw\n")
+	runDir := filepath.Join(root, "project", "task", "runs", "run-1")
+	set := changes.Set{Mode: changes.ModeGit, Files: []changes.File{{Path: "a.go", Status: changes.StatusModified, Additions: 1}}, Additions: 1}
+	data, _ := json.Marshal(set)
+	if err := os.WriteFile(filepath.Join(runDir, changes.FileName), data, 0o644); err != nil {
+		t.Fatalf("write changes: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(runDir, changes.PatchFileName), []byte("+x\n"), 0o644); err != nil {
+		t.Fatalf("write patch: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/projects/project/tasks/task/runs/run-1/changes?patch=true", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp changesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Changes == nil || len(resp.Changes.Files) != 1 || resp.Changes.Files[0].Path != "a.go" {
+		t.Fatalf("unexpected changes: %+v", resp.Changes)
+	}
+	if resp.Patch == nil || *resp.Patch != "+x\n" {
+		t.Fatalf("unexpected patch: %v", resp.Patch)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/projects/project/tasks/task/runs/run-1/file?name=changes.patch", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for changes.patch file, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/projects/project/tasks/task/runs/run-2/changes", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without changes.json, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
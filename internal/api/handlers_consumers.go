@@ -0,0 +1,122 @@
+package api
+
+import (
+	stderrors "errors"
+	"net/http"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+)
+
+// ackRequest is the request body of POST .../messages/consumers/{name}/ack.
+type ackRequest struct {
+	MsgID string `json:"msg_id"`
+}
+
+// ConsumerReadResponse is returned by GET .../messages/consumers/{name}.
+// LastMsgID is the last unacknowledged message examined, including messages
+// rejected by where=; acknowledging it consumes the whole batch.
+type ConsumerReadResponse struct {
+	Consumer  string             `json:"consumer"`
+	Cursor    *messagebus.Cursor `json:"cursor"`
+	Messages  []MessageResponse  `json:"messages"`
+	LastMsgID string             `json:"last_msg_id,omitempty"`
+}
+
+// handleBusConsumers serves the consumer cursor endpoints below a bus
+// messages URL; rest is the path after ".../messages/consumers":
+//
+//	GET    consumers               list cursors
+//	GET    consumers/{name}        unacknowledged messages (limit=, where=)
+//	POST   consumers/{name}/ack    move the cursor to {"msg_id": ...}
+//	DELETE consumers/{name}        reset the cursor
+func (s *Server) handleBusConsumers(w http.ResponseWriter, r *http.Request, busPath string, rest []string) *apiError {
+	bus, err := messagebus.Open(busPath, "")
+	if err != nil {
+		return apiErrorInternal("open message bus", err)
+	}
+	defer bus.Close()
+	if len(rest) == 0 {
+		if r.Method != http.MethodGet {
+			return apiErrorMethodNotAllowed()
+		}
+		cursors, err := bus.Cursors()
+		if err != nil {
+			return apiErrorInternal("read consumer cursors", err)
+		}
+		return writeJSON(w, http.StatusOK, map[string]interface{}{"consumers": cursors})
+	}
+	consumer := rest[0]
+	if err := messagebus.ValidateConsumerName(consumer); err != nil {
+		return apiErrorBadRequest(err.Error())
+	}
+	if len(rest) == 2 && rest[1] == "ack" {
+		if r.Method != http.MethodPost {
+			return apiErrorMethodNotAllowed()
+		}
+		return s.ackBusConsumer(w, r, bus, consumer)
+	}
+	if len(rest) != 1 {
+		return apiErrorNotFound("not found")
+	}
+	switch r.Method {
+	case http.MethodGet:
+		return s.readBusConsumer(w, r, bus, consumer)
+	case http.MethodDelete:
+		existed, err := bus.ResetCursor(consumer)
+		if err != nil {
+			return apiErrorInternal("reset consumer cursor", err)
+		}
+		return writeJSON(w, http.StatusOK, map[string]interface{}{"consumer": consumer, "reset": existed})
+	default:
+		return apiErrorMethodNotAllowed()
+	}
+}
+
+func (s *Server) readBusConsumer(w http.ResponseWriter, r *http.Request, bus messagebus.Bus, consumer string) *apiError {
+	limit := parseMessageListLimit(r.URL.Query().Get("limit"))
+	filter, apiErr := parseMessageFilter(r)
+	if apiErr != nil {
+		return apiErr
+	}
+	cursor, err := bus.Cursor(consumer)
+	if err != nil {
+		return apiErrorInternal("read consumer cursor", err)
+	}
+	messages, err := bus.ReadUnacked(consumer, limit)
+	if err != nil {
+		return apiErrorInternal("read message bus", err)
+	}
+	resp := ConsumerReadResponse{Consumer: consumer, Cursor: cursor}
+	if len(messages) > 0 {
+		resp.LastMsgID = messages[len(messages)-1].MsgID
+	}
+	resp.Messages = messageResponses(messagebus.FilterMessages(messages, filter))
+	return writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) ackBusConsumer(w http.ResponseWriter, r *http.Request, bus messagebus.Bus, consumer string) *apiError {
+	var req ackRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	msgID := strings.TrimSpace(req.MsgID)
+	if msgID == "" {
+		return apiErrorBadRequest("msg_id is required")
+	}
+	cursor, err := bus.Ack(consumer, msgID)
+	if err != nil {
+		if stderrors.Is(err, messagebus.ErrSinceIDNotFound) {
+			return apiErrorNotFound("message id not found")
+		}
+		return apiErrorInternal("ack message", err)
+	}
+	obslog.Log(s.logger, "INFO", "api", "bus_consumer_acked",
+		obslog.F("request_id", requestIDFromRequest(r)),
+		obslog.F("consumer", consumer),
+		obslog.F("message_id", msgID),
+		obslog.F("cursor", cursor.MsgID),
+	)
+	return writeJSON(w, http.StatusOK, cursor)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+)
+
+func TestBusConsumerEndpoints(t *testing.T) {
+	server, root := newTestServer(t)
+	taskDir := filepath.Join(root, "project", "task-20260101-000000-cursor")
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	bus, err := messagebus.NewMessageBus(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	var ids []string
+	for _, msgType := range []string{"USER_REQUEST", "PROGRESS", "USER_REQUEST"} {
+		id, err := bus.AppendMessage(&messagebus.Message{Type: msgType, ProjectID: "project", Body: msgType})
+		if err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	base := "/api/projects/project/tasks/task-20260101-000000-cursor/messages/consumers"
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	read := func(query string) ConsumerReadResponse {
+		t.Helper()
+		rec := do(http.MethodGet, base+"/ralph"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET consumer: %d %s", rec.Code, rec.Body.String())
+		}
+		var resp ConsumerReadResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp
+	}
+
+	resp := read("?limit=2&where=" + "type%20%3D%20USER_REQUEST")
+	if resp.Cursor != nil || len(resp.Messages) != 1 || resp.Messages[0].MsgID != ids[0] || resp.LastMsgID != ids[1] {
+		t.Fatalf("first read = %+v", resp)
+	}
+
+	rec := do(http.MethodPost, base+"/ralph/ack", `{"msg_id":"`+resp.LastMsgID+`"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), ids[1]) {
+		t.Fatalf("ack: %d %s", rec.Code, rec.Body.String())
+	}
+	resp = read("")
+	if resp.Cursor == nil || resp.Cursor.MsgID != ids[1] || len(resp.Messages) != 1 || resp.Messages[0].MsgID != ids[2] {
+		t.Fatalf("read after ack = %+v", resp)
+	}
+
+	rec = do(http.MethodGet, base, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"consumer":"ralph"`) {
+		t.Fatalf("list: %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, base + "/ralph/ack", `{"msg_id":"MSG-unknown"}`, http.StatusNotFound},
+		{http.MethodPost, base + "/ralph/ack", `{}`, http.StatusBadRequest},
+		{http.MethodPost, base + "/bad%20name/ack", `{"msg_id":"` + ids[0] + `"}`, http.StatusBadRequest},
+		{http.MethodGet, base + "/ralph/ack", "", http.StatusMethodNotAllowed},
+		{http.MethodPut, base + "/ralph", "", http.StatusMethodNotAllowed},
+	} {
+		if rec := do(tc.method, tc.path, tc.body); rec.Code != tc.want {
+			t.Errorf("%s %s = %d, want %d: %s", tc.method, tc.path, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+
+	rec = do(http.MethodDelete, base+"/ralph", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"reset":true`) {
+		t.Fatalf("reset: %d %s", rec.Code, rec.Body.String())
+	}
+	if resp := read(""); resp.Cursor != nil || len(resp.Messages) != 3 {
+		t.Fatalf("read after reset = %+v", resp)
+	}
+
+	// The project bus has the same endpoints.
+	if _, err := messagebus.NewMessageBus(filepath.Join(root, "project", "PROJECT-MESSAGE-BUS.md")); err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	rec = do(http.MethodGet, "/api/projects/project/messages/consumers/ralph", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"messages":[]`) {
+		t.Fatalf("project consumer read: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/busexport"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+)
+
+// handleBusExport serves GET /api/projects/{p}[/tasks/{t}]/messages/export:
+// the bus rendered as a downloadable task log. Query parameters: format
+// (markdown, html, json or csv; default markdown), since, until, type
+// (comma-separated or repeated), where, keep_run_events and title.
+func (s *Server) handleBusExport(w http.ResponseWriter, r *http.Request, projectID, taskID string) *apiError {
+	if r.Method != http.MethodGet {
+		return apiErrorMethodNotAllowed()
+	}
+	if err := validateIdentifier(projectID, "project_id"); err != nil {
+		return err
+	}
+	var (
+		busPath string
+		apiErr  *apiError
+	)
+	if taskID != "" {
+		if err := validateIdentifier(taskID, "task_id"); err != nil {
+			return err
+		}
+		busPath, apiErr = s.taskBusPath(projectID, taskID)
+	} else {
+		busPath, apiErr = s.projectBusPath(projectID)
+	}
+	if apiErr != nil {
+		return apiErr
+	}
+
+	query := r.URL.Query()
+	format, err := busexport.NormalizeFormat(query.Get("format"))
+	if err != nil {
+		return apiErrorBadRequest(err.Error())
+	}
+	opts := busexport.Options{
+		Title:         strings.TrimSpace(query.Get("title")),
+		KeepRunEvents: parseActiveOnlyQuery(query.Get("keep_run_events")),
+	}
+	now := time.Now()
+	for _, bound := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &opts.Since}, {"until", &opts.Until}} {
+		if raw := strings.TrimSpace(query.Get(bound.name)); raw != "" {
+			if *bound.dst, err = messagebus.ParseTime(raw, now); err != nil {
+				return apiErrorBadRequest(bound.name + ": " + err.Error())
+			}
+		}
+	}
+	for _, raw := range query["type"] {
+		for _, t := range strings.Split(raw, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				opts.Types = append(opts.Types, t)
+			}
+		}
+	}
+	if opts.Filter, apiErr = parseMessageFilter(r); apiErr != nil {
+		return apiErr
+	}
+	if opts.Title == "" {
+		opts.Title = "Project " + projectID
+		if taskID != "" {
+			opts.Title = "Task " + projectID + "/" + taskID
+		}
+	}
+
+	var messages []*messagebus.Message
+	if busFileExists(busPath) {
+		bus, err := messagebus.Open(busPath, "")
+		if err != nil {
+			return apiErrorInternal("open message bus", err)
+		}
+		defer bus.Close()
+		if messages, err = bus.ReadMessages(""); err != nil {
+			return apiErrorInternal("read message bus", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := busexport.Export(&buf, messages, format, opts); err != nil {
+		return apiErrorInternal("export message bus", err)
+	}
+
+	name := projectID
+	if taskID != "" {
+		name += "-" + taskID
+	}
+	w.Header().Set("Content-Type", busexport.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"-messages"+busexport.FileExtension(format)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+	return nil
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/busexport"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+)
+
+func TestBusExportEndpoint(t *testing.T) {
+	server, root := newTestServer(t)
+	taskID := "task-20260101-000000-log"
+	taskDir := filepath.Join(root, "project", taskID)
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	bus, err := messagebus.NewMessageBus(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	for _, msg := range []*messagebus.Message{
+		{Type: messagebus.EventTypeRunStart, ProjectID: "project", TaskID: taskID, RunID: "run-1", Body: "run started"},
+		{Type: "FACT", ProjectID: "project", TaskID: taskID, RunID: "run-1", Body: "tests <pass>"},
+		{Type: messagebus.EventTypeRunStop, ProjectID: "project", TaskID: taskID, RunID: "run-1", Body: "run stopped with code 0"},
+	} {
+		if _, err := bus.AppendMessage(msg); err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+	base := "/api/projects/project/tasks/" + taskID + "/messages/export"
+
+	rec := get(base)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET export: %d %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, `filename="project-`+taskID+`-messages.md"`) {
+		t.Fatalf("Content-Disposition = %q", cd)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "# Task project/"+taskID) || !strings.Contains(body, "## Run run-1") || strings.Contains(body, "RUN_START") {
+		t.Fatalf("markdown export:\n%s", body)
+	}
+
+	rec = get(base + "?format=json&keep_run_events=true&type=FACT,RUN_START")
+	var doc busexport.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || doc.Messages != 2 {
+		t.Fatalf("json export: %d %v %s", rec.Code, err, rec.Body.String())
+	}
+
+	if rec := get("/api/projects/project/messages/export?format=html"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<h1>Project project</h1>") {
+		t.Fatalf("project html export: %d %s", rec.Code, rec.Body.String())
+	}
+	for _, bad := range []string{"?format=pdf", "?since=yesterday", "?where=bogus"} {
+		if rec := get(base + bad); rec.Code != http.StatusBadRequest {
+			t.Fatalf("GET export%s: %d, want 400", bad, rec.Code)
+		}
+	}
+}
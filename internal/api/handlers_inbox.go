@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+)
+
+// inboxPostRequest is the request body of POST /api/projects/{p}/tasks/{t}/inbox.
+type inboxPostRequest struct {
+	Type     string `json:"type"`
+	Body     string `json:"body"`
+	ToRun    string `json:"to_run,omitempty"`
+	FromTask string `json:"from_task,omitempty"`
+	FromRun  string `json:"from_run,omitempty"`
+}
+
+// handleTaskInbox handles GET and POST for /api/projects/{p}/tasks/{t}/inbox:
+// the directed messages sent to the task. GET accepts run_id= (include the
+// messages for that run only) and unread=true (only messages no run of the
+// task has seen yet).
+func (s *Server) handleTaskInbox(w http.ResponseWriter, r *http.Request, projectID, taskID string) *apiError {
+	if _, ok := findProjectTaskDir(s.rootDir, projectID, taskID); !ok {
+		return apiErrorNotFound("task not found")
+	}
+	busPath, apiErr := s.taskBusPath(projectID, taskID)
+	if apiErr != nil {
+		return apiErr
+	}
+	bus, err := messagebus.Open(busPath, "")
+	if err != nil {
+		return apiErrorInternal("open message bus", err)
+	}
+	defer bus.Close()
+	switch r.Method {
+	case http.MethodGet:
+		runID := strings.TrimSpace(r.URL.Query().Get("run_id"))
+		unread := strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("unread")), "true")
+		messages, err := bus.ReadInbox(taskID, runID, unread)
+		if err != nil {
+			return apiErrorInternal("read inbox", err)
+		}
+		return writeJSON(w, http.StatusOK, map[string]interface{}{"messages": messageResponses(messages)})
+	case http.MethodPost:
+		return s.postInboxMessage(w, r, busPath, projectID, taskID)
+	default:
+		return apiErrorMethodNotAllowed()
+	}
+}
+
+func (s *Server) postInboxMessage(w http.ResponseWriter, r *http.Request, busPath, projectID, taskID string) *apiError {
+	var req inboxPostRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		return apiErrorBadRequest("body is required")
+	}
+	fromTask := strings.TrimSpace(req.FromTask)
+	if fromTask != "" {
+		if err := validateIdentifier(fromTask, "from_task"); err != nil {
+			return err
+		}
+	}
+	msgType := strings.TrimSpace(req.Type)
+	if msgType == "" {
+		msgType = "USER"
+	}
+	msg := &messagebus.Message{
+		Type:      msgType,
+		ProjectID: projectID,
+		TaskID:    fromTask,
+		RunID:     strings.TrimSpace(req.FromRun),
+		ToTask:    taskID,
+		ToRun:     strings.TrimSpace(req.ToRun),
+		Body:      req.Body,
+	}
+	bus, err := s.openWriteBus(busPath)
+	if err != nil {
+		return apiErrorInternal("open message bus", err)
+	}
+	defer bus.Close()
+	msgID, err := bus.AppendMessage(msg)
+	if err != nil {
+		return appendMessageError(err)
+	}
+	const endpoint = "POST /api/projects/{project_id}/tasks/{task_id}/inbox"
+	s.writeFormSubmissionAudit(r, formSubmissionAuditArgs{
+		Endpoint:  endpoint,
+		ProjectID: projectID,
+		TaskID:    taskID,
+		MessageID: msgID,
+		Payload:   req,
+	})
+	obslog.Log(s.logger, "INFO", "api", "bus_message_posted",
+		obslog.F("request_id", requestIDFromRequest(r)),
+		obslog.F("correlation_id", requestIDFromRequest(r)),
+		obslog.F("project_id", projectID),
+		obslog.F("task_id", taskID),
+		obslog.F("to_run", msg.ToRun),
+		obslog.F("message_id", msgID),
+		obslog.F("message_type", msgType),
+		obslog.F("endpoint", endpoint),
+	)
+	return writeJSON(w, http.StatusCreated, PostMessageResponse{
+		MsgID:     msgID,
+		Timestamp: msg.Timestamp,
+	})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTaskInboxEndpoint(t *testing.T) {
+	server, root := newTestServer(t)
+	if err := os.MkdirAll(filepath.Join(root, "project", "task-20260101-000000-child"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	path := "/api/projects/project/tasks/task-20260101-000000-child/inbox"
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(query string) []MessageResponse {
+		t.Helper()
+		rec := do(http.MethodGet, path+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET inbox%s: %d %s", query, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Messages []MessageResponse `json:"messages"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Messages
+	}
+
+	rec := do(http.MethodPost, path, `{"body":"stop and rebase","from_task":"task-20260101-000000-parent","from_run":"run-p"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST inbox: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, path, `{"type":"INFO","body":"run 2 only","to_run":"run-2"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST inbox to_run: %d %s", rec.Code, rec.Body.String())
+	}
+
+	all := list("")
+	if len(all) != 2 || all[0].ToTask != "task-20260101-000000-child" || all[0].TaskID != "task-20260101-000000-parent" ||
+		all[0].RunID != "run-p" || all[0].Type != "USER" || all[1].ToRun != "run-2" {
+		t.Fatalf("inbox = %+v", all)
+	}
+	if got := list("?run_id=run-1"); len(got) != 1 || strings.TrimSpace(got[0].Body) != "stop and rebase" {
+		t.Fatalf("run-1 inbox = %+v", got)
+	}
+
+	// Acknowledging through the consumer API marks messages as seen.
+	ack := `{"msg_id":"` + all[0].MsgID + `"}`
+	if rec := do(http.MethodPost, "/api/projects/project/tasks/task-20260101-000000-child/messages/consumers/inbox/ack", ack); rec.Code != http.StatusOK {
+		t.Fatalf("ack: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := list("?unread=true"); len(got) != 1 || got[0].MsgID != all[1].MsgID {
+		t.Fatalf("unread inbox = %+v", got)
+	}
+
+	for _, tc := range []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodPost, path, `{"body":" "}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/projects/project/tasks/task-20260101-000000-missing/inbox", `{"body":"x"}`, http.StatusNotFound},
+		{http.MethodDelete, path, "", http.StatusMethodNotAllowed},
+	} {
+		if rec := do(tc.method, tc.target, tc.body); rec.Code != tc.want {
+			t.Errorf("%s %s = %d, want %d: %s", tc.method, tc.target, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/goaldecompose"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
+	"github.com/pkg/errors"
+)
+
+// PipelineResponse is returned when a pipeline is submitted.
+type PipelineResponse struct {
+	WorkflowID string               `json:"workflow_id"`
+	ProjectID  string               `json:"project_id"`
+	Status     string               `json:"status"`
+	StatePath  string               `json:"state_path"`
+	State      runner.PipelineState `json:"state"`
+}
+
+// handleProjectPipelines serves /api/projects/{p}/pipelines[/{workflow_id}].
+//
+// POST takes a workflow spec (JSON or YAML, as written by run-agent goal
+// decompose), materializes its tasks and runs them in the background. Query
+// parameters: resume, max_parallel and agent. GET lists the pipelines of the
+// project or returns the state of one.
+func (s *Server) handleProjectPipelines(w http.ResponseWriter, r *http.Request, projectID string, rest []string) *apiError {
+	if len(rest) == 1 {
+		if r.Method != http.MethodGet {
+			return apiErrorMethodNotAllowed()
+		}
+		state, err := runner.LoadPipelineState(s.rootDir, projectID, rest[0])
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				return apiErrorNotFound("pipeline not found")
+			}
+			return apiErrorBadRequest(err.Error())
+		}
+		return writeJSON(w, http.StatusOK, state)
+	}
+	if len(rest) > 1 {
+		return apiErrorNotFound("not found")
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return s.listProjectPipelines(w, projectID)
+	case http.MethodPost:
+		return s.submitPipeline(w, r, projectID)
+	default:
+		return apiErrorMethodNotAllowed()
+	}
+}
+
+func (s *Server) listProjectPipelines(w http.ResponseWriter, projectID string) *apiError {
+	entries, err := os.ReadDir(filepath.Join(s.rootDir, projectID, "pipelines"))
+	if err != nil && !os.IsNotExist(err) {
+		return apiErrorInternal("read pipelines", err)
+	}
+	pipelines := make([]*runner.PipelineState, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		state, err := runner.LoadPipelineState(s.rootDir, projectID, entry.Name())
+		if err != nil {
+			continue
+		}
+		pipelines = append(pipelines, state)
+	}
+	sort.Slice(pipelines, func(i, j int) bool {
+		return pipelines[i].CreatedAt.After(pipelines[j].CreatedAt)
+	})
+	return writeJSON(w, http.StatusOK, map[string]interface{}{"pipelines": pipelines})
+}
+
+func (s *Server) submitPipeline(w http.ResponseWriter, r *http.Request, projectID string) *apiError {
+	if s.startTasks {
+		s.rootRunGateMu.Lock()
+		blockedErr := s.taskCreateBlockedBySelfUpdateLocked()
+		s.rootRunGateMu.Unlock()
+		if blockedErr != nil {
+			return blockedErr
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxJSONBodySize))
+	if err != nil {
+		return apiErrorBadRequest("read request body")
+	}
+	spec, err := goaldecompose.DecodeSpec(data)
+	if err != nil {
+		return apiErrorBadRequest(err.Error())
+	}
+	if spec.ProjectID == "" {
+		spec.ProjectID = projectID
+	}
+	if spec.ProjectID != projectID {
+		return apiErrorBadRequest(fmt.Sprintf("spec project_id %q does not match %q", spec.ProjectID, projectID))
+	}
+
+	query := r.URL.Query()
+	opts := runner.PipelineOptions{
+		RootDir:      s.rootDir,
+		ConfigPath:   s.configPath,
+		Agent:        strings.TrimSpace(query.Get("agent")),
+		Resume:       parseActiveOnlyQuery(query.Get("resume")),
+		ConductorURL: s.conductorURL(),
+		TaskExecutor: s.runPipelineTask,
+	}
+	if raw := strings.TrimSpace(query.Get("max_parallel")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return apiErrorBadRequest("max_parallel must be a positive integer")
+		}
+		opts.MaxParallel = n
+	}
+
+	key := projectID + "/" + spec.WorkflowID
+	s.pipelinesMu.Lock()
+	if s.runningPipelines[key] {
+		s.pipelinesMu.Unlock()
+		return apiErrorConflict("pipeline is already running", map[string]string{"workflow_id": spec.WorkflowID})
+	}
+	pipeline, err := runner.PreparePipeline(spec, opts)
+	if err != nil {
+		s.pipelinesMu.Unlock()
+		return apiErrorBadRequest(err.Error())
+	}
+	status := "created"
+	if s.startTasks {
+		status = "started"
+		if s.runningPipelines == nil {
+			s.runningPipelines = make(map[string]bool)
+		}
+		s.runningPipelines[key] = true
+	}
+	s.pipelinesMu.Unlock()
+
+	// Snapshot before Run starts mutating the state in the background.
+	state := pipeline.State()
+	if s.startTasks {
+		s.taskWg.Add(1)
+		go func() {
+			defer s.taskWg.Done()
+			defer func() {
+				s.pipelinesMu.Lock()
+				delete(s.runningPipelines, key)
+				s.pipelinesMu.Unlock()
+			}()
+			if _, err := pipeline.Run(); err != nil {
+				obslog.Log(s.logger, "ERROR", "api", "pipeline_run_failed",
+					obslog.F("project_id", projectID),
+					obslog.F("workflow_id", spec.WorkflowID),
+					obslog.F("error", err),
+				)
+			}
+		}()
+	}
+	obslog.Log(s.logger, "INFO", "api", "pipeline_accepted",
+		obslog.F("project_id", projectID),
+		obslog.F("workflow_id", spec.WorkflowID),
+		obslog.F("tasks", len(spec.Tasks)),
+		obslog.F("task_start_enabled", s.startTasks),
+	)
+
+	return writeJSON(w, http.StatusAccepted, PipelineResponse{
+		WorkflowID: state.WorkflowID,
+		ProjectID:  projectID,
+		Status:     status,
+		StatePath:  pipeline.StatePath(),
+		State:      state,
+	})
+}
+
+// runPipelineTask admits a pipeline task like any other root run (self-update
+// gate, root task planner) and waits for the run to finish.
+func (s *Server) runPipelineTask(projectID, taskID string, opts runner.TaskOptions) error {
+	taskDir := filepath.Join(s.rootDir, projectID, taskID)
+	prompt, err := os.ReadFile(filepath.Join(taskDir, "TASK.md"))
+	if err != nil {
+		return errors.Wrap(err, "read TASK.md")
+	}
+	runsDir := filepath.Join(taskDir, "runs")
+	if err := os.MkdirAll(runsDir, 0o755); err != nil {
+		return errors.Wrap(err, "create runs directory")
+	}
+	runID, runDir, err := runner.AllocateRunDir(runsDir)
+	if err != nil {
+		return errors.Wrap(err, "allocate run directory")
+	}
+	done := make(chan error, 1)
+	s.pipelinesMu.Lock()
+	if s.pipelineRuns == nil {
+		s.pipelineRuns = make(map[string]chan error)
+	}
+	s.pipelineRuns[runID] = done
+	s.pipelinesMu.Unlock()
+
+	req := TaskCreateRequest{
+		ProjectID:   projectID,
+		TaskID:      taskID,
+		AgentType:   opts.Agent,
+		Prompt:      string(prompt),
+		ProjectRoot: opts.WorkingDir,
+		DependsOn:   opts.DependsOn,
+		AttachMode:  "create",
+	}
+	if _, _, apiErr := s.admitTaskRun(req, runID, runDir, string(prompt)); apiErr != nil {
+		s.pipelinesMu.Lock()
+		delete(s.pipelineRuns, runID)
+		s.pipelinesMu.Unlock()
+		return errors.New(apiErr.Message)
+	}
+	return <-done
+}
+
+// finishPipelineTaskRun reports the end of a root run to the pipeline that
+// admitted it, if any.
+func (s *Server) finishPipelineTaskRun(runID string, err error) {
+	s.pipelinesMu.Lock()
+	done, ok := s.pipelineRuns[runID]
+	delete(s.pipelineRuns, runID)
+	s.pipelinesMu.Unlock()
+	if ok {
+		done <- err
+	}
+}
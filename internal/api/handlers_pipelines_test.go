@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
+)
+
+const testPipelineSpecYAML = `workflow_id: workflow-api
+max_parallel: 2
+tasks:
+  - task_id: task-20260301-100000-plan
+    title: Plan
+    agent: claude
+  - task_id: task-20260301-100000-build
+    title: Build
+    agent: codex
+    depends_on: [task-20260301-100000-plan]
+`
+
+func TestProjectPipelines_SubmitAndGet(t *testing.T) {
+	server, root := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/projects/proj1/pipelines", strings.NewReader(testPipelineSpecYAML))
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp PipelineResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Status != "created" || resp.WorkflowID != "workflow-api" || len(resp.State.Tasks) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(root, "proj1", "task-20260301-100000-build", "TASK-CONFIG.yaml")); err != nil {
+		t.Fatalf("depends_on not written: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/projects/proj1/pipelines/workflow-api", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	var state runner.PipelineState
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &state) != nil || state.Status != runner.PipelineStatusPending {
+		t.Fatalf("get pipeline: %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/projects/proj1/pipelines", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"workflow_id":"workflow-api"`) {
+		t.Fatalf("list pipelines: %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/projects/proj1/pipelines/workflow-missing", nil)
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestProjectPipelines_SubmitRejectsInvalidSpec(t *testing.T) {
+	server, _ := newTestServer(t)
+	for name, body := range map[string]string{
+		"other project": "project_id: proj2\n" + testPipelineSpecYAML,
+		"no tasks":      "workflow_id: workflow-empty\n",
+		"not a spec":    "tasks: 3\n",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/projects/proj1/pipelines", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestPipelineTaskQueuesInRootTaskPlanner(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	server, root := newScheduleTestServer(t, &now, 1)
+	createTaskFixture(t, root, "other", "task-20260301-095900-busy")
+	busyRunDir := filepath.Join(root, "other", "task-20260301-095900-busy", "runs", "run-1")
+	if err := os.MkdirAll(busyRunDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if _, err := server.rootTaskPlanner.Submit(TaskCreateRequest{ProjectID: "other", TaskID: "task-20260301-095900-busy", AgentType: "claude", Prompt: "busy"}, busyRunDir, "busy\n"); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	server.startTasks = true
+
+	taskID := "task-20260301-100000-plan"
+	createTaskFixture(t, root, "proj1", taskID)
+	done := make(chan error, 1)
+	go func() {
+		done <- server.runPipelineTask("proj1", taskID, runner.TaskOptions{Agent: "claude"})
+	}()
+
+	var runID string
+	deadline := time.Now().Add(5 * time.Second)
+	for runID == "" {
+		task, err := getTaskWithQueue(root, "proj1", taskID, server.taskQueueSnapshot())
+		if err == nil && task.Status == "queued" {
+			server.pipelinesMu.Lock()
+			for id := range server.pipelineRuns {
+				runID = id
+			}
+			server.pipelinesMu.Unlock()
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pipeline task was not queued in the planner: %+v, %v", task, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("pipeline task returned while queued: %v", err)
+	default:
+	}
+
+	server.finishPipelineTaskRun(runID, errors.New("agent failed"))
+	if err := <-done; err == nil || err.Error() != "agent failed" {
+		t.Fatalf("runPipelineTask = %v, want the run error", err)
+	}
+}
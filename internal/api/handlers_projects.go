@@ -14,6 +14,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/jonnyzzz/conductor-loop/internal/changes"
 	"github.com/jonnyzzz/conductor-loop/internal/obslog"
 	"github.com/jonnyzzz/conductor-loop/internal/runner"
 	"github.com/jonnyzzz/conductor-loop/internal/runstate"
@@ -209,7 +210,7 @@ func (s *Server) handleProjectsRouter(w http.ResponseWriter, r *http.Request) *a
 		}
 		return s.handleProjectTask(w, r)
 	}
-	// /api/projects/{id}/messages[/stream]
+	// /api/projects/{id}/messages[/stream|/export]
 	if parts[1] == "messages" {
 		if len(parts) == 2 {
 			return s.handleProjectMessages(w, r)
@@ -217,6 +218,25 @@ func (s *Server) handleProjectsRouter(w http.ResponseWriter, r *http.Request) *a
 		if len(parts) == 3 && parts[2] == "stream" {
 			return s.handleProjectMessagesStream(w, r)
 		}
+		if len(parts) == 3 && parts[2] == "export" {
+			return s.handleBusExport(w, r, projectID, "")
+		}
+		// /api/projects/{id}/messages/consumers[/...]
+		if parts[2] == "consumers" {
+			busPath, apiErr := s.projectBusPath(projectID)
+			if apiErr != nil {
+				return apiErr
+			}
+			return s.handleBusConsumers(w, r, busPath, parts[3:])
+		}
+	}
+	// /api/projects/{id}/pipelines[/{workflow_id}]
+	if parts[1] == "pipelines" {
+		return s.handleProjectPipelines(w, r, projectID, parts[2:])
+	}
+	// /api/projects/{id}/schedules[/{schedule_id}]
+	if parts[1] == "schedules" {
+		return s.handleProjectSchedules(w, r, projectID, parts[2:])
 	}
 	// /api/projects/{id}/gc
 	if parts[1] == "gc" {
@@ -1217,9 +1237,9 @@ func (s *Server) handleProjectTasks(w http.ResponseWriter, r *http.Request) *api
 // and GET /api/projects/{projectId}/tasks/{taskId}/runs/{runId}/file
 // and POST /api/projects/{projectId}/tasks/{taskId}/runs/{runId}/stop
 func (s *Server) handleProjectTask(w http.ResponseWriter, r *http.Request) *apiError {
-	// /api/projects/{projectId}/tasks/{taskId}[/runs/{runId}[/file|stream|stop]]
+	// /api/projects/{projectId}/tasks/{taskId}[/runs/{runId}[/file|stream|stop|transcript[/stream]]]
 	parts := splitPath(r.URL.Path, "/api/projects/")
-	// parts[0]=projectId, parts[1]="tasks", parts[2]=taskId, parts[3]="runs", parts[4]=runId, parts[5]="file|stream|stop"
+	// parts[0]=projectId, parts[1]="tasks", parts[2]=taskId, parts[3]="runs", parts[4]=runId, parts[5]="file|stream|stop|changes|transcript"
 	if len(parts) < 3 || parts[1] != "tasks" {
 		return apiErrorNotFound("not found")
 	}
@@ -1246,7 +1266,12 @@ func (s *Server) handleProjectTask(w http.ResponseWriter, r *http.Request) *apiE
 		return s.serveTaskFile(w, r, projectID, taskID)
 	}
 
-	// task-scoped message bus: /api/projects/{p}/tasks/{t}/messages[/stream]
+	// task inbox (directed messages): /api/projects/{p}/tasks/{t}/inbox
+	if len(parts) == 4 && parts[3] == "inbox" {
+		return s.handleTaskInbox(w, r, projectID, taskID)
+	}
+
+	// task-scoped message bus: /api/projects/{p}/tasks/{t}/messages[/stream|/export|/consumers/...]
 	if len(parts) >= 4 && parts[3] == "messages" {
 		if len(parts) == 4 {
 			return s.handleTaskMessages(w, r, projectID, taskID)
@@ -1254,6 +1279,16 @@ func (s *Server) handleProjectTask(w http.ResponseWriter, r *http.Request) *apiE
 		if len(parts) == 5 && parts[4] == "stream" {
 			return s.handleTaskMessagesStream(w, r, projectID, taskID)
 		}
+		if len(parts) == 5 && parts[4] == "export" {
+			return s.handleBusExport(w, r, projectID, taskID)
+		}
+		if parts[4] == "consumers" {
+			busPath, apiErr := s.taskBusPath(projectID, taskID)
+			if apiErr != nil {
+				return apiErr
+			}
+			return s.handleBusConsumers(w, r, busPath, parts[5:])
+		}
 		return apiErrorNotFound("not found")
 	}
 
@@ -1312,6 +1347,17 @@ func (s *Server) handleProjectTask(w http.ResponseWriter, r *http.Request) *apiE
 		if len(parts) >= 6 && parts[5] == "stream" {
 			return s.serveRunFileStream(w, r, found)
 		}
+		// changes endpoint
+		if len(parts) == 6 && parts[5] == "changes" {
+			return s.serveRunChanges(w, r, found)
+		}
+		// transcript endpoints
+		if len(parts) == 6 && parts[5] == "transcript" {
+			return s.serveRunTranscript(w, r, found)
+		}
+		if len(parts) == 7 && parts[5] == "transcript" && parts[6] == "stream" {
+			return s.streamRunTranscript(w, r, found)
+		}
 		// run info
 		return writeJSON(w, http.StatusOK, runInfoToProjectRun(found, true))
 	}
@@ -1754,6 +1800,10 @@ func (s *Server) serveRunFile(w http.ResponseWriter, r *http.Request, run *stora
 		} else if run.StdoutPath != "" {
 			filePath = filepath.Join(filepath.Dir(run.StdoutPath), "output.md")
 		}
+	case changes.FileName, changes.PatchFileName:
+		if run.StdoutPath != "" {
+			filePath = filepath.Join(filepath.Dir(run.StdoutPath), name)
+		}
 	default:
 		return apiErrorNotFound("unknown file: " + name)
 	}
@@ -2223,6 +2273,12 @@ func buildRunFiles(info *storage.RunInfo) []RunFile {
 			files = append(files, RunFile{Name: "prompt", Label: "prompt", Size: fi.Size()})
 		}
 	}
+	if info.StdoutPath != "" {
+		runDir := filepath.Dir(info.StdoutPath)
+		if fi, err := os.Stat(filepath.Join(runDir, changes.PatchFileName)); err == nil {
+			files = append(files, RunFile{Name: changes.PatchFileName, Label: "changes", Size: fi.Size()})
+		}
+	}
 	return files
 }
 
@@ -2563,10 +2619,23 @@ type projectStats struct {
 	CrashedRuns          int    `json:"crashed_runs"`
 	MessageBusFiles      int    `json:"message_bus_files"`
 	MessageBusTotalBytes int64  `json:"message_bus_total_bytes"`
+
+	// Usage totals token and cost accounting across all runs of the project.
+	Usage storage.UsageTotals `json:"usage"`
+	// TaskUsage lists per-task usage for tasks with recorded usage, most
+	// expensive first.
+	TaskUsage []taskUsageStats `json:"task_usage,omitempty"`
+}
+
+// taskUsageStats holds the usage rollup for a single task.
+type taskUsageStats struct {
+	TaskID string              `json:"task_id"`
+	Usage  storage.UsageTotals `json:"usage"`
 }
 
 // handleProjectStats serves GET /api/projects/{p}/stats.
-// It walks the project directory and returns run/task/bus counts.
+// It walks the project directory and returns run/task/bus counts and
+// token/cost usage rolled up per task and project.
 func (s *Server) handleProjectStats(w http.ResponseWriter, r *http.Request) *apiError {
 	if r.Method != http.MethodGet {
 		return apiErrorMethodNotAllowed()
@@ -2632,6 +2701,7 @@ func (s *Server) handleProjectStats(w http.ResponseWriter, r *http.Request) *api
 		if err != nil {
 			continue // no runs directory or unreadable
 		}
+		taskUsage := taskUsageStats{TaskID: name}
 		for _, runEntry := range runEntries {
 			if !runEntry.IsDir() {
 				continue
@@ -2642,6 +2712,7 @@ func (s *Server) handleProjectStats(w http.ResponseWriter, r *http.Request) *api
 			if err != nil || !present {
 				continue
 			}
+			taskUsage.Usage.AddRun(runInfo)
 			switch runInfo.Status {
 			case storage.StatusRunning:
 				stats.RunningRuns++
@@ -2653,11 +2724,30 @@ func (s *Server) handleProjectStats(w http.ResponseWriter, r *http.Request) *api
 				stats.CrashedRuns++
 			}
 		}
+		stats.Usage.Merge(taskUsage.Usage)
+		if taskUsage.Usage.RunsWithUsage > 0 {
+			stats.TaskUsage = append(stats.TaskUsage, taskUsage)
+		}
 	}
+	sortTaskUsage(stats.TaskUsage)
 
 	return writeJSON(w, http.StatusOK, stats)
 }
 
+// sortTaskUsage orders tasks by cost, then total tokens, most expensive first.
+func sortTaskUsage(tasks []taskUsageStats) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i].Usage, tasks[j].Usage
+		if a.CostUSD != b.CostUSD {
+			return a.CostUSD > b.CostUSD
+		}
+		if a.TotalTokens != b.TotalTokens {
+			return a.TotalTokens > b.TotalTokens
+		}
+		return tasks[i].TaskID < tasks[j].TaskID
+	})
+}
+
 // dirExists reports whether path exists and is a directory.
 func dirExists(path string) bool {
 	fi, err := os.Stat(path)
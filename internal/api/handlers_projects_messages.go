@@ -10,6 +10,7 @@ import (
 
 	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
 )
 
 // projectPostRequest is the request body for posting a message via project/task APIs.
@@ -37,6 +38,15 @@ func parseMessageListLimit(raw string) int {
 	return limit
 }
 
+// parseMessageFilter parses the where= query parameter of message endpoints.
+func parseMessageFilter(r *http.Request) (*messagebus.Filter, *apiError) {
+	filter, err := messagebus.ParseFilter(r.URL.Query().Get("where"))
+	if err != nil {
+		return nil, apiErrorBadRequest(err.Error())
+	}
+	return filter, nil
+}
+
 func sliceMessagesAfterSince(messages []*messagebus.Message, sinceID string) ([]*messagebus.Message, bool) {
 	for i, msg := range messages {
 		if msg == nil || msg.MsgID != sinceID {
@@ -50,31 +60,60 @@ func sliceMessagesAfterSince(messages []*messagebus.Message, sinceID string) ([]
 	return nil, false
 }
 
-// handleProjectMessages handles GET and POST for /api/projects/{p}/messages.
-func (s *Server) handleProjectMessages(w http.ResponseWriter, r *http.Request) *apiError {
-	parts := splitPath(r.URL.Path, "/api/projects/")
-	if len(parts) < 2 || parts[1] != "messages" {
-		return apiErrorNotFound("not found")
-	}
-	projectID := parts[0]
-	if err := validateIdentifier(projectID, "project_id"); err != nil {
-		return err
-	}
+// projectBusPath returns the PROJECT-MESSAGE-BUS.md path of projectID.
+func (s *Server) projectBusPath(projectID string) (string, *apiError) {
 	projectDir, ok := findProjectDir(s.rootDir, projectID)
 	if !ok {
 		var pathErr *apiError
 		projectDir, pathErr = joinPathWithinRoot(s.rootDir, projectID)
 		if pathErr != nil {
-			return pathErr
+			return "", pathErr
 		}
 	}
 	if err := requirePathWithinRoot(s.rootDir, projectDir, "project path"); err != nil {
-		return err
+		return "", err
 	}
 	busPath := filepath.Join(projectDir, "PROJECT-MESSAGE-BUS.md")
 	if err := requirePathWithinRoot(s.rootDir, busPath, "message bus path"); err != nil {
+		return "", err
+	}
+	return busPath, nil
+}
+
+// taskBusPath returns the TASK-MESSAGE-BUS.md path of projectID/taskID.
+func (s *Server) taskBusPath(projectID, taskID string) (string, *apiError) {
+	taskDir, ok := findProjectTaskDir(s.rootDir, projectID, taskID)
+	if !ok {
+		var pathErr *apiError
+		taskDir, pathErr = joinPathWithinRoot(s.rootDir, projectID, taskID)
+		if pathErr != nil {
+			return "", pathErr
+		}
+	}
+	if err := requirePathWithinRoot(s.rootDir, taskDir, "task path"); err != nil {
+		return "", err
+	}
+	busPath := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
+	if err := requirePathWithinRoot(s.rootDir, busPath, "message bus path"); err != nil {
+		return "", err
+	}
+	return busPath, nil
+}
+
+// handleProjectMessages handles GET and POST for /api/projects/{p}/messages.
+func (s *Server) handleProjectMessages(w http.ResponseWriter, r *http.Request) *apiError {
+	parts := splitPath(r.URL.Path, "/api/projects/")
+	if len(parts) < 2 || parts[1] != "messages" {
+		return apiErrorNotFound("not found")
+	}
+	projectID := parts[0]
+	if err := validateIdentifier(projectID, "project_id"); err != nil {
 		return err
 	}
+	busPath, apiErr := s.projectBusPath(projectID)
+	if apiErr != nil {
+		return apiErr
+	}
 	switch r.Method {
 	case http.MethodGet:
 		return s.listBusMessages(w, r, busPath)
@@ -98,20 +137,9 @@ func (s *Server) handleProjectMessagesStream(w http.ResponseWriter, r *http.Requ
 	if err := validateIdentifier(projectID, "project_id"); err != nil {
 		return err
 	}
-	projectDir, ok := findProjectDir(s.rootDir, projectID)
-	if !ok {
-		var pathErr *apiError
-		projectDir, pathErr = joinPathWithinRoot(s.rootDir, projectID)
-		if pathErr != nil {
-			return pathErr
-		}
-	}
-	if err := requirePathWithinRoot(s.rootDir, projectDir, "project path"); err != nil {
-		return err
-	}
-	busPath := filepath.Join(projectDir, "PROJECT-MESSAGE-BUS.md")
-	if err := requirePathWithinRoot(s.rootDir, busPath, "message bus path"); err != nil {
-		return err
+	busPath, apiErr := s.projectBusPath(projectID)
+	if apiErr != nil {
+		return apiErr
 	}
 	return s.streamMessageBusPath(w, r, busPath)
 }
@@ -124,20 +152,9 @@ func (s *Server) handleTaskMessages(w http.ResponseWriter, r *http.Request, proj
 	if err := validateIdentifier(taskID, "task_id"); err != nil {
 		return err
 	}
-	taskDir, ok := findProjectTaskDir(s.rootDir, projectID, taskID)
-	if !ok {
-		var pathErr *apiError
-		taskDir, pathErr = joinPathWithinRoot(s.rootDir, projectID, taskID)
-		if pathErr != nil {
-			return pathErr
-		}
-	}
-	if err := requirePathWithinRoot(s.rootDir, taskDir, "task path"); err != nil {
-		return err
-	}
-	busPath := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
-	if err := requirePathWithinRoot(s.rootDir, busPath, "message bus path"); err != nil {
-		return err
+	busPath, apiErr := s.taskBusPath(projectID, taskID)
+	if apiErr != nil {
+		return apiErr
 	}
 	switch r.Method {
 	case http.MethodGet:
@@ -160,20 +177,9 @@ func (s *Server) handleTaskMessagesStream(w http.ResponseWriter, r *http.Request
 	if err := validateIdentifier(taskID, "task_id"); err != nil {
 		return err
 	}
-	taskDir, ok := findProjectTaskDir(s.rootDir, projectID, taskID)
-	if !ok {
-		var pathErr *apiError
-		taskDir, pathErr = joinPathWithinRoot(s.rootDir, projectID, taskID)
-		if pathErr != nil {
-			return pathErr
-		}
-	}
-	if err := requirePathWithinRoot(s.rootDir, taskDir, "task path"); err != nil {
-		return err
-	}
-	busPath := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
-	if err := requirePathWithinRoot(s.rootDir, busPath, "message bus path"); err != nil {
-		return err
+	busPath, apiErr := s.taskBusPath(projectID, taskID)
+	if apiErr != nil {
+		return apiErr
 	}
 	return s.streamMessageBusPath(w, r, busPath)
 }
@@ -182,12 +188,24 @@ func (s *Server) handleTaskMessagesStream(w http.ResponseWriter, r *http.Request
 func (s *Server) listBusMessages(w http.ResponseWriter, r *http.Request, busPath string) *apiError {
 	since := strings.TrimSpace(r.URL.Query().Get("since"))
 	limit := parseMessageListLimit(r.URL.Query().Get("limit"))
-	bus, err := messagebus.NewMessageBus(busPath)
+	filter, apiErr := parseMessageFilter(r)
+	if apiErr != nil {
+		return apiErr
+	}
+	bus, err := messagebus.Open(busPath, "")
 	if err != nil {
 		return apiErrorInternal("open message bus", err)
 	}
+	defer bus.Close()
 	var messages []*messagebus.Message
-	if since == "" && limit > 0 {
+	if filter != nil {
+		// limit counts matching messages, so it cannot bound the read.
+		if since == "" {
+			messages, err = bus.ReadMessagesWhere(filter, limit)
+		} else if messages, err = bus.ReadMessages(since); err == nil {
+			messages = messagebus.FilterMessages(messages, filter)
+		}
+	} else if since == "" && limit > 0 {
 		messages, err = bus.ReadLastN(limit)
 	} else if since != "" && limit > 0 {
 		tailWindow := limit * sinceTailWindowMultiplier
@@ -214,6 +232,11 @@ func (s *Server) listBusMessages(w http.ResponseWriter, r *http.Request, busPath
 		}
 		return apiErrorInternal("read message bus", err)
 	}
+	return writeJSON(w, http.StatusOK, map[string]interface{}{"messages": messageResponses(messages)})
+}
+
+// messageResponses converts bus messages to their API representation.
+func messageResponses(messages []*messagebus.Message) []MessageResponse {
 	resp := make([]MessageResponse, 0, len(messages))
 	for _, msg := range messages {
 		if msg == nil {
@@ -227,13 +250,34 @@ func (s *Server) listBusMessages(w http.ResponseWriter, r *http.Request, busPath
 			TaskID:    msg.TaskID,
 			RunID:     msg.RunID,
 			IssueID:   msg.IssueID,
+			ToTask:    msg.ToTask,
+			ToRun:     msg.ToRun,
 			Parents:   msg.Parents,
 			Links:     msg.Links,
 			Meta:      msg.Meta,
 			Body:      msg.Body,
 		})
 	}
-	return writeJSON(w, http.StatusOK, map[string]interface{}{"messages": resp})
+	return resp
+}
+
+// appendMessageError maps an AppendMessage failure to an API error:
+// messages rejected by strict schema validation are bad requests.
+func appendMessageError(err error) *apiError {
+	if stderrors.Is(err, messagebus.ErrInvalidMessage) {
+		return apiErrorBadRequest(err.Error())
+	}
+	return apiErrorInternal("append message", err)
+}
+
+// openWriteBus opens a bus the server appends to. The message_bus config of
+// the server is stored next to the bus first, so its validation applies
+// before any run of the task stored it.
+func (s *Server) openWriteBus(busPath string) (messagebus.Bus, error) {
+	if s.busConfig != nil {
+		runner.SyncBusSchemaPolicy(*s.busConfig, busPath)
+	}
+	return messagebus.Open(busPath, "")
 }
 
 // postBusMessage appends a message to a bus file.
@@ -251,10 +295,11 @@ func (s *Server) postBusMessage(w http.ResponseWriter, r *http.Request, projectI
 	if err := os.MkdirAll(filepath.Dir(busPath), 0o755); err != nil {
 		return apiErrorInternal("create message bus directory", err)
 	}
-	bus, err := messagebus.NewMessageBus(busPath)
+	bus, err := s.openWriteBus(busPath)
 	if err != nil {
 		return apiErrorInternal("open message bus", err)
 	}
+	defer bus.Close()
 	msgType := strings.TrimSpace(req.Type)
 	if msgType == "" {
 		msgType = "USER"
@@ -267,7 +312,7 @@ func (s *Server) postBusMessage(w http.ResponseWriter, r *http.Request, projectI
 	}
 	msgID, err := bus.AppendMessage(msg)
 	if err != nil {
-		return apiErrorInternal("append message", err)
+		return appendMessageError(err)
 	}
 	endpoint := "POST /api/projects/{project_id}/messages"
 	if strings.TrimSpace(taskID) != "" {
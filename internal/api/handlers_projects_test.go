@@ -7,12 +7,15 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 	"github.com/jonnyzzz/conductor-loop/internal/storage"
 	"github.com/jonnyzzz/conductor-loop/internal/taskdeps"
 )
@@ -1805,6 +1808,55 @@ func TestProjectMessages_ListLimitReturnsLatestMessages(t *testing.T) {
 	}
 }
 
+func TestProjectMessages_ListWhere(t *testing.T) {
+	root := t.TempDir()
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	for _, m := range []struct{ typ, body string }{
+		{"FACT", "f-1"}, {"PROGRESS", "p-1"}, {"FACT", "f-2"}, {"ERROR", "e-1"}, {"FACT", "f-3"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/projects/proj1/messages",
+			strings.NewReader(`{"type":"`+m.typ+`","body":"`+m.body+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("post message: expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	list := func(query string) (int, []string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/projects/proj1/messages?"+query, nil))
+		var resp struct {
+			Messages []struct {
+				Body string `json:"body"`
+			} `json:"messages"`
+		}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		bodies := make([]string, 0, len(resp.Messages))
+		for _, m := range resp.Messages {
+			bodies = append(bodies, strings.TrimSpace(m.Body))
+		}
+		return rec.Code, bodies
+	}
+
+	code, bodies := list("where=" + url.QueryEscape("type in (fact, error) and body != f-1") + "&limit=2")
+	if code != http.StatusOK || strings.Join(bodies, ",") != "e-1,f-3" {
+		t.Fatalf("where+limit: %d %v", code, bodies)
+	}
+	code, bodies = list("where=" + url.QueryEscape("type = PROGRESS"))
+	if code != http.StatusOK || strings.Join(bodies, ",") != "p-1" {
+		t.Fatalf("where: %d %v", code, bodies)
+	}
+	if code, _ = list("where=" + url.QueryEscape("colour = red")); code != http.StatusBadRequest {
+		t.Fatalf("invalid where: expected 400, got %d", code)
+	}
+}
+
 func TestProjectMessages_Post(t *testing.T) {
 	root := t.TempDir()
 	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
@@ -1880,6 +1932,62 @@ func TestProjectMessages_PostEmptyBody(t *testing.T) {
 	}
 }
 
+func TestProjectMessages_PostRejectedByStrictSchema(t *testing.T) {
+	root := t.TempDir()
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "proj1"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	busPath := filepath.Join(root, "proj1", "PROJECT-MESSAGE-BUS.md")
+	if err := messagebus.WriteSchemaPolicy(busPath, messagebus.SchemaPolicy{Mode: messagebus.ValidationStrict}); err != nil {
+		t.Fatalf("WriteSchemaPolicy: %v", err)
+	}
+
+	body := strings.NewReader(`{"type":"DECISIONS","body":"made up type"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/projects/proj1/messages", body)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unknown message type") {
+		t.Fatalf("expected 400 for an unknown type, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProjectMessages_PostAppliesConfigValidation(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "proj1"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	post := func(validation string) *httptest.ResponseRecorder {
+		server, err := NewServer(Options{
+			RootDir:          root,
+			DisableTaskStart: true,
+			MessageBus:       &config.MessageBusConfig{Validation: validation},
+		})
+		if err != nil {
+			t.Fatalf("NewServer: %v", err)
+		}
+		body := strings.NewReader(`{"type":"DECISIONS","body":"made up type"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/projects/proj1/messages", body)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// No run stored the policy next to the bus; the server config applies.
+	if rec := post(messagebus.ValidationStrict); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 with strict config, got %d: %s", rec.Code, rec.Body.String())
+	}
+	// Validation turned off in the config drops the stored strict policy.
+	if rec := post(messagebus.ValidationOff); rec.Code >= 300 {
+		t.Fatalf("expected success with validation off, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
 func TestProjectMessages_MethodNotAllowed(t *testing.T) {
 	root := t.TempDir()
 	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
@@ -2145,6 +2253,59 @@ func TestProjectStats_WithTasksAndRuns(t *testing.T) {
 	checkInt("message_bus_files", 2)
 }
 
+func TestProjectStats_UsageRollup(t *testing.T) {
+	root := t.TempDir()
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	projectID := "usage-project"
+
+	withUsage := func(taskID, runID string, usage storage.Usage) {
+		t.Helper()
+		info := makeProjectRun(t, root, projectID, taskID, runID, storage.StatusCompleted, "ok")
+		info.Usage = &usage
+		path := filepath.Join(root, projectID, taskID, "runs", runID, "run-info.yaml")
+		if err := storage.WriteRunInfo(path, info); err != nil {
+			t.Fatalf("write run-info: %v", err)
+		}
+	}
+	withUsage("task-20260101-120000-cheap", "run-1", storage.Usage{InputTokens: 100, OutputTokens: 10, CostUSD: 0.01})
+	withUsage("task-20260101-130000-pricey", "run-1", storage.Usage{InputTokens: 1000, OutputTokens: 200, CachedInputTokens: 500, CostUSD: 0.5})
+	withUsage("task-20260101-130000-pricey", "run-2", storage.Usage{InputTokens: 2000, OutputTokens: 100, CostUSD: 0.25})
+	makeProjectRun(t, root, projectID, "task-20260101-140000-nousage", "run-1", storage.StatusCompleted, "ok")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/projects/"+projectID+"/stats", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp projectStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if resp.Usage.Runs != 4 || resp.Usage.RunsWithUsage != 3 {
+		t.Fatalf("unexpected run counts: %+v", resp.Usage)
+	}
+	if resp.Usage.InputTokens != 3100 || resp.Usage.OutputTokens != 310 || resp.Usage.CachedInputTokens != 500 {
+		t.Fatalf("unexpected token totals: %+v", resp.Usage)
+	}
+	if resp.Usage.TotalTokens != 3410 {
+		t.Fatalf("total_tokens=%d, want 3410", resp.Usage.TotalTokens)
+	}
+	if len(resp.TaskUsage) != 2 {
+		t.Fatalf("expected 2 tasks with usage, got %d", len(resp.TaskUsage))
+	}
+	if resp.TaskUsage[0].TaskID != "task-20260101-130000-pricey" {
+		t.Fatalf("expected most expensive task first, got %s", resp.TaskUsage[0].TaskID)
+	}
+	if got := resp.TaskUsage[0].Usage.CostUSD; got < 0.7499 || got > 0.7501 {
+		t.Fatalf("pricey task cost=%v, want 0.75", got)
+	}
+}
+
 func TestProjectStats_EmptyProject(t *testing.T) {
 	root := t.TempDir()
 	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+)
+
+const (
+	questionStatusOpen     = "open"
+	questionStatusAnswered = "answered"
+	questionStatusAll      = "all"
+)
+
+// QuestionResponse is a QUESTION message with its answer, if any.
+type QuestionResponse struct {
+	MessageResponse
+	Status string           `json:"status"`
+	Answer *MessageResponse `json:"answer,omitempty"`
+}
+
+// answerQuestionRequest is the request body of POST /api/v1/questions/{msg_id}/answer.
+type answerQuestionRequest struct {
+	ProjectID string `json:"project_id"`
+	TaskID    string `json:"task_id,omitempty"`
+	Body      string `json:"body"`
+}
+
+// handleQuestions serves GET /api/v1/questions: the QUESTION messages of
+// every project and task bus, oldest first. It accepts project_id= and
+// status=open|answered|all (default open).
+func (s *Server) handleQuestions(w http.ResponseWriter, r *http.Request) *apiError {
+	if r.Method != http.MethodGet {
+		return apiErrorMethodNotAllowed()
+	}
+	projectID := strings.TrimSpace(r.URL.Query().Get("project_id"))
+	if projectID != "" {
+		if err := validateIdentifier(projectID, "project_id"); err != nil {
+			return err
+		}
+	}
+	status := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("status")))
+	switch status {
+	case "":
+		status = questionStatusOpen
+	case questionStatusOpen, questionStatusAnswered, questionStatusAll:
+	default:
+		return apiErrorBadRequest("status must be open, answered or all")
+	}
+
+	questions := make([]QuestionResponse, 0)
+	for _, busPath := range questionBusPaths(s.rootDir, projectID) {
+		bus, err := messagebus.Open(busPath, "")
+		if err != nil {
+			return apiErrorInternal("open message bus", err)
+		}
+		messages, err := bus.ReadMessagesByType(0, messagebus.TypeQuestion, messagebus.TypeAnswer)
+		bus.Close()
+		if err != nil {
+			return apiErrorInternal("read message bus", err)
+		}
+		for _, msg := range messages {
+			if !strings.EqualFold(msg.Type, messagebus.TypeQuestion) {
+				continue
+			}
+			question := QuestionResponse{MessageResponse: messageResponses([]*messagebus.Message{msg})[0], Status: questionStatusOpen}
+			if answer := messagebus.FindAnswer(messages, msg.MsgID); answer != nil {
+				question.Status = questionStatusAnswered
+				question.Answer = &messageResponses([]*messagebus.Message{answer})[0]
+			}
+			if status == questionStatusAll || status == question.Status {
+				questions = append(questions, question)
+			}
+		}
+	}
+	sort.SliceStable(questions, func(i, j int) bool {
+		return questions[i].Timestamp.Before(questions[j].Timestamp)
+	})
+	return writeJSON(w, http.StatusOK, map[string]interface{}{"questions": questions})
+}
+
+// questionBusPaths lists the project and task buses under rootDir, limited
+// to projectID when it is set.
+func questionBusPaths(rootDir, projectID string) []string {
+	var projectDirs []string
+	if projectID != "" {
+		if dir, ok := findProjectDir(rootDir, projectID); ok {
+			projectDirs = append(projectDirs, dir)
+		}
+	} else {
+		entries, err := os.ReadDir(rootDir)
+		if err != nil {
+			return nil
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				projectDirs = append(projectDirs, filepath.Join(rootDir, entry.Name()))
+			}
+		}
+	}
+	var paths []string
+	for _, projectDir := range projectDirs {
+		if busPath := filepath.Join(projectDir, "PROJECT-MESSAGE-BUS.md"); busFileExists(busPath) {
+			paths = append(paths, busPath)
+		}
+		entries, err := os.ReadDir(projectDir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			if busPath := filepath.Join(projectDir, entry.Name(), "TASK-MESSAGE-BUS.md"); busFileExists(busPath) {
+				paths = append(paths, busPath)
+			}
+		}
+	}
+	return paths
+}
+
+func busFileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// handleQuestionByID serves POST /api/v1/questions/{msg_id}/answer.
+func (s *Server) handleQuestionByID(w http.ResponseWriter, r *http.Request) *apiError {
+	parts := splitPath(r.URL.Path, "/api/v1/questions/")
+	if len(parts) != 2 || parts[1] != "answer" {
+		return apiErrorNotFound("not found")
+	}
+	if r.Method != http.MethodPost {
+		return apiErrorMethodNotAllowed()
+	}
+	questionID := parts[0]
+	var req answerQuestionRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		return apiErrorBadRequest("body is required")
+	}
+	projectID := strings.TrimSpace(req.ProjectID)
+	if err := validateIdentifier(projectID, "project_id"); err != nil {
+		return err
+	}
+	taskID := strings.TrimSpace(req.TaskID)
+	var (
+		busPath string
+		apiErr  *apiError
+	)
+	if taskID != "" {
+		if err := validateIdentifier(taskID, "task_id"); err != nil {
+			return err
+		}
+		busPath, apiErr = s.taskBusPath(projectID, taskID)
+	} else {
+		busPath, apiErr = s.projectBusPath(projectID)
+	}
+	if apiErr != nil {
+		return apiErr
+	}
+	bus, err := s.openWriteBus(busPath)
+	if err != nil {
+		return apiErrorInternal("open message bus", err)
+	}
+	defer bus.Close()
+	messages, err := bus.ReadMessagesByType(0, messagebus.TypeQuestion, messagebus.TypeAnswer)
+	if err != nil {
+		return apiErrorInternal("read message bus", err)
+	}
+	var question *messagebus.Message
+	for _, msg := range messages {
+		if msg.MsgID == questionID && strings.EqualFold(msg.Type, messagebus.TypeQuestion) {
+			question = msg
+			break
+		}
+	}
+	if question == nil {
+		return apiErrorNotFound("question not found")
+	}
+	if answer := messagebus.FindAnswer(messages, questionID); answer != nil {
+		return apiErrorConflict("question already answered", map[string]string{"answer_msg_id": answer.MsgID})
+	}
+
+	answer := messagebus.NewAnswer(question, req.Body)
+	msgID, err := bus.AppendMessage(answer)
+	if err != nil {
+		return appendMessageError(err)
+	}
+	const endpoint = "POST /api/v1/questions/{msg_id}/answer"
+	s.writeFormSubmissionAudit(r, formSubmissionAuditArgs{
+		Endpoint:  endpoint,
+		ProjectID: projectID,
+		TaskID:    taskID,
+		MessageID: msgID,
+		Payload:   req,
+	})
+	obslog.Log(s.logger, "INFO", "api", "question_answered",
+		obslog.F("request_id", requestIDFromRequest(r)),
+		obslog.F("correlation_id", requestIDFromRequest(r)),
+		obslog.F("project_id", projectID),
+		obslog.F("task_id", taskID),
+		obslog.F("question_id", questionID),
+		obslog.F("message_id", msgID),
+		obslog.F("endpoint", endpoint),
+	)
+	return writeJSON(w, http.StatusCreated, PostMessageResponse{
+		MsgID:     msgID,
+		Timestamp: answer.Timestamp,
+	})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+)
+
+func TestQuestionsEndpoints(t *testing.T) {
+	server, root := newTestServer(t)
+	taskDir := filepath.Join(root, "project", "task-20260101-000000-ask")
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	bus, err := messagebus.NewMessageBus(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	question := &messagebus.Message{Type: messagebus.TypeQuestion, ProjectID: "project", TaskID: "task-20260101-000000-ask", RunID: "run-1", Body: "deploy?"}
+	if _, err := bus.AppendMessage(question); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	if _, err := bus.AppendMessage(&messagebus.Message{Type: "INFO", ProjectID: "project", Body: "noise"}); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(query string) []QuestionResponse {
+		t.Helper()
+		rec := do(http.MethodGet, "/api/v1/questions"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET questions%s: %d %s", query, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Questions []QuestionResponse `json:"questions"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Questions
+	}
+
+	if got := list(""); len(got) != 1 || got[0].MsgID != question.MsgID || got[0].Status != "open" || got[0].RunID != "run-1" {
+		t.Fatalf("open questions = %+v", got)
+	}
+	if got := list("?project_id=other"); len(got) != 0 {
+		t.Fatalf("other project questions = %+v", got)
+	}
+
+	answerPath := "/api/v1/questions/" + question.MsgID + "/answer"
+	answerBody := `{"project_id":"project","task_id":"task-20260101-000000-ask","body":"yes"}`
+	if rec := do(http.MethodPost, answerPath, answerBody); rec.Code != http.StatusCreated {
+		t.Fatalf("POST answer: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := list(""); len(got) != 0 {
+		t.Fatalf("open questions after answer = %+v", got)
+	}
+	got := list("?status=answered")
+	if len(got) != 1 || got[0].Answer == nil || strings.TrimSpace(got[0].Answer.Body) != "yes" || got[0].Answer.ToRun != "run-1" {
+		t.Fatalf("answered questions = %+v", got)
+	}
+
+	for _, tc := range []struct {
+		method, target, body string
+		want                 int
+	}{
+		{http.MethodPost, answerPath, answerBody, http.StatusConflict},
+		{http.MethodPost, "/api/v1/questions/MSG-missing/answer", answerBody, http.StatusNotFound},
+		{http.MethodPost, answerPath, `{"project_id":"project","body":" "}`, http.StatusBadRequest},
+		{http.MethodGet, answerPath, "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/questions?status=bogus", "", http.StatusBadRequest},
+	} {
+		if rec := do(tc.method, tc.target, tc.body); rec.Code != tc.want {
+			t.Errorf("%s %s = %d, want %d: %s", tc.method, tc.target, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+}
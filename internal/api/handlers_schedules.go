@@ -0,0 +1,237 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+)
+
+// ScheduleRequest creates a schedule.
+type ScheduleRequest struct {
+	ID          string            `json:"id"`
+	Cron        string            `json:"cron"`
+	Timezone    string            `json:"timezone,omitempty"`
+	AgentType   string            `json:"agent_type"`
+	Prompt      string            `json:"prompt"`
+	ProjectRoot string            `json:"project_root,omitempty"`
+	Config      map[string]string `json:"config,omitempty"`
+	Overlap     string            `json:"overlap,omitempty"`
+	CatchUp     string            `json:"catch_up,omitempty"`
+	Paused      bool              `json:"paused,omitempty"`
+}
+
+// ScheduleUpdateRequest changes the fields of a schedule that are set.
+type ScheduleUpdateRequest struct {
+	Cron        *string            `json:"cron,omitempty"`
+	Timezone    *string            `json:"timezone,omitempty"`
+	AgentType   *string            `json:"agent_type,omitempty"`
+	Prompt      *string            `json:"prompt,omitempty"`
+	ProjectRoot *string            `json:"project_root,omitempty"`
+	Config      *map[string]string `json:"config,omitempty"`
+	Overlap     *string            `json:"overlap,omitempty"`
+	CatchUp     *string            `json:"catch_up,omitempty"`
+	Paused      *bool              `json:"paused,omitempty"`
+}
+
+// handleProjectSchedules serves /api/projects/{p}/schedules[/{schedule_id}].
+//
+// GET lists the schedules of the project, POST adds one. GET, PATCH and
+// DELETE on a schedule read, update and remove it; PATCH {"paused": true}
+// pauses it.
+func (s *Server) handleProjectSchedules(w http.ResponseWriter, r *http.Request, projectID string, rest []string) *apiError {
+	if len(rest) > 1 {
+		return apiErrorNotFound("not found")
+	}
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			return s.listSchedules(w, projectID)
+		case http.MethodPost:
+			return s.createSchedule(w, r, projectID)
+		default:
+			return apiErrorMethodNotAllowed()
+		}
+	}
+	scheduleID := rest[0]
+	if err := validateIdentifier(scheduleID, "schedule_id"); err != nil {
+		return err
+	}
+	switch r.Method {
+	case http.MethodGet:
+		return s.getSchedule(w, projectID, scheduleID)
+	case http.MethodPatch:
+		return s.updateSchedule(w, r, projectID, scheduleID)
+	case http.MethodDelete:
+		return s.deleteSchedule(w, projectID, scheduleID)
+	default:
+		return apiErrorMethodNotAllowed()
+	}
+}
+
+func (s *Server) listSchedules(w http.ResponseWriter, projectID string) *apiError {
+	s.schedulesMu.Lock()
+	schedules, err := loadSchedules(s.rootDir, projectID)
+	s.schedulesMu.Unlock()
+	if err != nil {
+		return apiErrorInternal("load schedules", err)
+	}
+	resp := make([]Schedule, 0, len(schedules))
+	for _, sc := range schedules {
+		resp = append(resp, sc.withNextRun())
+	}
+	return writeJSON(w, http.StatusOK, map[string][]Schedule{"schedules": resp})
+}
+
+func (s *Server) getSchedule(w http.ResponseWriter, projectID, scheduleID string) *apiError {
+	s.schedulesMu.Lock()
+	schedules, err := loadSchedules(s.rootDir, projectID)
+	s.schedulesMu.Unlock()
+	if err != nil {
+		return apiErrorInternal("load schedules", err)
+	}
+	idx := findSchedule(schedules, scheduleID)
+	if idx < 0 {
+		return apiErrorNotFound("schedule not found")
+	}
+	return writeJSON(w, http.StatusOK, schedules[idx].withNextRun())
+}
+
+func (s *Server) createSchedule(w http.ResponseWriter, r *http.Request, projectID string) *apiError {
+	var req ScheduleRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+	now := s.now().UTC()
+	sc := Schedule{
+		ID:          strings.TrimSpace(req.ID),
+		Cron:        strings.TrimSpace(req.Cron),
+		Timezone:    strings.TrimSpace(req.Timezone),
+		AgentType:   strings.TrimSpace(req.AgentType),
+		Prompt:      req.Prompt,
+		ProjectRoot: strings.TrimSpace(req.ProjectRoot),
+		Config:      req.Config,
+		Overlap:     req.Overlap,
+		CatchUp:     req.CatchUp,
+		Paused:      req.Paused,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		CheckedAt:   now,
+	}
+	if _, _, err := sc.compile(); err != nil {
+		return apiErrorBadRequest(err.Error())
+	}
+
+	s.schedulesMu.Lock()
+	defer s.schedulesMu.Unlock()
+	schedules, err := loadSchedules(s.rootDir, projectID)
+	if err != nil {
+		return apiErrorInternal("load schedules", err)
+	}
+	if findSchedule(schedules, sc.ID) >= 0 {
+		return apiErrorConflict("schedule already exists", map[string]string{"schedule_id": sc.ID})
+	}
+	schedules = append(schedules, sc)
+	if err := saveSchedules(s.rootDir, projectID, schedules); err != nil {
+		return apiErrorInternal("save schedules", err)
+	}
+	obslog.Log(s.logger, "INFO", "api", "schedule_created",
+		obslog.F("project_id", projectID),
+		obslog.F("schedule_id", sc.ID),
+		obslog.F("cron", sc.Cron),
+		obslog.F("overlap", sc.Overlap),
+	)
+	return writeJSON(w, http.StatusCreated, sc.withNextRun())
+}
+
+func (s *Server) updateSchedule(w http.ResponseWriter, r *http.Request, projectID, scheduleID string) *apiError {
+	var req ScheduleUpdateRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return err
+	}
+
+	s.schedulesMu.Lock()
+	defer s.schedulesMu.Unlock()
+	schedules, err := loadSchedules(s.rootDir, projectID)
+	if err != nil {
+		return apiErrorInternal("load schedules", err)
+	}
+	idx := findSchedule(schedules, scheduleID)
+	if idx < 0 {
+		return apiErrorNotFound("schedule not found")
+	}
+	sc := schedules[idx]
+	now := s.now().UTC()
+	// A new timing or a resume does not catch up on earlier activations.
+	rearm := false
+	if req.Cron != nil && strings.TrimSpace(*req.Cron) != sc.Cron {
+		sc.Cron = strings.TrimSpace(*req.Cron)
+		rearm = true
+	}
+	if req.Timezone != nil && strings.TrimSpace(*req.Timezone) != sc.Timezone {
+		sc.Timezone = strings.TrimSpace(*req.Timezone)
+		rearm = true
+	}
+	if req.Paused != nil && *req.Paused != sc.Paused {
+		sc.Paused = *req.Paused
+		rearm = rearm || !sc.Paused
+	}
+	if req.AgentType != nil {
+		sc.AgentType = strings.TrimSpace(*req.AgentType)
+	}
+	if req.Prompt != nil {
+		sc.Prompt = *req.Prompt
+	}
+	if req.ProjectRoot != nil {
+		sc.ProjectRoot = strings.TrimSpace(*req.ProjectRoot)
+	}
+	if req.Config != nil {
+		sc.Config = *req.Config
+	}
+	if req.Overlap != nil {
+		sc.Overlap = *req.Overlap
+	}
+	if req.CatchUp != nil {
+		sc.CatchUp = *req.CatchUp
+	}
+	if _, _, err := sc.compile(); err != nil {
+		return apiErrorBadRequest(err.Error())
+	}
+	if rearm {
+		sc.CheckedAt = now
+	}
+	sc.UpdatedAt = now
+	schedules[idx] = sc
+	if err := saveSchedules(s.rootDir, projectID, schedules); err != nil {
+		return apiErrorInternal("save schedules", err)
+	}
+	obslog.Log(s.logger, "INFO", "api", "schedule_updated",
+		obslog.F("project_id", projectID),
+		obslog.F("schedule_id", sc.ID),
+		obslog.F("cron", sc.Cron),
+		obslog.F("paused", sc.Paused),
+	)
+	return writeJSON(w, http.StatusOK, sc.withNextRun())
+}
+
+func (s *Server) deleteSchedule(w http.ResponseWriter, projectID, scheduleID string) *apiError {
+	s.schedulesMu.Lock()
+	defer s.schedulesMu.Unlock()
+	schedules, err := loadSchedules(s.rootDir, projectID)
+	if err != nil {
+		return apiErrorInternal("load schedules", err)
+	}
+	idx := findSchedule(schedules, scheduleID)
+	if idx < 0 {
+		return apiErrorNotFound("schedule not found")
+	}
+	schedules = append(schedules[:idx], schedules[idx+1:]...)
+	if err := saveSchedules(s.rootDir, projectID, schedules); err != nil {
+		return apiErrorInternal("save schedules", err)
+	}
+	obslog.Log(s.logger, "INFO", "api", "schedule_deleted",
+		obslog.F("project_id", projectID),
+		obslog.F("schedule_id", scheduleID),
+	)
+	return writeJSON(w, http.StatusOK, map[string]string{"schedule_id": scheduleID, "status": "deleted"})
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newScheduleTestServer returns a server whose clock is *now.
+func newScheduleTestServer(t *testing.T, now *time.Time, rootTaskLimit int) (*Server, string) {
+	t.Helper()
+	root := t.TempDir()
+	server, err := NewServer(Options{
+		RootDir:          root,
+		DisableTaskStart: true,
+		RootTaskLimit:    rootTaskLimit,
+		Now:              func() time.Time { return *now },
+	})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return server, root
+}
+
+func scheduleRequest(t *testing.T, server *Server, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(method, path, reader))
+	return rec
+}
+
+func loadTestSchedule(t *testing.T, root, projectID, id string) Schedule {
+	t.Helper()
+	schedules, err := loadSchedules(root, projectID)
+	if err != nil {
+		t.Fatalf("loadSchedules: %v", err)
+	}
+	idx := findSchedule(schedules, id)
+	if idx < 0 {
+		t.Fatalf("schedule %s not found in %+v", id, schedules)
+	}
+	return schedules[idx]
+}
+
+func TestProjectSchedulesCRUD(t *testing.T) {
+	now := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	server, root := newScheduleTestServer(t, &now, 0)
+	const base = "/api/projects/my-project/schedules"
+
+	rec := scheduleRequest(t, server, http.MethodPost, base, ScheduleRequest{
+		ID:        "nightly-deps",
+		Cron:      "0 3 * * *",
+		Timezone:  "UTC",
+		AgentType: "claude",
+		Prompt:    "update dependencies",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body.String())
+	}
+	var created Schedule
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if created.Overlap != scheduleOverlapSkip || created.CatchUp != scheduleCatchUpOnce {
+		t.Fatalf("defaults not applied: %+v", created)
+	}
+	if created.NextRunAt == nil || !created.NextRunAt.Equal(time.Date(2026, 3, 5, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("next_run_at = %v", created.NextRunAt)
+	}
+	if _, err := os.Stat(filepath.Join(root, "my-project", schedulesFileName)); err != nil {
+		t.Fatalf("schedules.yaml not written: %v", err)
+	}
+
+	if rec := scheduleRequest(t, server, http.MethodPost, base, ScheduleRequest{ID: "nightly-deps", Cron: "@daily", AgentType: "claude", Prompt: "x"}); rec.Code != http.StatusConflict {
+		t.Fatalf("duplicate: %d %s", rec.Code, rec.Body.String())
+	}
+	for _, bad := range []ScheduleRequest{
+		{ID: "bad-cron", Cron: "61 * * * *", AgentType: "claude", Prompt: "x"},
+		{ID: "Bad_ID", Cron: "@daily", AgentType: "claude", Prompt: "x"},
+		{ID: "bad-overlap", Cron: "@daily", AgentType: "claude", Prompt: "x", Overlap: "parallel"},
+		{ID: "no-prompt", Cron: "@daily", AgentType: "claude"},
+	} {
+		if rec := scheduleRequest(t, server, http.MethodPost, base, bad); rec.Code != http.StatusBadRequest {
+			t.Fatalf("create %s: %d %s", bad.ID, rec.Code, rec.Body.String())
+		}
+	}
+
+	paused := true
+	rec = scheduleRequest(t, server, http.MethodPatch, base+"/nightly-deps", ScheduleUpdateRequest{Paused: &paused})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("pause: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = scheduleRequest(t, server, http.MethodGet, base, nil)
+	var list struct {
+		Schedules []Schedule `json:"schedules"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(list.Schedules) != 1 || !list.Schedules[0].Paused || list.Schedules[0].NextRunAt != nil {
+		t.Fatalf("list = %+v", list.Schedules)
+	}
+
+	if rec := scheduleRequest(t, server, http.MethodDelete, base+"/nightly-deps", nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := scheduleRequest(t, server, http.MethodGet, base+"/nightly-deps", nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("get deleted: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSchedulerOverlapPolicies(t *testing.T) {
+	now := time.Date(2026, 3, 4, 2, 59, 0, 0, time.UTC)
+	server, root := newScheduleTestServer(t, &now, 0)
+	rec := scheduleRequest(t, server, http.MethodPost, "/api/projects/my-project/schedules", ScheduleRequest{
+		ID:        "flaky-triage",
+		Cron:      "0 3 * * *",
+		Timezone:  "UTC",
+		AgentType: "claude",
+		Prompt:    "triage flaky tests",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body.String())
+	}
+
+	now = time.Date(2026, 3, 4, 3, 0, 10, 0, time.UTC)
+	server.runDueSchedules()
+	sc := loadTestSchedule(t, root, "my-project", "flaky-triage")
+	first := "task-20260304-030010-flaky-triage"
+	if sc.LastTaskID != first || sc.LastResult != scheduleResultStarted {
+		t.Fatalf("first activation: %+v", sc)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "my-project", first, "TASK.md")); err != nil || string(data) != "triage flaky tests\n" {
+		t.Fatalf("TASK.md = %q, %v", data, err)
+	}
+	server.runDueSchedules()
+	if again := loadTestSchedule(t, root, "my-project", "flaky-triage"); again.LastRunAt == nil || !again.LastRunAt.Equal(now) || again.LastTaskID != first {
+		t.Fatalf("activation ran twice: %+v", again)
+	}
+
+	// skip: the first task is still running.
+	server.trackTaskRun(taskQueueKey{ProjectID: "my-project", TaskID: first}, 1)
+	now = now.Add(24 * time.Hour)
+	server.runDueSchedules()
+	if sc := loadTestSchedule(t, root, "my-project", "flaky-triage"); sc.LastResult != scheduleResultSkipped || sc.LastTaskID != first {
+		t.Fatalf("skip: %+v", sc)
+	}
+
+	// queue: the activation waits for the first task.
+	overlap := scheduleOverlapQueue
+	scheduleRequest(t, server, http.MethodPatch, "/api/projects/my-project/schedules/flaky-triage", ScheduleUpdateRequest{Overlap: &overlap})
+	now = now.Add(24 * time.Hour)
+	server.runDueSchedules()
+	if sc := loadTestSchedule(t, root, "my-project", "flaky-triage"); sc.LastResult != scheduleResultPending || !sc.Pending {
+		t.Fatalf("queue: %+v", sc)
+	}
+	server.trackTaskRun(taskQueueKey{ProjectID: "my-project", TaskID: first}, -1)
+	now = now.Add(time.Minute)
+	server.runDueSchedules()
+	sc = loadTestSchedule(t, root, "my-project", "flaky-triage")
+	second := "task-20260306-030110-flaky-triage"
+	if sc.Pending || sc.LastTaskID != second || sc.LastResult != scheduleResultStarted {
+		t.Fatalf("queued activation: %+v", sc)
+	}
+
+	// replace: the running task is stopped.
+	overlap = scheduleOverlapReplace
+	scheduleRequest(t, server, http.MethodPatch, "/api/projects/my-project/schedules/flaky-triage", ScheduleUpdateRequest{Overlap: &overlap})
+	server.trackTaskRun(taskQueueKey{ProjectID: "my-project", TaskID: second}, 1)
+	now = time.Date(2026, 3, 7, 3, 0, 5, 0, time.UTC)
+	server.runDueSchedules()
+	sc = loadTestSchedule(t, root, "my-project", "flaky-triage")
+	if sc.LastResult != scheduleResultReplaced || sc.LastTaskID != "task-20260307-030005-flaky-triage" {
+		t.Fatalf("replace: %+v", sc)
+	}
+	if _, err := os.Stat(filepath.Join(root, "my-project", second, "DONE")); err != nil {
+		t.Fatalf("replaced task not marked DONE: %v", err)
+	}
+}
+
+func TestSchedulerCatchUpAfterRestart(t *testing.T) {
+	now := time.Date(2026, 3, 4, 2, 0, 0, 0, time.UTC)
+	server, root := newScheduleTestServer(t, &now, 0)
+	for _, req := range []ScheduleRequest{
+		{ID: "catch-up", Cron: "0 3 * * *", Timezone: "UTC", AgentType: "claude", Prompt: "a"},
+		{ID: "no-catch-up", Cron: "0 3 * * *", Timezone: "UTC", AgentType: "claude", Prompt: "b", CatchUp: scheduleCatchUpNone},
+	} {
+		if rec := scheduleRequest(t, server, http.MethodPost, "/api/projects/my-project/schedules", req); rec.Code != http.StatusCreated {
+			t.Fatalf("create %s: %d %s", req.ID, rec.Code, rec.Body.String())
+		}
+	}
+
+	// The server was down for three activations.
+	now = time.Date(2026, 3, 6, 9, 30, 0, 0, time.UTC)
+	restarted, err := NewServer(Options{RootDir: root, DisableTaskStart: true, Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	restarted.runDueSchedules()
+
+	lastActivation := time.Date(2026, 3, 6, 3, 0, 0, 0, time.UTC)
+	sc := loadTestSchedule(t, root, "my-project", "catch-up")
+	if sc.LastResult != scheduleResultStarted || sc.LastTaskID != "task-20260306-093000-catch-up" || !sc.CheckedAt.Equal(lastActivation) {
+		t.Fatalf("catch-up: %+v", sc)
+	}
+	sc = loadTestSchedule(t, root, "my-project", "no-catch-up")
+	if sc.LastResult != scheduleResultMissed || sc.LastTaskID != "" || !sc.CheckedAt.Equal(lastActivation) {
+		t.Fatalf("no catch-up: %+v", sc)
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "my-project"))
+	if err != nil {
+		t.Fatalf("read project: %v", err)
+	}
+	if len(entries) != 2 { // schedules.yaml and one task
+		t.Fatalf("project entries = %d, want 2", len(entries))
+	}
+}
+
+func TestSchedulerQueuesInRootTaskPlanner(t *testing.T) {
+	now := time.Date(2026, 3, 4, 2, 59, 0, 0, time.UTC)
+	server, root := newScheduleTestServer(t, &now, 1)
+	if rec := scheduleRequest(t, server, http.MethodPost, "/api/projects/my-project/schedules", ScheduleRequest{
+		ID: "nightly-deps", Cron: "0 3 * * *", Timezone: "UTC", AgentType: "claude", Prompt: "update dependencies",
+	}); rec.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Another root task holds the only slot; the planner is consulted
+	// directly so that nothing is launched.
+	now = time.Date(2026, 3, 4, 3, 0, 10, 0, time.UTC)
+	createTaskFixture(t, root, "other", "task-20260304-030000-busy")
+	busyRunDir := filepath.Join(root, "other", "task-20260304-030000-busy", "runs", "run-1")
+	if err := os.MkdirAll(busyRunDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if _, err := server.rootTaskPlanner.Submit(TaskCreateRequest{ProjectID: "other", TaskID: "task-20260304-030000-busy", AgentType: "claude", Prompt: "busy"}, busyRunDir, "busy\n"); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	server.startTasks = true
+	server.runDueSchedules()
+
+	sc := loadTestSchedule(t, root, "my-project", "nightly-deps")
+	if sc.LastResult != scheduleResultQueued {
+		t.Fatalf("schedule = %+v, want queued", sc)
+	}
+	task, err := getTaskWithQueue(root, "my-project", sc.LastTaskID, server.taskQueueSnapshot())
+	if err != nil || task.Status != "queued" || task.QueuePosition != 1 {
+		t.Fatalf("task = %+v, %v", task, err)
+	}
+	if !server.taskActive("my-project", sc.LastTaskID) {
+		t.Fatalf("queued task is not active")
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	stderrors "errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/bussearch"
+)
+
+const maxSearchLimit = 500
+
+// searchResponse is the body of GET /api/v1/search.
+type searchResponse struct {
+	Query string          `json:"query"`
+	Hits  []bussearch.Hit `json:"hits"`
+}
+
+// handleSearch serves GET /api/v1/search?q=...: a full-text search over the
+// message buses of every project, optionally narrowed by project_id and a
+// where= filter expression.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) *apiError {
+	if r.Method != http.MethodGet {
+		return apiErrorMethodNotAllowed()
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		return apiErrorBadRequest("q is required")
+	}
+	projectID := strings.TrimSpace(r.URL.Query().Get("project_id"))
+	if projectID != "" {
+		if err := validateIdentifier(projectID, "project_id"); err != nil {
+			return err
+		}
+	}
+	filter, apiErr := parseMessageFilter(r)
+	if apiErr != nil {
+		return apiErr
+	}
+	limit := bussearch.DefaultLimit
+	if raw := strings.TrimSpace(r.URL.Query().Get("limit")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return apiErrorBadRequest("limit must be a positive integer")
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	hits, err := bussearch.Search(s.rootDir, query, bussearch.Options{
+		Project: projectID,
+		Filter:  filter,
+		Limit:   limit,
+	})
+	if err != nil {
+		if stderrors.Is(err, bussearch.ErrInvalidQuery) {
+			return apiErrorBadRequest(err.Error())
+		}
+		return apiErrorInternal("search message buses", err)
+	}
+	return writeJSON(w, http.StatusOK, searchResponse{Query: query, Hits: hits})
+}
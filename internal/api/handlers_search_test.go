@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+)
+
+func TestSearchEndpoint(t *testing.T) {
+	server, root := newTestServer(t)
+	post := func(project, task, msgType, body string) string {
+		dir := filepath.Join(root, project)
+		name := "PROJECT-MESSAGE-BUS.md"
+		if task != "" {
+			dir = filepath.Join(dir, task)
+			name = "TASK-MESSAGE-BUS.md"
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		bus, err := messagebus.NewMessageBus(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("NewMessageBus: %v", err)
+		}
+		id, err := bus.AppendMessage(&messagebus.Message{Type: msgType, ProjectID: project, TaskID: task, RunID: "run-1", Body: body})
+		if err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+		return id
+	}
+	alphaID := post("alpha", "task-20260101-000000-one", "ERROR", "Flaky integration test timed out")
+	betaID := post("beta", "", "FACT", "integration suite is stable again")
+
+	get := func(query string) (*httptest.ResponseRecorder, searchResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/search?"+query, nil)
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		var resp searchResponse
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return rec, resp
+	}
+
+	rec, resp := get("q=integration")
+	if rec.Code != http.StatusOK || len(resp.Hits) != 2 || resp.Hits[0].MsgID != betaID || resp.Query != "integration" {
+		t.Fatalf("search = %d %+v", rec.Code, resp)
+	}
+	hit := resp.Hits[1]
+	if hit.MsgID != alphaID || hit.ProjectID != "alpha" || hit.TaskID != "task-20260101-000000-one" || hit.RunID != "run-1" || hit.Snippet == "" {
+		t.Fatalf("unexpected hit: %+v", hit)
+	}
+
+	_, resp = get("q=integration&project_id=alpha")
+	if len(resp.Hits) != 1 || resp.Hits[0].MsgID != alphaID {
+		t.Fatalf("project search = %+v", resp.Hits)
+	}
+	_, resp = get("q=integration&where=" + url.QueryEscape("type = FACT"))
+	if len(resp.Hits) != 1 || resp.Hits[0].MsgID != betaID {
+		t.Fatalf("filtered search = %+v", resp.Hits)
+	}
+	_, resp = get("q=integration&limit=1")
+	if len(resp.Hits) != 1 {
+		t.Fatalf("limited search = %+v", resp.Hits)
+	}
+
+	for _, query := range []string{"", "q=x", "q=" + url.QueryEscape(`"open`), "q=ok&limit=-1", "q=ok&where=" + url.QueryEscape("type =")} {
+		if rec, _ := get(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /api/v1/search?%s = %d, want 400", query, rec.Code)
+		}
+	}
+}
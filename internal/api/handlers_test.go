@@ -15,6 +15,7 @@ import (
 
 	"github.com/jonnyzzz/conductor-loop/internal/config"
 	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
 	"github.com/jonnyzzz/conductor-loop/internal/storage"
 	"github.com/jonnyzzz/conductor-loop/internal/taskdeps"
 )
@@ -565,6 +566,66 @@ func TestHandleTaskCreate_AttachMode_Invalid(t *testing.T) {
 	}
 }
 
+func TestHandleTaskCreate_Isolation_Invalid(t *testing.T) {
+	root := t.TempDir()
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	for name, payload := range map[string]TaskCreateRequest{
+		"isolation": {Isolation: "docker"},
+		"on_done":   {Isolation: "worktree", OnDone: "squash"},
+	} {
+		payload.ProjectID = "project"
+		payload.TaskID = "task"
+		payload.AgentType = "codex"
+		payload.Prompt = "hello"
+		data, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", bytes.NewBuffer(data))
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, req)
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for invalid %s, got %d: %s", name, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestHandleTaskCreate_Budget_Invalid(t *testing.T) {
+	root := t.TempDir()
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	for name, payload := range map[string]TaskCreateRequest{
+		"max_tokens":     {MaxTokens: -1},
+		"max_wall_clock": {MaxWallClock: "two hours"},
+	} {
+		payload.ProjectID = "project"
+		payload.TaskID = "task"
+		payload.AgentType = "codex"
+		payload.Prompt = "hello"
+		data, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", bytes.NewBuffer(data))
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, req)
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for invalid %s, got %d: %s", name, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestTaskCreateRequestBudget(t *testing.T) {
+	req := TaskCreateRequest{MaxTokens: 1000, MaxCostUSD: 2.5, MaxWallClock: "90m", MaxTreeRestarts: 4}
+	budget, err := req.budget()
+	if err != nil {
+		t.Fatalf("budget: %v", err)
+	}
+	want := runner.Budget{MaxTokens: 1000, MaxCostUSD: 2.5, MaxWallClock: 90 * time.Minute, MaxRestarts: 4}
+	if budget != want {
+		t.Fatalf("budget=%+v, want %+v", budget, want)
+	}
+}
+
 func TestHandleTaskCreate_AttachMode_Values(t *testing.T) {
 	for _, mode := range []string{"create", "attach", "resume"} {
 		t.Run(mode, func(t *testing.T) {
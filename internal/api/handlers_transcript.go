@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
+	"github.com/jonnyzzz/conductor-loop/internal/runstate"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/pkg/errors"
+)
+
+// transcriptResponse is the JSON body of the run transcript endpoint.
+type transcriptResponse struct {
+	ProjectID string             `json:"project_id"`
+	TaskID    string             `json:"task_id"`
+	RunID     string             `json:"run_id"`
+	Status    string             `json:"status"`
+	Events    []transcript.Event `json:"events"`
+}
+
+// runArtifactDir returns the run directory holding transcript.jsonl and
+// changes.json.
+func (s *Server) runArtifactDir(run *storage.RunInfo) (string, *apiError) {
+	if strings.TrimSpace(run.StdoutPath) == "" {
+		return "", apiErrorNotFound("run directory not set")
+	}
+	runDir := filepath.Dir(run.StdoutPath)
+	if err := requirePathWithinRoot(s.rootDir, runDir, "run path"); err != nil {
+		return "", err
+	}
+	return runDir, nil
+}
+
+// serveRunTranscript returns the normalized run transcript.
+// GET /api/projects/{p}/tasks/{t}/runs/{r}/transcript[?since=<seq>]
+func (s *Server) serveRunTranscript(w http.ResponseWriter, r *http.Request, run *storage.RunInfo) *apiError {
+	runDir, apiErr := s.runArtifactDir(run)
+	if apiErr != nil {
+		return apiErr
+	}
+	var since int64
+	if raw := strings.TrimSpace(r.URL.Query().Get("since")); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			return apiErrorBadRequest("invalid since")
+		}
+		since = parsed
+	}
+	events, err := runner.ReadTranscript(runDir, run)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return apiErrorNotFound("transcript not found")
+		}
+		return apiErrorInternal("read transcript", err)
+	}
+	filtered := make([]transcript.Event, 0, len(events))
+	for _, event := range events {
+		if event.Seq > since {
+			filtered = append(filtered, event)
+		}
+	}
+	return writeJSON(w, http.StatusOK, transcriptResponse{
+		ProjectID: run.ProjectID,
+		TaskID:    run.TaskID,
+		RunID:     run.RunID,
+		Status:    run.Status,
+		Events:    filtered,
+	})
+}
+
+// streamRunTranscript streams transcript events as SSE ("transcript" events
+// with the event seq as id) until the run finishes, then sends "done".
+// Last-Event-ID resumes after the given seq.
+// GET /api/projects/{p}/tasks/{t}/runs/{r}/transcript/stream
+func (s *Server) streamRunTranscript(w http.ResponseWriter, r *http.Request, run *storage.RunInfo) *apiError {
+	runDir, apiErr := s.runArtifactDir(run)
+	if apiErr != nil {
+		return apiErr
+	}
+	writer, err := newSSEWriter(w)
+	if err != nil {
+		return apiErrorBadRequest("sse not supported")
+	}
+	lastSeq, _ := strconv.ParseInt(strings.TrimSpace(r.Header.Get("Last-Event-ID")), 10, 64)
+	cfg := s.sseConfig()
+	path := filepath.Join(runDir, transcript.FileName)
+	runInfoPath := filepath.Join(runDir, "run-info.yaml")
+
+	send := func(event transcript.Event) bool {
+		if event.Seq <= lastSeq {
+			return true
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return true
+		}
+		if err := writer.Send(SSEEvent{ID: strconv.FormatInt(event.Seq, 10), Event: "transcript", Data: string(data)}); err != nil {
+			return false
+		}
+		lastSeq = event.Seq
+		return true
+	}
+
+	var (
+		offset  int64
+		partial []byte
+	)
+	// readAndSend forwards complete transcript lines appended since the last
+	// call. It reports whether the file exists and whether the client is
+	// still connected.
+	readAndSend := func() (bool, bool) {
+		file, err := os.Open(path)
+		if err != nil {
+			return false, true
+		}
+		defer file.Close()
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return true, true
+		}
+		data, err := io.ReadAll(file)
+		if err != nil || len(data) == 0 {
+			return true, true
+		}
+		offset += int64(len(data))
+		data = append(partial, data...)
+		last := bytes.LastIndexByte(data, '\n')
+		if last < 0 {
+			partial = data
+			return true, true
+		}
+		partial = append([]byte(nil), data[last+1:]...)
+		for _, line := range bytes.Split(data[:last], []byte("\n")) {
+			event, ok := transcript.DecodeLine(line)
+			if !ok {
+				continue
+			}
+			if !send(event) {
+				return true, false
+			}
+		}
+		return true, true
+	}
+
+	finished := func() bool {
+		status := run.Status
+		if current, err := runstate.ReadRunInfo(runInfoPath); err == nil {
+			status = current.Status
+		}
+		return status == storage.StatusCompleted || status == storage.StatusFailed
+	}
+
+	ctx := r.Context()
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+	heartbeat := time.NewTicker(cfg.HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		// Check completion before reading so events written just before the
+		// status change are always delivered ahead of "done".
+		done := finished()
+		exists, connected := readAndSend()
+		if !connected {
+			return nil
+		}
+		if done {
+			if !exists {
+				// Runs recorded before transcripts existed: send the derived
+				// transcript in one go.
+				events, _ := runner.ReadTranscript(runDir, run)
+				for _, event := range events {
+					if !send(event) {
+						return nil
+					}
+				}
+			}
+			_ = writer.Send(SSEEvent{Event: "done", Data: "{}"})
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			_ = writer.Send(SSEEvent{Event: "heartbeat", Data: "{}"})
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+func writeRunTranscript(t *testing.T, root, projectID, taskID, runID string, events ...transcript.Event) {
+	t.Helper()
+	path := filepath.Join(root, projectID, taskID, "runs", runID, transcript.FileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open transcript: %v", err)
+	}
+	defer f.Close()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatalf("marshal event: %v", err)
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			t.Fatalf("write transcript: %v", err)
+		}
+	}
+}
+
+func TestRunTranscript_JSON(t *testing.T) {
+	root := t.TempDir()
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	makeProjectRun(t, root, "project", "task", "run-1", storage.StatusCompleted, "raw\n")
+	writeRunTranscript(t, root, "project", "task", "run-1",
+		transcript.Event{Seq: 1, Type: transcript.TypeAssistantText, Text: "hello"},
+		transcript.Event{Seq: 2, Type: transcript.TypeToolCall, Tool: "read_file", CallID: "c1"},
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/projects/project/tasks/task/runs/run-1/transcript?since=1", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp transcriptResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.RunID != "run-1" || resp.Status != storage.StatusCompleted {
+		t.Fatalf("unexpected run fields: %+v", resp)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Tool != "read_file" {
+		t.Fatalf("expected only events after seq 1, got %+v", resp.Events)
+	}
+}
+
+func TestRunTranscript_DerivedFromStdout(t *testing.T) {
+	root := t.TempDir()
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	makeProjectRun(t, root, "project", "task", "run-1", storage.StatusCompleted, "plain answer\n")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/projects/project/tasks/task/runs/run-1/transcript", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp transcriptResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Text != "plain answer" || resp.Events[0].Seq != 1 {
+		t.Fatalf("unexpected derived events: %+v", resp.Events)
+	}
+}
+
+func TestRunTranscript_InvalidSince(t *testing.T) {
+	root := t.TempDir()
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	makeProjectRun(t, root, "project", "task", "run-1", storage.StatusCompleted, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/projects/project/tasks/task/runs/run-1/transcript?since=abc", nil)
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+}
+
+func TestRunTranscriptStream_FollowsUntilDone(t *testing.T) {
+	root := t.TempDir()
+	apiCfg := config.APIConfig{}
+	apiCfg.SSE.PollIntervalMs = 20
+	server, err := NewServer(Options{RootDir: root, DisableTaskStart: true, APIConfig: apiCfg})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	info := makeProjectRun(t, root, "project", "task", "run-1", storage.StatusRunning, "")
+	writeRunTranscript(t, root, "project", "task", "run-1",
+		transcript.Event{Seq: 1, Type: transcript.TypeAssistantText, Text: "first"},
+		transcript.Event{Seq: 2, Type: transcript.TypeThinking, Text: "second"},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/projects/project/tasks/task/runs/run-1/transcript/stream", nil).WithContext(ctx)
+	req.Header.Set("Last-Event-ID", "1")
+	rec := &recordingWriter{header: make(http.Header)}
+	done := make(chan struct{})
+	go func() {
+		server.Handler().ServeHTTP(rec, req)
+		close(done)
+	}()
+
+	waitFor := func(needle string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !bytes.Contains(rec.Bytes(), []byte(needle)) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout waiting for %q; got %q", needle, string(rec.Bytes()))
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(`"text":"second"`)
+
+	writeRunTranscript(t, root, "project", "task", "run-1",
+		transcript.Event{Seq: 3, Type: transcript.TypeError, Text: "third"},
+	)
+	info.Status = storage.StatusCompleted
+	info.EndTime = time.Now().UTC()
+	if err := storage.WriteRunInfo(filepath.Join(root, "project", "task", "runs", "run-1", "run-info.yaml"), info); err != nil {
+		t.Fatalf("write run-info: %v", err)
+	}
+	waitFor("event: done")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream did not end after done")
+	}
+
+	body := string(rec.Bytes())
+	if strings.Contains(body, `"text":"first"`) {
+		t.Fatalf("Last-Event-ID should skip seq 1: %q", body)
+	}
+	if !strings.Contains(body, "id: 3\nevent: transcript\n") {
+		t.Fatalf("expected seq 3 event before done: %q", body)
+	}
+	if strings.Index(body, `"text":"third"`) > strings.Index(body, "event: done") {
+		t.Fatalf("done must follow the last event: %q", body)
+	}
+}
@@ -564,17 +564,18 @@ func (p *rootTaskPlanner) saveStateLocked(state *rootTaskPlannerState) error {
 	if err := os.MkdirAll(filepath.Dir(p.statePath), 0o755); err != nil {
 		return errors.Wrap(err, "create root task planner state directory")
 	}
-	if err := writePlannerFileAtomic(p.statePath, data); err != nil {
+	if err := writeFileAtomic(p.statePath, data); err != nil {
 		return errors.Wrap(err, "write root task planner state")
 	}
 	return nil
 }
 
-func writePlannerFileAtomic(path string, data []byte) error {
+// writeFileAtomic replaces path with data through a synced temp file.
+func writeFileAtomic(path string, data []byte) error {
 	dir := filepath.Dir(path)
-	tmpFile, err := os.CreateTemp(dir, "root-task-planner.*.yaml.tmp")
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
 	if err != nil {
-		return errors.Wrap(err, "create temp planner file")
+		return errors.Wrap(err, "create temp file")
 	}
 	tmpName := tmpFile.Name()
 	success := false
@@ -587,16 +588,16 @@ func writePlannerFileAtomic(path string, data []byte) error {
 	}()
 
 	if _, err := tmpFile.Write(data); err != nil {
-		return errors.Wrap(err, "write temp planner file")
+		return errors.Wrap(err, "write temp file")
 	}
 	if err := tmpFile.Sync(); err != nil {
-		return errors.Wrap(err, "fsync temp planner file")
+		return errors.Wrap(err, "fsync temp file")
 	}
 	if err := tmpFile.Chmod(rootTaskPlannerFileMode); err != nil {
-		return errors.Wrap(err, "chmod temp planner file")
+		return errors.Wrap(err, "chmod temp file")
 	}
 	if err := tmpFile.Close(); err != nil {
-		return errors.Wrap(err, "close temp planner file")
+		return errors.Wrap(err, "close temp file")
 	}
 	if err := os.Rename(tmpName, path); err != nil {
 		if runtime.GOOS == "windows" {
@@ -607,7 +608,7 @@ func writePlannerFileAtomic(path string, data []byte) error {
 				}
 			}
 		}
-		return errors.Wrap(err, "rename temp planner file")
+		return errors.Wrap(err, "rename temp file")
 	}
 	success = true
 	return nil
@@ -30,6 +30,9 @@ func (s *Server) routes() http.Handler {
 	mux.Handle("/api/v1/messages", s.wrap(s.handleMessages))
 	mux.Handle("POST /api/v1/messages", s.wrap(s.handlePostMessage))
 	mux.Handle("/api/v1/messages/stream", s.wrap(s.handleMessageStream))
+	mux.Handle("/api/v1/search", s.wrap(s.handleSearch))
+	mux.Handle("/api/v1/questions", s.wrap(s.handleQuestions))
+	mux.Handle("/api/v1/questions/", s.wrap(s.handleQuestionByID))
 
 	// Project-centric API (used by the web UI)
 	mux.Handle("/api/projects", s.wrap(s.handleProjectsList))
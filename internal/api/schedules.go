@@ -0,0 +1,469 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/cron"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/runner"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	schedulesFileName    = "schedules.yaml"
+	schedulesFileVersion = 1
+
+	// scheduleTickInterval is how often the scheduler looks for due schedules.
+	scheduleTickInterval = 30 * time.Second
+	// scheduleMissedAfter is how late an activation may be handled before it
+	// counts as missed (the server was down or stalled) and catch_up applies.
+	scheduleMissedAfter = 2 * time.Minute
+	// scheduleMaxActivations bounds the activations counted in one pass.
+	scheduleMaxActivations = 100000
+)
+
+// Overlap policies: what an activation does while the task of the previous
+// activation is still queued or running.
+const (
+	scheduleOverlapSkip    = "skip"
+	scheduleOverlapQueue   = "queue"
+	scheduleOverlapReplace = "replace"
+)
+
+// Catch-up policies for activations missed while the server was down.
+const (
+	scheduleCatchUpOnce = "once"
+	scheduleCatchUpNone = "none"
+)
+
+// Results of an activation, recorded as Schedule.LastResult.
+const (
+	scheduleResultStarted  = "started"
+	scheduleResultQueued   = "queued"
+	scheduleResultSkipped  = "skipped"
+	scheduleResultPending  = "pending"
+	scheduleResultReplaced = "replaced"
+	scheduleResultMissed   = "missed"
+	scheduleResultFailed   = "failed"
+)
+
+// scheduleIDPattern keeps schedule IDs valid as the slug of a task ID.
+var scheduleIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,38}[a-z0-9]$`)
+
+// Schedule runs a task prompt on a cron schedule. Every activation creates a
+// new task, task-<YYYYMMDD>-<HHMMSS>-<id>, that is admitted like a task
+// created with POST /api/v1/tasks, so the root task limit queues it.
+type Schedule struct {
+	ID          string            `yaml:"id" json:"id"`
+	Cron        string            `yaml:"cron" json:"cron"`
+	Timezone    string            `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	AgentType   string            `yaml:"agent_type" json:"agent_type"`
+	Prompt      string            `yaml:"prompt" json:"prompt"`
+	ProjectRoot string            `yaml:"project_root,omitempty" json:"project_root,omitempty"`
+	Config      map[string]string `yaml:"config,omitempty" json:"config,omitempty"`
+	// Overlap is skip (default), queue or replace.
+	Overlap string `yaml:"overlap" json:"overlap"`
+	// CatchUp is once (default): one task for the activations missed while
+	// the server was down, or none.
+	CatchUp   string    `yaml:"catch_up" json:"catch_up"`
+	Paused    bool      `yaml:"paused,omitempty" json:"paused"`
+	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
+	UpdatedAt time.Time `yaml:"updated_at" json:"updated_at"`
+	// CheckedAt is the time up to which activations have been handled.
+	CheckedAt time.Time `yaml:"checked_at" json:"checked_at"`
+	// Pending is set when an activation with overlap queue waits for the
+	// previous task to finish.
+	Pending    bool       `yaml:"pending,omitempty" json:"pending,omitempty"`
+	LastRunAt  *time.Time `yaml:"last_run_at,omitempty" json:"last_run_at,omitempty"`
+	LastTaskID string     `yaml:"last_task_id,omitempty" json:"last_task_id,omitempty"`
+	LastRunID  string     `yaml:"last_run_id,omitempty" json:"last_run_id,omitempty"`
+	LastResult string     `yaml:"last_result,omitempty" json:"last_result,omitempty"`
+	LastError  string     `yaml:"last_error,omitempty" json:"last_error,omitempty"`
+	NextRunAt  *time.Time `yaml:"-" json:"next_run_at,omitempty"`
+}
+
+type schedulesFile struct {
+	Version   int        `yaml:"version"`
+	Schedules []Schedule `yaml:"schedules"`
+}
+
+// compile validates the schedule and returns its cron expression and
+// location. Empty policies are set to their defaults.
+func (sc *Schedule) compile() (*cron.Schedule, *time.Location, error) {
+	if !scheduleIDPattern.MatchString(sc.ID) {
+		return nil, nil, fmt.Errorf("invalid schedule id %q: must be 3-40 lowercase letters, digits and hyphens", sc.ID)
+	}
+	expr, err := cron.Parse(sc.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc := time.Local
+	if tz := strings.TrimSpace(sc.Timezone); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return nil, nil, fmt.Errorf("invalid timezone %q", tz)
+		}
+	}
+	if strings.TrimSpace(sc.AgentType) == "" {
+		return nil, nil, errors.New("agent_type is required")
+	}
+	if strings.TrimSpace(sc.Prompt) == "" {
+		return nil, nil, errors.New("prompt is required")
+	}
+	sc.Overlap = strings.ToLower(strings.TrimSpace(sc.Overlap))
+	switch sc.Overlap {
+	case "":
+		sc.Overlap = scheduleOverlapSkip
+	case scheduleOverlapSkip, scheduleOverlapQueue, scheduleOverlapReplace:
+	default:
+		return nil, nil, fmt.Errorf("invalid overlap %q: must be skip, queue or replace", sc.Overlap)
+	}
+	sc.CatchUp = strings.ToLower(strings.TrimSpace(sc.CatchUp))
+	switch sc.CatchUp {
+	case "":
+		sc.CatchUp = scheduleCatchUpOnce
+	case scheduleCatchUpOnce, scheduleCatchUpNone:
+	default:
+		return nil, nil, fmt.Errorf("invalid catch_up %q: must be once or none", sc.CatchUp)
+	}
+	return expr, loc, nil
+}
+
+// withNextRun returns a copy of sc with NextRunAt set.
+func (sc Schedule) withNextRun() Schedule {
+	sc.NextRunAt = nil
+	if sc.Paused {
+		return sc
+	}
+	expr, loc, err := sc.compile()
+	if err != nil {
+		return sc
+	}
+	if next := expr.Next(sc.CheckedAt.In(loc)); !next.IsZero() {
+		sc.NextRunAt = &next
+	}
+	return sc
+}
+
+func schedulesPath(rootDir, projectID string) string {
+	return filepath.Join(rootDir, projectID, schedulesFileName)
+}
+
+// loadSchedules reads the schedules of a project; a missing file has none.
+func loadSchedules(rootDir, projectID string) ([]Schedule, error) {
+	data, err := os.ReadFile(schedulesPath(rootDir, projectID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read schedules")
+	}
+	var file schedulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, errors.Wrap(err, "parse schedules")
+	}
+	return file.Schedules, nil
+}
+
+func saveSchedules(rootDir, projectID string, schedules []Schedule) error {
+	if schedules == nil {
+		schedules = []Schedule{}
+	}
+	data, err := yaml.Marshal(schedulesFile{Version: schedulesFileVersion, Schedules: schedules})
+	if err != nil {
+		return errors.Wrap(err, "marshal schedules")
+	}
+	path := schedulesPath(rootDir, projectID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "create project directory")
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return errors.Wrap(err, "write schedules")
+	}
+	return nil
+}
+
+func findSchedule(schedules []Schedule, id string) int {
+	for i := range schedules {
+		if schedules[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// startScheduler runs due schedules until stop is closed. Activations that
+// came due while the server was down are handled on the first pass.
+func (s *Server) startScheduler(stop <-chan struct{}) {
+	ticker := time.NewTicker(scheduleTickInterval)
+	defer ticker.Stop()
+	s.runDueSchedules()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.runDueSchedules()
+		}
+	}
+}
+
+// runDueSchedules handles the due activations of the schedules of all
+// projects.
+func (s *Server) runDueSchedules() {
+	entries, err := os.ReadDir(s.rootDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(schedulesPath(s.rootDir, entry.Name())); err != nil {
+			continue
+		}
+		if err := s.runProjectSchedules(entry.Name()); err != nil {
+			obslog.Log(s.logger, "ERROR", "api", "schedules_run_failed",
+				obslog.F("project_id", entry.Name()),
+				obslog.F("error", err),
+			)
+		}
+	}
+}
+
+func (s *Server) runProjectSchedules(projectID string) error {
+	s.schedulesMu.Lock()
+	defer s.schedulesMu.Unlock()
+	schedules, err := loadSchedules(s.rootDir, projectID)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i := range schedules {
+		if s.runSchedule(projectID, &schedules[i]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return saveSchedules(s.rootDir, projectID, schedules)
+}
+
+// runSchedule handles the due activations of one schedule and reports
+// whether it changed. Callers hold s.schedulesMu.
+func (s *Server) runSchedule(projectID string, sc *Schedule) bool {
+	if sc.Paused {
+		return false
+	}
+	expr, loc, err := sc.compile()
+	if err != nil {
+		obslog.Log(s.logger, "ERROR", "api", "schedule_invalid",
+			obslog.F("project_id", projectID),
+			obslog.F("schedule_id", sc.ID),
+			obslog.F("error", err),
+		)
+		return false
+	}
+	now := s.now()
+	var latest time.Time
+	activations := 0
+	for next := expr.Next(sc.CheckedAt.In(loc)); !next.IsZero() && !next.After(now) && activations < scheduleMaxActivations; next = expr.Next(next) {
+		latest = next
+		activations++
+	}
+	if activations == 0 {
+		if sc.Pending && !s.taskActive(projectID, sc.LastTaskID) {
+			sc.Pending = false
+			s.launchSchedule(projectID, sc, now)
+			return true
+		}
+		return false
+	}
+	sc.CheckedAt = latest
+
+	missed := now.Sub(latest) > scheduleMissedAfter
+	if missed && sc.CatchUp == scheduleCatchUpNone {
+		sc.LastResult = scheduleResultMissed
+		sc.LastError = ""
+		obslog.Log(s.logger, "WARN", "api", "schedule_missed",
+			obslog.F("project_id", projectID),
+			obslog.F("schedule_id", sc.ID),
+			obslog.F("activations", activations),
+			obslog.F("latest", latest),
+		)
+		return true
+	}
+
+	replaced := false
+	if s.taskActive(projectID, sc.LastTaskID) {
+		switch sc.Overlap {
+		case scheduleOverlapQueue:
+			sc.Pending = true
+			sc.LastResult = scheduleResultPending
+			sc.LastError = ""
+			return true
+		case scheduleOverlapReplace:
+			if err := s.stopScheduledTask(projectID, sc.LastTaskID); err != nil {
+				sc.LastResult = scheduleResultFailed
+				sc.LastError = err.Error()
+				return true
+			}
+			replaced = true
+		default:
+			sc.LastResult = scheduleResultSkipped
+			sc.LastError = ""
+			obslog.Log(s.logger, "INFO", "api", "schedule_skipped",
+				obslog.F("project_id", projectID),
+				obslog.F("schedule_id", sc.ID),
+				obslog.F("running_task_id", sc.LastTaskID),
+			)
+			return true
+		}
+	}
+	sc.Pending = false
+	s.launchSchedule(projectID, sc, now)
+	if replaced && sc.LastResult != scheduleResultFailed {
+		sc.LastResult = scheduleResultReplaced
+	}
+	return true
+}
+
+// launchSchedule creates the task of an activation and admits its first run.
+func (s *Server) launchSchedule(projectID string, sc *Schedule, now time.Time) {
+	taskID, runID, status, err := s.createScheduledTask(projectID, sc, now)
+	sc.LastRunAt = &now
+	if err != nil {
+		sc.LastResult = scheduleResultFailed
+		sc.LastError = err.Error()
+		obslog.Log(s.logger, "ERROR", "api", "schedule_launch_failed",
+			obslog.F("project_id", projectID),
+			obslog.F("schedule_id", sc.ID),
+			obslog.F("task_id", taskID),
+			obslog.F("error", err),
+		)
+		return
+	}
+	sc.LastTaskID = taskID
+	sc.LastRunID = runID
+	sc.LastResult = scheduleResultStarted
+	if status == rootTaskPlannerEntryQueued {
+		sc.LastResult = scheduleResultQueued
+	}
+	sc.LastError = ""
+	obslog.Log(s.logger, "INFO", "api", "schedule_launched",
+		obslog.F("project_id", projectID),
+		obslog.F("schedule_id", sc.ID),
+		obslog.F("task_id", taskID),
+		obslog.F("run_id", runID),
+		obslog.F("planner_status", status),
+	)
+}
+
+func (s *Server) createScheduledTask(projectID string, sc *Schedule, now time.Time) (taskID, runID, status string, err error) {
+	taskID = fmt.Sprintf("task-%s-%s", now.UTC().Format("20060102-150405"), sc.ID)
+	if err := storage.ValidateTaskID(taskID); err != nil {
+		return taskID, "", "", err
+	}
+	taskDir := filepath.Join(s.rootDir, projectID, taskID)
+	if _, err := os.Stat(taskDir); err == nil {
+		return taskID, "", "", fmt.Errorf("task %s already exists", taskID)
+	}
+	if err := os.MkdirAll(filepath.Join(taskDir, "runs"), 0o755); err != nil {
+		return taskID, "", "", errors.Wrap(err, "create task directory")
+	}
+	prompt := sc.Prompt
+	if !strings.HasSuffix(prompt, "\n") {
+		prompt += "\n"
+	}
+	if err := os.WriteFile(filepath.Join(taskDir, "TASK.md"), []byte(prompt), 0o644); err != nil {
+		return taskID, "", "", errors.Wrap(err, "write TASK.md")
+	}
+	runID, runDir, err := runner.AllocateRunDir(filepath.Join(taskDir, "runs"))
+	if err != nil {
+		return taskID, "", "", errors.Wrap(err, "allocate run directory")
+	}
+	req := TaskCreateRequest{
+		ProjectID:   projectID,
+		TaskID:      taskID,
+		AgentType:   sc.AgentType,
+		Prompt:      sc.Prompt,
+		Config:      sc.Config,
+		ProjectRoot: sc.ProjectRoot,
+		AttachMode:  "create",
+	}
+	status, _, apiErr := s.admitTaskRun(req, runID, runDir, prompt)
+	if apiErr != nil {
+		return taskID, runID, "", errors.New(apiErr.Message)
+	}
+	return taskID, runID, status, nil
+}
+
+// taskActive reports whether a task has a queued or running root run: one
+// started by this server, or one with a live run-info.yaml.
+func (s *Server) taskActive(projectID, taskID string) bool {
+	if taskID == "" {
+		return false
+	}
+	key := taskQueueKey{ProjectID: projectID, TaskID: taskID}
+	s.activeTasksMu.Lock()
+	inFlight := s.activeTasks[key] > 0
+	s.activeTasksMu.Unlock()
+	if inFlight {
+		return true
+	}
+	task, err := getTaskWithQueue(s.rootDir, projectID, taskID, s.taskQueueSnapshot())
+	if err != nil {
+		return false
+	}
+	switch task.Status {
+	case storage.StatusRunning, storage.StatusPartialFail, storage.StatusQueued:
+		return true
+	}
+	return false
+}
+
+// trackTaskRun counts the root runs of a task started by this server.
+func (s *Server) trackTaskRun(key taskQueueKey, delta int) {
+	s.activeTasksMu.Lock()
+	defer s.activeTasksMu.Unlock()
+	if s.activeTasks == nil {
+		s.activeTasks = make(map[taskQueueKey]int)
+	}
+	s.activeTasks[key] += delta
+	if s.activeTasks[key] <= 0 {
+		delete(s.activeTasks, key)
+	}
+}
+
+// stopScheduledTask marks the task of a previous activation DONE, stops its
+// runs and drops its queued runs.
+func (s *Server) stopScheduledTask(projectID, taskID string) error {
+	taskDir := filepath.Join(s.rootDir, projectID, taskID)
+	if err := os.WriteFile(filepath.Join(taskDir, "DONE"), []byte(""), 0o644); err != nil {
+		return errors.Wrap(err, "write DONE")
+	}
+	stopped, err := stopTaskRuns(taskDir)
+	if err != nil {
+		return errors.Wrap(err, "stop task")
+	}
+	if s.rootTaskPlanner != nil {
+		launches, err := s.rootTaskPlanner.DropQueuedForTask(projectID, taskID)
+		if err != nil {
+			return errors.Wrap(err, "drop queued runs")
+		}
+		s.launchPlannedTasks(launches)
+	}
+	obslog.Log(s.logger, "WARN", "api", "schedule_task_replaced",
+		obslog.F("project_id", projectID),
+		obslog.F("task_id", taskID),
+		obslog.F("stopped_runs", stopped),
+	)
+	return nil
+}
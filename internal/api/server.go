@@ -30,6 +30,7 @@ type Options struct {
 	ExtraRoots              []string
 	ConfigPath              string
 	APIConfig               config.APIConfig
+	MessageBus              *config.MessageBusConfig // applied to buses the server writes; nil keeps the stored policy
 	RootTaskLimit           int
 	ProjectRunsFlatCacheTTL time.Duration
 	Version                 string
@@ -46,6 +47,7 @@ type Server struct {
 	rootDir    string
 	extraRoots []string
 	configPath string
+	busConfig  *config.MessageBusConfig
 	version    string
 	agentNames []string
 	startTime  time.Time
@@ -71,6 +73,15 @@ type Server struct {
 	sseErr         error
 
 	projectRunsCache *projectRunInfosCache
+
+	pipelinesMu      sync.Mutex
+	runningPipelines map[string]bool       // project/workflow_id of pipelines run by this server
+	pipelineRuns     map[string]chan error // run_id of admitted pipeline tasks -> result
+
+	schedulesMu   sync.Mutex // guards the schedules.yaml files
+	schedulerStop chan struct{}
+	activeTasksMu sync.Mutex
+	activeTasks   map[taskQueueKey]int // root runs started by this server, per task
 }
 
 // WaitForTasks waits for all background task goroutines to finish.
@@ -132,6 +143,7 @@ func NewServer(opts Options) (*Server, error) {
 		rootDir:          rootDir,
 		extraRoots:       opts.ExtraRoots,
 		configPath:       strings.TrimSpace(opts.ConfigPath),
+		busConfig:        opts.MessageBus,
 		version:          version,
 		agentNames:       opts.AgentNames,
 		startTime:        now(),
@@ -214,6 +226,10 @@ func (s *Server) ListenAndServe(explicit bool) error {
 		s.server = &http.Server{Handler: s.handler}
 	}
 	srv := s.server
+	if s.startTasks && s.schedulerStop == nil {
+		s.schedulerStop = make(chan struct{})
+		go s.startScheduler(s.schedulerStop)
+	}
 	s.mu.Unlock()
 	apiURL, uiURL := startupURLs(s.apiConfig.Host, actualPort)
 	s.logger.Printf("API listening on %s", apiURL)
@@ -243,6 +259,10 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	s.mu.Lock()
 	srv := s.server
 	port := s.actualPort
+	if s.schedulerStop != nil {
+		close(s.schedulerStop)
+		s.schedulerStop = nil
+	}
 	s.mu.Unlock()
 	if srv == nil {
 		return nil
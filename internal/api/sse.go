@@ -263,15 +263,20 @@ func (s *Server) streamMessages(w http.ResponseWriter, r *http.Request) *apiErro
 // streamMessageBusPath streams messages from a bus file as SSE events.
 // It supports Last-Event-ID for resumable clients.
 func (s *Server) streamMessageBusPath(w http.ResponseWriter, r *http.Request, busPath string) *apiError {
+	filter, apiErr := parseMessageFilter(r)
+	if apiErr != nil {
+		return apiErr
+	}
 	writer, err := newSSEWriter(w)
 	if err != nil {
 		return apiErrorBadRequest("sse not supported")
 	}
 	ctx := r.Context()
-	bus, err := messagebus.NewMessageBus(busPath)
+	bus, err := messagebus.Open(busPath, "")
 	if err != nil {
 		return apiErrorInternal("open message bus", err)
 	}
+	defer bus.Close()
 	cfg := s.sseConfig()
 	lastID := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
 
@@ -297,7 +302,7 @@ func (s *Server) streamMessageBusPath(w http.ResponseWriter, r *http.Request, bu
 		if strings.TrimSpace(lastID) == "" {
 			// Initial connect or post-reset: send only the last N messages so the
 			// payload is bounded and the panel is never spuriously empty.
-			messages, err = bus.ReadLastN(sseInitialHydrationCount)
+			messages, err = bus.ReadMessagesWhere(filter, sseInitialHydrationCount)
 		} else {
 			messages, err = bus.ReadMessages(lastID)
 		}
@@ -307,7 +312,7 @@ func (s *Server) streamMessageBusPath(w http.ResponseWriter, r *http.Request, bu
 				// messages so the panel is repopulated without waiting another tick.
 				lastID = ""
 				var rerr error
-				messages, rerr = bus.ReadLastN(sseInitialHydrationCount)
+				messages, rerr = bus.ReadMessagesWhere(filter, sseInitialHydrationCount)
 				if rerr != nil {
 					return true
 				}
@@ -319,6 +324,11 @@ func (s *Server) streamMessageBusPath(w http.ResponseWriter, r *http.Request, bu
 			if msg == nil {
 				continue
 			}
+			if !filter.Match(msg) {
+				// Skip without re-reading it on the next tick.
+				lastID = msg.MsgID
+				continue
+			}
 			ts := msg.Timestamp
 			if ts.IsZero() {
 				ts = time.Now().UTC()
@@ -338,6 +348,8 @@ func (s *Server) streamMessageBusPath(w http.ResponseWriter, r *http.Request, bu
 				TaskID:    msg.TaskID,
 				RunID:     msg.RunID,
 				IssueID:   msg.IssueID,
+				ToTask:    msg.ToTask,
+				ToRun:     msg.ToRun,
 				Parents:   parentIDs,
 				Meta:      msg.Meta,
 				Body:      msg.Body,
@@ -477,6 +489,8 @@ type messagePayload struct {
 	TaskID    string            `json:"task_id,omitempty"`
 	RunID     string            `json:"run_id,omitempty"`
 	IssueID   string            `json:"issue_id,omitempty"`
+	ToTask    string            `json:"to_task,omitempty"`
+	ToRun     string            `json:"to_run,omitempty"`
 	Parents   []string          `json:"parents,omitempty"` // msg_id strings for JSON simplicity
 	Meta      map[string]string `json:"meta,omitempty"`
 	Body      string            `json:"body"` // Body text
@@ -123,11 +123,12 @@ func (s *Server) validateThreadedParent(req *TaskCreateRequest) (*threadedParent
 		return nil, apiErrorNotFound("parent task not found")
 	}
 	parentBusPath := filepath.Join(parentTaskDir, "TASK-MESSAGE-BUS.md")
-	parentBus, err := messagebus.NewMessageBus(parentBusPath)
+	parentBus, err := messagebus.Open(parentBusPath, "")
 	if err != nil {
 		return nil, apiErrorInternal("open parent message bus", err)
 	}
 	parentMessages, err := parentBus.ReadMessages("")
+	parentBus.Close()
 	if err != nil {
 		return nil, apiErrorInternal("read parent message bus", err)
 	}
@@ -247,11 +248,12 @@ func copyStringMap(values map[string]string) map[string]string {
 	return out
 }
 
-func appendThreadedMessage(busPath string, msg *messagebus.Message) (string, error) {
-	bus, err := messagebus.NewMessageBus(busPath)
+func (s *Server) appendThreadedMessage(busPath string, msg *messagebus.Message) (string, error) {
+	bus, err := s.openWriteBus(busPath)
 	if err != nil {
 		return "", errors.Wrap(err, "open message bus")
 	}
+	defer bus.Close()
 	msgID, err := bus.AppendMessage(msg)
 	if err != nil {
 		return "", errors.Wrap(err, "append message")
@@ -282,7 +284,7 @@ func (s *Server) persistThreadedTaskLinkage(taskDir string, req TaskCreateReques
 	}}
 
 	childBusPath := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
-	childMsgID, err := appendThreadedMessage(childBusPath, &messagebus.Message{
+	childMsgID, err := s.appendThreadedMessage(childBusPath, &messagebus.Message{
 		Type:      req.ThreadMessageType,
 		ProjectID: req.ProjectID,
 		TaskID:    req.TaskID,
@@ -306,7 +308,7 @@ func (s *Server) persistThreadedTaskLinkage(taskDir string, req TaskCreateReques
 
 	sourceBody := fmt.Sprintf("threaded user request opened child task %s/%s", req.ProjectID, req.TaskID)
 	sourceBusPath := filepath.Join(parentTaskDir, "TASK-MESSAGE-BUS.md")
-	if _, err := appendThreadedMessage(sourceBusPath, &messagebus.Message{
+	if _, err := s.appendThreadedMessage(sourceBusPath, &messagebus.Message{
 		Type:      req.ThreadMessageType,
 		ProjectID: parent.Parent.ProjectID,
 		TaskID:    parent.Parent.TaskID,
@@ -0,0 +1,338 @@
+// Package busexport renders message bus contents as human-readable task
+// logs: markdown or standalone HTML for tickets and reviews, and JSON or
+// CSV for tooling. Messages are grouped by run, replies are threaded under
+// the messages they reference in Parents, and RUN_START/RUN_STOP events
+// are collapsed into run headers.
+package busexport
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/pkg/errors"
+)
+
+// Export formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+)
+
+// Formats lists the supported export formats.
+var Formats = []string{FormatMarkdown, FormatHTML, FormatJSON, FormatCSV}
+
+// Options selects and shapes the exported messages.
+type Options struct {
+	// Title heads the markdown and HTML output.
+	Title string
+	// Since and Until bound message timestamps (inclusive) when non-zero.
+	Since time.Time
+	Until time.Time
+	// Types keeps only messages of these types (case-insensitive).
+	Types []string
+	// Filter is applied on top of the other criteria (see messagebus.ParseFilter).
+	Filter *messagebus.Filter
+	// KeepRunEvents lists RUN_START and RUN_STOP messages like any other
+	// message instead of collapsing them into the run headers.
+	KeepRunEvents bool
+}
+
+// Document is an export: the selected messages grouped by run.
+type Document struct {
+	Title    string `json:"title,omitempty"`
+	Messages int    `json:"message_count"`
+	Runs     []*Run `json:"runs"`
+}
+
+// Run groups the messages of one run, in bus order. The group with an
+// empty RunID holds the messages posted outside any run.
+type Run struct {
+	RunID     string     `json:"run_id,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+	// Outcome is the type of the message that ended the run: RUN_STOP or
+	// RUN_CRASH. Summary is the first line of its body.
+	Outcome  string   `json:"outcome,omitempty"`
+	Summary  string   `json:"summary,omitempty"`
+	Messages []*Entry `json:"messages"`
+}
+
+// Duration returns how long the run took, or 0 when it has not both
+// started and stopped.
+func (r *Run) Duration() time.Duration {
+	if r.StartedAt == nil || r.StoppedAt == nil {
+		return 0
+	}
+	return r.StoppedAt.Sub(*r.StartedAt)
+}
+
+// Entry is an exported message with the replies threaded under it.
+type Entry struct {
+	MsgID     string            `json:"msg_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Type      string            `json:"type"`
+	ProjectID string            `json:"project_id"`
+	TaskID    string            `json:"task_id,omitempty"`
+	RunID     string            `json:"run_id,omitempty"`
+	IssueID   string            `json:"issue_id,omitempty"`
+	ToTask    string            `json:"to_task,omitempty"`
+	ToRun     string            `json:"to_run,omitempty"`
+	Parents   []EntryParent     `json:"parents,omitempty"`
+	Links     []EntryLink       `json:"links,omitempty"`
+	Meta      map[string]string `json:"meta,omitempty"`
+	Body      string            `json:"body"`
+	Replies   []*Entry          `json:"replies,omitempty"`
+}
+
+// EntryParent is a parent reference of an exported message.
+type EntryParent struct {
+	MsgID string `json:"msg_id"`
+	Kind  string `json:"kind,omitempty"`
+}
+
+// EntryLink is a link of an exported message.
+type EntryLink struct {
+	URL   string `json:"url"`
+	Label string `json:"label,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+}
+
+// NormalizeFormat validates format and returns its canonical name; an
+// empty format means markdown and "md" is accepted as an alias.
+func NormalizeFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "", "md":
+		return FormatMarkdown, nil
+	case FormatMarkdown, FormatHTML, FormatJSON, FormatCSV:
+		return format, nil
+	}
+	return "", errors.Errorf("unknown export format %q (want %s)", format, strings.Join(Formats, ", "))
+}
+
+// ContentType returns the MIME type of a normalized format.
+func ContentType(format string) string {
+	switch format {
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatJSON:
+		return "application/json"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	}
+	return "text/markdown; charset=utf-8"
+}
+
+// FileExtension returns the file name extension of a normalized format.
+func FileExtension(format string) string {
+	if format == FormatMarkdown {
+		return ".md"
+	}
+	return "." + format
+}
+
+// Export builds the document for messages and writes it to w in format.
+func Export(w io.Writer, messages []*messagebus.Message, format string, opts Options) error {
+	format, err := NormalizeFormat(format)
+	if err != nil {
+		return err
+	}
+	doc := Build(messages, opts)
+	switch format {
+	case FormatHTML:
+		return WriteHTML(w, doc)
+	case FormatJSON:
+		return WriteJSON(w, doc)
+	case FormatCSV:
+		return WriteCSV(w, doc)
+	}
+	return WriteMarkdown(w, doc)
+}
+
+// Build selects the messages matching opts, threads replies under their
+// parents and groups the threads by run. Messages must be in bus order.
+//
+// A message is threaded under the first of its Parents that is exported
+// and precedes it; replies stay with their parent even when they were
+// posted by another run. Run groups are ordered by their first message.
+func Build(messages []*messagebus.Message, opts Options) *Document {
+	doc := &Document{Title: opts.Title, Runs: []*Run{}}
+	runs := make(map[string]*Run)
+	runFor := func(runID string) *Run {
+		run, ok := runs[runID]
+		if !ok {
+			run = &Run{RunID: runID, Messages: []*Entry{}}
+			runs[runID] = run
+			doc.Runs = append(doc.Runs, run)
+		}
+		return run
+	}
+
+	entries := make(map[string]*Entry)
+	for _, msg := range messages {
+		if msg == nil || !opts.selects(msg) {
+			continue
+		}
+		if isRunEvent(msg.Type) && msg.RunID != "" {
+			run := runFor(msg.RunID)
+			run.record(msg)
+			if !opts.KeepRunEvents && !strings.EqualFold(msg.Type, messagebus.EventTypeRunCrash) {
+				// Collapsed into the run header. Crashes stay visible:
+				// their body carries the stderr excerpt.
+				continue
+			}
+		}
+		entry := newEntry(msg)
+		doc.Messages++
+		if parent := threadParent(msg, entries); parent != nil {
+			parent.Replies = append(parent.Replies, entry)
+		} else {
+			run := runFor(msg.RunID)
+			run.Messages = append(run.Messages, entry)
+		}
+		if msg.MsgID != "" {
+			entries[msg.MsgID] = entry
+		}
+	}
+	// Posted-outside-any-run messages come last.
+	sort.SliceStable(doc.Runs, func(i, j int) bool {
+		return doc.Runs[i].RunID != "" && doc.Runs[j].RunID == ""
+	})
+	return doc
+}
+
+func (o Options) selects(msg *messagebus.Message) bool {
+	if !o.Since.IsZero() && msg.Timestamp.Before(o.Since) {
+		return false
+	}
+	if !o.Until.IsZero() && msg.Timestamp.After(o.Until) {
+		return false
+	}
+	if len(o.Types) > 0 {
+		found := false
+		for _, t := range o.Types {
+			if strings.EqualFold(strings.TrimSpace(t), msg.Type) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return o.Filter.Match(msg)
+}
+
+func isRunEvent(msgType string) bool {
+	switch strings.ToUpper(msgType) {
+	case messagebus.EventTypeRunStart, messagebus.EventTypeRunStop, messagebus.EventTypeRunCrash:
+		return true
+	}
+	return false
+}
+
+// record fills the run header from a lifecycle event.
+func (r *Run) record(msg *messagebus.Message) {
+	ts := msg.Timestamp
+	if strings.EqualFold(msg.Type, messagebus.EventTypeRunStart) {
+		if r.StartedAt == nil {
+			r.StartedAt = &ts
+		}
+		return
+	}
+	r.StoppedAt = &ts
+	r.Outcome = strings.ToUpper(msg.Type)
+	r.Summary = firstLine(msg.Body)
+}
+
+func threadParent(msg *messagebus.Message, entries map[string]*Entry) *Entry {
+	for _, p := range msg.Parents {
+		if entry, ok := entries[p.MsgID]; ok {
+			return entry
+		}
+	}
+	return nil
+}
+
+func newEntry(msg *messagebus.Message) *Entry {
+	entry := &Entry{
+		MsgID:     msg.MsgID,
+		Timestamp: msg.Timestamp,
+		Type:      msg.Type,
+		ProjectID: msg.ProjectID,
+		TaskID:    msg.TaskID,
+		RunID:     msg.RunID,
+		IssueID:   msg.IssueID,
+		ToTask:    msg.ToTask,
+		ToRun:     msg.ToRun,
+		Meta:      msg.Meta,
+		Body:      strings.TrimRight(msg.Body, "\n"),
+	}
+	for _, p := range msg.Parents {
+		entry.Parents = append(entry.Parents, EntryParent{MsgID: p.MsgID, Kind: p.Kind})
+	}
+	for _, l := range msg.Links {
+		entry.Links = append(entry.Links, EntryLink{URL: l.URL, Label: l.Label, Kind: l.Kind})
+	}
+	return entry
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(line)
+}
+
+// walk visits the entries of run depth-first, in document order.
+func (r *Run) walk(fn func(e *Entry, depth int)) {
+	var visit func(entries []*Entry, depth int)
+	visit = func(entries []*Entry, depth int) {
+		for _, e := range entries {
+			fn(e, depth)
+			visit(e.Replies, depth+1)
+		}
+	}
+	visit(r.Messages, 0)
+}
+
+// runHeading is the heading of a run group.
+func runHeading(r *Run) string {
+	if r.RunID == "" {
+		return "Messages outside runs"
+	}
+	return "Run " + r.RunID
+}
+
+// runDetails describes the run lifecycle for its header, e.g.
+// "started 2026-01-02 10:00:00 UTC · stopped after 5m0s · run stopped with code 0".
+func runDetails(r *Run) string {
+	var parts []string
+	if r.StartedAt != nil {
+		parts = append(parts, "started "+formatTime(*r.StartedAt))
+	}
+	if r.StoppedAt != nil {
+		verb := "stopped"
+		if r.Outcome == messagebus.EventTypeRunCrash {
+			verb = "crashed"
+		}
+		if d := r.Duration(); d > 0 {
+			parts = append(parts, verb+" after "+d.Round(time.Second).String())
+		} else {
+			parts = append(parts, verb+" "+formatTime(*r.StoppedAt))
+		}
+	} else if r.StartedAt != nil {
+		parts = append(parts, "no stop event")
+	}
+	if r.Summary != "" {
+		parts = append(parts, r.Summary)
+	}
+	return strings.Join(parts, " · ")
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
@@ -0,0 +1,141 @@
+package busexport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+)
+
+func testMessages() []*messagebus.Message {
+	base := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	msg := func(id string, offset time.Duration, msgType, runID, body string, parents ...string) *messagebus.Message {
+		m := &messagebus.Message{MsgID: id, Timestamp: base.Add(offset), Type: msgType, ProjectID: "p", TaskID: "t", RunID: runID, Body: body}
+		for _, p := range parents {
+			m.Parents = append(m.Parents, messagebus.Parent{MsgID: p})
+		}
+		return m
+	}
+	return []*messagebus.Message{
+		msg("m1", 0, "RUN_START", "run-1", "run started\nrun_dir: /x"),
+		msg("m2", time.Minute, "QUESTION", "run-1", "Which <DB>?"),
+		msg("m3", 2*time.Minute, "USER", "", "an unrelated note"),
+		msg("m4", 3*time.Minute, "ANSWER", "", "staging", "m2"),
+		msg("m5", 4*time.Minute, "FACT", "run-1", "uses staging\n\nsecond paragraph"),
+		msg("m6", 5*time.Minute, "RUN_STOP", "run-1", "run stopped with code 0\nrun_dir: /x"),
+		msg("m7", 6*time.Minute, "RUN_START", "run-2", "run started"),
+		msg("m8", 7*time.Minute, "RUN_CRASH", "run-2", "run stopped with code 1\n## stderr"),
+	}
+}
+
+func TestBuildGroupsThreadsAndCollapses(t *testing.T) {
+	doc := Build(testMessages(), Options{})
+	if doc.Messages != 5 {
+		t.Fatalf("Messages = %d, want 5", doc.Messages)
+	}
+	if len(doc.Runs) != 3 || doc.Runs[0].RunID != "run-1" || doc.Runs[1].RunID != "run-2" || doc.Runs[2].RunID != "" {
+		t.Fatalf("unexpected run groups: %+v", doc.Runs)
+	}
+	run1 := doc.Runs[0]
+	if run1.Duration() != 5*time.Minute || run1.Outcome != "RUN_STOP" || run1.Summary != "run stopped with code 0" {
+		t.Fatalf("run-1 header = %+v", run1)
+	}
+	if len(run1.Messages) != 2 || run1.Messages[0].MsgID != "m2" || run1.Messages[1].MsgID != "m5" {
+		t.Fatalf("run-1 messages = %+v", run1.Messages)
+	}
+	if replies := run1.Messages[0].Replies; len(replies) != 1 || replies[0].MsgID != "m4" {
+		t.Fatalf("answer not threaded under the question: %+v", replies)
+	}
+	// Crashes stay visible next to the collapsed header.
+	if run2 := doc.Runs[1]; run2.Outcome != "RUN_CRASH" || len(run2.Messages) != 1 || run2.Messages[0].MsgID != "m8" {
+		t.Fatalf("run-2 = %+v", run2)
+	}
+
+	kept := Build(testMessages(), Options{KeepRunEvents: true})
+	if kept.Messages != 8 || kept.Runs[0].Messages[0].Type != "RUN_START" {
+		t.Fatalf("KeepRunEvents: %d messages, first %+v", kept.Messages, kept.Runs[0].Messages[0])
+	}
+}
+
+func TestBuildFilters(t *testing.T) {
+	base := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	doc := Build(testMessages(), Options{Types: []string{"fact", "answer"}})
+	if doc.Messages != 2 || len(doc.Runs) != 2 {
+		t.Fatalf("type filter: %d messages in %d runs", doc.Messages, len(doc.Runs))
+	}
+	doc = Build(testMessages(), Options{Since: base.Add(2 * time.Minute), Until: base.Add(4 * time.Minute)})
+	if doc.Messages != 3 {
+		t.Fatalf("time range: %d messages, want 3", doc.Messages)
+	}
+	// The question is outside the range, so the answer is a top-level message.
+	if got := doc.Runs[len(doc.Runs)-1].Messages; len(got) != 2 || got[1].MsgID != "m4" {
+		t.Fatalf("orphaned answer = %+v", got)
+	}
+	filter, err := messagebus.ParseFilter("body ~ staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc := Build(testMessages(), Options{Filter: filter}); doc.Messages != 2 {
+		t.Fatalf("where filter: %d messages, want 2", doc.Messages)
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, testMessages(), "md", Options{Title: "p/t"}); err != nil {
+		t.Fatal(err)
+	}
+	md := buf.String()
+	for _, want := range []string{
+		"# p/t\n",
+		"## Run run-1\n\nstarted 2026-01-02 10:00:00 UTC · stopped after 5m0s · run stopped with code 0\n",
+		"- **QUESTION** · 2026-01-02 10:01:00 UTC · `m2`\n\n  Which <DB>?\n",
+		"  - **ANSWER** · 2026-01-02 10:03:00 UTC · `m4`\n\n    staging\n",
+		"  uses staging\n\n  second paragraph\n",
+		"## Messages outside runs\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown missing %q:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "RUN_START") {
+		t.Errorf("markdown lists collapsed run events:\n%s", md)
+	}
+
+	buf.Reset()
+	if err := Export(&buf, testMessages(), FormatHTML, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if html := buf.String(); !strings.Contains(html, "Which &lt;DB&gt;?") || !strings.Contains(html, `<ul class="thread">`) {
+		t.Fatalf("html not escaped or threaded:\n%s", html)
+	}
+
+	buf.Reset()
+	if err := Export(&buf, testMessages(), FormatJSON, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var doc Document
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil || doc.Runs[0].Messages[0].Replies[0].MsgID != "m4" {
+		t.Fatalf("json round trip: %v %+v", err, doc)
+	}
+
+	buf.Reset()
+	if err := Export(&buf, testMessages(), FormatCSV, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 6 {
+		t.Fatalf("csv rows = %d, %v", len(rows), err)
+	}
+	if row := rows[2]; row[1] != "m4" || row[6] != "1" || row[7] != "m2" {
+		t.Fatalf("csv reply row = %v", row)
+	}
+
+	if err := Export(&buf, nil, "pdf", Options{}); err == nil {
+		t.Fatal("expected unknown format error")
+	}
+}
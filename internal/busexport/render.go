@@ -0,0 +1,176 @@
+package busexport
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WriteMarkdown renders doc as a markdown task log: one section per run,
+// one list item per message, replies nested under their parents.
+func WriteMarkdown(w io.Writer, doc *Document) error {
+	bw := bufio.NewWriter(w)
+	title := doc.Title
+	if title == "" {
+		title = "Message bus export"
+	}
+	fmt.Fprintf(bw, "# %s\n\n", title)
+	fmt.Fprintf(bw, "%s in %s.\n", plural(doc.Messages, "message"), plural(len(doc.Runs), "group"))
+	for _, run := range doc.Runs {
+		fmt.Fprintf(bw, "\n## %s\n", runHeading(run))
+		if details := runDetails(run); details != "" {
+			fmt.Fprintf(bw, "\n%s\n", details)
+		}
+		var items strings.Builder
+		run.walk(func(e *Entry, depth int) {
+			indent := strings.Repeat("  ", depth)
+			fmt.Fprintf(&items, "%s- **%s** · %s · `%s`", indent, e.Type, formatTime(e.Timestamp), e.MsgID)
+			if e.RunID != "" && e.RunID != run.RunID {
+				fmt.Fprintf(&items, " · run `%s`", e.RunID)
+			}
+			items.WriteString("\n")
+			if e.Body != "" {
+				items.WriteString("\n")
+				for _, line := range strings.Split(e.Body, "\n") {
+					if strings.TrimSpace(line) == "" {
+						items.WriteString("\n")
+						continue
+					}
+					fmt.Fprintf(&items, "%s  %s\n", indent, line)
+				}
+				items.WriteString("\n")
+			}
+			for _, l := range e.Links {
+				label := l.Label
+				if label == "" {
+					label = l.URL
+				}
+				fmt.Fprintf(&items, "%s  - [%s](%s)\n", indent, label, l.URL)
+			}
+		})
+		if items.Len() > 0 {
+			fmt.Fprintf(bw, "\n%s\n", strings.TrimRight(items.String(), "\n"))
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteJSON writes doc as indented JSON.
+func WriteJSON(w io.Writer, doc *Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(doc), "encode export")
+}
+
+// csvHeader is the column list of WriteCSV.
+var csvHeader = []string{"run_id", "msg_id", "timestamp", "type", "project_id", "task_id", "depth", "parents", "body"}
+
+// WriteCSV writes one row per exported message in document order. depth
+// is the thread nesting level and run_id the group the row belongs to.
+func WriteCSV(w io.Writer, doc *Document) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return errors.Wrap(err, "write csv")
+	}
+	for _, run := range doc.Runs {
+		var writeErr error
+		run.walk(func(e *Entry, depth int) {
+			if writeErr != nil {
+				return
+			}
+			parents := make([]string, 0, len(e.Parents))
+			for _, p := range e.Parents {
+				parents = append(parents, p.MsgID)
+			}
+			writeErr = cw.Write([]string{
+				run.RunID,
+				e.MsgID,
+				e.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+				e.Type,
+				e.ProjectID,
+				e.TaskID,
+				strconv.Itoa(depth),
+				strings.Join(parents, " "),
+				e.Body,
+			})
+		})
+		if writeErr != nil {
+			return errors.Wrap(writeErr, "write csv")
+		}
+	}
+	cw.Flush()
+	return errors.Wrap(cw.Error(), "write csv")
+}
+
+// WriteHTML renders doc as a standalone HTML page.
+func WriteHTML(w io.Writer, doc *Document) error {
+	title := doc.Title
+	if title == "" {
+		title = "Message bus export"
+	}
+	return errors.Wrap(htmlTemplate.Execute(w, map[string]interface{}{
+		"Title":   title,
+		"Summary": plural(doc.Messages, "message") + " in " + plural(len(doc.Runs), "group"),
+		"Doc":     doc,
+	}), "render html")
+}
+
+var htmlTemplate = template.Must(template.New("export").Funcs(template.FuncMap{
+	"heading": runHeading,
+	"details": runDetails,
+	"time":    formatTime,
+	"typeClass": func(t string) string {
+		return "type-" + strings.ToLower(t)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 960px; color: #1f2328; }
+h2 { border-bottom: 1px solid #d0d7de; padding-bottom: .3em; margin-top: 2em; }
+.run-details, .summary { color: #59636e; }
+ul.thread { list-style: none; padding-left: 0; }
+ul.thread ul.thread { padding-left: 1.5em; border-left: 2px solid #d0d7de; margin-left: .5em; }
+.msg { margin: .75em 0; }
+.msg-head { font-size: 90%; color: #59636e; }
+.msg-type { font-weight: 600; color: #1f2328; }
+.type-error .msg-type, .type-run_crash .msg-type { color: #cf222e; }
+.type-question .msg-type { color: #9a6700; }
+.type-answer .msg-type, .type-decision .msg-type { color: #1a7f37; }
+pre.body { white-space: pre-wrap; background: #f6f8fa; padding: .5em .75em; border-radius: 6px; margin: .3em 0; }
+code { font-size: 85%; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="summary">{{.Summary}}</p>
+{{range .Doc.Runs}}<section>
+<h2>{{heading .}}</h2>
+{{with details .}}<p class="run-details">{{.}}</p>
+{{end}}{{template "thread" .Messages}}</section>
+{{end}}</body>
+</html>
+{{define "thread"}}{{if .}}<ul class="thread">
+{{range .}}<li class="msg {{typeClass .Type}}" id="{{.MsgID}}">
+<div class="msg-head"><span class="msg-type">{{.Type}}</span> · {{time .Timestamp}} · <code>{{.MsgID}}</code>{{with .RunID}} · run <code>{{.}}</code>{{end}}</div>
+{{with .Body}}<pre class="body">{{.}}</pre>
+{{end}}{{range .Links}}<div class="link"><a href="{{.URL}}">{{if .Label}}{{.Label}}{{else}}{{.URL}}{{end}}</a></div>
+{{end}}{{template "thread" .Replies}}</li>
+{{end}}</ul>
+{{end}}{{end}}`))
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return strconv.Itoa(n) + " " + noun + "s"
+}
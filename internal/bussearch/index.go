@@ -0,0 +1,599 @@
+// Package bussearch maintains a full-text index over every message bus under
+// a runs root and answers cross-project queries against it.
+//
+// The index lives in <root>/.search. It is a cache: deleting the directory
+// is always safe and the next Update rebuilds it from the bus files. The
+// manifest records, per bus, how many bytes have been indexed so that an
+// update only reads what was appended since the previous one. New messages
+// are written to an immutable segment (a docs file plus a sorted terms
+// file); segments are merged once there are too many of them.
+package bussearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DirName is the index directory under the runs root. Project IDs cannot
+	// start with a dot, so it never collides with a project.
+	DirName = ".search"
+
+	manifestName    = "manifest.json"
+	lockName        = "lock"
+	manifestVersion = 1
+	maxSegments     = 8
+	lockTimeout     = 30 * time.Second
+
+	minTermLen = 2
+	maxTermLen = 64
+)
+
+// busState tracks how far a single bus file has been indexed. Gen is unique
+// across the index lifetime: when a bus is truncated, rotated or recreated
+// it gets a new generation and documents of older generations become dead.
+type busState struct {
+	Gen     int64  `json:"gen"`
+	Offset  int64  `json:"offset"`
+	FirstID string `json:"first_id,omitempty"`
+}
+
+type manifest struct {
+	Version  int                  `json:"version"`
+	NextDoc  int64                `json:"next_doc"`
+	NextGen  int64                `json:"next_gen"`
+	NextSeg  int64                `json:"next_seg"`
+	Segments []string             `json:"segments"`
+	Buses    map[string]*busState `json:"buses"`
+}
+
+// doc is one indexed message. Offset points at the message's opening "---"
+// line in the bus file so that hits can be re-read for filtering and
+// snippets without rescanning the bus.
+type doc struct {
+	id        int64
+	bus       string
+	gen       int64
+	offset    int64
+	msgID     string
+	msgType   string
+	project   string
+	task      string
+	run       string
+	timestamp time.Time
+}
+
+// UpdateStats summarizes the work done by Update.
+type UpdateStats struct {
+	Buses    int `json:"buses"`
+	Messages int `json:"messages"`
+}
+
+// Update indexes every message appended to the buses under root since the
+// previous update.
+func Update(root string) (UpdateStats, error) {
+	var stats UpdateStats
+	err := withLock(root, func(dir string) error {
+		var err error
+		stats, err = update(root, dir)
+		return err
+	})
+	return stats, err
+}
+
+// Rebuild discards the index and indexes every bus under root from scratch.
+func Rebuild(root string) (UpdateStats, error) {
+	var stats UpdateStats
+	err := withLock(root, func(dir string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return errors.Wrap(err, "read search index dir")
+		}
+		for _, entry := range entries {
+			if entry.Name() == lockName {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return errors.Wrap(err, "remove search index file")
+			}
+		}
+		stats, err = update(root, dir)
+		return err
+	})
+	return stats, err
+}
+
+func withLock(root string, fn func(dir string) error) error {
+	if strings.TrimSpace(root) == "" {
+		return errors.New("runs root is empty")
+	}
+	dir := filepath.Join(root, DirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrap(err, "create search index dir")
+	}
+	lock, err := os.OpenFile(filepath.Join(dir, lockName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "open search index lock")
+	}
+	defer lock.Close()
+	if err := messagebus.LockExclusive(lock, lockTimeout); err != nil {
+		return errors.Wrap(err, "lock search index")
+	}
+	defer messagebus.Unlock(lock)
+	return fn(dir)
+}
+
+func update(root, dir string) (UpdateStats, error) {
+	var stats UpdateStats
+	m, err := readManifest(dir)
+	if err != nil {
+		return stats, err
+	}
+	buses, err := discoverBuses(root)
+	if err != nil {
+		return stats, err
+	}
+
+	seen := make(map[string]bool, len(buses))
+	var docs []doc
+	terms := make(map[string][]int64)
+	changed := false
+	for _, rel := range buses {
+		seen[rel] = true
+		state, fresh, err := m.catchUp(root, rel)
+		if err != nil {
+			return stats, err
+		}
+		if fresh {
+			changed = true
+		}
+		added, end, err := indexBus(root, rel, state, &m.NextDoc, terms)
+		if err != nil {
+			return stats, err
+		}
+		if end != state.Offset {
+			state.Offset = end
+			changed = true
+		}
+		if len(added) > 0 {
+			stats.Buses++
+			stats.Messages += len(added)
+			docs = append(docs, added...)
+		}
+	}
+	for rel := range m.Buses {
+		if !seen[rel] {
+			delete(m.Buses, rel)
+			changed = true
+		}
+	}
+	if !changed {
+		return stats, nil
+	}
+
+	var obsolete []string
+	if len(docs) > 0 {
+		name := fmt.Sprintf("seg-%06d", m.NextSeg)
+		m.NextSeg++
+		if err := writeSegment(dir, name, docs, terms); err != nil {
+			return stats, err
+		}
+		m.Segments = append(m.Segments, name)
+	}
+	if len(m.Segments) > maxSegments {
+		name := fmt.Sprintf("seg-%06d", m.NextSeg)
+		m.NextSeg++
+		if err := mergeSegments(dir, name, m); err != nil {
+			return stats, err
+		}
+		obsolete = m.Segments
+		m.Segments = []string{name}
+	}
+	if err := writeManifest(dir, m); err != nil {
+		return stats, err
+	}
+	for _, name := range obsolete {
+		_ = os.Remove(filepath.Join(dir, name+".docs"))
+		_ = os.Remove(filepath.Join(dir, name+".terms"))
+	}
+	return stats, nil
+}
+
+// catchUp returns the state for rel, starting a new generation when the bus
+// no longer extends what was indexed before.
+func (m *manifest) catchUp(root, rel string) (*busState, bool, error) {
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "stat message bus")
+	}
+	state := m.Buses[rel]
+	if state != nil && state.Offset > 0 {
+		if info.Size() < state.Offset || firstMessageID(path) != state.FirstID {
+			state = nil
+		}
+	}
+	if state != nil {
+		return state, false, nil
+	}
+	state = &busState{Gen: m.NextGen}
+	m.NextGen++
+	m.Buses[rel] = state
+	return state, true, nil
+}
+
+func firstMessageID(path string) string {
+	bus, err := messagebus.NewMessageBus(path, messagebus.WithIndex(false))
+	if err != nil {
+		return ""
+	}
+	msg, err := bus.ReadMessageAt(0)
+	if err != nil {
+		return ""
+	}
+	return msg.MsgID
+}
+
+// indexBus reads the messages appended to rel since state.Offset, adding
+// their postings to terms.
+func indexBus(root, rel string, state *busState, nextDoc *int64, terms map[string][]int64) ([]doc, int64, error) {
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	// The index addresses messages by byte offset in the markdown file, which
+	// every backend writes, so it reads the file rather than opening the bus.
+	bus, err := messagebus.NewMessageBus(path, messagebus.WithIndex(false))
+	if err != nil {
+		return nil, state.Offset, errors.Wrap(err, "open message bus")
+	}
+	project, task := busScope(rel)
+	var docs []doc
+	end, err := bus.ScanFrom(state.Offset, func(msg *messagebus.Message, offset int64) error {
+		if offset == 0 {
+			state.FirstID = msg.MsgID
+		}
+		d := doc{
+			id:        *nextDoc,
+			bus:       rel,
+			gen:       state.Gen,
+			offset:    offset,
+			msgID:     msg.MsgID,
+			msgType:   msg.Type,
+			project:   project,
+			task:      task,
+			run:       msg.RunID,
+			timestamp: msg.Timestamp.UTC(),
+		}
+		if d.task == "" {
+			d.task = msg.TaskID
+		}
+		for _, term := range messageTerms(msg) {
+			terms[term] = append(terms[term], d.id)
+		}
+		*nextDoc++
+		docs = append(docs, d)
+		return nil
+	})
+	if err != nil {
+		return nil, state.Offset, errors.Wrapf(err, "index %s", rel)
+	}
+	return docs, end, nil
+}
+
+// busScope derives the project and task from a bus path relative to the
+// runs root: <project>/PROJECT-MESSAGE-BUS.md or
+// <project>/<task>/TASK-MESSAGE-BUS.md (and their archives).
+func busScope(rel string) (project, task string) {
+	parts := strings.Split(rel, "/")
+	switch len(parts) {
+	case 2:
+		return parts[0], ""
+	case 3:
+		return parts[0], parts[1]
+	}
+	return "", ""
+}
+
+// discoverBuses lists project and task bus files, including archives left
+// by rotation and compaction segments, as slash-separated paths relative to
+// root.
+func discoverBuses(root string) ([]string, error) {
+	projects, err := os.ReadDir(root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read runs root")
+	}
+	var buses []string
+	for _, project := range projects {
+		if !project.IsDir() || strings.HasPrefix(project.Name(), ".") {
+			continue
+		}
+		projectDir := filepath.Join(root, project.Name())
+		entries, err := os.ReadDir(projectDir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() {
+				if strings.HasPrefix(name, ".") {
+					continue
+				}
+				taskEntries, err := os.ReadDir(filepath.Join(projectDir, name))
+				if err != nil {
+					continue
+				}
+				for _, te := range taskEntries {
+					if te.Type().IsRegular() && isBusFile(te.Name(), "TASK-MESSAGE-BUS.md") {
+						buses = append(buses, project.Name()+"/"+name+"/"+te.Name())
+					}
+				}
+				continue
+			}
+			if entry.Type().IsRegular() && isBusFile(name, "PROJECT-MESSAGE-BUS.md") {
+				buses = append(buses, project.Name()+"/"+name)
+			}
+		}
+	}
+	sort.Strings(buses)
+	return buses, nil
+}
+
+func isBusFile(name, base string) bool {
+	if name == base || strings.HasPrefix(name, base+".archive-") {
+		return true
+	}
+	return strings.HasPrefix(name, base+".") && strings.HasSuffix(name, ".archived")
+}
+
+func readManifest(dir string) (*manifest, error) {
+	m := &manifest{Version: manifestVersion, Buses: map[string]*busState{}}
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, errors.Wrap(err, "read search manifest")
+	}
+	var loaded manifest
+	if err := json.Unmarshal(data, &loaded); err != nil || loaded.Version != manifestVersion {
+		// An unreadable manifest only costs a full reindex.
+		return m, nil
+	}
+	if loaded.Buses == nil {
+		loaded.Buses = map[string]*busState{}
+	}
+	return &loaded, nil
+}
+
+func writeManifest(dir string, m *manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode search manifest")
+	}
+	return writeFileAtomic(filepath.Join(dir, manifestName), append(data, '\n'))
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return errors.Wrap(err, "write search index file")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "replace search index file")
+	}
+	return nil
+}
+
+// live reports whether d belongs to the current generation of its bus.
+func (m *manifest) live(d doc) bool {
+	state, ok := m.Buses[d.bus]
+	return ok && state.Gen == d.gen
+}
+
+// writeSegment writes docs and the postings of every term.
+func writeSegment(dir, name string, docs []doc, terms map[string][]int64) error {
+	var docsBuf strings.Builder
+	for _, d := range docs {
+		docsBuf.WriteString(formatDoc(d))
+	}
+	keys := make([]string, 0, len(terms))
+	for term := range terms {
+		keys = append(keys, term)
+	}
+	sort.Strings(keys)
+	var termsBuf strings.Builder
+	for _, term := range keys {
+		postings := terms[term]
+		sort.Slice(postings, func(i, j int) bool { return postings[i] < postings[j] })
+		termsBuf.WriteString(term)
+		termsBuf.WriteByte('\t')
+		for i, id := range postings {
+			if i > 0 {
+				termsBuf.WriteByte(',')
+			}
+			termsBuf.WriteString(strconv.FormatInt(id, 10))
+		}
+		termsBuf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(filepath.Join(dir, name+".docs"), []byte(docsBuf.String())); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, name+".terms"), []byte(termsBuf.String()))
+}
+
+// mergeSegments combines every segment in m into name, dropping documents
+// that are no longer live.
+func mergeSegments(dir, name string, m *manifest) error {
+	var docs []doc
+	liveIDs := make(map[int64]bool)
+	terms := make(map[string][]int64)
+	for _, seg := range m.Segments {
+		err := readDocs(dir, seg, func(d doc) {
+			if m.live(d) {
+				docs = append(docs, d)
+				liveIDs[d.id] = true
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, seg := range m.Segments {
+		err := readTerms(dir, seg, func(string) bool { return true }, func(term string, postings []int64) {
+			for _, id := range postings {
+				if liveIDs[id] {
+					terms[term] = append(terms[term], id)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return writeSegment(dir, name, docs, terms)
+}
+
+func formatDoc(d doc) string {
+	return strings.Join([]string{
+		strconv.FormatInt(d.id, 10),
+		d.bus,
+		strconv.FormatInt(d.gen, 10),
+		strconv.FormatInt(d.offset, 10),
+		d.msgID,
+		d.msgType,
+		d.project,
+		d.task,
+		d.run,
+		d.timestamp.Format(time.RFC3339Nano),
+	}, "\t") + "\n"
+}
+
+func parseDoc(line string) (doc, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 10 {
+		return doc{}, errors.Errorf("malformed search doc %q", line)
+	}
+	var d doc
+	var err error
+	if d.id, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return doc{}, errors.Wrap(err, "parse doc id")
+	}
+	d.bus = fields[1]
+	if d.gen, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return doc{}, errors.Wrap(err, "parse doc generation")
+	}
+	if d.offset, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+		return doc{}, errors.Wrap(err, "parse doc offset")
+	}
+	d.msgID, d.msgType, d.project, d.task, d.run = fields[4], fields[5], fields[6], fields[7], fields[8]
+	if fields[9] != "" {
+		d.timestamp, _ = time.Parse(time.RFC3339Nano, fields[9])
+	}
+	return d, nil
+}
+
+func readDocs(dir, seg string, fn func(doc)) error {
+	return readLines(filepath.Join(dir, seg+".docs"), func(line string) error {
+		d, err := parseDoc(line)
+		if err != nil {
+			return err
+		}
+		fn(d)
+		return nil
+	})
+}
+
+// readTerms calls fn with the postings of every term accepted by want.
+func readTerms(dir, seg string, want func(term string) bool, fn func(term string, postings []int64)) error {
+	return readLines(filepath.Join(dir, seg+".terms"), func(line string) error {
+		term, list, ok := strings.Cut(line, "\t")
+		if !ok {
+			return errors.Errorf("malformed search term line %q", line)
+		}
+		if !want(term) {
+			return nil
+		}
+		parts := strings.Split(list, ",")
+		postings := make([]int64, 0, len(parts))
+		for _, part := range parts {
+			id, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				return errors.Wrap(err, "parse posting")
+			}
+			postings = append(postings, id)
+		}
+		fn(term, postings)
+		return nil
+	})
+}
+
+func readLines(path string, fn func(line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "open search index file")
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+	}
+	return errors.Wrap(scanner.Err(), "read search index file")
+}
+
+// messageTerms returns the distinct terms indexed for msg: its body, type
+// and meta values.
+func messageTerms(msg *messagebus.Message) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	add := func(text string) {
+		for _, term := range tokenize(text) {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	add(msg.Body)
+	add(msg.Type)
+	for _, value := range msg.Meta {
+		add(value)
+	}
+	return terms
+}
+
+// tokenize splits text into lower-case runs of letters and digits. Tokens
+// shorter than two runes are dropped and long ones are truncated.
+func tokenize(text string) []string {
+	var tokens []string
+	for _, field := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		runes := []rune(field)
+		if len(runes) < minTermLen {
+			continue
+		}
+		if len(runes) > maxTermLen {
+			runes = runes[:maxTermLen]
+		}
+		tokens = append(tokens, string(runes))
+	}
+	return tokens
+}
@@ -0,0 +1,303 @@
+package bussearch
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultLimit is the number of hits returned when Options.Limit is unset.
+	DefaultLimit = 20
+
+	snippetRadius = 80
+)
+
+// ErrInvalidQuery is wrapped by the errors Search returns for malformed
+// query strings.
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// Options narrows a search.
+type Options struct {
+	// Project restricts hits to a single project.
+	Project string
+	// Filter is applied to every candidate message (see messagebus.ParseFilter).
+	Filter *messagebus.Filter
+	// Limit caps the number of hits; DefaultLimit when <= 0.
+	Limit int
+}
+
+// Hit is a message matching a search query, with its scope and a snippet
+// of the body around the first matching term.
+type Hit struct {
+	ProjectID string    `json:"project_id"`
+	TaskID    string    `json:"task_id,omitempty"`
+	RunID     string    `json:"run_id,omitempty"`
+	MsgID     string    `json:"msg_id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Bus       string    `json:"bus"`
+	Snippet   string    `json:"snippet"`
+}
+
+// query is a parsed search string: every term must match a message term
+// (prefix terms end with "*") and every quoted phrase must occur in the body.
+type query struct {
+	terms    []string
+	prefixes []string
+	phrases  []string
+}
+
+// parseQuery splits q into words and "quoted phrases". Words are tokenized
+// like message text, so "build-failed" requires both "build" and "failed".
+func parseQuery(q string) (query, error) {
+	var parsed query
+	rest := q
+	for {
+		start := strings.IndexByte(rest, '"')
+		if start < 0 {
+			parsed.addWords(rest)
+			break
+		}
+		end := strings.IndexByte(rest[start+1:], '"')
+		if end < 0 {
+			return query{}, errors.Wrap(ErrInvalidQuery, "unterminated quoted phrase")
+		}
+		parsed.addWords(rest[:start])
+		phrase := strings.TrimSpace(rest[start+1 : start+1+end])
+		if phrase != "" {
+			parsed.phrases = append(parsed.phrases, normalizeText(phrase))
+			parsed.terms = append(parsed.terms, tokenize(phrase)...)
+		}
+		rest = rest[start+1+end+1:]
+	}
+	if len(parsed.terms) == 0 && len(parsed.prefixes) == 0 {
+		return query{}, errors.Wrap(ErrInvalidQuery, "no searchable terms (terms need at least two letters or digits)")
+	}
+	return parsed, nil
+}
+
+func (q *query) addWords(text string) {
+	for _, word := range strings.Fields(text) {
+		if strings.HasSuffix(word, "*") {
+			tokens := tokenize(strings.TrimSuffix(word, "*"))
+			if len(tokens) > 0 {
+				q.terms = append(q.terms, tokens[:len(tokens)-1]...)
+				q.prefixes = append(q.prefixes, tokens[len(tokens)-1])
+			}
+			continue
+		}
+		q.terms = append(q.terms, tokenize(word)...)
+	}
+}
+
+// highlights returns the lower-case strings a snippet should center on.
+func (q query) highlights() []string {
+	out := append([]string{}, q.phrases...)
+	out = append(out, q.terms...)
+	return append(out, q.prefixes...)
+}
+
+// Search brings the index under root up to date and returns the messages
+// matching q, newest first.
+func Search(root, q string, opts Options) ([]Hit, error) {
+	parsed, err := parseQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	var hits []Hit
+	err = withLock(root, func(dir string) error {
+		if _, err := update(root, dir); err != nil {
+			return err
+		}
+		m, err := readManifest(dir)
+		if err != nil {
+			return err
+		}
+		candidates, err := findCandidates(dir, m, parsed, opts.Project)
+		if err != nil {
+			return err
+		}
+		hits, err = resolveHits(root, candidates, parsed, opts.Filter, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+// findCandidates returns the live documents containing every query term.
+func findCandidates(dir string, m *manifest, q query, project string) ([]doc, error) {
+	var candidates []doc
+	for _, seg := range m.Segments {
+		matched, err := segmentMatches(dir, seg, q)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		err = readDocs(dir, seg, func(d doc) {
+			if matched[d.id] && m.live(d) && (project == "" || d.project == project) {
+				candidates = append(candidates, d)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if !candidates[i].timestamp.Equal(candidates[j].timestamp) {
+			return candidates[i].timestamp.After(candidates[j].timestamp)
+		}
+		return candidates[i].id > candidates[j].id
+	})
+	return candidates, nil
+}
+
+// segmentMatches intersects the postings of the query terms in one segment.
+func segmentMatches(dir, seg string, q query) (map[int64]bool, error) {
+	wanted := len(q.terms) + len(q.prefixes)
+	sets := make([]map[int64]bool, wanted)
+	for i := range sets {
+		sets[i] = make(map[int64]bool)
+	}
+	termSlots := make(map[string][]int)
+	for i, term := range q.terms {
+		termSlots[term] = append(termSlots[term], i)
+	}
+	slotsFor := func(term string) []int {
+		slots := termSlots[term]
+		for i, prefix := range q.prefixes {
+			if strings.HasPrefix(term, prefix) {
+				slots = append(slots, len(q.terms)+i)
+			}
+		}
+		return slots
+	}
+	err := readTerms(dir, seg, func(term string) bool {
+		return len(slotsFor(term)) > 0
+	}, func(term string, postings []int64) {
+		for _, slot := range slotsFor(term) {
+			for _, id := range postings {
+				sets[slot][id] = true
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+	matched := sets[0]
+	for _, set := range sets[1:] {
+		for id := range matched {
+			if !set[id] {
+				delete(matched, id)
+			}
+		}
+	}
+	return matched, nil
+}
+
+// resolveHits re-reads candidate messages, newest first, applying phrases
+// and the filter until limit hits are found.
+func resolveHits(root string, candidates []doc, q query, filter *messagebus.Filter, limit int) ([]Hit, error) {
+	buses := make(map[string]*messagebus.MessageBus)
+	hits := make([]Hit, 0, limit)
+	for _, d := range candidates {
+		if len(hits) >= limit {
+			break
+		}
+		bus := buses[d.bus]
+		if bus == nil {
+			var err error
+			bus, err = messagebus.NewMessageBus(filepath.Join(root, filepath.FromSlash(d.bus)), messagebus.WithIndex(false))
+			if err != nil {
+				return nil, errors.Wrap(err, "open message bus")
+			}
+			buses[d.bus] = bus
+		}
+		msg, err := bus.ReadMessageAt(d.offset)
+		if err != nil || msg.MsgID != d.msgID {
+			// The bus changed under the index; the next update will catch up.
+			continue
+		}
+		if !containsAll(normalizeText(msg.Body), q.phrases) {
+			continue
+		}
+		if filter != nil && !filter.Match(msg) {
+			continue
+		}
+		hits = append(hits, Hit{
+			ProjectID: d.project,
+			TaskID:    d.task,
+			RunID:     msg.RunID,
+			MsgID:     msg.MsgID,
+			Type:      msg.Type,
+			Timestamp: msg.Timestamp,
+			Bus:       d.bus,
+			Snippet:   snippet(msg.Body, q.highlights()),
+		})
+	}
+	return hits, nil
+}
+
+// normalizeText lower-cases text and collapses runs of whitespace so that
+// phrases match regardless of line breaks in the body.
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+func containsAll(text string, needles []string) bool {
+	for _, needle := range needles {
+		if !strings.Contains(text, needle) {
+			return false
+		}
+	}
+	return true
+}
+
+// snippet collapses body onto one line and cuts a window of 2*snippetRadius
+// runes starting about snippetRadius runes before the first highlight.
+func snippet(body string, highlights []string) string {
+	text := strings.Join(strings.Fields(body), " ")
+	lower := strings.ToLower(text)
+	at := -1
+	for _, h := range highlights {
+		if i := strings.Index(lower, h); i >= 0 && (at < 0 || i < at) {
+			at = i
+		}
+	}
+	if at < 0 || len(lower) != len(text) {
+		// Lower-casing changed byte offsets; fall back to the head.
+		at = 0
+	}
+	start := at
+	for n := 0; n < snippetRadius && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := start
+	for n := 0; n < 2*snippetRadius && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	out := text[start:end]
+	if start > 0 {
+		out = "..." + out
+	}
+	if end < len(text) {
+		out += "..."
+	}
+	return out
+}
@@ -0,0 +1,242 @@
+package bussearch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+)
+
+func postMessage(t *testing.T, root, project, task, msgType, body string) string {
+	t.Helper()
+	dir := filepath.Join(root, project)
+	name := "PROJECT-MESSAGE-BUS.md"
+	if task != "" {
+		dir = filepath.Join(dir, task)
+		name = "TASK-MESSAGE-BUS.md"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	bus, err := messagebus.NewMessageBus(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	id, err := bus.AppendMessage(&messagebus.Message{
+		Type:      msgType,
+		ProjectID: project,
+		TaskID:    task,
+		RunID:     "run-" + project,
+		Body:      body,
+	})
+	if err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	return id
+}
+
+func hitIDs(hits []Hit) []string {
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.MsgID)
+	}
+	return ids
+}
+
+func mustSearch(t *testing.T, root, q string, opts Options) []Hit {
+	t.Helper()
+	hits, err := Search(root, q, opts)
+	if err != nil {
+		t.Fatalf("Search(%q): %v", q, err)
+	}
+	return hits
+}
+
+func TestSearchAcrossProjects(t *testing.T) {
+	root := t.TempDir()
+	a1 := postMessage(t, root, "alpha", "", "FACT", "Deploy pipeline is green")
+	a2 := postMessage(t, root, "alpha", "task-1", "ERROR", "Deploy failed:\nconnection refused by the database")
+	b1 := postMessage(t, root, "beta", "task-2", "PROGRESS", "Database migration finished; deploy next")
+	postMessage(t, root, "beta", "", "FACT", "Unrelated note")
+
+	hits := mustSearch(t, root, "deploy", Options{})
+	if want := []string{b1, a2, a1}; !reflect.DeepEqual(hitIDs(hits), want) {
+		t.Fatalf("deploy hits = %v, want %v", hitIDs(hits), want)
+	}
+	if hits[0].ProjectID != "beta" || hits[0].TaskID != "task-2" || hits[0].RunID != "run-beta" || hits[0].Bus != "beta/task-2/TASK-MESSAGE-BUS.md" {
+		t.Fatalf("unexpected hit scope: %+v", hits[0])
+	}
+	if hits[2].TaskID != "" || hits[2].Bus != "alpha/PROJECT-MESSAGE-BUS.md" {
+		t.Fatalf("unexpected project bus hit: %+v", hits[2])
+	}
+
+	for q, want := range map[string][]string{
+		"DEPLOY database":          {b1, a2},
+		`"failed: connection"`:     {a2},
+		`"connection failed"`:      nil,
+		"data*":                    {b1, a2},
+		"migrat* deploy":           {b1},
+		"error deploy":             {a2},
+		"nothing-matches-this-one": nil,
+	} {
+		got := hitIDs(mustSearch(t, root, q, Options{}))
+		if len(got) == 0 && len(want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Search(%q) = %v, want %v", q, got, want)
+		}
+	}
+
+	if got := hitIDs(mustSearch(t, root, "deploy", Options{Project: "alpha"})); !reflect.DeepEqual(got, []string{a2, a1}) {
+		t.Fatalf("project search = %v", got)
+	}
+	filter, err := messagebus.ParseFilter("type = fact")
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+	if got := hitIDs(mustSearch(t, root, "deploy", Options{Filter: filter})); !reflect.DeepEqual(got, []string{a1}) {
+		t.Fatalf("filtered search = %v", got)
+	}
+	if got := hitIDs(mustSearch(t, root, "deploy", Options{Limit: 1})); !reflect.DeepEqual(got, []string{b1}) {
+		t.Fatalf("limited search = %v", got)
+	}
+
+	for _, q := range []string{"", "a", `"open`} {
+		if _, err := Search(root, q, Options{}); err == nil {
+			t.Errorf("Search(%q) expected error", q)
+		}
+	}
+}
+
+func TestUpdateIsIncremental(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 3; i++ {
+		postMessage(t, root, "proj", "task", "FACT", fmt.Sprintf("first batch %d", i))
+	}
+	stats, err := Update(root)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if stats.Messages != 3 || stats.Buses != 1 {
+		t.Fatalf("first update = %+v", stats)
+	}
+	if stats, _ = Update(root); stats.Messages != 0 {
+		t.Fatalf("no-op update indexed %d messages", stats.Messages)
+	}
+
+	late := postMessage(t, root, "proj", "task", "FACT", "second batch")
+	postMessage(t, root, "other", "", "FACT", "second batch elsewhere")
+	if stats, _ = Update(root); stats.Messages != 2 || stats.Buses != 2 {
+		t.Fatalf("incremental update = %+v", stats)
+	}
+	hits := mustSearch(t, root, "second", Options{Project: "proj"})
+	if !reflect.DeepEqual(hitIDs(hits), []string{late}) {
+		t.Fatalf("search after append = %v", hitIDs(hits))
+	}
+	if got := mustSearch(t, root, "batch", Options{Limit: 100}); len(got) != 5 {
+		t.Fatalf("expected 5 hits without duplicates, got %v", hitIDs(got))
+	}
+
+	// Many small updates are merged back into a single segment.
+	for i := 0; i < maxSegments+2; i++ {
+		postMessage(t, root, "proj", "task", "PROGRESS", fmt.Sprintf("tick %d", i))
+		if _, err := Update(root); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	m, err := readManifest(filepath.Join(root, DirName))
+	if err != nil {
+		t.Fatalf("readManifest: %v", err)
+	}
+	if len(m.Segments) > maxSegments {
+		t.Fatalf("segments not merged: %v", m.Segments)
+	}
+	if got := mustSearch(t, root, "tick", Options{Limit: 100}); len(got) != maxSegments+2 {
+		t.Fatalf("tick hits after merge = %d", len(got))
+	}
+	if got := mustSearch(t, root, "batch", Options{Limit: 100}); len(got) != 5 {
+		t.Fatalf("batch hits after merge = %d", len(got))
+	}
+}
+
+func TestSearchAfterRotationAndRebuild(t *testing.T) {
+	root := t.TempDir()
+	old := postMessage(t, root, "proj", "", "FACT", "rotation candidate")
+	if _, err := Update(root); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	busPath := filepath.Join(root, "proj", "PROJECT-MESSAGE-BUS.md")
+	archived := busPath + ".20260101-000000.archived"
+	if err := os.Rename(busPath, archived); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	fresh := postMessage(t, root, "proj", "", "FACT", "rotation survivor")
+
+	hits := mustSearch(t, root, "rotation", Options{})
+	if !reflect.DeepEqual(hitIDs(hits), []string{fresh, old}) {
+		t.Fatalf("hits after rotation = %v", hitIDs(hits))
+	}
+	if hits[1].Bus != "proj/PROJECT-MESSAGE-BUS.md.20260101-000000.archived" {
+		t.Fatalf("archived hit bus = %q", hits[1].Bus)
+	}
+
+	if err := os.Remove(archived); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if got := hitIDs(mustSearch(t, root, "candidate", Options{})); len(got) != 0 {
+		t.Fatalf("removed bus still searchable: %v", got)
+	}
+
+	stats, err := Rebuild(root)
+	if err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if stats.Messages != 1 {
+		t.Fatalf("rebuild stats = %+v", stats)
+	}
+	if got := hitIDs(mustSearch(t, root, "survivor", Options{})); !reflect.DeepEqual(got, []string{fresh}) {
+		t.Fatalf("hits after rebuild = %v", got)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	body := strings.Repeat("lead ", 40) + "the NEEDLE is here\nand " + strings.Repeat("tail ", 40)
+	got := snippet(body, []string{"needle"})
+	if !strings.HasPrefix(got, "...") || !strings.HasSuffix(got, "...") || !strings.Contains(got, "the NEEDLE is here and") {
+		t.Fatalf("snippet = %q", got)
+	}
+	if strings.Contains(got, "\n") || len([]rune(got)) > 2*snippetRadius+6 {
+		t.Fatalf("snippet not bounded: %q", got)
+	}
+	if got := snippet("short body", []string{"missing"}); got != "short body" {
+		t.Fatalf("short snippet = %q", got)
+	}
+}
+
+func TestSearchFindsCompactedMessages(t *testing.T) {
+	root := t.TempDir()
+	first := postMessage(t, root, "proj", "task", "FACT", "archived knowledge")
+	if _, err := Update(root); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	second := postMessage(t, root, "proj", "task", "FACT", "live knowledge")
+	bus, err := messagebus.NewMessageBus(filepath.Join(root, "proj", "task", "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	if _, err := bus.Compact(messagebus.CompactOptions{KeepLast: 1}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	hits := mustSearch(t, root, "knowledge", Options{})
+	if !reflect.DeepEqual(hitIDs(hits), []string{second, first}) {
+		t.Fatalf("hits after compaction = %v", hitIDs(hits))
+	}
+	if hits[1].TaskID != "task" || !strings.HasPrefix(hits[1].Bus, "proj/task/TASK-MESSAGE-BUS.md.archive-") {
+		t.Fatalf("archived hit = %+v", hits[1])
+	}
+}
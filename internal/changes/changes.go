@@ -0,0 +1,212 @@
+// Package changes captures what an agent run changed in its working
+// directory. A Snapshot is taken when the run starts and when it stops; the
+// difference is stored in the run directory as changes.patch and
+// changes.json.
+//
+// Inside a git repository the snapshot is a tree object written from a
+// temporary index, so the diff covers committed, staged, unstaged and
+// untracked (non-ignored) changes made during the run, and nothing that was
+// already dirty before it. Outside git a file hash manifest is compared
+// instead and no patch is produced.
+package changes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FileName is the change list written to the run directory.
+	FileName = "changes.json"
+	// PatchFileName is the unified diff written to the run directory.
+	PatchFileName = "changes.patch"
+
+	// ModeGit marks change sets computed from git trees.
+	ModeGit = "git"
+	// ModeManifest marks change sets computed from a file hash manifest.
+	ModeManifest = "manifest"
+)
+
+// File statuses.
+const (
+	StatusAdded       = "added"
+	StatusModified    = "modified"
+	StatusDeleted     = "deleted"
+	StatusTypeChanged = "type_changed"
+)
+
+// maxPatchBytes caps changes.patch; larger diffs are truncated.
+var maxPatchBytes = 8 << 20
+
+// File is one changed path.
+type File struct {
+	// Path is relative to Set.Root and uses forward slashes.
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions,omitempty"`
+	Deletions int    `json:"deletions,omitempty"`
+	Binary    bool   `json:"binary,omitempty"`
+}
+
+// Set is the content of changes.json.
+type Set struct {
+	Mode string `json:"mode"`
+	// Root is the repository top level (git) or the working directory.
+	Root       string `json:"root"`
+	BaseCommit string `json:"base_commit,omitempty"`
+	HeadCommit string `json:"head_commit,omitempty"`
+	Files      []File `json:"files"`
+	Additions  int    `json:"additions"`
+	Deletions  int    `json:"deletions"`
+	// Truncated is set when the manifest hit its file limit or the patch
+	// exceeded its size limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Summary returns a one-line description such as
+// "3 files changed (+10 -2): a.go, b.go, c.go", listing at most max paths.
+func (s *Set) Summary(max int) string {
+	if s == nil {
+		return ""
+	}
+	if len(s.Files) == 0 {
+		return "no files changed"
+	}
+	noun := "files"
+	if len(s.Files) == 1 {
+		noun = "file"
+	}
+	line := fmt.Sprintf("%d %s changed", len(s.Files), noun)
+	if s.Mode == ModeGit {
+		line += fmt.Sprintf(" (+%d -%d)", s.Additions, s.Deletions)
+	}
+	paths := make([]string, 0, max)
+	for i, f := range s.Files {
+		if i >= max {
+			break
+		}
+		paths = append(paths, f.Path)
+	}
+	line += ": " + strings.Join(paths, ", ")
+	if rest := len(s.Files) - len(paths); rest > 0 {
+		line += fmt.Sprintf(" (+%d more)", rest)
+	}
+	return line
+}
+
+// Snapshot is the state of a working directory at one point in time.
+type Snapshot struct {
+	mode    string
+	root    string
+	exclude []string
+
+	// git mode
+	head string
+	tree string
+
+	// manifest mode
+	manifest  map[string]string
+	truncated bool
+}
+
+// Take snapshots dir. Paths under any of exclude (absolute) are ignored,
+// which keeps run-agent's own files out of the change list when they live
+// inside the working directory.
+func Take(dir string, exclude ...string) (*Snapshot, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve working dir")
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	cleaned := make([]string, 0, len(exclude))
+	for _, path := range exclude {
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		cleaned = append(cleaned, abs)
+	}
+	if root, err := git(dir, nil, "rev-parse", "--show-toplevel"); err == nil && root != "" {
+		return takeGit(root, cleaned)
+	}
+	return takeManifest(dir, cleaned)
+}
+
+// Diff compares two snapshots of the same directory and returns the change
+// set and, in git mode, the unified diff.
+func Diff(before, after *Snapshot) (*Set, []byte, error) {
+	if before == nil || after == nil {
+		return nil, nil, errors.New("snapshot is nil")
+	}
+	if before.mode != after.mode || before.root != after.root {
+		return nil, nil, errors.New("snapshots are not comparable")
+	}
+	if before.mode == ModeGit {
+		return diffGit(before, after)
+	}
+	return diffManifest(before, after), nil, nil
+}
+
+// Capture takes the stop snapshot, diffs it against before and writes
+// changes.json and (git mode) changes.patch to runDir.
+func Capture(runDir string, before *Snapshot) (*Set, error) {
+	if before == nil {
+		return nil, errors.New("snapshot is nil")
+	}
+	after, err := Take(before.root, before.exclude...)
+	if err != nil {
+		return nil, err
+	}
+	set, patch, err := Diff(before, after)
+	if err != nil {
+		return nil, err
+	}
+	if patch != nil {
+		if len(patch) > maxPatchBytes {
+			patch = append(patch[:maxPatchBytes:maxPatchBytes], []byte("\n# patch truncated\n")...)
+			set.Truncated = true
+		}
+		if err := os.WriteFile(filepath.Join(runDir, PatchFileName), patch, 0o644); err != nil {
+			return nil, errors.Wrap(err, "write changes patch")
+		}
+	}
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal changes")
+	}
+	if err := os.WriteFile(filepath.Join(runDir, FileName), append(data, '\n'), 0o644); err != nil {
+		return nil, errors.Wrap(err, "write changes")
+	}
+	return set, nil
+}
+
+// Read loads changes.json from runDir.
+func Read(runDir string) (*Set, error) {
+	data, err := os.ReadFile(filepath.Join(runDir, FileName))
+	if err != nil {
+		return nil, errors.Wrap(err, "read changes")
+	}
+	var set Set
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrap(err, "unmarshal changes")
+	}
+	return &set, nil
+}
+
+func sortFiles(files []File) {
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+}
@@ -0,0 +1,182 @@
+package changes
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestCaptureGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	mustGit(t, repo, "init", "-q")
+	writeFile(t, filepath.Join(repo, "keep.txt"), "keep\n")
+	writeFile(t, filepath.Join(repo, "edit.txt"), "one\ntwo\n")
+	writeFile(t, filepath.Join(repo, "gone.txt"), "bye\n")
+	writeFile(t, filepath.Join(repo, ".gitignore"), "ignored/\n")
+	mustGit(t, repo, "add", "-A")
+	mustGit(t, repo, "commit", "-q", "-m", "init")
+	// Already dirty before the run: must not be reported.
+	writeFile(t, filepath.Join(repo, "keep.txt"), "dirty before\n")
+	runDir := filepath.Join(repo, "runs", "r1")
+	writeFile(t, filepath.Join(runDir, "agent-stdout.txt"), "")
+
+	before, err := Take(filepath.Join(repo), filepath.Join(repo, "runs"))
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+
+	writeFile(t, filepath.Join(repo, "edit.txt"), "one\n2\nthree\n")
+	writeFile(t, filepath.Join(repo, "sub", "new.txt"), "new\n")
+	writeFile(t, filepath.Join(repo, "ignored", "cache"), "x")
+	writeFile(t, filepath.Join(runDir, "agent-stdout.txt"), "output")
+	if err := os.Remove(filepath.Join(repo, "gone.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "blob.bin"), []byte{0, 1, 2, 0}, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// The agent commits part of its work; the diff still covers it.
+	mustGit(t, repo, "add", "edit.txt")
+	mustGit(t, repo, "commit", "-q", "-m", "agent")
+
+	set, err := Capture(runDir, before)
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if set.Mode != ModeGit || set.BaseCommit == "" || set.HeadCommit == "" || set.BaseCommit == set.HeadCommit {
+		t.Fatalf("unexpected set header: %+v", set)
+	}
+	want := map[string]string{
+		"blob.bin":    StatusAdded,
+		"edit.txt":    StatusModified,
+		"gone.txt":    StatusDeleted,
+		"sub/new.txt": StatusAdded,
+	}
+	if len(set.Files) != len(want) {
+		t.Fatalf("unexpected files: %+v", set.Files)
+	}
+	for _, f := range set.Files {
+		if want[f.Path] != f.Status {
+			t.Fatalf("file %s: status %q, want %q", f.Path, f.Status, want[f.Path])
+		}
+		if f.Path == "blob.bin" && !f.Binary {
+			t.Fatalf("blob.bin not marked binary")
+		}
+		if f.Path == "edit.txt" && (f.Additions != 2 || f.Deletions != 1) {
+			t.Fatalf("edit.txt stats = +%d -%d", f.Additions, f.Deletions)
+		}
+	}
+	if set.Additions != 3 || set.Deletions != 2 {
+		t.Fatalf("totals = +%d -%d", set.Additions, set.Deletions)
+	}
+
+	patch, err := os.ReadFile(filepath.Join(runDir, PatchFileName))
+	if err != nil {
+		t.Fatalf("read patch: %v", err)
+	}
+	if !strings.Contains(string(patch), "+three") || strings.Contains(string(patch), "keep.txt") {
+		t.Fatalf("unexpected patch:\n%s", patch)
+	}
+	stored, err := Read(runDir)
+	if err != nil || len(stored.Files) != len(want) {
+		t.Fatalf("Read = %+v, %v", stored, err)
+	}
+}
+
+func TestCaptureGitNoChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	mustGit(t, repo, "init", "-q")
+	before, err := Take(repo)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	runDir := t.TempDir()
+	set, err := Capture(runDir, before)
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if len(set.Files) != 0 || set.Summary(5) != "no files changed" {
+		t.Fatalf("unexpected set: %+v", set)
+	}
+	if data, err := os.ReadFile(filepath.Join(runDir, PatchFileName)); err != nil || len(data) != 0 {
+		t.Fatalf("expected empty patch, got %q (%v)", data, err)
+	}
+}
+
+func TestCaptureManifest(t *testing.T) {
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").CombinedOutput(); err == nil {
+		t.Skipf("temp dir is inside a git repository: %s", out)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+	writeFile(t, filepath.Join(dir, "b.txt"), "b")
+	writeFile(t, filepath.Join(dir, "runs", "x"), "x")
+	before, err := Take(dir, filepath.Join(dir, "runs"))
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "a.txt"), "changed")
+	writeFile(t, filepath.Join(dir, "c", "d.txt"), "d")
+	writeFile(t, filepath.Join(dir, "runs", "x"), "changed")
+	if err := os.Remove(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	runDir := t.TempDir()
+	set, err := Capture(runDir, before)
+	if err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	got := make([]string, 0, len(set.Files))
+	for _, f := range set.Files {
+		got = append(got, f.Path+"="+f.Status)
+	}
+	if strings.Join(got, ",") != "a.txt=modified,b.txt=deleted,c/d.txt=added" {
+		t.Fatalf("unexpected files: %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, PatchFileName)); !os.IsNotExist(err) {
+		t.Fatalf("manifest mode must not write a patch: %v", err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	set := &Set{
+		Mode:      ModeGit,
+		Files:     []File{{Path: "a"}, {Path: "b"}, {Path: "c"}},
+		Additions: 10,
+		Deletions: 2,
+	}
+	if got := set.Summary(2); got != "3 files changed (+10 -2): a, b (+1 more)" {
+		t.Fatalf("Summary = %q", got)
+	}
+	set = &Set{Mode: ModeManifest, Files: []File{{Path: "a"}}}
+	if got := set.Summary(5); got != "1 file changed: a" {
+		t.Fatalf("Summary = %q", got)
+	}
+}
@@ -0,0 +1,155 @@
+package changes
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func takeGit(root string, exclude []string) (*Snapshot, error) {
+	head, _ := git(root, nil, "rev-parse", "--verify", "--quiet", "HEAD")
+
+	tmpDir, err := os.MkdirTemp("", "run-agent-changes-")
+	if err != nil {
+		return nil, errors.Wrap(err, "create temp index dir")
+	}
+	defer os.RemoveAll(tmpDir)
+	tmpIndex := filepath.Join(tmpDir, "index")
+	// Starting from a copy of the real index lets git reuse its stat cache
+	// instead of rehashing every file.
+	if indexPath, err := git(root, nil, "rev-parse", "--path-format=absolute", "--git-path", "index"); err == nil {
+		if err := copyFile(indexPath, tmpIndex); err != nil {
+			_ = os.Remove(tmpIndex)
+		}
+	}
+	env := []string{"GIT_INDEX_FILE=" + tmpIndex}
+
+	args := []string{"add", "--all", "--", "."}
+	for _, path := range exclude {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		args = append(args, ":(exclude)"+filepath.ToSlash(rel))
+	}
+	if _, err := git(root, env, args...); err != nil {
+		return nil, errors.Wrap(err, "stage working tree snapshot")
+	}
+	tree, err := git(root, env, "write-tree")
+	if err != nil {
+		return nil, errors.Wrap(err, "write working tree snapshot")
+	}
+	return &Snapshot{mode: ModeGit, root: root, exclude: exclude, head: head, tree: tree}, nil
+}
+
+func diffGit(before, after *Snapshot) (*Set, []byte, error) {
+	set := &Set{
+		Mode:       ModeGit,
+		Root:       before.root,
+		BaseCommit: before.head,
+		HeadCommit: after.head,
+		Files:      []File{},
+	}
+	if before.tree == after.tree {
+		return set, []byte{}, nil
+	}
+	statuses, err := gitRaw(before.root, "diff", "--name-status", "--no-renames", "-z", before.tree, after.tree)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "diff snapshot names")
+	}
+	numstat, err := gitRaw(before.root, "diff", "--numstat", "--no-renames", "-z", before.tree, after.tree)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "diff snapshot stats")
+	}
+	patch, err := gitRaw(before.root, "diff", "--binary", "--no-renames", "--no-color", "--no-ext-diff", before.tree, after.tree)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "diff snapshot patch")
+	}
+
+	byPath := make(map[string]*File)
+	fields := strings.Split(strings.TrimSuffix(string(statuses), "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		set.Files = append(set.Files, File{Path: fields[i+1], Status: gitStatus(fields[i])})
+	}
+	for i := range set.Files {
+		byPath[set.Files[i].Path] = &set.Files[i]
+	}
+	for _, record := range strings.Split(strings.TrimSuffix(string(numstat), "\x00"), "\x00") {
+		parts := strings.SplitN(record, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		file, ok := byPath[parts[2]]
+		if !ok {
+			continue
+		}
+		if parts[0] == "-" {
+			file.Binary = true
+			continue
+		}
+		file.Additions, _ = strconv.Atoi(parts[0])
+		file.Deletions, _ = strconv.Atoi(parts[1])
+		set.Additions += file.Additions
+		set.Deletions += file.Deletions
+	}
+	sortFiles(set.Files)
+	return set, patch, nil
+}
+
+func gitStatus(code string) string {
+	switch strings.TrimSpace(code) {
+	case "A":
+		return StatusAdded
+	case "D":
+		return StatusDeleted
+	case "T":
+		return StatusTypeChanged
+	}
+	return StatusModified
+}
+
+// git runs a git command in dir and returns its trimmed stdout.
+func git(dir string, env []string, args ...string) (string, error) {
+	out, err := runGit(dir, env, args...)
+	return strings.TrimSpace(string(out)), err
+}
+
+// gitRaw runs a git command in dir and returns its stdout unmodified.
+func gitRaw(dir string, args ...string) ([]byte, error) {
+	return runGit(dir, nil, args...)
+}
+
+func runGit(dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,119 @@
+package changes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// maxManifestFiles bounds the number of files hashed per snapshot.
+	maxManifestFiles = 20000
+	// maxHashBytes is the largest file that is content-hashed; bigger files
+	// are compared by size and modification time.
+	maxHashBytes int64 = 16 << 20
+)
+
+func takeManifest(root string, exclude []string) (*Snapshot, error) {
+	snap := &Snapshot{mode: ModeManifest, root: root, exclude: exclude, manifest: make(map[string]string)}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are skipped rather than failing the run.
+			if d != nil && d.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isExcluded(path, exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(snap.manifest) >= maxManifestFiles {
+			snap.truncated = true
+			return filepath.SkipAll
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		snap.manifest[filepath.ToSlash(rel)] = fingerprint(path, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func diffManifest(before, after *Snapshot) *Set {
+	set := &Set{
+		Mode:      ModeManifest,
+		Root:      before.root,
+		Files:     []File{},
+		Truncated: before.truncated || after.truncated,
+	}
+	for path, sum := range after.manifest {
+		old, ok := before.manifest[path]
+		switch {
+		case !ok:
+			set.Files = append(set.Files, File{Path: path, Status: StatusAdded})
+		case old != sum:
+			set.Files = append(set.Files, File{Path: path, Status: StatusModified})
+		}
+	}
+	for path := range before.manifest {
+		if _, ok := after.manifest[path]; !ok {
+			set.Files = append(set.Files, File{Path: path, Status: StatusDeleted})
+		}
+	}
+	sortFiles(set.Files)
+	return set
+}
+
+// fingerprint identifies file content: a sha256 for regular files up to
+// maxHashBytes, the target for symlinks, and size plus mtime otherwise.
+func fingerprint(path string, d fs.DirEntry) string {
+	info, err := d.Info()
+	if err != nil {
+		return "unreadable"
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, _ := os.Readlink(path)
+		return "link:" + target
+	}
+	if !info.Mode().IsRegular() || info.Size() > maxHashBytes {
+		return fmt.Sprintf("stat:%d:%d:%s", info.Size(), info.ModTime().UnixNano(), info.Mode())
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "unreadable"
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "unreadable"
+	}
+	return fmt.Sprintf("%s:%s", info.Mode().Perm(), hex.EncodeToString(h.Sum(nil)))
+}
+
+func isExcluded(path string, exclude []string) bool {
+	for _, prefix := range exclude {
+		if path == prefix || strings.HasPrefix(path, prefix+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
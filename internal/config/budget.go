@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BudgetConfig caps what a task and all of its descendant runs may consume.
+// Zero values mean "no limit" for the corresponding dimension.
+type BudgetConfig struct {
+	// MaxTokens caps input+output tokens reported by agent usage output.
+	MaxTokens int64 `yaml:"max_tokens,omitempty"`
+	// MaxCostUSD caps spend as reported by agents or derived from pricing.
+	MaxCostUSD float64 `yaml:"max_cost_usd,omitempty"`
+	// MaxWallClock caps elapsed time since the task loop started, e.g. "2h".
+	MaxWallClock string `yaml:"max_wall_clock,omitempty"`
+	// MaxRestarts caps restarts summed across every task in the subtree.
+	MaxRestarts int `yaml:"max_restarts,omitempty"`
+}
+
+// WallClock parses MaxWallClock. An empty value yields zero (no limit).
+func (b BudgetConfig) WallClock() (time.Duration, error) {
+	value := strings.TrimSpace(b.MaxWallClock)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max_wall_clock %q: %w", value, err)
+	}
+	return d, nil
+}
+
+func validateBudget(budget *BudgetConfig) error {
+	if budget == nil {
+		return nil
+	}
+	if budget.MaxTokens < 0 {
+		return fmt.Errorf("defaults.budget.max_tokens must be non-negative")
+	}
+	if budget.MaxCostUSD < 0 {
+		return fmt.Errorf("defaults.budget.max_cost_usd must be non-negative")
+	}
+	if budget.MaxRestarts < 0 {
+		return fmt.Errorf("defaults.budget.max_restarts must be non-negative")
+	}
+	wallClock, err := budget.WallClock()
+	if err != nil {
+		return fmt.Errorf("defaults.budget: %w", err)
+	}
+	if wallClock < 0 {
+		return fmt.Errorf("defaults.budget.max_wall_clock must be non-negative")
+	}
+	return nil
+}
@@ -7,15 +7,37 @@ import (
 	"path/filepath"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 )
 
 // Config defines the YAML configuration structure.
 type Config struct {
-	Agents   map[string]AgentConfig `yaml:"agents"`
-	Defaults DefaultConfig          `yaml:"defaults"`
-	API      APIConfig              `yaml:"api"`
-	Storage  StorageConfig          `yaml:"storage"`
-	Webhook  *WebhookConfig         `yaml:"webhook,omitempty"`
+	Agents     map[string]AgentConfig `yaml:"agents"`
+	Defaults   DefaultConfig          `yaml:"defaults"`
+	API        APIConfig              `yaml:"api"`
+	Storage    StorageConfig          `yaml:"storage"`
+	MessageBus MessageBusConfig       `yaml:"message_bus,omitempty"`
+	Workflows  WorkflowsConfig        `yaml:"workflows,omitempty"`
+	Webhook    *WebhookConfig         `yaml:"webhook,omitempty"`
+	Pricing    map[string]PriceConfig `yaml:"pricing,omitempty"`
+}
+
+// MessageBusConfig configures message schema validation on the task and
+// project buses of new runs.
+type MessageBusConfig struct {
+	// Validation is "off" (default), "warn" (log invalid messages) or
+	// "strict" (reject them).
+	Validation string `yaml:"validation,omitempty"`
+	// Types add message types or replace the schemas of built-in ones.
+	Types []messagebus.TypeSchema `yaml:"types,omitempty"`
+}
+
+// WorkflowsConfig lists directories searched for workflow templates
+// (<name>.yaml) after the project's own workflows directory.
+type WorkflowsConfig struct {
+	Dirs []string `yaml:"dirs,omitempty"`
 }
 
 // WebhookConfig holds configuration for run completion webhook notifications.
@@ -28,22 +50,52 @@ type WebhookConfig struct {
 
 // AgentConfig describes a single agent backend configuration.
 type AgentConfig struct {
-	Type      string `yaml:"type"` // claude, codex, gemini, perplexity, xai
+	Type      string `yaml:"type"` // a registered agent type, or custom
 	Token     string `yaml:"token,omitempty"`
 	TokenFile string `yaml:"token_file,omitempty"`
 	BaseURL   string `yaml:"base_url,omitempty"`
 	Model     string `yaml:"model,omitempty"`
 
+	// Headers are extra HTTP headers sent by openai-compatible agents, e.g.
+	// an Azure "api-key" header or a LiteLLM team header.
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// Tools lets xai and openai-compatible agents read and write files, run
+	// commands, post to the message bus and spawn child tasks through
+	// function calling.
+	Tools bool `yaml:"tools,omitempty"`
+
+	// Command is the argv template of a custom agent; {prompt_file},
+	// {run_dir} and {cwd} are substituted per run.
+	Command []string `yaml:"command,omitempty"`
+	// PromptMode selects how a custom agent receives the prompt: stdin
+	// (default) or file.
+	PromptMode string `yaml:"prompt_mode,omitempty"`
+	// TokenEnv names the environment variable a custom agent's token is
+	// exported as.
+	TokenEnv string `yaml:"token_env,omitempty"`
+
+	// Sandbox overrides defaults.sandbox for this agent.
+	Sandbox *SandboxConfig `yaml:"sandbox,omitempty"`
+
 	tokenFromFile bool `yaml:"-"`
 }
 
+// CustomSpec returns the command template of a custom agent.
+func (a AgentConfig) CustomSpec() agent.CustomSpec {
+	return agent.CustomSpec{Command: a.Command, PromptMode: a.PromptMode, TokenEnv: a.TokenEnv}
+}
+
 // DefaultConfig defines defaults used by the runner.
 type DefaultConfig struct {
-	Agent                  string               `yaml:"agent"`
-	Timeout                int                  `yaml:"timeout"`
-	MaxConcurrentRuns      int                  `yaml:"max_concurrent_runs"`
-	MaxConcurrentRootTasks int                  `yaml:"max_concurrent_root_tasks"`
+	Agent                  string                 `yaml:"agent"`
+	Timeout                int                    `yaml:"timeout"`
+	MaxConcurrentRuns      int                    `yaml:"max_concurrent_runs"`
+	MaxConcurrentRootTasks int                    `yaml:"max_concurrent_root_tasks"`
 	Diversification        *DiversificationConfig `yaml:"diversification,omitempty"`
+	Budget                 *BudgetConfig          `yaml:"budget,omitempty"`
+	Sandbox                *SandboxConfig         `yaml:"sandbox,omitempty"`
+	Resources              *ResourcesConfig       `yaml:"resources,omitempty"`
 }
 
 // DiversificationConfig controls how agent selection distributes work across
@@ -75,6 +127,9 @@ type DiversificationConfig struct {
 type StorageConfig struct {
 	RunsDir    string   `yaml:"runs_dir"`
 	ExtraRoots []string `yaml:"extra_roots,omitempty"`
+	// BusBackend selects the storage of new message buses: "file" (default)
+	// or "sqlite".
+	BusBackend string `yaml:"bus_backend,omitempty"`
 }
 
 // HomeHCLConfigDir returns the directory that holds the user home HCL config.
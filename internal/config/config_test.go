@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestTokenEnvVarName(t *testing.T) {
@@ -471,6 +472,19 @@ my_openai {
 	}
 }
 
+func TestParseHCLConfig_AgentTools(t *testing.T) {
+	cfg, err := parseHCLConfig([]byte("xai {\n  tools = true\n}\n"))
+	if err != nil {
+		t.Fatalf("parseHCLConfig: %v", err)
+	}
+	if !cfg.Agents["xai"].Tools {
+		t.Fatal("expected tools to be enabled")
+	}
+	if _, err := parseHCLConfig([]byte("xai {\n  tools = maybe\n}\n")); err == nil {
+		t.Fatal("expected error for invalid tools value")
+	}
+}
+
 func TestParseHCLConfig_UnclosedBlock(t *testing.T) {
 	hcl := `
 codex {
@@ -783,3 +797,420 @@ func TestValidateDiversificationConfig_NilIsNoOp(t *testing.T) {
 		t.Fatalf("unexpected error for nil: %v", err)
 	}
 }
+
+func TestLoadConfigYAMLPricing(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `agents:
+  claude:
+    type: claude
+
+defaults:
+  agent: claude
+  timeout: 10
+
+pricing:
+  claude-sonnet-4-5:
+    input_per_mtok: 3
+    output_per_mtok: 15
+    cached_input_per_mtok: 0.3
+  codex:
+    input_per_mtok: 1.25
+    output_per_mtok: 10
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfigForServer(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigForServer: %v", err)
+	}
+	price, ok := cfg.PriceFor("Claude-Sonnet-4-5")
+	if !ok {
+		t.Fatalf("expected price for model")
+	}
+	if price.OutputPerMTok != 15 {
+		t.Fatalf("output_per_mtok=%v, want 15", price.OutputPerMTok)
+	}
+	if _, ok := cfg.PriceFor("gpt-5-codex", "my-codex", "codex"); !ok {
+		t.Fatalf("expected fallback price for agent type")
+	}
+	if _, ok := cfg.PriceFor("unknown"); ok {
+		t.Fatalf("expected no price for unknown model")
+	}
+}
+
+func TestPriceConfigCost(t *testing.T) {
+	price := PriceConfig{InputPerMTok: 3, OutputPerMTok: 15, CachedInputPerMTok: 0.3}
+	// 1M input of which 500k cached, 100k output:
+	// 500k*3 + 500k*0.3 + 100k*15 = 1.5 + 0.15 + 1.5 = 3.15 USD.
+	got := price.Cost(1_000_000, 500_000, 100_000)
+	if got < 3.1499 || got > 3.1501 {
+		t.Fatalf("cost=%v, want 3.15", got)
+	}
+	noCachedRate := PriceConfig{InputPerMTok: 2, OutputPerMTok: 0}
+	if got := noCachedRate.Cost(1_000_000, 1_000_000, 0); got != 2 {
+		t.Fatalf("cost=%v, want cached tokens billed at input rate", got)
+	}
+}
+
+func TestValidateConfigRejectsNegativePricing(t *testing.T) {
+	cfg := makeMinimalConfig("claude")
+	cfg.Pricing = map[string]PriceConfig{"claude": {InputPerMTok: -1}}
+	if err := ValidateConfig(cfg); err == nil {
+		t.Fatal("expected validation error for negative price")
+	}
+}
+
+func TestLoadConfigYAMLBudget(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `agents:
+  claude:
+    type: claude
+
+defaults:
+  agent: claude
+  timeout: 10
+  budget:
+    max_tokens: 2000000
+    max_cost_usd: 25
+    max_wall_clock: 2h
+    max_restarts: 10
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfigForServer(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigForServer: %v", err)
+	}
+	budget := cfg.Defaults.Budget
+	if budget == nil {
+		t.Fatal("expected defaults.budget")
+	}
+	if budget.MaxTokens != 2000000 || budget.MaxCostUSD != 25 || budget.MaxRestarts != 10 {
+		t.Fatalf("unexpected budget: %+v", *budget)
+	}
+	wallClock, err := budget.WallClock()
+	if err != nil || wallClock != 2*time.Hour {
+		t.Fatalf("WallClock()=%v, %v; want 2h", wallClock, err)
+	}
+}
+
+func TestValidateConfigRejectsInvalidBudget(t *testing.T) {
+	for _, budget := range []BudgetConfig{
+		{MaxTokens: -1},
+		{MaxCostUSD: -0.5},
+		{MaxRestarts: -2},
+		{MaxWallClock: "soon"},
+		{MaxWallClock: "-1h"},
+	} {
+		cfg := makeMinimalConfig("claude")
+		b := budget
+		cfg.Defaults.Budget = &b
+		if err := ValidateConfig(cfg); err == nil {
+			t.Fatalf("expected validation error for budget %+v", budget)
+		}
+	}
+}
+
+func TestLoadConfigYAMLOpenAICompatible(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `agents:
+  local:
+    type: openai-compatible
+    base_url: http://localhost:11434/v1
+    model: qwen2.5-coder
+    headers:
+      X-Team: infra
+
+defaults:
+  agent: local
+  timeout: 10
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfigForServer(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigForServer: %v", err)
+	}
+	local := cfg.Agents["local"]
+	if local.Type != "openai-compatible" || local.BaseURL != "http://localhost:11434/v1" || local.Model != "qwen2.5-coder" {
+		t.Fatalf("unexpected agent: %+v", local)
+	}
+	if local.Headers["X-Team"] != "infra" {
+		t.Fatalf("unexpected headers: %+v", local.Headers)
+	}
+}
+
+func TestValidateConfigOpenAICompatibleRequiresBaseURL(t *testing.T) {
+	cfg := &Config{
+		Agents:   map[string]AgentConfig{"local": {Type: "openai-compatible"}},
+		Defaults: DefaultConfig{Agent: "local", Timeout: 10},
+	}
+	if err := ValidateConfig(cfg); err == nil || !strings.Contains(err.Error(), "base_url") {
+		t.Fatalf("expected base_url error, got %v", err)
+	}
+	cfg.Agents["local"] = AgentConfig{Type: "openai-compatible", BaseURL: "http://localhost:8000"}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+}
+
+func TestValidateConfigToolsRequireFunctionCallingAgent(t *testing.T) {
+	cfg := &Config{
+		Agents:   map[string]AgentConfig{"pplx": {Type: "perplexity", Tools: true}},
+		Defaults: DefaultConfig{Agent: "pplx", Timeout: 10},
+	}
+	if err := ValidateConfig(cfg); err == nil || !strings.Contains(err.Error(), "tools") {
+		t.Fatalf("expected tools error, got %v", err)
+	}
+	cfg.Agents["pplx"] = AgentConfig{Type: "xai", Tools: true}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+}
+
+func TestLoadConfigYAMLCustomAgent(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `agents:
+  aider:
+    type: custom
+    command: ["aider", "--yes", "--message-file", "{prompt_file}"]
+    prompt_mode: file
+    token_env: OPENAI_API_KEY
+
+defaults:
+  agent: aider
+  timeout: 10
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfigForServer(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigForServer: %v", err)
+	}
+	aider := cfg.Agents["aider"]
+	if aider.Type != "custom" || len(aider.Command) != 4 || aider.PromptMode != "file" || aider.TokenEnv != "OPENAI_API_KEY" {
+		t.Fatalf("unexpected agent: %+v", aider)
+	}
+}
+
+func TestValidateConfigCustomAgent(t *testing.T) {
+	cases := map[string]AgentConfig{
+		"command":     {Type: "custom"},
+		"prompt_mode": {Type: "custom", Command: []string{"aider"}, PromptMode: "pipe"},
+		"tools":       {Type: "custom", Command: []string{"aider"}, Tools: true},
+		"custom":      {Type: "claude", Command: []string{"claude"}},
+	}
+	for want, agentCfg := range cases {
+		cfg := &Config{
+			Agents:   map[string]AgentConfig{"a": agentCfg},
+			Defaults: DefaultConfig{Agent: "a", Timeout: 10},
+		}
+		if err := ValidateConfig(cfg); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %s error, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigYAMLSandbox(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `agents:
+  claude:
+    type: claude
+    sandbox:
+      network: none
+      mounts: ["~/.claude:rw"]
+
+defaults:
+  agent: claude
+  timeout: 10
+  sandbox:
+    mode: podman
+    image: ghcr.io/example/agents:1
+    memory: 4g
+    cpus: 2
+    mounts: ["/srv/cache"]
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfigForServer(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigForServer: %v", err)
+	}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+	sb := ResolveSandbox(cfg.Defaults.Sandbox, cfg.Agents["claude"].Sandbox)
+	if !sb.IsContainer() || sb.Image != "ghcr.io/example/agents:1" || sb.Network != "none" || sb.Memory != "4g" || sb.CPUs != 2 {
+		t.Fatalf("unexpected resolved sandbox: %+v", *sb)
+	}
+	mounts, err := sb.ParsedMounts()
+	if err != nil {
+		t.Fatalf("ParsedMounts: %v", err)
+	}
+	home, _ := os.UserHomeDir()
+	if len(mounts) != 2 || mounts[0] != (SandboxMount{Path: "/srv/cache"}) || mounts[1] != (SandboxMount{Path: filepath.Join(home, ".claude"), Writable: true}) {
+		t.Fatalf("unexpected mounts: %+v", mounts)
+	}
+	if ResolveSandbox(sb, &SandboxConfig{Mode: "none"}).Enabled() {
+		t.Fatal("mode none override must disable the sandbox")
+	}
+}
+
+func TestValidateConfigRejectsInvalidSandbox(t *testing.T) {
+	for _, sb := range []SandboxConfig{
+		{Mode: "chroot"},
+		{Mode: "docker"},
+		{Mode: "bwrap", Network: "bridge"},
+		{Mode: "bwrap", Memory: "lots"},
+		{Mode: "podman", Image: "img", Memory: "lots"},
+		{Mode: "podman", Image: "img", CPUs: -1},
+		{Mode: "podman", Image: "img", Network: "vpn"},
+		{Mode: "bwrap", Mounts: []string{"relative/dir"}},
+		{Mode: "bwrap", Mounts: []string{"/data:rx"}},
+		{Mode: "podman", Image: "img", Env: []string{"BAD-NAME"}},
+	} {
+		cfg := makeMinimalConfig("claude")
+		s := sb
+		cfg.Defaults.Sandbox = &s
+		if err := ValidateConfig(cfg); err == nil {
+			t.Fatalf("expected validation error for sandbox %+v", sb)
+		}
+	}
+
+	cfg := makeMinimalConfig("claude")
+	cfg.Agents["xai"] = AgentConfig{Type: "xai", Sandbox: &SandboxConfig{Mode: "bwrap"}}
+	if err := ValidateConfig(cfg); err == nil || !strings.Contains(err.Error(), "CLI agents") {
+		t.Fatalf("expected REST sandbox error, got %v", err)
+	}
+}
+
+func TestValidateConfigResources(t *testing.T) {
+	valid := []ResourcesConfig{
+		{},
+		{CPUMax: "max", MemoryMax: "max"},
+		{CPUMax: "150000 100000", MemoryMax: "512M", PidsMax: 100, CgroupParent: "/user.slice/agents"},
+	}
+	for _, resources := range valid {
+		cfg := makeMinimalConfig("claude")
+		r := resources
+		cfg.Defaults.Resources = &r
+		if err := ValidateConfig(cfg); err != nil {
+			t.Fatalf("resources %+v: unexpected error %v", resources, err)
+		}
+	}
+	invalid := []ResourcesConfig{
+		{CPUMax: "two"},
+		{CPUMax: "0 100000"},
+		{CPUMax: "100000 10"},
+		{MemoryMax: "4GB"},
+		{PidsMax: -1},
+		{CgroupParent: "../escape"},
+	}
+	for _, resources := range invalid {
+		cfg := makeMinimalConfig("claude")
+		r := resources
+		cfg.Defaults.Resources = &r
+		if err := ValidateConfig(cfg); err == nil {
+			t.Fatalf("expected validation error for resources %+v", resources)
+		}
+	}
+}
+
+func TestValidateConfigBusBackend(t *testing.T) {
+	for backend, wantErr := range map[string]bool{"": false, "file": false, "sqlite": false, "postgres": true} {
+		cfg := &Config{
+			Agents: map[string]AgentConfig{
+				"claude": {Type: "claude"},
+			},
+			Defaults: DefaultConfig{Timeout: 10},
+			Storage:  StorageConfig{BusBackend: backend},
+		}
+		if err := ValidateConfig(cfg); (err != nil) != wantErr {
+			t.Errorf("bus_backend %q: err = %v, want error %v", backend, err, wantErr)
+		}
+	}
+}
+
+func TestLoadConfigMessageBusValidation(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `agents:
+  claude:
+    type: claude
+
+defaults:
+  agent: claude
+  timeout: 10
+
+message_bus:
+  validation: strict
+  types:
+    - type: DECISION
+      required: [body, meta.decision_id]
+      body_pattern: '(?m)^Rationale:'
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfigForServer(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigForServer: %v", err)
+	}
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig: %v", err)
+	}
+	if cfg.MessageBus.Validation != "strict" || len(cfg.MessageBus.Types) != 1 || cfg.MessageBus.Types[0].Required[1] != "meta.decision_id" {
+		t.Fatalf("unexpected message_bus config: %+v", cfg.MessageBus)
+	}
+
+	cfg.MessageBus.Validation = "loud"
+	if err := ValidateConfig(cfg); err == nil {
+		t.Fatal("expected invalid validation mode error")
+	}
+	cfg.MessageBus.Validation = "warn"
+	cfg.MessageBus.Types[0].BodyPattern = "("
+	if err := ValidateConfig(cfg); err == nil {
+		t.Fatal("expected invalid body_pattern error")
+	}
+}
+
+func TestLoadConfigWorkflowsDirs(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	content := `agents:
+  claude:
+    type: claude
+
+workflows:
+  dirs: [workflows, /abs/templates]
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfigForServer(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfigForServer: %v", err)
+	}
+	want := []string{filepath.Join(dir, "workflows"), "/abs/templates"}
+	if len(cfg.Workflows.Dirs) != 2 || cfg.Workflows.Dirs[0] != want[0] || cfg.Workflows.Dirs[1] != want[1] {
+		t.Fatalf("workflows.dirs = %v, want %v", cfg.Workflows.Dirs, want)
+	}
+
+	hclCfg, err := parseHCLConfig([]byte("workflows {\n  dir = \"/srv/workflows\"\n}\n"))
+	if err != nil {
+		t.Fatalf("parseHCLConfig: %v", err)
+	}
+	if len(hclCfg.Workflows.Dirs) != 1 || hclCfg.Workflows.Dirs[0] != "/srv/workflows" {
+		t.Fatalf("hcl workflows.dirs = %v", hclCfg.Workflows.Dirs)
+	}
+}
@@ -3,12 +3,13 @@
 //   - Block headers:        name { ... }
 //   - String values:        key = "value"
 //   - Integer values:       key = 42
+//   - Boolean values:       key = true
 //   - Single-line comments: # ... or // ...
 //
 // Agent type is inferred from the block name when the "type" attribute is absent,
 // so "codex { ... }" needs no explicit type = "codex".
 //
-// Reserved block names: defaults, api, storage.
+// Reserved block names: defaults, api, storage, message_bus, workflows.
 // All other blocks are treated as agent configurations.
 package config
 
@@ -45,6 +46,14 @@ func parseHCLConfig(data []byte) (*Config, error) {
 			if err := applyHCLStorageBlock(cfg, b.values); err != nil {
 				return nil, fmt.Errorf("storage block: %w", err)
 			}
+		case "workflows":
+			if v, ok := b.values["dir"]; ok {
+				cfg.Workflows.Dirs = append(cfg.Workflows.Dirs, v)
+			}
+		case "message_bus":
+			if v, ok := b.values["validation"]; ok {
+				cfg.MessageBus.Validation = v
+			}
 		default:
 			// Agent block — type inferred from block name if absent
 			agent := AgentConfig{}
@@ -63,6 +72,13 @@ func parseHCLConfig(data []byte) (*Config, error) {
 			if v, ok := b.values["model"]; ok {
 				agent.Model = v
 			}
+			if v, ok := b.values["tools"]; ok {
+				enabled, err := strconv.ParseBool(v)
+				if err != nil {
+					return nil, fmt.Errorf("agent %q tools: %w", b.name, err)
+				}
+				agent.Tools = enabled
+			}
 			cfg.Agents[b.name] = agent
 		}
 	}
@@ -226,5 +242,8 @@ func applyHCLStorageBlock(cfg *Config, values map[string]string) error {
 	if v, ok := values["runs_dir"]; ok {
 		cfg.Storage.RunsDir = v
 	}
+	if v, ok := values["bus_backend"]; ok {
+		cfg.Storage.BusBackend = v
+	}
 	return nil
 }
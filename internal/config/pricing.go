@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PriceConfig is a per-million-token price used to estimate run cost when an
+// agent does not report cost itself. Keys of Config.Pricing are model names
+// (e.g. "claude-sonnet-4-5") or agent types (e.g. "codex") as a fallback.
+type PriceConfig struct {
+	InputPerMTok       float64 `yaml:"input_per_mtok"`
+	OutputPerMTok      float64 `yaml:"output_per_mtok"`
+	CachedInputPerMTok float64 `yaml:"cached_input_per_mtok,omitempty"`
+}
+
+// Cost returns the estimated USD cost for the given token counts. Cached
+// input tokens are a subset of inputTokens and are billed at the cached rate
+// when one is configured, otherwise at the regular input rate.
+func (p PriceConfig) Cost(inputTokens, cachedInputTokens, outputTokens int64) float64 {
+	cachedRate := p.CachedInputPerMTok
+	if cachedRate <= 0 {
+		cachedRate = p.InputPerMTok
+	}
+	uncached := inputTokens - cachedInputTokens
+	if uncached < 0 {
+		uncached = 0
+	}
+	total := float64(uncached)*p.InputPerMTok +
+		float64(cachedInputTokens)*cachedRate +
+		float64(outputTokens)*p.OutputPerMTok
+	return total / 1_000_000
+}
+
+// PriceFor looks up the price for a run. The model name is tried first, then
+// each fallback key (typically the agent name and agent type). Lookups are
+// case-insensitive.
+func (c *Config) PriceFor(model string, fallbacks ...string) (PriceConfig, bool) {
+	if c == nil || len(c.Pricing) == 0 {
+		return PriceConfig{}, false
+	}
+	keys := append([]string{model}, fallbacks...)
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if price, ok := c.Pricing[key]; ok {
+			return price, true
+		}
+		for name, price := range c.Pricing {
+			if strings.EqualFold(name, key) {
+				return price, true
+			}
+		}
+	}
+	return PriceConfig{}, false
+}
+
+func validatePricing(pricing map[string]PriceConfig) error {
+	for name, price := range pricing {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("pricing has an empty model name")
+		}
+		if price.InputPerMTok < 0 || price.OutputPerMTok < 0 || price.CachedInputPerMTok < 0 {
+			return fmt.Errorf("pricing.%s: prices must be non-negative", name)
+		}
+	}
+	return nil
+}
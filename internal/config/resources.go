@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ResourcesConfig places every CLI run in its own cgroup v2 (Linux only).
+// A present block enables accounting of peak memory, CPU time and OOM kills
+// in run-info.yaml even when no limit is set.
+type ResourcesConfig struct {
+	// CPUMax is written to cpu.max: "max" or "<quota> [<period>]" in
+	// microseconds, e.g. "200000 100000" for two CPUs.
+	CPUMax string `yaml:"cpu_max,omitempty"`
+	// MemoryMax is written to memory.max: bytes with an optional K, M or G
+	// suffix, or "max".
+	MemoryMax string `yaml:"memory_max,omitempty"`
+	// PidsMax is written to pids.max; zero means no limit.
+	PidsMax int `yaml:"pids_max,omitempty"`
+	// CgroupParent is the delegated cgroup under which run cgroups are
+	// created, absolute or relative to the cgroup v2 mount. Defaults to
+	// run-agent's own cgroup.
+	CgroupParent string `yaml:"cgroup_parent,omitempty"`
+}
+
+var (
+	cgroupCPUMaxPattern    = regexp.MustCompile(`^(max|[0-9]+)( [0-9]+)?$`)
+	cgroupMemoryMaxPattern = regexp.MustCompile(`^(max|[0-9]+[KMGkmg]?)$`)
+)
+
+func validateResources(resources *ResourcesConfig) error {
+	if resources == nil {
+		return nil
+	}
+	if cpu := strings.TrimSpace(resources.CPUMax); cpu != "" {
+		match := cgroupCPUMaxPattern.FindStringSubmatch(cpu)
+		if match == nil {
+			return fmt.Errorf("defaults.resources.cpu_max %q is invalid (want \"max\" or \"<quota> [<period>]\")", resources.CPUMax)
+		}
+		if match[1] == "0" {
+			return fmt.Errorf("defaults.resources.cpu_max quota must be positive")
+		}
+		if period := strings.TrimSpace(match[2]); period != "" {
+			if n, _ := strconv.Atoi(period); n < 1000 || n > 1000000 {
+				return fmt.Errorf("defaults.resources.cpu_max period must be between 1000 and 1000000")
+			}
+		}
+	}
+	if memory := strings.TrimSpace(resources.MemoryMax); memory != "" && !cgroupMemoryMaxPattern.MatchString(memory) {
+		return fmt.Errorf("defaults.resources.memory_max %q is invalid (e.g. 512M, 4G or max)", resources.MemoryMax)
+	}
+	if resources.PidsMax < 0 {
+		return fmt.Errorf("defaults.resources.pids_max must be non-negative")
+	}
+	if strings.Contains(resources.CgroupParent, "..") {
+		return fmt.Errorf("defaults.resources.cgroup_parent must not contain \"..\"")
+	}
+	return nil
+}
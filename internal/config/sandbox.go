@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Sandbox modes.
+const (
+	SandboxNone   = "none"
+	SandboxBwrap  = "bwrap"
+	SandboxPodman = "podman"
+	SandboxDocker = "docker"
+)
+
+// Sandbox network policies.
+const (
+	SandboxNetworkHost   = "host"
+	SandboxNetworkNone   = "none"
+	SandboxNetworkBridge = "bridge"
+)
+
+// SandboxConfig confines CLI agent processes. Only the working directory,
+// the task directory (run directory, message bus, DONE marker) and the
+// listed mounts are visible to the agent. REST agents run in-process and
+// are never sandboxed.
+type SandboxConfig struct {
+	// Mode is none (default), bwrap, podman or docker.
+	Mode string `yaml:"mode,omitempty"`
+	// Image is the container image; required for podman and docker.
+	Image string `yaml:"image,omitempty"`
+	// Network is host or none for bwrap (default host), and bridge, host
+	// or none for containers (default: the runtime's default network).
+	Network string `yaml:"network,omitempty"`
+	// Mounts are extra host paths, mounted at the same location, written as
+	// "path", "path:ro" (default) or "path:rw". "~/" is expanded.
+	Mounts []string `yaml:"mounts,omitempty"`
+	// Env names extra environment variables passed into containers; JRUN_*
+	// and the agent token variables are always passed.
+	Env []string `yaml:"env,omitempty"`
+	// Memory is a memory limit such as "4g". bwrap, which has no limits of
+	// its own, applies Memory, CPUs and PidsLimit to the run cgroup.
+	Memory string `yaml:"memory,omitempty"`
+	// CPUs is a CPU limit, e.g. 1.5.
+	CPUs float64 `yaml:"cpus,omitempty"`
+	// PidsLimit caps the number of processes of the run.
+	PidsLimit int `yaml:"pids_limit,omitempty"`
+}
+
+// SandboxMount is a parsed SandboxConfig.Mounts entry.
+type SandboxMount struct {
+	Path     string
+	Writable bool
+}
+
+// Enabled reports whether s wraps agent commands.
+func (s *SandboxConfig) Enabled() bool {
+	return s != nil && s.ModeName() != SandboxNone
+}
+
+// ModeName returns the normalized mode; empty means none.
+func (s *SandboxConfig) ModeName() string {
+	if s == nil {
+		return SandboxNone
+	}
+	mode := strings.ToLower(strings.TrimSpace(s.Mode))
+	if mode == "" {
+		return SandboxNone
+	}
+	return mode
+}
+
+// IsContainer reports whether s runs agents through a container runtime.
+func (s *SandboxConfig) IsContainer() bool {
+	mode := s.ModeName()
+	return mode == SandboxPodman || mode == SandboxDocker
+}
+
+// ParsedMounts parses Mounts.
+func (s *SandboxConfig) ParsedMounts() ([]SandboxMount, error) {
+	if s == nil {
+		return nil, nil
+	}
+	mounts := make([]SandboxMount, 0, len(s.Mounts))
+	for i, raw := range s.Mounts {
+		path := strings.TrimSpace(raw)
+		mount := SandboxMount{}
+		if idx := strings.LastIndex(path, ":"); idx >= 0 {
+			switch path[idx+1:] {
+			case "ro":
+			case "rw":
+				mount.Writable = true
+			default:
+				return nil, fmt.Errorf("mounts[%d] %q: access must be ro or rw", i, raw)
+			}
+			path = path[:idx]
+		}
+		if path == "~" || strings.HasPrefix(path, "~/") {
+			expanded, err := expandHome(path)
+			if err != nil {
+				return nil, fmt.Errorf("mounts[%d] %q: %w", i, raw, err)
+			}
+			path = expanded
+		}
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("mounts[%d] %q: path must be absolute", i, raw)
+		}
+		mount.Path = filepath.Clean(path)
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
+
+// ResolveSandbox overlays an agent's sandbox block on the defaults block.
+// Fields set in override win; an override with mode none disables the
+// sandbox for that agent.
+func ResolveSandbox(defaults, override *SandboxConfig) *SandboxConfig {
+	if override == nil {
+		return defaults
+	}
+	if defaults == nil {
+		return override
+	}
+	merged := *defaults
+	if override.Mode != "" {
+		merged.Mode = override.Mode
+	}
+	if override.Image != "" {
+		merged.Image = override.Image
+	}
+	if override.Network != "" {
+		merged.Network = override.Network
+	}
+	if len(override.Mounts) > 0 {
+		merged.Mounts = append(append([]string(nil), defaults.Mounts...), override.Mounts...)
+	}
+	if len(override.Env) > 0 {
+		merged.Env = append(append([]string(nil), defaults.Env...), override.Env...)
+	}
+	if override.Memory != "" {
+		merged.Memory = override.Memory
+	}
+	if override.CPUs != 0 {
+		merged.CPUs = override.CPUs
+	}
+	if override.PidsLimit != 0 {
+		merged.PidsLimit = override.PidsLimit
+	}
+	return &merged
+}
+
+var (
+	sandboxMemoryPattern  = regexp.MustCompile(`^[0-9]+[bkmgBKMG]?$`)
+	sandboxEnvNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// validateSandbox checks a sandbox block; field is its config path, e.g.
+// "defaults.sandbox".
+func validateSandbox(field string, s *SandboxConfig) error {
+	if s == nil {
+		return nil
+	}
+	mode := s.ModeName()
+	switch mode {
+	case SandboxNone, SandboxBwrap, SandboxPodman, SandboxDocker:
+	default:
+		return fmt.Errorf("%s.mode %q is invalid (want none, bwrap, podman or docker)", field, s.Mode)
+	}
+	network := strings.ToLower(strings.TrimSpace(s.Network))
+	switch {
+	case network == "":
+	case mode == SandboxBwrap && network != SandboxNetworkHost && network != SandboxNetworkNone:
+		return fmt.Errorf("%s.network %q is invalid for bwrap (want host or none)", field, s.Network)
+	case network != SandboxNetworkHost && network != SandboxNetworkNone && network != SandboxNetworkBridge:
+		return fmt.Errorf("%s.network %q is invalid (want bridge, host or none)", field, s.Network)
+	}
+	if s.IsContainer() && strings.TrimSpace(s.Image) == "" {
+		return fmt.Errorf("%s.image is required for %s", field, mode)
+	}
+	if memory := strings.TrimSpace(s.Memory); memory != "" && !sandboxMemoryPattern.MatchString(memory) {
+		return fmt.Errorf("%s.memory %q is invalid (e.g. 512m, 4g)", field, s.Memory)
+	}
+	if s.CPUs < 0 {
+		return fmt.Errorf("%s.cpus must be non-negative", field)
+	}
+	if s.PidsLimit < 0 {
+		return fmt.Errorf("%s.pids_limit must be non-negative", field)
+	}
+	for _, name := range s.Env {
+		if !sandboxEnvNamePattern.MatchString(name) {
+			return fmt.Errorf("%s.env: invalid variable name %q", field, name)
+		}
+	}
+	if _, err := s.ParsedMounts(); err != nil {
+		return fmt.Errorf("%s.%w", field, err)
+	}
+	return nil
+}
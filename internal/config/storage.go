@@ -20,5 +20,12 @@ func resolveStoragePaths(cfg *Config, baseDir string) error {
 		}
 		cfg.Storage.ExtraRoots[i] = resolved
 	}
+	for i, dir := range cfg.Workflows.Dirs {
+		resolved, err := resolvePath(baseDir, dir)
+		if err != nil {
+			return fmt.Errorf("resolve workflows.dirs[%d]: %w", i, err)
+		}
+		cfg.Workflows.Dirs[i] = resolved
+	}
 	return nil
 }
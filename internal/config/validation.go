@@ -6,15 +6,11 @@ import (
 	"os"
 	"strings"
 	"time"
-)
 
-var validAgentTypes = map[string]struct{}{
-	"claude":     {},
-	"codex":      {},
-	"gemini":     {},
-	"perplexity": {},
-	"xai":        {},
-}
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	_ "github.com/jonnyzzz/conductor-loop/internal/agent/builtin"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+)
 
 // ValidateConfig validates the configuration for required fields and constraints.
 func ValidateConfig(cfg *Config) error {
@@ -44,26 +40,35 @@ func ValidateConfig(cfg *Config) error {
 	if cfg.API.SSE.MaxClientsPerRun < 0 {
 		return fmt.Errorf("api.sse.max_clients_per_run must be non-negative")
 	}
+	if err := validateSandbox("defaults.sandbox", cfg.Defaults.Sandbox); err != nil {
+		return err
+	}
 
-	for name, agent := range cfg.Agents {
-		if agent.Type == "" {
+	for name, agentCfg := range cfg.Agents {
+		if agentCfg.Type == "" {
 			return fmt.Errorf("agent %q has empty type", name)
 		}
 
-		if _, ok := validAgentTypes[agent.Type]; !ok {
-			return fmt.Errorf("agent %q has invalid type %q", name, agent.Type)
+		if err := validateAgentType(name, agentCfg); err != nil {
+			return err
 		}
 
 		// token/token_file are optional — CLI agents (claude, codex, gemini)
 		// can authenticate via their own mechanisms.
 
-		if agent.Token != "" && agent.TokenFile != "" && !agent.tokenFromFile {
+		if agentCfg.Token != "" && agentCfg.TokenFile != "" && !agentCfg.tokenFromFile {
 			return fmt.Errorf("agent %q cannot set both token and token_file", name)
 		}
 
-		if agent.TokenFile != "" {
-			if err := validateTokenFile(agent.TokenFile); err != nil {
-				return fmt.Errorf("agent %q token_file %q: %w", name, agent.TokenFile, err)
+		if agentCfg.Sandbox != nil {
+			if err := validateSandbox(fmt.Sprintf("agents.%s.sandbox", name), ResolveSandbox(cfg.Defaults.Sandbox, agentCfg.Sandbox)); err != nil {
+				return err
+			}
+		}
+
+		if agentCfg.TokenFile != "" {
+			if err := validateTokenFile(agentCfg.TokenFile); err != nil {
+				return fmt.Errorf("agent %q token_file %q: %w", name, agentCfg.TokenFile, err)
 			}
 		}
 	}
@@ -72,6 +77,19 @@ func ValidateConfig(cfg *Config) error {
 		return fmt.Errorf("api.port must be between 0 and 65535")
 	}
 
+	switch strings.TrimSpace(cfg.Storage.BusBackend) {
+	case "", "file", "sqlite":
+	default:
+		return fmt.Errorf("storage.bus_backend must be \"file\" or \"sqlite\", got %q", cfg.Storage.BusBackend)
+	}
+
+	if _, err := messagebus.NormalizeValidationMode(cfg.MessageBus.Validation); err != nil {
+		return fmt.Errorf("message_bus.validation: %w", err)
+	}
+	if _, err := messagebus.NewRegistry(cfg.MessageBus.Types...); err != nil {
+		return fmt.Errorf("message_bus.types: %w", err)
+	}
+
 	if cfg.Webhook != nil {
 		if err := validateWebhookConfig(cfg.Webhook); err != nil {
 			return err
@@ -84,9 +102,63 @@ func ValidateConfig(cfg *Config) error {
 		}
 	}
 
+	if err := validatePricing(cfg.Pricing); err != nil {
+		return err
+	}
+
+	if err := validateBudget(cfg.Defaults.Budget); err != nil {
+		return err
+	}
+
+	if err := validateResources(cfg.Defaults.Resources); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateAgentType checks an agent block against the descriptor registered
+// for its type; custom agents are checked against their command template.
+func validateAgentType(name string, agentCfg AgentConfig) error {
+	if agentCfg.Type == agent.CustomType {
+		if agentCfg.Tools {
+			return fmt.Errorf("agent %q: tools are not supported for custom agents", name)
+		}
+		if _, err := agent.NewCustomDescriptor(agentCfg.CustomSpec()); err != nil {
+			return fmt.Errorf("agent %q: %w", name, err)
+		}
+		return nil
+	}
+
+	desc, ok := agent.Lookup(agentCfg.Type)
+	if !ok || desc.Type != agentCfg.Type {
+		return fmt.Errorf("agent %q has invalid type %q", name, agentCfg.Type)
+	}
+	if len(agentCfg.Command) > 0 || agentCfg.PromptMode != "" || agentCfg.TokenEnv != "" {
+		return fmt.Errorf("agent %q: command, prompt_mode and token_env are only valid for custom agents", name)
+	}
+	if desc.RequiresBaseURL && strings.TrimSpace(agentCfg.BaseURL) == "" {
+		return fmt.Errorf("agent %q of type %s requires base_url", name, agentCfg.Type)
+	}
+	if agentCfg.Tools && !desc.SupportsTools {
+		return fmt.Errorf("agent %q: tools are supported only for %s agents", name, strings.Join(toolAgentTypes(), " and "))
+	}
+	if agentCfg.Sandbox != nil && desc.REST {
+		return fmt.Errorf("agent %q: sandbox is only supported for CLI agents", name)
+	}
 	return nil
 }
 
+func toolAgentTypes() []string {
+	var types []string
+	for _, agentType := range agent.Types() {
+		if desc, ok := agent.Lookup(agentType); ok && desc.SupportsTools {
+			types = append(types, agentType)
+		}
+	}
+	return types
+}
+
 var validDiversificationStrategies = map[string]struct{}{
 	"round-robin": {},
 	"weighted":    {},
@@ -0,0 +1,78 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// 2026-03-04 is a Wednesday.
+	base := time.Date(2026, 3, 4, 10, 17, 30, 0, time.UTC)
+	for _, tc := range []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2026-03-04T10:18:00Z"},
+		{"*/15 * * * *", "2026-03-04T10:30:00Z"},
+		{"0 3 * * *", "2026-03-05T03:00:00Z"},
+		{"@daily", "2026-03-05T00:00:00Z"},
+		{"@hourly", "2026-03-04T11:00:00Z"},
+		{"30 2 * * mon-fri", "2026-03-05T02:30:00Z"},
+		{"0 9 * * sat,sun", "2026-03-07T09:00:00Z"},
+		{"0 9 * * 7", "2026-03-08T09:00:00Z"},
+		{"0 0 1 */3 *", "2026-04-01T00:00:00Z"},
+		{"0 0 13 * 5", "2026-03-06T00:00:00Z"}, // either day field matches
+		{"0 12 29 feb *", "2028-02-29T12:00:00Z"},
+		{"5-10/5 10 * * *", "2026-03-05T10:05:00Z"},
+	} {
+		s, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.expr, err)
+		}
+		if got := s.Next(base).Format(time.RFC3339); got != tc.want {
+			t.Errorf("Next(%q) = %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestNextUsesLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s, err := Parse("0 3 * * *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got := s.Next(time.Date(2026, 3, 4, 0, 30, 0, 0, time.UTC).In(loc))
+	if want := time.Date(2026, 3, 4, 1, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestNextNeverMatches(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Fatalf("Next = %s, want zero", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * foo *",
+		"@every 5m",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): expected an error", expr)
+		}
+	}
+}
@@ -88,12 +88,13 @@ func PromoteFacts(cfg PromoteConfig) (promoted int, already int, err error) {
 			continue
 		}
 
-		bus, busErr := messagebus.NewMessageBus(busPath)
+		bus, busErr := messagebus.Open(busPath, "")
 		if busErr != nil {
 			continue
 		}
 
-		messages, readErr := bus.ReadMessages("")
+		messages, readErr := bus.ReadMessagesByType(0, filterType)
+		bus.Close()
 		if readErr != nil {
 			continue
 		}
@@ -313,6 +313,24 @@ func EncodeSpec(spec WorkflowSpec, format OutputFormat) ([]byte, error) {
 	}
 }
 
+// DecodeSpec parses a workflow spec in YAML or JSON (a YAML subset).
+func DecodeSpec(data []byte) (WorkflowSpec, error) {
+	var spec WorkflowSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return WorkflowSpec{}, fmt.Errorf("decode workflow spec: %w", err)
+	}
+	return spec, nil
+}
+
+// LoadSpec reads a workflow spec file written by EncodeSpec or by hand.
+func LoadSpec(path string) (WorkflowSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return WorkflowSpec{}, fmt.Errorf("read workflow spec: %w", err)
+	}
+	return DecodeSpec(data)
+}
+
 func normalizeGoalText(text string) string {
 	normalized := strings.ReplaceAll(text, "\r\n", "\n")
 	normalized = strings.ReplaceAll(normalized, "\r", "\n")
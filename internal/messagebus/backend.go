@@ -0,0 +1,82 @@
+package messagebus
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Message bus storage backends, selected with storage.bus_backend.
+const (
+	// BackendFile stores messages in the append-only markdown bus file.
+	BackendFile = "file"
+	// BackendSQLite stores messages in <bus>.db and keeps the markdown bus
+	// file as an export for agents.
+	BackendSQLite = "sqlite"
+)
+
+// Bus is the storage-independent message bus API. *MessageBus implements it
+// on top of the markdown file; *SQLiteBus on top of an embedded database.
+// Open a bus with Open rather than a backend constructor so that migrated
+// buses are always written through their database.
+type Bus interface {
+	AppendMessage(msg *Message) (string, error)
+	ReadMessages(sinceID string) ([]*Message, error)
+	ReadMessagesSinceLimited(sinceID string, limit int) ([]*Message, error)
+	ReadLastN(n int) ([]*Message, error)
+	ReadMessagesByType(limit int, types ...string) ([]*Message, error)
+	ReadMessagesByRunID(runID string, limit int) ([]*Message, error)
+	ReadMessagesWhere(f *Filter, limit int) ([]*Message, error)
+	PollForNew(lastID string) ([]*Message, error)
+
+	// Consumer cursors (see Cursor).
+	Cursors() ([]Cursor, error)
+	Cursor(consumer string) (*Cursor, error)
+	ReadUnacked(consumer string, limit int) ([]*Message, error)
+	Ack(consumer, msgID string) (*Cursor, error)
+	ResetCursor(consumer string) (bool, error)
+
+	ReadInbox(taskID, runID string, unread bool) ([]*Message, error)
+	WaitForAnswer(ctx context.Context, questionID string) (*Message, error)
+
+	Compact(opts CompactOptions) (CompactResult, error)
+	ArchiveSegments() ([]ArchiveSegment, error)
+
+	Close() error
+}
+
+var (
+	_ Bus = (*MessageBus)(nil)
+	_ Bus = (*SQLiteBus)(nil)
+)
+
+// Open opens the bus at path (the markdown bus file path) with the given
+// backend. A bus that already has a database (see SQLitePath) is always
+// opened with the SQLite backend, so every writer of a migrated bus goes
+// through the database; an empty backend means BackendFile otherwise.
+// Callers must Close the returned bus.
+func Open(path, backend string, opts ...Option) (Bus, error) {
+	backend = strings.ToLower(strings.TrimSpace(backend))
+	switch backend {
+	case "", BackendFile, BackendSQLite:
+	default:
+		return nil, errors.Errorf("unknown message bus backend %q", backend)
+	}
+	if backend != BackendSQLite {
+		if _, err := os.Stat(SQLitePath(path)); err == nil {
+			backend = BackendSQLite
+		}
+	}
+	if backend == BackendSQLite {
+		return NewSQLiteBus(path, opts...)
+	}
+	return NewMessageBus(path, opts...)
+}
+
+// Close releases the bus. The file backend holds no resources between
+// calls, so it is a no-op.
+func (mb *MessageBus) Close() error {
+	return nil
+}
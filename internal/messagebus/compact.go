@@ -0,0 +1,547 @@
+package messagebus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/pkg/errors"
+)
+
+// Compaction moves the oldest messages of a bus into dated archive segments
+// next to it and rewrites the live bus with the remaining messages:
+//
+//	<bus>.archive-YYYY-MM-DD   messages whose timestamp falls on that UTC day
+//	<bus>.archive.json         ordered segment list (the archive manifest)
+//
+// Archived messages keep their bytes and msg_ids, so ReadMessages(sinceID)
+// continues from an archived cursor through the later segments into the
+// live bus. Optionally, RUN_START/RUN_STOP events are summarized into one
+// RUN_ROLLUP message per segment batch; every other message type (FACT,
+// DECISION, ...) is archived verbatim.
+const (
+	archiveSegmentInfix   = ".archive-"
+	archiveManifestSuffix = ".archive.json"
+	archiveManifestVer    = 1
+	archiveDateLayout     = "2006-01-02"
+
+	// EventTypeRunRollup summarizes archived run lifecycle events.
+	EventTypeRunRollup = "RUN_ROLLUP"
+
+	// RollupReplacesMetaKey lists the comma-separated msg_ids a rollup replaced.
+	RollupReplacesMetaKey = "rollup_replaces"
+)
+
+// rollupTypes are the message types compaction may summarize.
+var rollupTypes = map[string]bool{
+	EventTypeRunStart: true,
+	EventTypeRunStop:  true,
+}
+
+// CompactOptions selects which messages Compact moves to the archive. The
+// oldest messages are moved while they match Before or exceed TargetBytes;
+// with neither set every message is moved. KeepLast always wins.
+type CompactOptions struct {
+	// Before moves messages with a timestamp before this time.
+	Before time.Time
+	// TargetBytes moves the oldest messages until the live bus is at most
+	// this size.
+	TargetBytes int64
+	// KeepLast keeps at least this many of the newest messages in the bus.
+	KeepLast int
+	// Rollup summarizes RUN_START/RUN_STOP events into RUN_ROLLUP messages.
+	Rollup bool
+	// DryRun reports what would be moved without changing any file.
+	DryRun bool
+}
+
+// CompactResult reports what Compact did (or would do in dry-run mode).
+type CompactResult struct {
+	Moved       int      `json:"moved"`
+	Summarized  int      `json:"summarized"`
+	Rollups     int      `json:"rollups"`
+	Segments    []string `json:"segments,omitempty"`
+	BytesBefore int64    `json:"bytes_before"`
+	BytesAfter  int64    `json:"bytes_after"`
+}
+
+// ArchiveSegment describes one dated archive segment.
+type ArchiveSegment struct {
+	File     string    `json:"file"`
+	Date     string    `json:"date"`
+	FirstID  string    `json:"first_id"`
+	LastID   string    `json:"last_id"`
+	FirstTS  time.Time `json:"first_ts"`
+	LastTS   time.Time `json:"last_ts"`
+	Messages int       `json:"messages"`
+	Rollups  int       `json:"rollups,omitempty"`
+}
+
+// archiveManifest is <bus>.archive.json. CompactedThrough is the last
+// msg_id moved out of the live bus; it lets a compaction interrupted after
+// writing the archive but before rewriting the bus finish the job.
+type archiveManifest struct {
+	Version          int              `json:"version"`
+	CompactedThrough string           `json:"compacted_through,omitempty"`
+	Segments         []ArchiveSegment `json:"segments"`
+}
+
+// ArchiveManifestPath returns the path of the archive manifest of busPath.
+func ArchiveManifestPath(busPath string) string {
+	return busPath + archiveManifestSuffix
+}
+
+// ArchiveSegments lists the archive segments of the bus, oldest first.
+func (mb *MessageBus) ArchiveSegments() ([]ArchiveSegment, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	return archiveSegments(mb.path)
+}
+
+func archiveSegments(busPath string) ([]ArchiveSegment, error) {
+	m, err := readArchiveManifest(busPath)
+	if err != nil {
+		return nil, err
+	}
+	return m.Segments, nil
+}
+
+// WithAutoCompact compacts the bus inside the write lock whenever it
+// reaches maxBytes, moving old messages to the archive until it is at most
+// half that size (see Compact). Set maxBytes to 0 to disable (default).
+func WithAutoCompact(maxBytes int64, opts CompactOptions) Option {
+	return func(bus *MessageBus) {
+		bus.autoCompactBytes = maxBytes
+		opts.DryRun = false
+		if opts.TargetBytes <= 0 || opts.TargetBytes >= maxBytes {
+			opts.TargetBytes = maxBytes / 2
+		}
+		bus.autoCompact = opts
+	}
+}
+
+// Compact moves old messages into dated archive segments under the bus
+// write lock. See CompactOptions for how messages are selected.
+func (mb *MessageBus) Compact(opts CompactOptions) (CompactResult, error) {
+	if mb == nil {
+		return CompactResult{}, errors.New("message bus is nil")
+	}
+	if err := validateBusPath(mb.path); err != nil {
+		return CompactResult{}, errors.Wrap(err, "validate message bus path")
+	}
+	if _, err := os.Stat(mb.path); os.IsNotExist(err) {
+		return CompactResult{}, nil
+	}
+	file, err := mb.openLocked()
+	if err != nil {
+		return CompactResult{}, err
+	}
+	defer file.Close()
+	defer func() {
+		_ = Unlock(file)
+	}()
+	return mb.compactLocked(opts, nil)
+}
+
+// compactLocked compacts the bus; the caller holds the bus write lock. When
+// drop is set, it is called with the last moved msg_id once the archive is
+// written and before the bus file is rewritten, so that a backend keeping
+// the messages elsewhere removes them too.
+func (mb *MessageBus) compactLocked(opts CompactOptions, drop func(throughID string) error) (CompactResult, error) {
+	var result CompactResult
+	data, err := os.ReadFile(mb.path)
+	if err != nil {
+		return result, errors.Wrap(err, "read message bus")
+	}
+	result.BytesBefore = int64(len(data))
+	result.BytesAfter = result.BytesBefore
+
+	var messages []*Message
+	var offsets []int64
+	err = scanMessages(bufio.NewReader(bytes.NewReader(data)), 0, func(msg *Message, offset int64) error {
+		if strings.HasPrefix(msg.MsgID, "LEGACY-LINE-") {
+			return errors.New("bus contains legacy one-line entries and cannot be compacted")
+		}
+		messages = append(messages, msg)
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	offsets = append(offsets, int64(len(data)))
+
+	manifest, err := readArchiveManifest(mb.path)
+	if err != nil {
+		return result, err
+	}
+	archived := 0
+	if manifest.CompactedThrough != "" {
+		for i, msg := range messages {
+			if msg.MsgID == manifest.CompactedThrough {
+				archived = i + 1
+				break
+			}
+		}
+	}
+	cut := compactionCut(messages, offsets, archived, opts)
+	if cut == 0 {
+		return result, nil
+	}
+
+	batches := buildArchiveBatches(filepath.Base(mb.path), data, messages[archived:cut], offsets[archived:cut+1], opts.Rollup)
+	result.Moved = cut - archived
+	result.BytesAfter = int64(len(data)) - offsets[cut]
+	for _, batch := range batches {
+		result.Summarized += batch.summarized
+		result.Rollups += batch.segment.Rollups
+		result.Segments = append(result.Segments, batch.segment.File)
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	for _, batch := range batches {
+		if err := manifest.appendBatch(mb.path, batch); err != nil {
+			return result, err
+		}
+	}
+	manifest.CompactedThrough = messages[cut-1].MsgID
+	if err := writeArchiveManifest(mb.path, manifest); err != nil {
+		return result, err
+	}
+	if drop != nil {
+		if err := drop(manifest.CompactedThrough); err != nil {
+			return result, err
+		}
+	}
+	if err := replaceFileContents(mb.path, data[offsets[cut]:]); err != nil {
+		return result, err
+	}
+	// The sidecar index described the old file.
+	_ = os.Remove(IndexPath(mb.path))
+
+	obslog.Log(log.Default(), "INFO", "messagebus", "bus_compacted",
+		obslog.F("path", mb.path),
+		obslog.F("moved", result.Moved),
+		obslog.F("summarized", result.Summarized),
+		obslog.F("rollups", result.Rollups),
+		obslog.F("bytes_before", result.BytesBefore),
+		obslog.F("bytes_after", result.BytesAfter),
+	)
+	return result, nil
+}
+
+// compactionCut returns how many leading messages leave the live bus.
+// Messages before archived are already in the archive and always leave.
+func compactionCut(messages []*Message, offsets []int64, archived int, opts CompactOptions) int {
+	total := len(messages)
+	cut := total
+	if !opts.Before.IsZero() || opts.TargetBytes > 0 {
+		cut = 0
+		if !opts.Before.IsZero() {
+			for cut < total && messages[cut].Timestamp.Before(opts.Before) {
+				cut++
+			}
+		}
+		if opts.TargetBytes > 0 {
+			size := offsets[total]
+			bySize := 0
+			for bySize < total && size-offsets[bySize] > opts.TargetBytes {
+				bySize++
+			}
+			cut = max(cut, bySize)
+		}
+	}
+	if opts.KeepLast > 0 {
+		cut = min(cut, total-opts.KeepLast)
+	}
+	return max(cut, archived)
+}
+
+// archiveBatch is the run of moved messages destined for one segment.
+type archiveBatch struct {
+	segment    ArchiveSegment
+	chunks     [][]byte
+	summarized int
+}
+
+// buildArchiveBatches groups messages by UTC day into segments of the bus
+// named busName. offsets has one more entry than messages: the end of the
+// last message.
+func buildArchiveBatches(busName string, data []byte, messages []*Message, offsets []int64, rollup bool) []*archiveBatch {
+	var batches []*archiveBatch
+	var current *archiveBatch
+	var lifecycle []int
+	var lifecycleMsgs []*Message
+	flush := func() {
+		if current == nil {
+			return
+		}
+		if rollup && len(lifecycle) >= 2 {
+			if chunk, err := serializeMessage(newRollupMessage(lifecycleMsgs)); err == nil {
+				current.chunks[lifecycle[0]] = chunk
+				for _, i := range lifecycle[1:] {
+					current.chunks[i] = nil
+				}
+				current.summarized = len(lifecycle)
+				current.segment.Rollups = 1
+			}
+		}
+		kept := current.chunks[:0]
+		for _, chunk := range current.chunks {
+			if chunk != nil {
+				kept = append(kept, chunk)
+			}
+		}
+		current.chunks = kept
+		current.segment.Messages = len(kept)
+		batches = append(batches, current)
+	}
+	for i, msg := range messages {
+		date := msg.Timestamp.UTC().Format(archiveDateLayout)
+		if msg.Timestamp.IsZero() && current != nil {
+			date = current.segment.Date
+		}
+		if current == nil || date > current.segment.Date {
+			flush()
+			current = &archiveBatch{segment: ArchiveSegment{
+				File:    busName + archiveSegmentInfix + date,
+				Date:    date,
+				FirstID: msg.MsgID,
+				FirstTS: msg.Timestamp,
+			}}
+			lifecycle, lifecycleMsgs = nil, nil
+		}
+		// Each chunk is the serialized message without the separator line
+		// that follows it in the bus.
+		chunk := data[offsets[i]:offsets[i+1]]
+		if bytes.HasSuffix(chunk, []byte("\n\n")) {
+			chunk = chunk[:len(chunk)-1]
+		}
+		if rollupTypes[msg.Type] {
+			lifecycle = append(lifecycle, len(current.chunks))
+			lifecycleMsgs = append(lifecycleMsgs, msg)
+		}
+		current.chunks = append(current.chunks, chunk)
+		current.segment.LastID = msg.MsgID
+		current.segment.LastTS = msg.Timestamp
+	}
+	flush()
+	return batches
+}
+
+// newRollupMessage summarizes lifecycle events, one line per event.
+func newRollupMessage(events []*Message) *Message {
+	counts := make(map[string]int)
+	ids := make([]string, 0, len(events))
+	var body strings.Builder
+	for _, msg := range events {
+		counts[msg.Type]++
+		ids = append(ids, msg.MsgID)
+	}
+	fmt.Fprintf(&body, "Summarized %d run lifecycle events (%d %s, %d %s)\n",
+		len(events), counts[EventTypeRunStart], EventTypeRunStart, counts[EventTypeRunStop], EventTypeRunStop)
+	for _, msg := range events {
+		line, _, _ := strings.Cut(strings.TrimSpace(msg.Body), "\n")
+		fmt.Fprintf(&body, "- %s %s %s: %s\n", msg.Timestamp.UTC().Format(time.RFC3339), msg.Type, msg.RunID, line)
+	}
+	first, last := events[0], events[len(events)-1]
+	return &Message{
+		MsgID:     GenerateMessageID(),
+		Timestamp: first.Timestamp.UTC(),
+		Type:      EventTypeRunRollup,
+		ProjectID: first.ProjectID,
+		TaskID:    first.TaskID,
+		Meta: map[string]string{
+			"rollup_count":        strconv.Itoa(len(events)),
+			"rollup_from":         first.Timestamp.UTC().Format(time.RFC3339Nano),
+			"rollup_to":           last.Timestamp.UTC().Format(time.RFC3339Nano),
+			RollupReplacesMetaKey: strings.Join(ids, ","),
+		},
+		Body: body.String(),
+	}
+}
+
+// appendBatch appends a batch to its segment file, extending the last
+// manifest entry when the batch continues the newest segment.
+func (m *archiveManifest) appendBatch(busPath string, batch *archiveBatch) error {
+	if len(batch.chunks) == 0 {
+		return nil
+	}
+	segment := batch.segment
+	if n := len(m.Segments); n > 0 && segment.Date < m.Segments[n-1].Date {
+		// A skewed clock produced an earlier day; keep the segments ordered.
+		segment.Date = m.Segments[n-1].Date
+		segment.File = m.Segments[n-1].File
+	}
+	path := filepath.Join(filepath.Dir(busPath), segment.File)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, messageBusFileMode)
+	if err != nil {
+		return errors.Wrap(err, "open archive segment")
+	}
+	defer f.Close()
+	for _, chunk := range batch.chunks {
+		if err := appendEntry(f, chunk); err != nil {
+			return errors.Wrap(err, "write archive segment")
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "fsync archive segment")
+	}
+
+	if n := len(m.Segments); n > 0 && m.Segments[n-1].File == segment.File {
+		last := &m.Segments[n-1]
+		last.LastID, last.LastTS = segment.LastID, segment.LastTS
+		last.Messages += segment.Messages
+		last.Rollups += segment.Rollups
+		return nil
+	}
+	m.Segments = append(m.Segments, segment)
+	return nil
+}
+
+func readArchiveManifest(busPath string) (*archiveManifest, error) {
+	m := &archiveManifest{Version: archiveManifestVer}
+	data, err := os.ReadFile(ArchiveManifestPath(busPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, errors.Wrap(err, "read archive manifest")
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrap(err, "parse archive manifest")
+	}
+	if m.Version != archiveManifestVer {
+		return nil, errors.Errorf("unsupported archive manifest version %d", m.Version)
+	}
+	return m, nil
+}
+
+func writeArchiveManifest(busPath string, m *archiveManifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode archive manifest")
+	}
+	return replaceFileContents(ArchiveManifestPath(busPath), append(data, '\n'))
+}
+
+// replaceFileContents atomically replaces path with data.
+func replaceFileContents(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, messageBusFileMode)
+	if err != nil {
+		return errors.Wrap(err, "create temp file")
+	}
+	if err := writeAll(f, data); err != nil {
+		f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "fsync temp file")
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "close temp file")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "replace file")
+	}
+	return nil
+}
+
+// readArchivedSince returns the messages after sinceID when sinceID was
+// moved to the archive: the rest of its segment, the later segments and the
+// live bus. A cursor on a summarized lifecycle event resumes after its
+// rollup. ok is false when the archive does not know sinceID.
+func (mb *MessageBus) readArchivedSince(sinceID string) ([]*Message, bool, error) {
+	return readArchivedSince(mb.path, sinceID, func() ([]*Message, error) { return mb.ReadMessages("") })
+}
+
+// readArchivedSince implements readArchivedSince for the bus at busPath
+// whose live messages are returned by live.
+func readArchivedSince(busPath, sinceID string, live func() ([]*Message, error)) ([]*Message, bool, error) {
+	manifest, err := readArchiveManifest(busPath)
+	if err != nil || len(manifest.Segments) == 0 {
+		return nil, false, nil
+	}
+	dir := filepath.Dir(busPath)
+	var out []*Message
+	found := false
+	// Cursors are usually recent, so search the newest segment first.
+	for i := len(manifest.Segments) - 1; i >= 0 && !found; i-- {
+		messages, err := readSegmentMessages(filepath.Join(dir, manifest.Segments[i].File))
+		if err != nil {
+			return nil, false, err
+		}
+		for j, msg := range messages {
+			if msg.MsgID == sinceID || rollupReplaces(msg, sinceID) {
+				found = true
+				out = append(out, messages[j+1:]...)
+				for _, later := range manifest.Segments[i+1:] {
+					rest, err := readSegmentMessages(filepath.Join(dir, later.File))
+					if err != nil {
+						return nil, false, err
+					}
+					out = append(out, rest...)
+				}
+				break
+			}
+		}
+	}
+	if !found {
+		return nil, false, nil
+	}
+	current, err := live()
+	if err != nil {
+		return nil, false, err
+	}
+	seen := make(map[string]bool, len(out))
+	for _, msg := range out {
+		seen[msg.MsgID] = true
+	}
+	for _, msg := range current {
+		// An interrupted compaction can leave archived messages in the bus.
+		if !seen[msg.MsgID] {
+			out = append(out, msg)
+		}
+	}
+	return out, true, nil
+}
+
+func readSegmentMessages(path string) ([]*Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read archive segment")
+	}
+	return parseMessages(data)
+}
+
+func rollupReplaces(msg *Message, id string) bool {
+	if msg.Type != EventTypeRunRollup {
+		return false
+	}
+	for _, replaced := range strings.Split(msg.Meta[RollupReplacesMetaKey], ",") {
+		if replaced == id {
+			return true
+		}
+	}
+	return false
+}
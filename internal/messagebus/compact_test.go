@@ -0,0 +1,210 @@
+package messagebus
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendAt(t *testing.T, bus Bus, ts time.Time, msgType, runID, body string) string {
+	t.Helper()
+	id, err := bus.AppendMessage(&Message{
+		Timestamp: ts,
+		Type:      msgType,
+		ProjectID: "project",
+		TaskID:    "task",
+		RunID:     runID,
+		Body:      body,
+		Meta:      map[string]string{"n": body},
+	})
+	if err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	return id
+}
+
+func TestCompactArchivesByDayAndKeepsCursors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	day1 := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	day3 := day2.Add(24 * time.Hour)
+
+	fact := appendAt(t, bus, day1, "FACT", "", "tests are green")
+	start1 := appendAt(t, bus, day1.Add(time.Minute), EventTypeRunStart, "run-1", "run started")
+	progress := appendAt(t, bus, day1.Add(2*time.Minute), "PROGRESS", "run-1", "halfway")
+	stop1 := appendAt(t, bus, day1.Add(3*time.Minute), EventTypeRunStop, "run-1", "run stopped\nexit 0")
+	decision := appendAt(t, bus, day1.Add(4*time.Minute), "DECISION", "", "use plan B")
+	appendAt(t, bus, day1.Add(5*time.Minute), EventTypeRunStart, "run-2", "run started")
+	appendAt(t, bus, day1.Add(6*time.Minute), EventTypeRunStop, "run-2", "run stopped")
+	start3 := appendAt(t, bus, day2, EventTypeRunStart, "run-3", "run started")
+	fact2 := appendAt(t, bus, day2.Add(time.Minute), "FACT", "", "day two fact")
+	recent := appendAt(t, bus, day3, "PROGRESS", "run-3", "still going")
+	before, _ := bus.ReadMessages("")
+
+	dry, err := bus.Compact(CompactOptions{Before: day3, Rollup: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("dry-run Compact: %v", err)
+	}
+	if after, _ := bus.ReadMessages(""); len(after) != len(before) {
+		t.Fatalf("dry run changed the bus")
+	}
+
+	res, err := bus.Compact(CompactOptions{Before: day3, Rollup: true})
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if !reflect.DeepEqual(res, dry) {
+		t.Fatalf("dry run %+v differs from compaction %+v", dry, res)
+	}
+	if res.Moved != 9 || res.Summarized != 4 || res.Rollups != 1 || len(res.Segments) != 2 || res.BytesAfter >= res.BytesBefore {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	live, err := bus.ReadMessages("")
+	if err != nil || !reflect.DeepEqual(messageIDs(live), []string{recent}) {
+		t.Fatalf("live bus after compaction = %v, %v", messageIDs(live), err)
+	}
+	segments, err := bus.ArchiveSegments()
+	if err != nil || len(segments) != 2 {
+		t.Fatalf("ArchiveSegments = %+v, %v", segments, err)
+	}
+	if segments[0].File != "TASK-MESSAGE-BUS.md.archive-2026-01-01" || segments[0].Messages != 4 || segments[0].Rollups != 1 ||
+		segments[1].FirstID != start3 || segments[1].LastID != fact2 {
+		t.Fatalf("unexpected segments: %+v", segments)
+	}
+
+	// A cursor on an archived message continues through the archive into the bus.
+	got, err := bus.ReadMessages(fact)
+	if err != nil {
+		t.Fatalf("ReadMessages(archived): %v", err)
+	}
+	if len(got) != 6 || got[0].Type != EventTypeRunRollup || got[1].MsgID != progress || got[2].MsgID != decision ||
+		got[3].MsgID != start3 || got[4].MsgID != fact2 || got[5].MsgID != recent {
+		t.Fatalf("ReadMessages(archived) = %v", messageIDs(got))
+	}
+	rollup := got[0]
+	if rollup.Meta["rollup_count"] != "4" || !strings.Contains(rollup.Meta[RollupReplacesMetaKey], stop1) ||
+		!strings.Contains(rollup.Body, "RUN_STOP run-1: run stopped") || strings.Contains(rollup.Body, "exit 0") {
+		t.Fatalf("unexpected rollup: %+v", rollup)
+	}
+	// FACT and DECISION messages are archived untouched.
+	for i, want := range before {
+		if want.MsgID != decision && want.MsgID != fact2 {
+			continue
+		}
+		for _, msg := range got {
+			if msg.MsgID == want.MsgID && (strings.TrimSpace(msg.Body) != strings.TrimSpace(before[i].Body) || !reflect.DeepEqual(msg.Meta, before[i].Meta)) {
+				t.Fatalf("archived %s changed: %+v", msg.MsgID, msg)
+			}
+		}
+	}
+
+	// A cursor on a summarized event resumes after its rollup.
+	got, _ = bus.ReadMessages(start1)
+	if len(got) != 5 || got[0].MsgID != progress {
+		t.Fatalf("ReadMessages(summarized) = %v", messageIDs(got))
+	}
+	got, _ = bus.ReadMessagesSinceLimited(fact, 2)
+	if !reflect.DeepEqual(messageIDs(got), []string{fact2, recent}) {
+		t.Fatalf("ReadMessagesSinceLimited(archived) = %v", messageIDs(got))
+	}
+	if _, err := bus.ReadMessages("MSG-unknown"); err == nil {
+		t.Fatalf("expected unknown cursor to fail")
+	}
+
+	// Appends continue on the rewritten bus; a later compaction extends the archive.
+	next := appendAt(t, bus, day3.Add(time.Hour), "FACT", "", "after compaction")
+	if got, _ := bus.ReadMessages(recent); !reflect.DeepEqual(messageIDs(got), []string{next}) {
+		t.Fatalf("ReadMessages after append = %v", messageIDs(got))
+	}
+	if _, err := bus.Compact(CompactOptions{KeepLast: 1}); err != nil {
+		t.Fatalf("second Compact: %v", err)
+	}
+	if got, _ := bus.ReadMessages(fact2); !reflect.DeepEqual(messageIDs(got), []string{recent, next}) {
+		t.Fatalf("ReadMessages across compactions = %v", messageIDs(got))
+	}
+	if segments, _ := bus.ArchiveSegments(); len(segments) != 3 {
+		t.Fatalf("expected a third segment, got %+v", segments)
+	}
+}
+
+func TestCompactResumesInterruptedRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	ids := appendIndexTestMessages(t, bus, 0, 6)
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read bus: %v", err)
+	}
+	if _, err := bus.Compact(CompactOptions{KeepLast: 3}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	// Simulate a crash after the archive was written but before the bus was
+	// rewritten: the archived messages are still in the bus.
+	if err := os.WriteFile(path, original, 0o644); err != nil {
+		t.Fatalf("restore bus: %v", err)
+	}
+	if got, _ := bus.ReadMessages(ids[1]); !reflect.DeepEqual(messageIDs(got), ids[2:]) {
+		t.Fatalf("ReadMessages with leftovers = %v", messageIDs(got))
+	}
+	res, err := bus.Compact(CompactOptions{KeepLast: 100})
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if res.Moved != 0 {
+		t.Fatalf("leftovers archived twice: %+v", res)
+	}
+	live, _ := bus.ReadMessages("")
+	if !reflect.DeepEqual(messageIDs(live), ids[3:]) {
+		t.Fatalf("live bus = %v", messageIDs(live))
+	}
+	if segments, _ := bus.ArchiveSegments(); len(segments) != 1 || segments[0].Messages != 3 {
+		t.Fatalf("segments = %+v", segments)
+	}
+}
+
+func TestAutoCompactBoundsBusSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	const maxBytes = 2048
+	bus, err := NewMessageBus(path, WithAutoCompact(maxBytes, CompactOptions{KeepLast: 2}))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	var ids []string
+	for i := 0; i < 60; i++ {
+		ids = append(ids, appendAt(t, bus, time.Time{}, "PROGRESS", "run-1", fmt.Sprintf("message %d", i)))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Size() >= maxBytes {
+		t.Fatalf("bus grew to %d bytes", info.Size())
+	}
+	got, err := bus.ReadMessages(ids[0])
+	if err != nil || !reflect.DeepEqual(messageIDs(got), ids[1:]) {
+		t.Fatalf("ReadMessages(first) = %d messages, %v", len(got), err)
+	}
+}
+
+func TestCompactRejectsLegacyBus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	if err := os.WriteFile(path, []byte("[2026-01-01 10:00:00] FACT: legacy\n"), 0o644); err != nil {
+		t.Fatalf("write bus: %v", err)
+	}
+	bus, _ := NewMessageBus(path)
+	if _, err := bus.Compact(CompactOptions{}); err == nil || !strings.Contains(err.Error(), "legacy") {
+		t.Fatalf("expected legacy error, got %v", err)
+	}
+}
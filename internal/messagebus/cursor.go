@@ -0,0 +1,249 @@
+package messagebus
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/pkg/errors"
+)
+
+const cursorsVersion = 1
+
+// ErrInvalidConsumer is returned for consumer names that cannot be stored.
+var ErrInvalidConsumer = stderrors.New("invalid consumer name")
+
+var consumerNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Cursor is the position of a named consumer on a bus: the last message it
+// acknowledged.
+type Cursor struct {
+	Consumer string    `json:"consumer"`
+	MsgID    string    `json:"msg_id"`
+	AckedAt  time.Time `json:"acked_at"`
+}
+
+// cursorFile is the on-disk layout of <bus>.cursors.json.
+type cursorFile struct {
+	Version   int                `json:"version"`
+	Consumers map[string]*Cursor `json:"consumers"`
+}
+
+// CursorsPath returns the file holding the consumer cursors of the bus at busPath.
+func CursorsPath(busPath string) string {
+	return busPath + ".cursors.json"
+}
+
+// ValidateConsumerName reports whether name can be used as a consumer name:
+// 1-128 letters, digits, '.', '_' or '-', starting with a letter or digit.
+func ValidateConsumerName(name string) error {
+	if !consumerNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidConsumer, name)
+	}
+	return nil
+}
+
+// Cursors returns all consumer cursors of the bus, ordered by name.
+func (mb *MessageBus) Cursors() ([]Cursor, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	state, err := readCursorFile(CursorsPath(mb.path))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Cursor, 0, len(state.Consumers))
+	for _, cursor := range state.Consumers {
+		out = append(out, *cursor)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Consumer < out[j].Consumer })
+	return out, nil
+}
+
+// Cursor returns the cursor of consumer, or nil when it never acknowledged
+// a message.
+func (mb *MessageBus) Cursor(consumer string) (*Cursor, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	if err := ValidateConsumerName(consumer); err != nil {
+		return nil, err
+	}
+	state, err := readCursorFile(CursorsPath(mb.path))
+	if err != nil {
+		return nil, err
+	}
+	return state.Consumers[consumer], nil
+}
+
+// ReadUnacked returns the messages after the cursor of consumer, oldest
+// first, at most limit of them when limit > 0. A consumer without a cursor
+// reads the whole bus. When the cursor message is gone (the bus was rotated
+// without an archive), the whole bus is returned again: consumers get
+// at-least-once delivery, never a silent gap.
+func (mb *MessageBus) ReadUnacked(consumer string, limit int) ([]*Message, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	return readUnacked(mb, mb.path, consumer, limit)
+}
+
+// readUnacked implements ReadUnacked for any backend of the bus at path.
+func readUnacked(b Bus, path, consumer string, limit int) ([]*Message, error) {
+	cursor, err := b.Cursor(consumer)
+	if err != nil {
+		return nil, err
+	}
+	var messages []*Message
+	if cursor == nil {
+		messages, err = b.ReadMessages("")
+	} else {
+		messages, err = b.ReadMessages(cursor.MsgID)
+		if stderrors.Is(err, ErrSinceIDNotFound) {
+			obslog.Log(log.Default(), "WARN", "messagebus", "consumer_cursor_lost",
+				obslog.F("path", path),
+				obslog.F("consumer", consumer),
+				obslog.F("msg_id", cursor.MsgID),
+			)
+			messages, err = b.ReadMessages("")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+// Ack moves the cursor of consumer to msgID and returns the resulting
+// cursor. msgID must be on the bus or in its archive. Cursors only move
+// forward: acknowledging a message at or before the current cursor leaves
+// the cursor unchanged, so late or duplicate acks are harmless.
+func (mb *MessageBus) Ack(consumer, msgID string) (*Cursor, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	if err := ValidateConsumerName(consumer); err != nil {
+		return nil, err
+	}
+	if msgID == "" {
+		return nil, errors.New("msg id is required")
+	}
+	if _, err := mb.ReadMessages(msgID); err != nil {
+		return nil, errors.Wrapf(err, "ack %s", msgID)
+	}
+	var result *Cursor
+	err := mb.updateCursors(func(state *cursorFile) bool {
+		current := state.Consumers[consumer]
+		if !ackMovesCursor(mb, current, msgID) {
+			result = current
+			return false
+		}
+		result = &Cursor{Consumer: consumer, MsgID: msgID, AckedAt: mb.now().UTC()}
+		state.Consumers[consumer] = result
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ResetCursor deletes the cursor of consumer so that it reads the bus from
+// the start again. It reports whether a cursor existed.
+func (mb *MessageBus) ResetCursor(consumer string) (bool, error) {
+	if mb == nil {
+		return false, errors.New("message bus is nil")
+	}
+	if err := ValidateConsumerName(consumer); err != nil {
+		return false, err
+	}
+	existed := false
+	err := mb.updateCursors(func(state *cursorFile) bool {
+		_, existed = state.Consumers[consumer]
+		delete(state.Consumers, consumer)
+		return existed
+	})
+	return existed, err
+}
+
+// updateCursors applies fn to the cursor file under an exclusive lock and
+// writes it back when fn reports a change. The file is replaced atomically,
+// so readers never need the lock.
+func (mb *MessageBus) updateCursors(fn func(state *cursorFile) bool) error {
+	path := CursorsPath(mb.path)
+	file, err := openLockedFile(path, os.O_RDWR|os.O_CREATE, mb.lockTimeout)
+	if err != nil {
+		return errors.Wrap(err, "lock consumer cursors")
+	}
+	defer func() {
+		_ = Unlock(file)
+		file.Close()
+	}()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return errors.Wrap(err, "read consumer cursors")
+	}
+	state, err := parseCursorFile(data)
+	if err != nil {
+		return err
+	}
+	if !fn(state) {
+		return nil
+	}
+	state.Version = cursorsVersion
+	out, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode consumer cursors")
+	}
+	return replaceFileContents(path, append(out, '\n'))
+}
+
+func readCursorFile(path string) (*cursorFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "read consumer cursors")
+	}
+	return parseCursorFile(data)
+}
+
+func parseCursorFile(data []byte) (*cursorFile, error) {
+	state := &cursorFile{Version: cursorsVersion}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, errors.Wrap(err, "decode consumer cursors")
+		}
+	}
+	if state.Consumers == nil {
+		state.Consumers = make(map[string]*Cursor)
+	}
+	return state, nil
+}
+
+// ackMovesCursor reports whether acknowledging msgID moves the cursor
+// current forward, i.e. msgID is not at or before it on the bus b.
+func ackMovesCursor(b Bus, current *Cursor, msgID string) bool {
+	if current == nil || current.MsgID == msgID {
+		return true
+	}
+	after, err := b.ReadMessages(current.MsgID)
+	return err != nil || containsMessageID(after, msgID)
+}
+
+func containsMessageID(messages []*Message, msgID string) bool {
+	for _, msg := range messages {
+		if msg != nil && msg.MsgID == msgID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package messagebus
+
+import (
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConsumerCursorAck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	ids := appendIndexTestMessages(t, bus, 0, 5)
+
+	if cursor, err := bus.Cursor("ralph"); err != nil || cursor != nil {
+		t.Fatalf("Cursor before ack = %+v, %v", cursor, err)
+	}
+	got, err := bus.ReadUnacked("ralph", 2)
+	if err != nil || !reflect.DeepEqual(messageIDs(got), ids[:2]) {
+		t.Fatalf("ReadUnacked without cursor = %v, %v", messageIDs(got), err)
+	}
+
+	cursor, err := bus.Ack("ralph", ids[2])
+	if err != nil || cursor.MsgID != ids[2] || cursor.Consumer != "ralph" || cursor.AckedAt.IsZero() {
+		t.Fatalf("Ack = %+v, %v", cursor, err)
+	}
+	if got, _ := bus.ReadUnacked("ralph", 0); !reflect.DeepEqual(messageIDs(got), ids[3:]) {
+		t.Fatalf("ReadUnacked after ack = %v", messageIDs(got))
+	}
+
+	// Stale and duplicate acks leave the cursor where it is.
+	for _, id := range []string{ids[0], ids[2]} {
+		if cursor, err := bus.Ack("ralph", id); err != nil || cursor.MsgID != ids[2] {
+			t.Fatalf("Ack(%s) moved the cursor: %+v, %v", id, cursor, err)
+		}
+	}
+	if _, err := bus.Ack("ralph", "MSG-unknown"); !stderrors.Is(err, ErrSinceIDNotFound) {
+		t.Fatalf("Ack(unknown) = %v", err)
+	}
+	for _, name := range []string{"", ".hidden", "a/b", "has space"} {
+		if _, err := bus.Ack(name, ids[0]); !stderrors.Is(err, ErrInvalidConsumer) {
+			t.Fatalf("Ack(%q) = %v", name, err)
+		}
+	}
+
+	// Consumers are independent.
+	if _, err := bus.Ack("reviewer", ids[4]); err != nil {
+		t.Fatalf("Ack(reviewer): %v", err)
+	}
+	cursors, err := bus.Cursors()
+	if err != nil || len(cursors) != 2 || cursors[0].Consumer != "ralph" || cursors[1].MsgID != ids[4] {
+		t.Fatalf("Cursors = %+v, %v", cursors, err)
+	}
+
+	if existed, err := bus.ResetCursor("ralph"); err != nil || !existed {
+		t.Fatalf("ResetCursor = %v, %v", existed, err)
+	}
+	if existed, _ := bus.ResetCursor("ralph"); existed {
+		t.Fatalf("second ResetCursor reported an existing cursor")
+	}
+	if got, _ := bus.ReadUnacked("ralph", 0); !reflect.DeepEqual(messageIDs(got), ids) {
+		t.Fatalf("ReadUnacked after reset = %v", messageIDs(got))
+	}
+}
+
+func TestConsumerCursorSurvivesCompactionAndRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	ids := appendIndexTestMessages(t, bus, 0, 6)
+	if _, err := bus.Ack("ralph", ids[1]); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if _, err := bus.Compact(CompactOptions{KeepLast: 2}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if got, _ := bus.ReadUnacked("ralph", 0); !reflect.DeepEqual(messageIDs(got), ids[2:]) {
+		t.Fatalf("ReadUnacked after compaction = %v", messageIDs(got))
+	}
+	// Archived messages can still be acknowledged.
+	if cursor, err := bus.Ack("ralph", ids[3]); err != nil || cursor.MsgID != ids[3] {
+		t.Fatalf("Ack(archived) = %+v, %v", cursor, err)
+	}
+
+	// Rotation without an archive manifest loses the cursor message: the
+	// consumer re-reads the fresh bus instead of skipping it.
+	if err := os.Remove(ArchiveManifestPath(path)); err != nil {
+		t.Fatalf("remove manifest: %v", err)
+	}
+	if err := os.Rename(path, path+".20260101-000000.archived"); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	fresh := appendIndexTestMessages(t, bus, 6, 8)
+	if got, err := bus.ReadUnacked("ralph", 0); err != nil || !reflect.DeepEqual(messageIDs(got), fresh) {
+		t.Fatalf("ReadUnacked after rotation = %v, %v", messageIDs(got), err)
+	}
+	if cursor, err := bus.Ack("ralph", fresh[0]); err != nil || cursor.MsgID != fresh[0] {
+		t.Fatalf("Ack after rotation = %+v, %v", cursor, err)
+	}
+}
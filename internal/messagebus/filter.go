@@ -0,0 +1,590 @@
+package messagebus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Filter is a parsed message filter expression, e.g.
+//
+//	type in (FACT,DECISION) and meta.kind = "task_completion_propagation" and ts > -2h
+//
+// Comparisons are "field op value" with the operators =, !=, ~ (contains,
+// case-insensitive), !~, <, <=, >, >= (ts only) and "in (v1, v2, ...)" /
+// "not in (...)". They combine with and, or, not and parentheses; and binds
+// tighter than or.
+//
+// Fields: msg_id, type, project (project_id), task (task_id), run (run_id),
+// issue (issue_id), to_task, to_run, parent (any parent msg_id), body, ts
+// (timestamp) and meta.<key>. Type comparisons ignore case. A missing meta
+// key compares as "". ts values are RFC3339 timestamps, dates (2006-01-02),
+// "now" or offsets from now such as -2h, -30m or -7d. Values containing
+// spaces or operator characters must be quoted with " or '.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// ParseFilter parses a filter expression; relative times are resolved
+// against the current time. An empty expression yields a nil filter, which
+// matches every message.
+func ParseFilter(expr string) (*Filter, error) {
+	return ParseFilterAt(expr, time.Now())
+}
+
+// ParseFilterAt parses a filter expression, resolving relative times
+// against now.
+func ParseFilterAt(expr string, now time.Time) (*Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens, now: now}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	return &Filter{expr: strings.TrimSpace(expr), root: root}, nil
+}
+
+// String returns the expression the filter was parsed from.
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// Match reports whether msg satisfies the filter. A nil filter matches
+// every non-nil message.
+func (f *Filter) Match(msg *Message) bool {
+	if msg == nil {
+		return false
+	}
+	if f == nil {
+		return true
+	}
+	return f.root.match(msg)
+}
+
+// Types returns message types one of which every matching message must
+// have, or nil when the filter does not constrain the type. Readers use it
+// to narrow reads through the type index.
+func (f *Filter) Types() []string {
+	if f == nil {
+		return nil
+	}
+	types, _ := requiredTypes(f.root)
+	return types
+}
+
+// FilterMessages returns the messages matching f, preserving order.
+func FilterMessages(messages []*Message, f *Filter) []*Message {
+	filtered := make([]*Message, 0, len(messages))
+	for _, msg := range messages {
+		if f.Match(msg) {
+			filtered = append(filtered, msg)
+		}
+	}
+	return filtered
+}
+
+// ReadMessagesWhere returns the messages matching f, oldest first, keeping
+// the latest limit entries when limit > 0. Filters that constrain the type
+// read only those types through the sidecar index when the bus has one.
+func (mb *MessageBus) ReadMessagesWhere(f *Filter, limit int) ([]*Message, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	return readMessagesWhere(mb, f, limit)
+}
+
+// readMessagesWhere implements ReadMessagesWhere for any backend.
+func readMessagesWhere(b Bus, f *Filter, limit int) ([]*Message, error) {
+	if f == nil {
+		if limit > 0 {
+			return b.ReadLastN(limit)
+		}
+		return b.ReadMessages("")
+	}
+	var messages []*Message
+	var err error
+	if types := f.Types(); len(types) > 0 {
+		messages, err = b.ReadMessagesByType(0, types...)
+	} else {
+		messages, err = b.ReadMessages("")
+	}
+	if err != nil {
+		return nil, err
+	}
+	messages = FilterMessages(messages, f)
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages, nil
+}
+
+type filterNode interface {
+	match(msg *Message) bool
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) match(msg *Message) bool { return n.left.match(msg) && n.right.match(msg) }
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) match(msg *Message) bool { return n.left.match(msg) || n.right.match(msg) }
+
+type notNode struct{ inner filterNode }
+
+func (n notNode) match(msg *Message) bool { return !n.inner.match(msg) }
+
+// compareNode is a single "field op value(s)" comparison.
+type compareNode struct {
+	field  string
+	op     string
+	values []string
+	times  []time.Time
+}
+
+func (n compareNode) match(msg *Message) bool {
+	if n.field == "ts" {
+		return n.matchTime(msg.Timestamp)
+	}
+	// Negated operators are evaluated as the negation of their positive form
+	// so that "parent != X" means no parent is X.
+	op, negated := n.op, false
+	switch n.op {
+	case "!=":
+		op, negated = "=", true
+	case "!~":
+		op, negated = "~", true
+	case "not in":
+		op, negated = "in", true
+	}
+	if n.field == "parent" {
+		for _, parent := range msg.Parents {
+			if n.matchString(op, parent.MsgID) {
+				return !negated
+			}
+		}
+		return negated
+	}
+	return n.matchString(op, messageField(msg, n.field)) != negated
+}
+
+// matchString applies the positive operator op (=, ~ or in) to value.
+func (n compareNode) matchString(op, value string) bool {
+	equal := func(candidate string) bool {
+		if n.field == "type" {
+			return strings.EqualFold(strings.TrimSpace(value), candidate)
+		}
+		return value == candidate
+	}
+	switch op {
+	case "=":
+		return equal(n.values[0])
+	case "~":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(n.values[0]))
+	case "in":
+		for _, candidate := range n.values {
+			if equal(candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (n compareNode) matchTime(ts time.Time) bool {
+	if n.op == "in" || n.op == "not in" {
+		found := false
+		for _, t := range n.times {
+			if ts.Equal(t) {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in")
+	}
+	want := n.times[0]
+	switch n.op {
+	case "=":
+		return ts.Equal(want)
+	case "!=":
+		return !ts.Equal(want)
+	case "<":
+		return ts.Before(want)
+	case "<=":
+		return !ts.After(want)
+	case ">":
+		return ts.After(want)
+	case ">=":
+		return !ts.Before(want)
+	}
+	return false
+}
+
+func messageField(msg *Message, field string) string {
+	if key, ok := strings.CutPrefix(field, "meta."); ok {
+		return msg.Meta[key]
+	}
+	switch field {
+	case "msg_id":
+		return msg.MsgID
+	case "type":
+		return msg.Type
+	case "project":
+		return msg.ProjectID
+	case "task":
+		return msg.TaskID
+	case "run":
+		return msg.RunID
+	case "issue":
+		return msg.IssueID
+	case "to_task":
+		return msg.ToTask
+	case "to_run":
+		return msg.ToRun
+	case "body":
+		return msg.Body
+	}
+	return ""
+}
+
+// filterFieldAliases maps accepted field names to their canonical form.
+var filterFieldAliases = map[string]string{
+	"msg_id":     "msg_id",
+	"id":         "msg_id",
+	"type":       "type",
+	"project":    "project",
+	"project_id": "project",
+	"task":       "task",
+	"task_id":    "task",
+	"run":        "run",
+	"run_id":     "run",
+	"issue":      "issue",
+	"issue_id":   "issue",
+	"to_task":    "to_task",
+	"to_run":     "to_run",
+	"parent":     "parent",
+	"body":       "body",
+	"ts":         "ts",
+	"timestamp":  "ts",
+}
+
+func requiredTypes(node filterNode) ([]string, bool) {
+	switch n := node.(type) {
+	case compareNode:
+		if n.field == "type" && (n.op == "=" || n.op == "in") {
+			return n.values, true
+		}
+	case andNode:
+		if types, ok := requiredTypes(n.left); ok {
+			return types, true
+		}
+		return requiredTypes(n.right)
+	case orNode:
+		left, okLeft := requiredTypes(n.left)
+		right, okRight := requiredTypes(n.right)
+		if okLeft && okRight {
+			return append(append([]string(nil), left...), right...), true
+		}
+	}
+	return nil, false
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t filterToken) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// filterSpecial are the characters that end a bare word.
+const filterSpecial = "()=!<>~,\"'"
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, filterToken{kind: tokenComma, text: ",", pos: i})
+			i++
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				b.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, errors.Errorf("where: unterminated string at position %d", i+1)
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: b.String(), pos: i})
+			i = j + 1
+		case strings.ContainsRune("=!<>~", r):
+			op := string(r)
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '!' && runes[i+1] == '~')) {
+				op += string(runes[i+1])
+			}
+			switch op {
+			case "==":
+				op = "="
+			case "=", "!=", "~", "!~", "<", "<=", ">", ">=":
+			default:
+				return nil, errors.Errorf("where: unknown operator %q at position %d", op, i+1)
+			}
+			tokens = append(tokens, filterToken{kind: tokenOp, text: op, pos: i})
+			i += len([]rune(op))
+			if op == "=" && i < len(runes) && runes[i] == '=' {
+				i++
+			}
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(filterSpecial, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: tokenWord, text: string(runes[i:j]), pos: i})
+			i = j
+		}
+	}
+	return append(tokens, filterToken{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	now    time.Time
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.pos] }
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) errorf(tok filterToken, format string, args ...interface{}) error {
+	return errors.Errorf("where: %s at position %d", fmt.Sprintf(format, args...), tok.pos+1)
+}
+
+// keyword reports whether tok is the bare keyword kw (case-insensitive).
+func keyword(tok filterToken, kw string) bool {
+	return tok.kind == tokenWord && strings.EqualFold(tok.text, kw)
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for keyword(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for keyword(p.peek(), "and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	tok := p.peek()
+	switch {
+	case keyword(tok, "not"):
+		p.next()
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner: inner}, nil
+	case tok.kind == tokenLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "expected ) but found %s", closing)
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != tokenWord {
+		return nil, p.errorf(fieldTok, "expected a field name but found %s", fieldTok)
+	}
+	field, err := canonicalFilterField(fieldTok.text)
+	if err != nil {
+		return nil, p.errorf(fieldTok, "%v", err)
+	}
+	node := compareNode{field: field}
+
+	opTok := p.next()
+	switch {
+	case opTok.kind == tokenOp:
+		node.op = opTok.text
+		valueTok := p.next()
+		if valueTok.kind != tokenWord && valueTok.kind != tokenString {
+			return nil, p.errorf(valueTok, "expected a value after %s but found %s", node.op, valueTok)
+		}
+		node.values = []string{valueTok.text}
+	case keyword(opTok, "in"), keyword(opTok, "not") && keyword(p.peek(), "in"):
+		node.op = "in"
+		if keyword(opTok, "not") {
+			p.next()
+			node.op = "not in"
+		}
+		if open := p.next(); open.kind != tokenLParen {
+			return nil, p.errorf(open, "expected ( after %s", node.op)
+		}
+		for {
+			valueTok := p.next()
+			if valueTok.kind != tokenWord && valueTok.kind != tokenString {
+				return nil, p.errorf(valueTok, "expected a value in list but found %s", valueTok)
+			}
+			node.values = append(node.values, valueTok.text)
+			sep := p.next()
+			if sep.kind == tokenRParen {
+				break
+			}
+			if sep.kind != tokenComma {
+				return nil, p.errorf(sep, "expected , or ) but found %s", sep)
+			}
+		}
+	default:
+		return nil, p.errorf(opTok, "expected an operator after %s but found %s", fieldTok.text, opTok)
+	}
+
+	if field == "ts" {
+		for _, value := range node.values {
+			t, err := parseFilterTime(value, p.now)
+			if err != nil {
+				return nil, p.errorf(fieldTok, "%v", err)
+			}
+			node.times = append(node.times, t)
+		}
+		if node.op == "~" || node.op == "!~" {
+			return nil, p.errorf(opTok, "operator %s is not supported for ts", node.op)
+		}
+	} else if strings.ContainsAny(node.op, "<>") {
+		return nil, p.errorf(opTok, "operator %s is only supported for ts", node.op)
+	}
+	return node, nil
+}
+
+func canonicalFilterField(name string) (string, error) {
+	lower := strings.ToLower(name)
+	if key, ok := strings.CutPrefix(lower, "meta."); ok {
+		if key == "" {
+			return "", errors.New("meta field needs a key, e.g. meta.kind")
+		}
+		// Meta keys keep their case.
+		return "meta." + name[len("meta."):], nil
+	}
+	if canonical, ok := filterFieldAliases[lower]; ok {
+		return canonical, nil
+	}
+	return "", errors.Errorf("unknown field %q", name)
+}
+
+// ParseTime parses a time the way ts comparisons of filter expressions do:
+// an RFC3339 timestamp, a date (2006-01-02), "now" or an offset from now
+// such as -2h or -7d.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	return parseFilterTime(strings.TrimSpace(value), now)
+}
+
+// parseFilterTime parses an absolute time, "now" or a signed offset from
+// now such as -2h or -7d.
+func parseFilterTime(value string, now time.Time) (time.Time, error) {
+	if strings.EqualFold(value, "now") {
+		return now, nil
+	}
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		if days, ok := strings.CutSuffix(value, "d"); ok {
+			n, err := strconv.ParseFloat(days, 64)
+			if err == nil {
+				return now.Add(time.Duration(n * float64(24*time.Hour))), nil
+			}
+		}
+		if d, err := time.ParseDuration(value); err == nil {
+			return now.Add(d), nil
+		}
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("invalid time %q (want RFC3339, 2006-01-02, now or an offset like -2h, -7d)", value)
+}
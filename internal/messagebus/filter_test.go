@@ -0,0 +1,136 @@
+package messagebus
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fact := &Message{
+		MsgID:     "MSG-1",
+		Type:      "FACT",
+		ProjectID: "proj",
+		TaskID:    "task-1",
+		RunID:     "run-1",
+		Timestamp: now.Add(-time.Hour),
+		Meta:      map[string]string{"kind": "task_completion_propagation"},
+		Parents:   []Parent{{MsgID: "MSG-0"}},
+		Body:      "Build passed on main",
+	}
+	errMsg := &Message{
+		MsgID:     "MSG-2",
+		Type:      "error",
+		ProjectID: "proj",
+		TaskID:    "task-2",
+		RunID:     "run-2",
+		Timestamp: now.Add(-72 * time.Hour),
+		Body:      "agent crashed",
+	}
+
+	tests := []struct {
+		expr      string
+		fact, err bool
+	}{
+		{`type in (FACT,DECISION) and meta.kind = "task_completion_propagation" and ts > -2h`, true, false},
+		{`type = ERROR`, false, true},
+		{`type == fact or type = error`, true, true},
+		{`type not in (fact)`, false, true},
+		{`not type = FACT`, false, true},
+		{`meta.kind != ""`, true, false},
+		{`meta.missing = ''`, true, true},
+		{`body ~ "BUILD passed"`, true, false},
+		{`body !~ crash`, true, false},
+		{`ts >= 2026-02-27 and ts < now`, true, false},
+		{`ts < -1d`, false, true},
+		{`ts > 2026-03-01T10:30:00Z`, true, false},
+		{`(run = run-1 or run_id = run-2) and task_id != task-2`, true, false},
+		{`parent = MSG-0`, true, false},
+		{`parent != MSG-0`, false, true},
+		{`project = proj and (msg_id in (MSG-2, MSG-3))`, false, true},
+	}
+	for _, tc := range tests {
+		f, err := ParseFilterAt(tc.expr, now)
+		if err != nil {
+			t.Fatalf("ParseFilterAt(%q): %v", tc.expr, err)
+		}
+		if got := f.Match(fact); got != tc.fact {
+			t.Errorf("%q on FACT = %v, want %v", tc.expr, got, tc.fact)
+		}
+		if got := f.Match(errMsg); got != tc.err {
+			t.Errorf("%q on ERROR = %v, want %v", tc.expr, got, tc.err)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for expr, want := range map[string]string{
+		`type`:                 "expected an operator",
+		`type =`:               "expected a value",
+		`colour = red`:         `unknown field "colour"`,
+		`type in (FACT`:        "expected , or )",
+		`(type = FACT`:         "expected )",
+		`type = FACT extra`:    "unexpected",
+		`body > x`:             "only supported for ts",
+		`ts > yesterday`:       "invalid time",
+		`body = "unterminated`: "unterminated string",
+		`type ! FACT`:          "unknown operator",
+		`meta. = x`:            "meta field needs a key",
+	} {
+		_, err := ParseFilter(expr)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseFilter(%q) = %v, want error containing %q", expr, err, want)
+		}
+	}
+	if f, err := ParseFilter("  "); f != nil || err != nil {
+		t.Fatalf("empty expression = %v, %v", f, err)
+	}
+}
+
+func TestFilterTypes(t *testing.T) {
+	for expr, want := range map[string][]string{
+		`type in (FACT, DECISION) and ts > -1h`: {"FACT", "DECISION"},
+		`run = r and type = ERROR`:              {"ERROR"},
+		`type = FACT or type = ERROR`:           {"FACT", "ERROR"},
+		`type = FACT or run = r`:                nil,
+		`not type = FACT`:                       nil,
+	} {
+		f, err := ParseFilter(expr)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q): %v", expr, err)
+		}
+		if got := f.Types(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Types(%q) = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestReadMessagesWhere(t *testing.T) {
+	bus, err := NewMessageBus(filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	ids := appendIndexTestMessages(t, bus, 0, 12)
+	f, err := ParseFilter(`type = fact and run = run-1`)
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+	got, err := bus.ReadMessagesWhere(f, 0)
+	if err != nil {
+		t.Fatalf("ReadMessagesWhere: %v", err)
+	}
+	if want := []string{ids[3], ids[9]}; !reflect.DeepEqual(messageIDs(got), want) {
+		t.Fatalf("ReadMessagesWhere = %v, want %v", messageIDs(got), want)
+	}
+	got, _ = bus.ReadMessagesWhere(f, 1)
+	if !reflect.DeepEqual(messageIDs(got), []string{ids[9]}) {
+		t.Fatalf("limited ReadMessagesWhere = %v", messageIDs(got))
+	}
+	got, _ = bus.ReadMessagesWhere(nil, 2)
+	if !reflect.DeepEqual(messageIDs(got), ids[10:]) {
+		t.Fatalf("ReadMessagesWhere(nil) = %v", messageIDs(got))
+	}
+}
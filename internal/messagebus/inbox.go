@@ -0,0 +1,51 @@
+package messagebus
+
+import "github.com/pkg/errors"
+
+// InboxConsumer is the consumer cursor marking the directed messages that
+// the runs of a task have already seen.
+const InboxConsumer = "inbox"
+
+// AddressedTo reports whether msg is a directed message for taskID. A
+// message that names a run (ToRun) is only for that run; an empty runID
+// matches messages for any run of the task.
+func (m *Message) AddressedTo(taskID, runID string) bool {
+	if m == nil || m.ToTask == "" || m.ToTask != taskID {
+		return false
+	}
+	return m.ToRun == "" || runID == "" || m.ToRun == runID
+}
+
+// ReadInbox returns the messages on the bus addressed to taskID and runID
+// (see AddressedTo), oldest first. With unread, only messages after the
+// InboxConsumer cursor are returned; acknowledge the last one with
+// Ack(InboxConsumer, ...) once they were delivered.
+func (mb *MessageBus) ReadInbox(taskID, runID string, unread bool) ([]*Message, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	var (
+		messages []*Message
+		err      error
+	)
+	if unread {
+		messages, err = mb.ReadUnacked(InboxConsumer, 0)
+	} else {
+		messages, err = mb.ReadMessages("")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return addressedTo(messages, taskID, runID), nil
+}
+
+// addressedTo returns the messages addressed to taskID and runID.
+func addressedTo(messages []*Message, taskID, runID string) []*Message {
+	inbox := make([]*Message, 0)
+	for _, msg := range messages {
+		if msg.AddressedTo(taskID, runID) {
+			inbox = append(inbox, msg)
+		}
+	}
+	return inbox
+}
@@ -0,0 +1,63 @@
+package messagebus
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadInbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	send := func(toTask, toRun, body string) string {
+		t.Helper()
+		id, err := bus.AppendMessage(&Message{Type: "INFO", ProjectID: "project", TaskID: "parent", ToTask: toTask, ToRun: toRun, Body: body})
+		if err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+		return id
+	}
+	broadcast := send("", "", "broadcast")
+	toTask := send("task", "", "stop and rebase")
+	toRun := send("task", "run-2", "only for run 2")
+	send("other", "", "wrong task")
+
+	data, err := readBusFileShared(path)
+	if err != nil || !strings.Contains(string(data), "to_task: task\nto_run: run-2\n") {
+		t.Fatalf("addressing not serialized: %v\n%s", err, data)
+	}
+
+	for _, tc := range []struct {
+		runID string
+		want  []string
+	}{
+		{"", []string{toTask, toRun}},
+		{"run-1", []string{toTask}},
+		{"run-2", []string{toTask, toRun}},
+	} {
+		got, err := bus.ReadInbox("task", tc.runID, false)
+		if err != nil || !reflect.DeepEqual(messageIDs(got), tc.want) {
+			t.Fatalf("ReadInbox(run %q) = %v, %v; want %v", tc.runID, messageIDs(got), err, tc.want)
+		}
+	}
+
+	if _, err := bus.Ack(InboxConsumer, toTask); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if got, _ := bus.ReadInbox("task", "", true); !reflect.DeepEqual(messageIDs(got), []string{toRun}) {
+		t.Fatalf("unread inbox = %v", messageIDs(got))
+	}
+
+	filter, err := ParseFilter("to_task = task and to_run = ''")
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+	all, _ := bus.ReadMessages("")
+	if got := FilterMessages(all, filter); !reflect.DeepEqual(messageIDs(got), []string{toTask}) {
+		t.Fatalf("to_task filter = %v (broadcast %s)", messageIDs(got), broadcast)
+	}
+}
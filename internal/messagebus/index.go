@@ -0,0 +1,634 @@
+package messagebus
+
+import (
+	"bufio"
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// The sidecar index lives next to the bus file as <bus>.idx. It is a cache:
+// it may be missing, stale or deleted at any time and is rebuilt from the
+// bus on the next read. Writers keep an existing index current under the
+// bus append lock; readers verify it against the bus before trusting it.
+//
+// Format: a header line followed by one line per message,
+//
+//	offset<TAB>length<TAB>msg_id<TAB>type<TAB>run_id
+//
+// where offset is the byte offset of the message's opening "---" line and
+// offset+length of the last line is the bus size the index covers.
+const (
+	indexFileSuffix = ".idx"
+	indexHeader     = "# run-agent message bus index v1"
+	// indexVerifyWindow is how many bytes at an indexed offset are read to
+	// confirm the message there is the one the index names.
+	indexVerifyWindow = 512
+)
+
+// indexMinBusSize is the bus size below which reads scan the file directly
+// and no index is built; small buses parse faster than an index round-trip.
+var indexMinBusSize int64 = 256 * 1024
+
+// errIndexUnsupported is returned when a bus cannot be indexed, e.g. because
+// it contains legacy one-line entries whose IDs depend on line numbers.
+var errIndexUnsupported = stderrors.New("message bus cannot be indexed")
+
+// IndexPath returns the path of the sidecar index of the bus at busPath.
+func IndexPath(busPath string) string {
+	return busPath + indexFileSuffix
+}
+
+type indexEntry struct {
+	offset  int64
+	length  int64
+	msgID   string
+	msgType string
+	runID   string
+}
+
+// busIndex is the in-memory form of a bus index.
+type busIndex struct {
+	entries []indexEntry
+	byID    map[string]int
+	byType  map[string][]int
+	byRun   map[string][]int
+}
+
+func newBusIndex() *busIndex {
+	return &busIndex{
+		byID:   make(map[string]int),
+		byType: make(map[string][]int),
+		byRun:  make(map[string][]int),
+	}
+}
+
+func (idx *busIndex) add(entry indexEntry) {
+	pos := len(idx.entries)
+	idx.entries = append(idx.entries, entry)
+	if _, ok := idx.byID[entry.msgID]; !ok {
+		// First occurrence wins, matching filterSince.
+		idx.byID[entry.msgID] = pos
+	}
+	msgType := strings.ToUpper(strings.TrimSpace(entry.msgType))
+	idx.byType[msgType] = append(idx.byType[msgType], pos)
+	if entry.runID != "" {
+		idx.byRun[entry.runID] = append(idx.byRun[entry.runID], pos)
+	}
+}
+
+// covered is the bus size the index accounts for.
+func (idx *busIndex) covered() int64 {
+	if len(idx.entries) == 0 {
+		return 0
+	}
+	last := idx.entries[len(idx.entries)-1]
+	return last.offset + last.length
+}
+
+// start returns the offset at which messages after position pos begin.
+func (idx *busIndex) start(pos int) int64 {
+	if pos < len(idx.entries) {
+		return idx.entries[pos].offset
+	}
+	return idx.covered()
+}
+
+// span is the byte range of one indexed message; end < 0 means EOF.
+type span struct {
+	start int64
+	end   int64
+	msgID string
+}
+
+// span returns the range of the message at pos. A message runs up to the
+// next one so that parsing the range yields the same body as a full scan.
+func (idx *busIndex) span(pos int) span {
+	s := span{start: idx.entries[pos].offset, end: -1, msgID: idx.entries[pos].msgID}
+	if pos+1 < len(idx.entries) {
+		s.end = idx.entries[pos+1].offset
+	}
+	return s
+}
+
+// indexHandle caches the index of one bus file in memory.
+type indexHandle struct {
+	mu          sync.Mutex
+	idx         *busIndex
+	file        os.FileInfo
+	unsupported os.FileInfo
+}
+
+var (
+	indexCacheMu sync.Mutex
+	indexCache   = make(map[string]*indexHandle)
+)
+
+func indexHandleFor(path string) *indexHandle {
+	indexCacheMu.Lock()
+	defer indexCacheMu.Unlock()
+	h, ok := indexCache[path]
+	if !ok {
+		h = &indexHandle{}
+		indexCache[path] = h
+	}
+	return h
+}
+
+// withIndex brings the index of the bus up to date and calls fn with it
+// while holding the index lock; fn must only do in-memory lookups. It
+// returns false when no index is available and the caller must scan.
+func (mb *MessageBus) withIndex(fn func(idx *busIndex)) bool {
+	if mb == nil || !mb.index {
+		return false
+	}
+	h := indexHandleFor(mb.path)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.sync(mb.path); err != nil {
+		return false
+	}
+	fn(h.idx)
+	return true
+}
+
+// sync verifies the cached index against the bus, loading it from disk,
+// catching up with appended messages or rebuilding it as needed.
+func (h *indexHandle) sync(busPath string) error {
+	f, err := os.Open(busPath)
+	if err != nil {
+		h.idx = nil
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		h.idx = nil
+		return err
+	}
+	size := fi.Size()
+	if size < indexMinBusSize {
+		h.idx = nil
+		return errIndexUnsupported
+	}
+	if h.unsupported != nil && os.SameFile(h.unsupported, fi) {
+		return errIndexUnsupported
+	}
+	h.unsupported = nil
+
+	if h.idx != nil && (h.file == nil || !os.SameFile(h.file, fi) || !verifyIndex(h.idx, f, size)) {
+		h.idx = nil
+	}
+	persist := false
+	if h.idx == nil {
+		if loaded, loadErr := readIndexFile(IndexPath(busPath)); loadErr == nil && verifyIndex(loaded, f, size) {
+			h.idx = loaded
+		}
+	}
+	if h.idx == nil {
+		h.idx = newBusIndex()
+		persist = true
+	}
+	if covered := h.idx.covered(); covered < size {
+		if err := scanIndexEntries(f, covered, size, h.idx.add); err != nil {
+			h.idx = nil
+			if stderrors.Is(err, errIndexUnsupported) {
+				h.unsupported = fi
+			}
+			return err
+		}
+	}
+	h.file = fi
+	if !persist {
+		if _, statErr := os.Stat(IndexPath(busPath)); os.IsNotExist(statErr) {
+			persist = true
+		}
+	}
+	if persist {
+		// Best-effort: a missing index only costs the next process a rebuild.
+		_ = writeIndexFile(IndexPath(busPath), h.idx)
+	}
+	return nil
+}
+
+// scanIndexEntries indexes the messages in [from, to) of f. Each message's
+// length extends to the next one, or to 'to' for the last.
+func scanIndexEntries(f *os.File, from, to int64, add func(indexEntry)) error {
+	var pending *indexEntry
+	err := scanMessages(bufio.NewReader(io.NewSectionReader(f, from, to-from)), from, func(msg *Message, offset int64) error {
+		if strings.HasPrefix(msg.MsgID, "LEGACY-LINE-") {
+			return errIndexUnsupported
+		}
+		if pending != nil {
+			pending.length = offset - pending.offset
+			add(*pending)
+		}
+		pending = &indexEntry{offset: offset, msgID: msg.MsgID, msgType: msg.Type, runID: msg.RunID}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if pending != nil {
+		pending.length = to - pending.offset
+		add(*pending)
+	}
+	return nil
+}
+
+// verifyIndex reports whether idx describes the beginning of the bus in f:
+// the covered size fits, the first and last indexed messages are where the
+// index says, and the covered range ends on a message boundary. This also
+// detects a bus that was rotated or rewritten underneath the index.
+func verifyIndex(idx *busIndex, f *os.File, size int64) bool {
+	covered := idx.covered()
+	if covered > size {
+		return false
+	}
+	if len(idx.entries) == 0 {
+		return true
+	}
+	if !verifyIndexEntry(f, idx.entries[0]) || !verifyIndexEntry(f, idx.entries[len(idx.entries)-1]) {
+		return false
+	}
+	if covered < size {
+		// Writers separate messages with a blank line.
+		var next [1]byte
+		if _, err := f.ReadAt(next[:], covered); err != nil || next[0] != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+func verifyIndexEntry(f *os.File, entry indexEntry) bool {
+	buf := make([]byte, indexVerifyWindow)
+	n, err := f.ReadAt(buf, entry.offset)
+	if err != nil && err != io.EOF {
+		return false
+	}
+	buf = buf[:n]
+	if !bytes.HasPrefix(buf, []byte("---\n")) && !bytes.HasPrefix(buf, []byte("---\r\n")) {
+		return false
+	}
+	return bytes.Contains(buf, []byte(entry.msgID))
+}
+
+func formatIndexLine(entry indexEntry) string {
+	clean := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, s)
+	}
+	return fmt.Sprintf("%d\t%d\t%s\t%s\t%s\n", entry.offset, entry.length, clean(entry.msgID), clean(entry.msgType), clean(entry.runID))
+}
+
+func parseIndexLine(line string) (indexEntry, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != 5 {
+		return indexEntry{}, errors.Errorf("malformed index line %q", line)
+	}
+	offset, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || offset < 0 {
+		return indexEntry{}, errors.Errorf("malformed index offset %q", fields[0])
+	}
+	length, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || length <= 0 {
+		return indexEntry{}, errors.Errorf("malformed index length %q", fields[1])
+	}
+	if fields[2] == "" {
+		return indexEntry{}, errors.Errorf("index line %q has no msg_id", line)
+	}
+	return indexEntry{offset: offset, length: length, msgID: fields[2], msgType: fields[3], runID: fields[4]}, nil
+}
+
+// readIndexFile loads an index file. Any malformed or truncated line makes
+// the whole file invalid.
+func readIndexFile(path string) (*busIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+	if !strings.HasSuffix(text, "\n") {
+		return nil, errors.New("index file is truncated")
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if lines[0] != indexHeader {
+		return nil, errors.New("unknown index file format")
+	}
+	idx := newBusIndex()
+	for _, line := range lines[1:] {
+		entry, err := parseIndexLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(idx.entries); n > 0 && entry.offset < idx.entries[n-1].offset+idx.entries[n-1].length {
+			return nil, errors.New("index entries overlap")
+		}
+		idx.add(entry)
+	}
+	return idx, nil
+}
+
+// writeIndexFile replaces the index file atomically.
+func writeIndexFile(path string, idx *busIndex) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return errors.Wrap(err, "create index file")
+	}
+	tmpPath := tmp.Name()
+	w := bufio.NewWriter(tmp)
+	_, err = w.WriteString(indexHeader + "\n")
+	for i := 0; err == nil && i < len(idx.entries); i++ {
+		_, err = w.WriteString(formatIndexLine(idx.entries[i]))
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, messageBusFileMode)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrap(err, "write index file")
+	}
+	return nil
+}
+
+// updateIndexAfterAppend records a message the caller just appended at
+// offset (with end the new bus size) in an existing index file. It must be
+// called under the bus append lock. An index that does not end exactly at
+// the previous bus size is removed so that the next reader rebuilds it;
+// errors never fail the append.
+func updateIndexAfterAppend(busPath string, previousSize int64, entry indexEntry) {
+	path := IndexPath(busPath)
+	if previousSize == 0 {
+		// New or rotated bus: any index describes a different file.
+		_ = os.Remove(path)
+		return
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		return
+	}
+	covered, err := indexFileCovered(file)
+	if err == nil && covered == previousSize {
+		_, err = file.WriteString(formatIndexLine(entry))
+	} else if err == nil {
+		err = errors.New("index is stale")
+	}
+	file.Close()
+	if err != nil {
+		_ = os.Remove(path)
+	}
+}
+
+// indexFileCovered reads the last line of an index file and returns the bus
+// size it covers.
+func indexFileCovered(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	window := int64(4096)
+	if info.Size() < window {
+		window = info.Size()
+	}
+	buf := make([]byte, window)
+	if _, err := file.ReadAt(buf, info.Size()-window); err != nil && err != io.EOF {
+		return 0, err
+	}
+	text := string(buf)
+	if !strings.HasSuffix(text, "\n") {
+		return 0, errors.New("index file is truncated")
+	}
+	text = strings.TrimSuffix(text, "\n")
+	last := text[strings.LastIndex(text, "\n")+1:]
+	if last == indexHeader {
+		return 0, nil
+	}
+	entry, err := parseIndexLine(last)
+	if err != nil {
+		return 0, err
+	}
+	return entry.offset + entry.length, nil
+}
+
+// readSpans reads and parses the given message ranges of the bus. ok is
+// false when a range no longer holds the indexed message, in which case the
+// caller falls back to a scan.
+func (mb *MessageBus) readSpans(spans []span) ([]*Message, bool) {
+	f, err := os.Open(mb.path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	messages := make([]*Message, 0, len(spans))
+	for _, s := range spans {
+		var reader io.Reader
+		if s.end < 0 {
+			reader = io.NewSectionReader(f, s.start, 1<<62)
+		} else {
+			reader = io.NewSectionReader(f, s.start, s.end-s.start)
+		}
+		var found *Message
+		if err := parseMessagesReader(bufio.NewReader(reader), func(msg *Message) {
+			if found == nil {
+				found = msg
+			}
+		}); err != nil || found == nil || found.MsgID != s.msgID {
+			return nil, false
+		}
+		messages = append(messages, found)
+	}
+	return messages, true
+}
+
+// readFrom parses all messages from offset to the end of the bus.
+func (mb *MessageBus) readFrom(offset int64) ([]*Message, bool) {
+	f, err := os.Open(mb.path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	messages := make([]*Message, 0)
+	if err := parseMessagesReader(bufio.NewReader(io.NewSectionReader(f, offset, 1<<62)), func(msg *Message) {
+		messages = append(messages, msg)
+	}); err != nil {
+		return nil, false
+	}
+	return messages, true
+}
+
+// indexedSince reads messages after sinceID, keeping the last limit when
+// limit > 0. ok is false when the index cannot answer.
+func (mb *MessageBus) indexedSince(sinceID string, limit int) ([]*Message, bool) {
+	var offset int64
+	var expected int
+	found := false
+	if !mb.withIndex(func(idx *busIndex) {
+		pos, ok := idx.byID[sinceID]
+		if !ok {
+			return
+		}
+		found = true
+		from := pos + 1
+		if limit > 0 && len(idx.entries)-limit > from {
+			from = len(idx.entries) - limit
+		}
+		offset = idx.start(from)
+		expected = len(idx.entries) - from
+	}) || !found {
+		return nil, false
+	}
+	messages, ok := mb.readFrom(offset)
+	if !ok || len(messages) < expected {
+		return nil, false
+	}
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages, true
+}
+
+// indexedLastN reads the last n messages.
+func (mb *MessageBus) indexedLastN(n int) ([]*Message, bool) {
+	var offset int64
+	var expected int
+	if !mb.withIndex(func(idx *busIndex) {
+		from := len(idx.entries) - n
+		if from < 0 {
+			from = 0
+		}
+		offset = idx.start(from)
+		expected = len(idx.entries) - from
+	}) {
+		return nil, false
+	}
+	messages, ok := mb.readFrom(offset)
+	if !ok || len(messages) < expected {
+		return nil, false
+	}
+	if len(messages) > n {
+		messages = messages[len(messages)-n:]
+	}
+	return messages, true
+}
+
+// indexedPostings reads the messages at the positions chosen by pick,
+// keeping the last limit when limit > 0.
+func (mb *MessageBus) indexedPostings(limit int, pick func(idx *busIndex) []int) ([]*Message, bool) {
+	var spans []span
+	if !mb.withIndex(func(idx *busIndex) {
+		positions := pick(idx)
+		if limit > 0 && len(positions) > limit {
+			positions = positions[len(positions)-limit:]
+		}
+		spans = make([]span, 0, len(positions))
+		for _, pos := range positions {
+			spans = append(spans, idx.span(pos))
+		}
+	}) {
+		return nil, false
+	}
+	return mb.readSpans(spans)
+}
+
+// ReadMessagesByType returns messages whose type matches one of types
+// (case-insensitive), oldest first, keeping the latest limit entries when
+// limit > 0. Large buses answer from the sidecar index without a full scan.
+func (mb *MessageBus) ReadMessagesByType(limit int, types ...string) ([]*Message, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	if err := validateBusPath(mb.path); err != nil {
+		return nil, errors.Wrap(err, "validate message bus path")
+	}
+	wanted := make(map[string]bool, len(types))
+	for _, t := range types {
+		wanted[strings.ToUpper(strings.TrimSpace(t))] = true
+	}
+	if messages, ok := mb.indexedPostings(limit, func(idx *busIndex) []int {
+		var positions []int
+		for t := range wanted {
+			positions = mergePositions(positions, idx.byType[t])
+		}
+		return positions
+	}); ok {
+		return messages, nil
+	}
+	return mb.scanFiltered(limit, func(msg *Message) bool {
+		return wanted[strings.ToUpper(strings.TrimSpace(msg.Type))]
+	})
+}
+
+// ReadMessagesByRunID returns messages with the given run_id, oldest first,
+// keeping the latest limit entries when limit > 0.
+func (mb *MessageBus) ReadMessagesByRunID(runID string, limit int) ([]*Message, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	if err := validateBusPath(mb.path); err != nil {
+		return nil, errors.Wrap(err, "validate message bus path")
+	}
+	if messages, ok := mb.indexedPostings(limit, func(idx *busIndex) []int {
+		return idx.byRun[runID]
+	}); ok {
+		return messages, nil
+	}
+	return mb.scanFiltered(limit, func(msg *Message) bool {
+		return msg.RunID == runID
+	})
+}
+
+func (mb *MessageBus) scanFiltered(limit int, keep func(*Message) bool) ([]*Message, error) {
+	messages, err := mb.ReadMessages("")
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]*Message, 0)
+	for _, msg := range messages {
+		if msg != nil && keep(msg) {
+			filtered = append(filtered, msg)
+		}
+	}
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[len(filtered)-limit:]
+	}
+	return filtered, nil
+}
+
+// mergePositions merges two ascending position lists.
+func mergePositions(a, b []int) []int {
+	merged := make([]int, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] < b[j] {
+			merged = append(merged, a[i])
+			i++
+		} else {
+			merged = append(merged, b[j])
+			j++
+		}
+	}
+	merged = append(merged, a[i:]...)
+	return append(merged, b[j:]...)
+}
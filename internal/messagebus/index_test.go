@@ -0,0 +1,265 @@
+package messagebus
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withIndexThreshold makes every non-empty bus indexed for the test.
+func withIndexThreshold(t *testing.T, size int64) {
+	t.Helper()
+	old := indexMinBusSize
+	indexMinBusSize = size
+	t.Cleanup(func() { indexMinBusSize = old })
+}
+
+func appendIndexTestMessages(t *testing.T, bus Bus, from, to int) []string {
+	t.Helper()
+	ids := make([]string, 0, to-from)
+	for i := from; i < to; i++ {
+		msgType := "PROGRESS"
+		if i%3 == 0 {
+			msgType = "FACT"
+		}
+		id, err := bus.AppendMessage(&Message{
+			Type:      msgType,
+			ProjectID: "project",
+			TaskID:    "task",
+			RunID:     fmt.Sprintf("run-%d", i%2),
+			Body:      fmt.Sprintf("message %d\nsecond line", i),
+		})
+		if err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func messageIDs(messages []*Message) []string {
+	ids := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.MsgID)
+	}
+	return ids
+}
+
+func TestIndexedReadsMatchScan(t *testing.T) {
+	withIndexThreshold(t, 1)
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	scan, err := NewMessageBus(path, WithIndex(false))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	ids := appendIndexTestMessages(t, bus, 0, 30)
+
+	// The first read builds the index.
+	if _, err := bus.ReadMessages(ids[0]); err != nil {
+		t.Fatalf("ReadMessages: %v", err)
+	}
+	if _, err := os.Stat(IndexPath(path)); err != nil {
+		t.Fatalf("expected index file: %v", err)
+	}
+	// Writers keep the index current from now on.
+	ids = append(ids, appendIndexTestMessages(t, bus, 30, 40)...)
+	idx, err := readIndexFile(IndexPath(path))
+	if err != nil {
+		t.Fatalf("readIndexFile: %v", err)
+	}
+	if len(idx.entries) != len(ids) {
+		t.Fatalf("index has %d entries, want %d", len(idx.entries), len(ids))
+	}
+
+	for _, since := range []string{ids[0], ids[17], ids[38], ids[39]} {
+		got, err := bus.ReadMessages(since)
+		if err != nil {
+			t.Fatalf("ReadMessages(%s): %v", since, err)
+		}
+		want, _ := scan.ReadMessages(since)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("ReadMessages(%s) differs from scan:\n%v\n%v", since, messageIDs(got), messageIDs(want))
+		}
+		got, _ = bus.ReadMessagesSinceLimited(since, 5)
+		want, _ = scan.ReadMessagesSinceLimited(since, 5)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("ReadMessagesSinceLimited(%s) differs from scan", since)
+		}
+	}
+	for _, n := range []int{1, 7, 40, 100} {
+		got, _ := bus.indexedLastN(n)
+		want, _ := scan.readAllLastN(n)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("indexedLastN(%d) differs from scan", n)
+		}
+	}
+	facts, err := bus.ReadMessagesByType(0, "fact", "Missing")
+	if err != nil {
+		t.Fatalf("ReadMessagesByType: %v", err)
+	}
+	wantFacts, _ := scan.ReadMessagesByType(0, "FACT")
+	if len(facts) != 14 || !reflect.DeepEqual(facts, wantFacts) {
+		t.Fatalf("ReadMessagesByType = %v, want %v", messageIDs(facts), messageIDs(wantFacts))
+	}
+	lastFacts, _ := bus.ReadMessagesByType(2, "FACT")
+	if !reflect.DeepEqual(lastFacts, facts[len(facts)-2:]) {
+		t.Fatalf("limited ReadMessagesByType = %v", messageIDs(lastFacts))
+	}
+	run1, _ := bus.ReadMessagesByRunID("run-1", 0)
+	wantRun1, _ := scan.ReadMessagesByRunID("run-1", 0)
+	if len(run1) != 20 || !reflect.DeepEqual(run1, wantRun1) {
+		t.Fatalf("ReadMessagesByRunID = %d messages", len(run1))
+	}
+
+	if _, err := bus.ReadMessages("MSG-missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected since id not found, got %v", err)
+	}
+}
+
+func TestIndexRebuiltWhenStale(t *testing.T) {
+	withIndexThreshold(t, 1)
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	ids := appendIndexTestMessages(t, bus, 0, 10)
+	if _, err := bus.ReadMessages(ids[0]); err != nil {
+		t.Fatalf("ReadMessages: %v", err)
+	}
+
+	// A writer that does not maintain the index leaves it behind the bus;
+	// readers catch up and the next indexing writer drops the stale file.
+	plain, _ := NewMessageBus(path, WithIndex(false))
+	ids = append(ids, appendIndexTestMessages(t, plain, 10, 12)...)
+	got, ok := bus.indexedSince(ids[9], 0)
+	if !ok || !reflect.DeepEqual(messageIDs(got), ids[10:]) {
+		t.Fatalf("indexedSince after unindexed append = %v, %v", messageIDs(got), ok)
+	}
+	ids = append(ids, appendIndexTestMessages(t, bus, 12, 13)...)
+	if _, err := os.Stat(IndexPath(path)); !os.IsNotExist(err) {
+		t.Fatalf("expected stale index to be removed: %v", err)
+	}
+
+	// A corrupt index file is rebuilt from a fresh process' point of view.
+	forgetCachedIndex(path)
+	if err := os.WriteFile(IndexPath(path), []byte(indexHeader+"\n0\t5\tMSG-bogus\tFACT\t\n"), 0o644); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+	got, ok = bus.indexedSince(ids[11], 0)
+	if !ok || !reflect.DeepEqual(messageIDs(got), ids[12:]) {
+		t.Fatalf("indexedSince after corruption = %v, %v", messageIDs(got), ok)
+	}
+	idx, err := readIndexFile(IndexPath(path))
+	if err != nil || len(idx.entries) != len(ids) || idx.entries[0].msgID != ids[0] {
+		t.Fatalf("index not rebuilt: %+v, %v", idx, err)
+	}
+}
+
+func TestIndexAfterRotation(t *testing.T) {
+	withIndexThreshold(t, 1)
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	old := appendIndexTestMessages(t, bus, 0, 10)
+	if _, err := bus.ReadMessages(old[0]); err != nil {
+		t.Fatalf("ReadMessages: %v", err)
+	}
+	// Replace the bus behind the cached index, as gc rotation does.
+	if err := os.Rename(path, path+".archived"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	plain, _ := NewMessageBus(path, WithIndex(false))
+	fresh := appendIndexTestMessages(t, plain, 0, 20)
+
+	if _, err := bus.ReadMessages(old[3]); err == nil {
+		t.Fatalf("expected old id to be missing after rotation")
+	}
+	got, err := bus.ReadMessages(fresh[15])
+	if err != nil || !reflect.DeepEqual(messageIDs(got), fresh[16:]) {
+		t.Fatalf("ReadMessages after rotation = %v, %v", messageIDs(got), err)
+	}
+}
+
+func TestIndexSkipsLegacyBus(t *testing.T) {
+	withIndexThreshold(t, 1)
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	if err := os.WriteFile(path, []byte("[2026-01-01 10:00:00] FACT: legacy\n"), 0o644); err != nil {
+		t.Fatalf("write bus: %v", err)
+	}
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	appendIndexTestMessages(t, bus, 0, 3)
+	facts, err := bus.ReadMessagesByType(0, "FACT")
+	if err != nil || len(facts) != 2 || facts[0].MsgID != "LEGACY-LINE-000000001" {
+		t.Fatalf("ReadMessagesByType on legacy bus = %v, %v", messageIDs(facts), err)
+	}
+	if _, err := os.Stat(IndexPath(path)); !os.IsNotExist(err) {
+		t.Fatalf("legacy bus must not be indexed: %v", err)
+	}
+}
+
+func forgetCachedIndex(path string) {
+	indexCacheMu.Lock()
+	delete(indexCache, path)
+	indexCacheMu.Unlock()
+}
+
+func TestScanFromResumes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	ids := appendIndexTestMessages(t, bus, 0, 3)
+
+	var seen []string
+	var offsets []int64
+	collect := func(msg *Message, offset int64) error {
+		seen = append(seen, msg.MsgID)
+		offsets = append(offsets, offset)
+		return nil
+	}
+	end, err := bus.ScanFrom(0, collect)
+	if err != nil || !reflect.DeepEqual(seen, ids) {
+		t.Fatalf("ScanFrom(0) = %v, %v", seen, err)
+	}
+	for i, offset := range offsets {
+		msg, err := bus.ReadMessageAt(offset)
+		if err != nil || msg.MsgID != ids[i] {
+			t.Fatalf("ReadMessageAt(%d) = %v, %v", offset, msg, err)
+		}
+	}
+
+	// A message still being written is held back until it is complete.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := f.WriteString("---\nmsg_id: MSG-partial\ntype: FACT\n---\nhalf"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	seen = nil
+	next, err := bus.ScanFrom(end, collect)
+	if err != nil || len(seen) != 0 || next != end {
+		t.Fatalf("ScanFrom over partial message = %v, %d, %v", seen, next, err)
+	}
+	if _, err := f.WriteString(" done\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	f.Close()
+	if _, err := bus.ScanFrom(end, collect); err != nil || !reflect.DeepEqual(seen, []string{"MSG-partial"}) {
+		t.Fatalf("ScanFrom after completion = %v, %v", seen, err)
+	}
+}
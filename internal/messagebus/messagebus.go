@@ -33,6 +33,9 @@ const (
 	EventTypeRunCrash = "RUN_CRASH"
 )
 
+// EventTypeBudgetExceeded is posted when a task subtree crosses a budget cap.
+const EventTypeBudgetExceeded = "BUDGET_EXCEEDED"
+
 // ErrSinceIDNotFound indicates the requested since ID was not found.
 var ErrSinceIDNotFound = stderrors.New("since id not found")
 
@@ -59,6 +62,8 @@ type Message struct {
 	TaskID    string            `yaml:"task_id"`
 	RunID     string            `yaml:"run_id"`
 	IssueID   string            `yaml:"issue_id,omitempty"` // alias for msg_id on ISSUE messages
+	ToTask    string            `yaml:"to_task,omitempty"`  // directed message: recipient task
+	ToRun     string            `yaml:"to_run,omitempty"`   // directed message: recipient run of ToTask
 	Parents   []Parent          `yaml:"parents,omitempty"`  // replaces ParentMsgIDs
 	Links     []Link            `yaml:"links,omitempty"`
 	Meta      map[string]string `yaml:"meta,omitempty"`
@@ -74,6 +79,8 @@ type rawMessage struct {
 	TaskID    string            `yaml:"task_id"`
 	RunID     string            `yaml:"run_id"`
 	IssueID   string            `yaml:"issue_id,omitempty"`
+	ToTask    string            `yaml:"to_task,omitempty"`
+	ToRun     string            `yaml:"to_run,omitempty"`
 	Parents   yaml.Node         `yaml:"parents,omitempty"`
 	Links     []Link            `yaml:"links,omitempty"`
 	Meta      map[string]string `yaml:"meta,omitempty"`
@@ -110,14 +117,19 @@ func parseParents(node yaml.Node) []Parent {
 
 // MessageBus manages append-only message bus files.
 type MessageBus struct {
-	path            string
-	now             func() time.Time
-	lockTimeout     time.Duration
-	pollInterval    time.Duration
-	maxRetries      int
-	retryBackoff    time.Duration
-	fsync           bool
-	autoRotateBytes int64
+	path             string
+	now              func() time.Time
+	lockTimeout      time.Duration
+	pollInterval     time.Duration
+	maxRetries       int
+	retryBackoff     time.Duration
+	fsync            bool
+	autoRotateBytes  int64
+	autoCompact      CompactOptions
+	autoCompactBytes int64
+	index            bool
+	validation       *busValidation
+	policy           policyCache
 
 	attempts int64
 	retries  int64
@@ -185,6 +197,14 @@ func WithAutoRotate(maxBytes int64) Option {
 	}
 }
 
+// WithIndex enables or disables the sidecar offset index (<path>.idx) used
+// by since-ID, last-N and type-filtered reads of large buses. Default is true.
+func WithIndex(enabled bool) Option {
+	return func(bus *MessageBus) {
+		bus.index = enabled
+	}
+}
+
 // ContentionStats returns the total append attempts and lock contention retries.
 func (mb *MessageBus) ContentionStats() (attempts, retries int64) {
 	return atomic.LoadInt64(&mb.attempts), atomic.LoadInt64(&mb.retries)
@@ -203,6 +223,7 @@ func NewMessageBus(path string, opts ...Option) (*MessageBus, error) {
 		pollInterval: defaultPollInterval,
 		maxRetries:   defaultMaxRetries,
 		retryBackoff: defaultRetryBackoff,
+		index:        true,
 	}
 	for _, opt := range opts {
 		if opt != nil {
@@ -226,29 +247,12 @@ func (mb *MessageBus) AppendMessage(msg *Message) (string, error) {
 	if mb == nil {
 		return "", errors.New("message bus is nil")
 	}
-	if msg == nil {
-		return "", errors.New("message is nil")
-	}
-	if strings.TrimSpace(msg.Type) == "" {
-		return "", errors.New("message type is empty")
-	}
-	if strings.TrimSpace(msg.ProjectID) == "" {
-		return "", errors.New("project id is empty")
-	}
-
-	msg.MsgID = GenerateMessageID()
-	if msg.Timestamp.IsZero() {
-		msg.Timestamp = mb.now().UTC()
-	} else {
-		msg.Timestamp = msg.Timestamp.UTC()
-	}
-	if msg.Type == "ISSUE" && msg.IssueID == "" {
-		msg.IssueID = msg.MsgID
+	if err := mb.validate(msg); err != nil {
+		return "", err
 	}
-
-	data, err := serializeMessage(msg)
+	data, err := prepareMessage(msg, mb.now)
 	if err != nil {
-		return "", errors.Wrap(err, "serialize message")
+		return "", err
 	}
 
 	if err := validateBusPath(mb.path); err != nil {
@@ -265,7 +269,7 @@ func (mb *MessageBus) AppendMessage(msg *Message) (string, error) {
 			time.Sleep(backoff)
 		}
 
-		lastErr = mb.tryAppend(data)
+		lastErr = mb.tryAppend(data, indexEntry{msgID: msg.MsgID, msgType: msg.Type, runID: msg.RunID})
 		if lastErr == nil {
 			if attempt > 0 {
 				obslog.Log(log.Default(), "INFO", "messagebus", "append_recovered_after_retry",
@@ -319,20 +323,78 @@ func (mb *MessageBus) AppendMessage(msg *Message) (string, error) {
 	return "", fmt.Errorf("append failed after %d attempts: %w", mb.maxRetries, lastErr)
 }
 
-func (mb *MessageBus) tryAppend(data []byte) error {
-	file, err := os.OpenFile(mb.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, messageBusFileMode)
+// prepareMessage validates msg, assigns its msg_id and timestamp and returns
+// its serialized form.
+func prepareMessage(msg *Message, now func() time.Time) ([]byte, error) {
+	if msg == nil {
+		return nil, errors.New("message is nil")
+	}
+	if strings.TrimSpace(msg.Type) == "" {
+		return nil, errors.New("message type is empty")
+	}
+	if strings.TrimSpace(msg.ProjectID) == "" {
+		return nil, errors.New("project id is empty")
+	}
+
+	msg.MsgID = GenerateMessageID()
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = now().UTC()
+	} else {
+		msg.Timestamp = msg.Timestamp.UTC()
+	}
+	if msg.Type == "ISSUE" && msg.IssueID == "" {
+		msg.IssueID = msg.MsgID
+	}
+
+	data, err := serializeMessage(msg)
 	if err != nil {
-		return errors.Wrap(err, "open message bus")
+		return nil, errors.Wrap(err, "serialize message")
 	}
+	return data, nil
+}
 
-	if err := LockExclusive(file, mb.lockTimeout); err != nil {
-		file.Close()
+// openLocked opens the bus for appending and takes the exclusive lock on
+// the file currently at the bus path.
+func (mb *MessageBus) openLocked() (*os.File, error) {
+	file, err := openLockedFile(mb.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, mb.lockTimeout)
+	if err != nil {
 		obslog.Log(log.Default(), "WARN", "messagebus", "append_lock_failed",
 			obslog.F("path", mb.path),
 			obslog.F("lock_timeout", mb.lockTimeout),
 			obslog.F("error", err),
 		)
-		return fmt.Errorf("lock message bus: %w", err)
+		return nil, err
+	}
+	return file, nil
+}
+
+// openLockedFile opens path and locks it exclusively. A compaction,
+// rotation or cursor update may replace the file while we wait for the
+// lock, so the lock is retaken until it is held on the file at path.
+func openLockedFile(path string, flag int, timeout time.Duration) (*os.File, error) {
+	for attempt := 0; ; attempt++ {
+		file, err := os.OpenFile(path, flag, messageBusFileMode)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open %s", filepath.Base(path))
+		}
+		if err := LockExclusive(file, timeout); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("lock %s: %w", filepath.Base(path), err)
+		}
+		locked, statErr := file.Stat()
+		current, pathErr := os.Stat(path)
+		if attempt >= 3 || (statErr == nil && pathErr == nil && os.SameFile(locked, current)) {
+			return file, nil
+		}
+		_ = Unlock(file)
+		file.Close()
+	}
+}
+
+func (mb *MessageBus) tryAppend(data []byte, entry indexEntry) error {
+	file, err := mb.openLocked()
+	if err != nil {
+		return err
 	}
 
 	// Auto-rotation: if file exceeds threshold, rename to archive and create fresh file.
@@ -353,7 +415,7 @@ func (mb *MessageBus) tryAppend(data []byte) error {
 			)
 
 			// Open (or create) the fresh bus file.
-			file, err = os.OpenFile(mb.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, messageBusFileMode)
+			file, err = mb.openLocked()
 			if err != nil {
 				obslog.Log(log.Default(), "ERROR", "messagebus", "bus_open_after_rotation_failed",
 					obslog.F("path", mb.path),
@@ -361,14 +423,27 @@ func (mb *MessageBus) tryAppend(data []byte) error {
 				)
 				return errors.Wrap(err, "open new message bus after rotation")
 			}
-			if err := LockExclusive(file, mb.lockTimeout); err != nil {
-				file.Close()
-				obslog.Log(log.Default(), "ERROR", "messagebus", "bus_lock_after_rotation_failed",
+		}
+	}
+
+	// Auto-compaction: move old messages to the archive while holding the
+	// lock, then append to the rewritten bus file.
+	if mb.autoCompactBytes > 0 {
+		if fi, statErr := file.Stat(); statErr == nil && fi.Size() >= mb.autoCompactBytes {
+			_, compactErr := mb.compactLocked(mb.autoCompact, nil)
+			if compactErr != nil {
+				// Appending must not fail because compaction did.
+				obslog.Log(log.Default(), "WARN", "messagebus", "bus_compaction_failed",
 					obslog.F("path", mb.path),
-					obslog.F("lock_timeout", mb.lockTimeout),
-					obslog.F("error", err),
+					obslog.F("error", compactErr),
 				)
-				return fmt.Errorf("lock new message bus after rotation: %w", err)
+			} else {
+				_ = Unlock(file)
+				file.Close()
+				file, err = mb.openLocked()
+				if err != nil {
+					return errors.Wrap(err, "open message bus after compaction")
+				}
 			}
 		}
 	}
@@ -378,6 +453,10 @@ func (mb *MessageBus) tryAppend(data []byte) error {
 		_ = Unlock(file)
 	}()
 
+	var previousSize int64 = -1
+	if fi, statErr := file.Stat(); statErr == nil {
+		previousSize = fi.Size()
+	}
 	if err := appendEntry(file, data); err != nil {
 		return errors.Wrap(err, "write message")
 	}
@@ -386,6 +465,13 @@ func (mb *MessageBus) tryAppend(data []byte) error {
 			return errors.Wrap(err, "fsync message bus")
 		}
 	}
+	if mb.index && previousSize >= 0 {
+		if previousSize > 0 {
+			entry.offset = previousSize + 1
+		}
+		entry.length = int64(len(data))
+		updateIndexAfterAppend(mb.path, previousSize, entry)
+	}
 	return nil
 }
 
@@ -418,6 +504,11 @@ func (mb *MessageBus) ReadMessages(sinceID string) ([]*Message, error) {
 	if err := validateBusPath(mb.path); err != nil {
 		return nil, errors.Wrap(err, "validate message bus path")
 	}
+	if sinceID != "" {
+		if messages, ok := mb.indexedSince(sinceID, 0); ok {
+			return messages, nil
+		}
+	}
 	// On Windows, acquire a shared lock before reading to avoid reading while
 	// a writer holds an exclusive mandatory lock. On Unix, tryFlockShared is a
 	// no-op so this adds negligible overhead.
@@ -439,7 +530,15 @@ func (mb *MessageBus) ReadMessages(sinceID string) ([]*Message, error) {
 		// With partial results, can't reliably do sinceID filtering; return all.
 		return messages, nil
 	}
-	return filterSince(messages, sinceID)
+	filtered, err := filterSince(messages, sinceID)
+	if stderrors.Is(err, ErrSinceIDNotFound) {
+		if archived, ok, archiveErr := mb.readArchivedSince(sinceID); archiveErr != nil {
+			return nil, archiveErr
+		} else if ok {
+			return archived, nil
+		}
+	}
+	return filtered, err
 }
 
 // parseMessagesPartial parses as many messages as possible from data, skipping
@@ -455,7 +554,8 @@ func parseMessagesPartial(data []byte) []*Message {
 }
 
 // ReadMessagesSinceLimited reads messages after sinceID and keeps only the latest limit entries.
-// For limit <= 0 it behaves like ReadMessages(sinceID).
+// For limit <= 0 it behaves like ReadMessages(sinceID). When the bus has a sidecar
+// index, reading starts at the first kept message instead of scanning the file.
 func (mb *MessageBus) ReadMessagesSinceLimited(sinceID string, limit int) ([]*Message, error) {
 	if mb == nil {
 		return nil, errors.New("message bus is nil")
@@ -468,6 +568,11 @@ func (mb *MessageBus) ReadMessagesSinceLimited(sinceID string, limit int) ([]*Me
 	}
 
 	normalizedSinceID := strings.TrimSpace(sinceID)
+	if normalizedSinceID != "" {
+		if messages, ok := mb.indexedSince(normalizedSinceID, limit); ok {
+			return messages, nil
+		}
+	}
 	file, err := os.Open(mb.path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -507,6 +612,14 @@ func (mb *MessageBus) ReadMessagesSinceLimited(sinceID string, limit int) ([]*Me
 	}
 
 	if !foundSince {
+		if archived, ok, archiveErr := mb.readArchivedSince(normalizedSinceID); archiveErr != nil {
+			return nil, archiveErr
+		} else if ok {
+			if len(archived) > limit {
+				archived = archived[len(archived)-limit:]
+			}
+			return archived, nil
+		}
 		return nil, fmt.Errorf("since id %q not found: %w", normalizedSinceID, ErrSinceIDNotFound)
 	}
 	if len(tail) < limit || tailStart == 0 {
@@ -526,6 +639,7 @@ const readLastNChunkSize = 64 * 1024 // 64KB initial seek window
 // For small files (≤64KB), falls back to a full read then trims to n.
 // For large files, uses a seek-based approach: reads a chunk from near the end,
 // parsing messages. Doubles the window up to 3 times if needed, then falls back.
+// Buses large enough to carry a sidecar index seek straight to the n-th last message.
 func (mb *MessageBus) ReadLastN(n int) ([]*Message, error) {
 	if mb == nil {
 		return nil, errors.New("message bus is nil")
@@ -555,6 +669,9 @@ func (mb *MessageBus) ReadLastN(n int) ([]*Message, error) {
 		// Small file: full read then trim.
 		return mb.readAllLastN(n)
 	}
+	if messages, ok := mb.indexedLastN(n); ok {
+		return messages, nil
+	}
 
 	// Estimate bytes by message count, then grow exponentially when needed.
 	// This avoids eagerly reading the whole file for moderate tail sizes.
@@ -627,6 +744,107 @@ func (mb *MessageBus) PollForNew(lastID string) ([]*Message, error) {
 	}
 }
 
+// errStopScan stops a scan early without reporting an error.
+var errStopScan = stderrors.New("stop scan")
+
+// ScanFrom calls fn for each complete message that starts at or after the
+// byte offset, passing the offset of its opening "---" line. It returns the
+// offset up to which the bus was consumed; passing it to the next ScanFrom
+// call visits only messages appended since. A trailing message that is still
+// being written is left for the next call. Offsets must be message
+// boundaries previously returned by ScanFrom or passed to fn.
+func (mb *MessageBus) ScanFrom(offset int64, fn func(msg *Message, offset int64) error) (int64, error) {
+	if mb == nil {
+		return offset, errors.New("message bus is nil")
+	}
+	if fn == nil {
+		return offset, errors.New("scan callback is nil")
+	}
+	if err := validateBusPath(mb.path); err != nil {
+		return offset, errors.Wrap(err, "validate message bus path")
+	}
+	f, err := os.Open(mb.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return offset, nil
+		}
+		return offset, errors.Wrap(err, "open message bus")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return offset, errors.Wrap(err, "stat message bus")
+	}
+	size := info.Size()
+	if offset >= size {
+		return offset, nil
+	}
+	complete := false
+	var last [1]byte
+	if _, err := f.ReadAt(last[:], size-1); err == nil {
+		complete = last[0] == '\n'
+	}
+
+	// Hold back each message until the next one starts so that an
+	// incomplete trailing message is not reported.
+	var pending *Message
+	var pendingOffset int64
+	err = scanMessages(bufio.NewReader(io.NewSectionReader(f, offset, size-offset)), offset, func(msg *Message, at int64) error {
+		if pending != nil {
+			if err := fn(pending, pendingOffset); err != nil {
+				return err
+			}
+		}
+		pending, pendingOffset = msg, at
+		return nil
+	})
+	if err != nil {
+		return offset, err
+	}
+	if pending == nil {
+		if complete {
+			return size, nil
+		}
+		return offset, nil
+	}
+	if !complete {
+		return pendingOffset, nil
+	}
+	if err := fn(pending, pendingOffset); err != nil {
+		return offset, err
+	}
+	return size, nil
+}
+
+// ReadMessageAt returns the message whose opening "---" line is at offset.
+func (mb *MessageBus) ReadMessageAt(offset int64) (*Message, error) {
+	if mb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	if err := validateBusPath(mb.path); err != nil {
+		return nil, errors.Wrap(err, "validate message bus path")
+	}
+	f, err := os.Open(mb.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open message bus")
+	}
+	defer f.Close()
+	var found *Message
+	err = scanMessages(bufio.NewReader(io.NewSectionReader(f, offset, 1<<62)), offset, func(msg *Message, at int64) error {
+		if at == offset {
+			found = msg
+		}
+		return errStopScan
+	})
+	if err != nil && !stderrors.Is(err, errStopScan) {
+		return nil, err
+	}
+	if found == nil {
+		return nil, errors.Errorf("no message at offset %d", offset)
+	}
+	return found, nil
+}
+
 func appendEntry(file *os.File, data []byte) error {
 	if file == nil {
 		return errors.New("message bus file is nil")
@@ -698,6 +916,19 @@ func parseMessages(data []byte) ([]*Message, error) {
 }
 
 func parseMessagesReader(reader *bufio.Reader, onMessage func(*Message)) error {
+	if onMessage == nil {
+		return errors.New("message callback is nil")
+	}
+	return scanMessages(reader, 0, func(msg *Message, _ int64) error {
+		onMessage(msg)
+		return nil
+	})
+}
+
+// scanMessages parses messages from reader, reporting each with the byte
+// offset (base plus bytes consumed) of the "---" line that opens it, or of
+// its line for legacy entries. A callback error stops the scan.
+func scanMessages(reader *bufio.Reader, base int64, onMessage func(*Message, int64) error) error {
 	if reader == nil {
 		return errors.New("message reader is nil")
 	}
@@ -714,7 +945,9 @@ func parseMessagesReader(reader *bufio.Reader, onMessage func(*Message)) error {
 	var headerBuf bytes.Buffer
 	var bodyBuf bytes.Buffer
 	var current *Message
+	var currentStart int64
 	lineNo := 0
+	pos := base
 
 	for {
 		line, err := reader.ReadString('\n')
@@ -725,14 +958,19 @@ func parseMessagesReader(reader *bufio.Reader, onMessage func(*Message)) error {
 			break
 		}
 		lineNo++
+		lineStart := pos
+		pos += int64(len(line))
 		trimmed := strings.TrimRight(line, "\r\n")
 		switch state {
 		case stateSeekHeader:
 			if trimmed == "---" {
 				state = stateHeader
 				headerBuf.Reset()
+				currentStart = lineStart
 			} else if msg, ok := parseLegacyMessageLine(trimmed, lineNo); ok {
-				onMessage(msg)
+				if cbErr := onMessage(msg, lineStart); cbErr != nil {
+					return cbErr
+				}
 			}
 		case stateHeader:
 			if trimmed == "---" {
@@ -741,6 +979,7 @@ func parseMessagesReader(reader *bufio.Reader, onMessage func(*Message)) error {
 					headerBuf.Reset()
 					current = nil
 					state = stateHeader
+					currentStart = lineStart
 					break
 				}
 				msg := &Message{
@@ -751,6 +990,8 @@ func parseMessagesReader(reader *bufio.Reader, onMessage func(*Message)) error {
 					TaskID:    raw.TaskID,
 					RunID:     raw.RunID,
 					IssueID:   raw.IssueID,
+					ToTask:    raw.ToTask,
+					ToRun:     raw.ToRun,
 					Parents:   parseParents(raw.Parents),
 					Links:     raw.Links,
 					Meta:      raw.Meta,
@@ -765,10 +1006,13 @@ func parseMessagesReader(reader *bufio.Reader, onMessage func(*Message)) error {
 			if trimmed == "---" {
 				if current != nil {
 					current.Body = finalizeBody(bodyBuf.Bytes())
-					onMessage(current)
+					if cbErr := onMessage(current, currentStart); cbErr != nil {
+						return cbErr
+					}
 				}
 				headerBuf.Reset()
 				state = stateHeader
+				currentStart = lineStart
 			} else {
 				bodyBuf.WriteString(line)
 			}
@@ -782,7 +1026,7 @@ func parseMessagesReader(reader *bufio.Reader, onMessage func(*Message)) error {
 		bodyBytes := bodyBuf.Bytes()
 		if len(bodyBytes) > 0 && bodyBytes[len(bodyBytes)-1] == '\n' {
 			current.Body = finalizeBody(bodyBytes)
-			onMessage(current)
+			return onMessage(current, currentStart)
 		}
 	}
 	return nil
@@ -0,0 +1,116 @@
+package messagebus
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"time"
+)
+
+const (
+	// TypeQuestion marks a message an agent waits on until a human answers.
+	TypeQuestion = "QUESTION"
+	// TypeAnswer marks the reply to a QUESTION; it lists the question in Parents.
+	TypeAnswer = "ANSWER"
+	// ParentKindAnswers is the Parent.Kind linking an ANSWER to its QUESTION.
+	ParentKindAnswers = "answers"
+)
+
+// NewAnswer returns an ANSWER message threaded to question. The answer is
+// also addressed to the asking task and run, so it lands in their inbox.
+func NewAnswer(question *Message, body string) *Message {
+	return &Message{
+		Type:      TypeAnswer,
+		ProjectID: question.ProjectID,
+		TaskID:    question.TaskID,
+		ToTask:    question.TaskID,
+		ToRun:     question.RunID,
+		Parents:   []Parent{{MsgID: question.MsgID, Kind: ParentKindAnswers}},
+		Body:      body,
+	}
+}
+
+// IsAnswerTo reports whether m is an ANSWER listing questionID in Parents.
+func (m *Message) IsAnswerTo(questionID string) bool {
+	if m == nil || questionID == "" || !strings.EqualFold(m.Type, TypeAnswer) {
+		return false
+	}
+	for _, parent := range m.Parents {
+		if parent.MsgID == questionID {
+			return true
+		}
+	}
+	return false
+}
+
+// FindAnswer returns the first answer to questionID among messages, or nil.
+func FindAnswer(messages []*Message, questionID string) *Message {
+	for _, msg := range messages {
+		if msg.IsAnswerTo(questionID) {
+			return msg
+		}
+	}
+	return nil
+}
+
+// OpenQuestions returns the QUESTION messages that have no answer yet.
+func OpenQuestions(messages []*Message) []*Message {
+	answered := make(map[string]struct{})
+	for _, msg := range messages {
+		if !strings.EqualFold(msg.Type, TypeAnswer) {
+			continue
+		}
+		for _, parent := range msg.Parents {
+			answered[parent.MsgID] = struct{}{}
+		}
+	}
+	open := make([]*Message, 0)
+	for _, msg := range messages {
+		if !strings.EqualFold(msg.Type, TypeQuestion) {
+			continue
+		}
+		if _, ok := answered[msg.MsgID]; !ok {
+			open = append(open, msg)
+		}
+	}
+	return open
+}
+
+// WaitForAnswer blocks until an answer to questionID is on the bus or ctx is
+// done, polling at the bus poll interval. Answers written before the call are
+// found too.
+func (mb *MessageBus) WaitForAnswer(ctx context.Context, questionID string) (*Message, error) {
+	if mb == nil {
+		return nil, stderrors.New("message bus is nil")
+	}
+	return waitForAnswer(ctx, mb, questionID, mb.pollInterval)
+}
+
+// waitForAnswer implements WaitForAnswer for any backend.
+func waitForAnswer(ctx context.Context, b Bus, questionID string, pollInterval time.Duration) (*Message, error) {
+	var since string
+	for {
+		messages, err := b.ReadMessages(since)
+		if stderrors.Is(err, ErrSinceIDNotFound) {
+			// The bus was rotated or compacted; rescan what is left.
+			since = ""
+			messages, err = b.ReadMessages("")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if answer := FindAnswer(messages, questionID); answer != nil {
+			return answer, nil
+		}
+		if len(messages) > 0 {
+			since = messages[len(messages)-1].MsgID
+		}
+		timer := time.NewTimer(pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
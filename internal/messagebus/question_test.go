@@ -0,0 +1,63 @@
+package messagebus
+
+import (
+	"context"
+	stderrors "errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWaitForAnswer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := NewMessageBus(path, WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	question := &Message{Type: TypeQuestion, ProjectID: "project", TaskID: "task", RunID: "run-1", Body: "deploy to prod?"}
+	if _, err := bus.AppendMessage(question); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	other, _ := bus.AppendMessage(&Message{Type: TypeQuestion, ProjectID: "project", TaskID: "task", Body: "other"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := bus.WaitForAnswer(ctx, question.MsgID); !stderrors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForAnswer without answer: %v", err)
+	}
+
+	done := make(chan *Message, 1)
+	go func() {
+		answer, err := bus.WaitForAnswer(context.Background(), question.MsgID)
+		if err != nil {
+			t.Errorf("WaitForAnswer: %v", err)
+		}
+		done <- answer
+	}()
+	time.Sleep(30 * time.Millisecond)
+	answer := NewAnswer(question, "yes")
+	if answer.ToTask != "task" || answer.ToRun != "run-1" {
+		t.Fatalf("answer not addressed to the asker: %+v", answer)
+	}
+	if _, err := bus.AppendMessage(answer); err != nil {
+		t.Fatalf("AppendMessage answer: %v", err)
+	}
+	select {
+	case got := <-done:
+		if got == nil || got.MsgID != answer.MsgID || got.Body != "yes" {
+			t.Fatalf("answer = %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for answer")
+	}
+
+	// An answer already on the bus is returned immediately.
+	if got, err := bus.WaitForAnswer(context.Background(), question.MsgID); err != nil || got.MsgID != answer.MsgID {
+		t.Fatalf("WaitForAnswer after answer = %+v, %v", got, err)
+	}
+	all, _ := bus.ReadMessages("")
+	if got := OpenQuestions(all); !reflect.DeepEqual(messageIDs(got), []string{other}) {
+		t.Fatalf("OpenQuestions = %v", messageIDs(got))
+	}
+}
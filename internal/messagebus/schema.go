@@ -0,0 +1,413 @@
+package messagebus
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/pkg/errors"
+)
+
+// Schema validation modes, selected with message_bus.validation.
+const (
+	// ValidationOff appends every message with a type and project (default).
+	ValidationOff = "off"
+	// ValidationWarn appends invalid messages and logs the problems.
+	ValidationWarn = "warn"
+	// ValidationStrict rejects invalid messages with a *ValidationError.
+	ValidationStrict = "strict"
+)
+
+// ErrInvalidMessage is matched (errors.Is) by the *ValidationError that
+// AppendMessage returns for messages rejected in strict mode.
+var ErrInvalidMessage = stderrors.New("invalid message")
+
+// TypeSchema describes a message type and the structure its messages must
+// have.
+type TypeSchema struct {
+	Type        string `yaml:"type" json:"type"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Required lists fields that must be non-empty, named like filter
+	// expression fields: body, run, task, issue, to_task, to_run, parent
+	// (at least one parent) and meta.<key>.
+	Required []string `yaml:"required,omitempty" json:"required,omitempty"`
+	// BodyPattern is a regular expression (RE2) the body must match, e.g.
+	// "(?m)^Rationale:" to require a "Rationale:" line.
+	BodyPattern string `yaml:"body_pattern,omitempty" json:"body_pattern,omitempty"`
+	// Where is a filter expression the message must satisfy, e.g.
+	// "meta.status in (accepted, rejected)".
+	Where string `yaml:"where,omitempty" json:"where,omitempty"`
+}
+
+// builtinSchemas are the message types conductor-loop and its agents post.
+var builtinSchemas = []TypeSchema{
+	{Type: "FACT", Description: "A verified finding", Required: []string{"body"}},
+	{Type: "DECISION", Description: "A decision and its reasoning", Required: []string{"body"}},
+	{Type: "PROGRESS", Description: "A progress update", Required: []string{"body"}},
+	{Type: "ERROR", Description: "A failure", Required: []string{"body"}},
+	{Type: "WARNING", Description: "A non-fatal problem", Required: []string{"body"}},
+	{Type: "WARN", Description: "A non-fatal problem posted by the runner", Required: []string{"body"}},
+	{Type: "INFO", Description: "Informational note", Required: []string{"body"}},
+	{Type: "REVIEW", Description: "A review verdict", Required: []string{"body"}},
+	{Type: "QUESTION", Description: "A question for a human (bus ask)", Required: []string{"body"}},
+	{Type: "ANSWER", Description: "The answer to a QUESTION", Required: []string{"body", "parent"}},
+	{Type: "ISSUE", Description: "A tracked issue", Required: []string{"body"}},
+	{Type: "USER", Description: "A message from a human", Required: []string{"body"}},
+	{Type: "USER_REQUEST", Description: "A request from a human", Required: []string{"body"}},
+	{Type: EventTypeRunStart, Description: "A run started", Required: []string{"run"}},
+	{Type: EventTypeRunStop, Description: "A run stopped", Required: []string{"run"}},
+	{Type: EventTypeRunCrash, Description: "A run exited with a non-zero code", Required: []string{"run"}},
+	{Type: EventTypeRunRollup, Description: "Compacted run lifecycle events"},
+	{Type: EventTypeBudgetExceeded, Description: "A task exceeded its budget"},
+}
+
+// Registry is a set of known message types with their schemas.
+type Registry struct {
+	types map[string]*compiledSchema
+}
+
+type compiledSchema struct {
+	TypeSchema
+	bodyPattern *regexp.Regexp
+	where       *Filter
+}
+
+// DefaultRegistry returns the registry of built-in message types.
+func DefaultRegistry() *Registry {
+	reg, err := NewRegistry()
+	if err != nil {
+		panic(err) // the built-in schemas are valid
+	}
+	return reg
+}
+
+// NewRegistry returns the built-in message types plus extra ones; an extra
+// schema replaces the built-in schema of the same type.
+func NewRegistry(extra ...TypeSchema) (*Registry, error) {
+	reg := &Registry{types: make(map[string]*compiledSchema)}
+	for _, schemas := range [][]TypeSchema{builtinSchemas, extra} {
+		for _, schema := range schemas {
+			if err := reg.add(schema); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return reg, nil
+}
+
+func (r *Registry) add(schema TypeSchema) error {
+	name := strings.ToUpper(strings.TrimSpace(schema.Type))
+	if name == "" {
+		return errors.New("message type schema without a type")
+	}
+	schema.Type = name
+	compiled := &compiledSchema{TypeSchema: schema}
+	for _, field := range schema.Required {
+		if field == "parent" {
+			continue
+		}
+		canonical, err := canonicalFilterField(field)
+		if err != nil || canonical == "ts" || canonical == "msg_id" {
+			return errors.Errorf("message type %s: cannot require field %q", name, field)
+		}
+	}
+	if schema.BodyPattern != "" {
+		re, err := regexp.Compile(schema.BodyPattern)
+		if err != nil {
+			return errors.Wrapf(err, "message type %s: body_pattern", name)
+		}
+		compiled.bodyPattern = re
+	}
+	if schema.Where != "" {
+		f, err := ParseFilter(schema.Where)
+		if err != nil {
+			return errors.Wrapf(err, "message type %s: where", name)
+		}
+		compiled.where = f
+	}
+	r.types[name] = compiled
+	return nil
+}
+
+// Types returns the registered schemas sorted by type.
+func (r *Registry) Types() []TypeSchema {
+	schemas := make([]TypeSchema, 0, len(r.types))
+	for _, s := range r.types {
+		schemas = append(schemas, s.TypeSchema)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Type < schemas[j].Type })
+	return schemas
+}
+
+// Lookup returns the schema of msgType (case-insensitive).
+func (r *Registry) Lookup(msgType string) (TypeSchema, bool) {
+	s, ok := r.types[strings.ToUpper(strings.TrimSpace(msgType))]
+	if !ok {
+		return TypeSchema{}, false
+	}
+	return s.TypeSchema, true
+}
+
+// ValidationError lists the schema problems of a message.
+type ValidationError struct {
+	MsgID    string
+	Type     string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	subject := e.Type + " message"
+	if e.MsgID != "" {
+		subject += " " + e.MsgID
+	}
+	return "invalid " + subject + ": " + strings.Join(e.Problems, "; ")
+}
+
+// Is makes errors.Is(err, ErrInvalidMessage) true.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidMessage
+}
+
+// Validate checks msg against the schema of its type. It returns nil or a
+// *ValidationError; unknown types are a problem too.
+func (r *Registry) Validate(msg *Message) error {
+	if msg == nil {
+		return errors.New("message is nil")
+	}
+	schema, ok := r.types[strings.ToUpper(strings.TrimSpace(msg.Type))]
+	if !ok {
+		return &ValidationError{MsgID: msg.MsgID, Type: msg.Type, Problems: []string{
+			"unknown message type (known: " + strings.Join(r.typeNames(), ", ") + ")",
+		}}
+	}
+	var problems []string
+	for _, field := range schema.Required {
+		if field == "parent" {
+			if len(msg.Parents) == 0 {
+				problems = append(problems, "parents are required")
+			}
+			continue
+		}
+		canonical, _ := canonicalFilterField(field)
+		if strings.TrimSpace(messageField(msg, canonical)) == "" {
+			problems = append(problems, field+" is required")
+		}
+	}
+	if schema.bodyPattern != nil && !schema.bodyPattern.MatchString(msg.Body) {
+		problems = append(problems, "body does not match "+schema.BodyPattern)
+	}
+	if schema.where != nil && !schema.where.Match(msg) {
+		problems = append(problems, "message does not satisfy "+schema.Where)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{MsgID: msg.MsgID, Type: msg.Type, Problems: problems}
+}
+
+func (r *Registry) typeNames() []string {
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SchemaPolicy is the validation configuration of a bus, stored next to it
+// in <bus>.schema.json (see SchemaPolicyPath). Types extend or replace the
+// built-in registry.
+type SchemaPolicy struct {
+	Mode  string       `json:"mode"`
+	Types []TypeSchema `json:"types,omitempty"`
+}
+
+// NormalizeValidationMode validates mode and returns its canonical name;
+// an empty mode means ValidationOff.
+func NormalizeValidationMode(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return ValidationOff, nil
+	case ValidationOff, ValidationWarn, ValidationStrict:
+		return mode, nil
+	}
+	return "", errors.Errorf("unknown validation mode %q (want off, warn or strict)", mode)
+}
+
+// Registry returns the registry the policy validates against.
+func (p SchemaPolicy) Registry() (*Registry, error) {
+	return NewRegistry(p.Types...)
+}
+
+// SchemaPolicyPath returns the path of the schema policy of the bus at busPath.
+func SchemaPolicyPath(busPath string) string {
+	return filepath.Clean(busPath) + ".schema.json"
+}
+
+// WriteSchemaPolicy stores policy for the bus at busPath, so every writer
+// of the bus validates messages. A policy with mode off removes the file.
+func WriteSchemaPolicy(busPath string, policy SchemaPolicy) error {
+	mode, err := NormalizeValidationMode(policy.Mode)
+	if err != nil {
+		return err
+	}
+	path := SchemaPolicyPath(busPath)
+	if mode == ValidationOff {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "remove schema policy")
+		}
+		return nil
+	}
+	policy.Mode = mode
+	if _, err := policy.Registry(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "encode schema policy")
+	}
+	if existing, err := os.ReadFile(path); err == nil && string(existing) == string(data)+"\n" {
+		return nil
+	}
+	return replaceFileContents(path, append(data, '\n'))
+}
+
+// ReadSchemaPolicy returns the schema policy of the bus at busPath; ok is
+// false when the bus has none.
+func ReadSchemaPolicy(busPath string) (policy SchemaPolicy, ok bool, err error) {
+	data, err := os.ReadFile(SchemaPolicyPath(busPath))
+	if os.IsNotExist(err) {
+		return SchemaPolicy{}, false, nil
+	}
+	if err != nil {
+		return SchemaPolicy{}, false, errors.Wrap(err, "read schema policy")
+	}
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return SchemaPolicy{}, false, errors.Wrap(err, "decode schema policy")
+	}
+	if policy.Mode, err = NormalizeValidationMode(policy.Mode); err != nil {
+		return SchemaPolicy{}, false, err
+	}
+	return policy, true, nil
+}
+
+// WithValidation validates appended messages against reg in mode instead
+// of the policy stored next to the bus.
+func WithValidation(mode string, reg *Registry) Option {
+	return func(bus *MessageBus) {
+		bus.validation = &busValidation{mode: mode, registry: reg}
+	}
+}
+
+// busValidation is the validation a bus applies to appended messages.
+type busValidation struct {
+	mode     string
+	registry *Registry
+}
+
+// CheckMessage validates msg against the schema policy of the bus at
+// busPath. It returns the policy mode and the validation error, if any;
+// mode is ValidationOff when the bus has no policy. Writers use it to
+// report problems that warn mode only logs.
+func CheckMessage(busPath string, msg *Message) (string, error) {
+	v, err := loadBusValidation(busPath)
+	if err != nil || v == nil {
+		return ValidationOff, err
+	}
+	return v.mode, v.registry.Validate(msg)
+}
+
+func loadBusValidation(busPath string) (*busValidation, error) {
+	policy, ok, err := ReadSchemaPolicy(busPath)
+	if err != nil || !ok || policy.Mode == ValidationOff {
+		return nil, err
+	}
+	reg, err := policy.Registry()
+	if err != nil {
+		return nil, err
+	}
+	return &busValidation{mode: policy.Mode, registry: reg}, nil
+}
+
+// policyCache holds the validation compiled from the schema policy of a bus
+// until the policy file changes, so appends do not re-read and re-parse it.
+type policyCache struct {
+	mu      sync.Mutex
+	loaded  bool
+	modTime time.Time
+	size    int64
+	v       *busValidation
+}
+
+// load returns the validation of the bus at busPath, compiling the policy
+// again only when its modification time or size changed.
+func (c *policyCache) load(busPath string) (*busValidation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var (
+		modTime time.Time
+		size    int64 = -1
+	)
+	info, err := os.Stat(SchemaPolicyPath(busPath))
+	switch {
+	case err == nil:
+		modTime, size = info.ModTime(), info.Size()
+	case !os.IsNotExist(err):
+		return nil, errors.Wrap(err, "stat schema policy")
+	}
+	if c.loaded && c.size == size && c.modTime.Equal(modTime) {
+		return c.v, nil
+	}
+	v, err := loadBusValidation(busPath)
+	if err != nil {
+		return nil, err
+	}
+	c.loaded, c.modTime, c.size, c.v = true, modTime, size, v
+	return v, nil
+}
+
+// validate applies the bus validation to msg before it is appended: strict
+// mode returns the validation error, warn mode logs it.
+func (mb *MessageBus) validate(msg *Message) error {
+	v := mb.validation
+	if v == nil {
+		loaded, err := mb.policy.load(mb.path)
+		if err != nil {
+			// A broken policy must not stop the bus; report it.
+			obslog.Log(log.Default(), "WARN", "messagebus", "schema_policy_invalid",
+				obslog.F("path", mb.path),
+				obslog.F("error", err),
+			)
+			return nil
+		}
+		v = loaded
+	}
+	if v == nil || v.registry == nil || v.mode == ValidationOff || msg == nil || strings.TrimSpace(msg.Type) == "" {
+		return nil
+	}
+	err := v.registry.Validate(msg)
+	if err == nil {
+		return nil
+	}
+	if v.mode == ValidationStrict {
+		return err
+	}
+	obslog.Log(log.Default(), "WARN", "messagebus", "message_schema_violation",
+		obslog.F("path", mb.path),
+		obslog.F("message_type", msg.Type),
+		obslog.F("project_id", msg.ProjectID),
+		obslog.F("task_id", msg.TaskID),
+		obslog.F("run_id", msg.RunID),
+		obslog.F("error", err),
+	)
+	return nil
+}
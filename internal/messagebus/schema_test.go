@@ -0,0 +1,138 @@
+package messagebus
+
+import (
+	"bytes"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegistryValidate(t *testing.T) {
+	reg, err := NewRegistry(TypeSchema{
+		Type:        "decision",
+		Required:    []string{"body", "meta.decision_id"},
+		BodyPattern: `(?m)^Rationale:`,
+		Where:       "meta.status in (accepted, rejected)",
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	valid := &Message{Type: "Decision", ProjectID: "p", Body: "Use SQLite.\nRationale: no server", Meta: map[string]string{"decision_id": "D-1", "status": "accepted"}}
+	if err := reg.Validate(valid); err != nil {
+		t.Fatalf("Validate(valid) = %v", err)
+	}
+
+	err = reg.Validate(&Message{Type: "DECISION", ProjectID: "p", Body: "Use SQLite.", Meta: map[string]string{"status": "maybe"}})
+	var verr *ValidationError
+	if !stderrors.As(err, &verr) || !stderrors.Is(err, ErrInvalidMessage) || len(verr.Problems) != 3 {
+		t.Fatalf("Validate(invalid) = %v", err)
+	}
+	if !strings.Contains(err.Error(), "meta.decision_id is required") {
+		t.Fatalf("error = %q", err)
+	}
+
+	if err := reg.Validate(&Message{Type: "DECISIONS", ProjectID: "p", Body: "x"}); err == nil || !strings.Contains(err.Error(), "unknown message type") {
+		t.Fatalf("unknown type error = %v", err)
+	}
+	if err := DefaultRegistry().Validate(&Message{Type: TypeAnswer, ProjectID: "p", Body: "yes"}); err == nil || !strings.Contains(err.Error(), "parents are required") {
+		t.Fatalf("ANSWER without parent: %v", err)
+	}
+	if _, err := NewRegistry(TypeSchema{Type: "X", Required: []string{"ts"}}); err == nil {
+		t.Fatal("expected error for required ts")
+	}
+}
+
+func TestSchemaPolicyModes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	invalid := func() *Message { return &Message{Type: "DECISIONS", ProjectID: "p", Body: "x"} }
+
+	if err := WriteSchemaPolicy(path, SchemaPolicy{Mode: ValidationStrict}); err != nil {
+		t.Fatalf("WriteSchemaPolicy: %v", err)
+	}
+	for _, backend := range []string{BackendFile, BackendSQLite} {
+		bus, err := Open(path, backend)
+		if err != nil {
+			t.Fatalf("Open(%s): %v", backend, err)
+		}
+		if _, err := bus.AppendMessage(invalid()); !stderrors.Is(err, ErrInvalidMessage) {
+			t.Fatalf("%s strict append err = %v", backend, err)
+		}
+		if _, err := bus.AppendMessage(&Message{Type: "FACT", ProjectID: "p", Body: "ok"}); err != nil {
+			t.Fatalf("%s valid append: %v", backend, err)
+		}
+		bus.Close()
+	}
+	if mode, err := CheckMessage(path, invalid()); mode != ValidationStrict || err == nil {
+		t.Fatalf("CheckMessage = %q, %v", mode, err)
+	}
+
+	if err := WriteSchemaPolicy(path, SchemaPolicy{Mode: ValidationWarn}); err != nil {
+		t.Fatalf("WriteSchemaPolicy: %v", err)
+	}
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	if _, err := bus.AppendMessage(invalid()); err != nil {
+		t.Fatalf("warn append: %v", err)
+	}
+
+	// An explicit option overrides the stored policy.
+	strict, _ := NewMessageBus(path, WithValidation(ValidationStrict, DefaultRegistry()))
+	if _, err := strict.AppendMessage(invalid()); err == nil {
+		t.Fatal("WithValidation(strict) accepted an invalid message")
+	}
+
+	if err := WriteSchemaPolicy(path, SchemaPolicy{Mode: ValidationOff}); err != nil {
+		t.Fatalf("WriteSchemaPolicy(off): %v", err)
+	}
+	if _, err := os.Stat(SchemaPolicyPath(path)); !os.IsNotExist(err) {
+		t.Fatalf("policy file left behind: %v", err)
+	}
+	if mode, err := CheckMessage(path, invalid()); mode != ValidationOff || err != nil {
+		t.Fatalf("CheckMessage without policy = %q, %v", mode, err)
+	}
+}
+
+func TestSchemaPolicyCachedUntilChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	invalid := func() *Message { return &Message{Type: "DECISIONS", ProjectID: "p", Body: "x"} }
+	if err := WriteSchemaPolicy(path, SchemaPolicy{Mode: ValidationStrict}); err != nil {
+		t.Fatalf("WriteSchemaPolicy: %v", err)
+	}
+	bus, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	if _, err := bus.AppendMessage(invalid()); !stderrors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("strict append err = %v", err)
+	}
+
+	// Same size and modification time: the compiled policy is reused, so
+	// the unparseable contents are never read.
+	policyPath := SchemaPolicyPath(path)
+	info, err := os.Stat(policyPath)
+	if err != nil {
+		t.Fatalf("stat policy: %v", err)
+	}
+	if err := os.WriteFile(policyPath, bytes.Repeat([]byte("x"), int(info.Size())), 0o644); err != nil {
+		t.Fatalf("overwrite policy: %v", err)
+	}
+	if err := os.Chtimes(policyPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if _, err := bus.AppendMessage(invalid()); !stderrors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("cached strict append err = %v", err)
+	}
+
+	// A changed policy is picked up by the open bus.
+	if err := WriteSchemaPolicy(path, SchemaPolicy{Mode: ValidationOff}); err != nil {
+		t.Fatalf("WriteSchemaPolicy(off): %v", err)
+	}
+	if _, err := bus.AppendMessage(invalid()); err != nil {
+		t.Fatalf("append after policy removal: %v", err)
+	}
+}
@@ -0,0 +1,1000 @@
+package messagebus
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/pkg/errors"
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// sqliteSchemaVersion 2 stores timestamps with a fixed width (see
+// sqliteTimeLayout) and adds the consumer cursors and the markdown export
+// state.
+const sqliteSchemaVersion = 2
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	seq        INTEGER PRIMARY KEY AUTOINCREMENT,
+	msg_id     TEXT NOT NULL UNIQUE,
+	ts         TEXT NOT NULL,
+	type       TEXT NOT NULL,
+	project_id TEXT NOT NULL,
+	task_id    TEXT NOT NULL DEFAULT '',
+	run_id     TEXT NOT NULL DEFAULT '',
+	issue_id   TEXT NOT NULL DEFAULT '',
+	to_task    TEXT NOT NULL DEFAULT '',
+	to_run     TEXT NOT NULL DEFAULT '',
+	parents    TEXT NOT NULL DEFAULT '',
+	links      TEXT NOT NULL DEFAULT '',
+	meta       TEXT NOT NULL DEFAULT '',
+	body       TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS messages_type ON messages(upper(type));
+CREATE INDEX IF NOT EXISTS messages_run_id ON messages(run_id);
+CREATE TABLE IF NOT EXISTS cursors (
+	consumer TEXT PRIMARY KEY,
+	msg_id   TEXT NOT NULL,
+	acked_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS markdown_export (
+	id   INTEGER PRIMARY KEY CHECK (id = 1),
+	seq  INTEGER NOT NULL,
+	size INTEGER NOT NULL
+);
+`
+
+const sqliteColumns = `msg_id, ts, type, project_id, task_id, run_id, issue_id, to_task, to_run, parents, links, meta, body`
+
+// sqliteTimeLayout stores timestamps in UTC with a fixed width, so that they
+// compare as text in SQL.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// SQLitePath returns the database of the SQLite backend for the bus file at
+// busPath.
+func SQLitePath(busPath string) string {
+	return filepath.Clean(strings.TrimSpace(busPath)) + ".db"
+}
+
+// SQLiteBus stores messages in an embedded SQLite database (<bus>.db) in WAL
+// mode. The database is the source of truth: writers are serialized by it
+// instead of the file lock, reads and filters are indexed queries, and
+// consumer cursors live in it too.
+//
+// The markdown bus file stays an export for agents. It is appended in the
+// background after writes, under the file lock, and flushed by Close; once
+// it caught up it lists the same messages in the same order. A file that
+// changed behind the export (a writer bypassing the database, a crash in
+// the middle of an export) is detected by its size: the messages it has
+// and the database lacks are imported, and the file is rewritten from the
+// database. Rotation does not apply to the export; compact the bus instead.
+type SQLiteBus struct {
+	db     *sql.DB
+	mirror *MessageBus
+
+	mu         sync.Mutex
+	closed     bool
+	exportNow  chan struct{}
+	exportDone chan struct{}
+}
+
+// NewSQLiteBus opens (creating if needed) the SQLite backend of the bus file
+// at path. Options apply as for NewMessageBus; the lock timeout is also the
+// database busy timeout. A new database imports the messages and consumer
+// cursors of the file.
+func NewSQLiteBus(path string, opts ...Option) (*SQLiteBus, error) {
+	sb, _, err := openSQLiteBus(path, opts...)
+	return sb, err
+}
+
+func openSQLiteBus(path string, opts ...Option) (*SQLiteBus, int, error) {
+	mirror, err := NewMessageBus(path, opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := validateBusPath(mirror.path); err != nil {
+		return nil, 0, errors.Wrap(err, "validate message bus path")
+	}
+	synchronous := "NORMAL"
+	if mirror.fsync {
+		synchronous = "FULL"
+	}
+	dsn := fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(%s)&_txlock=immediate",
+		SQLitePath(mirror.path), mirror.lockTimeout.Milliseconds(), synchronous)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "open message bus database")
+	}
+	// One connection per process: writers queue in database/sql, and other
+	// processes wait on the busy timeout.
+	db.SetMaxOpenConns(1)
+	sb := &SQLiteBus{db: db, mirror: mirror}
+	imported, err := sb.initSchema()
+	if err != nil {
+		db.Close()
+		return nil, 0, err
+	}
+	sb.exportNow = make(chan struct{}, 1)
+	sb.exportDone = make(chan struct{})
+	go sb.exportLoop()
+	return sb, imported, nil
+}
+
+// initSchema creates or upgrades the database and returns the number of
+// messages imported from the markdown file.
+func (sb *SQLiteBus) initSchema() (int, error) {
+	var version int
+	if err := sb.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, errors.Wrap(err, "read message bus database version")
+	}
+	if version == sqliteSchemaVersion {
+		return 0, nil
+	}
+	if version > sqliteSchemaVersion {
+		return 0, errors.Errorf("message bus database version %d is newer than supported version %d", version, sqliteSchemaVersion)
+	}
+	// Creating or upgrading the database snapshots the markdown file, so
+	// hold its lock. Like the export, take the file lock before the database.
+	file, err := sb.mirror.openLocked()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = Unlock(file)
+		file.Close()
+	}()
+	tx, err := sb.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "begin message bus transaction")
+	}
+	defer tx.Rollback() //nolint:errcheck
+	// Another process may have finished while we waited for the locks.
+	if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, errors.Wrap(err, "read message bus database version")
+	}
+	if version == sqliteSchemaVersion {
+		return 0, nil
+	}
+	if _, err := tx.Exec(sqliteSchema); err != nil {
+		return 0, errors.Wrap(err, "create message bus schema")
+	}
+	if version == 1 {
+		if err := normalizeTimestamps(tx); err != nil {
+			return 0, err
+		}
+	}
+	imported, err := sb.importFileTx(tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := importCursorFile(tx, CursorsPath(sb.mirror.path)); err != nil {
+		return 0, err
+	}
+	// The file now holds every message of the database.
+	info, err := file.Stat()
+	if err != nil {
+		return 0, errors.Wrap(err, "stat message bus")
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO markdown_export (id, seq, size) VALUES (1, (SELECT coalesce(max(seq), 0) FROM messages), ?)`, info.Size()); err != nil {
+		return 0, errors.Wrap(err, "record markdown export")
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, sqliteSchemaVersion)); err != nil {
+		return 0, errors.Wrap(err, "set message bus database version")
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "commit message bus schema")
+	}
+	if imported > 0 {
+		obslog.Log(log.Default(), "INFO", "messagebus", "bus_file_imported",
+			obslog.F("path", sb.mirror.path),
+			obslog.F("messages", imported),
+		)
+	}
+	return imported, nil
+}
+
+// normalizeTimestamps rewrites the RFC3339 timestamps of a version 1
+// database in sqliteTimeLayout.
+func normalizeTimestamps(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT seq, ts FROM messages`)
+	if err != nil {
+		return errors.Wrap(err, "read message timestamps")
+	}
+	updates := make(map[int64]string)
+	for rows.Next() {
+		var (
+			seq int64
+			ts  string
+		)
+		if err := rows.Scan(&seq, &ts); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "scan message timestamp")
+		}
+		if parsed, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			updates[seq] = formatSQLiteTime(parsed)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "read message timestamps")
+	}
+	for seq, ts := range updates {
+		if _, err := tx.Exec(`UPDATE messages SET ts = ? WHERE seq = ?`, ts, seq); err != nil {
+			return errors.Wrap(err, "update message timestamp")
+		}
+	}
+	return nil
+}
+
+// importCursorFile copies the consumer cursors of the file backend.
+func importCursorFile(tx *sql.Tx, path string) error {
+	state, err := readCursorFile(path)
+	if err != nil {
+		return err
+	}
+	for _, cursor := range state.Consumers {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO cursors (consumer, msg_id, acked_at) VALUES (?, ?, ?)`,
+			cursor.Consumer, cursor.MsgID, formatSQLiteTime(cursor.AckedAt)); err != nil {
+			return errors.Wrapf(err, "import cursor %s", cursor.Consumer)
+		}
+	}
+	return nil
+}
+
+// MigrateToSQLite creates the SQLite backend of the bus file at path and
+// imports the messages and consumer cursors of the file into it. It returns
+// the number of messages imported; a bus that already has a database is
+// left as it is. Archives left by rotation are not imported; compaction
+// archives stay readable through their manifest.
+func MigrateToSQLite(path string, opts ...Option) (int, error) {
+	sb, imported, err := openSQLiteBus(path, opts...)
+	if err != nil {
+		return 0, err
+	}
+	return imported, sb.Close()
+}
+
+// Close flushes the markdown export and closes the database.
+func (sb *SQLiteBus) Close() error {
+	if sb == nil || sb.db == nil {
+		return nil
+	}
+	sb.mu.Lock()
+	if sb.closed {
+		sb.mu.Unlock()
+		return nil
+	}
+	sb.closed = true
+	close(sb.exportNow)
+	sb.mu.Unlock()
+	<-sb.exportDone
+
+	exportErr := sb.exportMarkdown()
+	if err := sb.db.Close(); err != nil {
+		return errors.Wrap(err, "close message bus database")
+	}
+	return exportErr
+}
+
+// AppendMessage stores msg and returns its msg_id. The markdown export is
+// appended in the background.
+func (sb *SQLiteBus) AppendMessage(msg *Message) (string, error) {
+	if sb == nil {
+		return "", errors.New("message bus is nil")
+	}
+	if err := sb.mirror.validate(msg); err != nil {
+		return "", err
+	}
+	if _, err := prepareMessage(msg, sb.mirror.now); err != nil {
+		return "", err
+	}
+	if _, err := sb.db.Exec(`INSERT INTO messages (`+sqliteColumns+`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`, messageRow(msg)...); err != nil {
+		obslog.Log(log.Default(), "ERROR", "messagebus", "append_failed",
+			obslog.F("path", sb.mirror.path),
+			obslog.F("backend", BackendSQLite),
+			obslog.F("message_id", msg.MsgID),
+			obslog.F("message_type", msg.Type),
+			obslog.F("project_id", msg.ProjectID),
+			obslog.F("error", err),
+		)
+		return "", errors.Wrap(err, "insert message")
+	}
+	sb.requestExport()
+	return msg.MsgID, nil
+}
+
+// ReadMessages reads messages after sinceID. If sinceID is empty, returns
+// all messages. A sinceID moved to the archive by compaction continues
+// through the archive (see Compact).
+func (sb *SQLiteBus) ReadMessages(sinceID string) ([]*Message, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	sinceID = strings.TrimSpace(sinceID)
+	if sinceID == "" {
+		return sb.query(`ORDER BY seq`)
+	}
+	seq, err := sb.seqOf(sinceID)
+	if stderrors.Is(err, ErrSinceIDNotFound) {
+		archived, ok, archiveErr := readArchivedSince(sb.mirror.path, sinceID, func() ([]*Message, error) {
+			return sb.query(`ORDER BY seq`)
+		})
+		if archiveErr != nil {
+			return nil, archiveErr
+		}
+		if ok {
+			return archived, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sb.query(`WHERE seq > ? ORDER BY seq`, seq)
+}
+
+// ReadMessagesSinceLimited reads messages after sinceID and keeps only the
+// latest limit entries. For limit <= 0 it behaves like ReadMessages(sinceID).
+func (sb *SQLiteBus) ReadMessagesSinceLimited(sinceID string, limit int) ([]*Message, error) {
+	if limit <= 0 {
+		return sb.ReadMessages(sinceID)
+	}
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	var seq int64
+	if strings.TrimSpace(sinceID) != "" {
+		var err error
+		seq, err = sb.seqOf(sinceID)
+		if stderrors.Is(err, ErrSinceIDNotFound) {
+			messages, err := sb.ReadMessages(sinceID)
+			if err != nil {
+				return nil, err
+			}
+			if len(messages) > limit {
+				messages = messages[len(messages)-limit:]
+			}
+			return messages, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sb.queryLatest(`WHERE seq > ?`, limit, seq)
+}
+
+// ReadLastN returns the last n messages. For n <= 0, returns all messages.
+func (sb *SQLiteBus) ReadLastN(n int) ([]*Message, error) {
+	if n <= 0 {
+		return sb.ReadMessages("")
+	}
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	return sb.queryLatest(``, n)
+}
+
+// ReadMessagesByType returns messages whose type matches one of types
+// (case-insensitive), oldest first, keeping the latest limit entries when
+// limit > 0.
+func (sb *SQLiteBus) ReadMessagesByType(limit int, types ...string) ([]*Message, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	if len(types) == 0 {
+		return []*Message{}, nil
+	}
+	args := make([]interface{}, 0, len(types))
+	for _, t := range types {
+		args = append(args, strings.ToUpper(strings.TrimSpace(t)))
+	}
+	return sb.queryLatest(`WHERE upper(type) IN (`+sqlPlaceholders(len(args))+`)`, limit, args...)
+}
+
+// ReadMessagesByRunID returns messages with the given run_id, oldest first,
+// keeping the latest limit entries when limit > 0.
+func (sb *SQLiteBus) ReadMessagesByRunID(runID string, limit int) ([]*Message, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	return sb.queryLatest(`WHERE run_id = ?`, limit, runID)
+}
+
+// ReadMessagesWhere returns the messages matching f, oldest first, keeping
+// the latest limit entries when limit > 0. The filter runs as an SQL query;
+// the few comparisons SQL cannot express exactly are checked on the rows it
+// returns.
+func (sb *SQLiteBus) ReadMessagesWhere(f *Filter, limit int) ([]*Message, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	if f == nil {
+		return readMessagesWhere(sb, f, limit)
+	}
+	cond, args, exact := filterSQL(f.root)
+	where := ""
+	if cond != "" {
+		where = `WHERE ` + cond
+	}
+	if exact {
+		return sb.queryLatest(where, limit, args...)
+	}
+	messages, err := sb.query(where+` ORDER BY seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	messages = FilterMessages(messages, f)
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages, nil
+}
+
+// PollForNew blocks until new messages appear after lastID.
+func (sb *SQLiteBus) PollForNew(lastID string) ([]*Message, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	for {
+		messages, err := sb.ReadMessages(lastID)
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) > 0 {
+			return messages, nil
+		}
+		time.Sleep(sb.mirror.pollInterval)
+	}
+}
+
+// Cursors returns all consumer cursors of the bus, ordered by name.
+func (sb *SQLiteBus) Cursors() ([]Cursor, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	rows, err := sb.db.Query(`SELECT consumer, msg_id, acked_at FROM cursors ORDER BY consumer`)
+	if err != nil {
+		return nil, errors.Wrap(err, "read consumer cursors")
+	}
+	defer rows.Close()
+	out := make([]Cursor, 0)
+	for rows.Next() {
+		var (
+			cursor  Cursor
+			ackedAt string
+		)
+		if err := rows.Scan(&cursor.Consumer, &cursor.MsgID, &ackedAt); err != nil {
+			return nil, errors.Wrap(err, "scan consumer cursor")
+		}
+		cursor.AckedAt = parseSQLiteTime(ackedAt)
+		out = append(out, cursor)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "read consumer cursors")
+	}
+	return out, nil
+}
+
+// Cursor returns the cursor of consumer, or nil when it never acknowledged
+// a message.
+func (sb *SQLiteBus) Cursor(consumer string) (*Cursor, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	if err := ValidateConsumerName(consumer); err != nil {
+		return nil, err
+	}
+	cursor := &Cursor{Consumer: consumer}
+	var ackedAt string
+	err := sb.db.QueryRow(`SELECT msg_id, acked_at FROM cursors WHERE consumer = ?`, consumer).Scan(&cursor.MsgID, &ackedAt)
+	if stderrors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read consumer cursor")
+	}
+	cursor.AckedAt = parseSQLiteTime(ackedAt)
+	return cursor, nil
+}
+
+// ReadUnacked returns the messages after the cursor of consumer, oldest
+// first, at most limit of them when limit > 0. See MessageBus.ReadUnacked.
+func (sb *SQLiteBus) ReadUnacked(consumer string, limit int) ([]*Message, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	return readUnacked(sb, sb.mirror.path, consumer, limit)
+}
+
+// Ack moves the cursor of consumer forward to msgID and returns the
+// resulting cursor. See MessageBus.Ack.
+func (sb *SQLiteBus) Ack(consumer, msgID string) (*Cursor, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	if err := ValidateConsumerName(consumer); err != nil {
+		return nil, err
+	}
+	if msgID == "" {
+		return nil, errors.New("msg id is required")
+	}
+	if _, err := sb.ReadMessages(msgID); err != nil {
+		return nil, errors.Wrapf(err, "ack %s", msgID)
+	}
+	for {
+		current, err := sb.Cursor(consumer)
+		if err != nil {
+			return nil, err
+		}
+		if !ackMovesCursor(sb, current, msgID) {
+			return current, nil
+		}
+		next := &Cursor{Consumer: consumer, MsgID: msgID, AckedAt: sb.mirror.now().UTC()}
+		var res sql.Result
+		if current == nil {
+			res, err = sb.db.Exec(`INSERT INTO cursors (consumer, msg_id, acked_at) VALUES (?, ?, ?) ON CONFLICT (consumer) DO NOTHING`,
+				consumer, msgID, formatSQLiteTime(next.AckedAt))
+		} else {
+			res, err = sb.db.Exec(`UPDATE cursors SET msg_id = ?, acked_at = ? WHERE consumer = ? AND msg_id = ?`,
+				msgID, formatSQLiteTime(next.AckedAt), consumer, current.MsgID)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "update consumer cursor")
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return next, nil
+		}
+		// Another writer moved the cursor meanwhile; decide again.
+	}
+}
+
+// ResetCursor deletes the cursor of consumer so that it reads the bus from
+// the start again. It reports whether a cursor existed.
+func (sb *SQLiteBus) ResetCursor(consumer string) (bool, error) {
+	if sb == nil {
+		return false, errors.New("message bus is nil")
+	}
+	if err := ValidateConsumerName(consumer); err != nil {
+		return false, err
+	}
+	res, err := sb.db.Exec(`DELETE FROM cursors WHERE consumer = ?`, consumer)
+	if err != nil {
+		return false, errors.Wrap(err, "delete consumer cursor")
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ReadInbox returns the messages addressed to taskID and runID, oldest
+// first. See MessageBus.ReadInbox.
+func (sb *SQLiteBus) ReadInbox(taskID, runID string, unread bool) ([]*Message, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	var (
+		messages []*Message
+		err      error
+	)
+	if unread {
+		messages, err = sb.ReadUnacked(InboxConsumer, 0)
+	} else {
+		messages, err = sb.query(`WHERE to_task = ? ORDER BY seq`, taskID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return addressedTo(messages, taskID, runID), nil
+}
+
+// WaitForAnswer blocks until an answer to questionID is on the bus or ctx is
+// done, polling at the bus poll interval.
+func (sb *SQLiteBus) WaitForAnswer(ctx context.Context, questionID string) (*Message, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	return waitForAnswer(ctx, sb, questionID, sb.mirror.pollInterval)
+}
+
+// Compact moves old messages into dated archive segments and deletes them
+// from the database, then rewrites the markdown export with the rest. See
+// CompactOptions for how messages are selected.
+func (sb *SQLiteBus) Compact(opts CompactOptions) (CompactResult, error) {
+	if sb == nil {
+		return CompactResult{}, errors.New("message bus is nil")
+	}
+	file, err := sb.mirror.openLocked()
+	if err != nil {
+		return CompactResult{}, err
+	}
+	defer func() {
+		_ = Unlock(file)
+		file.Close()
+	}()
+	return sb.compactLocked(file, opts)
+}
+
+// compactLocked compacts the bus; the caller holds the lock of file, the
+// markdown export.
+func (sb *SQLiteBus) compactLocked(file *os.File, opts CompactOptions) (CompactResult, error) {
+	// Compaction cuts the export, so bring it up to date first.
+	if err := sb.exportLocked(file); err != nil {
+		return CompactResult{}, err
+	}
+	result, err := sb.mirror.compactLocked(opts, func(throughID string) error {
+		_, err := sb.db.Exec(`DELETE FROM messages WHERE seq <= (SELECT seq FROM messages WHERE msg_id = ?)`, throughID)
+		return errors.Wrap(err, "delete compacted messages")
+	})
+	if err != nil || opts.DryRun || result.Moved == 0 {
+		return result, err
+	}
+	if _, err := sb.db.Exec(`UPDATE markdown_export SET size = ? WHERE id = 1`, result.BytesAfter); err != nil {
+		return result, errors.Wrap(err, "record markdown export")
+	}
+	return result, nil
+}
+
+// ArchiveSegments lists the archive segments of the bus, oldest first.
+func (sb *SQLiteBus) ArchiveSegments() ([]ArchiveSegment, error) {
+	if sb == nil {
+		return nil, errors.New("message bus is nil")
+	}
+	return archiveSegments(sb.mirror.path)
+}
+
+func (sb *SQLiteBus) requestExport() {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.closed {
+		return
+	}
+	select {
+	case sb.exportNow <- struct{}{}:
+	default:
+	}
+}
+
+func (sb *SQLiteBus) exportLoop() {
+	defer close(sb.exportDone)
+	for range sb.exportNow {
+		if err := sb.exportMarkdown(); err != nil {
+			obslog.Log(log.Default(), "WARN", "messagebus", "markdown_export_failed",
+				obslog.F("path", sb.mirror.path),
+				obslog.F("error", err),
+			)
+		}
+	}
+}
+
+// exportState is the markdown export position: the last exported seq and
+// the file size after it, and the last seq in the database.
+type exportState struct {
+	seq, size, last int64
+}
+
+func (sb *SQLiteBus) readExportState() (exportState, error) {
+	var st exportState
+	err := sb.db.QueryRow(`SELECT seq, size, (SELECT coalesce(max(seq), 0) FROM messages) FROM markdown_export WHERE id = 1`).
+		Scan(&st.seq, &st.size, &st.last)
+	if err != nil {
+		return st, errors.Wrap(err, "read markdown export state")
+	}
+	return st, nil
+}
+
+// exportMarkdown brings the markdown export up to date with the database.
+func (sb *SQLiteBus) exportMarkdown() error {
+	st, err := sb.readExportState()
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(sb.mirror.path); err == nil && st.last == st.seq && info.Size() == st.size {
+		return nil
+	}
+	file, err := sb.mirror.openLocked()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = Unlock(file)
+		file.Close()
+	}()
+	if err := sb.exportLocked(file); err != nil {
+		return err
+	}
+	if sb.mirror.autoCompactBytes <= 0 {
+		return nil
+	}
+	if info, err := os.Stat(sb.mirror.path); err == nil && info.Size() >= sb.mirror.autoCompactBytes {
+		if _, err := sb.compactLocked(file, sb.mirror.autoCompact); err != nil {
+			obslog.Log(log.Default(), "WARN", "messagebus", "bus_compaction_failed",
+				obslog.F("path", sb.mirror.path),
+				obslog.F("error", err),
+			)
+		}
+	}
+	return nil
+}
+
+// exportLocked appends the messages not yet exported to the markdown file;
+// the caller holds its lock.
+func (sb *SQLiteBus) exportLocked(file *os.File) error {
+	st, err := sb.readExportState()
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "stat message bus")
+	}
+	if info.Size() != st.size {
+		return sb.rewriteExport()
+	}
+	if st.last == st.seq {
+		return nil
+	}
+	messages, err := sb.query(`WHERE seq > ? AND seq <= ? ORDER BY seq`, st.seq, st.last)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		data, err := serializeMessage(msg)
+		if err != nil {
+			return errors.Wrap(err, "serialize message")
+		}
+		if err := appendEntry(file, data); err != nil {
+			return errors.Wrap(err, "write markdown export")
+		}
+	}
+	if sb.mirror.fsync {
+		if err := file.Sync(); err != nil {
+			return errors.Wrap(err, "fsync message bus")
+		}
+	}
+	if info, err = file.Stat(); err != nil {
+		return errors.Wrap(err, "stat message bus")
+	}
+	// Readers of the database need no sidecar index.
+	_ = os.Remove(IndexPath(sb.mirror.path))
+	return sb.recordExport(st.last, info.Size())
+}
+
+// rewriteExport imports the messages of the markdown file missing from the
+// database, then rewrites the file from the database. The caller holds the
+// file lock.
+func (sb *SQLiteBus) rewriteExport() error {
+	if _, err := sb.importFile(); err != nil {
+		return err
+	}
+	st, err := sb.readExportState()
+	if err != nil {
+		return err
+	}
+	messages, err := sb.query(`WHERE seq <= ? ORDER BY seq`, st.last)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for i, msg := range messages {
+		data, err := serializeMessage(msg)
+		if err != nil {
+			return errors.Wrap(err, "serialize message")
+		}
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.Write(data)
+	}
+	if err := replaceFileContents(sb.mirror.path, buf.Bytes()); err != nil {
+		return err
+	}
+	_ = os.Remove(IndexPath(sb.mirror.path))
+	obslog.Log(log.Default(), "INFO", "messagebus", "markdown_export_rewritten",
+		obslog.F("path", sb.mirror.path),
+		obslog.F("messages", len(messages)),
+	)
+	return sb.recordExport(st.last, int64(buf.Len()))
+}
+
+func (sb *SQLiteBus) recordExport(seq, size int64) error {
+	if _, err := sb.db.Exec(`UPDATE markdown_export SET seq = ?, size = ? WHERE id = 1`, seq, size); err != nil {
+		return errors.Wrap(err, "record markdown export")
+	}
+	return nil
+}
+
+func (sb *SQLiteBus) importFile() (int, error) {
+	tx, err := sb.db.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "begin message bus transaction")
+	}
+	defer tx.Rollback() //nolint:errcheck
+	imported, err := sb.importFileTx(tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "commit imported messages")
+	}
+	if imported > 0 {
+		obslog.Log(log.Default(), "INFO", "messagebus", "bus_file_imported",
+			obslog.F("path", sb.mirror.path),
+			obslog.F("messages", imported),
+		)
+	}
+	return imported, nil
+}
+
+// importFileTx copies the file messages missing from the database into it.
+func (sb *SQLiteBus) importFileTx(tx *sql.Tx) (int, error) {
+	pending, err := sb.pendingFileMessages(tx)
+	if err != nil {
+		return 0, err
+	}
+	imported := 0
+	for _, msg := range pending {
+		res, err := tx.Exec(`INSERT OR IGNORE INTO messages (`+sqliteColumns+`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`, messageRow(msg)...)
+		if err != nil {
+			return 0, errors.Wrapf(err, "import message %s", msg.MsgID)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			imported++
+		}
+	}
+	return imported, nil
+}
+
+type sqlQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// pendingFileMessages returns the file messages after the last message in
+// the database, or all file messages when the file no longer holds it.
+func (sb *SQLiteBus) pendingFileMessages(q sqlQuerier) ([]*Message, error) {
+	var last string
+	err := q.QueryRow(`SELECT msg_id FROM messages ORDER BY seq DESC LIMIT 1`).Scan(&last)
+	if err != nil && !stderrors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Wrap(err, "read last message id")
+	}
+	messages, err := sb.mirror.ReadMessages(last)
+	if stderrors.Is(err, ErrSinceIDNotFound) {
+		messages, err = sb.mirror.ReadMessages("")
+		if err == nil {
+			messages, err = sb.missingMessages(q, messages)
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read markdown bus")
+	}
+	return messages, nil
+}
+
+func (sb *SQLiteBus) missingMessages(q sqlQuerier, messages []*Message) ([]*Message, error) {
+	missing := make([]*Message, 0)
+	for _, msg := range messages {
+		var seq int64
+		err := q.QueryRow(`SELECT seq FROM messages WHERE msg_id = ?`, msg.MsgID).Scan(&seq)
+		if stderrors.Is(err, sql.ErrNoRows) {
+			missing = append(missing, msg)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+func messageRow(msg *Message) []interface{} {
+	return []interface{}{
+		msg.MsgID,
+		formatSQLiteTime(msg.Timestamp),
+		msg.Type,
+		msg.ProjectID,
+		msg.TaskID,
+		msg.RunID,
+		msg.IssueID,
+		msg.ToTask,
+		msg.ToRun,
+		jsonColumn(msg.Parents, len(msg.Parents)),
+		jsonColumn(msg.Links, len(msg.Links)),
+		jsonColumn(msg.Meta, len(msg.Meta)),
+		msg.Body,
+	}
+}
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+func parseSQLiteTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return t
+}
+
+func jsonColumn(v interface{}, n int) string {
+	if n == 0 {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func (sb *SQLiteBus) seqOf(msgID string) (int64, error) {
+	var seq int64
+	err := sb.db.QueryRow(`SELECT seq FROM messages WHERE msg_id = ?`, strings.TrimSpace(msgID)).Scan(&seq)
+	if stderrors.Is(err, sql.ErrNoRows) {
+		return 0, ErrSinceIDNotFound
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "find since id")
+	}
+	return seq, nil
+}
+
+// queryLatest returns the latest limit rows matching where (all rows when
+// limit <= 0), oldest first.
+func (sb *SQLiteBus) queryLatest(where string, limit int, args ...interface{}) ([]*Message, error) {
+	if limit <= 0 {
+		return sb.query(where+` ORDER BY seq`, args...)
+	}
+	messages, err := sb.query(where+` ORDER BY seq DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (sb *SQLiteBus) query(clause string, args ...interface{}) ([]*Message, error) {
+	rows, err := sb.db.Query(`SELECT `+sqliteColumns+` FROM messages `+clause, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query messages")
+	}
+	defer rows.Close()
+	messages := make([]*Message, 0)
+	for rows.Next() {
+		var (
+			msg                  Message
+			ts                   string
+			parents, links, meta string
+		)
+		if err := rows.Scan(&msg.MsgID, &ts, &msg.Type, &msg.ProjectID, &msg.TaskID, &msg.RunID, &msg.IssueID,
+			&msg.ToTask, &msg.ToRun, &parents, &links, &meta, &msg.Body); err != nil {
+			return nil, errors.Wrap(err, "scan message")
+		}
+		msg.Timestamp = parseSQLiteTime(ts)
+		if parents != "" {
+			_ = json.Unmarshal([]byte(parents), &msg.Parents)
+		}
+		if links != "" {
+			_ = json.Unmarshal([]byte(links), &msg.Links)
+		}
+		if meta != "" {
+			_ = json.Unmarshal([]byte(meta), &msg.Meta)
+		}
+		messages = append(messages, &msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "read messages")
+	}
+	return messages, nil
+}
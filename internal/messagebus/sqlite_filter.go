@@ -0,0 +1,160 @@
+package messagebus
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// filterSQL translates a filter into a condition on the messages table.
+// exact reports whether the condition selects exactly the matching messages;
+// otherwise it selects a superset (an empty condition selects every message)
+// and the rows must be checked with Filter.Match.
+func filterSQL(node filterNode) (cond string, args []interface{}, exact bool) {
+	switch n := node.(type) {
+	case andNode:
+		left, leftArgs, leftExact := filterSQL(n.left)
+		right, rightArgs, rightExact := filterSQL(n.right)
+		exact := leftExact && rightExact
+		switch {
+		case left == "":
+			return right, rightArgs, exact
+		case right == "":
+			return left, leftArgs, exact
+		}
+		return "(" + left + " AND " + right + ")", append(leftArgs, rightArgs...), exact
+	case orNode:
+		left, leftArgs, leftExact := filterSQL(n.left)
+		right, rightArgs, rightExact := filterSQL(n.right)
+		if left == "" || right == "" {
+			return "", nil, false
+		}
+		return "(" + left + " OR " + right + ")", append(leftArgs, rightArgs...), leftExact && rightExact
+	case notNode:
+		inner, innerArgs, innerExact := filterSQL(n.inner)
+		if inner == "" || !innerExact {
+			return "", nil, false
+		}
+		return "NOT (" + inner + ")", innerArgs, true
+	case compareNode:
+		return compareSQL(n)
+	}
+	return "", nil, false
+}
+
+// compareSQL translates one comparison, mirroring compareNode.match.
+func compareSQL(n compareNode) (string, []interface{}, bool) {
+	if n.field == "ts" {
+		values := make([]interface{}, 0, len(n.times))
+		for _, t := range n.times {
+			values = append(values, formatSQLiteTime(t))
+		}
+		switch n.op {
+		case "=", "!=", "<", "<=", ">", ">=":
+			return "ts " + n.op + " ?", values, true
+		case "in", "not in":
+			return "ts " + strings.ToUpper(n.op) + " (" + sqlPlaceholders(len(values)) + ")", values, true
+		}
+		return "", nil, false
+	}
+	op, negated := n.op, false
+	switch n.op {
+	case "!=":
+		op, negated = "=", true
+	case "!~":
+		op, negated = "~", true
+	case "not in":
+		op, negated = "in", true
+	}
+
+	var cond string
+	var args []interface{}
+	switch {
+	case n.field == "parent":
+		match, matchArgs, ok := stringSQL(`coalesce(json_extract(value, '$.MsgID'), '')`, op, n.values, false)
+		if !ok {
+			return "", nil, false
+		}
+		cond = `EXISTS (SELECT 1 FROM json_each(CASE WHEN parents = '' THEN '[]' ELSE parents END) WHERE ` + match + `)`
+		args = matchArgs
+	case strings.HasPrefix(n.field, "meta."):
+		key := strings.TrimPrefix(n.field, "meta.")
+		if strings.ContainsAny(key, `"\`) {
+			return "", nil, false
+		}
+		match, matchArgs, ok := stringSQL(`coalesce(json_extract(CASE WHEN meta = '' THEN '{}' ELSE meta END, ?), '')`, op, n.values, false)
+		if !ok {
+			return "", nil, false
+		}
+		cond = match
+		args = append([]interface{}{`$."` + key + `"`}, matchArgs...)
+	default:
+		column, ok := filterColumns[n.field]
+		if !ok {
+			return "", nil, false
+		}
+		match, matchArgs, ok := stringSQL(column, op, n.values, n.field == "type")
+		if !ok {
+			return "", nil, false
+		}
+		cond = match
+		args = matchArgs
+	}
+	if negated {
+		cond = "NOT (" + cond + ")"
+	}
+	return cond, args, true
+}
+
+// filterColumns maps filter fields to the columns holding them.
+var filterColumns = map[string]string{
+	"msg_id":  "msg_id",
+	"type":    "type",
+	"project": "project_id",
+	"task":    "task_id",
+	"run":     "run_id",
+	"issue":   "issue_id",
+	"to_task": "to_task",
+	"to_run":  "to_run",
+	"body":    "body",
+}
+
+// stringSQL applies the positive operator op (=, ~ or in) to expr. With
+// foldCase, = and in ignore case, as type comparisons do. SQLite folds the
+// case of ASCII letters only, so other values are not translated.
+func stringSQL(expr, op string, values []string, foldCase bool) (string, []interface{}, bool) {
+	if op == "~" {
+		if !isASCII(values[0]) {
+			return "", nil, false
+		}
+		return "instr(lower(" + expr + "), ?) > 0", []interface{}{strings.ToLower(values[0])}, true
+	}
+	args := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		if foldCase {
+			if !isASCII(v) {
+				return "", nil, false
+			}
+			v = strings.ToUpper(v)
+		}
+		args = append(args, v)
+	}
+	if foldCase {
+		expr = "upper(" + expr + ")"
+	}
+	switch op {
+	case "=":
+		return expr + " = ?", args, true
+	case "in":
+		return expr + " IN (" + sqlPlaceholders(len(args)) + ")", args, true
+	}
+	return "", nil, false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,336 @@
+package messagebus
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSQLiteBusExportsMarkdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	bus, err := Open(path, BackendSQLite)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, ok := bus.(*SQLiteBus); !ok {
+		t.Fatalf("Open(sqlite) = %T", bus)
+	}
+
+	first, err := bus.AppendMessage(&Message{Type: "FACT", ProjectID: "p", TaskID: "t", RunID: "run-1", Body: "first"})
+	if err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	second, err := bus.AppendMessage(&Message{
+		Type: "ANSWER", ProjectID: "p", RunID: "run-2", ToTask: "t",
+		Parents: []Parent{{MsgID: first, Kind: "answers"}},
+		Links:   []Link{{URL: "https://example.com", Label: "doc"}},
+		Meta:    map[string]string{"k": "v"},
+		Body:    "second",
+	})
+	if err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+
+	got, err := bus.ReadMessages("")
+	if err != nil || !reflect.DeepEqual(messageIDs(got), []string{first, second}) {
+		t.Fatalf("ReadMessages = %v, %v", messageIDs(got), err)
+	}
+	if m := got[1]; m.Parents[0].MsgID != first || m.Links[0].Label != "doc" || m.Meta["k"] != "v" || m.ToTask != "t" || m.Body != "second" {
+		t.Fatalf("round trip lost fields: %+v", m)
+	}
+	if got, _ := bus.ReadMessagesByType(0, "answer"); !reflect.DeepEqual(messageIDs(got), []string{second}) {
+		t.Fatalf("ReadMessagesByType = %v", messageIDs(got))
+	}
+	if got, _ := bus.ReadMessagesByRunID("run-1", 0); !reflect.DeepEqual(messageIDs(got), []string{first}) {
+		t.Fatalf("ReadMessagesByRunID = %v", messageIDs(got))
+	}
+	if got, _ := bus.ReadInbox("t", "", false); !reflect.DeepEqual(messageIDs(got), []string{second}) {
+		t.Fatalf("ReadInbox = %v", messageIDs(got))
+	}
+	if _, err := bus.ReadMessages("MSG-missing"); !stderrors.Is(err, ErrSinceIDNotFound) {
+		t.Fatalf("ReadMessages(missing) err = %v", err)
+	}
+
+	// Close flushes the markdown export, which lists the same messages.
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	file, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	exported, err := file.ReadMessages("")
+	if err != nil || !reflect.DeepEqual(messageIDs(exported), []string{first, second}) {
+		t.Fatalf("markdown export = %v, %v", messageIDs(exported), err)
+	}
+
+	// A message written straight to the file is imported by the next
+	// export, which rewrites the file from the database.
+	legacy, err := file.AppendMessage(&Message{Type: "INFO", ProjectID: "p", Body: "legacy writer"})
+	if err != nil {
+		t.Fatalf("file AppendMessage: %v", err)
+	}
+	bus, err = Open(path, "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	third, err := bus.AppendMessage(&Message{Type: "INFO", ProjectID: "p", Body: "third"})
+	if err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	bus, err = Open(path, "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer bus.Close()
+	stored, _ := bus.ReadMessages(second)
+	if !reflect.DeepEqual(messageIDs(stored), []string{third, legacy}) {
+		t.Fatalf("ReadMessages after file write = %v", messageIDs(stored))
+	}
+	if exported, _ := file.ReadMessages(""); !reflect.DeepEqual(messageIDs(exported), []string{first, second, third, legacy}) {
+		t.Fatalf("rewritten export = %v", messageIDs(exported))
+	}
+}
+
+func TestSQLiteBusFilterRunsInSQL(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	bus, err := NewSQLiteBus(filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("NewSQLiteBus: %v", err)
+	}
+	defer bus.Close()
+	root, err := bus.AppendMessage(&Message{Type: "INFO", ProjectID: "proj", Timestamp: now.Add(-100 * time.Hour), Body: "root"})
+	if err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	for _, msg := range []*Message{
+		{Type: "FACT", ProjectID: "proj", TaskID: "task-1", RunID: "run-1", Timestamp: now.Add(-time.Hour),
+			Meta: map[string]string{"kind": "task_completion_propagation"}, Parents: []Parent{{MsgID: root}}, Body: "Build passed on main"},
+		{Type: "error", ProjectID: "proj", TaskID: "task-2", RunID: "run-2", Timestamp: now.Add(-72 * time.Hour), Body: "agent crashed"},
+		{Type: "Fact", ProjectID: "other", TaskID: "task-1", Timestamp: now, Meta: map[string]string{"kind": "note", "a.b": "dotted"}, Body: "PASSED"},
+	} {
+		if _, err := bus.AppendMessage(msg); err != nil {
+			t.Fatalf("AppendMessage: %v", err)
+		}
+	}
+	all, _ := bus.ReadMessages("")
+
+	for _, expr := range []string{
+		`type in (FACT,DECISION) and meta.kind = "task_completion_propagation" and ts > -2h`,
+		`type = ERROR`,
+		`type == fact or type = error`,
+		`type not in (fact)`,
+		`not type = FACT`,
+		`type ~ ACT`,
+		`meta.kind != ""`,
+		`meta.missing = ''`,
+		`meta.a.b = dotted`,
+		`body ~ "BUILD passed"`,
+		`body !~ crash`,
+		`ts >= 2026-02-27 and ts < now`,
+		`ts < -1d`,
+		`ts <= 2026-03-01T12:00:00Z and ts != 2026-03-01T11:00:00Z`,
+		`(run = run-1 or run_id = run-2) and task_id != task-2`,
+		`parent = ` + root,
+		`parent != ` + root,
+		`parent in (MSG-x, ` + root + `)`,
+		`project = proj and (msg_id in (MSG-2, MSG-3))`,
+		`not (project = other or body ~ crash)`,
+	} {
+		f, err := ParseFilterAt(expr, now)
+		if err != nil {
+			t.Fatalf("ParseFilterAt(%q): %v", expr, err)
+		}
+		if _, _, exact := filterSQL(f.root); !exact {
+			t.Errorf("%q is not translated to SQL exactly", expr)
+		}
+		got, err := bus.ReadMessagesWhere(f, 0)
+		if err != nil {
+			t.Fatalf("ReadMessagesWhere(%q): %v", expr, err)
+		}
+		if want := FilterMessages(all, f); !reflect.DeepEqual(messageIDs(got), messageIDs(want)) {
+			t.Errorf("ReadMessagesWhere(%q) = %v, want %v", expr, messageIDs(got), messageIDs(want))
+		}
+	}
+
+	// Comparisons SQL cannot fold are checked on the rows it returns.
+	f, err := ParseFilterAt(`type = fact or body ~ "ÉCHEC"`, now)
+	if err != nil {
+		t.Fatalf("ParseFilterAt: %v", err)
+	}
+	if _, _, exact := filterSQL(f.root); exact {
+		t.Fatalf("non-ASCII contains was translated exactly")
+	}
+	if got, _ := bus.ReadMessagesWhere(f, 1); len(got) != 1 || got[0].Body != "PASSED" {
+		t.Fatalf("ReadMessagesWhere(non-ASCII) = %v", messageIDs(got))
+	}
+}
+
+func TestSQLiteBusCursorsAndCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	file, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	day1 := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	old := appendAt(t, file, day1, "FACT", "", "old fact")
+	if _, err := file.Ack("ralph", old); err != nil {
+		t.Fatalf("file Ack: %v", err)
+	}
+
+	// Migration carries the cursors over.
+	if n, err := MigrateToSQLite(path); err != nil || n != 1 {
+		t.Fatalf("MigrateToSQLite = %d, %v", n, err)
+	}
+	bus, err := Open(path, "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer bus.Close()
+	if cursor, err := bus.Cursor("ralph"); err != nil || cursor == nil || cursor.MsgID != old {
+		t.Fatalf("migrated Cursor = %+v, %v", cursor, err)
+	}
+	mid := appendAt(t, bus, day1.Add(time.Hour), "PROGRESS", "run-1", "midway")
+	recent := appendAt(t, bus, day1.Add(48*time.Hour), "FACT", "", "recent fact")
+	if got, _ := bus.ReadUnacked("ralph", 0); !reflect.DeepEqual(messageIDs(got), []string{mid, recent}) {
+		t.Fatalf("ReadUnacked = %v", messageIDs(got))
+	}
+	if cursor, err := bus.Ack("ralph", mid); err != nil || cursor.MsgID != mid {
+		t.Fatalf("Ack = %+v, %v", cursor, err)
+	}
+	if cursor, err := bus.Ack("ralph", old); err != nil || cursor.MsgID != mid {
+		t.Fatalf("stale Ack moved the cursor: %+v, %v", cursor, err)
+	}
+
+	res, err := bus.Compact(CompactOptions{Before: day1.Add(24 * time.Hour)})
+	if err != nil || res.Moved != 2 {
+		t.Fatalf("Compact = %+v, %v", res, err)
+	}
+	if live, _ := bus.ReadMessages(""); !reflect.DeepEqual(messageIDs(live), []string{recent}) {
+		t.Fatalf("database after compaction = %v", messageIDs(live))
+	}
+	if exported, _ := file.ReadMessages(""); !reflect.DeepEqual(messageIDs(exported), []string{recent}) {
+		t.Fatalf("export after compaction = %v", messageIDs(exported))
+	}
+	// The archived cursor continues through the archive.
+	if got, _ := bus.ReadUnacked("ralph", 0); !reflect.DeepEqual(messageIDs(got), []string{recent}) {
+		t.Fatalf("ReadUnacked after compaction = %v", messageIDs(got))
+	}
+	if segments, err := bus.ArchiveSegments(); err != nil || len(segments) != 1 || segments[0].LastID != mid {
+		t.Fatalf("ArchiveSegments = %+v, %v", segments, err)
+	}
+
+	// Appends after compaction extend the cut export.
+	last := appendAt(t, bus, day1.Add(49*time.Hour), "FACT", "", "last")
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if exported, _ := file.ReadMessages(""); !reflect.DeepEqual(messageIDs(exported), []string{recent, last}) {
+		t.Fatalf("export after append = %v", messageIDs(exported))
+	}
+	if _, err := os.Stat(CursorsPath(path)); err != nil {
+		t.Fatalf("file cursors were removed: %v", err)
+	}
+}
+
+func TestSQLiteBusWaitForAnswer(t *testing.T) {
+	bus, err := NewSQLiteBus(filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md"), WithPollInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewSQLiteBus: %v", err)
+	}
+	defer bus.Close()
+	questionID, err := bus.AppendMessage(&Message{Type: TypeQuestion, ProjectID: "p", TaskID: "t", Body: "which plan?"})
+	if err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+	question := &Message{MsgID: questionID, ProjectID: "p", TaskID: "t"}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = bus.AppendMessage(NewAnswer(question, "plan B"))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	answer, err := bus.WaitForAnswer(ctx, questionID)
+	if err != nil || answer.Body != "plan B" {
+		t.Fatalf("WaitForAnswer = %+v, %v", answer, err)
+	}
+}
+
+func TestMigrateToSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	file, err := NewMessageBus(path)
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	ids := appendIndexTestMessages(t, file, 0, 5)
+
+	if n, err := MigrateToSQLite(path); err != nil || n != 5 {
+		t.Fatalf("MigrateToSQLite = %d, %v", n, err)
+	}
+	if n, err := MigrateToSQLite(path); err != nil || n != 0 {
+		t.Fatalf("second MigrateToSQLite = %d, %v", n, err)
+	}
+
+	// A migrated bus opens with the SQLite backend even when file is asked for.
+	bus, err := Open(path, BackendFile)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer bus.Close()
+	if _, ok := bus.(*SQLiteBus); !ok {
+		t.Fatalf("Open(migrated) = %T", bus)
+	}
+	if got, _ := bus.ReadMessagesSinceLimited(ids[1], 2); !reflect.DeepEqual(messageIDs(got), ids[3:]) {
+		t.Fatalf("ReadMessagesSinceLimited = %v", messageIDs(got))
+	}
+	if _, err := Open(path, "postgres"); err == nil {
+		t.Fatal("expected unknown backend error")
+	}
+}
+
+func TestSQLiteBusConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "TASK-MESSAGE-BUS.md")
+	const writers, perWriter = 4, 10
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			bus, err := NewSQLiteBus(path)
+			if err != nil {
+				t.Errorf("NewSQLiteBus: %v", err)
+				return
+			}
+			defer bus.Close()
+			for i := 0; i < perWriter; i++ {
+				if _, err := bus.AppendMessage(&Message{Type: "INFO", ProjectID: "p", Body: fmt.Sprintf("%d-%d", w, i)}); err != nil {
+					t.Errorf("AppendMessage: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	bus, err := NewSQLiteBus(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteBus: %v", err)
+	}
+	defer bus.Close()
+	stored, _ := bus.ReadMessages("")
+	file, _ := NewMessageBus(path)
+	exported, _ := file.ReadMessages("")
+	if len(stored) != writers*perWriter || !reflect.DeepEqual(messageIDs(stored), messageIDs(exported)) {
+		t.Fatalf("database has %d messages, export %d; orders differ: %v",
+			len(stored), len(exported), !reflect.DeepEqual(messageIDs(stored), messageIDs(exported)))
+	}
+}
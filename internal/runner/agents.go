@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	_ "github.com/jonnyzzz/conductor-loop/internal/agent/builtin"
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+)
+
+// agentDescriptor resolves how to drive the selected agent. Custom agents
+// are built from their config block; all other types come from the agent
+// registry.
+func agentDescriptor(selection agentSelection, agentType string) (agent.Descriptor, error) {
+	if agentType == agent.CustomType {
+		return agent.NewCustomDescriptor(selection.Config.CustomSpec())
+	}
+	desc, ok := agent.Lookup(agentType)
+	if !ok {
+		return agent.Descriptor{}, fmt.Errorf("unsupported agent type %q", agentType)
+	}
+	return desc, nil
+}
+
+// AgentDescriptor returns the descriptor of a configured agent, including
+// custom agents declared by their command template.
+func AgentDescriptor(agentCfg config.AgentConfig) (agent.Descriptor, error) {
+	agentType := strings.ToLower(strings.TrimSpace(agentCfg.Type))
+	return agentDescriptor(agentSelection{Type: agentType, Config: agentCfg}, agentType)
+}
+
+func isRestAgent(agentType string) bool {
+	desc, ok := agent.Lookup(agentType)
+	return ok && desc.REST
+}
+
+func tokenEnvVar(agentType string) string {
+	desc, _ := agent.Lookup(agentType)
+	return desc.TokenEnvVar
+}
+
+// cliCommand returns the CLI binary name for a given agent type.
+func cliCommand(agentType string) string {
+	desc, ok := agent.Lookup(agentType)
+	if !ok || desc.REST {
+		return ""
+	}
+	return desc.Binary
+}
+
+// commandForAgent returns the CLI command line for one run of desc.
+// Working directory is handled by SpawnOptions.Dir, not by CLI flags.
+func commandForAgent(desc agent.Descriptor, inv agent.Invocation) (agent.Command, error) {
+	if desc.REST || desc.Command == nil {
+		return agent.Command{}, fmt.Errorf("agent type %q has no CLI command", desc.Type)
+	}
+	return desc.Command(inv)
+}
+
+// restSettings maps the selected agent's config onto REST backend settings.
+// Child tasks spawned by the tool loop reuse the job config.
+func restSettings(selection agentSelection, configPath string) agent.Settings {
+	settings := agent.Settings{
+		Token:   selection.Config.Token,
+		BaseURL: selection.Config.BaseURL,
+		Model:   selection.Config.Model,
+		Headers: selection.Config.Headers,
+		Tools:   selection.Config.Tools,
+	}
+	if !settings.Tools {
+		return settings
+	}
+	settings.ConfigPath = strings.TrimSpace(configPath)
+	if settings.ConfigPath != "" {
+		if abs, err := filepath.Abs(settings.ConfigPath); err == nil {
+			settings.ConfigPath = abs
+		}
+	}
+	if execPath, err := os.Executable(); err == nil && strings.HasPrefix(filepath.Base(execPath), "run-agent") {
+		settings.RunAgentPath = execPath
+	}
+	return settings
+}
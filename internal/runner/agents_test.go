@@ -0,0 +1,126 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+)
+
+func mustDescriptor(t *testing.T, agentType string) agent.Descriptor {
+	t.Helper()
+	desc, ok := agent.Lookup(agentType)
+	if !ok {
+		t.Fatalf("agent type %q is not registered", agentType)
+	}
+	return desc
+}
+
+func TestBuiltinAgentsRegistered(t *testing.T) {
+	for _, agentType := range []string{"claude", "codex", "gemini", "perplexity", "xai", "openai-compatible"} {
+		desc := mustDescriptor(t, agentType)
+		if desc.REST != (desc.NewAgent != nil) {
+			t.Fatalf("%s: REST=%v but factory set=%v", agentType, desc.REST, desc.NewAgent != nil)
+		}
+	}
+	if _, err := agentDescriptor(agentSelection{}, "aider"); err == nil {
+		t.Fatal("expected error for unregistered agent type")
+	}
+}
+
+func TestAgentDescriptorCustom(t *testing.T) {
+	desc, err := AgentDescriptor(config.AgentConfig{
+		Type:       "custom",
+		Command:    []string{"aider", "--yes", "--message-file", "{prompt_file}"},
+		PromptMode: "file",
+		TokenEnv:   "OPENAI_API_KEY",
+	})
+	if err != nil {
+		t.Fatalf("AgentDescriptor: %v", err)
+	}
+	if desc.REST || desc.Binary != "aider" || desc.TokenEnvVar != "OPENAI_API_KEY" {
+		t.Fatalf("unexpected descriptor: %+v", desc)
+	}
+	cmd, err := commandForAgent(desc, agent.Invocation{PromptPath: "/runs/r1/prompt.md"})
+	if err != nil {
+		t.Fatalf("commandForAgent: %v", err)
+	}
+	if cmd.PromptOnStdin || strings.Join(cmd.Args, " ") != "--yes --message-file /runs/r1/prompt.md" {
+		t.Fatalf("unexpected command: %+v", cmd)
+	}
+
+	env := sanitizeEnvForAgent(desc, []string{"OPENAI_API_KEY=k", "ANTHROPIC_API_KEY=a"})
+	if strings.Join(env, ",") != "OPENAI_API_KEY=k" {
+		t.Fatalf("unexpected sanitized env: %v", env)
+	}
+}
+
+func TestRunJobCustomAgent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("custom agent script uses sh")
+	}
+	root := t.TempDir()
+	script := filepath.Join(root, "wrapper.sh")
+	content := "#!/bin/sh\necho \"args: $*\"\necho \"token: $WRAPPER_TOKEN\"\ncat \"$2\"\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	configPath := filepath.Join(root, "config.yaml")
+	configContent := `agents:
+  wrapper:
+    type: custom
+    command: ["` + script + `", "--prompt", "{prompt_file}", "--out", "{run_dir}"]
+    prompt_mode: file
+    token_env: WRAPPER_TOKEN
+    token: secret
+
+defaults:
+  agent: wrapper
+  timeout: 10
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	info, err := runJob("project", "task", JobOptions{
+		RootDir:    root,
+		ConfigPath: configPath,
+		Prompt:     "hello",
+	})
+	if err != nil {
+		t.Fatalf("runJob: %v", err)
+	}
+	if info.AgentType != "custom" {
+		t.Fatalf("expected custom agent type, got %q", info.AgentType)
+	}
+	runDir := filepath.Join(root, "project", "task", "runs", info.RunID)
+	output, err := os.ReadFile(filepath.Join(runDir, "output.md"))
+	if err != nil {
+		t.Fatalf("read output.md: %v", err)
+	}
+	promptPath := filepath.Join(runDir, "prompt.md")
+	if !strings.Contains(string(output), "args: --prompt "+promptPath) {
+		t.Fatalf("expected prompt path in args, got %q", output)
+	}
+	if !strings.Contains(string(output), "token: secret") {
+		t.Fatalf("expected token in environment, got %q", output)
+	}
+	if !strings.Contains(string(output), "hello") {
+		t.Fatalf("expected prompt file content, got %q", output)
+	}
+	if strings.Contains(info.CommandLine, "<") {
+		t.Fatalf("file mode must not redirect stdin: %q", info.CommandLine)
+	}
+	events, err := transcript.Read(filepath.Join(runDir, transcript.FileName))
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	if len(events) == 0 || events[0].Type != transcript.TypeAssistantText || !strings.Contains(events[0].Text, "token: secret") {
+		t.Fatalf("expected plain text transcript, got %+v", events)
+	}
+}
@@ -0,0 +1,395 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/pkg/errors"
+)
+
+// budgetExceededMarker is written into a task directory once its subtree
+// crossed a budget cap. While present, runJob refuses to start new runs in
+// that task or in any task whose parent run chain leads back to it.
+const budgetExceededMarker = "BUDGET_EXCEEDED"
+
+// ErrBudgetExceeded indicates a task subtree crossed one of its budget caps.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Budget caps what a task and all of its descendant runs may consume.
+// Zero fields mean no limit for that dimension.
+type Budget struct {
+	MaxTokens    int64
+	MaxCostUSD   float64
+	MaxWallClock time.Duration
+	MaxRestarts  int
+}
+
+// IsZero reports whether no cap is set.
+func (b Budget) IsZero() bool {
+	return b.MaxTokens <= 0 && b.MaxCostUSD <= 0 && b.MaxWallClock <= 0 && b.MaxRestarts <= 0
+}
+
+// withDefaults fills caps that are unset on b from defaults.budget in cfg.
+func (b Budget) withDefaults(cfg *config.Config) (Budget, error) {
+	if cfg == nil || cfg.Defaults.Budget == nil {
+		return b, nil
+	}
+	defaults := cfg.Defaults.Budget
+	if b.MaxTokens <= 0 {
+		b.MaxTokens = defaults.MaxTokens
+	}
+	if b.MaxCostUSD <= 0 {
+		b.MaxCostUSD = defaults.MaxCostUSD
+	}
+	if b.MaxRestarts <= 0 {
+		b.MaxRestarts = defaults.MaxRestarts
+	}
+	if b.MaxWallClock <= 0 {
+		wallClock, err := defaults.WallClock()
+		if err != nil {
+			return b, err
+		}
+		b.MaxWallClock = wallClock
+	}
+	return b, nil
+}
+
+// budgetSpend is the measured consumption of a task subtree.
+type budgetSpend struct {
+	Tokens   int64
+	CostUSD  float64
+	Restarts int
+	Elapsed  time.Duration
+}
+
+// exceededBy returns a human-readable reason when spend crosses a cap, or an
+// empty string while the subtree is within budget.
+func (b Budget) exceededBy(spend budgetSpend) string {
+	switch {
+	case b.MaxTokens > 0 && spend.Tokens >= b.MaxTokens:
+		return fmt.Sprintf("tokens %d >= max %d", spend.Tokens, b.MaxTokens)
+	case b.MaxCostUSD > 0 && spend.CostUSD >= b.MaxCostUSD:
+		return fmt.Sprintf("cost $%.4f >= max $%.4f", spend.CostUSD, b.MaxCostUSD)
+	case b.MaxRestarts > 0 && spend.Restarts > b.MaxRestarts:
+		return fmt.Sprintf("restarts %d > max %d", spend.Restarts, b.MaxRestarts)
+	case b.MaxWallClock > 0 && spend.Elapsed >= b.MaxWallClock:
+		return fmt.Sprintf("wall clock %s >= max %s", roundElapsed(spend.Elapsed), b.MaxWallClock)
+	}
+	return ""
+}
+
+func roundElapsed(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
+
+// budgetGuard enforces a budget on the subtree of one task. The Ralph loop
+// guards a whole task; runJob guards a single run started with job flags.
+type budgetGuard struct {
+	budget       Budget
+	taskDir      string
+	projectID    string
+	taskID       string
+	pollInterval time.Duration
+	post         func(msgType, body string) error
+
+	mu       sync.Mutex
+	start    time.Time
+	exceeded string
+}
+
+func newBudgetGuard(budget Budget, taskDir, projectID, taskID string, pollInterval time.Duration, post func(msgType, body string) error) *budgetGuard {
+	return &budgetGuard{
+		budget:       budget,
+		taskDir:      taskDir,
+		projectID:    projectID,
+		taskID:       taskID,
+		pollInterval: pollInterval,
+		post:         post,
+		start:        time.Now(),
+	}
+}
+
+// enforce measures the task subtree and, when a cap is crossed, stops it and
+// returns ErrBudgetExceeded. A nil guard enforces nothing.
+func (g *budgetGuard) enforce() error {
+	if g == nil {
+		return nil
+	}
+	if reason := g.reason(); reason != "" {
+		return errors.Wrap(ErrBudgetExceeded, reason)
+	}
+	if g.budget.IsZero() {
+		return nil
+	}
+	if g.check() {
+		return errors.Wrap(ErrBudgetExceeded, g.reason())
+	}
+	return nil
+}
+
+// watch polls the subtree while a run is in flight so that runaway runs are
+// stopped mid-flight. The returned func stops the watcher.
+func (g *budgetGuard) watch() func() {
+	if g == nil || g.budget.IsZero() {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(g.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if g.check() {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// check reports whether the subtree is over budget. On the first crossing it
+// records the reason, writes the task marker, stops running process groups
+// and posts BUDGET_EXCEEDED.
+func (g *budgetGuard) check() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.exceeded != "" {
+		return true
+	}
+	runs, err := collectSubtreeRuns(g.taskDir)
+	if err != nil {
+		obslog.Log(log.Default(), "WARN", "runner", "budget_measure_failed",
+			obslog.F("project_id", g.projectID),
+			obslog.F("task_id", g.taskID),
+			obslog.F("error", err),
+		)
+		return false
+	}
+	spend := measureSpend(runs, time.Since(g.start))
+	reason := g.budget.exceededBy(spend)
+	if reason == "" {
+		return false
+	}
+	g.exceeded = reason
+
+	if err := writeBudgetMarker(g.taskDir, reason); err != nil {
+		obslog.Log(log.Default(), "WARN", "runner", "budget_marker_write_failed",
+			obslog.F("project_id", g.projectID),
+			obslog.F("task_id", g.taskID),
+			obslog.F("error", err),
+		)
+	}
+	stopped := stopSubtreeRuns(runs)
+	body := fmt.Sprintf("task budget exceeded: %s\ntokens: %d\ncost_usd: %.4f\nrestarts: %d\nelapsed: %s\nstopped runs: %v",
+		reason, spend.Tokens, spend.CostUSD, spend.Restarts, roundElapsed(spend.Elapsed), stopped)
+	_ = g.post(messagebus.EventTypeBudgetExceeded, body)
+	obslog.Log(log.Default(), "ERROR", "runner", "budget_exceeded",
+		obslog.F("project_id", g.projectID),
+		obslog.F("task_id", g.taskID),
+		obslog.F("reason", reason),
+		obslog.F("cost_usd", spend.CostUSD),
+		obslog.F("restarts", spend.Restarts),
+		obslog.F("stopped_runs", len(stopped)),
+	)
+	return true
+}
+
+// reason returns why the budget was exceeded, or an empty string while the
+// subtree is within budget.
+func (g *budgetGuard) reason() string {
+	if g == nil {
+		return ""
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.exceeded
+}
+
+// subtreeRun is a run that belongs to a task or one of its descendants.
+type subtreeRun struct {
+	Path string
+	Info *storage.RunInfo
+}
+
+// collectSubtreeRuns returns every run of the task in taskDir plus every run
+// in the same project whose parent_run_id chain leads back to one of them.
+func collectSubtreeRuns(taskDir string) ([]subtreeRun, error) {
+	clean := filepath.Clean(strings.TrimSpace(taskDir))
+	if clean == "." || clean == "" {
+		return nil, errors.New("task directory is empty")
+	}
+	projectDir := filepath.Dir(clean)
+	taskEntries, err := os.ReadDir(projectDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read project directory")
+	}
+
+	var (
+		subtree  []subtreeRun
+		pending  []subtreeRun
+		included = make(map[string]bool)
+	)
+	for _, taskEntry := range taskEntries {
+		if !taskEntry.IsDir() {
+			continue
+		}
+		runsDir := filepath.Join(projectDir, taskEntry.Name(), "runs")
+		runEntries, err := os.ReadDir(runsDir)
+		if err != nil {
+			continue
+		}
+		ownTask := filepath.Join(projectDir, taskEntry.Name()) == clean
+		for _, runEntry := range runEntries {
+			if !runEntry.IsDir() {
+				continue
+			}
+			path := filepath.Join(runsDir, runEntry.Name(), "run-info.yaml")
+			info, err := storage.ReadRunInfo(path)
+			if err != nil {
+				continue
+			}
+			run := subtreeRun{Path: path, Info: info}
+			if ownTask {
+				subtree = append(subtree, run)
+				included[info.RunID] = true
+				continue
+			}
+			if strings.TrimSpace(info.ParentRunID) != "" {
+				pending = append(pending, run)
+			}
+		}
+	}
+
+	// Descendants may be nested several levels deep; sweep until stable.
+	for changed := true; changed; {
+		changed = false
+		remaining := pending[:0]
+		for _, run := range pending {
+			if included[run.Info.ParentRunID] {
+				subtree = append(subtree, run)
+				included[run.Info.RunID] = true
+				changed = true
+				continue
+			}
+			remaining = append(remaining, run)
+		}
+		pending = remaining
+	}
+	return subtree, nil
+}
+
+// measureSpend sums usage and restarts over runs. A run counts as a restart
+// when it continues a previous run of the same task.
+func measureSpend(runs []subtreeRun, elapsed time.Duration) budgetSpend {
+	spend := budgetSpend{Elapsed: elapsed}
+	for _, run := range runs {
+		if run.Info.Usage != nil {
+			spend.Tokens += run.Info.Usage.TotalTokens()
+			spend.CostUSD += run.Info.Usage.CostUSD
+		}
+		if strings.TrimSpace(run.Info.PreviousRunID) != "" {
+			spend.Restarts++
+		}
+	}
+	return spend
+}
+
+// stopSubtreeRuns sends SIGTERM to the process groups of every running run in
+// the subtree, skipping the caller's own group. It returns the stopped run IDs.
+func stopSubtreeRuns(runs []subtreeRun) []string {
+	selfPGID, err := ProcessGroupID(os.Getpid())
+	if err != nil {
+		selfPGID = 0
+	}
+	var stopped []string
+	for _, run := range runs {
+		info := run.Info
+		if !info.EndTime.IsZero() || info.PGID <= 0 || info.PGID == selfPGID {
+			continue
+		}
+		if err := TerminateProcessGroup(info.PGID); err != nil {
+			obslog.Log(log.Default(), "WARN", "runner", "budget_stop_run_failed",
+				obslog.F("project_id", info.ProjectID),
+				obslog.F("task_id", info.TaskID),
+				obslog.F("run_id", info.RunID),
+				obslog.F("pgid", info.PGID),
+				obslog.F("error", err),
+			)
+			continue
+		}
+		stopped = append(stopped, info.RunID)
+	}
+	return stopped
+}
+
+func writeBudgetMarker(taskDir, reason string) error {
+	path := filepath.Join(taskDir, budgetExceededMarker)
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(reason)+"\n"), 0o644); err != nil {
+		return errors.Wrap(err, "write budget marker")
+	}
+	return nil
+}
+
+func readBudgetMarker(taskDir string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(taskDir, budgetExceededMarker))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+// checkBudgetAncestry refuses new runs for a task whose own subtree, or the
+// subtree of any ancestor task reachable through parentRunID, has exceeded
+// its budget.
+func checkBudgetAncestry(taskDir, parentRunID string) error {
+	if reason, ok := readBudgetMarker(taskDir); ok {
+		return errors.Wrapf(ErrBudgetExceeded, "task %s: %s", filepath.Base(taskDir), reason)
+	}
+	projectDir := filepath.Dir(taskDir)
+	seen := make(map[string]bool)
+	for runID := strings.TrimSpace(parentRunID); runID != "" && !seen[runID]; {
+		seen[runID] = true
+		ancestorTaskDir, info := findRunInProject(projectDir, runID)
+		if info == nil {
+			return nil
+		}
+		if reason, ok := readBudgetMarker(ancestorTaskDir); ok {
+			return errors.Wrapf(ErrBudgetExceeded, "ancestor task %s: %s", info.TaskID, reason)
+		}
+		runID = strings.TrimSpace(info.ParentRunID)
+	}
+	return nil
+}
+
+func findRunInProject(projectDir, runID string) (string, *storage.RunInfo) {
+	matches, err := filepath.Glob(filepath.Join(projectDir, "*", "runs", runID, "run-info.yaml"))
+	if err != nil || len(matches) == 0 {
+		return "", nil
+	}
+	info, err := storage.ReadRunInfo(matches[0])
+	if err != nil {
+		return "", nil
+	}
+	return filepath.Dir(filepath.Dir(filepath.Dir(matches[0]))), info
+}
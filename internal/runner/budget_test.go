@@ -0,0 +1,238 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+func writeBudgetRun(t *testing.T, projectDir, taskID, runID, parentRunID string, usage *storage.Usage) string {
+	t.Helper()
+	runDir := filepath.Join(projectDir, taskID, "runs", runID)
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		t.Fatalf("mkdir run dir: %v", err)
+	}
+	info := &storage.RunInfo{
+		RunID:       runID,
+		ParentRunID: parentRunID,
+		ProjectID:   filepath.Base(projectDir),
+		TaskID:      taskID,
+		AgentType:   "codex",
+		StartTime:   time.Now().UTC(),
+		EndTime:     time.Now().UTC(),
+		Status:      storage.StatusCompleted,
+		Usage:       usage,
+	}
+	if err := storage.WriteRunInfo(filepath.Join(runDir, "run-info.yaml"), info); err != nil {
+		t.Fatalf("write run-info: %v", err)
+	}
+	return runDir
+}
+
+func TestCollectSubtreeRuns(t *testing.T) {
+	projectDir := filepath.Join(t.TempDir(), "project")
+	writeBudgetRun(t, projectDir, "task-a", "run-a", "", &storage.Usage{InputTokens: 10})
+	writeBudgetRun(t, projectDir, "task-c", "run-c", "run-b", &storage.Usage{InputTokens: 1, CostUSD: 0.5})
+	writeBudgetRun(t, projectDir, "task-b", "run-b", "run-a", &storage.Usage{OutputTokens: 5})
+	writeBudgetRun(t, projectDir, "task-d", "run-d", "run-other", &storage.Usage{InputTokens: 1000})
+
+	runs, err := collectSubtreeRuns(filepath.Join(projectDir, "task-a"))
+	if err != nil {
+		t.Fatalf("collectSubtreeRuns: %v", err)
+	}
+	var ids []string
+	for _, run := range runs {
+		ids = append(ids, run.Info.RunID)
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "run-a,run-b,run-c" {
+		t.Fatalf("unexpected subtree: %v", ids)
+	}
+
+	spend := measureSpend(runs, time.Minute)
+	if spend.Tokens != 16 || spend.CostUSD != 0.5 {
+		t.Fatalf("unexpected spend: %+v", spend)
+	}
+}
+
+func TestBudgetExceededBy(t *testing.T) {
+	budget := Budget{MaxTokens: 100, MaxCostUSD: 1, MaxWallClock: time.Hour, MaxRestarts: 2}
+	if reason := budget.exceededBy(budgetSpend{Tokens: 99, CostUSD: 0.5, Restarts: 2, Elapsed: time.Minute}); reason != "" {
+		t.Fatalf("expected within budget, got %q", reason)
+	}
+	cases := []budgetSpend{
+		{Tokens: 100},
+		{CostUSD: 1.5},
+		{Restarts: 3},
+		{Elapsed: 2 * time.Hour},
+	}
+	for _, spend := range cases {
+		if budget.exceededBy(spend) == "" {
+			t.Fatalf("expected %+v to exceed budget", spend)
+		}
+	}
+	if (Budget{}).exceededBy(budgetSpend{Tokens: 1 << 40}) != "" {
+		t.Fatal("zero budget must be unlimited")
+	}
+}
+
+func TestBudgetWithDefaults(t *testing.T) {
+	cfg := &config.Config{Defaults: config.DefaultConfig{Budget: &config.BudgetConfig{
+		MaxTokens:    1000,
+		MaxCostUSD:   2,
+		MaxWallClock: "30m",
+		MaxRestarts:  5,
+	}}}
+	budget, err := Budget{MaxTokens: 50}.withDefaults(cfg)
+	if err != nil {
+		t.Fatalf("withDefaults: %v", err)
+	}
+	want := Budget{MaxTokens: 50, MaxCostUSD: 2, MaxWallClock: 30 * time.Minute, MaxRestarts: 5}
+	if budget != want {
+		t.Fatalf("budget=%+v, want %+v", budget, want)
+	}
+}
+
+func TestRalphLoopBudgetExceededRefusesRestart(t *testing.T) {
+	projectDir := filepath.Join(t.TempDir(), "project")
+	writeBudgetRun(t, projectDir, "task", "run-1", "", &storage.Usage{InputTokens: 400, OutputTokens: 200})
+	taskDir := filepath.Join(projectDir, "task")
+	bus := newMessageBus(t, taskDir)
+
+	calls := 0
+	loop, err := NewRalphLoop(taskDir, bus,
+		WithProjectTask("project", "task"),
+		WithBudget(Budget{MaxTokens: 500}),
+		WithRestartDelay(0),
+		WithRootRunner(func(ctx context.Context, attempt int) error {
+			calls++
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewRalphLoop: %v", err)
+	}
+	err = loop.Run(context.Background())
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded, got %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("expected no root runs, got %d", calls)
+	}
+	if _, ok := readBudgetMarker(taskDir); !ok {
+		t.Fatal("expected budget marker in task dir")
+	}
+	found := false
+	for _, msg := range readMessages(t, bus) {
+		if msg.Type == messagebus.EventTypeBudgetExceeded {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected BUDGET_EXCEEDED message")
+	}
+}
+
+func TestRalphLoopBudgetStopsRunningRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process group checks not supported on windows")
+	}
+	projectDir := filepath.Join(t.TempDir(), "project")
+	taskDir := filepath.Join(projectDir, "task")
+	runDir := filepath.Join(taskDir, "runs", "run-root")
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	bus := newMessageBus(t, taskDir)
+
+	loop, err := NewRalphLoop(taskDir, bus,
+		WithProjectTask("project", "task"),
+		WithBudget(Budget{MaxWallClock: 100 * time.Millisecond}),
+		WithPollInterval(20*time.Millisecond),
+		WithRootRunner(func(ctx context.Context, attempt int) error {
+			proc, cancel := spawnSleepProcess(t, runDir, 10*time.Second)
+			defer cancel()
+			writeChildRunInfo(t, runDir, "run-root", "", proc)
+			return proc.Wait()
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewRalphLoop: %v", err)
+	}
+
+	start := time.Now()
+	err = loop.Run(context.Background())
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("root run was not stopped promptly (%s)", elapsed)
+	}
+}
+
+func TestCheckBudgetAncestry(t *testing.T) {
+	projectDir := filepath.Join(t.TempDir(), "project")
+	writeBudgetRun(t, projectDir, "parent", "run-p", "", nil)
+	writeBudgetRun(t, projectDir, "child", "run-c", "run-p", nil)
+	childDir := filepath.Join(projectDir, "child")
+
+	if err := checkBudgetAncestry(childDir, "run-c"); err != nil {
+		t.Fatalf("expected no error before marker, got %v", err)
+	}
+	if err := writeBudgetMarker(filepath.Join(projectDir, "parent"), "tokens 10 >= max 5"); err != nil {
+		t.Fatalf("write marker: %v", err)
+	}
+	err := checkBudgetAncestry(filepath.Join(projectDir, "grandchild"), "run-c")
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded through ancestry, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "parent") {
+		t.Fatalf("expected ancestor task in error, got %v", err)
+	}
+}
+
+func TestRunJobBudgetRefusesOverspentTask(t *testing.T) {
+	root := t.TempDir()
+	binDir := filepath.Join(root, "bin")
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		t.Fatalf("mkdir bin: %v", err)
+	}
+	createFakeCLI(t, binDir, "codex")
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	projectDir := filepath.Join(root, "project")
+	writeBudgetRun(t, projectDir, "task", "run-1", "", &storage.Usage{InputTokens: 400, OutputTokens: 200})
+	taskDir := filepath.Join(projectDir, "task")
+
+	info, err := runJob("project", "task", JobOptions{
+		RootDir: root,
+		Agent:   "codex",
+		Prompt:  "hello",
+		Budget:  Budget{MaxTokens: 500},
+	})
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected ErrBudgetExceeded, got %v", err)
+	}
+	if info != nil {
+		t.Fatalf("expected no run, got %s", info.RunID)
+	}
+	if _, ok := readBudgetMarker(taskDir); !ok {
+		t.Fatal("expected budget marker in task dir")
+	}
+	entries, err := os.ReadDir(filepath.Join(taskDir, "runs"))
+	if err != nil {
+		t.Fatalf("read runs dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the earlier run, got %d runs", len(entries))
+	}
+}
@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"log"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+)
+
+// initBusBackend opens the buses with the configured storage backend so
+// that later writers, which detect the backend from the files on disk, use
+// it too. Switching an existing file bus to sqlite imports its messages.
+// Failures are logged: the file backend keeps working.
+func initBusBackend(backend string, busPaths ...string) {
+	if !strings.EqualFold(strings.TrimSpace(backend), messagebus.BackendSQLite) {
+		return
+	}
+	for _, busPath := range busPaths {
+		bus, err := messagebus.Open(busPath, messagebus.BackendSQLite)
+		if err == nil {
+			err = bus.Close()
+		}
+		if err != nil {
+			obslog.Log(log.Default(), "WARN", "runner", "bus_backend_init_failed",
+				obslog.F("path", busPath),
+				obslog.F("backend", backend),
+				obslog.F("error", err),
+			)
+		}
+	}
+}
+
+// SyncBusSchemaPolicy stores the configured message validation next to the
+// buses, where every writer of the bus picks it up. With validation off the
+// policy files are removed. runJob, the API server and the run-agent bus
+// commands call it before writing, so the config applies before the first
+// run of a task. Failures are logged.
+func SyncBusSchemaPolicy(cfg config.MessageBusConfig, busPaths ...string) {
+	policy := messagebus.SchemaPolicy{Mode: cfg.Validation, Types: cfg.Types}
+	for _, busPath := range busPaths {
+		if err := messagebus.WriteSchemaPolicy(busPath, policy); err != nil {
+			obslog.Log(log.Default(), "WARN", "runner", "bus_schema_policy_failed",
+				obslog.F("path", busPath),
+				obslog.F("validation", cfg.Validation),
+				obslog.F("error", err),
+			)
+		}
+	}
+}
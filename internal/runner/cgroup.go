@@ -0,0 +1,359 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/pkg/errors"
+)
+
+// The proc files used to locate cgroup v2; tests point them at fakes.
+var (
+	procMountsPath = "/proc/self/mounts"
+	procCgroupPath = "/proc/self/cgroup"
+)
+
+const (
+	// cgroupLeafName is the child cgroup run-agent moves itself into when its
+	// own cgroup must hand controllers down to run cgroups (cgroup v2 does not
+	// allow processes in a cgroup that delegates controllers).
+	cgroupLeafName = "run-agent"
+	// cgroupRemoveTimeout bounds waiting for killed processes to leave.
+	cgroupRemoveTimeout = 5 * time.Second
+	// cgroupParentEnv passes the parent of a run cgroup to the agent so that
+	// child runs it starts create sibling cgroups instead of nesting theirs
+	// inside the parent run's cgroup.
+	cgroupParentEnv = "JRUN_CGROUP_PARENT"
+)
+
+var (
+	// cgroupSetupMu serializes controller delegation across concurrent runs.
+	cgroupSetupMu sync.Mutex
+	// selfCgroupParent is run-agent's original cgroup once it delegates
+	// controllers to run cgroups.
+	selfCgroupParent string
+
+	// pendingCgroupsMu guards pendingCgroups.
+	pendingCgroupsMu sync.Mutex
+	// pendingCgroups are run cgroups whose release waits for child runs.
+	pendingCgroups []pendingCgroup
+)
+
+// runCgroup is the cgroup v2 directory that holds one run's processes.
+type runCgroup struct {
+	mount string
+	dir   string
+}
+
+// pendingCgroup is a finished run's cgroup that still holds child runs.
+type pendingCgroup struct {
+	cg      *runCgroup
+	taskDir string
+	info    *storage.RunInfo
+}
+
+// createRunCgroup creates <parent>/run-<runID> and applies the configured
+// limits. The memory controller is always enabled so that peak memory and
+// OOM kills can be reported. Without a configured parent, a run started by
+// another run's agent uses the parent passed in JRUN_CGROUP_PARENT, so its
+// cgroup is a sibling of the parent run's cgroup.
+func createRunCgroup(resources *config.ResourcesConfig, runID string) (*runCgroup, error) {
+	mount, err := cgroup2Mount()
+	if err != nil {
+		return nil, err
+	}
+	self, err := selfCgroupDir(mount)
+	if err != nil {
+		return nil, err
+	}
+	parent := self
+	if configured := strings.TrimSpace(resources.CgroupParent); configured != "" {
+		parent = filepath.Join(mount, strings.TrimPrefix(filepath.Clean(configured), mount))
+	} else if inherited := strings.TrimSpace(os.Getenv(cgroupParentEnv)); inherited != "" {
+		parent = filepath.Join(mount, strings.TrimPrefix(filepath.Clean(inherited), mount))
+	}
+	controllers := []string{"memory"}
+	if strings.TrimSpace(resources.CPUMax) != "" {
+		controllers = append(controllers, "cpu")
+	}
+	if resources.PidsMax > 0 {
+		controllers = append(controllers, "pids")
+	}
+	cgroupSetupMu.Lock()
+	if parent == self && selfCgroupParent != "" {
+		// run-agent already moved itself into a leaf of this parent.
+		parent = selfCgroupParent
+	}
+	err = delegateControllers(parent, parent == self, controllers)
+	if err == nil && parent == self {
+		selfCgroupParent = parent
+	}
+	cgroupSetupMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(parent, "run-"+containerNameUnsafe.ReplaceAllString(runID, "_"))
+	if err := os.Mkdir(dir, 0o755); err != nil && !os.IsExist(err) {
+		return nil, errors.Wrap(err, "create run cgroup")
+	}
+	cg := &runCgroup{mount: mount, dir: dir}
+	limits := []struct{ file, value string }{
+		{"cpu.max", strings.TrimSpace(resources.CPUMax)},
+		{"memory.max", strings.TrimSpace(resources.MemoryMax)},
+	}
+	if resources.PidsMax > 0 {
+		limits = append(limits, struct{ file, value string }{"pids.max", strconv.Itoa(resources.PidsMax)})
+	}
+	for _, limit := range limits {
+		if limit.value == "" {
+			continue
+		}
+		if err := writeCgroupFile(dir, limit.file, limit.value); err != nil {
+			_ = os.Remove(dir)
+			return nil, err
+		}
+	}
+	// Kill the whole run on OOM rather than leaving a half-dead process tree.
+	_ = writeCgroupFile(dir, "memory.oom.group", "1")
+	return cg, nil
+}
+
+// delegateControllers enables controllers in parent's cgroup.subtree_control.
+// When parent is run-agent's own cgroup and still holds processes, run-agent
+// first moves itself into a leaf child.
+func delegateControllers(parent string, isSelf bool, controllers []string) error {
+	enabled, _ := os.ReadFile(filepath.Join(parent, "cgroup.subtree_control"))
+	available, err := os.ReadFile(filepath.Join(parent, "cgroup.controllers"))
+	if err != nil {
+		return errors.Wrapf(err, "read controllers of cgroup %s", parent)
+	}
+	var missing []string
+	for _, controller := range controllers {
+		if containsField(string(enabled), controller) {
+			continue
+		}
+		if !containsField(string(available), controller) {
+			return errors.Errorf("cgroup %s does not delegate the %s controller", parent, controller)
+		}
+		missing = append(missing, "+"+controller)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	request := strings.Join(missing, " ")
+	err = writeCgroupFile(parent, "cgroup.subtree_control", request)
+	if err != nil && isSelf && errors.Is(err, syscall.EBUSY) {
+		leaf := filepath.Join(parent, cgroupLeafName)
+		if mkErr := os.Mkdir(leaf, 0o755); mkErr != nil && !os.IsExist(mkErr) {
+			return errors.Wrap(mkErr, "create run-agent leaf cgroup")
+		}
+		if mvErr := writeCgroupFile(leaf, "cgroup.procs", "0"); mvErr != nil {
+			return mvErr
+		}
+		err = writeCgroupFile(parent, "cgroup.subtree_control", request)
+	}
+	return err
+}
+
+// usage reads the accounting files of the cgroup.
+func (c *runCgroup) usage() *storage.ResourceUsage {
+	usage := &storage.ResourceUsage{Cgroup: "/" + filepath.ToSlash(strings.TrimPrefix(strings.TrimPrefix(c.dir, c.mount), string(filepath.Separator)))}
+	if data, err := os.ReadFile(filepath.Join(c.dir, "memory.peak")); err == nil {
+		usage.PeakMemoryBytes, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	}
+	cpu := readCgroupKeyed(filepath.Join(c.dir, "cpu.stat"))
+	usage.CPUSeconds = float64(cpu["usage_usec"]) / 1e6
+	usage.CPUUserSeconds = float64(cpu["user_usec"]) / 1e6
+	usage.CPUSystemSeconds = float64(cpu["system_usec"]) / 1e6
+	usage.OOMKills = int(readCgroupKeyed(filepath.Join(c.dir, "memory.events"))["oom_kill"])
+	return usage
+}
+
+// remove kills whatever is left in the cgroup (processes that escaped the
+// process group included) and deletes it.
+func (c *runCgroup) remove() error {
+	_ = writeCgroupFile(c.dir, "cgroup.kill", "1")
+	deadline := time.Now().Add(cgroupRemoveTimeout)
+	for {
+		err := os.Remove(c.dir)
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		if !errors.Is(err, syscall.EBUSY) || time.Now().After(deadline) {
+			return errors.Wrap(err, "remove run cgroup")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// startRunCgroup creates the run's cgroup. It returns nil when resources is
+// not configured or the cgroup cannot be set up; the run then proceeds
+// without limits.
+func startRunCgroup(resources *config.ResourcesConfig, info *storage.RunInfo) *runCgroup {
+	if resources == nil {
+		return nil
+	}
+	cg, err := createRunCgroup(resources, info.RunID)
+	if err != nil {
+		logCgroupWarning("cgroup_setup_failed", info, err)
+		return nil
+	}
+	return cg
+}
+
+// dropRunCgroup removes a cgroup no process was started in.
+func dropRunCgroup(cg *runCgroup, info *storage.RunInfo) {
+	if cg == nil {
+		return
+	}
+	if err := cg.remove(); err != nil {
+		logCgroupWarning("cgroup_remove_failed", info, err)
+	}
+}
+
+// releaseRunCgroup removes the cgroup of a finished run, killing what the
+// agent left behind. Child runs the agent started in the background live in
+// it too (their run-agent process does), so while any of them is active the
+// release is deferred to releasePendingCgroups.
+func releaseRunCgroup(cg *runCgroup, taskDir string, info *storage.RunInfo) {
+	if cg == nil {
+		return
+	}
+	if hasActiveChildRuns(taskDir, info.RunID) {
+		pendingCgroupsMu.Lock()
+		pendingCgroups = append(pendingCgroups, pendingCgroup{cg: cg, taskDir: taskDir, info: info})
+		pendingCgroupsMu.Unlock()
+		return
+	}
+	dropRunCgroup(cg, info)
+}
+
+// releasePendingCgroups releases the deferred cgroups whose child runs have
+// finished. The cgroups of runs with children still active are left in
+// place so that those children keep running.
+func releasePendingCgroups() {
+	pendingCgroupsMu.Lock()
+	pending := pendingCgroups
+	pendingCgroups = nil
+	pendingCgroupsMu.Unlock()
+	for _, p := range pending {
+		if hasActiveChildRuns(p.taskDir, p.info.RunID) {
+			logCgroupWarning("cgroup_left_with_children", p.info, errors.Errorf("cgroup %s still holds active child runs", p.cg.dir))
+			continue
+		}
+		dropRunCgroup(p.cg, p.info)
+	}
+}
+
+func hasActiveChildRuns(taskDir, runID string) bool {
+	children, _ := FindActiveChildren(taskDir)
+	for _, child := range children {
+		if child.ParentRunID == runID {
+			return true
+		}
+	}
+	return false
+}
+
+// formatResourcesLine renders the resources line of the RUN_STOP message.
+func formatResourcesLine(usage *storage.ResourceUsage) string {
+	if usage == nil {
+		return ""
+	}
+	parts := make([]string, 0, 3)
+	if usage.OOMKilled() {
+		parts = append(parts, fmt.Sprintf("OUT OF MEMORY (%d oom kill(s))", usage.OOMKills))
+	}
+	if usage.PeakMemoryBytes > 0 {
+		parts = append(parts, fmt.Sprintf("peak memory %.1f MiB", float64(usage.PeakMemoryBytes)/(1<<20)))
+	}
+	parts = append(parts, fmt.Sprintf("cpu %.1fs (user %.1fs, system %.1fs)", usage.CPUSeconds, usage.CPUUserSeconds, usage.CPUSystemSeconds))
+	return "resources: " + strings.Join(parts, ", ")
+}
+
+func logCgroupWarning(event string, info *storage.RunInfo, err error) {
+	obslog.Log(log.Default(), "WARN", "runner", event,
+		obslog.F("project_id", info.ProjectID),
+		obslog.F("task_id", info.TaskID),
+		obslog.F("run_id", info.RunID),
+		obslog.F("error", err),
+	)
+}
+
+// cgroup2Mount returns the mount point of the cgroup v2 hierarchy.
+func cgroup2Mount() (string, error) {
+	data, err := os.ReadFile(procMountsPath)
+	if err != nil {
+		return "", errors.Wrap(err, "cgroup v2 is not available")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[2] == "cgroup2" {
+			return fields[1], nil
+		}
+	}
+	return "", errors.New("cgroup v2 is not mounted")
+}
+
+// selfCgroupDir returns the directory of run-agent's own cgroup v2.
+func selfCgroupDir(mount string) (string, error) {
+	data, err := os.ReadFile(procCgroupPath)
+	if err != nil {
+		return "", errors.Wrap(err, "read own cgroup")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(mount, filepath.FromSlash(strings.TrimSpace(path))), nil
+		}
+	}
+	return "", errors.New("run-agent is not in a cgroup v2 hierarchy")
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o644); err != nil {
+		return errors.Wrapf(err, "write %s", name)
+	}
+	return nil
+}
+
+// readCgroupKeyed parses a flat keyed file such as cpu.stat.
+func readCgroupKeyed(path string) map[string]int64 {
+	values := make(map[string]int64)
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values
+}
+
+func containsField(list, name string) bool {
+	for _, field := range strings.Fields(list) {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// applyCgroup makes cmd start inside the cgroup dir (clone3 with
+// CLONE_INTO_CGROUP), so nothing the agent forks can run outside its limits.
+// The returned func closes the cgroup fd once the process started.
+func applyCgroup(cmd *exec.Cmd, dir string) (func(), error) {
+	if dir == "" {
+		return func() {}, nil
+	}
+	f, err := os.OpenFile(dir, os.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "open run cgroup")
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(f.Fd())
+	return func() { _ = f.Close() }, nil
+}
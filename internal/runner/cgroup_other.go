@@ -0,0 +1,16 @@
+//go:build !linux
+
+package runner
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+func applyCgroup(cmd *exec.Cmd, dir string) (func(), error) {
+	if dir == "" {
+		return func() {}, nil
+	}
+	return nil, errors.New("run cgroups are only supported on linux")
+}
@@ -0,0 +1,198 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// fakeCgroupFS lays out a cgroup v2 mount with run-agent in /agents and
+// points the proc lookups at it.
+func fakeCgroupFS(t *testing.T, controllers string) (mount, self string) {
+	t.Helper()
+	root := t.TempDir()
+	mount = filepath.Join(root, "cgroup")
+	self = filepath.Join(mount, "agents")
+	if err := os.MkdirAll(self, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	files := map[string]string{
+		filepath.Join(self, "cgroup.controllers"):     controllers,
+		filepath.Join(self, "cgroup.subtree_control"): "",
+		filepath.Join(root, "mounts"):                 "proc /proc proc rw 0 0\ncgroup2 " + mount + " cgroup2 rw 0 0\n",
+		filepath.Join(root, "self-cgroup"):            "0::/agents\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+	oldMounts, oldCgroup, oldParent := procMountsPath, procCgroupPath, selfCgroupParent
+	procMountsPath, procCgroupPath, selfCgroupParent = filepath.Join(root, "mounts"), filepath.Join(root, "self-cgroup"), ""
+	t.Cleanup(func() {
+		procMountsPath, procCgroupPath, selfCgroupParent = oldMounts, oldCgroup, oldParent
+	})
+	return mount, self
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestCreateRunCgroupAppliesLimits(t *testing.T) {
+	_, self := fakeCgroupFS(t, "cpuset cpu io memory pids")
+	resources := &config.ResourcesConfig{CPUMax: "200000 100000", MemoryMax: "4G", PidsMax: 256}
+	cg, err := createRunCgroup(resources, "20260101-1200-1/x")
+	if err != nil {
+		t.Fatalf("createRunCgroup: %v", err)
+	}
+	if cg.dir != filepath.Join(self, "run-20260101-1200-1_x") {
+		t.Fatalf("unexpected cgroup dir %s", cg.dir)
+	}
+	if got := readTestFile(t, filepath.Join(self, "cgroup.subtree_control")); got != "+memory +cpu +pids" {
+		t.Fatalf("subtree_control = %q", got)
+	}
+	for file, want := range map[string]string{"cpu.max": "200000 100000", "memory.max": "4G", "pids.max": "256", "memory.oom.group": "1"} {
+		if got := readTestFile(t, filepath.Join(cg.dir, file)); got != want {
+			t.Fatalf("%s = %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestCreateRunCgroupUsesInheritedParent(t *testing.T) {
+	mount, self := fakeCgroupFS(t, "memory")
+	// The parent run's agent passes the parent of its cgroup down.
+	t.Setenv(cgroupParentEnv, "/agents")
+	if err := os.WriteFile(filepath.Join(self, "cgroup.subtree_control"), []byte("memory"), 0o644); err != nil {
+		t.Fatalf("write subtree_control: %v", err)
+	}
+	cg, err := createRunCgroup(&config.ResourcesConfig{MemoryMax: "1G"}, "child-run")
+	if err != nil {
+		t.Fatalf("createRunCgroup: %v", err)
+	}
+	if cg.dir != filepath.Join(mount, "agents", "run-child-run") {
+		t.Fatalf("child cgroup must be a sibling of the parent run's, got %s", cg.dir)
+	}
+	if _, err := os.Stat(filepath.Join(self, cgroupLeafName)); !os.IsNotExist(err) {
+		t.Fatalf("an inherited parent must not move run-agent into a leaf: %v", err)
+	}
+}
+
+func TestReleaseRunCgroupWaitsForChildRuns(t *testing.T) {
+	pgid, err := ProcessGroupID(os.Getpid())
+	if err != nil {
+		t.Fatalf("ProcessGroupID: %v", err)
+	}
+	taskDir := t.TempDir()
+	childInfo := &storage.RunInfo{RunID: "child", ParentRunID: "root", PGID: pgid, StartTime: time.Now().UTC()}
+	childPath := filepath.Join(taskDir, "runs", "child", "run-info.yaml")
+	if err := os.MkdirAll(filepath.Dir(childPath), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := storage.WriteRunInfo(childPath, childInfo); err != nil {
+		t.Fatalf("write run-info: %v", err)
+	}
+	cg := &runCgroup{dir: t.TempDir()}
+	killFile := filepath.Join(cg.dir, "cgroup.kill")
+	t.Cleanup(func() { pendingCgroups = nil })
+
+	releaseRunCgroup(cg, taskDir, &storage.RunInfo{RunID: "root"})
+	if _, err := os.Stat(killFile); !os.IsNotExist(err) {
+		t.Fatalf("cgroup with an active child run must not be killed: %v", err)
+	}
+	releasePendingCgroups()
+	if _, err := os.Stat(killFile); !os.IsNotExist(err) {
+		t.Fatalf("cgroup must stay while the child run is active: %v", err)
+	}
+
+	releaseRunCgroup(cg, taskDir, &storage.RunInfo{RunID: "root"})
+	childInfo.EndTime = time.Now().UTC()
+	if err := storage.WriteRunInfo(childPath, childInfo); err != nil {
+		t.Fatalf("write run-info: %v", err)
+	}
+	releasePendingCgroups()
+	if got := readTestFile(t, killFile); got != "1" {
+		t.Fatalf("cgroup.kill = %q after the child run finished", got)
+	}
+	if len(pendingCgroups) != 0 {
+		t.Fatalf("pending cgroups = %d", len(pendingCgroups))
+	}
+}
+
+func TestCreateRunCgroupMissingController(t *testing.T) {
+	fakeCgroupFS(t, "cpu memory")
+	_, err := createRunCgroup(&config.ResourcesConfig{PidsMax: 10}, "run-1")
+	if err == nil || !strings.Contains(err.Error(), "pids controller") {
+		t.Fatalf("expected missing pids controller error, got %v", err)
+	}
+}
+
+func TestRunCgroupUsage(t *testing.T) {
+	_, self := fakeCgroupFS(t, "memory")
+	cg, err := createRunCgroup(&config.ResourcesConfig{}, "run-1")
+	if err != nil {
+		t.Fatalf("createRunCgroup: %v", err)
+	}
+	files := map[string]string{
+		"memory.peak":   "1073741824\n",
+		"cpu.stat":      "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\nnr_periods 0\n",
+		"memory.events": "low 0\nhigh 0\nmax 12\noom 1\noom_kill 1\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(cg.dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	usage := cg.usage()
+	want := storage.ResourceUsage{
+		Cgroup:           "/agents/run-run-1",
+		PeakMemoryBytes:  1 << 30,
+		CPUSeconds:       2.5,
+		CPUUserSeconds:   2,
+		CPUSystemSeconds: 0.5,
+		OOMKills:         1,
+	}
+	if *usage != want {
+		t.Fatalf("usage = %+v, want %+v", *usage, want)
+	}
+	if !usage.OOMKilled() {
+		t.Fatalf("expected OOMKilled")
+	}
+	if _, err := os.Stat(filepath.Join(self, "run-run-1", "cpu.max")); !os.IsNotExist(err) {
+		t.Fatalf("cpu.max must not be written without cpu_max: %v", err)
+	}
+
+	line := formatResourcesLine(usage)
+	if line != "resources: OUT OF MEMORY (1 oom kill(s)), peak memory 1024.0 MiB, cpu 2.5s (user 2.0s, system 0.5s)" {
+		t.Fatalf("resources line = %q", line)
+	}
+	if got := classifyExitCode(-1, usage.OOMKilled()); !strings.Contains(got, "out of memory") {
+		t.Fatalf("classifyExitCode with OOM = %q", got)
+	}
+}
+
+func TestStartRunCgroupWithoutCgroupV2(t *testing.T) {
+	dir := t.TempDir()
+	oldMounts := procMountsPath
+	procMountsPath = filepath.Join(dir, "mounts")
+	t.Cleanup(func() { procMountsPath = oldMounts })
+	if err := os.WriteFile(procMountsPath, []byte("proc /proc proc rw 0 0\n"), 0o644); err != nil {
+		t.Fatalf("write mounts: %v", err)
+	}
+	if cg := startRunCgroup(&config.ResourcesConfig{MemoryMax: "1G"}, &storage.RunInfo{RunID: "r"}); cg != nil {
+		t.Fatalf("expected nil cgroup without cgroup v2, got %+v", cg)
+	}
+	if cg := startRunCgroup(nil, &storage.RunInfo{RunID: "r"}); cg != nil {
+		t.Fatalf("expected nil cgroup without resources config")
+	}
+}
@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/changes"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// changeSummaryMaxFiles bounds the paths listed in the RUN_STOP message.
+const changeSummaryMaxFiles = 10
+
+// startChangeCapture snapshots the working directory before the agent starts.
+// It returns nil when the snapshot fails; change capture is best-effort.
+func startChangeCapture(workingDir, runDir, busPath string, info *storage.RunInfo) *changes.Snapshot {
+	snap, err := changes.Take(workingDir, changeExcludes(workingDir, runDir, busPath)...)
+	if err != nil {
+		obslog.Log(log.Default(), "WARN", "runner", "changes_snapshot_failed",
+			obslog.F("project_id", info.ProjectID),
+			obslog.F("task_id", info.TaskID),
+			obslog.F("run_id", info.RunID),
+			obslog.F("error", err),
+		)
+		return nil
+	}
+	return snap
+}
+
+// finishChangeCapture diffs the working directory against the start snapshot
+// and writes changes.json and changes.patch to the run directory.
+func finishChangeCapture(snap *changes.Snapshot, runDir string, info *storage.RunInfo) *changes.Set {
+	if snap == nil {
+		return nil
+	}
+	set, err := changes.Capture(runDir, snap)
+	if err != nil {
+		obslog.Log(log.Default(), "WARN", "runner", "changes_capture_failed",
+			obslog.F("project_id", info.ProjectID),
+			obslog.F("task_id", info.TaskID),
+			obslog.F("run_id", info.RunID),
+			obslog.F("error", err),
+		)
+		return nil
+	}
+	return set
+}
+
+// formatChangesLine renders the changed-files line of the RUN_STOP message.
+func formatChangesLine(set *changes.Set) string {
+	if set == nil {
+		return ""
+	}
+	return "changes: " + set.Summary(changeSummaryMaxFiles)
+}
+
+// changeExcludes keeps run-agent's own files out of the change list. When the
+// working directory lives in the runs root (the task directory by default)
+// only this task's runs and message bus are skipped; otherwise the whole runs
+// root is, since it may sit inside the repository being edited.
+func changeExcludes(workingDir, runDir, busPath string) []string {
+	taskDir := filepath.Dir(filepath.Dir(runDir))
+	rootDir := filepath.Dir(filepath.Dir(taskDir))
+	if rel, err := filepath.Rel(rootDir, workingDir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return []string{filepath.Join(taskDir, "runs"), busPath}
+	}
+	return []string{rootDir}
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/changes"
+)
+
+func TestRunJobCapturesChanges(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("custom agent script uses sh")
+	}
+	root := t.TempDir()
+	script := filepath.Join(root, "agent.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho hi > hello.txt\necho done\n"), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	configPath := filepath.Join(root, "config.yaml")
+	configContent := `agents:
+  scripted:
+    type: custom
+    command: ["` + script + `"]
+
+defaults:
+  agent: scripted
+  timeout: 10
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	info, err := runJob("project", "task", JobOptions{
+		RootDir:    root,
+		ConfigPath: configPath,
+		Prompt:     "write a file",
+	})
+	if err != nil {
+		t.Fatalf("runJob: %v", err)
+	}
+	taskDir := filepath.Join(root, "project", "task")
+	runDir := filepath.Join(taskDir, "runs", info.RunID)
+	set, err := changes.Read(runDir)
+	if err != nil {
+		t.Fatalf("read changes: %v", err)
+	}
+	// The run's own files and the task message bus are not agent changes.
+	if len(set.Files) != 1 || set.Files[0].Path != "hello.txt" || set.Files[0].Status != changes.StatusAdded {
+		t.Fatalf("unexpected changes: %+v", set.Files)
+	}
+	bus, err := os.ReadFile(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("read bus: %v", err)
+	}
+	if !strings.Contains(string(bus), "changes: 1 file changed: hello.txt") {
+		t.Fatalf("expected change summary in RUN_STOP, got:\n%s", bus)
+	}
+}
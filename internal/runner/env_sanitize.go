@@ -2,30 +2,20 @@ package runner
 
 import (
 	"strings"
-)
 
-// allAgentAPIKeys lists all known per-agent API key environment variable names.
-// When launching an agent, only the key for the target agent type is allowed through.
-var allAgentAPIKeys = []string{
-	"OPENAI_API_KEY",
-	"ANTHROPIC_API_KEY",
-	"GEMINI_API_KEY",
-	"PERPLEXITY_API_KEY",
-	"XAI_API_KEY",
-	"OPENAI_ORG_ID",
-}
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+)
 
 // sanitizeEnvForAgent strips foreign API keys from the environment before
-// passing it to an agent subprocess. Only the key relevant to agentType is
-// kept; all other agent API keys are removed.
+// passing it to an agent subprocess. Only the keys owned by desc are kept;
+// the keys of every other registered agent are removed.
 //
 // System path vars, JRUN_* vars, and the conductor-loop internal vars are
 // always preserved. Keys and their names are logged at debug level by the
 // caller; values are never logged.
-func sanitizeEnvForAgent(agentType string, env []string) []string {
-	allowedAgentKey := tokenEnvVar(agentType)
-	// also allow codex org key when running codex
-	allowOrgKey := strings.EqualFold(agentType, "codex")
+func sanitizeEnvForAgent(desc agent.Descriptor, env []string) []string {
+	knownKeys := agent.TokenEnvVars()
+	allowedKeys := desc.TokenEnvVars()
 
 	result := make([]string, 0, len(env))
 	for _, entry := range env {
@@ -34,7 +24,7 @@ func sanitizeEnvForAgent(agentType string, env []string) []string {
 			continue
 		}
 		key := parts[0]
-		if isForeignAgentAPIKey(key, allowedAgentKey, allowOrgKey) {
+		if isForeignAgentAPIKey(key, knownKeys, allowedKeys) {
 			continue
 		}
 		result = append(result, entry)
@@ -45,19 +35,15 @@ func sanitizeEnvForAgent(agentType string, env []string) []string {
 // isForeignAgentAPIKey returns true if key is a known agent API key that
 // should NOT be passed to the current agent (i.e., it belongs to a different
 // agent type).
-func isForeignAgentAPIKey(key, allowedKey string, allowOrgKey bool) bool {
-	for _, k := range allAgentAPIKeys {
-		if !strings.EqualFold(key, k) {
-			continue
-		}
-		// It's a known agent key — allow it only if it's the designated key.
-		if strings.EqualFold(key, allowedKey) {
-			return false
-		}
-		if allowOrgKey && strings.EqualFold(key, "OPENAI_ORG_ID") {
-			return false
+func isForeignAgentAPIKey(key string, knownKeys, allowedKeys []string) bool {
+	return containsFold(knownKeys, key) && !containsFold(allowedKeys, key)
+}
+
+func containsFold(values []string, want string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, want) {
+			return true
 		}
-		return true
 	}
 	return false
 }
@@ -3,6 +3,8 @@ package runner
 import (
 	"strings"
 	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
 )
 
 func TestSanitizeEnvForAgent_Claude(t *testing.T) {
@@ -18,7 +20,7 @@ func TestSanitizeEnvForAgent_Claude(t *testing.T) {
 		"MY_CUSTOM_VAR=foo",
 	}
 
-	result := sanitizeEnvForAgent("claude", fullEnv)
+	result := sanitizeEnvForAgent(mustDescriptor(t, "claude"), fullEnv)
 
 	envMap := envSliceToMap(result)
 
@@ -49,7 +51,7 @@ func TestSanitizeEnvForAgent_Codex(t *testing.T) {
 		"GEMINI_API_KEY=gemini-secret",
 	}
 
-	result := sanitizeEnvForAgent("codex", fullEnv)
+	result := sanitizeEnvForAgent(mustDescriptor(t, "codex"), fullEnv)
 	envMap := envSliceToMap(result)
 
 	if _, ok := envMap["OPENAI_API_KEY"]; !ok {
@@ -74,7 +76,7 @@ func TestSanitizeEnvForAgent_UnknownAgent(t *testing.T) {
 		"MY_VAR=value",
 	}
 
-	result := sanitizeEnvForAgent("unknown-agent", fullEnv)
+	result := sanitizeEnvForAgent(agent.Descriptor{Type: "unknown-agent"}, fullEnv)
 	envMap := envSliceToMap(result)
 
 	// Unknown agent has no allowed key, so all known API keys are stripped.
@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+)
+
+// readTaskInbox returns the directed messages for the task that no earlier
+// run has seen. It is best-effort: a broken bus must not block the run.
+func readTaskInbox(busPath, projectID, taskID, runID string) []*messagebus.Message {
+	bus, err := messagebus.Open(busPath, "")
+	if err == nil {
+		defer bus.Close()
+		var inbox []*messagebus.Message
+		if inbox, err = bus.ReadInbox(taskID, runID, true); err == nil {
+			return inbox
+		}
+	}
+	obslog.Log(log.Default(), "WARN", "runner", "inbox_read_failed",
+		obslog.F("project_id", projectID),
+		obslog.F("task_id", taskID),
+		obslog.F("run_id", runID),
+		obslog.F("error", err),
+	)
+	return nil
+}
+
+// ackTaskInbox marks inbox as delivered once it was written into a prompt.
+func ackTaskInbox(busPath, projectID, taskID, runID string, inbox []*messagebus.Message) {
+	if len(inbox) == 0 {
+		return
+	}
+	bus, err := messagebus.Open(busPath, "")
+	if err == nil {
+		_, err = bus.Ack(messagebus.InboxConsumer, inbox[len(inbox)-1].MsgID)
+		bus.Close()
+	}
+	if err != nil {
+		obslog.Log(log.Default(), "WARN", "runner", "inbox_ack_failed",
+			obslog.F("project_id", projectID),
+			obslog.F("task_id", taskID),
+			obslog.F("run_id", runID),
+			obslog.F("error", err),
+		)
+		return
+	}
+	obslog.Log(log.Default(), "INFO", "runner", "inbox_delivered",
+		obslog.F("project_id", projectID),
+		obslog.F("task_id", taskID),
+		obslog.F("run_id", runID),
+		obslog.F("messages", len(inbox)),
+	)
+}
+
+// writeInbox renders the inbox section of a run prompt.
+func writeInbox(b *strings.Builder, inbox []*messagebus.Message) {
+	if len(inbox) == 0 {
+		return
+	}
+	b.WriteString("\n## Inbox\n")
+	b.WriteString("Messages sent directly to this task since its previous run (oldest first).\n")
+	b.WriteString("They take precedence over the original task description where they conflict.\n")
+	for _, msg := range inbox {
+		sender := msg.ProjectID
+		if msg.TaskID != "" {
+			sender = msg.TaskID
+		}
+		if msg.RunID != "" {
+			sender += "/" + msg.RunID
+		}
+		fmt.Fprintf(b, "\n[%s] %s from %s (%s):\n", msg.Timestamp.UTC().Format("2006-01-02 15:04:05"), msg.Type, sender, msg.MsgID)
+		b.WriteString(strings.TrimSpace(msg.Body))
+		b.WriteString("\n")
+	}
+}
@@ -0,0 +1,89 @@
+package runner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/jonnyzzz/conductor-loop/internal/worktree"
+	"github.com/pkg/errors"
+)
+
+// resolveIsolation returns the working directory for a run of the task.
+// With worktree isolation the task worktree is created on first use and
+// reused by later runs. An empty isolation mode inherits an existing task
+// worktree so restarts and resumes stay on the task branch.
+func resolveIsolation(taskDir, taskID, workingDir, isolation, onDone string) (string, *worktree.Info, error) {
+	mode := worktree.ModeNone
+	if strings.TrimSpace(isolation) == "" {
+		existing, err := worktree.Read(taskDir)
+		if err != nil {
+			return "", nil, err
+		}
+		if existing != nil && !existing.Removed {
+			mode = worktree.ModeWorktree
+		}
+	} else {
+		var err error
+		if mode, err = worktree.NormalizeMode(isolation); err != nil {
+			return "", nil, err
+		}
+	}
+	if mode == worktree.ModeNone {
+		return workingDir, nil, nil
+	}
+	info, err := worktree.Ensure(taskDir, taskID, workingDir, onDone)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "prepare task worktree")
+	}
+	return info.WorkingDir(), info, nil
+}
+
+// completeIsolation applies the on-done policy of the task worktree once the
+// task is DONE and reports the outcome on the task message bus. Failures
+// leave the branch in place and are reported, not returned.
+func completeIsolation(taskDir, busPath, projectID, taskID string) {
+	if _, err := os.Stat(filepath.Join(taskDir, "DONE")); err != nil {
+		return
+	}
+	info, err := worktree.Complete(taskDir, taskID)
+	if info == nil && err == nil {
+		return
+	}
+	msg := &storage.RunInfo{ProjectID: projectID, TaskID: taskID}
+	if err != nil {
+		obslog.Log(log.Default(), "ERROR", "runner", "worktree_complete_failed",
+			obslog.F("project_id", projectID),
+			obslog.F("task_id", taskID),
+			obslog.F("error", err),
+		)
+		body := fmt.Sprintf("task worktree completion failed: %v", err)
+		if info != nil {
+			body = fmt.Sprintf("task worktree %s policy failed, branch %s left in place: %v", info.OnDone, info.Branch, err)
+		}
+		_ = postRunEvent(busPath, msg, "ERROR", body)
+		return
+	}
+	var body string
+	switch info.Outcome {
+	case worktree.OutcomeMerged:
+		body = fmt.Sprintf("task branch %s merged into %s", info.Branch, info.BaseBranch)
+	case worktree.OutcomeRebased:
+		body = fmt.Sprintf("task branch %s rebased onto %s and fast-forwarded", info.Branch, info.BaseBranch)
+	case worktree.OutcomeEmpty:
+		body = fmt.Sprintf("task branch %s had no changes; worktree removed", info.Branch)
+	default:
+		body = fmt.Sprintf("task branch %s left for review in %s", info.Branch, info.Path)
+	}
+	obslog.Log(log.Default(), "INFO", "runner", "worktree_completed",
+		obslog.F("project_id", projectID),
+		obslog.F("task_id", taskID),
+		obslog.F("branch", info.Branch),
+		obslog.F("outcome", info.Outcome),
+	)
+	_ = postRunEvent(busPath, msg, "FACT", body)
+}
@@ -0,0 +1,107 @@
+package runner
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/jonnyzzz/conductor-loop/internal/worktree"
+)
+
+func TestRunJobWorktreeIsolationMerge(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("custom agent script uses sh")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		args = append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "-b", "main")
+	if err := os.WriteFile(filepath.Join(repo, "README"), []byte("readme\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+	base := git("rev-parse", "HEAD")
+
+	root := t.TempDir()
+	// The agent edits its working directory and marks the task DONE.
+	script := filepath.Join(root, "agent.sh")
+	content := "#!/bin/sh\npwd > where.txt\ntouch \"$JRUN_TASK_FOLDER/DONE\"\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	configPath := filepath.Join(root, "config.yaml")
+	configContent := `agents:
+  scripted:
+    type: custom
+    command: ["` + script + `"]
+
+defaults:
+  agent: scripted
+  timeout: 10
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	opts := JobOptions{
+		RootDir:    root,
+		ConfigPath: configPath,
+		Prompt:     "edit",
+		WorkingDir: repo,
+		Isolation:  worktree.ModeWorktree,
+		OnDone:     worktree.PolicyMerge,
+	}
+	if err := RunJob("project", "task-1", opts); err != nil {
+		t.Fatalf("RunJob: %v", err)
+	}
+
+	taskDir := filepath.Join(root, "project", "task-1")
+	runs, err := os.ReadDir(filepath.Join(taskDir, "runs"))
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one run, got %v (%v)", runs, err)
+	}
+	info, err := storage.ReadRunInfo(filepath.Join(taskDir, "runs", runs[0].Name(), "run-info.yaml"))
+	if err != nil {
+		t.Fatalf("read run-info: %v", err)
+	}
+	if info.WorktreeBranch != "run-agent/task-1" || info.WorktreeBaseCommit != base {
+		t.Fatalf("unexpected worktree fields: branch=%q base=%q", info.WorktreeBranch, info.WorktreeBaseCommit)
+	}
+	if !strings.HasPrefix(info.CWD, filepath.Join(taskDir, worktree.DirName)) {
+		t.Fatalf("run cwd %q is not the task worktree", info.CWD)
+	}
+
+	where, err := os.ReadFile(filepath.Join(repo, "where.txt"))
+	if err != nil {
+		t.Fatalf("agent change was not merged: %v", err)
+	}
+	if !strings.Contains(string(where), worktree.DirName) {
+		t.Fatalf("agent did not run in the worktree: %s", where)
+	}
+	wt, err := worktree.Read(taskDir)
+	if err != nil || wt == nil || wt.Outcome != worktree.OutcomeMerged {
+		t.Fatalf("worktree metadata = %+v, %v", wt, err)
+	}
+	bus, err := os.ReadFile(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("read bus: %v", err)
+	}
+	if !strings.Contains(string(bus), "merged into main") {
+		t.Fatalf("expected merge fact on the bus, got:\n%s", bus)
+	}
+}
@@ -2,21 +2,16 @@ package runner
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/jonnyzzz/conductor-loop/internal/agent"
-	"github.com/jonnyzzz/conductor-loop/internal/agent/claude"
-	"github.com/jonnyzzz/conductor-loop/internal/agent/codex"
-	"github.com/jonnyzzz/conductor-loop/internal/agent/gemini"
-	"github.com/jonnyzzz/conductor-loop/internal/agent/perplexity"
-	"github.com/jonnyzzz/conductor-loop/internal/agent/xai"
+	"github.com/jonnyzzz/conductor-loop/internal/changes"
 	"github.com/jonnyzzz/conductor-loop/internal/config"
 	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 	"github.com/jonnyzzz/conductor-loop/internal/obslog"
@@ -39,17 +34,21 @@ type JobOptions struct {
 	PreallocatedRunDir string        // optional: pre-created run directory; skip createRunDir if set
 	Timeout            time.Duration // idle output timeout for CLI agents; 0 means no limit
 	ConductorURL       string        // e.g. "http://127.0.0.1:14355"; if empty, derived from config
+	// Isolation selects the task working copy: "none" or "worktree". Empty
+	// reuses an existing task worktree, if any.
+	Isolation string
+	// OnDone is the worktree policy applied when the task is DONE:
+	// "branch" (default), "merge" or "rebase".
+	OnDone string
+	// Budget caps the task subtree while this run is in flight. Unlike task
+	// loops, jobs do not fall back to defaults.budget.
+	Budget Budget
 
 	// preselectedAgent bypasses the selectAgent() call inside runJob when set.
 	// Used internally by the diversification fallback path.
 	preselectedAgent *agentSelection
 }
 
-var (
-	geminiStreamJSONOnce sync.Once
-	geminiStreamJSONErr  error
-)
-
 // RunJob starts a single agent run and waits for completion.
 // When the loaded config has diversification enabled and FallbackOnFailure is
 // true, a single retry with the next policy agent is attempted on failure.
@@ -82,13 +81,18 @@ func RunJob(projectID, taskID string, opts JobOptions) error {
 		opts.preselectedAgent = initial
 	}
 
-	_, runErr := runJob(projectID, taskID, opts)
+	// Runs whose children outlive them keep their cgroup until here.
+	defer releasePendingCgroups()
+
+	info, runErr := runJob(projectID, taskID, opts)
 	if runErr == nil {
+		completeJobIsolation(info, opts)
 		return nil
 	}
 
-	// Fallback: try next agent in policy when enabled.
-	if policy == nil || !policy.cfg.FallbackOnFailure || initial == nil {
+	// Fallback: try next agent in policy when enabled. A budget breach is not
+	// an agent failure, so it is not retried.
+	if policy == nil || !policy.cfg.FallbackOnFailure || initial == nil || stderrors.Is(runErr, ErrBudgetExceeded) {
 		return runErr
 	}
 
@@ -111,10 +115,30 @@ func RunJob(projectID, taskID string, opts JobOptions) error {
 	fbOpts.PreallocatedRunDir = ""
 	fbOpts.preselectedAgent = &fallback
 
-	_, runErr = runJob(projectID, taskID, fbOpts)
+	info, runErr = runJob(projectID, taskID, fbOpts)
+	if runErr == nil {
+		completeJobIsolation(info, fbOpts)
+	}
 	return runErr
 }
 
+// completeJobIsolation applies the worktree on-done policy after a
+// standalone job whose task is DONE.
+func completeJobIsolation(info *storage.RunInfo, opts JobOptions) {
+	if info == nil || info.WorktreeBranch == "" {
+		return
+	}
+	rootDir, err := resolveRootDir(opts.RootDir)
+	if err != nil {
+		return
+	}
+	taskDir, err := resolveTaskDir(rootDir, info.ProjectID, info.TaskID)
+	if err != nil {
+		return
+	}
+	completeIsolation(taskDir, filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"), info.ProjectID, info.TaskID)
+}
+
 // diversificationCfgFrom returns the DiversificationConfig from the given
 // Config, or nil when cfg is nil.
 func diversificationCfgFrom(cfg *config.Config) *config.DiversificationConfig {
@@ -176,6 +200,10 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 	if err != nil {
 		return nil, errors.Wrap(err, "resolve working dir")
 	}
+	workingDir, taskWorktree, err := resolveIsolation(taskDir, taskID, workingDir, opts.Isolation, opts.OnDone)
+	if err != nil {
+		return nil, err
+	}
 
 	busPath := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
 
@@ -189,6 +217,11 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 	if err != nil {
 		return nil, err
 	}
+	if cfg != nil {
+		projectBusPath := filepath.Join(filepath.Dir(taskDir), "PROJECT-MESSAGE-BUS.md")
+		SyncBusSchemaPolicy(cfg.MessageBus, busPath, projectBusPath)
+		initBusBackend(cfg.Storage.BusBackend, busPath, projectBusPath)
+	}
 
 	// Honour a pre-selected agent from the diversification policy; otherwise
 	// fall through to the standard agent selection logic.
@@ -208,6 +241,10 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 	if agentType == "" {
 		return nil, errors.New("agent type is empty")
 	}
+	desc, err := agentDescriptor(selection, agentType)
+	if err != nil {
+		return nil, err
+	}
 	if tokenErr := ValidateToken(agentType, selection.Config.Token); tokenErr != nil {
 		obslog.Log(logger, "WARN", "runner", "agent_token_validation_warning",
 			obslog.F("project_id", projectID),
@@ -218,6 +255,21 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 	}
 
 	parentRunID := strings.TrimSpace(opts.ParentRunID)
+	if err := checkBudgetAncestry(taskDir, parentRunID); err != nil {
+		refused := &storage.RunInfo{ProjectID: projectID, TaskID: taskID}
+		_ = postRunEvent(busPath, refused, messagebus.EventTypeBudgetExceeded, fmt.Sprintf("run refused: %v", err))
+		return nil, err
+	}
+	var guard *budgetGuard
+	if !opts.Budget.IsZero() {
+		taskEvent := &storage.RunInfo{ProjectID: projectID, TaskID: taskID}
+		guard = newBudgetGuard(opts.Budget, taskDir, projectID, taskID, defaultRalphPollInterval, func(msgType, body string) error {
+			return postRunEvent(busPath, taskEvent, msgType, body)
+		})
+		if err := guard.enforce(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Create the run directory and write a sentinel run-info.yaml BEFORE
 	// detectAgentVersion. detectAgentVersion spawns a subprocess that can take
@@ -276,7 +328,7 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 	// detectAgentVersion spawns an external process and is best-effort.
 	agentVersion := detectAgentVersion(context.Background(), agentType)
 
-	restAgent := isRestAgent(agentType)
+	restAgent := desc.REST
 	ctx := context.Background()
 	if restAgent && opts.Timeout > 0 {
 		var cancel context.CancelFunc
@@ -325,6 +377,7 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 	repoRoot := filepath.Dir(rootDir)
 
 	promptPath := filepath.Join(runDir, "prompt.md")
+	inbox := readTaskInbox(busPath, projectID, taskID, runID)
 	promptContent := buildPrompt(PromptParams{
 		TaskDir:        taskDir,
 		RunDir:         runDir,
@@ -335,10 +388,12 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 		MessageBusPath: busPath,
 		ConductorURL:   conductorURL,
 		RepoRoot:       repoRoot,
+		Inbox:          inbox,
 	}, promptText)
 	if err := os.WriteFile(promptPath, []byte(promptContent), 0o644); err != nil {
 		return nil, errors.Wrap(err, "write prompt")
 	}
+	ackTaskInbox(busPath, projectID, taskID, runID, inbox)
 	obslog.Log(logger, "INFO", "runner", "run_prepared",
 		obslog.F("project_id", projectID),
 		obslog.F("task_id", taskID),
@@ -357,19 +412,19 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 	warnJRunEnvMismatch(projectID, taskID, runID, parentRunID)
 
 	envOverrides := map[string]string{
-		"JRUN_PROJECT_ID": projectID,
-		"JRUN_TASK_ID":    taskID,
-		"JRUN_ID":         runID,
-		"JRUN_PARENT_ID":  parentRunID,
-		"JRUN_RUNS_DIR":        runsDir,
-		"JRUN_MESSAGE_BUS":     busPath,
-		"JRUN_TASK_FOLDER":     taskDir,
-		"JRUN_RUN_FOLDER":      runDir,
+		"JRUN_PROJECT_ID":  projectID,
+		"JRUN_TASK_ID":     taskID,
+		"JRUN_ID":          runID,
+		"JRUN_PARENT_ID":   parentRunID,
+		"JRUN_RUNS_DIR":    runsDir,
+		"JRUN_MESSAGE_BUS": busPath,
+		"JRUN_TASK_FOLDER": taskDir,
+		"JRUN_RUN_FOLDER":  runDir,
 	}
 	if conductorURL != "" {
 		envOverrides["JRUN_CONDUCTOR_URL"] = conductorURL
 	}
-	if tokenVar := tokenEnvVar(agentType); tokenVar != "" {
+	if tokenVar := desc.TokenEnvVar; tokenVar != "" {
 		if token := strings.TrimSpace(selection.Config.Token); token != "" {
 			envOverrides[tokenVar] = token
 		}
@@ -386,7 +441,7 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 
 	env := mergeEnv(os.Environ(), envOverrides)
 	env = removeEnvKeys(env, "CLAUDECODE")
-	env = sanitizeEnvForAgent(agentType, env)
+	env = sanitizeEnvForAgent(desc, env)
 
 	runDirAbs, err := absPath(runDir)
 	if err != nil {
@@ -416,14 +471,33 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 		StdoutPath:       stdoutPathAbs,
 		StderrPath:       stderrPathAbs,
 	}
+	if taskWorktree != nil {
+		info.WorktreeBranch = taskWorktree.Branch
+		info.WorktreeBaseCommit = taskWorktree.BaseCommit
+	}
+	var sandbox *config.SandboxConfig
+	var resources *config.ResourcesConfig
+	if cfg != nil && !restAgent {
+		sandbox = config.ResolveSandbox(cfg.Defaults.Sandbox, selection.Config.Sandbox)
+		resources = sandboxResources(cfg.Defaults.Resources, sandbox)
+	}
+	if sandbox.Enabled() {
+		info.Sandbox = sandbox.ModeName()
+	}
 
+	price := usagePricer(cfg, selection, agentType)
 	timedOut := false
 	var execErr error
+	stopWatch := guard.watch()
 	if restAgent {
-		execErr = executeREST(ctx, agentType, selection, promptContent, workingDir, env, runDir, busPath, info)
+		execErr = executeREST(ctx, desc, restSettings(selection, opts.ConfigPath), promptContent, workingDir, env, runDir, busPath, info, price)
 		timedOut = opts.Timeout > 0 && ctx.Err() == context.DeadlineExceeded
 	} else {
-		timedOut, execErr = executeCLI(ctx, agentType, promptPathAbs, workingDir, env, runDir, busPath, info, opts.Timeout)
+		timedOut, execErr = executeCLI(ctx, desc, promptPathAbs, workingDir, env, runDir, busPath, info, price, sandbox, resources, opts.Timeout)
+	}
+	stopWatch()
+	if reason := guard.reason(); reason != "" {
+		execErr = errors.Wrap(ErrBudgetExceeded, reason)
 	}
 
 	if timedOut {
@@ -455,6 +529,10 @@ func runJob(projectID, taskID string, opts JobOptions) (*storage.RunInfo, error)
 			StoppedAt:       info.EndTime,
 			DurationSeconds: info.EndTime.Sub(info.StartTime).Seconds(),
 			ErrorSummary:    info.ErrorSummary,
+			Usage:           info.Usage,
+		}
+		if changeSet, err := changes.Read(runDir); err == nil {
+			payload.Changes = changeSet
 		}
 		notifier.SendRunStop(payload, func(err error) {
 			_ = postRunEvent(busPath, info, "WARN", fmt.Sprintf("webhook delivery failed: %v", err))
@@ -495,40 +573,78 @@ func resolvePrompt(opts JobOptions) (string, error) {
 	return "", errors.New("prompt is empty")
 }
 
-func isRestAgent(agentType string) bool {
-	switch strings.ToLower(agentType) {
-	case "perplexity", "xai":
-		return true
-	default:
-		return false
-	}
-}
-
-func executeCLI(ctx context.Context, agentType, promptPath, workingDir string, env []string, runDir, busPath string, info *storage.RunInfo, idleOutputTimeout time.Duration) (bool, error) {
-	command, args, err := commandForAgent(agentType)
+func executeCLI(ctx context.Context, desc agent.Descriptor, promptPath, workingDir string, env []string, runDir, busPath string, info *storage.RunInfo, price func(*storage.Usage), sandbox *config.SandboxConfig, resources *config.ResourcesConfig, idleOutputTimeout time.Duration) (bool, error) {
+	command, err := commandForAgent(desc, agent.Invocation{
+		PromptPath: promptPath,
+		RunDir:     filepath.Dir(promptPath),
+		WorkingDir: workingDir,
+	})
 	if err != nil {
 		return false, err
 	}
-	promptFile, err := os.Open(promptPath)
+	wrapped, err := wrapSandbox(sandbox, sandboxRequest{
+		Path:        command.Path,
+		Args:        command.Args,
+		WorkingDir:  workingDir,
+		RunDir:      runDir,
+		BusPath:     busPath,
+		Env:         env,
+		TokenVars:   desc.TokenEnvVars(),
+		ConfigPaths: desc.ConfigPaths,
+		Info:        info,
+	})
 	if err != nil {
-		return false, errors.Wrap(err, "open prompt")
+		return false, err
+	}
+	if wrapped.cleanup != nil {
+		defer wrapped.cleanup()
+	}
+	var promptFile *os.File
+	if command.PromptOnStdin {
+		promptFile, err = os.Open(promptPath)
+		if err != nil {
+			return false, errors.Wrap(err, "open prompt")
+		}
+	}
+	closePrompt := func() {
+		if promptFile != nil {
+			_ = promptFile.Close()
+		}
 	}
 	pm, err := NewProcessManager(runDir)
 	if err != nil {
-		_ = promptFile.Close()
+		closePrompt()
 		return false, err
 	}
 	processCtx, processCancel := context.WithCancel(ctx)
 	defer processCancel()
 
-	proc, err := pm.SpawnAgent(processCtx, agentType, SpawnOptions{
-		Command: command,
-		Args:    args,
+	spawnOpts := SpawnOptions{
+		Command: wrapped.Path,
+		Args:    wrapped.Args,
 		Dir:     workingDir,
 		Env:     env,
-		Stdin:   promptFile,
-	})
-	_ = promptFile.Close()
+	}
+	if promptFile != nil {
+		spawnOpts.Stdin = promptFile
+	}
+	snapshot := startChangeCapture(workingDir, runDir, busPath, info)
+	cgroup := startRunCgroup(resources, info)
+	if cgroup != nil {
+		spawnOpts.CgroupDir = cgroup.dir
+		spawnOpts.Env = mergeEnv(env, map[string]string{cgroupParentEnv: filepath.Dir(cgroup.dir)})
+	}
+	proc, err := pm.SpawnAgent(processCtx, desc.Type, spawnOpts)
+	if err != nil && cgroup != nil {
+		// Run without limits rather than not at all.
+		logCgroupWarning("cgroup_attach_failed", info, err)
+		dropRunCgroup(cgroup, info)
+		cgroup = nil
+		spawnOpts.CgroupDir = ""
+		spawnOpts.Env = env
+		proc, err = pm.SpawnAgent(processCtx, desc.Type, spawnOpts)
+	}
+	closePrompt()
 	if err != nil {
 		pid := os.Getpid()
 		pgid := pid
@@ -545,9 +661,15 @@ func executeCLI(ctx context.Context, agentType, promptPath, workingDir string, e
 		}
 		return false, errors.Wrap(err, "spawn agent")
 	}
+	if cgroup != nil {
+		defer releaseRunCgroup(cgroup, filepath.Dir(filepath.Dir(runDir)), info)
+	}
 	info.PID = proc.PID
 	info.PGID = proc.PGID
-	info.CommandLine = fmt.Sprintf("%s %s < %s", command, strings.Join(args, " "), promptPath)
+	info.CommandLine = strings.TrimSpace(wrapped.Path + " " + strings.Join(wrapped.Args, " "))
+	if command.PromptOnStdin {
+		info.CommandLine += " < " + promptPath
+	}
 	if err := storage.WriteRunInfo(filepath.Join(runDir, "run-info.yaml"), info); err != nil {
 		_ = proc.Cmd.Process.Kill()
 		_ = proc.Wait()
@@ -566,7 +688,11 @@ func executeCLI(ctx context.Context, agentType, promptPath, workingDir string, e
 		return false, err
 	}
 
+	follower := startTranscript(desc, runDir, info)
 	waitErr, idleTimedOut := waitForProcessWithIdleOutputTimeout(processCtx, processCancel, proc, idleOutputTimeout)
+	if cgroup != nil {
+		info.Resources = cgroup.usage()
+	}
 	exitCode := 0
 	if proc.Cmd.ProcessState != nil {
 		exitCode = proc.Cmd.ProcessState.ExitCode()
@@ -582,48 +708,60 @@ func executeCLI(ctx context.Context, agentType, promptPath, workingDir string, e
 		if idleTimedOut {
 			info.ErrorSummary = "timed out"
 		} else {
-			info.ErrorSummary = classifyExitCode(exitCode)
+			info.ErrorSummary = classifyExitCode(exitCode, info.Resources.OOMKilled())
 		}
 	}
 	// For stream-json CLI agents: extract clean text from JSON stream before
 	// writing the final run-info status. Parsing happens before the UpdateRunInfo
 	// write so that status is set exactly once with the definitive value.
-	switch strings.ToLower(agentType) {
-	case "claude":
-		if parseErr := claude.WriteOutputMDFromStream(runDir, info.StdoutPath); parseErr != nil {
-			obslog.Log(log.Default(), "WARN", "runner", "output_parse_fallback",
-				obslog.F("project_id", info.ProjectID),
-				obslog.F("task_id", info.TaskID),
-				obslog.F("run_id", info.RunID),
-				obslog.F("agent_type", info.AgentType),
-				obslog.F("error", parseErr),
-			)
-			placeholder := "# Agent Output\n\n*The agent did not write output.md. Raw output is available in the stdout tab.*\n"
-			_ = os.WriteFile(filepath.Join(runDir, "output.md"), []byte(placeholder), 0o644)
-		}
-	case "codex":
-		_ = codex.WriteOutputMDFromStream(runDir, info.StdoutPath)
-	case "gemini":
-		if parseErr := gemini.WriteOutputMDFromStream(runDir, info.StdoutPath); parseErr != nil {
-			if isGeminiStreamJSONFlagError(info.StderrPath) {
-				obslog.Log(log.Default(), "ERROR", "runner", "gemini_stream_json_rejected",
+	if desc.WriteOutput != nil {
+		if parseErr := desc.WriteOutput(runDir, info.StdoutPath); parseErr != nil {
+			summary := ""
+			if desc.OutputFailure != nil {
+				summary = desc.OutputFailure(info.StderrPath)
+			}
+			if summary == "" {
+				obslog.Log(log.Default(), "WARN", "runner", "output_parse_fallback",
+					obslog.F("project_id", info.ProjectID),
+					obslog.F("task_id", info.TaskID),
+					obslog.F("run_id", info.RunID),
+					obslog.F("agent_type", info.AgentType),
+					obslog.F("error", parseErr),
+				)
+			} else {
+				obslog.Log(log.Default(), "ERROR", "runner", "output_parse_failed",
+					obslog.F("project_id", info.ProjectID),
+					obslog.F("task_id", info.TaskID),
 					obslog.F("run_id", info.RunID),
-					obslog.F("reason", "Gemini CLI rejected --output-format stream-json even after version check passed. Please update your Gemini CLI."),
+					obslog.F("agent_type", info.AgentType),
+					obslog.F("reason", summary),
 					obslog.F("error", parseErr),
 				)
 				waitErr = parseErr
 				exitCode = 1
 				info.ExitCode = exitCode
 				info.Status = storage.StatusFailed
-				info.ErrorSummary = "gemini CLI rejected --output-format stream-json"
+				info.ErrorSummary = summary
 			}
 		}
 	}
+	info.Usage = parseCLIUsage(desc, info.StdoutPath)
+	if price != nil {
+		price(info.Usage)
+	}
+	transcriptErr := ""
+	if info.Status == storage.StatusFailed {
+		transcriptErr = info.ErrorSummary
+	}
+	follower.finish(info.Usage, transcriptErr)
+	changeSet := finishChangeCapture(snapshot, runDir, info)
 	if err := storage.UpdateRunInfo(filepath.Join(runDir, "run-info.yaml"), func(update *storage.RunInfo) error {
 		update.ExitCode = info.ExitCode
 		update.EndTime = info.EndTime
 		update.Status = info.Status
 		update.ErrorSummary = info.ErrorSummary
+		update.Usage = info.Usage
+		update.Resources = info.Resources
 		return nil
 	}); err != nil {
 		return idleTimedOut, errors.Wrap(err, "update run-info")
@@ -636,6 +774,15 @@ func executeCLI(ctx context.Context, agentType, promptPath, workingDir string, e
 		runDir,
 		info.OutputPath,
 	)
+	if usageLine := formatUsageLine(info.Usage); usageLine != "" {
+		stopBody += "\n" + usageLine
+	}
+	if changesLine := formatChangesLine(changeSet); changesLine != "" {
+		stopBody += "\n" + changesLine
+	}
+	if resourcesLine := formatResourcesLine(info.Resources); resourcesLine != "" {
+		stopBody += "\n" + resourcesLine
+	}
 	if info.Status == storage.StatusFailed {
 		if excerpt := tailFile(info.StderrPath, 50); excerpt != "" {
 			stopBody += "\n\n## stderr (last 50 lines)\n" + excerpt
@@ -715,7 +862,7 @@ func fileSize(path string) int64 {
 	return stat.Size()
 }
 
-func executeREST(ctx context.Context, agentType string, selection agentSelection, promptContent, workingDir string, env []string, runDir, busPath string, info *storage.RunInfo) error {
+func executeREST(ctx context.Context, desc agent.Descriptor, settings agent.Settings, promptContent, workingDir string, env []string, runDir, busPath string, info *storage.RunInfo, price func(*storage.Usage)) error {
 	pid := os.Getpid()
 	pgid := pid
 	if resolved, err := ProcessGroupID(pid); err == nil {
@@ -748,27 +895,26 @@ func executeREST(ctx context.Context, agentType string, selection agentSelection
 		StderrPath:  info.StderrPath,
 		Environment: envMap(env),
 	}
-	switch strings.ToLower(agentType) {
-	case "perplexity":
-		agentImpl := perplexity.NewPerplexityAgent(perplexity.Options{
-			Token:       selection.Config.Token,
-			Model:       selection.Config.Model,
-			APIEndpoint: selection.Config.BaseURL,
-		})
-		execErr = agentImpl.Execute(ctx, runCtx)
-	case "xai":
-		agentImpl, err := xai.NewAgent(xai.Config{
-			APIKey:  selection.Config.Token,
-			BaseURL: selection.Config.BaseURL,
-			Model:   selection.Config.Model,
-		})
-		if err != nil {
-			return err
-		}
-		execErr = agentImpl.Execute(ctx, runCtx)
-	default:
-		return fmt.Errorf("unsupported rest agent %q", agentType)
+	if desc.NewAgent == nil {
+		return fmt.Errorf("unsupported rest agent %q", desc.Type)
+	}
+	agentImpl, err := desc.NewAgent(settings)
+	if err != nil {
+		return err
+	}
+	follower := startTranscript(desc, runDir, info)
+	snapshot := startChangeCapture(workingDir, runDir, busPath, info)
+	execErr = agentImpl.Execute(ctx, runCtx)
+	info.Usage = restUsage(agentImpl)
+	if price != nil {
+		price(info.Usage)
+	}
+	transcriptErr := ""
+	if execErr != nil {
+		transcriptErr = execErr.Error()
 	}
+	follower.finish(info.Usage, transcriptErr)
+	finishChangeCapture(snapshot, runDir, info)
 	return finalizeRun(runDir, busPath, info, execErr)
 }
 
@@ -794,6 +940,7 @@ func finalizeRun(runDir, busPath string, info *storage.RunInfo, execErr error) e
 		update.EndTime = info.EndTime
 		update.Status = info.Status
 		update.ErrorSummary = info.ErrorSummary
+		update.Usage = info.Usage
 		return nil
 	}); err != nil {
 		return errors.Wrap(err, "update run-info")
@@ -806,6 +953,12 @@ func finalizeRun(runDir, busPath string, info *storage.RunInfo, execErr error) e
 		runDir,
 		info.OutputPath,
 	)
+	if usageLine := formatUsageLine(info.Usage); usageLine != "" {
+		stopBody += "\n" + usageLine
+	}
+	if changeSet, err := changes.Read(runDir); err == nil {
+		stopBody += "\n" + formatChangesLine(changeSet)
+	}
 	if info.Status == storage.StatusFailed {
 		if excerpt := tailFile(info.StderrPath, 50); excerpt != "" {
 			stopBody += "\n\n## stderr (last 50 lines)\n" + excerpt
@@ -831,7 +984,7 @@ func postRunEvent(busPath string, info *storage.RunInfo, msgType, body string) e
 	if strings.TrimSpace(busPath) == "" {
 		return nil
 	}
-	bus, err := messagebus.NewMessageBus(busPath)
+	bus, err := messagebus.Open(busPath, "")
 	if err != nil {
 		obslog.Log(log.Default(), "ERROR", "runner", "run_event_bus_open_failed",
 			obslog.F("project_id", info.ProjectID),
@@ -842,6 +995,7 @@ func postRunEvent(busPath string, info *storage.RunInfo, msgType, body string) e
 		)
 		return errors.Wrap(err, "new message bus")
 	}
+	defer bus.Close()
 	msgID, err := bus.AppendMessage(&messagebus.Message{
 		Type:      msgType,
 		ProjectID: info.ProjectID,
@@ -869,71 +1023,6 @@ func postRunEvent(busPath string, info *storage.RunInfo, msgType, body string) e
 	return nil
 }
 
-// isGeminiStreamJSONFlagError checks whether a Gemini stderr file contains
-// a flag-rejection message indicating the CLI version does not support
-// --output-format stream-json.
-func isGeminiStreamJSONFlagError(stderrPath string) bool {
-	if stderrPath == "" {
-		return false
-	}
-	data, err := os.ReadFile(stderrPath)
-	if err != nil {
-		return false
-	}
-	lower := strings.ToLower(string(data))
-	for _, keyword := range []string{"unknown flag", "unrecognized option", "output-format", "stream-json", "invalid flag"} {
-		if strings.Contains(lower, keyword) {
-			return true
-		}
-	}
-	return false
-}
-
-// checkGeminiStreamJSONSupport verifies the Gemini CLI binary supports
-// --output-format stream-json. Returns a descriptive error if not supported.
-func checkGeminiStreamJSONSupport() error {
-	geminiStreamJSONOnce.Do(func() {
-		helpOut, err := exec.Command("gemini", "--help").CombinedOutput()
-		if err != nil {
-			geminiStreamJSONErr = fmt.Errorf("gemini CLI not found or failed to run (install from https://github.com/google-gemini/gemini-cli): %w", err)
-			return
-		}
-		helpStr := strings.ToLower(string(helpOut))
-		if !strings.Contains(helpStr, "output-format") {
-			geminiStreamJSONErr = fmt.Errorf("installed Gemini CLI does not support --output-format stream-json; please update to the latest version (npm install -g @google/gemini-cli or brew upgrade gemini-cli)")
-		}
-	})
-	return geminiStreamJSONErr
-}
-
-// commandForAgent returns the CLI command and arguments for the given agent type.
-// Working directory is handled by SpawnOptions.Dir, not by CLI flags.
-func commandForAgent(agentType string) (string, []string, error) {
-	switch strings.ToLower(agentType) {
-	case "codex":
-		args := []string{"exec", "--dangerously-bypass-approvals-and-sandbox", "--json", "-"}
-		return "codex", args, nil
-	case "claude":
-		args := []string{
-			"-p",
-			"--input-format", "text",
-			"--output-format", "stream-json",
-			"--verbose",
-			"--tools", "default",
-			"--permission-mode", "bypassPermissions",
-		}
-		return "claude", args, nil
-	case "gemini":
-		if err := checkGeminiStreamJSONSupport(); err != nil {
-			return "", nil, err
-		}
-		args := []string{"--screen-reader", "true", "--approval-mode", "yolo", "--output-format", "stream-json"}
-		return "gemini", args, nil
-	default:
-		return "", nil, fmt.Errorf("unsupported agent type %q", agentType)
-	}
-}
-
 // removeEnvKeys returns a copy of env with the given keys removed.
 func removeEnvKeys(env []string, keys ...string) []string {
 	remove := make(map[string]struct{}, len(keys))
@@ -999,7 +1088,11 @@ func tailFile(path string, maxLines int) string {
 }
 
 // classifyExitCode returns a one-line error summary for a non-zero exit code.
-func classifyExitCode(exitCode int) string {
+// oomKilled is set when the run's cgroup recorded an OOM kill.
+func classifyExitCode(exitCode int, oomKilled bool) string {
+	if oomKilled {
+		return "agent killed: out of memory (cgroup memory.max reached)"
+	}
 	switch exitCode {
 	case 1:
 		return "agent reported failure"
@@ -1021,14 +1114,11 @@ func ctxOrBackground() context.Context {
 // detectAgentVersion returns the CLI version string for CLI agents (best-effort).
 // Returns empty string for REST agents or if detection fails.
 func detectAgentVersion(ctx context.Context, agentType string) string {
-	if isRestAgent(agentType) {
-		return ""
-	}
-	command := cliCommand(agentType)
-	if command == "" {
+	desc, ok := agent.Lookup(agentType)
+	if !ok || desc.REST || !desc.ProbeVersion || desc.Binary == "" {
 		return ""
 	}
-	version, err := agent.DetectCLIVersion(ctx, command)
+	version, err := agent.DetectCLIVersion(ctx, desc.Binary)
 	if err != nil {
 		return ""
 	}
@@ -10,10 +10,11 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/config"
 	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 	"github.com/jonnyzzz/conductor-loop/internal/storage"
 )
@@ -57,10 +58,9 @@ func TestCommandForAgent(t *testing.T) {
 				}
 				createFakeGeminiCLIForHelp(t, binDir, true)
 				t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
-				resetGeminiStreamJSONSupportCache()
 			}
 
-			cmd, args, err := commandForAgent(tc.agentType)
+			desc, err := agentDescriptor(agentSelection{}, tc.agentType)
 			if tc.wantErr {
 				if err == nil {
 					t.Fatalf("expected error for agent type %q", tc.agentType)
@@ -70,16 +70,23 @@ func TestCommandForAgent(t *testing.T) {
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if cmd != tc.wantCmd {
-				t.Fatalf("expected command %q, got %q", tc.wantCmd, cmd)
+			cmd, err := commandForAgent(desc, agent.Invocation{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-			if len(args) == 0 {
+			if cmd.Path != tc.wantCmd {
+				t.Fatalf("expected command %q, got %q", tc.wantCmd, cmd.Path)
+			}
+			if len(cmd.Args) == 0 {
 				t.Fatalf("expected non-empty args")
 			}
+			if !cmd.PromptOnStdin {
+				t.Fatalf("expected prompt on stdin")
+			}
 			// working directory is handled by SpawnOptions.Dir, not CLI flags
-			for _, arg := range args {
+			for _, arg := range cmd.Args {
 				if arg == "-C" {
-					t.Fatalf("args should not contain -C flag, got %v", args)
+					t.Fatalf("args should not contain -C flag, got %v", cmd.Args)
 				}
 			}
 		})
@@ -87,12 +94,12 @@ func TestCommandForAgent(t *testing.T) {
 }
 
 func TestCommandForAgentJSONFlags(t *testing.T) {
-	_, codexArgs, err := commandForAgent("codex")
+	codexCmd, err := commandForAgent(mustDescriptor(t, "codex"), agent.Invocation{})
 	if err != nil {
 		t.Fatalf("commandForAgent(codex): %v", err)
 	}
-	if !containsArg(codexArgs, "--json") {
-		t.Fatalf("expected codex args to include --json, got %v", codexArgs)
+	if !containsArg(codexCmd.Args, "--json") {
+		t.Fatalf("expected codex args to include --json, got %v", codexCmd.Args)
 	}
 
 	binDir := filepath.Join(t.TempDir(), "bin")
@@ -101,45 +108,13 @@ func TestCommandForAgentJSONFlags(t *testing.T) {
 	}
 	createFakeGeminiCLIForHelp(t, binDir, true)
 	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
-	resetGeminiStreamJSONSupportCache()
 
-	_, geminiArgs, err := commandForAgent("gemini")
+	geminiCmd, err := commandForAgent(mustDescriptor(t, "gemini"), agent.Invocation{})
 	if err != nil {
 		t.Fatalf("commandForAgent(gemini): %v", err)
 	}
-	if !containsArgPair(geminiArgs, "--output-format", "stream-json") {
-		t.Fatalf("expected gemini args to include --output-format stream-json, got %v", geminiArgs)
-	}
-}
-
-func TestCheckGeminiStreamJSONSupport_NotInstalled(t *testing.T) {
-	t.Setenv("PATH", t.TempDir())
-	resetGeminiStreamJSONSupportCache()
-
-	err := checkGeminiStreamJSONSupport()
-	if err == nil {
-		t.Fatalf("expected error when gemini is not installed")
-	}
-	if !strings.Contains(strings.ToLower(err.Error()), "not found") {
-		t.Fatalf("expected not found error, got %v", err)
-	}
-}
-
-func TestCheckGeminiStreamJSONSupport_OldVersion(t *testing.T) {
-	binDir := filepath.Join(t.TempDir(), "bin")
-	if err := os.MkdirAll(binDir, 0o755); err != nil {
-		t.Fatalf("mkdir bin: %v", err)
-	}
-	createFakeGeminiCLIForHelp(t, binDir, false)
-	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
-	resetGeminiStreamJSONSupportCache()
-
-	err := checkGeminiStreamJSONSupport()
-	if err == nil {
-		t.Fatalf("expected old-version error")
-	}
-	if !strings.Contains(err.Error(), "does not support --output-format stream-json") {
-		t.Fatalf("expected actionable stream-json error, got %v", err)
+	if !containsArgPair(geminiCmd.Args, "--output-format", "stream-json") {
+		t.Fatalf("expected gemini args to include --output-format stream-json, got %v", geminiCmd.Args)
 	}
 }
 
@@ -168,11 +143,6 @@ func containsArgPair(args []string, key, value string) bool {
 	return false
 }
 
-func resetGeminiStreamJSONSupportCache() {
-	geminiStreamJSONOnce = sync.Once{}
-	geminiStreamJSONErr = nil
-}
-
 func TestIsRestAgent(t *testing.T) {
 	if !isRestAgent("perplexity") || !isRestAgent("xai") {
 		t.Fatalf("expected rest agents")
@@ -256,6 +226,49 @@ func TestRunJobCLI(t *testing.T) {
 	}
 }
 
+func TestRunJobDeliversInboxOnce(t *testing.T) {
+	root := t.TempDir()
+	binDir := filepath.Join(root, "bin")
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		t.Fatalf("mkdir bin: %v", err)
+	}
+	createFakeCLI(t, binDir, "codex")
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	taskDir := filepath.Join(root, "project", "task")
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		t.Fatalf("mkdir task: %v", err)
+	}
+	bus, err := messagebus.NewMessageBus(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"))
+	if err != nil {
+		t.Fatalf("NewMessageBus: %v", err)
+	}
+	if _, err := bus.AppendMessage(&messagebus.Message{
+		Type: "INFO", ProjectID: "project", TaskID: "parent", RunID: "run-p", ToTask: "task", Body: "switch to plan B",
+	}); err != nil {
+		t.Fatalf("AppendMessage: %v", err)
+	}
+
+	readPrompt := func() string {
+		t.Helper()
+		info, err := runJob("project", "task", JobOptions{RootDir: root, Agent: "codex", Prompt: "hello"})
+		if err != nil {
+			t.Fatalf("runJob: %v", err)
+		}
+		data, err := os.ReadFile(filepath.Join(taskDir, "runs", info.RunID, "prompt.md"))
+		if err != nil {
+			t.Fatalf("read prompt: %v", err)
+		}
+		return string(data)
+	}
+	if prompt := readPrompt(); !strings.Contains(prompt, "## Inbox") || !strings.Contains(prompt, "INFO from parent/run-p") || !strings.Contains(prompt, "switch to plan B") {
+		t.Fatalf("inbox missing from first prompt:\n%s", prompt)
+	}
+	if prompt := readPrompt(); strings.Contains(prompt, "switch to plan B") {
+		t.Fatalf("inbox delivered twice:\n%s", prompt)
+	}
+}
+
 func TestRunJob_CreatesTaskMD(t *testing.T) {
 	root := t.TempDir()
 	binDir := filepath.Join(root, "bin")
@@ -503,7 +516,7 @@ func TestRunJobCLIExitFailure(t *testing.T) {
 
 func TestExecuteCLICommandError(t *testing.T) {
 	info := &storage.RunInfo{RunID: "run-1", ProjectID: "project", TaskID: "task", AgentType: "unknown"}
-	if _, err := executeCLI(context.Background(), "unknown", "prompt.md", t.TempDir(), nil, t.TempDir(), "", info, 0); err == nil {
+	if _, err := executeCLI(context.Background(), agent.Descriptor{Type: "unknown"}, "prompt.md", t.TempDir(), nil, t.TempDir(), "", info, nil, nil, nil, 0); err == nil {
 		t.Fatalf("expected error for unknown agent type")
 	}
 }
@@ -523,7 +536,7 @@ func TestExecuteCLISpawnError(t *testing.T) {
 		Status:    storage.StatusRunning,
 	}
 	env := []string{"PATH=" + t.TempDir()}
-	if _, err := executeCLI(context.Background(), "codex", promptPath, runDir, env, runDir, "", info, 0); err == nil {
+	if _, err := executeCLI(context.Background(), mustDescriptor(t, "codex"), promptPath, runDir, env, runDir, "", info, nil, nil, nil, 0); err == nil {
 		t.Fatalf("expected spawn error")
 	}
 	updated, err := storage.ReadRunInfo(filepath.Join(runDir, "run-info.yaml"))
@@ -562,7 +575,7 @@ func TestExecuteCLIPostRunEventError(t *testing.T) {
 		Status:    storage.StatusRunning,
 	}
 	env := []string{"PATH=" + binDir + string(os.PathListSeparator) + os.Getenv("PATH")}
-	if _, err := executeCLI(context.Background(), "codex", promptPath, runDir, env, runDir, busPath, info, 0); err == nil {
+	if _, err := executeCLI(context.Background(), mustDescriptor(t, "codex"), promptPath, runDir, env, runDir, busPath, info, nil, nil, nil, 0); err == nil {
 		t.Fatalf("expected postRunEvent error")
 	}
 }
@@ -577,11 +590,24 @@ func TestExecuteRESTUnsupported(t *testing.T) {
 		StartTime: time.Now().UTC(),
 		Status:    storage.StatusRunning,
 	}
-	if err := executeREST(context.Background(), "unknown", agentSelection{Name: "unknown"}, "prompt", runDir, nil, runDir, "", info); err == nil {
+	if err := executeREST(context.Background(), agent.Descriptor{Type: "unknown"}, agent.Settings{}, "prompt", runDir, nil, runDir, "", info, nil); err == nil {
 		t.Fatalf("expected unsupported rest agent error")
 	}
 }
 
+func TestRestSettings(t *testing.T) {
+	if settings := restSettings(agentSelection{Config: config.AgentConfig{Type: "xai"}}, "config.yaml"); settings.Tools || settings.ConfigPath != "" {
+		t.Fatalf("expected tools to be disabled, got %+v", settings)
+	}
+	settings := restSettings(agentSelection{Config: config.AgentConfig{Type: "xai", Tools: true}}, "config.yaml")
+	if !settings.Tools {
+		t.Fatal("expected tools to be enabled")
+	}
+	if !filepath.IsAbs(settings.ConfigPath) || filepath.Base(settings.ConfigPath) != "config.yaml" {
+		t.Fatalf("expected absolute config path, got %q", settings.ConfigPath)
+	}
+}
+
 func TestFinalizeRunFailure(t *testing.T) {
 	runDir := t.TempDir()
 	if err := os.WriteFile(filepath.Join(runDir, "agent-stdout.txt"), []byte("output"), 0o644); err != nil {
@@ -719,7 +745,7 @@ func TestErrorSummaryClassification(t *testing.T) {
 	}
 	for _, tc := range tests {
 		t.Run(fmt.Sprintf("exit_%d", tc.exitCode), func(t *testing.T) {
-			got := classifyExitCode(tc.exitCode)
+			got := classifyExitCode(tc.exitCode, false)
 			if got != tc.expected {
 				t.Fatalf("classifyExitCode(%d) = %q, want %q", tc.exitCode, got, tc.expected)
 			}
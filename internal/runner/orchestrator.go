@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 	"github.com/jonnyzzz/conductor-loop/internal/obslog"
 	"github.com/jonnyzzz/conductor-loop/internal/storage"
 	"github.com/pkg/errors"
@@ -144,6 +145,8 @@ type PromptParams struct {
 	MessageBusPath string // absolute path to TASK-MESSAGE-BUS.md
 	ConductorURL   string // e.g. "http://127.0.0.1:14355"
 	RepoRoot       string // absolute path to conductor-loop repo root
+	// Inbox holds the unread directed messages for the task (see messagebus.ReadInbox).
+	Inbox []*messagebus.Message
 }
 
 func buildPrompt(params PromptParams, prompt string) string {
@@ -175,6 +178,12 @@ func buildPrompt(params PromptParams, prompt string) string {
 	b.WriteString("  run-agent bus post --type DECISION --body \"what was decided\"\n")
 	b.WriteString("Types: FACT, PROGRESS, DECISION, ERROR, QUESTION, INFO\n")
 	b.WriteString("The JRUN_MESSAGE_BUS env var is set; run-agent bus post uses it automatically.\n")
+	b.WriteString("Read messages not yet seen by earlier runs of this task with:\n")
+	b.WriteString("  run-agent bus read --consumer $JRUN_TASK_ID --ack\n")
+	b.WriteString("Check for instructions sent to this task or run while you work with:\n")
+	b.WriteString("  run-agent bus inbox --ack\n")
+	b.WriteString("When only a human can decide, ask and wait for the answer with:\n")
+	b.WriteString("  run-agent bus ask --wait --timeout 30m --body \"<question>\"\n")
 
 	// --- Sub-agent spawning ---
 	b.WriteString("\n## Sub-Agent Spawning (RLM Pattern)\n")
@@ -205,6 +214,8 @@ func buildPrompt(params PromptParams, prompt string) string {
 	fmt.Fprintf(&b, "When done, create: %s/DONE\n", params.TaskDir)
 	b.WriteString("This signals the conductor loop to stop restarting this task.\n")
 
+	writeInbox(&b, params.Inbox)
+
 	b.WriteString("\n---\n\n")
 	trimmed := strings.TrimSpace(prompt)
 	if trimmed != "" {
@@ -269,23 +280,6 @@ func readFileTrimmed(path string) (string, error) {
 	return trimmed, nil
 }
 
-func tokenEnvVar(agentType string) string {
-	switch strings.ToLower(agentType) {
-	case "codex":
-		return "OPENAI_API_KEY"
-	case "claude":
-		return "ANTHROPIC_API_KEY"
-	case "gemini":
-		return "GEMINI_API_KEY"
-	case "perplexity":
-		return "PERPLEXITY_API_KEY"
-	case "xai":
-		return "XAI_API_KEY"
-	default:
-		return ""
-	}
-}
-
 func mergeEnv(base []string, overrides map[string]string) []string {
 	merged := make(map[string]string, len(base)+len(overrides))
 	for _, entry := range base {
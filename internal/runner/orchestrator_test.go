@@ -126,6 +126,7 @@ func TestBuildPrompt(t *testing.T) {
 				"JRUN_TASK_ID=task-1",
 				"JRUN_ID=run-1",
 				"JRUN_PARENT_ID=parent-1",
+				"run-agent bus read --consumer $JRUN_TASK_ID --ack",
 				"do something",
 			},
 		},
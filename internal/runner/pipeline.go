@@ -0,0 +1,716 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/goaldecompose"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/jonnyzzz/conductor-loop/internal/taskdeps"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	pipelineStateVersion = 1
+	// PipelineStateFileName is the pipeline state file inside PipelineDir.
+	PipelineStateFileName = "pipeline-state.yaml"
+
+	// Pipeline and pipeline task statuses.
+	PipelineStatusPending   = "pending"
+	PipelineStatusRunning   = "running"
+	PipelineStatusCompleted = "completed"
+	PipelineStatusFailed    = "failed"
+	// PipelineStatusSkipped marks a task that was not started because a
+	// dependency failed.
+	PipelineStatusSkipped = "skipped"
+)
+
+// PipelineOptions controls execution of a workflow spec as a task DAG.
+type PipelineOptions struct {
+	RootDir      string
+	ConfigPath   string
+	Agent        string // overrides the agent of every task when set
+	WorkingDir   string
+	MaxParallel  int // overrides the spec max_parallel when > 0
+	SpecPath     string
+	Resume       bool
+	DryRun       bool
+	Timeout      time.Duration
+	ConductorURL string
+	// TaskExecutor runs one task and returns when it finished; RunTask when
+	// nil. The API server uses it to admit tasks through its run planner.
+	TaskExecutor PipelineTaskExecutor
+}
+
+// PipelineState is the persisted state of a pipeline run.
+type PipelineState struct {
+	Version     int            `json:"version" yaml:"version"`
+	WorkflowID  string         `json:"workflow_id" yaml:"workflow_id"`
+	ProjectID   string         `json:"project_id" yaml:"project_id"`
+	SpecPath    string         `json:"spec_path,omitempty" yaml:"spec_path,omitempty"`
+	MaxParallel int            `json:"max_parallel" yaml:"max_parallel"`
+	Status      string         `json:"status" yaml:"status"`
+	CreatedAt   time.Time      `json:"created_at" yaml:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at" yaml:"updated_at"`
+	CompletedAt time.Time      `json:"completed_at,omitempty" yaml:"completed_at,omitempty"`
+	Tasks       []PipelineTask `json:"tasks" yaml:"tasks"`
+}
+
+// PipelineTask tracks one task of a pipeline.
+type PipelineTask struct {
+	TaskID    string    `json:"task_id" yaml:"task_id"`
+	Title     string    `json:"title,omitempty" yaml:"title,omitempty"`
+	Agent     string    `json:"agent,omitempty" yaml:"agent,omitempty"`
+	DependsOn []string  `json:"depends_on,omitempty" yaml:"depends_on,omitempty"`
+	Status    string    `json:"status" yaml:"status"`
+	Attempts  int       `json:"attempts" yaml:"attempts"`
+	StartedAt time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty"`
+	EndedAt   time.Time `json:"ended_at,omitempty" yaml:"ended_at,omitempty"`
+	Error     string    `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Counts returns the number of tasks per status.
+func (s *PipelineState) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, task := range s.Tasks {
+		counts[task.Status]++
+	}
+	return counts
+}
+
+// PipelineResult describes a finished (or dry-run) pipeline execution.
+// DoneTasks were already completed when the pipeline started.
+type PipelineResult struct {
+	WorkflowID    string        `json:"workflow_id"`
+	ProjectID     string        `json:"project_id"`
+	Resume        bool          `json:"resume"`
+	DryRun        bool          `json:"dry_run"`
+	StatePath     string        `json:"state_path"`
+	ExecutedTasks []string      `json:"executed_tasks"`
+	DoneTasks     []string      `json:"done_tasks"`
+	State         PipelineState `json:"state"`
+}
+
+// PipelineTaskExecutor runs a task of a pipeline to completion.
+type PipelineTaskExecutor func(projectID, taskID string, opts TaskOptions) error
+
+// Pipeline is a workflow spec whose tasks have been materialized in the
+// project and whose state file is ready. Run launches the tasks.
+type Pipeline struct {
+	spec        goaldecompose.WorkflowSpec
+	opts        PipelineOptions
+	rootDir     string
+	busPath     string
+	statePath   string
+	maxParallel int
+	state       *PipelineState
+	inSpec      map[string]bool
+}
+
+// PipelineDir returns the directory holding the state and DONE marker of a
+// pipeline.
+func PipelineDir(rootDir, projectID, workflowID string) string {
+	return filepath.Join(rootDir, projectID, "pipelines", workflowID)
+}
+
+// LoadPipelineState reads the state of a pipeline from the runs root.
+func LoadPipelineState(rootDir, projectID, workflowID string) (*PipelineState, error) {
+	if err := validatePipelineID(workflowID); err != nil {
+		return nil, err
+	}
+	return loadPipelineState(filepath.Join(PipelineDir(rootDir, projectID, workflowID), PipelineStateFileName))
+}
+
+// RunPipeline materializes the tasks of spec and runs them as a DAG.
+func RunPipeline(spec goaldecompose.WorkflowSpec, opts PipelineOptions) (*PipelineResult, error) {
+	p, err := PreparePipeline(spec, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return p.result(), nil
+	}
+	return p.Run()
+}
+
+// PreparePipeline validates spec, writes TASK.md and depends_on for every
+// task and initializes (or, with Resume, reloads) the pipeline state.
+// Tasks that already have a DONE marker count as completed.
+func PreparePipeline(spec goaldecompose.WorkflowSpec, opts PipelineOptions) (*Pipeline, error) {
+	if err := validatePipelineSpec(&spec); err != nil {
+		return nil, err
+	}
+	rootDir, err := resolveRootDir(opts.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	maxParallel := opts.MaxParallel
+	if maxParallel <= 0 {
+		maxParallel = spec.MaxParallel
+	}
+	if maxParallel <= 0 {
+		maxParallel = goaldecompose.DefaultMaxParallel
+	}
+
+	specDir := ""
+	if path := strings.TrimSpace(opts.SpecPath); path != "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			opts.SpecPath = abs
+		}
+		specDir = filepath.Dir(opts.SpecPath)
+	}
+
+	p := &Pipeline{
+		spec:        spec,
+		opts:        opts,
+		rootDir:     rootDir,
+		busPath:     filepath.Join(rootDir, spec.ProjectID, "PROJECT-MESSAGE-BUS.md"),
+		maxParallel: maxParallel,
+		inSpec:      make(map[string]bool, len(spec.Tasks)),
+	}
+	for _, task := range spec.Tasks {
+		p.inSpec[task.TaskID] = true
+	}
+
+	for _, task := range spec.Tasks {
+		taskDir, err := resolveTaskDir(rootDir, spec.ProjectID, task.TaskID)
+		if err != nil {
+			return nil, err
+		}
+		if err := ensureDir(taskDir); err != nil {
+			return nil, errors.Wrap(err, "ensure task dir")
+		}
+		taskMDPath := filepath.Join(taskDir, "TASK.md")
+		if _, err := os.Stat(taskMDPath); os.IsNotExist(err) {
+			prompt, err := pipelineTaskPrompt(spec, task, specDir)
+			if err != nil {
+				return nil, err
+			}
+			if err := os.WriteFile(taskMDPath, []byte(prompt+"\n"), 0o644); err != nil {
+				return nil, errors.Wrapf(err, "write TASK.md for %s", task.TaskID)
+			}
+		} else if err != nil {
+			return nil, errors.Wrap(err, "stat TASK.md")
+		}
+		if err := taskdeps.WriteDependsOn(taskDir, task.DependsOn); err != nil {
+			return nil, errors.Wrapf(err, "write dependencies of %s", task.TaskID)
+		}
+	}
+	for _, task := range spec.Tasks {
+		if err := taskdeps.ValidateNoCycle(rootDir, spec.ProjectID, task.TaskID, task.DependsOn); err != nil {
+			return nil, errors.Wrap(err, "validate task dependencies")
+		}
+	}
+
+	pipelineDir := PipelineDir(rootDir, spec.ProjectID, spec.WorkflowID)
+	if err := ensureDir(pipelineDir); err != nil {
+		return nil, errors.Wrap(err, "ensure pipeline directory")
+	}
+	p.statePath = filepath.Join(pipelineDir, PipelineStateFileName)
+	if err := p.loadOrInitState(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// State returns a copy of the current pipeline state.
+func (p *Pipeline) State() PipelineState {
+	state := *p.state
+	state.Tasks = append([]PipelineTask(nil), p.state.Tasks...)
+	return state
+}
+
+// StatePath returns the path of the pipeline state file.
+func (p *Pipeline) StatePath() string {
+	return p.statePath
+}
+
+// Run launches every pending task once the tasks it depends on within the
+// pipeline have completed, at most max_parallel at a time. A failed task
+// marks its dependents as skipped; the other branches keep running. When
+// every task completed the pipeline writes its DONE marker.
+func (p *Pipeline) Run() (*PipelineResult, error) {
+	result := p.result()
+	state := p.state
+	projectID, workflowID := p.spec.ProjectID, p.spec.WorkflowID
+
+	execTask := p.opts.TaskExecutor
+	if execTask == nil {
+		execTask = RunTask
+	}
+
+	mode := "fresh"
+	if p.opts.Resume {
+		mode = "resume"
+	}
+	_ = postWorkflowBusMessage(p.busPath, projectID, "", "", "DECISION",
+		fmt.Sprintf("pipeline %s started (%s): %d tasks, max_parallel=%d", workflowID, mode, len(state.Tasks), p.maxParallel))
+	obslog.Log(log.Default(), "INFO", "runner", "pipeline_started",
+		obslog.F("project_id", projectID),
+		obslog.F("workflow_id", workflowID),
+		obslog.F("tasks", len(state.Tasks)),
+		obslog.F("max_parallel", p.maxParallel),
+		obslog.F("resume", p.opts.Resume),
+	)
+
+	state.Status = PipelineStatusRunning
+	state.CompletedAt = time.Time{}
+	if err := p.save(); err != nil {
+		return nil, err
+	}
+
+	// Buffered so that tasks never block on a pipeline that stopped early.
+	results := make(chan pipelineTaskResult, p.maxParallel)
+	running := 0
+	for {
+		p.skipBlockedTasks()
+		for i := range state.Tasks {
+			if running >= p.maxParallel {
+				break
+			}
+			entry := &state.Tasks[i]
+			if entry.Status != PipelineStatusPending || !p.dependenciesCompleted(entry) {
+				continue
+			}
+			now := time.Now().UTC()
+			entry.Status = PipelineStatusRunning
+			entry.Attempts++
+			entry.StartedAt = now
+			entry.EndedAt = time.Time{}
+			entry.Error = ""
+			if err := p.save(); err != nil {
+				entry.Status = PipelineStatusPending
+				return nil, p.abort(results, running, err)
+			}
+			result.ExecutedTasks = append(result.ExecutedTasks, entry.TaskID)
+			_ = postWorkflowBusMessage(p.busPath, projectID, entry.TaskID, "", "PROGRESS",
+				fmt.Sprintf("pipeline %s: task %s started", workflowID, entry.TaskID))
+
+			running++
+			go func(index int, taskOpts pipelineTaskOptions) {
+				err := execTask(projectID, taskOpts.taskID, taskOpts.TaskOptions)
+				results <- pipelineTaskResult{index: index, err: err}
+			}(i, p.taskOptions(entry))
+		}
+		if running == 0 {
+			break
+		}
+
+		p.recordResult(<-results)
+		running--
+		if err := p.save(); err != nil {
+			return nil, p.abort(results, running, err)
+		}
+	}
+
+	counts := state.Counts()
+	now := time.Now().UTC()
+	state.CompletedAt = now
+	doneMarker := filepath.Join(filepath.Dir(p.statePath), "DONE")
+	if counts[PipelineStatusCompleted] == len(state.Tasks) {
+		state.Status = PipelineStatusCompleted
+		if err := p.save(); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(doneMarker, nil, 0o644); err != nil {
+			return nil, errors.Wrap(err, "write pipeline DONE")
+		}
+		_ = postWorkflowBusMessage(p.busPath, projectID, "", "", "FACT",
+			fmt.Sprintf("pipeline %s completed: %d tasks", workflowID, len(state.Tasks)))
+		obslog.Log(log.Default(), "INFO", "runner", "pipeline_completed",
+			obslog.F("project_id", projectID),
+			obslog.F("workflow_id", workflowID),
+		)
+		result.State = p.State()
+		return result, nil
+	}
+
+	state.Status = PipelineStatusFailed
+	if err := p.save(); err != nil {
+		return nil, err
+	}
+	_ = os.Remove(doneMarker)
+	summary := fmt.Sprintf("%d failed, %d skipped", counts[PipelineStatusFailed], counts[PipelineStatusSkipped])
+	_ = postWorkflowBusMessage(p.busPath, projectID, "", "", "ERROR",
+		fmt.Sprintf("pipeline %s failed: %s", workflowID, summary))
+	obslog.Log(log.Default(), "ERROR", "runner", "pipeline_failed",
+		obslog.F("project_id", projectID),
+		obslog.F("workflow_id", workflowID),
+		obslog.F("failed", counts[PipelineStatusFailed]),
+		obslog.F("skipped", counts[PipelineStatusSkipped]),
+	)
+	result.State = p.State()
+	return result, fmt.Errorf("pipeline %s failed: %s", workflowID, summary)
+}
+
+type pipelineTaskResult struct {
+	index int
+	err   error
+}
+
+// recordResult applies the outcome of a finished task to the state.
+func (p *Pipeline) recordResult(res pipelineTaskResult) {
+	projectID, workflowID := p.spec.ProjectID, p.spec.WorkflowID
+	entry := &p.state.Tasks[res.index]
+	entry.EndedAt = time.Now().UTC()
+	if res.err != nil {
+		entry.Status = PipelineStatusFailed
+		entry.Error = res.err.Error()
+		_ = postWorkflowBusMessage(p.busPath, projectID, entry.TaskID, "", "ERROR",
+			fmt.Sprintf("pipeline %s: task %s failed: %v", workflowID, entry.TaskID, res.err))
+		return
+	}
+	entry.Status = PipelineStatusCompleted
+	_ = postWorkflowBusMessage(p.busPath, projectID, entry.TaskID, "", "FACT",
+		fmt.Sprintf("pipeline %s: task %s completed", workflowID, entry.TaskID))
+}
+
+// abort stops a pipeline whose state could not be saved: it waits for the
+// running tasks, records their results, marks the pipeline failed and makes
+// a last attempt to save the state. It returns err.
+func (p *Pipeline) abort(results <-chan pipelineTaskResult, running int, err error) error {
+	for ; running > 0; running-- {
+		p.recordResult(<-results)
+	}
+	p.state.Status = PipelineStatusFailed
+	p.state.CompletedAt = time.Now().UTC()
+	_ = p.save()
+	obslog.Log(log.Default(), "ERROR", "runner", "pipeline_aborted",
+		obslog.F("project_id", p.spec.ProjectID),
+		obslog.F("workflow_id", p.spec.WorkflowID),
+		obslog.F("error", err),
+	)
+	return err
+}
+
+// PipelineResultJSON returns a stable JSON rendering of the result.
+func PipelineResultJSON(result *PipelineResult) ([]byte, error) {
+	if result == nil {
+		return nil, errors.New("pipeline result is nil")
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal pipeline result")
+	}
+	return append(data, '\n'), nil
+}
+
+type pipelineTaskOptions struct {
+	TaskOptions
+	taskID string
+}
+
+func (p *Pipeline) taskOptions(entry *PipelineTask) pipelineTaskOptions {
+	agent := strings.TrimSpace(p.opts.Agent)
+	if agent == "" {
+		agent = entry.Agent
+	}
+	return pipelineTaskOptions{
+		taskID: entry.TaskID,
+		TaskOptions: TaskOptions{
+			RootDir:      p.rootDir,
+			ConfigPath:   p.opts.ConfigPath,
+			Agent:        agent,
+			WorkingDir:   p.opts.WorkingDir,
+			Timeout:      p.opts.Timeout,
+			ConductorURL: p.opts.ConductorURL,
+			DependsOn:    append([]string{}, entry.DependsOn...),
+		},
+	}
+}
+
+func (p *Pipeline) result() *PipelineResult {
+	return &PipelineResult{
+		WorkflowID:    p.spec.WorkflowID,
+		ProjectID:     p.spec.ProjectID,
+		Resume:        p.opts.Resume,
+		DryRun:        p.opts.DryRun,
+		StatePath:     p.statePath,
+		ExecutedTasks: []string{},
+		DoneTasks:     p.completedTaskIDs(),
+		State:         p.State(),
+	}
+}
+
+func (p *Pipeline) completedTaskIDs() []string {
+	ids := []string{}
+	for _, task := range p.state.Tasks {
+		if task.Status == PipelineStatusCompleted {
+			ids = append(ids, task.TaskID)
+		}
+	}
+	return ids
+}
+
+// dependenciesCompleted reports whether every dependency inside the
+// pipeline completed. Dependencies on tasks outside the spec are awaited by
+// RunTask itself.
+func (p *Pipeline) dependenciesCompleted(entry *PipelineTask) bool {
+	for _, dep := range entry.DependsOn {
+		if !p.inSpec[dep] {
+			continue
+		}
+		if p.taskEntry(dep).Status != PipelineStatusCompleted {
+			return false
+		}
+	}
+	return true
+}
+
+// skipBlockedTasks marks pending tasks whose dependencies failed or were
+// skipped, transitively.
+func (p *Pipeline) skipBlockedTasks() {
+	for changed := true; changed; {
+		changed = false
+		for i := range p.state.Tasks {
+			entry := &p.state.Tasks[i]
+			if entry.Status != PipelineStatusPending {
+				continue
+			}
+			for _, dep := range entry.DependsOn {
+				if !p.inSpec[dep] {
+					continue
+				}
+				if status := p.taskEntry(dep).Status; status == PipelineStatusFailed || status == PipelineStatusSkipped {
+					entry.Status = PipelineStatusSkipped
+					entry.Error = fmt.Sprintf("dependency %s %s", dep, status)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+func (p *Pipeline) taskEntry(taskID string) *PipelineTask {
+	for i := range p.state.Tasks {
+		if p.state.Tasks[i].TaskID == taskID {
+			return &p.state.Tasks[i]
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) loadOrInitState() error {
+	now := time.Now().UTC()
+	previous, err := loadPipelineState(p.statePath)
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			return err
+		}
+		previous = nil
+	}
+	if previous != nil && previous.ProjectID != "" && previous.ProjectID != p.spec.ProjectID {
+		return fmt.Errorf("pipeline state project mismatch: %q != %q", previous.ProjectID, p.spec.ProjectID)
+	}
+
+	state := &PipelineState{
+		Version:     pipelineStateVersion,
+		WorkflowID:  p.spec.WorkflowID,
+		ProjectID:   p.spec.ProjectID,
+		SpecPath:    p.opts.SpecPath,
+		MaxParallel: p.maxParallel,
+		Status:      PipelineStatusPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if previous != nil && !previous.CreatedAt.IsZero() {
+		state.CreatedAt = previous.CreatedAt
+	}
+	for _, task := range p.spec.Tasks {
+		entry := PipelineTask{
+			TaskID:    task.TaskID,
+			Title:     task.Title,
+			Agent:     task.Agent,
+			DependsOn: task.DependsOn,
+			Status:    PipelineStatusPending,
+		}
+		if previous != nil && p.opts.Resume {
+			for _, old := range previous.Tasks {
+				if old.TaskID != task.TaskID {
+					continue
+				}
+				entry.Attempts = old.Attempts
+				if old.Status == PipelineStatusCompleted {
+					entry.Status = PipelineStatusCompleted
+					entry.StartedAt, entry.EndedAt = old.StartedAt, old.EndedAt
+				}
+			}
+		}
+		taskDir := filepath.Join(p.rootDir, p.spec.ProjectID, task.TaskID)
+		if _, err := os.Stat(filepath.Join(taskDir, "DONE")); err == nil {
+			entry.Status = PipelineStatusCompleted
+		}
+		state.Tasks = append(state.Tasks, entry)
+	}
+	p.state = state
+	return p.save()
+}
+
+func (p *Pipeline) save() error {
+	p.state.UpdatedAt = time.Now().UTC()
+	data, err := yaml.Marshal(p.state)
+	if err != nil {
+		return fmt.Errorf("encode pipeline state: %w", err)
+	}
+	if err := writeWorkflowFileAtomic(p.statePath, data); err != nil {
+		return fmt.Errorf("write pipeline state: %w", err)
+	}
+	return nil
+}
+
+func loadPipelineState(path string) (*PipelineState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read pipeline state")
+	}
+	var state PipelineState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("decode pipeline state: %w", err)
+	}
+	return &state, nil
+}
+
+// validatePipelineSpec checks identifiers, normalizes dependencies and
+// rejects cycles between the tasks of spec.
+func validatePipelineSpec(spec *goaldecompose.WorkflowSpec) error {
+	spec.ProjectID = strings.TrimSpace(spec.ProjectID)
+	spec.WorkflowID = strings.TrimSpace(spec.WorkflowID)
+	if spec.ProjectID == "" {
+		return errors.New("workflow spec: project_id is required")
+	}
+	if err := storage.ValidateProjectID(spec.ProjectID); err != nil {
+		return err
+	}
+	if err := validatePipelineID(spec.WorkflowID); err != nil {
+		return err
+	}
+	if len(spec.Tasks) == 0 {
+		return errors.New("workflow spec: no tasks")
+	}
+
+	graph := make(map[string][]string, len(spec.Tasks))
+	for i := range spec.Tasks {
+		task := &spec.Tasks[i]
+		task.TaskID = strings.TrimSpace(task.TaskID)
+		if err := storage.ValidateTaskID(task.TaskID); err != nil {
+			return errors.Wrap(err, "workflow spec")
+		}
+		if _, ok := graph[task.TaskID]; ok {
+			return fmt.Errorf("workflow spec: duplicate task %s", task.TaskID)
+		}
+		dependsOn, err := taskdeps.Normalize(task.TaskID, task.DependsOn)
+		if err != nil {
+			return errors.Wrapf(err, "workflow spec: task %s", task.TaskID)
+		}
+		task.DependsOn = dependsOn
+		graph[task.TaskID] = dependsOn
+	}
+
+	// Kahn's algorithm over the dependencies inside the spec.
+	indegree := make(map[string]int, len(graph))
+	for id, deps := range graph {
+		for _, dep := range deps {
+			if _, ok := graph[dep]; ok {
+				indegree[id]++
+			}
+		}
+	}
+	queue := make([]string, 0, len(graph))
+	for id := range graph {
+		if indegree[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	visited := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		visited++
+		for other, deps := range graph {
+			for _, dep := range deps {
+				if dep == id {
+					if indegree[other]--; indegree[other] == 0 {
+						queue = append(queue, other)
+					}
+				}
+			}
+		}
+	}
+	if visited != len(graph) {
+		return errors.New("workflow spec: dependency cycle between tasks")
+	}
+	return nil
+}
+
+func validatePipelineID(workflowID string) error {
+	if workflowID == "" {
+		return errors.New("workflow spec: workflow_id is required")
+	}
+	if strings.ContainsAny(workflowID, `/\`) || strings.HasPrefix(workflowID, ".") {
+		return fmt.Errorf("invalid workflow_id %q", workflowID)
+	}
+	return nil
+}
+
+// pipelineTaskPrompt returns the prompt_file content of task (relative to
+// the spec directory) or, when there is none, a prompt built from the spec.
+func pipelineTaskPrompt(spec goaldecompose.WorkflowSpec, task goaldecompose.TaskSpec, specDir string) (string, error) {
+	if promptFile := strings.TrimSpace(task.PromptFile); promptFile != "" {
+		path := filepath.FromSlash(promptFile)
+		if !filepath.IsAbs(path) && specDir != "" {
+			path = filepath.Join(specDir, path)
+		}
+		prompt, err := readFileTrimmed(path)
+		if err == nil {
+			return prompt, nil
+		}
+		if !os.IsNotExist(errors.Cause(err)) {
+			return "", errors.Wrapf(err, "prompt file of %s", task.TaskID)
+		}
+	}
+
+	title := strings.TrimSpace(task.Title)
+	if title == "" {
+		title = task.TaskID
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", title)
+	fmt.Fprintf(&b, "Pipeline: %s (project %s)\n", spec.WorkflowID, spec.ProjectID)
+	if goal := strings.TrimSpace(spec.Goal.Preview); goal != "" {
+		fmt.Fprintf(&b, "Goal: %s\n", goal)
+	}
+	if source := strings.TrimSpace(spec.Goal.Source); source != "" && source != "inline" {
+		fmt.Fprintf(&b, "Goal file: %s\n", source)
+	}
+	if step := strings.TrimSpace(task.RLMStep); step != "" {
+		fmt.Fprintf(&b, "Step: %s\n", step)
+	}
+	if len(task.PromptStage) > 0 && spec.Template != "" {
+		stages := make([]string, 0, len(task.PromptStage))
+		for _, stage := range task.PromptStage {
+			stages = append(stages, fmt.Sprintf("%d (%s)", stage, workflowStageTitle(stage)))
+		}
+		fmt.Fprintf(&b, "%s stages: %s\n", spec.Template, strings.Join(stages, ", "))
+	}
+	if rolePrompt := strings.TrimSpace(task.RolePrompt); rolePrompt != "" {
+		fmt.Fprintf(&b, "Role prompt: %s\n", rolePrompt)
+	}
+	if len(task.DependsOn) > 0 {
+		fmt.Fprintf(&b, "Depends on: %s\n", strings.Join(task.DependsOn, ", "))
+	}
+	b.WriteString(`
+Instructions:
+1. Follow the role prompt for this step of the pipeline.
+2. Read the output.md and message bus of the tasks this one depends on.
+3. Post FACT and DECISION messages for the tasks that follow.
+4. Summarize the result in output.md and create DONE when the step is complete.`)
+	return b.String(), nil
+}
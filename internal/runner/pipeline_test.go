@@ -0,0 +1,174 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/goaldecompose"
+	"github.com/jonnyzzz/conductor-loop/internal/taskdeps"
+)
+
+func testPipelineSpec() goaldecompose.WorkflowSpec {
+	return goaldecompose.WorkflowSpec{
+		WorkflowID:  "workflow-demo",
+		ProjectID:   "my-project",
+		MaxParallel: 2,
+		Goal:        goaldecompose.GoalSpec{Preview: "Ship the feature"},
+		Tasks: []goaldecompose.TaskSpec{
+			{TaskID: "task-20260301-100000-plan", Title: "Plan", Agent: "claude"},
+			{TaskID: "task-20260301-100000-build", Title: "Build", Agent: "codex", DependsOn: []string{"task-20260301-100000-plan"}},
+			{TaskID: "task-20260301-100000-docs", Title: "Docs", Agent: "codex", DependsOn: []string{"task-20260301-100000-plan"}},
+			{TaskID: "task-20260301-100000-verify", Title: "Verify", Agent: "claude", DependsOn: []string{"task-20260301-100000-build", "task-20260301-100000-docs"}},
+		},
+	}
+}
+
+// recordingExecutor completes tasks by writing DONE, failing those in fail.
+type recordingExecutor struct {
+	mu      sync.Mutex
+	root    string
+	started []string
+	agents  map[string]string
+	fail    map[string]bool
+}
+
+func (e *recordingExecutor) run(projectID, taskID string, opts TaskOptions) error {
+	e.mu.Lock()
+	e.started = append(e.started, taskID)
+	if e.agents == nil {
+		e.agents = map[string]string{}
+	}
+	e.agents[taskID] = opts.Agent
+	fail := e.fail[taskID]
+	e.mu.Unlock()
+	if fail {
+		return errors.New("max restarts exceeded")
+	}
+	return os.WriteFile(filepath.Join(e.root, projectID, taskID, "DONE"), nil, 0o644)
+}
+
+func TestRunPipelineMaterializesAndRunsDAG(t *testing.T) {
+	root := t.TempDir()
+	exec := &recordingExecutor{root: root}
+	result, err := RunPipeline(testPipelineSpec(), PipelineOptions{RootDir: root, MaxParallel: 1, TaskExecutor: exec.run})
+	if err != nil {
+		t.Fatalf("RunPipeline: %v", err)
+	}
+	want := []string{"task-20260301-100000-plan", "task-20260301-100000-build", "task-20260301-100000-docs", "task-20260301-100000-verify"}
+	if !reflect.DeepEqual(exec.started, want) {
+		t.Fatalf("start order = %v, want %v", exec.started, want)
+	}
+	if result.State.Status != PipelineStatusCompleted {
+		t.Fatalf("status = %q", result.State.Status)
+	}
+	pipelineDir := PipelineDir(root, "my-project", "workflow-demo")
+	if _, err := os.Stat(filepath.Join(pipelineDir, "DONE")); err != nil {
+		t.Fatalf("pipeline DONE missing: %v", err)
+	}
+
+	verifyDir := filepath.Join(root, "my-project", "task-20260301-100000-verify")
+	deps, err := taskdeps.ReadDependsOn(verifyDir)
+	if err != nil || len(deps) != 2 {
+		t.Fatalf("depends_on = %v, %v", deps, err)
+	}
+	prompt, err := os.ReadFile(filepath.Join(verifyDir, "TASK.md"))
+	if err != nil || !strings.Contains(string(prompt), "Goal: Ship the feature") {
+		t.Fatalf("TASK.md = %q, %v", prompt, err)
+	}
+	state, err := LoadPipelineState(root, "my-project", "workflow-demo")
+	if err != nil || state.Counts()[PipelineStatusCompleted] != 4 {
+		t.Fatalf("state = %+v, %v", state, err)
+	}
+}
+
+func TestRunPipelineFailureSkipsDependentsAndResumes(t *testing.T) {
+	root := t.TempDir()
+	exec := &recordingExecutor{root: root, fail: map[string]bool{"task-20260301-100000-build": true}}
+	result, err := RunPipeline(testPipelineSpec(), PipelineOptions{RootDir: root, Agent: "gemini", TaskExecutor: exec.run})
+	if err == nil || !strings.Contains(err.Error(), "1 failed, 1 skipped") {
+		t.Fatalf("expected pipeline failure, got %v", err)
+	}
+	counts := result.State.Counts()
+	if counts[PipelineStatusCompleted] != 2 || counts[PipelineStatusFailed] != 1 || counts[PipelineStatusSkipped] != 1 {
+		t.Fatalf("counts = %v", counts)
+	}
+	if exec.agents["task-20260301-100000-docs"] != "gemini" {
+		t.Fatalf("agent override not applied: %v", exec.agents)
+	}
+	if _, err := os.Stat(filepath.Join(PipelineDir(root, "my-project", "workflow-demo"), "DONE")); !os.IsNotExist(err) {
+		t.Fatalf("failed pipeline has a DONE marker: %v", err)
+	}
+
+	exec.started, exec.fail = nil, nil
+	result, err = RunPipeline(testPipelineSpec(), PipelineOptions{RootDir: root, Resume: true, TaskExecutor: exec.run})
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if want := []string{"task-20260301-100000-build", "task-20260301-100000-verify"}; !reflect.DeepEqual(exec.started, want) {
+		t.Fatalf("resumed tasks = %v, want %v", exec.started, want)
+	}
+	if len(result.DoneTasks) != 2 || result.State.Status != PipelineStatusCompleted {
+		t.Fatalf("resume result = %+v", result)
+	}
+}
+
+func TestRunPipelineRejectsInvalidSpecs(t *testing.T) {
+	cycle := testPipelineSpec()
+	cycle.Tasks[0].DependsOn = []string{"task-20260301-100000-verify"}
+	for name, spec := range map[string]goaldecompose.WorkflowSpec{
+		"cycle":    cycle,
+		"no tasks": {WorkflowID: "w", ProjectID: "p"},
+		"bad id":   {WorkflowID: "../w", ProjectID: "p", Tasks: testPipelineSpec().Tasks},
+	} {
+		if _, err := RunPipeline(spec, PipelineOptions{RootDir: t.TempDir(), DryRun: true}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRunPipelineSaveFailureWaitsForRunningTasks(t *testing.T) {
+	root := t.TempDir()
+	spec := testPipelineSpec()
+	spec.Tasks = spec.Tasks[:1]
+	spec.Tasks = append(spec.Tasks, goaldecompose.TaskSpec{TaskID: "task-20260301-100000-slow", Title: "Slow"})
+	pipelineDir := PipelineDir(root, spec.ProjectID, spec.WorkflowID)
+	var slowDone bool
+	slowStarted := make(chan struct{})
+	executor := func(projectID, taskID string, opts TaskOptions) error {
+		if taskID == "task-20260301-100000-slow" {
+			close(slowStarted)
+			time.Sleep(100 * time.Millisecond)
+			slowDone = true
+			return nil
+		}
+		// Make every state write after both tasks started fail.
+		<-slowStarted
+		if err := os.RemoveAll(pipelineDir); err != nil {
+			return err
+		}
+		return os.WriteFile(pipelineDir, nil, 0o644)
+	}
+
+	finished := make(chan error, 1)
+	go func() {
+		_, err := RunPipeline(spec, PipelineOptions{RootDir: root, TaskExecutor: executor})
+		finished <- err
+	}()
+	select {
+	case err := <-finished:
+		if err == nil || !strings.Contains(err.Error(), "write pipeline state") {
+			t.Fatalf("RunPipeline = %v, want a state write error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("RunPipeline did not return after a state write error")
+	}
+	if !slowDone {
+		t.Fatalf("RunPipeline returned before the running task finished")
+	}
+}
@@ -26,6 +26,9 @@ type SpawnOptions struct {
 	Stdin   io.Reader
 	Stdout  io.Writer
 	Stderr  io.Writer
+	// CgroupDir, when set, is the cgroup v2 directory the process is
+	// started in (Linux only).
+	CgroupDir string
 }
 
 // Process represents a spawned agent process and its metadata.
@@ -92,14 +95,24 @@ func (pm *ProcessManager) SpawnAgent(ctx context.Context, agentType string, opts
 	cmd.Stdin = stdin
 
 	configureProcessGroup(cmd)
+	closeCgroup, err := applyCgroup(cmd, opts.CgroupDir)
+	if err != nil {
+		if stdinFile != nil {
+			_ = stdinFile.Close()
+		}
+		_ = capture.Close()
+		return nil, err
+	}
 
 	if err := cmd.Start(); err != nil {
+		closeCgroup()
 		if stdinFile != nil {
 			_ = stdinFile.Close()
 		}
 		_ = capture.Close()
 		return nil, errors.Wrap(err, "start process")
 	}
+	closeCgroup()
 	if stdinFile != nil {
 		_ = stdinFile.Close()
 	}
@@ -29,6 +29,10 @@ func TestSpawnAgentValidation(t *testing.T) {
 	if _, err := pm.SpawnAgent(context.Background(), "test", SpawnOptions{}); err == nil {
 		t.Fatalf("expected error for empty command")
 	}
+	missing := filepath.Join(runDir, "no-such-cgroup")
+	if _, err := pm.SpawnAgent(context.Background(), "test", SpawnOptions{Command: "echo", CgroupDir: missing}); err == nil {
+		t.Fatalf("expected error for missing cgroup dir")
+	}
 }
 
 func TestSpawnAgent(t *testing.T) {
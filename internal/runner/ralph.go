@@ -29,7 +29,7 @@ type RootRunner func(ctx context.Context, attempt int) error
 // RalphLoop implements the root agent restart loop.
 type RalphLoop struct {
 	runDir      string
-	messagebus  *messagebus.MessageBus
+	messagebus  messagebus.Bus
 	maxRestarts int
 	waitTimeout time.Duration
 
@@ -38,13 +38,14 @@ type RalphLoop struct {
 	projectID    string
 	taskID       string
 	runRoot      RootRunner
+	budget       Budget
 }
 
 // RalphOption configures the Ralph loop.
 type RalphOption func(*RalphLoop)
 
 // NewRalphLoop constructs a RalphLoop with defaults and validation.
-func NewRalphLoop(runDir string, bus *messagebus.MessageBus, opts ...RalphOption) (*RalphLoop, error) {
+func NewRalphLoop(runDir string, bus messagebus.Bus, opts ...RalphOption) (*RalphLoop, error) {
 	clean := filepath.Clean(strings.TrimSpace(runDir))
 	if clean == "." || clean == "" {
 		return nil, errors.New("run directory is empty")
@@ -147,6 +148,14 @@ func WithRootRunner(run RootRunner) RalphOption {
 	}
 }
 
+// WithBudget caps tokens, cost, wall-clock time and restarts across the
+// task and all of its descendant runs.
+func WithBudget(budget Budget) RalphOption {
+	return func(rl *RalphLoop) {
+		rl.budget = budget
+	}
+}
+
 // Run executes the Ralph loop until completion or error.
 func (rl *RalphLoop) Run(ctx context.Context) error {
 	if rl == nil {
@@ -156,6 +165,10 @@ func (rl *RalphLoop) Run(ctx context.Context) error {
 		ctx = context.Background()
 	}
 
+	// Cgroups of root runs are released once their children finished.
+	defer releasePendingCgroups()
+
+	guard := newBudgetGuard(rl.budget, rl.runDir, rl.projectID, rl.taskID, rl.pollInterval, rl.appendMessage)
 	restarts := 0
 	for {
 		if err := ctx.Err(); err != nil {
@@ -186,10 +199,23 @@ func (rl *RalphLoop) Run(ctx context.Context) error {
 			return errors.New("max restarts exceeded")
 		}
 
+		if err := guard.enforce(); err != nil {
+			return err
+		}
+
 		if err := rl.appendMessage("INFO", fmt.Sprintf("starting root agent (restart #%d)", restarts)); err != nil {
 			return err
 		}
-		if err := rl.runRoot(ctx, restarts); err != nil {
+		stopWatch := guard.watch()
+		err = rl.runRoot(ctx, restarts)
+		stopWatch()
+		if reason := guard.reason(); reason != "" {
+			return errors.Wrap(ErrBudgetExceeded, reason)
+		}
+		if stderrors.Is(err, ErrBudgetExceeded) {
+			return err
+		}
+		if err != nil {
 			if logErr := rl.appendMessage("WARNING", fmt.Sprintf("root agent failed on restart #%d: %v", restarts, err)); logErr != nil {
 				return logErr
 			}
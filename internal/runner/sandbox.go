@@ -0,0 +1,300 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/pkg/errors"
+)
+
+// sandboxSystemDirs are mounted read-only into bwrap sandboxes so that the
+// agent binary and its interpreter can run; missing ones are skipped.
+var sandboxSystemDirs = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/etc", "/opt", "/nix"}
+
+// sandboxCleanupTimeout bounds the container removal after a run.
+const sandboxCleanupTimeout = 30 * time.Second
+
+// sandboxCPUPeriod is the cpu.max period, in microseconds, of bwrap CPU limits.
+const sandboxCPUPeriod = 100000
+
+var containerNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// sandboxCommand is an agent command rewritten to run inside a sandbox.
+type sandboxCommand struct {
+	Path string
+	Args []string
+	// cleanup removes leftovers such as a container whose runtime client
+	// was killed; it is nil when nothing needs cleaning up.
+	cleanup func()
+}
+
+// sandboxRequest carries what wrapSandbox needs to confine one run.
+type sandboxRequest struct {
+	Path       string
+	Args       []string
+	WorkingDir string
+	RunDir     string
+	BusPath    string
+	Env        []string
+	// TokenVars are the agent token variables passed into containers.
+	TokenVars []string
+	// ConfigPaths are the agent's config files and directories below HOME.
+	ConfigPaths []string
+	Info        *storage.RunInfo
+}
+
+// wrapSandbox rewrites the agent command according to sb. The working
+// directory and the task directory (which holds the run directory, the
+// message bus and the DONE marker) are mounted read-write; everything else
+// the agent sees is read-only or absent. The wrapper stays the direct child
+// of the runner, so PID/PGID tracking, stop and liveness checks apply to it
+// unchanged: bwrap keeps its children in the caller's process group and
+// container clients proxy SIGTERM into the container.
+func wrapSandbox(sb *config.SandboxConfig, req sandboxRequest) (sandboxCommand, error) {
+	if !sb.Enabled() {
+		return sandboxCommand{Path: req.Path, Args: req.Args}, nil
+	}
+	mounts, err := sb.ParsedMounts()
+	if err != nil {
+		return sandboxCommand{}, errors.Wrap(err, "sandbox")
+	}
+	taskDir := filepath.Dir(filepath.Dir(req.RunDir))
+	writable := []string{req.WorkingDir, taskDir}
+	if busDir := filepath.Dir(req.BusPath); req.BusPath != "" && !pathWithin(busDir, taskDir) {
+		writable = append(writable, busDir)
+	}
+	runtime := sb.ModeName()
+	runtimePath, err := exec.LookPath(runtime)
+	if err != nil {
+		return sandboxCommand{}, errors.Wrapf(err, "sandbox mode %s", runtime)
+	}
+	if sb.IsContainer() {
+		return containerCommand(runtimePath, sb, req, writable, mounts), nil
+	}
+	return sandboxCommand{Path: runtimePath, Args: bwrapArgs(sb, req, writable, mounts)}, nil
+}
+
+// sandboxResources returns the run cgroup settings of a run in sb. bwrap
+// applies no limits, so the memory, cpus and pids_limit of a bwrap sandbox
+// become limits of the run cgroup, overriding those of resources.
+func sandboxResources(resources *config.ResourcesConfig, sb *config.SandboxConfig) *config.ResourcesConfig {
+	if sb.ModeName() != config.SandboxBwrap || (strings.TrimSpace(sb.Memory) == "" && sb.CPUs == 0 && sb.PidsLimit == 0) {
+		return resources
+	}
+	merged := config.ResourcesConfig{}
+	if resources != nil {
+		merged = *resources
+	}
+	if memory := strings.TrimSpace(sb.Memory); memory != "" {
+		merged.MemoryMax = strings.ToUpper(strings.TrimSuffix(strings.ToLower(memory), "b"))
+	}
+	if sb.CPUs > 0 {
+		quota := int64(sb.CPUs * sandboxCPUPeriod)
+		if quota < 1000 {
+			quota = 1000
+		}
+		merged.CPUMax = fmt.Sprintf("%d %d", quota, sandboxCPUPeriod)
+	}
+	if sb.PidsLimit > 0 {
+		merged.PidsMax = sb.PidsLimit
+	}
+	return &merged
+}
+
+// bwrapArgs builds a bubblewrap command line: fresh PID, IPC and UTS
+// namespaces, read-only system directories and PATH entries, a private /tmp
+// and HOME with the agent's config bound read-only, and read-write binds of
+// the writable directories.
+func bwrapArgs(sb *config.SandboxConfig, req sandboxRequest, writable []string, mounts []config.SandboxMount) []string {
+	args := []string{"--die-with-parent", "--unshare-pid", "--unshare-ipc", "--unshare-uts"}
+	if strings.EqualFold(strings.TrimSpace(sb.Network), config.SandboxNetworkNone) {
+		args = append(args, "--unshare-net")
+	}
+	for _, dir := range sandboxSystemDirs {
+		args = append(args, "--ro-bind-try", dir, dir)
+	}
+	args = append(args, "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp")
+	if home := envValue(req.Env, "HOME"); filepath.IsAbs(home) {
+		args = append(args, "--tmpfs", home)
+		// The agent CLI reads its login and settings from HOME.
+		for _, rel := range req.ConfigPaths {
+			path := filepath.Join(home, rel)
+			args = append(args, "--ro-bind-try", path, path)
+		}
+	}
+	for _, dir := range bwrapPathDirs(req) {
+		args = append(args, "--ro-bind-try", dir, dir)
+	}
+	for _, dir := range writable {
+		args = append(args, "--bind", dir, dir)
+	}
+	for _, mount := range mounts {
+		flag := "--ro-bind-try"
+		if mount.Writable {
+			flag = "--bind-try"
+		}
+		args = append(args, flag, mount.Path, mount.Path)
+	}
+	args = append(args, "--chdir", req.WorkingDir, "--", req.Path)
+	return append(args, req.Args...)
+}
+
+// bwrapPathDirs lists PATH entries and the agent binary directory that are
+// not already covered by the system directories.
+func bwrapPathDirs(req sandboxRequest) []string {
+	candidates := filepath.SplitList(envValue(req.Env, "PATH"))
+	if filepath.IsAbs(req.Path) {
+		candidates = append(candidates, filepath.Dir(req.Path))
+	}
+	if resolved, err := filepath.EvalSymlinks(req.Path); err == nil && filepath.IsAbs(resolved) {
+		candidates = append(candidates, filepath.Dir(resolved))
+	}
+	seen := make(map[string]struct{})
+	var dirs []string
+	for _, dir := range candidates {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if _, ok := seen[dir]; ok || underSystemDir(dir) {
+			continue
+		}
+		seen[dir] = struct{}{}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func underSystemDir(dir string) bool {
+	for _, sys := range sandboxSystemDirs {
+		if pathWithin(dir, sys) {
+			return true
+		}
+	}
+	return false
+}
+
+// containerCommand builds a podman or docker run command. Environment
+// variables are passed by name so that token values never appear on the
+// command line recorded in run-info.yaml.
+func containerCommand(runtimePath string, sb *config.SandboxConfig, req sandboxRequest, writable []string, mounts []config.SandboxMount) sandboxCommand {
+	name := containerName(req.Info)
+	args := []string{"run", "--rm", "-i", "--init", "--name", name}
+	if sb.ModeName() == config.SandboxPodman {
+		args = append(args, "--userns=keep-id")
+	} else {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+	}
+	if network := strings.ToLower(strings.TrimSpace(sb.Network)); network != "" {
+		args = append(args, "--network", network)
+	}
+	if memory := strings.TrimSpace(sb.Memory); memory != "" {
+		args = append(args, "--memory", memory)
+	}
+	if sb.CPUs > 0 {
+		args = append(args, "--cpus", strconv.FormatFloat(sb.CPUs, 'f', -1, 64))
+	}
+	if sb.PidsLimit > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(sb.PidsLimit))
+	}
+	for _, dir := range writable {
+		args = append(args, "-v", dir+":"+dir+":rw")
+	}
+	for _, mount := range mounts {
+		access := "ro"
+		if mount.Writable {
+			access = "rw"
+		}
+		args = append(args, "-v", mount.Path+":"+mount.Path+":"+access)
+	}
+	for _, key := range containerEnvNames(sb, req) {
+		args = append(args, "-e", key)
+	}
+	args = append(args, "-w", req.WorkingDir, strings.TrimSpace(sb.Image), req.Path)
+	args = append(args, req.Args...)
+
+	cleanup := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sandboxCleanupTimeout)
+		defer cancel()
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, runtimePath, "rm", "-f", name)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil && req.Info != nil {
+			obslog.Log(log.Default(), "WARN", "runner", "sandbox_cleanup_failed",
+				obslog.F("project_id", req.Info.ProjectID),
+				obslog.F("task_id", req.Info.TaskID),
+				obslog.F("run_id", req.Info.RunID),
+				obslog.F("container", name),
+				obslog.F("error", strings.TrimSpace(err.Error()+" "+stderr.String())),
+			)
+		}
+	}
+	return sandboxCommand{Path: runtimePath, Args: args, cleanup: cleanup}
+}
+
+// containerEnvNames returns the variables forwarded into a container: the
+// JRUN_* run context, the agent token variables and the configured names,
+// limited to those set in the run environment.
+func containerEnvNames(sb *config.SandboxConfig, req sandboxRequest) []string {
+	present := make(map[string]struct{}, len(req.Env))
+	for _, entry := range req.Env {
+		if key, _, ok := strings.Cut(entry, "="); ok {
+			present[key] = struct{}{}
+		}
+	}
+	names := make(map[string]struct{})
+	for key := range present {
+		if strings.HasPrefix(key, "JRUN_") {
+			names[key] = struct{}{}
+		}
+	}
+	for _, key := range append(append([]string(nil), req.TokenVars...), sb.Env...) {
+		if _, ok := present[key]; ok {
+			names[key] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(names))
+	for key := range names {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func containerName(info *storage.RunInfo) string {
+	if info == nil || info.RunID == "" {
+		return fmt.Sprintf("run-agent-%d", time.Now().UnixNano())
+	}
+	return "run-agent-" + containerNameUnsafe.ReplaceAllString(info.RunID, "_")
+}
+
+func envValue(env []string, key string) string {
+	value := ""
+	for _, entry := range env {
+		if k, v, ok := strings.Cut(entry, "="); ok && k == key {
+			value = v
+		}
+	}
+	if value == "" && env == nil {
+		return os.Getenv(key)
+	}
+	return value
+}
+
+func pathWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+func TestWrapSandboxDisabled(t *testing.T) {
+	for _, sb := range []*config.SandboxConfig{nil, {}, {Mode: "none"}} {
+		got, err := wrapSandbox(sb, sandboxRequest{Path: "claude", Args: []string{"-p"}})
+		if err != nil {
+			t.Fatalf("wrapSandbox: %v", err)
+		}
+		if got.Path != "claude" || strings.Join(got.Args, " ") != "-p" || got.cleanup != nil {
+			t.Fatalf("unexpected command: %+v", got)
+		}
+	}
+}
+
+func TestBwrapArgs(t *testing.T) {
+	sb := &config.SandboxConfig{Mode: "bwrap", Network: "none", Mounts: []string{"/srv/cache", "/srv/shared:rw"}}
+	mounts, err := sb.ParsedMounts()
+	if err != nil {
+		t.Fatalf("ParsedMounts: %v", err)
+	}
+	req := sandboxRequest{
+		Path:        "/home/u/.local/bin/claude",
+		Args:        []string{"-p", "--verbose"},
+		WorkingDir:  "/work/repo",
+		RunDir:      "/runs/p/t/runs/r1",
+		Env:         []string{"HOME=/home/u", "PATH=/home/u/.local/bin:/usr/bin"},
+		ConfigPaths: []string{".claude", ".claude.json"},
+	}
+	args := strings.Join(bwrapArgs(sb, req, []string{"/work/repo", "/runs/p/t"}, mounts), " ")
+	for _, want := range []string{
+		"--die-with-parent --unshare-pid --unshare-ipc --unshare-uts --unshare-net",
+		"--ro-bind-try /usr /usr",
+		"--tmpfs /home/u --ro-bind-try /home/u/.claude /home/u/.claude --ro-bind-try /home/u/.claude.json /home/u/.claude.json",
+		"--ro-bind-try /home/u/.local/bin /home/u/.local/bin",
+		"--bind /work/repo /work/repo --bind /runs/p/t /runs/p/t",
+		"--ro-bind-try /srv/cache /srv/cache --bind-try /srv/shared /srv/shared",
+		"--chdir /work/repo -- /home/u/.local/bin/claude -p --verbose",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("bwrap args missing %q:\n%s", want, args)
+		}
+	}
+	if strings.Contains(args, "--ro-bind-try /usr/bin /usr/bin") {
+		t.Fatalf("system PATH entries must not be bound twice:\n%s", args)
+	}
+}
+
+func TestSandboxResources(t *testing.T) {
+	defaults := &config.ResourcesConfig{MemoryMax: "8G", PidsMax: 1024, CgroupParent: "/agents.slice"}
+	got := sandboxResources(defaults, &config.SandboxConfig{Mode: "bwrap", Memory: "512m", CPUs: 1.5})
+	want := config.ResourcesConfig{CPUMax: "150000 100000", MemoryMax: "512M", PidsMax: 1024, CgroupParent: "/agents.slice"}
+	if got == nil || *got != want {
+		t.Fatalf("bwrap resources = %+v, want %+v", got, want)
+	}
+	if defaults.MemoryMax != "8G" {
+		t.Fatalf("defaults modified: %+v", defaults)
+	}
+	if got := sandboxResources(nil, &config.SandboxConfig{Mode: "bwrap", PidsLimit: 64}); got == nil || *got != (config.ResourcesConfig{PidsMax: 64}) {
+		t.Fatalf("bwrap resources without defaults = %+v", got)
+	}
+	if got := sandboxResources(defaults, &config.SandboxConfig{Mode: "podman", Image: "img", Memory: "1g"}); got != defaults {
+		t.Fatalf("container limits must stay with the runtime, got %+v", got)
+	}
+	if got := sandboxResources(nil, &config.SandboxConfig{Mode: "bwrap"}); got != nil {
+		t.Fatalf("bwrap without limits = %+v, want nil", got)
+	}
+}
+
+func TestContainerCommand(t *testing.T) {
+	sb := &config.SandboxConfig{
+		Mode:      "podman",
+		Image:     "ghcr.io/example/agents:1",
+		Network:   "none",
+		Memory:    "4g",
+		CPUs:      1.5,
+		PidsLimit: 256,
+		Env:       []string{"EXTRA", "UNSET"},
+	}
+	req := sandboxRequest{
+		Path:       "codex",
+		Args:       []string{"exec", "-"},
+		WorkingDir: "/work/repo",
+		RunDir:     "/runs/p/t/runs/r1",
+		Env:        []string{"JRUN_ID=r1", "OPENAI_API_KEY=sk-secret", "EXTRA=1", "OTHER=2"},
+		TokenVars:  []string{"OPENAI_API_KEY"},
+		Info:       &storage.RunInfo{RunID: "r1"},
+	}
+	cmd := containerCommand("/usr/bin/podman", sb, req, []string{"/work/repo", "/runs/p/t"}, nil)
+	args := strings.Join(cmd.Args, " ")
+	for _, want := range []string{
+		"run --rm -i --init --name run-agent-r1 --userns=keep-id",
+		"--network none --memory 4g --cpus 1.5 --pids-limit 256",
+		"-v /work/repo:/work/repo:rw -v /runs/p/t:/runs/p/t:rw",
+		"-e EXTRA -e JRUN_ID -e OPENAI_API_KEY",
+		"-w /work/repo ghcr.io/example/agents:1 codex exec -",
+	} {
+		if !strings.Contains(args, want) {
+			t.Fatalf("container args missing %q:\n%s", want, args)
+		}
+	}
+	if strings.Contains(args, "sk-secret") || strings.Contains(args, "OTHER") || strings.Contains(args, "UNSET") {
+		t.Fatalf("container args leak environment:\n%s", args)
+	}
+	if cmd.cleanup == nil {
+		t.Fatalf("expected container cleanup")
+	}
+}
+
+func TestRunJobSandboxBwrap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake sandbox uses sh")
+	}
+	root := t.TempDir()
+	binDir := filepath.Join(root, "bin")
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	// The fake bwrap records that it ran and executes the wrapped command.
+	fake := "#!/bin/sh\necho wrapped > \"$JRUN_RUN_FOLDER/sandboxed.txt\"\nwhile [ \"$1\" != \"--\" ]; do shift; done\nshift\nexec \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "bwrap"), []byte(fake), 0o755); err != nil {
+		t.Fatalf("write bwrap: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	script := filepath.Join(root, "agent.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho agent-ran\n"), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	configPath := filepath.Join(root, "config.yaml")
+	configContent := `agents:
+  scripted:
+    type: custom
+    command: ["` + script + `"]
+    sandbox:
+      network: none
+
+defaults:
+  agent: scripted
+  timeout: 10
+  sandbox:
+    mode: bwrap
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	if err := RunJob("project", "task-1", JobOptions{RootDir: root, ConfigPath: configPath, Prompt: "hi"}); err != nil {
+		t.Fatalf("RunJob: %v", err)
+	}
+	runsDir := filepath.Join(root, "project", "task-1", "runs")
+	runs, err := os.ReadDir(runsDir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("expected one run, got %v (%v)", runs, err)
+	}
+	runDir := filepath.Join(runsDir, runs[0].Name())
+	info, err := storage.ReadRunInfo(filepath.Join(runDir, "run-info.yaml"))
+	if err != nil {
+		t.Fatalf("read run-info: %v", err)
+	}
+	if info.Sandbox != config.SandboxBwrap || info.Status != storage.StatusCompleted {
+		t.Fatalf("unexpected run-info: sandbox=%q status=%q", info.Sandbox, info.Status)
+	}
+	if !strings.Contains(info.CommandLine, "--unshare-net") || !strings.Contains(info.CommandLine, "-- "+script) {
+		t.Fatalf("unexpected command line: %s", info.CommandLine)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, "sandboxed.txt")); err != nil {
+		t.Fatalf("agent did not run through the sandbox: %v", err)
+	}
+	stdout, err := os.ReadFile(info.StdoutPath)
+	if err != nil || !strings.Contains(string(stdout), "agent-ran") {
+		t.Fatalf("agent stdout = %q, %v", stdout, err)
+	}
+}
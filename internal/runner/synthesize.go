@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SynthesisRun is one run whose output is aggregated by SynthesizeRunOutputs.
+type SynthesisRun struct {
+	Label  string
+	RunDir string
+}
+
+// SynthesizeRunOutputs writes the outputs of runs as one markdown document,
+// a "## run: <label>" section per run. Runs without output are reported
+// inline, or fail the synthesis when strict is set.
+func SynthesizeRunOutputs(out io.Writer, runs []SynthesisRun, strict bool) error {
+	if len(runs) == 0 {
+		return fmt.Errorf("no run selectors provided")
+	}
+
+	var missingCount int
+	for _, run := range runs {
+		content, sourcePath, err := ReadRunOutput(run.RunDir)
+		if err != nil {
+			if strict {
+				return fmt.Errorf("run %s: %w", run.Label, err)
+			}
+			fmt.Fprintf(out, "## run: %s\n\n", run.Label)
+			fmt.Fprintf(out, "> WARNING: no output found for this run (path: %s)\n\n", run.RunDir)
+			missingCount++
+			continue
+		}
+
+		fmt.Fprintf(out, "## run: %s\n\n", run.Label)
+		fmt.Fprintf(out, "source: %s\n\n", sourcePath)
+		fmt.Fprintf(out, "%s\n\n", strings.TrimSpace(content))
+		fmt.Fprintf(out, "---\n\n")
+	}
+
+	if missingCount > 0 && !strict {
+		fmt.Fprintf(out, "> %d run(s) had no output artifact\n", missingCount)
+	}
+	return nil
+}
+
+// ReadRunOutput reads the best available output of a run directory:
+// output.md, falling back to agent-stdout.txt.
+func ReadRunOutput(runDir string) (content, sourcePath string, err error) {
+	outputPath := filepath.Join(runDir, "output.md")
+	if data, e := os.ReadFile(outputPath); e == nil {
+		return string(data), outputPath, nil
+	}
+
+	stdoutPath := filepath.Join(runDir, "agent-stdout.txt")
+	if data, e := os.ReadFile(stdoutPath); e == nil {
+		return string(data), stdoutPath, nil
+	}
+
+	return "", runDir, fmt.Errorf("no output.md or agent-stdout.txt found in %s", runDir)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
 	"github.com/jonnyzzz/conductor-loop/internal/obslog"
 	"github.com/jonnyzzz/conductor-loop/internal/taskdeps"
+	"github.com/jonnyzzz/conductor-loop/internal/worktree"
 	"github.com/pkg/errors"
 )
 
@@ -44,6 +45,12 @@ type TaskOptions struct {
 	// DependencyPollInterval controls how often dependency status is checked while blocked.
 	// Zero means a default interval is used.
 	DependencyPollInterval time.Duration
+	// Budget caps the task subtree; unset fields fall back to defaults.budget.
+	Budget Budget
+	// Isolation and OnDone configure per-task git worktree isolation; see
+	// JobOptions.
+	Isolation string
+	OnDone    string
 }
 
 // RunTask starts the root agent and enforces the Ralph loop.
@@ -67,6 +74,12 @@ func RunTask(projectID, taskID string, opts TaskOptions) error {
 	if err := ensureDir(taskDir); err != nil {
 		return errors.Wrap(err, "ensure task dir")
 	}
+	if _, err := worktree.NormalizeMode(opts.Isolation); err != nil {
+		return err
+	}
+	if _, err := worktree.NormalizePolicy(opts.OnDone); err != nil {
+		return err
+	}
 
 	// Resolve prompt from file if PromptPath is set
 	if path := strings.TrimSpace(opts.PromptPath); path != "" {
@@ -100,11 +113,22 @@ func RunTask(projectID, taskID string, opts TaskOptions) error {
 		}
 	}
 
+	cfg, err := loadConfig(opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+
 	busPath := filepath.Join(taskDir, "TASK-MESSAGE-BUS.md")
-	bus, err := messagebus.NewMessageBus(busPath)
+	if cfg != nil {
+		// Create the database of a sqlite bus before opening it, so that the
+		// task's own messages are written through it.
+		initBusBackend(cfg.Storage.BusBackend, busPath)
+	}
+	bus, err := messagebus.Open(busPath, "")
 	if err != nil {
 		return errors.Wrap(err, "new message bus")
 	}
+	defer bus.Close()
 	obslog.Log(log.Default(), "INFO", "runner", "task_run_started",
 		obslog.F("project_id", projectID),
 		obslog.F("task_id", taskID),
@@ -127,6 +151,18 @@ func RunTask(projectID, taskID string, opts TaskOptions) error {
 		return err
 	}
 
+	budget, err := opts.Budget.withDefaults(cfg)
+	if err != nil {
+		return errors.Wrap(err, "resolve budget")
+	}
+	if opts.ResumeMode {
+		// Resuming is an explicit decision to continue; drop the marker left
+		// by an earlier budget breach so the (possibly raised) budget applies.
+		if err := os.Remove(filepath.Join(taskDir, budgetExceededMarker)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "remove budget marker")
+		}
+	}
+
 	previousRunID := ""
 	runnerFn := func(ctx context.Context, attempt int) error {
 		jobPrompt := prompt
@@ -144,6 +180,8 @@ func RunTask(projectID, taskID string, opts TaskOptions) error {
 			Environment:    opts.Environment,
 			Timeout:        opts.Timeout,
 			ConductorURL:   opts.ConductorURL,
+			Isolation:      opts.Isolation,
+			OnDone:         opts.OnDone,
 		}
 		if attempt == 0 && strings.TrimSpace(opts.FirstRunDir) != "" {
 			jobOpts.PreallocatedRunDir = opts.FirstRunDir
@@ -171,6 +209,9 @@ func RunTask(projectID, taskID string, opts TaskOptions) error {
 	if opts.RestartDelay > 0 {
 		options = append(options, WithRestartDelay(opts.RestartDelay))
 	}
+	if !budget.IsZero() {
+		options = append(options, WithBudget(budget))
+	}
 
 	loop, err := NewRalphLoop(taskDir, bus, options...)
 	if err != nil {
@@ -188,6 +229,7 @@ func RunTask(projectID, taskID string, opts TaskOptions) error {
 		obslog.F("project_id", projectID),
 		obslog.F("task_id", taskID),
 	)
+	completeIsolation(taskDir, busPath, projectID, taskID)
 
 	propagationResult, err := propagateTaskCompletionToProject(rootDir, projectID, taskID, taskDir, busPath)
 	if err != nil {
@@ -241,7 +283,7 @@ func resolveTaskDependencies(rootDir, projectID, taskID, taskDir string, request
 	return dependsOn, nil
 }
 
-func waitForDependencies(taskDir, rootDir, projectID, taskID string, dependsOn []string, pollInterval time.Duration, bus *messagebus.MessageBus) error {
+func waitForDependencies(taskDir, rootDir, projectID, taskID string, dependsOn []string, pollInterval time.Duration, bus messagebus.Bus) error {
 	if len(dependsOn) == 0 {
 		return nil
 	}
@@ -279,7 +321,7 @@ func waitForDependencies(taskDir, rootDir, projectID, taskID string, dependsOn [
 	}
 }
 
-func appendDependencyMessage(bus *messagebus.MessageBus, projectID, taskID, msgType, body string) {
+func appendDependencyMessage(bus messagebus.Bus, projectID, taskID, msgType, body string) {
 	if bus == nil {
 		return
 	}
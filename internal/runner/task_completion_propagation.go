@@ -114,10 +114,11 @@ func propagateTaskCompletionToProject(rootDir, projectID, taskID, taskDir, taskB
 	if err := ensureDir(filepath.Dir(projectBusPath)); err != nil {
 		return result, errors.Wrap(err, "ensure project dir")
 	}
-	projectBus, err := messagebus.NewMessageBus(projectBusPath)
+	projectBus, err := messagebus.Open(projectBusPath, "")
 	if err != nil {
 		return result, errors.Wrap(err, "new project message bus")
 	}
+	defer projectBus.Close()
 
 	statePath := filepath.Join(cleanTaskDir, taskCompletionPropagationStateFile)
 	lockPath := filepath.Join(cleanTaskDir, taskCompletionPropagationLockFile)
@@ -258,10 +259,11 @@ func loadTaskCompletionRunSummary(taskDir string) (taskCompletionRunSummary, err
 }
 
 func readTaskFactSignals(taskBusPath, latestRunID string) ([]taskFactSignal, *messagebus.Message, error) {
-	bus, err := messagebus.NewMessageBus(taskBusPath)
+	bus, err := messagebus.Open(taskBusPath, "")
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "new task message bus")
 	}
+	defer bus.Close()
 	messages, err := bus.ReadMessages("")
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "read task message bus")
@@ -422,11 +424,11 @@ func writeAtomicFile(path string, data []byte, mode os.FileMode) error {
 	return nil
 }
 
-func findExistingPropagationMessage(projectBus *messagebus.MessageBus, taskID, propagationKey string) (*messagebus.Message, error) {
+func findExistingPropagationMessage(projectBus messagebus.Bus, taskID, propagationKey string) (*messagebus.Message, error) {
 	if projectBus == nil {
 		return nil, errors.New("project message bus is nil")
 	}
-	messages, err := projectBus.ReadMessages("")
+	messages, err := projectBus.ReadMessagesByType(0, "FACT")
 	if err != nil {
 		return nil, errors.Wrap(err, "read project message bus")
 	}
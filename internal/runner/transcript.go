@@ -0,0 +1,195 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+	"github.com/jonnyzzz/conductor-loop/internal/obslog"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/pkg/errors"
+)
+
+// transcriptPollInterval is how often a running agent's stdout is converted
+// into transcript events. It is a package-level var so tests can shorten it.
+var transcriptPollInterval = 500 * time.Millisecond
+
+// transcriptFollower tails agent-stdout.txt while the agent runs and appends
+// normalized events to transcript.jsonl. Transcript failures are logged and
+// never fail the run.
+type transcriptFollower struct {
+	info       *storage.RunInfo
+	stdoutPath string
+	parser     transcript.Parser
+	writer     *transcript.Writer
+
+	mu      sync.Mutex
+	offset  int64
+	partial []byte
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startTranscript creates transcript.jsonl in runDir and starts following
+// the run's stdout. It returns nil when the transcript cannot be created.
+func startTranscript(desc agent.Descriptor, runDir string, info *storage.RunInfo) *transcriptFollower {
+	writer, err := transcript.Create(filepath.Join(runDir, transcript.FileName))
+	if err != nil {
+		logTranscriptError(info, err)
+		return nil
+	}
+	parser := transcript.NewTextParser()
+	if desc.NewTranscriptParser != nil {
+		parser = desc.NewTranscriptParser()
+	}
+	f := &transcriptFollower{
+		info:       info,
+		stdoutPath: info.StdoutPath,
+		parser:     parser,
+		writer:     writer,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go f.loop()
+	return f
+}
+
+func (f *transcriptFollower) loop() {
+	defer close(f.done)
+	ticker := time.NewTicker(transcriptPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.poll()
+		}
+	}
+}
+
+// poll converts the complete stdout lines written since the last poll.
+func (f *transcriptFollower) poll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.Open(f.stdoutPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	if _, err := file.Seek(f.offset, io.SeekStart); err != nil {
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil || len(data) == 0 {
+		return
+	}
+	f.offset += int64(len(data))
+	data = append(f.partial, data...)
+	last := bytes.LastIndexByte(data, '\n')
+	if last < 0 {
+		f.partial = data
+		return
+	}
+	f.partial = append([]byte(nil), data[last+1:]...)
+	var events []transcript.Event
+	for _, line := range bytes.Split(data[:last], []byte("\n")) {
+		events = append(events, f.parser.ParseLine(line)...)
+	}
+	f.write(events)
+}
+
+// finish stops following, converts the remaining output and appends the
+// run's usage and error events before closing the transcript.
+func (f *transcriptFollower) finish(usage *storage.Usage, errText string) {
+	if f == nil {
+		return
+	}
+	close(f.stop)
+	<-f.done
+	f.poll()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var events []transcript.Event
+	if len(f.partial) > 0 {
+		events = append(events, f.parser.ParseLine(f.partial)...)
+		f.partial = nil
+	}
+	events = append(events, f.parser.Flush()...)
+	if usage != nil && !usage.IsZero() {
+		total := *usage
+		events = append(events, transcript.Event{Type: transcript.TypeUsage, Usage: &total})
+	}
+	if errText = strings.TrimSpace(errText); errText != "" {
+		events = append(events, transcript.Event{Type: transcript.TypeError, Text: errText})
+	}
+	f.write(events)
+	if err := f.writer.Close(); err != nil {
+		logTranscriptError(f.info, err)
+	}
+}
+
+func (f *transcriptFollower) write(events []transcript.Event) {
+	if err := f.writer.Write(events...); err != nil {
+		logTranscriptError(f.info, err)
+	}
+}
+
+func logTranscriptError(info *storage.RunInfo, err error) {
+	obslog.Log(log.Default(), "WARN", "runner", "transcript_write_failed",
+		obslog.F("project_id", info.ProjectID),
+		obslog.F("task_id", info.TaskID),
+		obslog.F("run_id", info.RunID),
+		obslog.F("error", err),
+	)
+}
+
+// ReadTranscript returns the normalized transcript of the run in runDir.
+// Runs recorded before transcripts existed get one derived from their
+// agent-stdout.txt with the parser of the run's agent type.
+func ReadTranscript(runDir string, info *storage.RunInfo) ([]transcript.Event, error) {
+	events, err := transcript.Read(filepath.Join(runDir, transcript.FileName))
+	if err == nil || !os.IsNotExist(errors.Cause(err)) {
+		return events, err
+	}
+	stdoutPath := filepath.Join(runDir, "agent-stdout.txt")
+	if info != nil && strings.TrimSpace(info.StdoutPath) != "" {
+		stdoutPath = info.StdoutPath
+	}
+	data, readErr := os.ReadFile(stdoutPath)
+	if readErr != nil {
+		return nil, err
+	}
+	parser := transcript.NewTextParser()
+	if info != nil {
+		if desc, ok := agent.Lookup(info.AgentType); ok && desc.NewTranscriptParser != nil {
+			parser = desc.NewTranscriptParser()
+		}
+	}
+	events = transcript.Parse(data, parser)
+	var ts time.Time
+	if info != nil {
+		ts = info.EndTime
+		if info.Usage != nil && !info.Usage.IsZero() {
+			total := *info.Usage
+			events = append(events, transcript.Event{Type: transcript.TypeUsage, Usage: &total})
+		}
+		if info.Status == storage.StatusFailed && strings.TrimSpace(info.ErrorSummary) != "" {
+			events = append(events, transcript.Event{Type: transcript.TypeError, Text: strings.TrimSpace(info.ErrorSummary)})
+		}
+	}
+	for i := range events {
+		events[i].Seq = int64(i + 1)
+		events[i].Time = ts
+	}
+	return events, nil
+}
@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent/transcript"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+func TestTranscriptFollowerConvertsStdoutIncrementally(t *testing.T) {
+	prev := transcriptPollInterval
+	transcriptPollInterval = 10 * time.Millisecond
+	defer func() { transcriptPollInterval = prev }()
+
+	runDir := t.TempDir()
+	info := &storage.RunInfo{ProjectID: "p", TaskID: "t", RunID: "r", StdoutPath: filepath.Join(runDir, "agent-stdout.txt")}
+	follower := startTranscript(mustDescriptor(t, "claude"), runDir, info)
+	if follower == nil {
+		t.Fatal("expected transcript follower")
+	}
+
+	first := `{"type":"assistant","message":{"content":[{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"ls"}}]}}` + "\n"
+	if err := os.WriteFile(info.StdoutPath, []byte(first), 0o644); err != nil {
+		t.Fatalf("write stdout: %v", err)
+	}
+	path := filepath.Join(runDir, transcript.FileName)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		events, _ := transcript.Read(path)
+		if len(events) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tool call was not written while running; got %+v", events)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The last line has no trailing newline; finish must still convert it.
+	rest := first + `{"type":"assistant","message":{"content":[{"type":"text","text":"Done."}]}}`
+	if err := os.WriteFile(info.StdoutPath, []byte(rest), 0o644); err != nil {
+		t.Fatalf("write stdout: %v", err)
+	}
+	follower.finish(&storage.Usage{InputTokens: 7, OutputTokens: 3}, "exit code 1")
+
+	events, err := transcript.Read(path)
+	if err != nil {
+		t.Fatalf("read transcript: %v", err)
+	}
+	wantTypes := []string{transcript.TypeToolCall, transcript.TypeAssistantText, transcript.TypeUsage, transcript.TypeError}
+	if len(events) != len(wantTypes) {
+		t.Fatalf("expected %d events, got %+v", len(wantTypes), events)
+	}
+	for i, want := range wantTypes {
+		if events[i].Type != want || events[i].Seq != int64(i+1) {
+			t.Fatalf("event %d = %+v, want type %q", i, events[i], want)
+		}
+	}
+	if events[2].Usage.InputTokens != 7 || events[3].Text != "exit code 1" {
+		t.Fatalf("unexpected closing events: %+v %+v", events[2], events[3])
+	}
+}
+
+func TestReadTranscriptDerivesFromStdout(t *testing.T) {
+	runDir := t.TempDir()
+	stdout := `{"type":"item.completed","item":{"id":"item_1","type":"agent_message","text":"hi"}}` + "\n"
+	if err := os.WriteFile(filepath.Join(runDir, "agent-stdout.txt"), []byte(stdout), 0o644); err != nil {
+		t.Fatalf("write stdout: %v", err)
+	}
+	info := &storage.RunInfo{
+		AgentType:    "codex",
+		Status:       storage.StatusFailed,
+		ErrorSummary: "timed out",
+		EndTime:      time.Now().UTC(),
+		Usage:        &storage.Usage{InputTokens: 1, OutputTokens: 1},
+	}
+	events, err := ReadTranscript(runDir, info)
+	if err != nil {
+		t.Fatalf("ReadTranscript: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	if events[0].Type != transcript.TypeAssistantText || events[0].Text != "hi" {
+		t.Fatalf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Type != transcript.TypeUsage || events[2].Type != transcript.TypeError || events[2].Seq != 3 {
+		t.Fatalf("unexpected closing events: %+v", events[1:])
+	}
+}
+
+func TestReadTranscriptMissing(t *testing.T) {
+	if _, err := ReadTranscript(t.TempDir(), nil); err == nil {
+		t.Fatal("expected error for run without transcript or stdout")
+	}
+}
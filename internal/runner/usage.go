@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// parseCLIUsage extracts token usage from a CLI agent's captured stdout.
+// Returns nil when the agent output carries no usage information.
+func parseCLIUsage(desc agent.Descriptor, stdoutPath string) *storage.Usage {
+	if strings.TrimSpace(stdoutPath) == "" || desc.ParseUsage == nil {
+		return nil
+	}
+	data, err := os.ReadFile(stdoutPath)
+	if err != nil {
+		return nil
+	}
+	usage, ok := desc.ParseUsage(data)
+	if !ok {
+		return nil
+	}
+	return &usage
+}
+
+// restUsage returns the usage collected by an in-process REST agent, if any.
+func restUsage(impl agent.Agent) *storage.Usage {
+	reporter, ok := impl.(agent.UsageReporter)
+	if !ok {
+		return nil
+	}
+	usage, ok := reporter.Usage()
+	if !ok {
+		return nil
+	}
+	return &usage
+}
+
+// priceUsage estimates usage.CostUSD from the configured price table when the
+// agent did not report a cost. The model reported by the agent is preferred,
+// then the configured model, the agent name and finally the agent type.
+// Returns true when a cost was filled in.
+func priceUsage(cfg *config.Config, selection agentSelection, agentType string, usage *storage.Usage) bool {
+	if cfg == nil || usage == nil || usage.CostUSD > 0 {
+		return false
+	}
+	price, ok := cfg.PriceFor(usage.Model, selection.Config.Model, selection.Name, agentType)
+	if !ok {
+		return false
+	}
+	usage.CostUSD = price.Cost(usage.InputTokens, usage.CachedInputTokens, usage.OutputTokens)
+	usage.CostSource = storage.CostSourcePriceTable
+	return true
+}
+
+// usagePricer returns the function that prices the usage of a finished run
+// of selection. The run calls it before persisting the usage into
+// run-info.yaml and reporting it in RUN_STOP.
+func usagePricer(cfg *config.Config, selection agentSelection, agentType string) func(*storage.Usage) {
+	return func(usage *storage.Usage) {
+		priceUsage(cfg, selection, agentType, usage)
+	}
+}
+
+// formatUsageLine renders a one-line usage summary for RUN_STOP messages.
+// Returns an empty string when no usage was recorded.
+func formatUsageLine(usage *storage.Usage) string {
+	if usage == nil || usage.IsZero() {
+		return ""
+	}
+	line := fmt.Sprintf("usage: %d input", usage.InputTokens)
+	if usage.CachedInputTokens > 0 {
+		line += fmt.Sprintf(" (%d cached)", usage.CachedInputTokens)
+	}
+	line += fmt.Sprintf(" / %d output tokens", usage.OutputTokens)
+	if usage.CostUSD > 0 {
+		line += fmt.Sprintf(", $%.4f", usage.CostUSD)
+	}
+	if usage.Model != "" {
+		line += fmt.Sprintf(" (%s)", usage.Model)
+	}
+	return line
+}
@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/agent"
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+func TestParseCLIUsageClaude(t *testing.T) {
+	dir := t.TempDir()
+	stdout := filepath.Join(dir, "agent-stdout.txt")
+	data := `{"type":"system","subtype":"init","model":"claude-sonnet-4-5"}
+{"type":"result","subtype":"success","is_error":false,"result":"ok","usage":{"input_tokens":10,"output_tokens":20}}`
+	if err := os.WriteFile(stdout, []byte(data), 0o644); err != nil {
+		t.Fatalf("write stdout: %v", err)
+	}
+	usage := parseCLIUsage(mustDescriptor(t, "claude"), stdout)
+	if usage == nil {
+		t.Fatal("expected usage")
+	}
+	if usage.InputTokens != 10 || usage.OutputTokens != 20 || usage.Model != "claude-sonnet-4-5" {
+		t.Fatalf("unexpected usage: %+v", *usage)
+	}
+	if got := parseCLIUsage(agent.Descriptor{Type: "unknown"}, stdout); got != nil {
+		t.Fatalf("expected nil usage for unknown agent, got %+v", *got)
+	}
+	if got := parseCLIUsage(mustDescriptor(t, "claude"), filepath.Join(dir, "missing.txt")); got != nil {
+		t.Fatalf("expected nil usage for missing stdout, got %+v", *got)
+	}
+}
+
+func TestPriceUsage(t *testing.T) {
+	cfg := &config.Config{Pricing: map[string]config.PriceConfig{
+		"codex": {InputPerMTok: 1, OutputPerMTok: 10},
+	}}
+	usage := &storage.Usage{InputTokens: 1_000_000, OutputTokens: 100_000}
+	if !priceUsage(cfg, agentSelection{Name: "codex", Type: "codex"}, "codex", usage) {
+		t.Fatal("expected usage to be priced")
+	}
+	if usage.CostUSD != 2 || usage.CostSource != storage.CostSourcePriceTable {
+		t.Fatalf("unexpected cost: %v (%s)", usage.CostUSD, usage.CostSource)
+	}
+
+	reported := &storage.Usage{InputTokens: 10, CostUSD: 0.5, CostSource: storage.CostSourceAgent}
+	if priceUsage(cfg, agentSelection{Name: "codex", Type: "codex"}, "codex", reported) {
+		t.Fatal("agent-reported cost must not be overridden")
+	}
+	if priceUsage(cfg, agentSelection{Name: "claude", Type: "claude"}, "claude", &storage.Usage{InputTokens: 1}) {
+		t.Fatal("expected no price for unconfigured agent")
+	}
+}
+
+func TestExecuteCLIPricesUsageBeforeRunStop(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI is a shell script")
+	}
+	runDir := t.TempDir()
+	binDir := filepath.Join(runDir, "bin")
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		t.Fatalf("mkdir bin: %v", err)
+	}
+	script := "#!/bin/sh\ncat >/dev/null\necho '{\"type\":\"turn.completed\",\"usage\":{\"input_tokens\":2000000,\"output_tokens\":0}}'\n"
+	if err := os.WriteFile(filepath.Join(binDir, "codex"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	promptPath := filepath.Join(runDir, "prompt.md")
+	if err := os.WriteFile(promptPath, []byte("prompt"), 0o644); err != nil {
+		t.Fatalf("write prompt: %v", err)
+	}
+	busPath := filepath.Join(runDir, "TASK-MESSAGE-BUS.md")
+	info := &storage.RunInfo{
+		RunID:      "run-1",
+		ProjectID:  "project",
+		TaskID:     "task",
+		AgentType:  "codex",
+		StdoutPath: filepath.Join(runDir, "agent-stdout.txt"),
+		StderrPath: filepath.Join(runDir, "agent-stderr.txt"),
+		OutputPath: filepath.Join(runDir, "output.md"),
+		Status:     storage.StatusRunning,
+	}
+	cfg := &config.Config{Pricing: map[string]config.PriceConfig{"codex": {InputPerMTok: 1.5}}}
+	price := usagePricer(cfg, agentSelection{Name: "codex", Type: "codex"}, "codex")
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if _, err := executeCLI(context.Background(), mustDescriptor(t, "codex"), promptPath, runDir, os.Environ(), runDir, busPath, info, price, nil, nil, 0); err != nil {
+		t.Fatalf("executeCLI: %v", err)
+	}
+
+	stored, err := storage.ReadRunInfo(filepath.Join(runDir, "run-info.yaml"))
+	if err != nil {
+		t.Fatalf("read run-info: %v", err)
+	}
+	if stored.Usage == nil || stored.Usage.CostUSD != 3 {
+		t.Fatalf("expected persisted cost 3, got %+v", stored.Usage)
+	}
+	bus, err := messagebus.Open(busPath, "")
+	if err != nil {
+		t.Fatalf("open bus: %v", err)
+	}
+	defer bus.Close()
+	stops, err := bus.ReadMessagesByType(0, messagebus.EventTypeRunStop)
+	if err != nil || len(stops) != 1 {
+		t.Fatalf("RUN_STOP messages = %v, %v", stops, err)
+	}
+	if !strings.Contains(stops[0].Body, "$3.0000") {
+		t.Fatalf("RUN_STOP body lacks the cost:\n%s", stops[0].Body)
+	}
+}
+
+func TestFormatUsageLine(t *testing.T) {
+	if got := formatUsageLine(nil); got != "" {
+		t.Fatalf("expected empty line for nil usage, got %q", got)
+	}
+	line := formatUsageLine(&storage.Usage{InputTokens: 100, CachedInputTokens: 40, OutputTokens: 7, CostUSD: 0.0123, Model: "m"})
+	for _, want := range []string{"100 input", "40 cached", "7 output", "$0.0123", "(m)"} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("expected %q in %q", want, line)
+		}
+	}
+}
@@ -16,13 +16,6 @@ import (
 	"github.com/jonnyzzz/conductor-loop/internal/obslog"
 )
 
-// minVersions defines the minimum supported CLI version per agent type.
-var minVersions = map[string][3]int{
-	"claude": {1, 0, 0},
-	"codex":  {0, 1, 0},
-	"gemini": {0, 1, 0},
-}
-
 // semverRe matches a semantic version pattern (with optional v prefix).
 var semverRe = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)`)
 
@@ -34,14 +27,21 @@ func ValidateAgent(ctx context.Context, agentType string) error {
 	if clean == "" {
 		return errors.New("agent type is empty")
 	}
+	desc, ok := agent.Lookup(clean)
+	if !ok {
+		return errors.Errorf("unknown agent type %q", clean)
+	}
+	return validateDescriptor(ctx, desc)
+}
 
-	if isRestAgent(clean) {
+func validateDescriptor(ctx context.Context, desc agent.Descriptor) error {
+	if desc.REST {
 		return nil
 	}
-
-	command := cliCommand(clean)
+	clean := desc.Type
+	command := desc.Binary
 	if command == "" {
-		return errors.Errorf("unknown cli agent type %q", clean)
+		return errors.Errorf("cli agent type %q has no binary", clean)
 	}
 
 	path, err := exec.LookPath(command)
@@ -49,6 +49,10 @@ func ValidateAgent(ctx context.Context, agentType string) error {
 		return errors.Errorf("agent cli %q not found in PATH: %v", command, err)
 	}
 
+	if !desc.ProbeVersion {
+		return nil
+	}
+
 	version, err := agent.DetectCLIVersion(ctx, path)
 	if err != nil {
 		obslog.Log(log.Default(), "WARN", "runner", "agent_version_detect_failed",
@@ -66,12 +70,16 @@ func ValidateAgent(ctx context.Context, agentType string) error {
 		obslog.F("path", path),
 	)
 
-	if minVer, ok := minVersions[clean]; ok {
-		if !isVersionCompatible(version, minVer) {
+	if desc.MinVersion != "" {
+		major, minor, patch, err := parseVersion(desc.MinVersion)
+		if err != nil {
+			return errors.Wrapf(err, "agent type %q min version", clean)
+		}
+		if !isVersionCompatible(version, [3]int{major, minor, patch}) {
 			obslog.Log(log.Default(), "WARN", "runner", "agent_version_below_minimum",
 				obslog.F("agent_type", clean),
 				obslog.F("version", version),
-				obslog.F("min_version", fmt.Sprintf("%d.%d.%d", minVer[0], minVer[1], minVer[2])),
+				obslog.F("min_version", desc.MinVersion),
 			)
 		}
 	}
@@ -109,36 +117,24 @@ func isVersionCompatible(detected string, minVersion [3]int) bool {
 	return patch >= minVersion[2]
 }
 
-// cliCommand returns the CLI binary name for a given agent type.
-func cliCommand(agentType string) string {
-	switch strings.ToLower(agentType) {
-	case "claude":
-		return "claude"
-	case "codex":
-		return "codex"
-	case "gemini":
-		return "gemini"
-	default:
-		return ""
-	}
-}
-
 // ValidateToken checks if a token is configured for the given agent type.
 // It returns a warning (non-nil error) if the token appears to be missing,
 // but callers should treat this as advisory only.
 func ValidateToken(agentType string, token string) error {
 	agentType = strings.ToLower(strings.TrimSpace(agentType))
 
+	desc, _ := agent.Lookup(agentType)
+
 	// For REST agents, check the provided token
-	if isRestAgent(agentType) {
-		if strings.TrimSpace(token) == "" {
+	if desc.REST {
+		if strings.TrimSpace(token) == "" && !desc.TokenOptional {
 			return fmt.Errorf("agent %q: no token configured; set token in config or via environment", agentType)
 		}
 		return nil
 	}
 
 	// For CLI agents, check environment variable
-	envVar := tokenEnvVar(agentType)
+	envVar := desc.TokenEnvVar
 	if envVar != "" && os.Getenv(envVar) == "" {
 		// Check if there's a token in config that will be injected
 		if strings.TrimSpace(token) == "" {
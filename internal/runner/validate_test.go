@@ -262,6 +262,12 @@ func TestValidateToken(t *testing.T) {
 			envValue:  "",
 			wantErr:   false,
 		},
+		{
+			name:      "openai-compatible without token",
+			agentType: "openai-compatible",
+			token:     "",
+			wantErr:   false,
+		},
 		{
 			name:      "unknown agent type",
 			agentType: "unknown-agent",
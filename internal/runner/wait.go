@@ -21,6 +21,7 @@ var ErrChildWaitTimeout = errors.New("child wait timeout")
 // ChildProcess captures minimal run metadata for a child process.
 type ChildProcess struct {
 	RunID       string
+	ParentRunID string
 	PID         int
 	PGID        int
 	RunInfoPath string
@@ -73,6 +74,7 @@ func FindActiveChildren(runDir string) ([]ChildProcess, error) {
 		if alive {
 			children = append(children, ChildProcess{
 				RunID:       info.RunID,
+				ParentRunID: info.ParentRunID,
 				PID:         info.PID,
 				PGID:        info.PGID,
 				RunInfoPath: path,
@@ -16,7 +16,7 @@ import (
 )
 
 const (
-	// WorkflowTemplatePromptV5 is the currently supported staged workflow template.
+	// WorkflowTemplatePromptV5 is the built-in staged workflow template.
 	WorkflowTemplatePromptV5 = "THE_PROMPT_v5"
 
 	workflowStateVersion = 1
@@ -25,6 +25,7 @@ const (
 	workflowStageStatusRunning   = "running"
 	workflowStageStatusCompleted = "completed"
 	workflowStageStatusFailed    = "failed"
+	workflowStageStatusSkipped   = "skipped"
 )
 
 var workflowStageTitles = map[int]string{
@@ -56,6 +57,12 @@ type WorkflowOptions struct {
 	DryRun         bool
 	Timeout        time.Duration
 	StatePath      string
+	// Vars are template variables ({{.Vars.name}}); they override the vars
+	// of the template.
+	Vars map[string]string
+	// TemplateDirs are searched for templates after the project workflows
+	// directory and before workflows.dirs of the config.
+	TemplateDirs []string
 
 	stageExecutor workflowStageExecutor
 }
@@ -63,12 +70,14 @@ type WorkflowOptions struct {
 // WorkflowResult describes the final workflow execution state.
 type WorkflowResult struct {
 	Template       string        `json:"template"`
+	TemplateSource string        `json:"template_source,omitempty"`
 	FromStage      int           `json:"from_stage"`
 	ToStage        int           `json:"to_stage"`
 	Resume         bool          `json:"resume"`
 	DryRun         bool          `json:"dry_run"`
 	StatePath      string        `json:"state_path"`
 	PlannedStages  []int         `json:"planned_stages"`
+	PlannedSteps   [][]int       `json:"planned_steps"`
 	ExecutedStages []int         `json:"executed_stages"`
 	SkippedStages  []int         `json:"skipped_stages"`
 	State          WorkflowState `json:"state"`
@@ -86,15 +95,20 @@ type WorkflowState struct {
 	UpdatedAt   time.Time       `json:"updated_at" yaml:"updated_at"`
 	CompletedAt time.Time       `json:"completed_at,omitempty" yaml:"completed_at,omitempty"`
 	Stages      []WorkflowStage `json:"stages" yaml:"stages"`
+	Jumps       []WorkflowJump  `json:"jumps,omitempty" yaml:"jumps,omitempty"`
 }
 
-// WorkflowStage tracks execution status for one template stage.
+// WorkflowStage tracks execution status for one template stage. RunIDs
+// lists the runs of the instances of a fan-out stage; Goto is the stage a
+// route of the stage selected.
 type WorkflowStage struct {
 	Stage     int       `json:"stage" yaml:"stage"`
 	Name      string    `json:"name" yaml:"name"`
 	Status    string    `json:"status" yaml:"status"`
 	Attempts  int       `json:"attempts" yaml:"attempts"`
 	RunID     string    `json:"run_id,omitempty" yaml:"run_id,omitempty"`
+	RunIDs    []string  `json:"run_ids,omitempty" yaml:"run_ids,omitempty"`
+	Goto      *int      `json:"goto,omitempty" yaml:"goto,omitempty"`
 	StartedAt time.Time `json:"started_at,omitempty" yaml:"started_at,omitempty"`
 	EndedAt   time.Time `json:"ended_at,omitempty" yaml:"ended_at,omitempty"`
 	Error     string    `json:"error,omitempty" yaml:"error,omitempty"`
@@ -116,23 +130,29 @@ func RunWorkflow(projectID, taskID string, opts WorkflowOptions) (*WorkflowResul
 		return nil, err
 	}
 
-	template, err := normalizeWorkflowTemplate(opts.Template)
+	rootDir, err := resolveRootDir(opts.RootDir)
 	if err != nil {
 		return nil, err
 	}
-	fromStage, toStage, err := normalizeWorkflowStageRange(template, opts.FromStage, opts.ToStage)
+	taskDir, err := resolveTaskDir(rootDir, projectID, taskID)
 	if err != nil {
 		return nil, err
 	}
 
-	rootDir, err := resolveRootDir(opts.RootDir)
+	dirs, err := WorkflowTemplateDirs(rootDir, projectID, opts.ConfigPath, opts.TemplateDirs)
 	if err != nil {
 		return nil, err
 	}
-	taskDir, err := resolveTaskDir(rootDir, projectID, taskID)
+	tmpl, err := ResolveWorkflowTemplate(opts.Template, dirs)
+	if err != nil {
+		return nil, err
+	}
+	template := tmpl.Name
+	fromStage, toStage, err := normalizeWorkflowStageRange(tmpl, opts.FromStage, opts.ToStage)
 	if err != nil {
 		return nil, err
 	}
+
 	if err := ensureDir(taskDir); err != nil {
 		return nil, errors.Wrap(err, "ensure task dir")
 	}
@@ -152,16 +172,24 @@ func RunWorkflow(projectID, taskID string, opts WorkflowOptions) (*WorkflowResul
 	if err != nil {
 		return nil, err
 	}
+	for _, stageNum := range workflowStageNumbers(fromStage, toStage) {
+		findOrCreateWorkflowStage(state, stageNum).Name = tmpl.Stages[stageNum].Name
+	}
+	if err := saveWorkflowState(statePath, state); err != nil {
+		return nil, err
+	}
 
 	result := &WorkflowResult{
-		Template:      template,
-		FromStage:     fromStage,
-		ToStage:       toStage,
-		Resume:        opts.Resume,
-		DryRun:        opts.DryRun,
-		StatePath:     statePath,
-		PlannedStages: workflowStageNumbers(fromStage, toStage),
-		State:         *state,
+		Template:       template,
+		TemplateSource: tmpl.Source,
+		FromStage:      fromStage,
+		ToStage:        toStage,
+		Resume:         opts.Resume,
+		DryRun:         opts.DryRun,
+		StatePath:      statePath,
+		PlannedStages:  workflowStageNumbers(fromStage, toStage),
+		PlannedSteps:   tmpl.workflowSteps(fromStage, toStage),
+		State:          *state,
 	}
 
 	mode := "fresh"
@@ -183,58 +211,29 @@ func RunWorkflow(projectID, taskID string, opts WorkflowOptions) (*WorkflowResul
 		execStage = runWorkflowStage
 	}
 
-	for _, stageNum := range result.PlannedStages {
-		entry := findOrCreateWorkflowStage(state, stageNum)
-		if opts.Resume && entry.Status == workflowStageStatusCompleted {
-			result.SkippedStages = append(result.SkippedStages, stageNum)
-			_ = postWorkflowBusMessage(busPath, projectID, taskID, entry.RunID, "DECISION",
-				fmt.Sprintf("workflow stage %d skipped (already completed)", stageNum))
-			continue
-		}
-
-		result.ExecutedStages = append(result.ExecutedStages, stageNum)
-		now := time.Now().UTC()
-		entry.Status = workflowStageStatusRunning
-		entry.Attempts++
-		entry.StartedAt = now
-		entry.EndedAt = time.Time{}
-		entry.Error = ""
-		state.UpdatedAt = now
-		state.CompletedAt = time.Time{}
-		if err := saveWorkflowState(statePath, state); err != nil {
+	run := &workflowRun{
+		projectID: projectID,
+		taskID:    taskID,
+		taskDir:   taskDir,
+		busPath:   busPath,
+		statePath: statePath,
+		fromStage: fromStage,
+		toStage:   toStage,
+		tmpl:      tmpl,
+		opts:      opts,
+		exec:      execStage,
+		state:     state,
+	}
+	for current := 0; current < len(result.PlannedSteps); {
+		next, failed, err := run.runStep(result.PlannedSteps, current, result)
+		if err != nil {
 			return nil, err
 		}
-
-		_ = postWorkflowBusMessage(busPath, projectID, taskID, "", "PROGRESS",
-			fmt.Sprintf("workflow stage %d started", stageNum))
-
-		prompt := workflowStagePrompt(template, stageNum, taskDir)
-		info, stageErr := execStage(projectID, taskID, stageNum, prompt, opts)
-		if info != nil {
-			entry.RunID = info.RunID
-		}
-
-		entry.EndedAt = time.Now().UTC()
-		state.UpdatedAt = entry.EndedAt
-		if stageErr != nil {
-			entry.Status = workflowStageStatusFailed
-			entry.Error = stageErr.Error()
-			if err := saveWorkflowState(statePath, state); err != nil {
-				return nil, err
-			}
-			_ = postWorkflowBusMessage(busPath, projectID, taskID, entry.RunID, "ERROR",
-				fmt.Sprintf("workflow stage %d failed: %v", stageNum, stageErr))
+		if failed != nil {
 			result.State = *state
-			return result, fmt.Errorf("workflow stage %d failed: %w", stageNum, stageErr)
+			return result, failed
 		}
-
-		entry.Status = workflowStageStatusCompleted
-		entry.Error = ""
-		if err := saveWorkflowState(statePath, state); err != nil {
-			return nil, err
-		}
-		_ = postWorkflowBusMessage(busPath, projectID, taskID, entry.RunID, "FACT",
-			fmt.Sprintf("workflow stage %d completed", stageNum))
+		current = next
 	}
 
 	now := time.Now().UTC()
@@ -275,39 +274,24 @@ func runWorkflowStage(projectID, taskID string, stage int, prompt string, opts W
 	return runJob(projectID, taskID, jobOpts)
 }
 
-func workflowStagePrompt(template string, stage int, taskDir string) string {
-	return strings.TrimSpace(fmt.Sprintf(`Workflow stage execution request.
-
-Template: %s
-Stage: %d - %s
-Task folder: %s
-
-Instructions:
-1. Read TASK.md in the task folder for baseline context.
-2. Execute only this template stage and produce concrete, file-backed outcomes.
-3. Preserve prior stage outputs unless this stage explicitly requires changes.
-4. Summarize this stage in output.md, including decisions, facts, and unresolved risks.
-`, template, stage, workflowStageTitle(stage), taskDir))
-}
-
-func normalizeWorkflowTemplate(template string) (string, error) {
-	trimmed := strings.TrimSpace(template)
-	if trimmed == "" {
-		return WorkflowTemplatePromptV5, nil
+// workflowPromptVars merges template vars with overrides.
+func workflowPromptVars(vars, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(vars)+len(overrides))
+	for k, v := range vars {
+		merged[k] = v
 	}
-	if strings.EqualFold(trimmed, WorkflowTemplatePromptV5) {
-		return WorkflowTemplatePromptV5, nil
+	for k, v := range overrides {
+		merged[k] = v
 	}
-	if strings.EqualFold(trimmed, "the_prompt_v5") {
-		return WorkflowTemplatePromptV5, nil
-	}
-	return "", fmt.Errorf("unsupported template %q", trimmed)
+	return merged
 }
 
-func normalizeWorkflowStageRange(template string, fromStage, toStage int) (int, int, error) {
-	minStage, maxStage, err := templateStageBounds(template)
-	if err != nil {
-		return 0, 0, err
+// normalizeWorkflowStageRange validates the stage range against tmpl; a
+// negative toStage selects the last stage.
+func normalizeWorkflowStageRange(tmpl *WorkflowTemplate, fromStage, toStage int) (int, int, error) {
+	minStage, maxStage := 0, len(tmpl.Stages)-1
+	if toStage < 0 {
+		toStage = maxStage
 	}
 	if fromStage < minStage || fromStage > maxStage {
 		return 0, 0, fmt.Errorf("from-stage %d out of range [%d..%d]", fromStage, minStage, maxStage)
@@ -321,13 +305,6 @@ func normalizeWorkflowStageRange(template string, fromStage, toStage int) (int,
 	return fromStage, toStage, nil
 }
 
-func templateStageBounds(template string) (int, int, error) {
-	if template != WorkflowTemplatePromptV5 {
-		return 0, 0, fmt.Errorf("unsupported template %q", template)
-	}
-	return 0, 12, nil
-}
-
 func workflowStageTitle(stage int) string {
 	if title, ok := workflowStageTitles[stage]; ok {
 		return title
@@ -427,10 +404,15 @@ func loadOrInitWorkflowState(statePath, projectID, taskID, template string, from
 		entry.Status = workflowStageStatusPending
 		entry.Attempts = 0
 		entry.RunID = ""
+		entry.RunIDs = nil
+		entry.Goto = nil
 		entry.StartedAt = time.Time{}
 		entry.EndedAt = time.Time{}
 		entry.Error = ""
 	}
+	if !resume {
+		state.Jumps = nil
+	}
 	state.CompletedAt = time.Time{}
 	sort.Slice(state.Stages, func(i, j int) bool {
 		return state.Stages[i].Stage < state.Stages[j].Stage
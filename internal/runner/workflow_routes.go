@@ -0,0 +1,386 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/verdict"
+	"github.com/pkg/errors"
+)
+
+// Stage outcomes matched by WorkflowRoute.Status.
+const (
+	workflowRouteStatusSucceeded = "succeeded"
+	workflowRouteStatusFailed    = "failed"
+	workflowRouteStatusAny       = "any"
+)
+
+// Stage verdicts matched by WorkflowRoute.Verdict.
+const (
+	workflowVerdictPass    = verdict.Pass
+	workflowVerdictFail    = verdict.Fail
+	workflowVerdictUnknown = verdict.Unknown
+)
+
+const (
+	// workflowRouteEnd as a route target finishes the workflow.
+	workflowRouteEnd = "end"
+	// defaultWorkflowRouteMax is how often a route may be taken by default.
+	defaultWorkflowRouteMax = 3
+)
+
+// WorkflowRoute sends a workflow from a finished stage to Goto when all of
+// its set conditions hold.
+type WorkflowRoute struct {
+	// Status is the stage outcome: succeeded (default), failed or any.
+	Status string `yaml:"status,omitempty" json:"status,omitempty"`
+	// Verdict is pass, fail or unknown: the "verdict" meta of the latest bus
+	// message of each stage run, else the tokens in the stage output.
+	Verdict      string `yaml:"verdict,omitempty" json:"verdict,omitempty"`
+	WorkflowGate `yaml:",inline"`
+	// Goto is the target stage: its name, its number or "end".
+	Goto string `yaml:"goto" json:"goto"`
+	// Max is how often the route may be taken in one workflow run (default
+	// 3). The stage fails when the route matches once more.
+	Max int `yaml:"max,omitempty" json:"max,omitempty"`
+
+	target int
+	re     *regexp.Regexp
+}
+
+// WorkflowJump records a route taken during a workflow run.
+type WorkflowJump struct {
+	From    int       `json:"from" yaml:"from"`
+	To      int       `json:"to" yaml:"to"`
+	Route   int       `json:"route" yaml:"route"`
+	Verdict string    `json:"verdict,omitempty" yaml:"verdict,omitempty"`
+	RunIDs  []string  `json:"run_ids,omitempty" yaml:"run_ids,omitempty"`
+	At      time.Time `json:"at" yaml:"at"`
+}
+
+func (route *WorkflowRoute) max() int {
+	if route.Max > 0 {
+		return route.Max
+	}
+	return defaultWorkflowRouteMax
+}
+
+// compileRoutes validates the routes of stage i and resolves their targets.
+func (t *WorkflowTemplate) compileRoutes(i int) error {
+	stage := &t.Stages[i]
+	for j := range stage.Routes {
+		route := &stage.Routes[j]
+		where := fmt.Sprintf("stage %d (%s): route %d", i, stage.Name, j)
+		route.Status = strings.ToLower(strings.TrimSpace(route.Status))
+		switch route.Status {
+		case "", workflowRouteStatusSucceeded, workflowRouteStatusFailed, workflowRouteStatusAny:
+		default:
+			return fmt.Errorf("%s: status must be succeeded, failed or any", where)
+		}
+		route.Verdict = strings.ToLower(strings.TrimSpace(route.Verdict))
+		switch route.Verdict {
+		case "", workflowVerdictPass, workflowVerdictFail, workflowVerdictUnknown:
+		default:
+			return fmt.Errorf("%s: verdict must be pass, fail or unknown", where)
+		}
+		if route.Max < 0 {
+			return fmt.Errorf("%s: max must be >= 0", where)
+		}
+		if route.OutputMatches != "" {
+			re, err := regexp.Compile(route.OutputMatches)
+			if err != nil {
+				return errors.Wrapf(err, "%s: output_matches", where)
+			}
+			route.re = re
+		}
+		target, err := t.stageIndex(route.Goto)
+		if err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+		if target > 0 && target < len(t.Stages) {
+			if group := t.Stages[target].Parallel; group != "" && t.Stages[target-1].Parallel == group {
+				return fmt.Errorf("%s: goto must be the first stage of parallel group %q", where, group)
+			}
+		}
+		route.target = target
+	}
+	return nil
+}
+
+// stageIndex resolves a stage name (case-insensitive), a stage number or
+// "end" (len(t.Stages)).
+func (t *WorkflowTemplate) stageIndex(ref string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return 0, errors.New("goto is required")
+	}
+	if strings.EqualFold(ref, workflowRouteEnd) {
+		return len(t.Stages), nil
+	}
+	for i := range t.Stages {
+		if strings.EqualFold(t.Stages[i].Name, ref) {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 0 && n < len(t.Stages) {
+		return n, nil
+	}
+	return 0, fmt.Errorf("goto %q is not a stage", ref)
+}
+
+// stageRunIDs returns the runs of the last execution of a stage.
+func stageRunIDs(entry *WorkflowStage) []string {
+	var runIDs []string
+	for _, runID := range entry.RunIDs {
+		if runID != "" {
+			runIDs = append(runIDs, runID)
+		}
+	}
+	if len(runIDs) == 0 && entry.RunID != "" {
+		runIDs = []string{entry.RunID}
+	}
+	return runIDs
+}
+
+// stageOutput returns the outputs of runIDs, one after another.
+func (r *workflowRun) stageOutput(runIDs []string) string {
+	outputs := make([]string, 0, len(runIDs))
+	for _, runID := range runIDs {
+		if output := readWorkflowStageOutput(r.taskDir, runID); output != "" {
+			outputs = append(outputs, output)
+		}
+	}
+	return strings.Join(outputs, "\n\n")
+}
+
+// stageVerdict returns the verdict of the runs of a stage. A "verdict" meta
+// posted by a run to the task bus (run-agent bus post --meta verdict=fail)
+// takes precedence over output tokens; any failing run fails the stage.
+func (r *workflowRun) stageVerdict(runIDs []string, output string) string {
+	verdicts := make([]string, 0, len(runIDs))
+	if bus, err := messagebus.Open(r.busPath, ""); err == nil {
+		for _, runID := range runIDs {
+			messages, err := bus.ReadMessagesByRunID(runID, 0)
+			if err != nil {
+				continue
+			}
+			for i := len(messages) - 1; i >= 0; i-- {
+				if msgVerdict := strings.ToLower(strings.TrimSpace(messages[i].Meta["verdict"])); msgVerdict != "" {
+					verdicts = append(verdicts, msgVerdict)
+					break
+				}
+			}
+		}
+		_ = bus.Close()
+	}
+	if len(verdicts) == 0 {
+		return verdict.Detect(output)
+	}
+	result := workflowVerdictUnknown
+	for _, v := range verdicts {
+		switch v {
+		case workflowVerdictFail:
+			return workflowVerdictFail
+		case workflowVerdictPass:
+			result = workflowVerdictPass
+		}
+	}
+	return result
+}
+
+// matchRoute returns the index of the first route of a finished stage whose
+// conditions hold, or -1, and the stage verdict. Callers hold r.mu.
+func (r *workflowRun) matchRoute(stageNum int, entry *WorkflowStage, failed bool) (int, string) {
+	stage := &r.tmpl.Stages[stageNum]
+	if len(stage.Routes) == 0 {
+		return -1, ""
+	}
+	runIDs := stageRunIDs(entry)
+	output := r.stageOutput(runIDs)
+	stageVerdict := ""
+	for i := range stage.Routes {
+		route := &stage.Routes[i]
+		switch route.Status {
+		case "", workflowRouteStatusSucceeded:
+			if failed {
+				continue
+			}
+		case workflowRouteStatusFailed:
+			if !failed {
+				continue
+			}
+		}
+		if route.Verdict != "" {
+			if stageVerdict == "" {
+				stageVerdict = r.stageVerdict(runIDs, output)
+			}
+			if route.Verdict != stageVerdict {
+				continue
+			}
+		}
+		if route.WorkflowGate.check(output, route.re) != nil {
+			continue
+		}
+		return i, stageVerdict
+	}
+	return -1, stageVerdict
+}
+
+// routeStep resolves the routes of a finished step once: the first stage of
+// the step whose route matches takes it, and only that jump is recorded with
+// the target in the stage entry. A stage that took a route before the
+// workflow was interrupted takes it again. A failed stage does not fail the
+// workflow when it took the route or the route goes back to run it again;
+// routeStep returns the first other failure, and then takes no route. from
+// is -1 when the step takes no route.
+func (r *workflowRun) routeStep(step []int, failures map[int]error) (from, target int, failed error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	from, routeIdx, routeVerdict := -1, -1, ""
+	for _, stageNum := range step {
+		entry := findWorkflowStage(r.state, stageNum)
+		if entry == nil {
+			continue
+		}
+		if entry.Goto != nil {
+			from, target = stageNum, *entry.Goto
+			break
+		}
+		idx, v := r.matchRoute(stageNum, entry, entry.Status == workflowStageStatusFailed)
+		if idx < 0 {
+			continue
+		}
+		if err := r.checkRoute(stageNum, idx); err != nil {
+			entry.Status = workflowStageStatusFailed
+			entry.Error = err.Error()
+			r.save()
+			failures[stageNum] = err
+			break
+		}
+		from, target, routeIdx, routeVerdict = stageNum, r.tmpl.Stages[stageNum].Routes[idx].target, idx, v
+		break
+	}
+
+	for _, stageNum := range step {
+		failure := failures[stageNum]
+		if failure == nil {
+			continue
+		}
+		runID := ""
+		if entry := findWorkflowStage(r.state, stageNum); entry != nil {
+			runID = entry.RunID
+		}
+		if from >= 0 && (stageNum == from || target <= stageNum) {
+			r.post(runID, "WARNING", fmt.Sprintf("workflow stage %d failed: %v", stageNum, failure))
+			continue
+		}
+		r.post(runID, "ERROR", fmt.Sprintf("workflow stage %d failed: %v", stageNum, failure))
+		if failed == nil {
+			failed = fmt.Errorf("workflow stage %d failed: %w", stageNum, failure)
+		}
+	}
+	if failed != nil {
+		return -1, 0, failed
+	}
+
+	if routeIdx >= 0 {
+		entry := findWorkflowStage(r.state, from)
+		entry.Goto = &target
+		r.state.Jumps = append(r.state.Jumps, WorkflowJump{
+			From:    from,
+			To:      target,
+			Route:   routeIdx,
+			Verdict: routeVerdict,
+			RunIDs:  stageRunIDs(entry),
+			At:      time.Now().UTC(),
+		})
+		r.state.UpdatedAt = time.Now().UTC()
+		r.save()
+	}
+	return from, target, nil
+}
+
+// checkRoute returns an error when route routeIdx of stage exceeded its max
+// or leaves the planned stages. Callers hold r.mu.
+func (r *workflowRun) checkRoute(stage, routeIdx int) error {
+	route := &r.tmpl.Stages[stage].Routes[routeIdx]
+	taken := 0
+	for _, jump := range r.state.Jumps {
+		if jump.From == stage && jump.Route == routeIdx {
+			taken++
+		}
+	}
+	if taken >= route.max() {
+		return fmt.Errorf("route to %q already taken %d times (max %d)", route.Goto, taken, route.max())
+	}
+	if route.target < r.fromStage {
+		return fmt.Errorf("route to %q leaves the planned stages %d..%d", route.Goto, r.fromStage, r.toStage)
+	}
+	return nil
+}
+
+// loopState returns how often routes jumped to stage and the output of the
+// stage that routed there last. Callers hold r.mu.
+func (r *workflowRun) loopState(stage int) (int, string) {
+	loops := 0
+	var last *WorkflowJump
+	for i := range r.state.Jumps {
+		if r.state.Jumps[i].To == stage {
+			loops++
+			last = &r.state.Jumps[i]
+		}
+	}
+	if last == nil {
+		return 0, ""
+	}
+	return loops, r.stageOutput(last.RunIDs)
+}
+
+// jump moves the workflow from the step steps[current] to target and returns
+// the index of the next step. Going back resets the stages from target up
+// to the current step; going forward skips the stages in between.
+func (r *workflowRun) jump(steps [][]int, current, from, target int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	step := steps[current]
+	last := step[len(step)-1]
+	next := len(steps)
+	for i, s := range steps {
+		if s[0] == target {
+			next = i
+			break
+		}
+	}
+	now := time.Now().UTC()
+	for i := range r.state.Stages {
+		entry := &r.state.Stages[i]
+		switch {
+		case target <= last && entry.Stage >= target && entry.Stage <= last:
+			entry.Status = workflowStageStatusPending
+			entry.RunID = ""
+			entry.RunIDs = nil
+			entry.Goto = nil
+			entry.StartedAt = time.Time{}
+			entry.EndedAt = time.Time{}
+			entry.Error = ""
+		case target > last && entry.Stage > last && entry.Stage < target && entry.Stage <= r.toStage:
+			entry.Status = workflowStageStatusSkipped
+			entry.EndedAt = now
+		}
+	}
+	r.state.UpdatedAt = now
+	r.save()
+
+	if target >= len(r.tmpl.Stages) || target > r.toStage {
+		r.post("", "DECISION", fmt.Sprintf("workflow stage %d routed to the end", from))
+		return len(steps)
+	}
+	r.post("", "DECISION", fmt.Sprintf("workflow stage %d routed to stage %d (%s)", from, target, r.tmpl.Stages[target].Name))
+	return next
+}
@@ -0,0 +1,258 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jonnyzzz/conductor-loop/internal/messagebus"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+const testLoopTemplate = `name: loop
+stages:
+  - name: Implement
+    prompt: "implement loop={{.Loop}} feedback={{.Feedback}}"
+  - name: Validate
+    prompt: validate
+    routes:
+      - verdict: fail
+        goto: Implement
+        max: 2
+  - name: Ship
+    prompt: ship
+    routes:
+      - output_contains: SKIP
+        goto: end
+`
+
+// loopExecutor runs stages of testLoopTemplate, answering Validate with the
+// next of validations.
+type loopExecutor struct {
+	t           *testing.T
+	taskDir     string
+	validations []string
+	crashLoop   int
+	calls       int
+	stages      []int
+	prompts     []string
+}
+
+func (e *loopExecutor) run(projectID, taskID string, stage int, prompt string, opts WorkflowOptions) (*storage.RunInfo, error) {
+	e.calls++
+	e.stages = append(e.stages, stage)
+	e.prompts = append(e.prompts, prompt)
+	runID := fmt.Sprintf("run-%02d", e.calls)
+	output := "done"
+	switch stage {
+	case 0:
+		if e.crashLoop > 0 && strings.Contains(prompt, fmt.Sprintf("loop=%d", e.crashLoop)) {
+			e.crashLoop = 0
+			return &storage.RunInfo{RunID: runID}, fmt.Errorf("agent crashed")
+		}
+	case 1:
+		output, e.validations = e.validations[0], e.validations[1:]
+	}
+	return writeStageOutput(e.t, e.taskDir, runID, output), nil
+}
+
+func writeLoopTemplate(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "loop.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	return path
+}
+
+func TestRunWorkflowRoutesLoopBackOnFailVerdict(t *testing.T) {
+	root := t.TempDir()
+	taskID := "task-20260302-090000-loop"
+	exec := &loopExecutor{t: t, taskDir: filepath.Join(root, "my-project", taskID), validations: []string{"tests FAIL", "all PASS"}}
+	result, err := RunWorkflow("my-project", taskID, WorkflowOptions{
+		RootDir:       root,
+		Template:      writeLoopTemplate(t, testLoopTemplate),
+		ToStage:       -1,
+		stageExecutor: exec.run,
+	})
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if want := []int{0, 1, 0, 1, 2}; !reflect.DeepEqual(exec.stages, want) {
+		t.Fatalf("stages = %v, want %v", exec.stages, want)
+	}
+	if got := exec.prompts[2]; got != "implement loop=1 feedback=tests FAIL" {
+		t.Fatalf("looped prompt = %q", got)
+	}
+	if !reflect.DeepEqual(result.ExecutedStages, exec.stages) {
+		t.Fatalf("executed stages = %v", result.ExecutedStages)
+	}
+	jumps := result.State.Jumps
+	if len(jumps) != 1 || jumps[0].From != 1 || jumps[0].To != 0 || jumps[0].Verdict != "fail" || jumps[0].RunIDs[0] != "run-02" {
+		t.Fatalf("jumps = %+v", jumps)
+	}
+	if implement := findWorkflowStage(&result.State, 0); implement.Attempts != 2 || implement.Status != workflowStageStatusCompleted {
+		t.Fatalf("implement stage = %+v", implement)
+	}
+}
+
+func TestRunWorkflowRouteLimitSurvivesResume(t *testing.T) {
+	root := t.TempDir()
+	taskID := "task-20260302-091500-loop"
+	templatePath := writeLoopTemplate(t, testLoopTemplate)
+	exec := &loopExecutor{t: t, taskDir: filepath.Join(root, "my-project", taskID), validations: []string{"FAIL"}, crashLoop: 1}
+	opts := WorkflowOptions{RootDir: root, Template: templatePath, ToStage: -1, stageExecutor: exec.run}
+	if _, err := RunWorkflow("my-project", taskID, opts); err == nil || !strings.Contains(err.Error(), "agent crashed") {
+		t.Fatalf("expected interrupted loop, got %v", err)
+	}
+
+	exec.stages = nil
+	exec.validations = []string{"FAIL", "FAIL"}
+	opts.Resume = true
+	result, err := RunWorkflow("my-project", taskID, opts)
+	if err == nil || !strings.Contains(err.Error(), `workflow stage 1 failed: route to "Implement" already taken 2 times (max 2)`) {
+		t.Fatalf("expected route limit, got %v", err)
+	}
+	if want := []int{0, 1, 0, 1}; !reflect.DeepEqual(exec.stages, want) {
+		t.Fatalf("resumed stages = %v, want %v", exec.stages, want)
+	}
+	if len(result.State.Jumps) != 2 || findWorkflowStage(&result.State, 1).Status != workflowStageStatusFailed {
+		t.Fatalf("state = %+v", result.State)
+	}
+}
+
+func TestRunWorkflowRoutesOnBusVerdictAndToEnd(t *testing.T) {
+	root := t.TempDir()
+	taskID := "task-20260302-093000-loop"
+	taskDir := filepath.Join(root, "my-project", taskID)
+	calls := 0
+	result, err := RunWorkflow("my-project", taskID, WorkflowOptions{
+		RootDir:  root,
+		Template: writeLoopTemplate(t, testLoopTemplate),
+		ToStage:  -1,
+		stageExecutor: func(projectID, taskID string, stage int, prompt string, opts WorkflowOptions) (*storage.RunInfo, error) {
+			calls++
+			runID := fmt.Sprintf("run-%d", calls)
+			output := "APPROVED"
+			if stage == 0 && calls > 1 {
+				output = "SKIP"
+			}
+			if stage == 1 && calls == 2 {
+				// The structured verdict overrides the output token.
+				bus, err := messagebus.Open(filepath.Join(taskDir, "TASK-MESSAGE-BUS.md"), "")
+				if err != nil {
+					t.Fatalf("open bus: %v", err)
+				}
+				defer bus.Close()
+				if _, err := bus.AppendMessage(&messagebus.Message{Type: "REVIEW", ProjectID: projectID, TaskID: taskID, RunID: runID, Meta: map[string]string{"verdict": "fail"}, Body: "missing tests"}); err != nil {
+					t.Fatalf("post verdict: %v", err)
+				}
+			}
+			return writeStageOutput(t, taskDir, runID, output), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if want := []int{0, 1, 0, 1, 2}; !reflect.DeepEqual(result.ExecutedStages, want) {
+		t.Fatalf("executed stages = %v, want %v", result.ExecutedStages, want)
+	}
+	if jumps := result.State.Jumps; len(jumps) != 1 {
+		t.Fatalf("jumps = %+v", jumps)
+	}
+
+	// Ship says SKIP only when stage 0 did; route it to the end from stage 0.
+	tmpl := strings.Replace(testLoopTemplate, "  - name: Validate\n", "    routes:\n      - output_contains: SKIP\n        goto: end\n  - name: Validate\n", 1)
+	calls = 0
+	result, err = RunWorkflow("my-project", "task-20260302-094500-loop", WorkflowOptions{
+		RootDir:  root,
+		Template: writeLoopTemplate(t, tmpl),
+		ToStage:  -1,
+		stageExecutor: func(projectID, taskID string, stage int, prompt string, opts WorkflowOptions) (*storage.RunInfo, error) {
+			calls++
+			return writeStageOutput(t, filepath.Join(root, projectID, taskID), fmt.Sprintf("run-%d", calls), "SKIP"), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunWorkflow to end: %v", err)
+	}
+	if !reflect.DeepEqual(result.ExecutedStages, []int{0}) || result.State.CompletedAt.IsZero() {
+		t.Fatalf("result = %+v", result)
+	}
+	for _, stage := range []int{1, 2} {
+		if entry := findWorkflowStage(&result.State, stage); entry.Status != workflowStageStatusSkipped {
+			t.Fatalf("stage %d = %+v, want skipped", stage, entry)
+		}
+	}
+}
+
+func TestRunWorkflowParallelGroupTakesOneRoute(t *testing.T) {
+	root := t.TempDir()
+	taskID := "task-20260302-100000-loop"
+	taskDir := filepath.Join(root, "my-project", taskID)
+	tmpl := `stages:
+  - name: Implement
+    prompt: implement
+  - name: Lint
+    prompt: lint
+    parallel: check
+    routes: [{verdict: fail, goto: Implement, max: 1}]
+  - name: Test
+    prompt: test
+    parallel: check
+    routes: [{verdict: fail, goto: Implement, max: 1}]
+  - name: Ship
+    prompt: ship
+`
+	var mu sync.Mutex
+	calls := 0
+	runs := make(map[int]int)
+	result, err := RunWorkflow("my-project", taskID, WorkflowOptions{
+		RootDir:  root,
+		Template: writeLoopTemplate(t, tmpl),
+		ToStage:  -1,
+		stageExecutor: func(projectID, taskID string, stage int, prompt string, opts WorkflowOptions) (*storage.RunInfo, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			runs[stage]++
+			output := "PASS"
+			if stage != 0 && runs[stage] == 1 {
+				output = "FAIL"
+			}
+			return writeStageOutput(t, taskDir, fmt.Sprintf("run-%02d", calls), output), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if want := map[int]int{0: 2, 1: 2, 2: 2, 3: 1}; !reflect.DeepEqual(runs, want) {
+		t.Fatalf("runs per stage = %v, want %v", runs, want)
+	}
+	if jumps := result.State.Jumps; len(jumps) != 1 || jumps[0].From != 1 || jumps[0].To != 0 {
+		t.Fatalf("jumps = %+v, want one jump from stage 1", jumps)
+	}
+	for _, entry := range result.State.Stages {
+		if entry.Goto != nil {
+			t.Fatalf("stage %d kept goto %d", entry.Stage, *entry.Goto)
+		}
+	}
+}
+
+func TestWorkflowTemplateRejectsInvalidRoutes(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown goto":   "stages:\n  - prompt: a\n    routes: [{goto: nowhere}]\n",
+		"bad verdict":    "stages:\n  - prompt: a\n    routes: [{verdict: maybe, goto: end}]\n",
+		"bad status":     "stages:\n  - prompt: a\n    routes: [{status: crashed, goto: end}]\n",
+		"into a group":   "stages:\n  - {prompt: a, routes: [{goto: 2}]}\n  - {prompt: b, parallel: g}\n  - {prompt: c, parallel: g}\n",
+		"negative limit": "stages:\n  - prompt: a\n    routes: [{goto: 0, max: -1}]\n",
+	} {
+		if _, err := LoadWorkflowTemplate(writeLoopTemplate(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
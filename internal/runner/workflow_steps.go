@@ -0,0 +1,352 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+// workflowRun executes the steps of one RunWorkflow call. The stages of a
+// step and the instances of a fan-out stage run concurrently; every run
+// still takes a slot of the run semaphore (defaults.max_concurrent_runs).
+type workflowRun struct {
+	projectID string
+	taskID    string
+	taskDir   string
+	busPath   string
+	statePath string
+	fromStage int
+	toStage   int
+	tmpl      *WorkflowTemplate
+	opts      WorkflowOptions
+	exec      workflowStageExecutor
+
+	mu      sync.Mutex // guards state, its file and saveErr
+	state   *WorkflowState
+	saveErr error
+}
+
+// save persists the state, keeping the first error. Callers hold r.mu.
+func (r *workflowRun) save() {
+	if err := saveWorkflowState(r.statePath, r.state); err != nil && r.saveErr == nil {
+		r.saveErr = err
+	}
+}
+
+func (r *workflowRun) post(runID, msgType, body string) {
+	_ = postWorkflowBusMessage(r.busPath, r.projectID, r.taskID, runID, msgType, body)
+}
+
+// runStep runs the stages of steps[current] that still need to run and
+// returns the index of the next step: the following one, or the one a route
+// jumped to. It returns the error of the first failed stage the route does
+// not cover, or a state persistence error as err.
+func (r *workflowRun) runStep(steps [][]int, current int, result *WorkflowResult) (next int, failed error, err error) {
+	step := steps[current]
+	var stages []int
+	for _, stageNum := range step {
+		entry := findOrCreateWorkflowStage(r.state, stageNum)
+		// A stage with a target already took a route before the workflow
+		// was interrupted; the route is applied again below.
+		if r.opts.Resume && (entry.Status == workflowStageStatusCompleted || entry.Goto != nil) {
+			result.SkippedStages = append(result.SkippedStages, stageNum)
+			r.post(entry.RunID, "DECISION", fmt.Sprintf("workflow stage %d skipped (already completed)", stageNum))
+			continue
+		}
+		result.ExecutedStages = append(result.ExecutedStages, stageNum)
+		stages = append(stages, stageNum)
+	}
+
+	failures := make(map[int]error)
+	if len(stages) > 0 {
+		if failures, err = r.runStages(stages); err != nil {
+			return 0, nil, err
+		}
+	}
+	from, target, failed := r.routeStep(step, failures)
+	if r.saveErr != nil {
+		return 0, nil, r.saveErr
+	}
+	if failed != nil {
+		return 0, failed, nil
+	}
+	if len(stages) > 0 {
+		if runs := r.stepRuns(step); len(runs) > 1 {
+			r.writeSynthesis(step, runs)
+		}
+	}
+	if from >= 0 {
+		return r.jump(steps, current, from, target), nil, nil
+	}
+	return current + 1, nil, nil
+}
+
+// runStages runs stages of one step concurrently and returns the errors of
+// the stages that failed.
+func (r *workflowRun) runStages(stages []int) (map[int]error, error) {
+	previousOutput := r.previousOutput(stages[0])
+	if len(stages) > 1 {
+		r.post("", "PROGRESS", fmt.Sprintf("workflow stages %v started in parallel", stages))
+	}
+	failures := make([]error, len(stages))
+	var wg sync.WaitGroup
+	for i, stageNum := range stages {
+		wg.Add(1)
+		go func(i, stageNum int) {
+			defer wg.Done()
+			failures[i] = r.runStage(stageNum, previousOutput)
+		}(i, stageNum)
+	}
+	wg.Wait()
+
+	if r.saveErr != nil {
+		return nil, r.saveErr
+	}
+	failed := make(map[int]error)
+	for i, failure := range failures {
+		if failure != nil {
+			failed[stages[i]] = failure
+		}
+	}
+	return failed, nil
+}
+
+// runStage runs all instances of one stage and records its outcome. The
+// routes of the step are resolved by routeStep once all its stages finished.
+func (r *workflowRun) runStage(stageNum int, previousOutput string) error {
+	stage := &r.tmpl.Stages[stageNum]
+	instances := stage.instances()
+
+	r.mu.Lock()
+	entry := findOrCreateWorkflowStage(r.state, stageNum)
+	now := time.Now().UTC()
+	entry.Status = workflowStageStatusRunning
+	entry.StartedAt = now
+	entry.EndedAt = time.Time{}
+	entry.Error = ""
+	entry.RunID = ""
+	entry.RunIDs = nil
+	entry.Goto = nil
+	if instances > 1 {
+		entry.RunIDs = make([]string, instances)
+	}
+	r.state.UpdatedAt = now
+	r.state.CompletedAt = time.Time{}
+	r.save()
+	data := workflowPromptData{
+		ProjectID:      r.projectID,
+		TaskID:         r.taskID,
+		TaskDir:        r.taskDir,
+		Template:       r.tmpl.Name,
+		Stage:          stageNum,
+		StageName:      stage.Name,
+		Instances:      instances,
+		PreviousOutput: previousOutput,
+		Vars:           workflowPromptVars(r.tmpl.Vars, r.opts.Vars),
+	}
+	data.Loop, data.Feedback = r.loopState(stageNum)
+	r.mu.Unlock()
+
+	if instances > 1 {
+		r.post("", "PROGRESS", fmt.Sprintf("workflow stage %d started (fan-out %d)", stageNum, instances))
+	} else {
+		r.post("", "PROGRESS", fmt.Sprintf("workflow stage %d started", stageNum))
+	}
+
+	failures := make([]error, instances)
+	var wg sync.WaitGroup
+	for instance := 0; instance < instances; instance++ {
+		wg.Add(1)
+		go func(instance int) {
+			defer wg.Done()
+			failures[instance] = r.runInstance(stageNum, instance, data)
+		}(instance)
+	}
+	wg.Wait()
+
+	var stageErr error
+	for instance, failure := range failures {
+		if failure == nil {
+			continue
+		}
+		stageErr = failure
+		if instances > 1 {
+			stageErr = fmt.Errorf("instance %d: %w", instance+1, failure)
+		}
+		break
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.EndedAt = time.Now().UTC()
+	r.state.UpdatedAt = entry.EndedAt
+	if stageErr != nil {
+		entry.Status = workflowStageStatusFailed
+		entry.Error = stageErr.Error()
+		r.save()
+		return stageErr
+	}
+	entry.Status = workflowStageStatusCompleted
+	entry.Error = ""
+	r.save()
+	r.post(entry.RunID, "FACT", fmt.Sprintf("workflow stage %d completed", stageNum))
+	return nil
+}
+
+// runInstance runs one instance of a stage with its retries and gate.
+func (r *workflowRun) runInstance(stageNum, instance int, data workflowPromptData) error {
+	stage := &r.tmpl.Stages[stageNum]
+	instances := stage.instances()
+	stageOpts := r.opts
+	if agent := r.tmpl.stageAgent(stage, instance); agent != "" {
+		stageOpts.Agent = agent
+	}
+	if stage.timeout > 0 {
+		stageOpts.Timeout = stage.timeout
+	}
+	data.Instance = instance + 1
+	label := fmt.Sprintf("workflow stage %d", stageNum)
+	if instances > 1 {
+		label = fmt.Sprintf("workflow stage %d instance %d", stageNum, instance+1)
+	}
+
+	maxAttempts := 1 + r.tmpl.stageRetries(stage)
+	var stageErr error
+	var runID string
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		r.mu.Lock()
+		entry := findOrCreateWorkflowStage(r.state, stageNum)
+		entry.Attempts++
+		r.state.UpdatedAt = time.Now().UTC()
+		r.save()
+		r.mu.Unlock()
+
+		if attempt > 1 {
+			r.post(runID, "WARNING", fmt.Sprintf("%s retry %d/%d after: %v", label, attempt-1, maxAttempts-1, stageErr))
+			if stage.retryDelay > 0 {
+				time.Sleep(stage.retryDelay)
+			}
+		}
+
+		data.Attempt = attempt
+		var prompt string
+		prompt, stageErr = stage.renderPrompt(data)
+		if stageErr != nil {
+			return stageErr
+		}
+		var info *storage.RunInfo
+		info, stageErr = r.exec(r.projectID, r.taskID, stageNum, prompt, stageOpts)
+		if info != nil {
+			runID = info.RunID
+			r.mu.Lock()
+			entry := findOrCreateWorkflowStage(r.state, stageNum)
+			if instances > 1 {
+				entry.RunIDs[instance] = runID
+			} else {
+				entry.RunID = runID
+			}
+			r.mu.Unlock()
+		}
+		if stageErr == nil {
+			stageErr = stage.checkGate(info)
+		}
+		if stageErr == nil {
+			return nil
+		}
+	}
+	return stageErr
+}
+
+// previousOutput returns the output of the step before the one holding
+// stage: the output.md of its single run, or the synthesis of all its runs.
+func (r *workflowRun) previousOutput(stage int) string {
+	runs := r.stepRuns(r.tmpl.previousStep(stage))
+	switch len(runs) {
+	case 0:
+		return ""
+	case 1:
+		return readWorkflowStageOutput(r.taskDir, filepath.Base(runs[0].RunDir))
+	}
+	var b strings.Builder
+	if err := SynthesizeRunOutputs(&b, runs, false); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// stepRuns returns the recorded runs of the stages of step.
+func (r *workflowRun) stepRuns(step []int) []SynthesisRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var runs []SynthesisRun
+	for _, stageNum := range step {
+		entry := findWorkflowStage(r.state, stageNum)
+		if entry == nil {
+			continue
+		}
+		runIDs := entry.RunIDs
+		if len(runIDs) == 0 && entry.RunID != "" {
+			runIDs = []string{entry.RunID}
+		}
+		for _, runID := range runIDs {
+			if runID == "" {
+				continue
+			}
+			runs = append(runs, SynthesisRun{
+				Label:  fmt.Sprintf("%s (stage %d: %s)", runID, stageNum, entry.Name),
+				RunDir: filepath.Join(r.taskDir, "runs", runID),
+			})
+		}
+	}
+	return runs
+}
+
+// writeSynthesis stores the synthesis of the runs of a step next to the
+// workflow state for the fan-in stage and for readers of the task.
+func (r *workflowRun) writeSynthesis(step []int, runs []SynthesisRun) {
+	var b strings.Builder
+	if err := SynthesizeRunOutputs(&b, runs, false); err != nil {
+		return
+	}
+	names := make([]string, 0, len(step))
+	for _, stageNum := range step {
+		names = append(names, strconv.Itoa(stageNum))
+	}
+	path := filepath.Join(filepath.Dir(r.statePath), fmt.Sprintf("stages-%s-synthesis.md", strings.Join(names, "-")))
+	if err := writeWorkflowFileAtomic(path, []byte(b.String())); err != nil {
+		r.post("", "WARNING", fmt.Sprintf("workflow stages %v synthesis not written: %v", step, err))
+		return
+	}
+	r.post("", "FACT", fmt.Sprintf("workflow stages %v synthesized from %d runs: %s", step, len(runs), path))
+}
+
+// findWorkflowStage returns the state entry of stage, or nil.
+func findWorkflowStage(state *WorkflowState, stage int) *WorkflowStage {
+	for i := range state.Stages {
+		if state.Stages[i].Stage == stage {
+			return &state.Stages[i]
+		}
+	}
+	return nil
+}
+
+// readWorkflowStageOutput returns output.md of a stage run, or "" when it
+// cannot be read.
+func readWorkflowStageOutput(taskDir, runID string) string {
+	runDir := filepath.Join(taskDir, "runs", runID)
+	outputPath := filepath.Join(runDir, "output.md")
+	if info, err := storage.ReadRunInfo(filepath.Join(runDir, "run-info.yaml")); err == nil && strings.TrimSpace(info.OutputPath) != "" {
+		outputPath = info.OutputPath
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,432 @@
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// WorkflowTemplate defines the stages of a workflow run by RunWorkflow.
+// Stages are numbered by position, starting at 0.
+type WorkflowTemplate struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Agent, Timeout and Retries are the defaults of stages that do not set
+	// their own.
+	Agent   string                  `yaml:"agent,omitempty" json:"agent,omitempty"`
+	Timeout string                  `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Retries int                     `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Vars    map[string]string       `yaml:"vars,omitempty" json:"vars,omitempty"`
+	Stages  []WorkflowTemplateStage `yaml:"stages" json:"stages"`
+
+	// Source is the file the template was loaded from; empty for built-ins.
+	Source string `yaml:"-" json:"source,omitempty"`
+}
+
+// WorkflowTemplateStage is one stage of a workflow template.
+type WorkflowTemplateStage struct {
+	Name string `yaml:"name" json:"name"`
+	// Prompt is a Go text/template; see workflowPromptData for the
+	// variables. PromptFile (relative to the template file) is used when
+	// Prompt is empty.
+	Prompt     string `yaml:"prompt,omitempty" json:"prompt,omitempty"`
+	PromptFile string `yaml:"prompt_file,omitempty" json:"prompt_file,omitempty"`
+	Agent      string `yaml:"agent,omitempty" json:"agent,omitempty"`
+	Timeout    string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Retries is the number of extra attempts after a failed attempt;
+	// unset means the template default.
+	Retries    *int         `yaml:"retries,omitempty" json:"retries,omitempty"`
+	RetryDelay string       `yaml:"retry_delay,omitempty" json:"retry_delay,omitempty"`
+	Gate       WorkflowGate `yaml:"gate,omitempty" json:"gate,omitempty"`
+	// Parallel names a group of consecutive stages that run concurrently.
+	Parallel string `yaml:"parallel,omitempty" json:"parallel,omitempty"`
+	// FanOut runs the stage as this many concurrent instances; instance i
+	// uses Agents[i % len(Agents)] when Agents is set. It defaults to
+	// len(Agents), or 1.
+	FanOut int      `yaml:"fan_out,omitempty" json:"fan_out,omitempty"`
+	Agents []string `yaml:"agents,omitempty" json:"agents,omitempty"`
+	// Routes are checked in order once the stage finished; the first that
+	// matches jumps to its target instead of the next stage.
+	Routes []WorkflowRoute `yaml:"routes,omitempty" json:"routes,omitempty"`
+
+	prompt     *template.Template
+	timeout    time.Duration
+	retryDelay time.Duration
+	gate       *regexp.Regexp
+}
+
+// WorkflowGate decides whether a stage passed from the output.md of its
+// run. All set conditions must hold.
+type WorkflowGate struct {
+	OutputContains    string `yaml:"output_contains,omitempty" json:"output_contains,omitempty"`
+	OutputNotContains string `yaml:"output_not_contains,omitempty" json:"output_not_contains,omitempty"`
+	// OutputMatches is a regular expression (RE2), e.g. "(?m)^VERDICT: APPROVED$".
+	OutputMatches string `yaml:"output_matches,omitempty" json:"output_matches,omitempty"`
+}
+
+func (g WorkflowGate) isZero() bool {
+	return g.OutputContains == "" && g.OutputNotContains == "" && g.OutputMatches == ""
+}
+
+// workflowPromptData holds the variables of stage prompt templates:
+// {{.ProjectID}}, {{.TaskID}}, {{.TaskDir}}, {{.Template}}, {{.Stage}},
+// {{.StageName}}, {{.Attempt}}, {{.Instance}} and {{.Instances}} (fan-out),
+// {{.PreviousOutput}} (output.md of the previous stage, or the synthesis of
+// all runs of the previous parallel group or fan-out), {{.Loop}} and
+// {{.Feedback}} (how often a route jumped back to the stage, and the output
+// of the stage that routed there last) and {{.Vars.name}} (template vars and
+// --var values).
+type workflowPromptData struct {
+	ProjectID      string
+	TaskID         string
+	TaskDir        string
+	Template       string
+	Stage          int
+	StageName      string
+	Attempt        int
+	Instance       int
+	Instances      int
+	PreviousOutput string
+	Loop           int
+	Feedback       string
+	Vars           map[string]string
+}
+
+// WorkflowTemplatesDirName is the directory of a project (under the runs
+// root) searched for workflow templates.
+const WorkflowTemplatesDirName = "workflows"
+
+const promptV5StagePrompt = `Workflow stage execution request.
+
+Template: {{.Template}}
+Stage: {{.Stage}} - {{.StageName}}
+Task folder: {{.TaskDir}}
+
+Instructions:
+1. Read TASK.md in the task folder for baseline context.
+2. Execute only this template stage and produce concrete, file-backed outcomes.
+3. Preserve prior stage outputs unless this stage explicitly requires changes.
+4. Summarize this stage in output.md, including decisions, facts, and unresolved risks.`
+
+// promptV5Template is the built-in THE_PROMPT_v5 template.
+func promptV5Template() *WorkflowTemplate {
+	tmpl := &WorkflowTemplate{
+		Name:        WorkflowTemplatePromptV5,
+		Description: "THE_PROMPT_v5 orchestration stages",
+	}
+	for stage := 0; stage <= 12; stage++ {
+		tmpl.Stages = append(tmpl.Stages, WorkflowTemplateStage{
+			Name:   workflowStageTitle(stage),
+			Prompt: promptV5StagePrompt,
+		})
+	}
+	// The independent reviews run concurrently.
+	tmpl.Stages[8].Parallel = "review"
+	tmpl.Stages[9].Parallel = "review"
+	if err := tmpl.compile(); err != nil {
+		panic(err) // the built-in template is valid
+	}
+	return tmpl
+}
+
+// LoadWorkflowTemplate reads and validates a workflow template file. The
+// name defaults to the file name without extension.
+func LoadWorkflowTemplate(path string) (*WorkflowTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read workflow template")
+	}
+	var tmpl WorkflowTemplate
+	if err := yaml.Unmarshal(data, &tmpl); err != nil {
+		return nil, fmt.Errorf("decode workflow template %s: %w", path, err)
+	}
+	if strings.TrimSpace(tmpl.Name) == "" {
+		tmpl.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	tmpl.Source = path
+	if err := tmpl.compile(); err != nil {
+		return nil, fmt.Errorf("workflow template %s: %w", path, err)
+	}
+	return &tmpl, nil
+}
+
+// compile validates the template and prepares prompts, durations and gates.
+func (t *WorkflowTemplate) compile() error {
+	t.Name = strings.TrimSpace(t.Name)
+	if len(t.Stages) == 0 {
+		return errors.New("no stages")
+	}
+	if t.Retries < 0 {
+		return errors.New("retries must be >= 0")
+	}
+	defaultTimeout, err := parseTemplateDuration(t.Timeout, "timeout")
+	if err != nil {
+		return err
+	}
+	for i := range t.Stages {
+		stage := &t.Stages[i]
+		if strings.TrimSpace(stage.Name) == "" {
+			stage.Name = fmt.Sprintf("Stage %d", i)
+		}
+		text := stage.Prompt
+		if text == "" && stage.PromptFile != "" {
+			path := stage.PromptFile
+			if !filepath.IsAbs(path) && t.Source != "" {
+				path = filepath.Join(filepath.Dir(t.Source), path)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return errors.Wrapf(err, "stage %d (%s): prompt_file", i, stage.Name)
+			}
+			text = string(data)
+		}
+		if strings.TrimSpace(text) == "" {
+			return fmt.Errorf("stage %d (%s): prompt or prompt_file is required", i, stage.Name)
+		}
+		if stage.prompt, err = template.New(stage.Name).Option("missingkey=error").Parse(text); err != nil {
+			return errors.Wrapf(err, "stage %d (%s): prompt", i, stage.Name)
+		}
+		if stage.timeout, err = parseTemplateDuration(stage.Timeout, fmt.Sprintf("stage %d timeout", i)); err != nil {
+			return err
+		}
+		if stage.timeout == 0 {
+			stage.timeout = defaultTimeout
+		}
+		if stage.retryDelay, err = parseTemplateDuration(stage.RetryDelay, fmt.Sprintf("stage %d retry_delay", i)); err != nil {
+			return err
+		}
+		if stage.Retries != nil && *stage.Retries < 0 {
+			return fmt.Errorf("stage %d (%s): retries must be >= 0", i, stage.Name)
+		}
+		if stage.Gate.OutputMatches != "" {
+			if stage.gate, err = regexp.Compile(stage.Gate.OutputMatches); err != nil {
+				return errors.Wrapf(err, "stage %d (%s): gate.output_matches", i, stage.Name)
+			}
+		}
+		if stage.FanOut < 0 {
+			return fmt.Errorf("stage %d (%s): fan_out must be >= 0", i, stage.Name)
+		}
+		if group := stage.Parallel; group != "" && i > 0 && t.Stages[i-1].Parallel != group {
+			for j := 0; j < i-1; j++ {
+				if t.Stages[j].Parallel == group {
+					return fmt.Errorf("stage %d (%s): parallel group %q must be consecutive stages", i, stage.Name, group)
+				}
+			}
+		}
+	}
+	for i := range t.Stages {
+		if err := t.compileRoutes(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instances returns the number of concurrent instances of stage.
+func (stage *WorkflowTemplateStage) instances() int {
+	if stage.FanOut > 0 {
+		return stage.FanOut
+	}
+	if len(stage.Agents) > 0 {
+		return len(stage.Agents)
+	}
+	return 1
+}
+
+// workflowSteps groups the stages fromStage..toStage into steps that run one
+// after another; the stages of a step (a parallel group) run concurrently.
+func (t *WorkflowTemplate) workflowSteps(fromStage, toStage int) [][]int {
+	var steps [][]int
+	for stage := fromStage; stage <= toStage; stage++ {
+		group := t.Stages[stage].Parallel
+		if n := len(steps); n > 0 && group != "" && t.Stages[stage-1].Parallel == group {
+			steps[n-1] = append(steps[n-1], stage)
+			continue
+		}
+		steps = append(steps, []int{stage})
+	}
+	return steps
+}
+
+// previousStep returns the stages of the step before the one holding stage.
+func (t *WorkflowTemplate) previousStep(stage int) []int {
+	var prev []int
+	for _, step := range t.workflowSteps(0, len(t.Stages)-1) {
+		for _, s := range step {
+			if s == stage {
+				return prev
+			}
+		}
+		prev = step
+	}
+	return nil
+}
+
+func parseTemplateDuration(value, field string) (time.Duration, error) {
+	if strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s: invalid duration %q", field, value)
+	}
+	return d, nil
+}
+
+func (t *WorkflowTemplate) stageRetries(stage *WorkflowTemplateStage) int {
+	if stage.Retries != nil {
+		return *stage.Retries
+	}
+	return t.Retries
+}
+
+// stageAgent returns the agent of an instance of stage: its entry in
+// Agents, the stage agent or the template agent.
+func (t *WorkflowTemplate) stageAgent(stage *WorkflowTemplateStage, instance int) string {
+	if len(stage.Agents) > 0 {
+		if agent := strings.TrimSpace(stage.Agents[instance%len(stage.Agents)]); agent != "" {
+			return agent
+		}
+	}
+	if agent := strings.TrimSpace(stage.Agent); agent != "" {
+		return agent
+	}
+	return strings.TrimSpace(t.Agent)
+}
+
+// renderPrompt renders the prompt of stage with data.
+func (stage *WorkflowTemplateStage) renderPrompt(data workflowPromptData) (string, error) {
+	var buf bytes.Buffer
+	if err := stage.prompt.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "render prompt of stage %d", data.Stage)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// checkGate reports why output does not pass the gate of stage, or nil.
+func (stage *WorkflowTemplateStage) checkGate(info *storage.RunInfo) error {
+	if stage.Gate.isZero() {
+		return nil
+	}
+	if info == nil || strings.TrimSpace(info.OutputPath) == "" {
+		return errors.New("gate: the stage run has no output")
+	}
+	data, err := os.ReadFile(info.OutputPath)
+	if err != nil {
+		return errors.Wrap(err, "gate: read output")
+	}
+	if err := stage.Gate.check(string(data), stage.gate); err != nil {
+		return errors.Wrap(err, "gate")
+	}
+	return nil
+}
+
+// check reports which condition of g output fails, or nil. re is the
+// compiled OutputMatches.
+func (g WorkflowGate) check(output string, re *regexp.Regexp) error {
+	if want := g.OutputContains; want != "" && !strings.Contains(output, want) {
+		return fmt.Errorf("output does not contain %q", want)
+	}
+	if reject := g.OutputNotContains; reject != "" && strings.Contains(output, reject) {
+		return fmt.Errorf("output contains %q", reject)
+	}
+	if re != nil && !re.MatchString(output) {
+		return fmt.Errorf("output does not match %q", g.OutputMatches)
+	}
+	return nil
+}
+
+// WorkflowTemplateDirs returns the directories searched for workflow
+// templates: the project's workflows directory under the runs root, extra,
+// then workflows.dirs from the config at configPath (if any).
+func WorkflowTemplateDirs(rootDir, projectID, configPath string, extra []string) ([]string, error) {
+	var dirs []string
+	if rootDir != "" && projectID != "" {
+		dirs = append(dirs, filepath.Join(rootDir, projectID, WorkflowTemplatesDirName))
+	}
+	dirs = append(dirs, extra...)
+	if path := strings.TrimSpace(configPath); path != "" {
+		cfg, err := config.LoadConfigForServer(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "load config")
+		}
+		dirs = append(dirs, cfg.Workflows.Dirs...)
+	}
+	return dirs, nil
+}
+
+// ResolveWorkflowTemplate finds a template by name: a path to a template
+// file, <dir>/<name>.yaml (or .yml) in the first of dirs that has it, or a
+// built-in template. An empty name selects THE_PROMPT_v5.
+func ResolveWorkflowTemplate(name string, dirs []string) (*WorkflowTemplate, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return promptV5Template(), nil
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") {
+		return LoadWorkflowTemplate(name)
+	}
+	for _, dir := range dirs {
+		for _, ext := range []string{".yaml", ".yml"} {
+			path := filepath.Join(dir, name+ext)
+			if _, err := os.Stat(path); err == nil {
+				return LoadWorkflowTemplate(path)
+			}
+		}
+	}
+	if strings.EqualFold(name, WorkflowTemplatePromptV5) {
+		return promptV5Template(), nil
+	}
+	return nil, fmt.Errorf("unsupported template %q (not built in and not found in %s)", name, strings.Join(dirs, ", "))
+}
+
+// ListWorkflowTemplates returns the built-in templates and the templates in
+// dirs; a template in an earlier directory hides later ones of the same name.
+// Templates that fail to load are returned in errs.
+func ListWorkflowTemplates(dirs []string) (templates []*WorkflowTemplate, errs []error) {
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, errors.Wrap(err, "read workflow templates"))
+			}
+			continue
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSuffix(entry.Name(), ext))
+			if seen[key] {
+				continue
+			}
+			tmpl, err := LoadWorkflowTemplate(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			seen[key] = true
+			templates = append(templates, tmpl)
+		}
+	}
+	if !seen[strings.ToLower(WorkflowTemplatePromptV5)] {
+		templates = append(templates, promptV5Template())
+	}
+	sort.SliceStable(templates, func(i, j int) bool {
+		return strings.ToLower(templates[i].Name) < strings.ToLower(templates[j].Name)
+	})
+	return templates, errs
+}
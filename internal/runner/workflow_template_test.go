@@ -0,0 +1,322 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
+)
+
+const testShipTemplate = `name: ship
+description: plan, implement and review
+agent: claude
+vars:
+  branch: main
+stages:
+  - name: Plan
+    prompt: "Plan {{.TaskID}} on {{.Vars.branch}}"
+  - name: Review
+    agent: codex
+    timeout: 5m
+    retries: 1
+    prompt: "Review attempt {{.Attempt}}: {{.PreviousOutput}}"
+    gate:
+      output_contains: APPROVED
+  - name: Ship
+    prompt: "Ship after {{.PreviousOutput}}"
+`
+
+// writeStageOutput returns an executor result whose output.md holds output.
+func writeStageOutput(t *testing.T, taskDir, runID, output string) *storage.RunInfo {
+	t.Helper()
+	runDir := filepath.Join(taskDir, "runs", runID)
+	if err := os.MkdirAll(runDir, 0o755); err != nil {
+		t.Fatalf("mkdir run dir: %v", err)
+	}
+	outputPath := filepath.Join(runDir, "output.md")
+	if err := os.WriteFile(outputPath, []byte(output), 0o644); err != nil {
+		t.Fatalf("write output: %v", err)
+	}
+	return &storage.RunInfo{RunID: runID, OutputPath: outputPath}
+}
+
+func TestRunWorkflowCustomTemplateFromProjectDir(t *testing.T) {
+	root := t.TempDir()
+	projectID := "my-project"
+	taskID := "task-20260301-101010-ship"
+	taskDir := filepath.Join(root, projectID, taskID)
+	templatesDir := filepath.Join(root, projectID, WorkflowTemplatesDirName)
+	if err := os.MkdirAll(templatesDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(templatesDir, "ship.yaml"), []byte(testShipTemplate), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	var prompts, agents []string
+	var timeouts []time.Duration
+	calls := 0
+	result, err := RunWorkflow(projectID, taskID, WorkflowOptions{
+		RootDir:  root,
+		Template: "ship",
+		ToStage:  -1,
+		Vars:     map[string]string{"branch": "release"},
+		stageExecutor: func(projectID, taskID string, stage int, prompt string, opts WorkflowOptions) (*storage.RunInfo, error) {
+			calls++
+			prompts = append(prompts, prompt)
+			agents = append(agents, opts.Agent)
+			timeouts = append(timeouts, opts.Timeout)
+			output := fmt.Sprintf("stage %d done", stage)
+			if stage == 1 && calls == 2 {
+				output = "CHANGES REQUESTED"
+			} else if stage == 1 {
+				output = "APPROVED"
+			}
+			return writeStageOutput(t, taskDir, fmt.Sprintf("run-%d", calls), output), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+
+	wantPrompts := []string{
+		"Plan " + taskID + " on release",
+		"Review attempt 1: stage 0 done",
+		"Review attempt 2: stage 0 done",
+		"Ship after APPROVED",
+	}
+	if !reflect.DeepEqual(prompts, wantPrompts) {
+		t.Fatalf("prompts = %q, want %q", prompts, wantPrompts)
+	}
+	if want := []string{"claude", "codex", "codex", "claude"}; !reflect.DeepEqual(agents, want) {
+		t.Fatalf("agents = %v, want %v", agents, want)
+	}
+	if timeouts[1] != 5*time.Minute || timeouts[0] != 0 {
+		t.Fatalf("timeouts = %v", timeouts)
+	}
+	if result.Template != "ship" || result.ToStage != 2 || !strings.HasSuffix(result.TemplateSource, "ship.yaml") {
+		t.Fatalf("result = %+v", result)
+	}
+	if got := filepath.Base(filepath.Dir(result.StatePath)); got != "ship" {
+		t.Fatalf("state dir = %q, want ship", got)
+	}
+
+	state, err := loadWorkflowState(result.StatePath)
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	review := findOrCreateWorkflowStage(state, 1)
+	if review.Name != "Review" || review.Attempts != 2 || review.Status != workflowStageStatusCompleted {
+		t.Fatalf("review stage = %+v", review)
+	}
+}
+
+func TestRunWorkflowGateFailureExhaustsRetries(t *testing.T) {
+	root := t.TempDir()
+	projectID := "my-project"
+	taskID := "task-20260301-111111-gate"
+	taskDir := filepath.Join(root, projectID, taskID)
+	templatePath := filepath.Join(t.TempDir(), "review.yml")
+	if err := os.WriteFile(templatePath, []byte(`stages:
+  - name: Review
+    prompt: review
+    retries: 2
+    gate:
+      output_matches: "(?m)^VERDICT: APPROVED$"
+`), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	calls := 0
+	result, err := RunWorkflow(projectID, taskID, WorkflowOptions{
+		RootDir:  root,
+		Template: templatePath,
+		ToStage:  -1,
+		stageExecutor: func(projectID, taskID string, stage int, prompt string, opts WorkflowOptions) (*storage.RunInfo, error) {
+			calls++
+			return writeStageOutput(t, taskDir, fmt.Sprintf("run-%d", calls), "VERDICT: REJECTED"), nil
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "gate: output does not match") {
+		t.Fatalf("expected gate failure, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("attempts = %d, want 3", calls)
+	}
+	stage := findOrCreateWorkflowStage(&result.State, 0)
+	if stage.Status != workflowStageStatusFailed || stage.Attempts != 3 || stage.RunID != "run-3" {
+		t.Fatalf("stage = %+v", stage)
+	}
+	if result.Template != "review" {
+		t.Fatalf("template = %q, want the file name", result.Template)
+	}
+}
+
+func TestPromptV5TemplateRendersStagePrompt(t *testing.T) {
+	tmpl, err := ResolveWorkflowTemplate("", nil)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if tmpl.Name != WorkflowTemplatePromptV5 || len(tmpl.Stages) != 13 {
+		t.Fatalf("template = %s with %d stages", tmpl.Name, len(tmpl.Stages))
+	}
+	prompt, err := tmpl.Stages[3].renderPrompt(workflowPromptData{Template: tmpl.Name, Stage: 3, StageName: tmpl.Stages[3].Name, TaskDir: "/tmp/task"})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.HasPrefix(prompt, "Workflow stage execution request.\n\nTemplate: THE_PROMPT_v5\nStage: 3 - Decomposition\nTask folder: /tmp/task\n") {
+		t.Fatalf("prompt = %q", prompt)
+	}
+}
+
+func TestResolveWorkflowTemplateErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"empty":     "name: empty\n",
+		"no-prompt": "stages:\n  - name: A\n",
+		"bad-gate":  "stages:\n  - prompt: x\n    gate: {output_matches: \"(\"}\n",
+		"bad-time":  "timeout: soon\nstages:\n  - prompt: x\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name+".yaml"), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		if _, err := ResolveWorkflowTemplate(name, []string{dir}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := ResolveWorkflowTemplate("missing", []string{dir}); err == nil || !strings.Contains(err.Error(), "unsupported template") {
+		t.Fatalf("missing template error = %v", err)
+	}
+
+	templates, errs := ListWorkflowTemplates([]string{dir})
+	if len(templates) != 1 || templates[0].Name != WorkflowTemplatePromptV5 || len(errs) != 4 {
+		t.Fatalf("templates = %d, errs = %v", len(templates), errs)
+	}
+}
+
+const testReviewTemplate = `name: review
+stages:
+  - name: Implement
+    prompt: implement
+  - name: Lint
+    parallel: checks
+    prompt: lint
+  - name: Review
+    parallel: checks
+    agents: [claude, codex]
+    prompt: "review {{.Instance}}/{{.Instances}}"
+  - name: Synthesis
+    prompt: "{{.PreviousOutput}}"
+`
+
+func TestRunWorkflowParallelGroupAndFanOut(t *testing.T) {
+	root := t.TempDir()
+	projectID := "my-project"
+	taskID := "task-20260301-121212-review"
+	taskDir := filepath.Join(root, projectID, taskID)
+	templatePath := filepath.Join(t.TempDir(), "review.yaml")
+	if err := os.WriteFile(templatePath, []byte(testReviewTemplate), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	// The three runs of the checks step must all be in flight at once.
+	arrived := make(chan struct{}, 3)
+	release := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			<-arrived
+		}
+		close(release)
+	}()
+	var mu sync.Mutex
+	var fanInPrompt string
+	agents := map[string]bool{}
+	calls := 0
+	result, err := RunWorkflow(projectID, taskID, WorkflowOptions{
+		RootDir:  root,
+		Template: templatePath,
+		ToStage:  -1,
+		stageExecutor: func(projectID, taskID string, stage int, prompt string, opts WorkflowOptions) (*storage.RunInfo, error) {
+			mu.Lock()
+			calls++
+			runID := fmt.Sprintf("run-%d-%d", stage, calls)
+			if stage == 2 {
+				agents[opts.Agent] = true
+			}
+			if stage == 3 {
+				fanInPrompt = prompt
+			}
+			mu.Unlock()
+			if stage == 1 || stage == 2 {
+				arrived <- struct{}{}
+				select {
+				case <-release:
+				case <-time.After(5 * time.Second):
+					return nil, fmt.Errorf("stage %d was not run in parallel", stage)
+				}
+			}
+			return writeStageOutput(t, taskDir, runID, "output of "+prompt), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunWorkflow: %v", err)
+	}
+	if want := [][]int{{0}, {1, 2}, {3}}; !reflect.DeepEqual(result.PlannedSteps, want) {
+		t.Fatalf("planned steps = %v, want %v", result.PlannedSteps, want)
+	}
+	if !agents["claude"] || !agents["codex"] {
+		t.Fatalf("fan-out agents = %v", agents)
+	}
+	for _, want := range []string{"output of lint", "output of review 1/2", "output of review 2/2", "(stage 2: Review)"} {
+		if !strings.Contains(fanInPrompt, want) {
+			t.Fatalf("fan-in prompt missing %q:\n%s", want, fanInPrompt)
+		}
+	}
+	review := findWorkflowStage(&result.State, 2)
+	if review == nil || len(review.RunIDs) != 2 || review.RunIDs[0] == "" || review.Attempts != 2 {
+		t.Fatalf("review stage = %+v", review)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(result.StatePath), "stages-1-2-synthesis.md")); err != nil {
+		t.Fatalf("synthesis file: %v", err)
+	}
+}
+
+func TestRunWorkflowFanOutInstanceFailureFailsStage(t *testing.T) {
+	root := t.TempDir()
+	templatePath := filepath.Join(t.TempDir(), "reviewers.yaml")
+	if err := os.WriteFile(templatePath, []byte("stages:\n  - name: Review\n    fan_out: 3\n    prompt: \"reviewer {{.Instance}}\"\n"), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	result, err := RunWorkflow("my-project", "task-20260301-131313-fanout", WorkflowOptions{
+		RootDir:  root,
+		Template: templatePath,
+		ToStage:  -1,
+		stageExecutor: func(projectID, taskID string, stage int, prompt string, opts WorkflowOptions) (*storage.RunInfo, error) {
+			if prompt == "reviewer 2" {
+				return &storage.RunInfo{RunID: "run-b"}, fmt.Errorf("agent crashed")
+			}
+			return &storage.RunInfo{RunID: "run-" + prompt[len(prompt)-1:]}, nil
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "workflow stage 0 failed: instance 2: agent crashed") {
+		t.Fatalf("expected instance failure, got %v", err)
+	}
+	stage := findWorkflowStage(&result.State, 0)
+	if stage.Status != workflowStageStatusFailed || !reflect.DeepEqual(stage.RunIDs, []string{"run-1", "run-b", "run-3"}) {
+		t.Fatalf("stage = %+v", stage)
+	}
+
+	v5, err := ResolveWorkflowTemplate(WorkflowTemplatePromptV5, nil)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if steps := v5.workflowSteps(7, 10); !reflect.DeepEqual(steps, [][]int{{7}, {8, 9}, {10}}) {
+		t.Fatalf("THE_PROMPT_v5 steps = %v", steps)
+	}
+}
@@ -228,7 +228,7 @@ func runWrap(projectID, taskID, agentType string, forwardedArgs []string, opts W
 		if timedOut {
 			info.ErrorSummary = "timed out"
 		} else if exitCode != 0 {
-			info.ErrorSummary = classifyExitCode(exitCode)
+			info.ErrorSummary = classifyExitCode(exitCode, false)
 		} else if waitErr != nil {
 			errMsg := waitErr.Error()
 			if len(errMsg) > 200 {
@@ -0,0 +1,20 @@
+package storage
+
+// ResourceUsage is the cgroup v2 accounting recorded for a run when
+// defaults.resources is configured.
+type ResourceUsage struct {
+	// Cgroup is the run's cgroup path relative to the cgroup v2 mount.
+	Cgroup           string  `yaml:"cgroup" json:"cgroup"`
+	PeakMemoryBytes  int64   `yaml:"peak_memory_bytes,omitempty" json:"peak_memory_bytes,omitempty"`
+	CPUSeconds       float64 `yaml:"cpu_seconds,omitempty" json:"cpu_seconds,omitempty"`
+	CPUUserSeconds   float64 `yaml:"cpu_user_seconds,omitempty" json:"cpu_user_seconds,omitempty"`
+	CPUSystemSeconds float64 `yaml:"cpu_system_seconds,omitempty" json:"cpu_system_seconds,omitempty"`
+	// OOMKills counts processes killed by the kernel OOM killer because the
+	// cgroup hit memory.max.
+	OOMKills int `yaml:"oom_kills,omitempty" json:"oom_kills,omitempty"`
+}
+
+// OOMKilled reports whether the run lost a process to the OOM killer.
+func (r *ResourceUsage) OOMKilled() bool {
+	return r != nil && r.OOMKills > 0
+}
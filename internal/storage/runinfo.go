@@ -49,4 +49,16 @@ type RunInfo struct {
 	CommandLine      string    `yaml:"commandline,omitempty"`
 	ErrorSummary     string    `yaml:"error_summary,omitempty"`
 	AgentVersion     string    `yaml:"agent_version"`
+	Usage            *Usage    `yaml:"usage,omitempty"`
+
+	// WorktreeBranch and WorktreeBaseCommit are set when the task runs in an
+	// isolated git worktree (see internal/worktree).
+	WorktreeBranch     string `yaml:"worktree_branch,omitempty"`
+	WorktreeBaseCommit string `yaml:"worktree_base_commit,omitempty"`
+
+	// Sandbox is the sandbox mode (bwrap, podman, docker) the agent ran in.
+	Sandbox string `yaml:"sandbox,omitempty"`
+
+	// Resources is the cgroup accounting of the run (Linux only).
+	Resources *ResourceUsage `yaml:"resources,omitempty"`
 }
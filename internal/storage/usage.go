@@ -0,0 +1,97 @@
+package storage
+
+import "strings"
+
+const (
+	// CostSourceAgent marks a cost reported directly by the agent output.
+	CostSourceAgent = "agent"
+	// CostSourcePriceTable marks a cost estimated from the configured price table.
+	CostSourcePriceTable = "price_table"
+)
+
+// Usage records token consumption and cost reported for a run.
+// InputTokens counts all prompt tokens, including CachedInputTokens.
+type Usage struct {
+	InputTokens       int64   `yaml:"input_tokens" json:"input_tokens"`
+	OutputTokens      int64   `yaml:"output_tokens" json:"output_tokens"`
+	CachedInputTokens int64   `yaml:"cached_input_tokens,omitempty" json:"cached_input_tokens,omitempty"`
+	CostUSD           float64 `yaml:"cost_usd,omitempty" json:"cost_usd,omitempty"`
+	CostSource        string  `yaml:"cost_source,omitempty" json:"cost_source,omitempty"`
+	Model             string  `yaml:"model,omitempty" json:"model,omitempty"`
+}
+
+// TotalTokens returns the sum of input and output tokens.
+func (u Usage) TotalTokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// IsZero reports whether the usage carries no token or cost data.
+func (u Usage) IsZero() bool {
+	return u.InputTokens == 0 && u.OutputTokens == 0 && u.CachedInputTokens == 0 && u.CostUSD == 0
+}
+
+// Add accumulates other into u. The model is kept only while all added
+// entries agree on it; the cost source degrades the same way.
+func (u *Usage) Add(other Usage) {
+	if u == nil {
+		return
+	}
+	wasZero := u.IsZero() && u.Model == ""
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.CachedInputTokens += other.CachedInputTokens
+	u.CostUSD += other.CostUSD
+	if wasZero {
+		u.Model = other.Model
+		u.CostSource = other.CostSource
+		return
+	}
+	if !strings.EqualFold(u.Model, other.Model) {
+		u.Model = ""
+	}
+	if u.CostSource != other.CostSource {
+		u.CostSource = ""
+	}
+}
+
+// UsageTotals aggregates usage across a set of runs.
+type UsageTotals struct {
+	Runs              int     `json:"runs"`
+	RunsWithUsage     int     `json:"runs_with_usage"`
+	InputTokens       int64   `json:"input_tokens"`
+	OutputTokens      int64   `json:"output_tokens"`
+	CachedInputTokens int64   `json:"cached_input_tokens"`
+	TotalTokens       int64   `json:"total_tokens"`
+	CostUSD           float64 `json:"cost_usd"`
+}
+
+// AddRun accumulates the usage recorded in info (if any) into the totals.
+func (t *UsageTotals) AddRun(info *RunInfo) {
+	if t == nil || info == nil {
+		return
+	}
+	t.Runs++
+	if info.Usage == nil || info.Usage.IsZero() {
+		return
+	}
+	t.RunsWithUsage++
+	t.InputTokens += info.Usage.InputTokens
+	t.OutputTokens += info.Usage.OutputTokens
+	t.CachedInputTokens += info.Usage.CachedInputTokens
+	t.TotalTokens += info.Usage.TotalTokens()
+	t.CostUSD += info.Usage.CostUSD
+}
+
+// Merge accumulates other totals into t.
+func (t *UsageTotals) Merge(other UsageTotals) {
+	if t == nil {
+		return
+	}
+	t.Runs += other.Runs
+	t.RunsWithUsage += other.RunsWithUsage
+	t.InputTokens += other.InputTokens
+	t.OutputTokens += other.OutputTokens
+	t.CachedInputTokens += other.CachedInputTokens
+	t.TotalTokens += other.TotalTokens
+	t.CostUSD += other.CostUSD
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestUsageAdd(t *testing.T) {
+	var total Usage
+	total.Add(Usage{InputTokens: 10, OutputTokens: 5, Model: "m1", CostSource: CostSourceAgent, CostUSD: 0.1})
+	total.Add(Usage{InputTokens: 20, OutputTokens: 5, CachedInputTokens: 15, Model: "m1", CostSource: CostSourceAgent, CostUSD: 0.2})
+	if total.InputTokens != 30 || total.OutputTokens != 10 || total.CachedInputTokens != 15 {
+		t.Fatalf("unexpected totals: %+v", total)
+	}
+	if total.Model != "m1" || total.CostSource != CostSourceAgent {
+		t.Fatalf("expected model and source kept, got %+v", total)
+	}
+	total.Add(Usage{InputTokens: 1, Model: "m2", CostSource: CostSourcePriceTable})
+	if total.Model != "" || total.CostSource != "" {
+		t.Fatalf("expected mixed model/source cleared, got %+v", total)
+	}
+	if total.TotalTokens() != 41 {
+		t.Fatalf("TotalTokens=%d, want 41", total.TotalTokens())
+	}
+}
+
+func TestUsageTotalsAddRun(t *testing.T) {
+	var totals UsageTotals
+	totals.AddRun(&RunInfo{RunID: "a"})
+	totals.AddRun(&RunInfo{RunID: "b", Usage: &Usage{InputTokens: 3, OutputTokens: 4, CostUSD: 1.5}})
+	totals.AddRun(nil)
+	if totals.Runs != 2 || totals.RunsWithUsage != 1 {
+		t.Fatalf("unexpected run counts: %+v", totals)
+	}
+	if totals.TotalTokens != 7 || totals.CostUSD != 1.5 {
+		t.Fatalf("unexpected totals: %+v", totals)
+	}
+	var merged UsageTotals
+	merged.Merge(totals)
+	merged.Merge(totals)
+	if merged.Runs != 4 || merged.TotalTokens != 14 {
+		t.Fatalf("unexpected merged totals: %+v", merged)
+	}
+}
+
+func TestRunInfoUsageRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run-info.yaml")
+	info := &RunInfo{
+		RunID:  "run-1",
+		Status: StatusCompleted,
+		Usage:  &Usage{InputTokens: 12, OutputTokens: 34, CachedInputTokens: 5, CostUSD: 0.25, CostSource: CostSourceAgent, Model: "m"},
+	}
+	if err := WriteRunInfo(path, info); err != nil {
+		t.Fatalf("WriteRunInfo: %v", err)
+	}
+	got, err := ReadRunInfo(path)
+	if err != nil {
+		t.Fatalf("ReadRunInfo: %v", err)
+	}
+	if got.Usage == nil || *got.Usage != *info.Usage {
+		t.Fatalf("usage mismatch: %+v", got.Usage)
+	}
+}
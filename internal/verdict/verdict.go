@@ -0,0 +1,50 @@
+// Package verdict reads the verdict of a review or validation from agent
+// output for workflow routes. run-agent iterate and review quorum keep their
+// own token lists, where approval wins.
+package verdict
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Verdicts returned by Detect.
+const (
+	Pass    = "pass"
+	Fail    = "fail"
+	Unknown = "unknown"
+)
+
+// Tokens are matched as whole words, ignoring case, so "no failures",
+// "PASSWORD" or "COMPASS" carry no verdict.
+var (
+	passTokens = []string{"APPROVED", "PASS", "PASSED", "LGTM", "+1"}
+	failTokens = []string{"REJECTED", "FAIL", "FAILED", "CHANGES_REQUESTED", "BLOCKED"}
+
+	passPattern = wordsPattern(passTokens)
+	failPattern = wordsPattern(failTokens)
+)
+
+// Detect returns Fail when output holds a fail token, else Pass when it holds
+// a pass token, else Unknown. Fail tokens win, so a review that approves one
+// part and rejects another fails.
+func Detect(output string) string {
+	switch {
+	case failPattern.MatchString(output):
+		return Fail
+	case passPattern.MatchString(output):
+		return Pass
+	}
+	return Unknown
+}
+
+// wordsPattern matches any of tokens between non-word characters or the
+// ends of the text. Tokens like "+1" start with a non-word character, so
+// \b cannot delimit them.
+func wordsPattern(tokens []string) *regexp.Regexp {
+	quoted := make([]string, len(tokens))
+	for i, tok := range tokens {
+		quoted[i] = regexp.QuoteMeta(tok)
+	}
+	return regexp.MustCompile(`(?i)(?:^|\W)(?:` + strings.Join(quoted, "|") + `)(?:\W|$)`)
+}
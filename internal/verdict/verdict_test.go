@@ -0,0 +1,34 @@
+package verdict
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		output string
+		want   string
+	}{
+		{"APPROVED", Pass},
+		{"approved", Pass},
+		{"This looks great, APPROVED!", Pass},
+		{"All PASS", Pass},
+		{"LGTM from me", Pass},
+		{"+1 ship it", Pass},
+		{"12 tests passed.", Pass},
+		{"REJECTED", Fail},
+		{"FAIL", Fail},
+		{"CHANGES_REQUESTED", Fail},
+		{"I say REJECTED!", Fail},
+		{"2 tests failed", Fail},
+		{"Lint PASS, tests FAIL", Fail},
+		{"BLOCKED: missing tests", Fail},
+		{"Looks good to me, but no verdict token.", Unknown},
+		{"no failures so far", Unknown},
+		{"the PASSWORD check uses a COMPASS", Unknown},
+		{"x+1 is off by one", Unknown},
+		{"", Unknown},
+	} {
+		if got := Detect(tc.output); got != tc.want {
+			t.Errorf("Detect(%q) = %q, want %q", tc.output, got, tc.want)
+		}
+	}
+}
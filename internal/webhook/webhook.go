@@ -1,4 +1,5 @@
-// Package webhook provides HTTP webhook notifications for run completion events.
+// Package webhook provides HTTP webhook notifications for run completion
+// events and for questions agents ask a human.
 package webhook
 
 import (
@@ -12,22 +13,39 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/jonnyzzz/conductor-loop/internal/changes"
 	"github.com/jonnyzzz/conductor-loop/internal/config"
+	"github.com/jonnyzzz/conductor-loop/internal/storage"
 )
 
 // RunStopPayload is the JSON payload sent for run_stop events.
 type RunStopPayload struct {
-	Event           string    `json:"event"`
-	ProjectID       string    `json:"project_id"`
-	TaskID          string    `json:"task_id"`
-	RunID           string    `json:"run_id"`
-	AgentType       string    `json:"agent_type"`
-	Status          string    `json:"status"`
-	ExitCode        int       `json:"exit_code"`
-	StartedAt       time.Time `json:"started_at"`
-	StoppedAt       time.Time `json:"stopped_at"`
-	DurationSeconds float64   `json:"duration_seconds"`
-	ErrorSummary    string    `json:"error_summary,omitempty"`
+	Event           string         `json:"event"`
+	ProjectID       string         `json:"project_id"`
+	TaskID          string         `json:"task_id"`
+	RunID           string         `json:"run_id"`
+	AgentType       string         `json:"agent_type"`
+	Status          string         `json:"status"`
+	ExitCode        int            `json:"exit_code"`
+	StartedAt       time.Time      `json:"started_at"`
+	StoppedAt       time.Time      `json:"stopped_at"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	ErrorSummary    string         `json:"error_summary,omitempty"`
+	Usage           *storage.Usage `json:"usage,omitempty"`
+	// Changes lists the files the run changed in its working directory.
+	Changes *changes.Set `json:"changes,omitempty"`
+}
+
+// QuestionPayload is the JSON payload sent for question events: an agent
+// posted a QUESTION and waits for a human to answer it.
+type QuestionPayload struct {
+	Event     string    `json:"event"`
+	ProjectID string    `json:"project_id"`
+	TaskID    string    `json:"task_id,omitempty"`
+	RunID     string    `json:"run_id,omitempty"`
+	MsgID     string    `json:"msg_id"`
+	Body      string    `json:"body"`
+	AskedAt   time.Time `json:"asked_at"`
 }
 
 // Notifier sends webhook notifications for run events.
@@ -56,31 +74,49 @@ func NewNotifier(cfg *config.WebhookConfig) *Notifier {
 // SendRunStop sends a run_stop event webhook asynchronously. It is non-blocking.
 // onError is called (in a goroutine) if all retries fail; it may be nil.
 func (n *Notifier) SendRunStop(payload RunStopPayload, onError func(err error)) {
-	if n == nil {
+	if n == nil || !n.allows("run_stop", payload.Event) {
 		return
 	}
-	if len(n.cfg.Events) > 0 {
-		allowed := false
-		for _, e := range n.cfg.Events {
-			if e == "run_stop" || e == payload.Event {
-				allowed = true
-				break
-			}
+	go func() {
+		if err := n.deliver(payload); err != nil && onError != nil {
+			onError(err)
 		}
-		if !allowed {
-			return
+	}()
+}
+
+// SendQuestion sends a question event webhook and waits for the delivery,
+// so short-lived callers such as the CLI do not exit before it is sent.
+func (n *Notifier) SendQuestion(payload QuestionPayload) error {
+	if payload.Event == "" {
+		payload.Event = "question"
+	}
+	if n == nil || !n.allows("question", payload.Event) {
+		return nil
+	}
+	return n.deliver(payload)
+}
+
+// allows reports whether the configured event filter admits an event.
+// An empty filter admits all events.
+func (n *Notifier) allows(names ...string) bool {
+	if len(n.cfg.Events) == 0 {
+		return true
+	}
+	for _, e := range n.cfg.Events {
+		for _, name := range names {
+			if e == name {
+				return true
+			}
 		}
 	}
-	go n.sendWithRetry(payload, onError)
+	return false
 }
 
-func (n *Notifier) sendWithRetry(payload RunStopPayload, onError func(err error)) {
+// deliver posts payload, retrying up to 3 times with backoff.
+func (n *Notifier) deliver(payload interface{}) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
-		if onError != nil {
-			onError(fmt.Errorf("marshal payload: %w", err))
-		}
-		return
+		return fmt.Errorf("marshal payload: %w", err)
 	}
 
 	var lastErr error
@@ -92,11 +128,9 @@ func (n *Notifier) sendWithRetry(payload RunStopPayload, onError func(err error)
 			lastErr = err
 			continue
 		}
-		return // success
-	}
-	if onError != nil {
-		onError(fmt.Errorf("webhook delivery failed after 3 attempts: %w", lastErr))
+		return nil // success
 	}
+	return fmt.Errorf("webhook delivery failed after 3 attempts: %w", lastErr)
 }
 
 func (n *Notifier) send(body []byte) error {
@@ -238,3 +238,40 @@ func TestSendRunStop_NoSecretNoHeader(t *testing.T) {
 		t.Fatal("timeout waiting for webhook delivery")
 	}
 }
+
+func TestSendQuestion(t *testing.T) {
+	payloadCh := make(chan QuestionPayload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p QuestionPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		payloadCh <- p
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	// run_stop-only subscribers do not get questions.
+	n := NewNotifier(&config.WebhookConfig{URL: srv.URL, Events: []string{"run_stop"}})
+	if err := n.SendQuestion(QuestionPayload{ProjectID: "p", MsgID: "MSG-1"}); err != nil {
+		t.Fatalf("SendQuestion (filtered): %v", err)
+	}
+	if len(payloadCh) != 0 {
+		t.Fatal("expected filtered question event not to be delivered")
+	}
+
+	n = NewNotifier(&config.WebhookConfig{URL: srv.URL, Events: []string{"question"}})
+	if err := n.SendQuestion(QuestionPayload{ProjectID: "p", TaskID: "t", MsgID: "MSG-1", Body: "deploy?"}); err != nil {
+		t.Fatalf("SendQuestion: %v", err)
+	}
+	got := <-payloadCh
+	if got.Event != "question" || got.MsgID != "MSG-1" || got.Body != "deploy?" {
+		t.Fatalf("unexpected payload: %+v", got)
+	}
+
+	var nilNotifier *Notifier
+	if err := nilNotifier.SendQuestion(QuestionPayload{}); err != nil {
+		t.Fatalf("nil notifier: %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+// Package worktree isolates a task in a dedicated git worktree and branch
+// under the task directory, and integrates the branch back when the task is
+// done.
+package worktree
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FileName is the task-local file that records the task worktree.
+	FileName = "TASK-WORKTREE.yaml"
+	// DirName is the worktree checkout directory inside the task directory.
+	DirName = "worktree"
+	// BranchPrefix prefixes the branch created for each task.
+	BranchPrefix = "run-agent/"
+)
+
+// Isolation modes.
+const (
+	ModeNone     = "none"
+	ModeWorktree = "worktree"
+)
+
+// Policies applied to the task branch once the task is DONE.
+const (
+	// PolicyBranch leaves the branch and worktree for manual review.
+	PolicyBranch = "branch"
+	// PolicyMerge merges the branch into the base branch with a merge commit.
+	PolicyMerge = "merge"
+	// PolicyRebase rebases the branch onto the base branch and fast-forwards.
+	PolicyRebase = "rebase"
+)
+
+// Outcomes recorded after Complete.
+const (
+	OutcomeLeft    = "left"
+	OutcomeMerged  = "merged"
+	OutcomeRebased = "rebased"
+	OutcomeEmpty   = "empty"
+)
+
+// Info describes a task worktree; it is persisted as TASK-WORKTREE.yaml.
+type Info struct {
+	// Repo is the top-level directory of the main checkout.
+	Repo string `yaml:"repo"`
+	// Path is the worktree directory.
+	Path   string `yaml:"path"`
+	Branch string `yaml:"branch"`
+	// BaseBranch is the branch checked out in Repo when the worktree was
+	// created; empty when the main checkout was detached.
+	BaseBranch string `yaml:"base_branch,omitempty"`
+	BaseCommit string `yaml:"base_commit"`
+	// Subdir is the requested working directory relative to Repo.
+	Subdir    string    `yaml:"subdir,omitempty"`
+	OnDone    string    `yaml:"on_done,omitempty"`
+	CreatedAt time.Time `yaml:"created_at"`
+	Outcome   string    `yaml:"outcome,omitempty"`
+	Removed   bool      `yaml:"removed,omitempty"`
+}
+
+// WorkingDir returns the run working directory inside the worktree.
+func (i *Info) WorkingDir() string {
+	if i.Subdir == "" {
+		return i.Path
+	}
+	return filepath.Join(i.Path, i.Subdir)
+}
+
+// NormalizeMode validates an isolation mode; empty means ModeNone.
+func NormalizeMode(mode string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", ModeNone:
+		return ModeNone, nil
+	case ModeWorktree:
+		return ModeWorktree, nil
+	}
+	return "", errors.Errorf("invalid isolation %q; valid values: none, worktree", mode)
+}
+
+// NormalizePolicy validates an on-done policy; empty means PolicyBranch.
+func NormalizePolicy(policy string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", PolicyBranch:
+		return PolicyBranch, nil
+	case PolicyMerge:
+		return PolicyMerge, nil
+	case PolicyRebase:
+		return PolicyRebase, nil
+	}
+	return "", errors.Errorf("invalid on-done policy %q; valid values: branch, merge, rebase", policy)
+}
+
+// Read loads TASK-WORKTREE.yaml from taskDir. It returns (nil, nil) when the
+// task has no worktree.
+func Read(taskDir string) (*Info, error) {
+	data, err := os.ReadFile(filepath.Join(taskDir, FileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "read task worktree")
+	}
+	var info Info
+	if err := yaml.Unmarshal(data, &info); err != nil {
+		return nil, errors.Wrap(err, "unmarshal task worktree")
+	}
+	return &info, nil
+}
+
+// Write stores info as TASK-WORKTREE.yaml in taskDir.
+func Write(taskDir string, info *Info) error {
+	data, err := yaml.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "marshal task worktree")
+	}
+	if err := os.WriteFile(filepath.Join(taskDir, FileName), data, 0o644); err != nil {
+		return errors.Wrap(err, "write task worktree")
+	}
+	return nil
+}
+
+// Ensure returns the worktree of the task, creating it from the repository
+// containing workingDir on first use. Restarts reuse the existing worktree;
+// a non-empty onDone replaces the recorded policy.
+func Ensure(taskDir, taskID, workingDir, onDone string) (*Info, error) {
+	policy := ""
+	if strings.TrimSpace(onDone) != "" {
+		var err error
+		if policy, err = NormalizePolicy(onDone); err != nil {
+			return nil, err
+		}
+	}
+	info, err := Read(taskDir)
+	if err != nil {
+		return nil, err
+	}
+	if info != nil && !info.Removed {
+		if _, statErr := os.Stat(info.Path); statErr == nil {
+			if policy != "" && policy != info.OnDone {
+				info.OnDone = policy
+				if err := Write(taskDir, info); err != nil {
+					return nil, err
+				}
+			}
+			return info, nil
+		}
+	}
+
+	repo, err := git(workingDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, errors.Wrap(err, "worktree isolation requires a git repository")
+	}
+	repo, err = filepath.EvalSymlinks(repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve repository root")
+	}
+	resolvedWD, err := filepath.EvalSymlinks(workingDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve working directory")
+	}
+	subdir, err := filepath.Rel(repo, resolvedWD)
+	if err != nil || strings.HasPrefix(subdir, "..") {
+		return nil, errors.Errorf("working directory %s is outside repository %s", workingDir, repo)
+	}
+	if subdir == "." {
+		subdir = ""
+	}
+
+	branch := BranchPrefix + taskID
+	if _, err := git(repo, "check-ref-format", "--branch", branch); err != nil {
+		return nil, errors.Wrapf(err, "task id %q is not a valid branch name", taskID)
+	}
+	path := filepath.Join(taskDir, DirName)
+	if abs, absErr := filepath.Abs(path); absErr == nil {
+		path = abs
+	}
+	// A removed or deleted worktree leaves stale metadata in the repository.
+	_, _ = git(repo, "worktree", "prune")
+
+	if info == nil {
+		baseCommit, err := git(repo, "rev-parse", "HEAD")
+		if err != nil {
+			return nil, errors.Wrap(err, "resolve base commit")
+		}
+		baseBranch, _ := git(repo, "symbolic-ref", "--quiet", "--short", "HEAD")
+		info = &Info{
+			Repo:       repo,
+			Branch:     branch,
+			BaseBranch: baseBranch,
+			BaseCommit: baseCommit,
+			OnDone:     PolicyBranch,
+			CreatedAt:  time.Now().UTC(),
+		}
+	}
+	info.Path = path
+	info.Subdir = subdir
+	info.Removed = false
+	info.Outcome = ""
+	if policy != "" {
+		info.OnDone = policy
+	}
+
+	if _, err := git(repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		_, err = git(repo, "worktree", "add", path, branch)
+		if err != nil {
+			return nil, errors.Wrap(err, "add worktree")
+		}
+	} else if _, err := git(repo, "worktree", "add", "-b", branch, path, info.BaseCommit); err != nil {
+		return nil, errors.Wrap(err, "add worktree")
+	}
+	if err := Write(taskDir, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Complete applies the recorded on-done policy to a finished task. Merge and
+// rebase commit pending worktree changes, integrate the branch into the base
+// branch checked out in the main repository, and then remove the worktree
+// and branch. On failure the branch and worktree are left untouched.
+func Complete(taskDir, taskID string) (*Info, error) {
+	info, err := Read(taskDir)
+	if err != nil || info == nil || info.Removed {
+		return info, err
+	}
+	policy, err := NormalizePolicy(info.OnDone)
+	if err != nil {
+		return info, err
+	}
+	if policy == PolicyBranch {
+		info.Outcome = OutcomeLeft
+		return info, Write(taskDir, info)
+	}
+
+	if err := commitPending(info.Path, fmt.Sprintf("run-agent: uncommitted changes of task %s", taskID)); err != nil {
+		return info, err
+	}
+	ahead, err := git(info.Repo, "rev-list", "--count", info.BaseCommit+".."+info.Branch)
+	if err != nil {
+		return info, errors.Wrap(err, "count task commits")
+	}
+	if ahead == "0" {
+		if err := Remove(info, true); err != nil {
+			return info, err
+		}
+		info.Outcome = OutcomeEmpty
+		return info, Write(taskDir, info)
+	}
+
+	if info.BaseBranch == "" {
+		return info, errors.New("base branch unknown (repository was detached when the worktree was created)")
+	}
+	current, _ := git(info.Repo, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if current != info.BaseBranch {
+		return info, errors.Errorf("base branch %s is not checked out in %s", info.BaseBranch, info.Repo)
+	}
+	if dirty, err := git(info.Repo, "status", "--porcelain", "--untracked-files=no"); err != nil {
+		return info, errors.Wrap(err, "check repository status")
+	} else if dirty != "" {
+		return info, errors.Errorf("repository %s has uncommitted changes", info.Repo)
+	}
+
+	switch policy {
+	case PolicyMerge:
+		if _, err := gitCommit(info.Repo, "merge", "--no-ff", "--no-edit", info.Branch); err != nil {
+			_, _ = git(info.Repo, "merge", "--abort")
+			return info, errors.Wrap(err, "merge task branch")
+		}
+		info.Outcome = OutcomeMerged
+	case PolicyRebase:
+		if _, err := gitCommit(info.Path, "rebase", info.BaseBranch); err != nil {
+			_, _ = git(info.Path, "rebase", "--abort")
+			return info, errors.Wrap(err, "rebase task branch")
+		}
+		if _, err := git(info.Repo, "merge", "--ff-only", info.Branch); err != nil {
+			return info, errors.Wrap(err, "fast-forward base branch")
+		}
+		info.Outcome = OutcomeRebased
+	}
+	if err := Remove(info, true); err != nil {
+		return info, err
+	}
+	return info, Write(taskDir, info)
+}
+
+// Remove deletes the worktree checkout and, when deleteBranch is set, the
+// task branch. Unmerged branches are only deleted by the merge policies
+// after integration, so the branch is removed with "branch -D".
+func Remove(info *Info, deleteBranch bool) error {
+	if info == nil || info.Removed {
+		return nil
+	}
+	if _, err := os.Stat(info.Path); err == nil {
+		if _, err := git(info.Repo, "worktree", "remove", "--force", info.Path); err != nil {
+			if rmErr := os.RemoveAll(info.Path); rmErr != nil {
+				return errors.Wrap(rmErr, "remove worktree")
+			}
+		}
+	}
+	_, _ = git(info.Repo, "worktree", "prune")
+	if deleteBranch {
+		if _, err := git(info.Repo, "branch", "-D", info.Branch); err != nil {
+			return errors.Wrap(err, "delete task branch")
+		}
+	}
+	info.Removed = true
+	return nil
+}
+
+// commitPending commits uncommitted changes in the worktree.
+func commitPending(dir, message string) error {
+	status, err := git(dir, "status", "--porcelain")
+	if err != nil {
+		return errors.Wrap(err, "check worktree status")
+	}
+	if status == "" {
+		return nil
+	}
+	if _, err := git(dir, "add", "-A"); err != nil {
+		return errors.Wrap(err, "stage worktree changes")
+	}
+	if _, err := gitCommit(dir, "commit", "-m", message); err != nil {
+		return errors.Wrap(err, "commit worktree changes")
+	}
+	return nil
+}
+
+// gitCommit runs a git command that creates commits, supplying a fallback
+// identity when none is configured.
+func gitCommit(dir string, args ...string) (string, error) {
+	if email, _ := git(dir, "config", "user.email"); email == "" {
+		args = append([]string{"-c", "user.name=run-agent", "-c", "user.email=run-agent@localhost"}, args...)
+	}
+	return git(dir, args...)
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_EDITOR=true")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return "", errors.Errorf("git %s: %v: %s", strings.Join(args, " "), err, msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
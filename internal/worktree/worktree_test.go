@@ -0,0 +1,212 @@
+package worktree
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// initRepo creates a repository with one commit on branch main.
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	runGit(t, repo, "init", "-q", "-b", "main")
+	if err := os.MkdirAll(filepath.Join(repo, "src"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "src", "a.txt"), []byte("a\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "init")
+	return repo
+}
+
+func TestNormalize(t *testing.T) {
+	if mode, err := NormalizeMode(""); err != nil || mode != ModeNone {
+		t.Fatalf("NormalizeMode(\"\") = %q, %v", mode, err)
+	}
+	if mode, err := NormalizeMode(" Worktree "); err != nil || mode != ModeWorktree {
+		t.Fatalf("NormalizeMode(Worktree) = %q, %v", mode, err)
+	}
+	if _, err := NormalizeMode("docker"); err == nil {
+		t.Fatalf("expected error for unknown mode")
+	}
+	if policy, err := NormalizePolicy(""); err != nil || policy != PolicyBranch {
+		t.Fatalf("NormalizePolicy(\"\") = %q, %v", policy, err)
+	}
+	if _, err := NormalizePolicy("squash"); err == nil {
+		t.Fatalf("expected error for unknown policy")
+	}
+}
+
+func TestEnsureCreatesAndReusesWorktree(t *testing.T) {
+	repo := initRepo(t)
+	taskDir := t.TempDir()
+
+	info, err := Ensure(taskDir, "task-1", filepath.Join(repo, "src"), "")
+	if err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	if info.Branch != "run-agent/task-1" || info.BaseBranch != "main" || info.OnDone != PolicyBranch {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if info.BaseCommit != runGit(t, repo, "rev-parse", "HEAD") {
+		t.Fatalf("base commit = %s", info.BaseCommit)
+	}
+	if info.WorkingDir() != filepath.Join(taskDir, DirName, "src") {
+		t.Fatalf("working dir = %s", info.WorkingDir())
+	}
+	if _, err := os.Stat(filepath.Join(info.WorkingDir(), "a.txt")); err != nil {
+		t.Fatalf("worktree not checked out: %v", err)
+	}
+	if branch := runGit(t, info.Path, "symbolic-ref", "--short", "HEAD"); branch != info.Branch {
+		t.Fatalf("worktree branch = %s", branch)
+	}
+
+	again, err := Ensure(taskDir, "task-1", filepath.Join(repo, "src"), "merge")
+	if err != nil {
+		t.Fatalf("Ensure again: %v", err)
+	}
+	if again.Path != info.Path || again.OnDone != PolicyMerge {
+		t.Fatalf("expected reuse with updated policy, got %+v", again)
+	}
+	stored, err := Read(taskDir)
+	if err != nil || stored == nil || stored.OnDone != PolicyMerge {
+		t.Fatalf("Read = %+v, %v", stored, err)
+	}
+}
+
+func TestEnsureRequiresGitRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	if _, err := Ensure(t.TempDir(), "task-1", t.TempDir(), ""); err == nil {
+		t.Fatalf("expected error outside a git repository")
+	}
+}
+
+func TestCompletePolicies(t *testing.T) {
+	for _, policy := range []string{PolicyMerge, PolicyRebase} {
+		t.Run(policy, func(t *testing.T) {
+			repo := initRepo(t)
+			taskDir := t.TempDir()
+			info, err := Ensure(taskDir, "task-1", repo, policy)
+			if err != nil {
+				t.Fatalf("Ensure: %v", err)
+			}
+			// Uncommitted agent changes are committed on completion.
+			if err := os.WriteFile(filepath.Join(info.Path, "b.txt"), []byte("b\n"), 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			// The base branch moves on while the task runs.
+			if err := os.WriteFile(filepath.Join(repo, "c.txt"), []byte("c\n"), 0o644); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			runGit(t, repo, "add", "-A")
+			runGit(t, repo, "commit", "-q", "-m", "base")
+
+			done, err := Complete(taskDir, "task-1")
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			want := OutcomeMerged
+			if policy == PolicyRebase {
+				want = OutcomeRebased
+			}
+			if done.Outcome != want || !done.Removed {
+				t.Fatalf("unexpected info: %+v", done)
+			}
+			if _, err := os.Stat(filepath.Join(repo, "b.txt")); err != nil {
+				t.Fatalf("task change not integrated: %v", err)
+			}
+			if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+				t.Fatalf("worktree still present: %v", err)
+			}
+			if branches := runGit(t, repo, "branch", "--list", info.Branch); branches != "" {
+				t.Fatalf("task branch not deleted: %s", branches)
+			}
+			parents := strings.Fields(runGit(t, repo, "rev-list", "--parents", "-n", "1", "HEAD"))
+			if policy == PolicyRebase && len(parents) != 2 {
+				t.Fatalf("rebase should produce linear history, got parents %v", parents)
+			}
+			if policy == PolicyMerge && len(parents) != 3 {
+				t.Fatalf("merge should produce a merge commit, got parents %v", parents)
+			}
+		})
+	}
+}
+
+func TestCompleteBranchPolicyLeavesWorktree(t *testing.T) {
+	repo := initRepo(t)
+	taskDir := t.TempDir()
+	info, err := Ensure(taskDir, "task-1", repo, "")
+	if err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	done, err := Complete(taskDir, "task-1")
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if done.Outcome != OutcomeLeft || done.Removed {
+		t.Fatalf("unexpected info: %+v", done)
+	}
+	if _, err := os.Stat(info.Path); err != nil {
+		t.Fatalf("worktree removed: %v", err)
+	}
+}
+
+func TestCompleteMergeRefusesDirtyRepository(t *testing.T) {
+	repo := initRepo(t)
+	taskDir := t.TempDir()
+	info, err := Ensure(taskDir, "task-1", repo, PolicyMerge)
+	if err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(info.Path, "b.txt"), []byte("b\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "src", "a.txt"), []byte("dirty\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Complete(taskDir, "task-1"); err == nil || !strings.Contains(err.Error(), "uncommitted") {
+		t.Fatalf("expected uncommitted changes error, got %v", err)
+	}
+	if branches := runGit(t, repo, "branch", "--list", info.Branch); branches == "" {
+		t.Fatalf("task branch must be kept on failure")
+	}
+}
+
+func TestCompleteWithoutChangesRemovesWorktree(t *testing.T) {
+	repo := initRepo(t)
+	taskDir := t.TempDir()
+	info, err := Ensure(taskDir, "task-1", repo, PolicyMerge)
+	if err != nil {
+		t.Fatalf("Ensure: %v", err)
+	}
+	done, err := Complete(taskDir, "task-1")
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if done.Outcome != OutcomeEmpty || !done.Removed {
+		t.Fatalf("unexpected info: %+v", done)
+	}
+	if _, err := os.Stat(info.Path); !os.IsNotExist(err) {
+		t.Fatalf("worktree still present: %v", err)
+	}
+}
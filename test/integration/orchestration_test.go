@@ -686,7 +686,7 @@ func main() {
 
 // buildChainGeminiStub compiles a terminal "gemini" stub into dir. It
 // responds to --help with an "output-format" line (satisfying the
-// checkGeminiStreamJSONSupport version probe), and exits successfully on
+// gemini.CheckStreamJSONSupport probe), and exits successfully on
 // regular invocations.
 func buildChainGeminiStub(t *testing.T, dir string) {
 	t.Helper()
@@ -705,7 +705,7 @@ import (
 func main() {
 	for _, arg := range os.Args[1:] {
 		if arg == "--help" {
-			// Satisfy the checkGeminiStreamJSONSupport version probe.
+			// Satisfy the gemini.CheckStreamJSONSupport probe.
 			fmt.Fprintln(os.Stdout, "--output-format stream-json")
 			return
 		}
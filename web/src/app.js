@@ -23,6 +23,7 @@ const state = {
   projects:        [],
   tasks:           [],
   activeTab:       'task.md',
+  questions:       [],   // open QUESTION messages across projects
 };
 
 let refreshTimer     = null;
@@ -35,6 +36,7 @@ let sseRefreshTimer  = null;
 let refreshInFlight  = false;
 let refreshQueued    = false;
 let selectedRunLastStatus = null;
+let knownQuestionIds = null;
 
 // ── API ──────────────────────────────────────────────────────────────────────
 
@@ -589,6 +591,8 @@ async function fullRefresh() {
     } catch { /* keep */ }
     renderProjectList();
 
+    await refreshQuestions();
+
     // Refresh task list
     if (state.selectedProject) {
       try {
@@ -631,6 +635,67 @@ async function fullRefresh() {
   }
 }
 
+// ── Open questions ────────────────────────────────────────────────────────────
+
+async function refreshQuestions() {
+  try {
+    const data = await apiFetch('/api/v1/questions?status=open');
+    state.questions = data.questions || [];
+  } catch { return; }
+  const ids = new Set(state.questions.map(q => q.msg_id));
+  if (knownQuestionIds) {
+    const fresh = state.questions.filter(q => !knownQuestionIds.has(q.msg_id));
+    if (fresh.length) {
+      showToast(`New question from ${fresh[0].task_id || fresh[0].project_id}`);
+    }
+  }
+  knownQuestionIds = ids;
+  renderQuestions();
+}
+
+function renderQuestions() {
+  const el = document.getElementById('open-questions');
+  if (!el) return;
+  // Keep a half-typed answer across refreshes.
+  if (el.contains(document.activeElement)) return;
+  if (!state.questions.length) {
+    el.style.display = 'none';
+    el.innerHTML = '';
+    return;
+  }
+  el.style.display = '';
+  el.innerHTML = `<div class="panel-hdr">Open questions <span class="badge">${state.questions.length}</span></div>` +
+    state.questions.map((q, i) => `<div class="question-item">
+      <div class="question-src">${h(q.project_id)}${q.task_id ? ' / ' + h(q.task_id) : ''} · ${h(shortTime(q.timestamp))}</div>
+      <div class="question-body">${h((q.body || '').trim())}</div>
+      <textarea id="question-answer-${i}" rows="2" placeholder="Answer..."></textarea>
+      <button onclick="answerQuestion(${i})">Answer</button>
+    </div>`).join('');
+}
+
+async function answerQuestion(index) {
+  const q = state.questions[index];
+  const bodyEl = document.getElementById(`question-answer-${index}`);
+  const body = bodyEl ? bodyEl.value.trim() : '';
+  if (!q || !body) return;
+  try {
+    const resp = await fetch(`${API_BASE}/api/v1/questions/${enc(q.msg_id)}/answer`, {
+      method: 'POST',
+      headers: { ...UI_REQUEST_HEADERS, 'Content-Type': 'application/json' },
+      body: JSON.stringify({ project_id: q.project_id, task_id: q.task_id || '', body }),
+    });
+    if (!resp.ok) {
+      const text = await resp.text();
+      throw new Error(`HTTP ${resp.status}: ${text}`);
+    }
+    bodyEl.blur();
+    showToast('Answer posted');
+    await refreshQuestions();
+  } catch (e) {
+    showToast(`Error: ${e.message}`, true);
+  }
+}
+
 // ── Message compose ───────────────────────────────────────────────────────────
 
 function updateMsgCompose() {
@@ -668,6 +733,12 @@ async function postMessage() {
   }
 }
 
+// Downloads the task message bus as a task log (see GET .../messages/export).
+function exportMessages(format) {
+  if (!state.selectedTask) return;
+  window.location.href = `${API_BASE}${runPrefix()}/messages/export?format=${enc(format)}`;
+}
+
 // ── Helpers ───────────────────────────────────────────────────────────────────
 
 function runPrefix() {
@@ -689,7 +760,8 @@ function msgTypeClass(type) {
     case 'RUN_CRASH':    return 'msg-crash';
     case 'RUN_START':
     case 'RUN_COMPLETE': return 'msg-run';
-    case 'TASK_DONE':    return 'msg-ok';
+    case 'TASK_DONE':
+    case 'ANSWER':       return 'msg-ok';
     case 'USER':
     case 'QUESTION':     return 'msg-user';
     default:             return '';